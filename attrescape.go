@@ -0,0 +1,38 @@
+package quicktemplate
+
+// appendAttrEscape appends src escaped for html attribute value to dst.
+//
+// The escaped value is intended for double-quoted attributes such as
+// <a title="{%a title %}">. It is also safe for single-quoted and unquoted
+// attributes, since quotes, whitespace, '=' and '`' are escaped too.
+func appendAttrEscape(dst []byte, src string) []byte {
+	n := len(src)
+	if n > 0 {
+		// Hint the compiler to remove bounds checks in the loop below.
+		_ = src[n-1]
+	}
+	for i := 0; i < n; i++ {
+		c := src[i]
+		switch c {
+		case '<':
+			dst = append(dst, strLT...)
+		case '>':
+			dst = append(dst, strGT...)
+		case '"':
+			dst = append(dst, strQuot...)
+		case '\'':
+			dst = append(dst, strApos...)
+		case '&':
+			dst = append(dst, strAmp...)
+		case ' ', '\t', '\n', '\r', '\f', '=', '`':
+			dst = append(dst, '&', '#')
+			if c >= 10 {
+				dst = append(dst, '0'+c/10)
+			}
+			dst = append(dst, '0'+c%10, ';')
+		default:
+			dst = append(dst, c)
+		}
+	}
+	return dst
+}
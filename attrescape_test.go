@@ -0,0 +1,24 @@
+package quicktemplate
+
+import (
+	"testing"
+)
+
+func TestAppendAttrEscape(t *testing.T) {
+	testAppendAttrEscape(t, "", "")
+	testAppendAttrEscape(t, "foo", "foo")
+	testAppendAttrEscape(t, "тест/?;:", "тест/?;:")
+	testAppendAttrEscape(t, `a"b`, "a&quot;b")
+	testAppendAttrEscape(t, "a'b", "a&#39;b")
+	testAppendAttrEscape(t, "a b", "a&#32;b")
+	testAppendAttrEscape(t, `"><script>alert('x')</script>`, "&quot;&gt;&lt;script&gt;alert(&#39;x&#39;)&lt;/script&gt;")
+	testAppendAttrEscape(t, "x onclick=alert(1)", "x&#32;onclick&#61;alert(1)")
+	testAppendAttrEscape(t, "\t\n\r\f`&", "&#9;&#10;&#13;&#12;&#96;&amp;")
+}
+
+func testAppendAttrEscape(t *testing.T, s, expectedResult string) {
+	result := appendAttrEscape(nil, s)
+	if string(result) != expectedResult {
+		t.Fatalf("unexpected result %q. Expecting %q. str=%q", result, expectedResult, s)
+	}
+}
@@ -17,6 +17,11 @@ func (b *ByteBuffer) Write(p []byte) (int, error) {
 	return bb(b).Write(p)
 }
 
+// WriteString appends s to the byte buffer.
+func (b *ByteBuffer) WriteString(s string) (int, error) {
+	return bb(b).WriteString(s)
+}
+
 // Reset resets the byte buffer.
 func (b *ByteBuffer) Reset() {
 	bb(b).Reset()
@@ -30,6 +35,19 @@ func AcquireByteBuffer() *ByteBuffer {
 	return (*ByteBuffer)(byteBufferPool.Get())
 }
 
+// AcquireByteBufferSize returns new ByteBuffer from the pool with capacity
+// for at least n bytes.
+//
+// This avoids repeated buffer reallocations if the approximate size
+// of the output is known in advance.
+func AcquireByteBufferSize(n int) *ByteBuffer {
+	b := AcquireByteBuffer()
+	if cap(b.B) < n {
+		b.B = make([]byte, 0, n)
+	}
+	return b
+}
+
 // ReleaseByteBuffer retruns byte buffer to the pool.
 //
 // Do not access byte buffer after returning it to the pool,
@@ -0,0 +1,22 @@
+package quicktemplate
+
+import (
+	"testing"
+)
+
+func TestAcquireByteBufferSize(t *testing.T) {
+	for _, n := range []int{0, 1, 100, 8192} {
+		b := AcquireByteBufferSize(n)
+		if len(b.B) != 0 {
+			t.Fatalf("unexpected non-empty buffer for n=%d: %q", n, b.B)
+		}
+		if cap(b.B) < n {
+			t.Fatalf("unexpected buffer capacity for n=%d: %d", n, cap(b.B))
+		}
+		b.WriteString("foo")
+		if string(b.B) != "foo" {
+			t.Fatalf("unexpected buffer contents for n=%d: %q. Expecting %q", n, b.B, "foo")
+		}
+		ReleaseByteBuffer(b)
+	}
+}
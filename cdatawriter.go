@@ -0,0 +1,75 @@
+package quicktemplate
+
+import (
+	"io"
+	"sync"
+)
+
+// AcquireCDATAWriter returns a writer for CDATA section contents
+// written to qw.
+//
+// Every "]]>" in the written data is split between two adjacent
+// CDATA sections, so the data cannot terminate the CDATA section.
+// Sequences split between multiple writes are handled too.
+//
+// Return unneeded writer to the pool by calling ReleaseCDATAWriter.
+func AcquireCDATAWriter(qw *Writer) *Writer {
+	v := cdataWriterPool.Get()
+	if v == nil {
+		v = &cdataWriter{}
+	}
+	cw := v.(*cdataWriter)
+	// Write via qw.N(), so write errors are visible in qw.Err().
+	cw.w = qw.N()
+	return AcquireWriter(cw)
+}
+
+// ReleaseCDATAWriter returns the writer obtained via AcquireCDATAWriter
+// to the pool.
+//
+// Do not access released writer, otherwise data races may occur.
+func ReleaseCDATAWriter(qw *Writer) {
+	cw := qw.W().(*cdataWriter)
+	ReleaseWriter(qw)
+	cw.w = nil
+	cw.brackets = 0
+	cdataWriterPool.Put(cw)
+}
+
+var cdataWriterPool sync.Pool
+
+type cdataWriter struct {
+	w io.Writer
+
+	// brackets is the number of trailing ']' chars written to w.
+	brackets int
+}
+
+func (w *cdataWriter) Write(b []byte) (int, error) {
+	write := w.w.Write
+	j := 0
+	for i, c := range b {
+		if c == ']' {
+			w.brackets++
+			continue
+		}
+		if c == '>' && w.brackets >= 2 {
+			// "]]" is already written, so terminate the current
+			// CDATA section and start the next one before '>'.
+			if n, err := write(b[j:i]); err != nil {
+				return j + n, err
+			}
+			if _, err := write(strCDATASplit); err != nil {
+				return i, err
+			}
+			j = i
+		}
+		w.brackets = 0
+	}
+	if n, err := write(b[j:]); err != nil {
+		return j + n, err
+	}
+	return len(b), nil
+}
+
+var strCDATASplit = []byte("]]><![CDATA[")
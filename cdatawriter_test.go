@@ -0,0 +1,33 @@
+package quicktemplate
+
+import (
+	"testing"
+)
+
+func TestCDATAWriter(t *testing.T) {
+	testCDATAWriter(t, nil, "")
+	testCDATAWriter(t, []string{"foo bar"}, "foo bar")
+	testCDATAWriter(t, []string{"]]>"}, "]]]]><![CDATA[>")
+	testCDATAWriter(t, []string{"a]]>b]]]>c]>d]] >e"}, "a]]]]><![CDATA[>b]]]]]><![CDATA[>c]>d]] >e")
+	testCDATAWriter(t, []string{"<![CDATA[x]]>"}, "<![CDATA[x]]]]><![CDATA[>")
+
+	// "]]>" split between writes
+	testCDATAWriter(t, []string{"a]", "]", ">b"}, "a]]]]><![CDATA[>b")
+	testCDATAWriter(t, []string{"a]]", ">"}, "a]]]]><![CDATA[>")
+	testCDATAWriter(t, []string{"a]", "b]", ">"}, "a]b]>")
+}
+
+func testCDATAWriter(t *testing.T, writes []string, expectedS string) {
+	bb := AcquireByteBuffer()
+	qw := AcquireWriter(bb)
+	cqw := AcquireCDATAWriter(qw)
+	for _, s := range writes {
+		cqw.N().S(s)
+	}
+	ReleaseCDATAWriter(cqw)
+	ReleaseWriter(qw)
+	if string(bb.B) != expectedS {
+		t.Fatalf("unexpected output: %q. Expecting %q. writes=%q", bb.B, expectedS, writes)
+	}
+	ReleaseByteBuffer(bb)
+}
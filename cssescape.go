@@ -0,0 +1,46 @@
+package quicktemplate
+
+// appendCSSEscape appends src escaped for css value to dst.
+//
+// The escaped value is intended for css property values inside
+// <style> and style="..." attributes, such as color: {%css color %}.
+// Only alphanumerics, non-ascii chars and -_.,#% are left as is,
+// while the rest is hex-escaped, so the value cannot close
+// the declaration or the block with ';' or '}', open a comment
+// with /* or break out of the attribute or the <style> element.
+func appendCSSEscape(dst []byte, src string) []byte {
+	n := len(src)
+	if n > 0 {
+		// Hint the compiler to remove bounds checks in the loop below.
+		_ = src[n-1]
+	}
+	for i := 0; i < n; i++ {
+		c := src[i]
+		if isCSSSafeChar(c) {
+			dst = append(dst, c)
+			continue
+		}
+		// The trailing space terminates the hex escape, so the next char
+		// isn't treated as a part of it. The space is consumed by css parser.
+		dst = append(dst, '\\')
+		if c >= 16 {
+			dst = append(dst, hexCharLower(c>>4))
+		}
+		dst = append(dst, hexCharLower(c&15), ' ')
+	}
+	return dst
+}
+
+func isCSSSafeChar(c byte) bool {
+	if c >= 0x80 {
+		return true
+	}
+	if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' {
+		return true
+	}
+	switch c {
+	case '-', '_', '.', ',', '#', '%':
+		return true
+	}
+	return false
+}
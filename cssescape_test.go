@@ -0,0 +1,28 @@
+package quicktemplate
+
+import (
+	"testing"
+)
+
+func TestAppendCSSEscape(t *testing.T) {
+	testAppendCSSEscape(t, "", "")
+	testAppendCSSEscape(t, "red", "red")
+	testAppendCSSEscape(t, "#fff", "#fff")
+	testAppendCSSEscape(t, "1.5em", "1.5em")
+	testAppendCSSEscape(t, "50%", "50%")
+	testAppendCSSEscape(t, "sans-serif,Arial_1", "sans-serif,Arial_1")
+	testAppendCSSEscape(t, "тест", "тест")
+	testAppendCSSEscape(t, "red;background:url(x)", `red\3b background\3a url\28 x\29 `)
+	testAppendCSSEscape(t, "red}body{color:red", `red\7d body\7b color\3a red`)
+	testAppendCSSEscape(t, "/* x */", `\2f \2a \20 x\20 \2a \2f `)
+	testAppendCSSEscape(t, `</style><script>`, `\3c \2f style\3e \3c script\3e `)
+	testAppendCSSEscape(t, `a"b'c\d`, `a\22 b\27 c\5c d`)
+	testAppendCSSEscape(t, "\x00\n", `\0 \a `)
+}
+
+func testAppendCSSEscape(t *testing.T, s, expectedResult string) {
+	result := appendCSSEscape(nil, s)
+	if string(result) != expectedResult {
+		t.Fatalf("unexpected result %q. Expecting %q. str=%q", result, expectedResult, s)
+	}
+}
@@ -1,5 +1,7 @@
 module github.com/valyala/quicktemplate
 
+go 1.23
+
 require (
 	github.com/klauspost/compress v1.4.0 // indirect
 	github.com/klauspost/cpuid v0.0.0-20180405133222-e7e905edc00e // indirect
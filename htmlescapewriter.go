@@ -21,33 +21,32 @@ func (w *htmlEscapeWriter) Write(b []byte) (int, error) {
 	}
 
 	// slow path
-	write := w.w.Write
 	j := 0
 	for i, c := range b {
+		var e []byte
 		switch c {
 		case '<':
-			write(b[j:i])
-			write(strLT)
-			j = i + 1
+			e = strLT
 		case '>':
-			write(b[j:i])
-			write(strGT)
-			j = i + 1
+			e = strGT
 		case '"':
-			write(b[j:i])
-			write(strQuot)
-			j = i + 1
+			e = strQuot
 		case '\'':
-			write(b[j:i])
-			write(strApos)
-			j = i + 1
+			e = strApos
 		case '&':
-			write(b[j:i])
-			write(strAmp)
-			j = i + 1
+			e = strAmp
+		default:
+			continue
 		}
+		if n, err := w.w.Write(b[j:i]); err != nil {
+			return j + n, err
+		}
+		if _, err := w.w.Write(e); err != nil {
+			return i, err
+		}
+		j = i + 1
 	}
-	if n, err := write(b[j:]); err != nil {
+	if n, err := w.w.Write(b[j:]); err != nil {
 		return j + n, err
 	}
 	return len(b), nil
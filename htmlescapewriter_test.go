@@ -27,3 +27,15 @@ func testHTMLEscapeWriter(t *testing.T, s, expectedS string) {
 	}
 	ReleaseByteBuffer(bb)
 }
+
+func TestHTMLEscapeWriterError(t *testing.T) {
+	fw := &testFailingWriter{n: 5}
+	w := &htmlEscapeWriter{w: fw}
+	n, err := w.Write([]byte("foo<bar>"))
+	if err != errTestFailingWriter {
+		t.Fatalf("unexpected error: %v. Expecting %v", err, errTestFailingWriter)
+	}
+	if n != 3 {
+		t.Fatalf("unexpected n returned: %d. Expecting 3", n)
+	}
+}
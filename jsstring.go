@@ -0,0 +1,65 @@
+package quicktemplate
+
+// appendJSString appends src escaped for js string literal to dst.
+//
+// The escaped value is safe inside '...' and "..." js string literals
+// in inline <script>, since '<' is escaped, so neither </script>
+// nor <!-- may appear in the output.
+func appendJSString(dst []byte, src string) []byte {
+	n := len(src)
+	if n > 0 {
+		// Hint the compiler to remove bounds checks in the loop below.
+		_ = src[n-1]
+	}
+	for i := 0; i < n; i++ {
+		c := src[i]
+		switch c {
+		case '"':
+			dst = append(dst, '\\', '"')
+		case '\'':
+			dst = append(dst, '\\', '\'')
+		case '\\':
+			dst = append(dst, '\\', '\\')
+		case '\n':
+			dst = append(dst, '\\', 'n')
+		case '\r':
+			dst = append(dst, '\\', 'r')
+		case '\t':
+			dst = append(dst, '\\', 't')
+		case '<', '>', '&':
+			dst = appendJSUnicodeEscape(dst, rune(c))
+		case 0xe2:
+			// U+2028 and U+2029 are line terminators in js.
+			if i+2 < n && src[i+1] == 0x80 && (src[i+2] == 0xa8 || src[i+2] == 0xa9) {
+				r := rune(0x2028)
+				if src[i+2] == 0xa9 {
+					r = 0x2029
+				}
+				dst = appendJSUnicodeEscape(dst, r)
+				i += 2
+			} else {
+				dst = append(dst, c)
+			}
+		default:
+			if c < 0x20 {
+				dst = appendJSUnicodeEscape(dst, rune(c))
+			} else {
+				dst = append(dst, c)
+			}
+		}
+	}
+	return dst
+}
+
+func appendJSUnicodeEscape(dst []byte, r rune) []byte {
+	return append(dst, '\\', 'u',
+		hexCharLower(byte(r>>12)&15), hexCharLower(byte(r>>8)&15),
+		hexCharLower(byte(r>>4)&15), hexCharLower(byte(r)&15))
+}
+
+func hexCharLower(c byte) byte {
+	if c < 10 {
+		return '0' + c
+	}
+	return c - 10 + 'a'
+}
@@ -0,0 +1,30 @@
+package quicktemplate
+
+import (
+	"testing"
+)
+
+func TestAppendJSString(t *testing.T) {
+	testAppendJSString(t, "", "")
+	testAppendJSString(t, "foo bar", "foo bar")
+	testAppendJSString(t, "привет", "привет")
+	testAppendJSString(t, `say "hi" 'there'`, `say \"hi\" \'there\'`)
+	testAppendJSString(t, `</script><script>alert(1)</script>`, `\u003c/script\u003e\u003cscript\u003ealert(1)\u003c/script\u003e`)
+	testAppendJSString(t, "<!-- foo -->", `\u003c!-- foo --\u003e`)
+	testAppendJSString(t, "foo\nbar\r\n\tbaz", `foo\nbar\r\n\tbaz`)
+	testAppendJSString(t, `\`, `\\`)
+	testAppendJSString(t, "a&b", `a\u0026b`)
+	testAppendJSString(t, "\x00\x1f\b\f", `\u0000\u001f\u0008\u000c`)
+	testAppendJSString(t, "a\u2028b\u2029c", `a\u2028b\u2029c`)
+
+	// other runes starting with 0xe2 byte are left as is
+	testAppendJSString(t, "\u2027\u202a\u20ac", "\u2027\u202a\u20ac")
+	testAppendJSString(t, "\xe2\x80", "\xe2\x80")
+}
+
+func testAppendJSString(t *testing.T, s, expectedResult string) {
+	result := appendJSString(nil, s)
+	if string(result) != expectedResult {
+		t.Fatalf("unexpected result %q. Expecting %q. str=%q", result, expectedResult, s)
+	}
+}
@@ -0,0 +1,86 @@
+package quicktemplate
+
+import (
+	"context"
+	"iter"
+	"reflect"
+	"unicode/utf8"
+)
+
+// Loop contains the state of {% for ... range %} loop.
+//
+// The state is available via loop variable inside the loop body.
+type Loop struct {
+	// Index is zero-based index of the current iteration.
+	Index int
+
+	// Len is the length of the range expression.
+	Len int
+
+	// First is set on the first iteration.
+	First bool
+
+	// Last is set on the last iteration.
+	Last bool
+}
+
+// NewLoop returns the state for the loop with n iterations.
+//
+// It is used by the generated code.
+func NewLoop(n int) Loop {
+	return Loop{
+		Index: -1,
+		Len:   n,
+	}
+}
+
+// NewRangeLoop returns the state for the loop over x with n iterations,
+// where n must be len(x).
+//
+// Strings are iterated by runes, so the loop over string contains
+// as many iterations as there are runes in it.
+//
+// It is used by the generated code, since the type of x is unknown
+// to the template compiler.
+func NewRangeLoop[T any](x T, n int) Loop {
+	if reflect.TypeFor[T]().Kind() == reflect.String {
+		n = utf8.RuneCountInString(reflect.ValueOf(x).String())
+	}
+	return NewLoop(n)
+}
+
+// Next advances the loop state to the next iteration.
+//
+// It is called by the generated code at the start of every iteration.
+func (l *Loop) Next() {
+	l.Index++
+	l.First = l.Index == 0
+	l.Last = l.Index == l.Len-1
+}
+
+// RecvContext returns the sequence of values received from ch until ch
+// is closed or ctx is done.
+//
+// It is used by the generated code for {% for x in <-ch while ctx %} loops.
+func RecvContext[T any](ctx context.Context, ch <-chan T) iter.Seq[T] {
+	return func(yield func(T) bool) {
+		done := ctx.Done()
+		for {
+			// Check ctx before receiving, since select picks a random case
+			// when both ctx is done and ch has values.
+			select {
+			case <-done:
+				return
+			default:
+			}
+			select {
+			case <-done:
+				return
+			case v, ok := <-ch:
+				if !ok || !yield(v) {
+					return
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package quicktemplate
+
+import (
+	"context"
+	"testing"
+)
+
+func TestLoop(t *testing.T) {
+	loop := NewLoop(3)
+	for i := 0; i < 3; i++ {
+		loop.Next()
+		if loop.Index != i {
+			t.Fatalf("unexpected Index: %d. Expecting %d", loop.Index, i)
+		}
+		if loop.Len != 3 {
+			t.Fatalf("unexpected Len: %d. Expecting 3", loop.Len)
+		}
+		if loop.First != (i == 0) {
+			t.Fatalf("unexpected First: %v at iteration %d", loop.First, i)
+		}
+		if loop.Last != (i == 2) {
+			t.Fatalf("unexpected Last: %v at iteration %d", loop.Last, i)
+		}
+	}
+
+	loop = NewLoop(1)
+	loop.Next()
+	if !loop.First || !loop.Last {
+		t.Fatalf("the only iteration must be the first and the last: %+v", loop)
+	}
+}
+
+func TestNewRangeLoop(t *testing.T) {
+	type myString string
+
+	f := func(loop Loop, expectedLen int) {
+		t.Helper()
+		if loop.Len != expectedLen {
+			t.Fatalf("unexpected Len: %d. Expecting %d", loop.Len, expectedLen)
+		}
+		if loop.Index != -1 {
+			t.Fatalf("unexpected Index: %d. Expecting -1", loop.Index)
+		}
+	}
+
+	// strings are iterated by runes
+	s := "hé!"
+	f(NewRangeLoop(s, len(s)), 3)
+	ms := myString("привет")
+	f(NewRangeLoop(ms, len(ms)), 6)
+	f(NewRangeLoop("", 0), 0)
+
+	// other types
+	a := []string{"é", "b"}
+	f(NewRangeLoop(a, len(a)), 2)
+	m := map[string]int{"é": 1}
+	f(NewRangeLoop(m, len(m)), 1)
+	arr := [4]byte{}
+	f(NewRangeLoop(&arr, len(&arr)), 4)
+
+	// the last rune is the last iteration
+	loop := NewRangeLoop(s, len(s))
+	n := 0
+	for range s {
+		loop.Next()
+		n++
+		if loop.Last != (n == 3) {
+			t.Fatalf("unexpected Last: %v at iteration %d", loop.Last, n)
+		}
+	}
+}
+
+func TestRecvContext(t *testing.T) {
+	ch := make(chan int, 5)
+	for i := 0; i < 5; i++ {
+		ch <- i
+	}
+	close(ch)
+
+	// closed channel
+	var got []int
+	for v := range RecvContext(context.Background(), ch) {
+		got = append(got, v)
+	}
+	if len(got) != 5 {
+		t.Fatalf("unexpected values received: %v. Expecting 5 values", got)
+	}
+	for i, v := range got {
+		if v != i {
+			t.Fatalf("unexpected value #%d: %d. Expecting %d", i, v, i)
+		}
+	}
+
+	// cancellation stops receiving
+	ch = make(chan int, 5)
+	for i := 0; i < 5; i++ {
+		ch <- i
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	got = got[:0]
+	for v := range RecvContext(ctx, ch) {
+		got = append(got, v)
+		if v == 1 {
+			cancel()
+		}
+	}
+	if len(got) != 2 {
+		t.Fatalf("unexpected values received after cancel: %v. Expecting [0 1]", got)
+	}
+
+	// done ctx doesn't block on the empty channel
+	for v := range RecvContext(ctx, make(chan int)) {
+		t.Fatalf("unexpected value received: %d", v)
+	}
+
+	// break stops receiving
+	ch = make(chan int, 2)
+	ch <- 1
+	ch <- 2
+	for range RecvContext(context.Background(), ch) {
+		break
+	}
+	if len(ch) != 1 {
+		t.Fatalf("unexpected number of values left in ch: %d. Expecting 1", len(ch))
+	}
+}
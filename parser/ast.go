@@ -0,0 +1,584 @@
+package parser
+
+import (
+	"fmt"
+	"io"
+)
+
+// Template is a parsed template file.
+//
+// Use ParseAST for obtaining Template.
+type Template struct {
+	FilePath string
+	Nodes    []Node
+}
+
+// Node is a node in the template tree.
+type Node interface {
+	// Line returns the line number the node starts at.
+	Line() int
+}
+
+// Pos holds the position of the node in the template file.
+type Pos struct {
+	LineNum int
+}
+
+// Line implements Node.
+func (p Pos) Line() int {
+	return p.LineNum
+}
+
+// Text is a static text.
+//
+// Text outside funcs is a comment.
+type Text struct {
+	Pos
+	Value string
+}
+
+// Output is an output tag such as {%s x %} or {%d= n %}.
+type Output struct {
+	Pos
+
+	// Filter is the tag name, i.e. "s", "d=", "f.2", "s?".
+	Filter string
+	Expr   string
+}
+
+// Call is a func template call such as {%= F() %} or {%=h F() %}.
+type Call struct {
+	Pos
+
+	// Filter is the tag name, i.e. "=", "=h", "=uh".
+	Filter string
+	Expr   string
+}
+
+// Code is a {% code %} tag.
+type Code struct {
+	Pos
+	Code string
+
+	// Block is set for {% code %} ... {% endcode %} block.
+	Block bool
+
+	// Package is set for {% code package %} ... {% endcode %} block.
+	Package bool
+}
+
+// FuncDef is a {% func %} or {% macro %} definition.
+type FuncDef struct {
+	Pos
+
+	// Def is the func definition without the 'func' keyword, i.e. "F(n int)".
+	Def  string
+	Body []Node
+
+	// Macro is set for {% macro %} definition.
+	Macro bool
+
+	// EndName is the func name in the end tag, i.e. "F" for {% endfunc F %}.
+	// It is empty for the end tag without the name.
+	EndName string
+}
+
+// For is a {% for %} loop.
+type For struct {
+	Pos
+	Stmt string
+	Body []Node
+}
+
+// If is a {% if %} statement with optional elseif and else branches.
+//
+// {% unless %} statement is represented as If with the first branch
+// having "unless" tag.
+type If struct {
+	Pos
+	Branches []*IfBranch
+}
+
+// IfBranch is a branch of If.
+type IfBranch struct {
+	Pos
+
+	// Tag is one of "if", "unless", "elseif", "elif" or "else".
+	Tag  string
+	Cond string
+	Body []Node
+}
+
+// Switch is a {% switch %} statement.
+type Switch struct {
+	Pos
+	Stmt string
+
+	// Comment is the text before the first case.
+	Comment string
+	Cases   []*Case
+}
+
+// Case is a {% case %} or {% default %} branch of Switch.
+type Case struct {
+	Pos
+
+	// Tag is either "case" or "default".
+	Tag  string
+	Expr string
+	Body []Node
+}
+
+// Raw is a block with unparsed contents, i.e. {% plain %} or {% comment %}.
+type Raw struct {
+	Pos
+	Name  string
+	Value string
+}
+
+// Block is a block tag not covered by other node types,
+// i.e. {% stripspace %}, {% collapsespace %}, {% stripnewlines %},
+// {% cdata %}, {% spaceless %} or {% with %}.
+type Block struct {
+	Pos
+	Name     string
+	Contents string
+	Body     []Node
+}
+
+// Tag is a standalone tag not covered by other node types,
+// i.e. {% import %}, {% return %} or {% cat %}.
+type Tag struct {
+	Pos
+	Name     string
+	Contents string
+}
+
+// blockEndTags maps Block tag names to the corresponding end tags.
+var blockEndTags = map[string]string{
+	"stripspace":    "endstripspace",
+	"collapsespace": "endcollapsespace",
+	"stripnewlines": "endstripnewlines",
+	"cdata":         "endcdata",
+	"spaceless":     "endspaceless",
+	"with":          "endwith",
+}
+
+// rawEndTags maps Raw tag names to the corresponding end tags.
+var rawEndTags = map[string]string{
+	"plain":   "endplain",
+	"comment": "endcomment",
+}
+
+// topLevelTags contains the tags, which may be used outside funcs.
+var topLevelTags = map[string]bool{
+	"func":      true,
+	"macro":     true,
+	"code":      true,
+	"const":     true,
+	"interface": true,
+	"iface":     true,
+	"import":    true,
+	"package":   true,
+	"build":     true,
+}
+
+// funcTags contains the tags other than output tags, which may be used
+// inside funcs. It must be in sync with parser.tryParseCommonTags.
+var funcTags = map[string]bool{
+	"fallthrough": true,
+	"return":      true,
+	"cdata":       true,
+	"spaceless":   true,
+	"break":       true,
+	"continue":    true,
+	"sep":         true,
+	"code":        true,
+	"defer":       true,
+	"printf":      true,
+	"raw":         true,
+	"copy":        true,
+	"assign":      true,
+	"with":        true,
+	"for":         true,
+	"if":          true,
+	"unless":      true,
+	"switch":      true,
+	"cat":         true,
+	"include":     true,
+	"func":        true,
+	"macro":       true,
+}
+
+// scannerTags contains the tags handled by the scanner, so they may be
+// used both inside and outside funcs.
+var scannerTags = map[string]bool{
+	"#":             true,
+	"comment":       true,
+	"plain":         true,
+	"stripspace":    true,
+	"collapsespace": true,
+	"stripnewlines": true,
+	"space":         true,
+	"newline":       true,
+}
+
+// callTags contains the tags for func template calls.
+var callTags = map[string]bool{
+	"=":   true,
+	"=h":  true,
+	"=u":  true,
+	"=uh": true,
+	"=q":  true,
+	"=qh": true,
+	"=j":  true,
+	"=jh": true,
+}
+
+// emptyContentsTags contains the tags, which cannot have contents.
+var emptyContentsTags = map[string]bool{
+	"else":         true,
+	"default":      true,
+	"fallthrough":  true,
+	"cdata":        true,
+	"spaceless":    true,
+	"endfor":       true,
+	"endif":        true,
+	"endunless":    true,
+	"endswitch":    true,
+	"endcdata":     true,
+	"endspaceless": true,
+	"endwith":      true,
+}
+
+// ParseAST parses the template from r into the tree of nodes.
+//
+// ParseAST is the structural parser, which is independent of the parser
+// generating the code. It verifies the same template structure:
+// tag names, the nesting of blocks and their end tags, tags allowed
+// inside and outside funcs and the order of build, package and import tags.
+// Go code inside tags, func definitions and modifiers aren't verified
+// and are returned as is, while tags such as break, sep or fallthrough
+// aren't checked against the enclosing blocks. Use CompileString for
+// complete verification.
+//
+// Errors found in the template are returned as ParseError.
+//
+// Unlike the code generator, ParseAST requires stripspace, collapsespace
+// and stripnewlines blocks to be properly nested with other blocks.
+func ParseAST(r io.Reader, filePath string) (*Template, error) {
+	s := newScanner(r, filePath)
+	s.raw = true
+	a := &astParser{
+		s: s,
+	}
+	nodes, _, err := a.parseNodes()
+	if err != nil {
+		return nil, newParseError(s, err)
+	}
+	return &Template{
+		FilePath: filePath,
+		Nodes:    nodes,
+	}, nil
+}
+
+// Walk calls fn for each node in depth-first order.
+//
+// Children of the node are skipped if fn returns false.
+func Walk(nodes []Node, fn func(n Node) bool) {
+	for _, n := range nodes {
+		if !fn(n) {
+			continue
+		}
+		switch x := n.(type) {
+		case *FuncDef:
+			Walk(x.Body, fn)
+		case *For:
+			Walk(x.Body, fn)
+		case *If:
+			for _, b := range x.Branches {
+				if fn(b) {
+					Walk(b.Body, fn)
+				}
+			}
+		case *Switch:
+			for _, c := range x.Cases {
+				if fn(c) {
+					Walk(c.Body, fn)
+				}
+			}
+		case *Block:
+			Walk(x.Body, fn)
+		}
+	}
+}
+
+type astParser struct {
+	s *scanner
+
+	// funcDepth is the number of funcs enclosing the current node.
+	funcDepth int
+
+	// The state of the tags, which must be at the top of the template.
+	buildFound   bool
+	packageFound bool
+	importFound  bool
+	declFound    bool
+}
+
+// parseNodes parses nodes until one of endTags is found.
+//
+// The found end tag is returned.
+func (a *astParser) parseNodes(endTags ...string) ([]Node, *Tag, error) {
+	s := a.s
+	var nodes []Node
+	for s.Next() {
+		t := s.Token()
+		pos := Pos{LineNum: t.line + 1}
+		switch t.ID {
+		case text:
+			nodes = append(nodes, &Text{Pos: pos, Value: string(t.Value)})
+			continue
+		case tagName:
+		default:
+			return nil, nil, errorf(KindUnexpectedToken, "unexpected token found %s at %s", t, s.Context())
+		}
+
+		name := string(t.Value)
+		ct, err := expectTagContents(s)
+		if err != nil {
+			return nil, nil, err
+		}
+		contents := string(ct.Value)
+		if emptyContentsTags[name] && len(contents) > 0 {
+			return nil, nil, errorf(KindUnexpectedToken, "unexpected extra value after %s: %q at %s", name, contents, s.Context())
+		}
+		for _, endTag := range endTags {
+			if name == endTag {
+				return nodes, &Tag{Pos: pos, Name: name, Contents: contents}, nil
+			}
+		}
+
+		if isClosingTag(name) {
+			return nil, nil, errorf(KindUnexpectedToken, "unexpected tag found: %q at %s", name, s.Context())
+		}
+		if err := a.checkTag(name); err != nil {
+			return nil, nil, err
+		}
+
+		var n Node
+		switch name {
+		case "func", "macro":
+			n, err = a.parseFuncDef(pos, name, contents)
+		case "for":
+			n, err = a.parseFor(pos, contents)
+		case "if", "unless":
+			n, err = a.parseIf(pos, name, contents)
+		case "switch":
+			n, err = a.parseSwitch(pos, contents)
+		case "code":
+			n, err = a.parseCode(pos, contents)
+		default:
+			n, err = a.parseOtherTag(pos, name, contents)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		nodes = append(nodes, n)
+	}
+	if err := s.LastError(); err != nil {
+		return nil, nil, fmt.Errorf("cannot parse template: %w", err)
+	}
+	if len(endTags) > 0 {
+		return nil, nil, errorf(KindUnclosedTag, "cannot find %s tag at %s", endTags[len(endTags)-1], s.Context())
+	}
+	return nodes, nil, nil
+}
+
+// checkTag verifies whether the tag with the given name may be used
+// at the current position.
+func (a *astParser) checkTag(name string) error {
+	s := a.s
+	if scannerTags[name] {
+		return nil
+	}
+	if a.funcDepth > 0 {
+		if !funcTags[name] && !isOutputOrCallTag(name) {
+			return errorf(KindUnexpectedToken, "unexpected tag found: %q at %s", name, s.Context())
+		}
+		return nil
+	}
+	if !topLevelTags[name] {
+		return errorf(KindUnexpectedToken, "unexpected tag found outside func: %q at %s", name, s.Context())
+	}
+	switch name {
+	case "build":
+		if a.buildFound || a.packageFound || a.importFound || a.declFound {
+			return errorf(KindMisplacedTag, "build constraint must be at the top of the template before package name. Found at %s", s.Context())
+		}
+		a.buildFound = true
+	case "package":
+		if a.packageFound || a.importFound || a.declFound {
+			return errorf(KindMisplacedTag, "package name must be at the top of the template. Found at %s", s.Context())
+		}
+		a.packageFound = true
+	case "import":
+		if a.declFound {
+			return errorf(KindMisplacedTag, "imports must be at the top of the template. Found at %s", s.Context())
+		}
+		a.importFound = true
+	default:
+		a.declFound = true
+	}
+	return nil
+}
+
+// isOutputOrCallTag returns true if name is the name of output tag
+// such as "s", "f.2=" or "v:stringer", or the name of func call tag such as "=h".
+func isOutputOrCallTag(name string) bool {
+	tagNameStr, safeDeref := splitSafeDerefTagName(name)
+	tagNameStr, _ = splitTagNamePrec(tagNameStr)
+	tagNameStr, _, err := splitTagNameType(tagNameStr)
+	if err != nil {
+		return false
+	}
+	if isOutputTagName(tagNameStr) {
+		return true
+	}
+	return !safeDeref && callTags[tagNameStr]
+}
+
+func isClosingTag(name string) bool {
+	switch name {
+	case "endfunc", "endmacro", "endfor", "endif", "endunless", "elseif", "elif", "else", "case", "default", "endswitch", "endcode":
+		return true
+	}
+	for _, endTag := range blockEndTags {
+		if name == endTag {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *astParser) parseFuncDef(pos Pos, name, def string) (Node, error) {
+	a.funcDepth++
+	body, end, err := a.parseNodes("end" + name)
+	a.funcDepth--
+	if err != nil {
+		return nil, err
+	}
+	if len(end.Contents) > 0 {
+		// Invalid func definitions are reported by the code generator.
+		if f, err := parseFuncDef([]byte(def)); err == nil && f.name != end.Contents {
+			return nil, errorf(KindUnexpectedToken, "%s %s at %s doesn't match %s %s defined at %s:%d",
+				end.Name, end.Contents, a.s.Context(), name, f.name, a.s.filePath, pos.LineNum)
+		}
+	}
+	return &FuncDef{Pos: pos, Def: def, Body: body, Macro: name == "macro", EndName: end.Contents}, nil
+}
+
+func (a *astParser) parseCode(pos Pos, contents string) (Node, error) {
+	isPackage := isPackageCodeTag([]byte(contents))
+	if !isPackage && len(contents) > 0 {
+		return &Code{Pos: pos, Code: contents}, nil
+	}
+	if !isPackage {
+		// Empty code tag without endcode is no-op.
+		if !a.s.readCodeBlock() {
+			return &Code{Pos: pos}, nil
+		}
+		return &Code{Pos: pos, Code: string(a.s.Token().Value), Block: true}, nil
+	}
+	v, ok := a.s.readRawUntilTag("endcode")
+	if !ok {
+		return nil, errorf(KindUnclosedTag, "cannot parse code block: %w", a.s.err)
+	}
+	return &Code{Pos: pos, Code: string(v), Block: true, Package: true}, nil
+}
+
+func (a *astParser) parseFor(pos Pos, stmt string) (Node, error) {
+	body, _, err := a.parseNodes("endfor")
+	if err != nil {
+		return nil, err
+	}
+	return &For{Pos: pos, Stmt: stmt, Body: body}, nil
+}
+
+func (a *astParser) parseIf(pos Pos, tag, cond string) (Node, error) {
+	n := &If{Pos: pos}
+	b := &IfBranch{Pos: pos, Tag: tag, Cond: cond}
+	endTags := []string{"elseif", "elif", "else", "endif"}
+	if tag == "unless" {
+		endTags = []string{"else", "endunless"}
+	}
+	for {
+		body, end, err := a.parseNodes(endTags...)
+		if err != nil {
+			return nil, err
+		}
+		b.Body = body
+		n.Branches = append(n.Branches, b)
+		if end.Name == endTags[len(endTags)-1] {
+			return n, nil
+		}
+		if b.Tag == "else" {
+			return nil, errorf(KindUnexpectedToken, "unexpected %s tag after else at %s", end.Name, a.s.Context())
+		}
+		b = &IfBranch{Pos: end.Pos, Tag: end.Name, Cond: end.Contents}
+	}
+}
+
+func (a *astParser) parseSwitch(pos Pos, stmt string) (Node, error) {
+	n := &Switch{Pos: pos, Stmt: stmt}
+	comment, end, err := a.parseNodes("case", "default", "endswitch")
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range comment {
+		t, ok := c.(*Text)
+		if !ok {
+			return nil, errorf(KindUnexpectedToken, "unexpected tag found before the first case in switch at line %d", c.Line())
+		}
+		n.Comment += t.Value
+	}
+	for end.Name != "endswitch" {
+		c := &Case{Pos: end.Pos, Tag: end.Name, Expr: end.Contents}
+		c.Body, end, err = a.parseNodes("case", "default", "endswitch")
+		if err != nil {
+			return nil, err
+		}
+		n.Cases = append(n.Cases, c)
+	}
+	return n, nil
+}
+
+func (a *astParser) parseOtherTag(pos Pos, name, contents string) (Node, error) {
+	if endTag, ok := rawEndTags[name]; ok {
+		v, ok := a.s.readRawUntilTag(endTag)
+		if !ok {
+			return nil, errorf(KindUnclosedTag, "cannot parse %s: %w", name, a.s.err)
+		}
+		return &Raw{Pos: pos, Name: name, Value: string(v)}, nil
+	}
+	if endTag, ok := blockEndTags[name]; ok {
+		body, _, err := a.parseNodes(endTag)
+		if err != nil {
+			return nil, err
+		}
+		return &Block{Pos: pos, Name: name, Contents: contents, Body: body}, nil
+	}
+
+	tagNameStr, _ := splitSafeDerefTagName(name)
+	tagNameStr, _ = splitTagNamePrec(tagNameStr)
+	if t, _, err := splitTagNameType(tagNameStr); err == nil {
+		tagNameStr = t
+	}
+	if isOutputTagName(tagNameStr) {
+		return &Output{Pos: pos, Filter: name, Expr: contents}, nil
+	}
+	if len(name) > 0 && name[0] == '=' {
+		return &Call{Pos: pos, Filter: name, Expr: contents}, nil
+	}
+	return &Tag{Pos: pos, Name: name, Contents: contents}, nil
+}
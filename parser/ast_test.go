@@ -0,0 +1,320 @@
+package parser
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseASTFuncForOutput(t *testing.T) {
+	tpl := testParseASTSuccess(t, `Greetings
+{% func Greet(names []string) %}
+	{% for _, name := range names %}
+		Hello, {%s name %}!
+	{% endfor %}
+{% endfunc %}`)
+	expectedNodes := []Node{
+		&Text{Pos: Pos{1}, Value: "Greetings\n"},
+		&FuncDef{Pos: Pos{2}, Def: "Greet(names []string)", Body: []Node{
+			&Text{Pos: Pos{2}, Value: "\n\t"},
+			&For{Pos: Pos{3}, Stmt: "_, name := range names", Body: []Node{
+				&Text{Pos: Pos{3}, Value: "\n\t\tHello, "},
+				&Output{Pos: Pos{4}, Filter: "s", Expr: "name"},
+				&Text{Pos: Pos{4}, Value: "!\n\t"},
+			}},
+			&Text{Pos: Pos{5}, Value: "\n"},
+		}},
+	}
+	if !reflect.DeepEqual(tpl.Nodes, expectedNodes) {
+		t.Fatalf("unexpected nodes\n%s\nExpecting\n%s", dumpNodes(tpl.Nodes), dumpNodes(expectedNodes))
+	}
+}
+
+func TestParseASTIfSwitch(t *testing.T) {
+	tpl := testParseASTSuccess(t, `{% func F(n int) %}{% if n == 1 %}one{% elseif n == 2 %}{%= two() %}{% else %}{% code x := n %}{%d= x %}{% endif %}`+
+		`{% switch n %}comment{% case 1 %}a{% break %}{% default %}b{% endswitch %}{% endfunc %}`)
+	expectedNodes := []Node{
+		&FuncDef{Pos: Pos{1}, Def: "F(n int)", Body: []Node{
+			&If{Pos: Pos{1}, Branches: []*IfBranch{
+				{Pos: Pos{1}, Tag: "if", Cond: "n == 1", Body: []Node{&Text{Pos: Pos{1}, Value: "one"}}},
+				{Pos: Pos{1}, Tag: "elseif", Cond: "n == 2", Body: []Node{&Call{Pos: Pos{1}, Filter: "=", Expr: "two()"}}},
+				{Pos: Pos{1}, Tag: "else", Body: []Node{
+					&Code{Pos: Pos{1}, Code: "x := n"},
+					&Output{Pos: Pos{1}, Filter: "d=", Expr: "x"},
+				}},
+			}},
+			&Switch{Pos: Pos{1}, Stmt: "n", Comment: "comment", Cases: []*Case{
+				{Pos: Pos{1}, Tag: "case", Expr: "1", Body: []Node{
+					&Text{Pos: Pos{1}, Value: "a"},
+					&Tag{Pos: Pos{1}, Name: "break"},
+				}},
+				{Pos: Pos{1}, Tag: "default", Body: []Node{&Text{Pos: Pos{1}, Value: "b"}}},
+			}},
+		}},
+	}
+	if !reflect.DeepEqual(tpl.Nodes, expectedNodes) {
+		t.Fatalf("unexpected nodes\n%s\nExpecting\n%s", dumpNodes(tpl.Nodes), dumpNodes(expectedNodes))
+	}
+}
+
+func TestParseASTMacro(t *testing.T) {
+	tpl := testParseASTSuccess(t, `{% macro badge(n int) %}{%d n %}{% endmacro %}{% func F() %}{% macro li() %}<li>{% endmacro %}{% endfunc %}`)
+	expectedNodes := []Node{
+		&FuncDef{Pos: Pos{1}, Def: "badge(n int)", Macro: true, Body: []Node{
+			&Output{Pos: Pos{1}, Filter: "d", Expr: "n"},
+		}},
+		&FuncDef{Pos: Pos{1}, Def: "F()", Body: []Node{
+			&FuncDef{Pos: Pos{1}, Def: "li()", Macro: true, Body: []Node{
+				&Text{Pos: Pos{1}, Value: "<li>"},
+			}},
+		}},
+	}
+	if !reflect.DeepEqual(tpl.Nodes, expectedNodes) {
+		t.Fatalf("unexpected nodes\n%s\nExpecting\n%s", dumpNodes(tpl.Nodes), dumpNodes(expectedNodes))
+	}
+}
+
+func TestParseASTFuncEndName(t *testing.T) {
+	tpl := testParseASTSuccess(t, `{% func F() %}{% macro li() %}<li>{% endmacro li %}{% endfunc F %}{% func G() %}{% endfunc %}`)
+	expectedNodes := []Node{
+		&FuncDef{Pos: Pos{1}, Def: "F()", EndName: "F", Body: []Node{
+			&FuncDef{Pos: Pos{1}, Def: "li()", Macro: true, EndName: "li", Body: []Node{
+				&Text{Pos: Pos{1}, Value: "<li>"},
+			}},
+		}},
+		&FuncDef{Pos: Pos{1}, Def: "G()"},
+	}
+	if !reflect.DeepEqual(tpl.Nodes, expectedNodes) {
+		t.Fatalf("unexpected nodes\n%s\nExpecting\n%s", dumpNodes(tpl.Nodes), dumpNodes(expectedNodes))
+	}
+}
+
+func TestParseASTRawAndBlocks(t *testing.T) {
+	tpl := testParseASTSuccess(t, `{% import "fmt" %}{% stripspace %}{% func F() %}{% plain %}{% foo %}{% endplain %}{% space %}{% endfunc %}{% endstripspace %}{% comment %}{% bar {% endcomment %}`)
+	expectedNodes := []Node{
+		&Tag{Pos: Pos{1}, Name: "import", Contents: `"fmt"`},
+		&Block{Pos: Pos{1}, Name: "stripspace", Body: []Node{
+			&FuncDef{Pos: Pos{1}, Def: "F()", Body: []Node{
+				&Raw{Pos: Pos{1}, Name: "plain", Value: "{% foo %}"},
+				&Tag{Pos: Pos{1}, Name: "space"},
+			}},
+		}},
+		&Raw{Pos: Pos{1}, Name: "comment", Value: "{% bar "},
+	}
+	if !reflect.DeepEqual(tpl.Nodes, expectedNodes) {
+		t.Fatalf("unexpected nodes\n%s\nExpecting\n%s", dumpNodes(tpl.Nodes), dumpNodes(expectedNodes))
+	}
+
+	tpl = testParseASTSuccess(t, "{% func F() %}{% code package %}var s = `{% foo %}`{% endcode %}{% code x := 1 %}{% endfunc %}")
+	expectedNodes = []Node{
+		&FuncDef{Pos: Pos{1}, Def: "F()", Body: []Node{
+			&Code{Pos: Pos{1}, Code: "var s = `{% foo %}`", Block: true, Package: true},
+			&Code{Pos: Pos{1}, Code: "x := 1"},
+		}},
+	}
+	if !reflect.DeepEqual(tpl.Nodes, expectedNodes) {
+		t.Fatalf("unexpected nodes\n%s\nExpecting\n%s", dumpNodes(tpl.Nodes), dumpNodes(expectedNodes))
+	}
+
+	// empty code tag without endcode isn't a block
+	tpl = testParseASTSuccess(t, "{% func F() %}{% code %}a{% code %}x := 1{% endcode %}{% endfunc %}")
+	expectedNodes = []Node{
+		&FuncDef{Pos: Pos{1}, Def: "F()", Body: []Node{
+			&Code{Pos: Pos{1}},
+			&Text{Pos: Pos{1}, Value: "a"},
+			&Code{Pos: Pos{1}, Code: "x := 1", Block: true},
+		}},
+	}
+	if !reflect.DeepEqual(tpl.Nodes, expectedNodes) {
+		t.Fatalf("unexpected nodes\n%s\nExpecting\n%s", dumpNodes(tpl.Nodes), dumpNodes(expectedNodes))
+	}
+}
+
+func TestParseASTWalk(t *testing.T) {
+	tpl := testParseASTSuccess(t, `{% func F() %}{% for %}{%s a %}{% if b %}{%s c %}{% endif %}{% endfor %}{% endfunc %}{% func G() %}{%s d %}{% endfunc %}`)
+	var exprs []string
+	Walk(tpl.Nodes, func(n Node) bool {
+		if f, ok := n.(*FuncDef); ok && f.Def == "G()" {
+			return false
+		}
+		if o, ok := n.(*Output); ok {
+			exprs = append(exprs, o.Expr)
+		}
+		return true
+	})
+	if !reflect.DeepEqual(exprs, []string{"a", "c"}) {
+		t.Fatalf("unexpected expressions visited: %q", exprs)
+	}
+}
+
+func TestParseASTFailure(t *testing.T) {
+	// missing end tags
+	testParseASTFailure(t, `{% func F() %}`)
+	testParseASTFailure(t, `{% func F() %}{% for %}{% endfunc %}`)
+	testParseASTFailure(t, `{% func F() %}{% if a %}{% endfunc %}`)
+	testParseASTFailure(t, `{% func F() %}{% switch %}{% case 1 %}{% endfunc %}`)
+	testParseASTFailure(t, `{% stripspace %}`)
+	testParseASTFailure(t, `{% plain %}`)
+	testParseASTFailure(t, `{% code package %}var x = 1`)
+
+	// unexpected end tags
+	testParseASTFailure(t, `{% endfunc %}`)
+	testParseASTFailure(t, `{% func F() %}{% endfor %}{% endfunc %}`)
+	testParseASTFailure(t, `{% func F() %}{% else %}{% endfunc %}`)
+	testParseASTFailure(t, `{% endstripspace %}`)
+	testParseASTFailure(t, `{% endcode %}`)
+
+	// else must be the last branch
+	testParseASTFailure(t, `{% func F() %}{% if a %}{% else %}{% elseif b %}{% endif %}{% endfunc %}`)
+	testParseASTFailure(t, `{% func F() %}{% if a %}{% else %}{% else %}{% endif %}{% endfunc %}`)
+	testParseASTFailure(t, `{% func F() %}{% if a %}{% else %}{% elif b %}{% endif %}{% endfunc %}`)
+
+	// unless allows only else branch
+	testParseASTFailure(t, `{% func F() %}{% unless a %}{% elseif b %}{% endunless %}{% endfunc %}`)
+	testParseASTFailure(t, `{% func F() %}{% unless a %}{% endif %}{% endfunc %}`)
+
+	// tag inside switch before the first case
+	testParseASTFailure(t, `{% func F() %}{% switch %}{%s a %}{% case 1 %}{% endswitch %}{% endfunc %}`)
+}
+
+func TestParseASTMatchesCompiler(t *testing.T) {
+	// ParseAST and the code generator must accept and reject the same
+	// templates from testdata, including the partial templates for include tag,
+	// which cannot be compiled on their own.
+	var paths []string
+	for _, dir := range []string{"testdata", "../qtc/testdata", "../testdata", "../examples"} {
+		err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() && strings.HasSuffix(path, ".qtpl") {
+				paths = append(paths, path)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("cannot collect templates in %q: %s", dir, err)
+		}
+	}
+	if len(paths) == 0 {
+		t.Fatalf("cannot find templates in testdata")
+	}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("cannot read %q: %s", path, err)
+		}
+		testParseASTMatchesCompiler(t, string(data), path)
+	}
+
+	// broken template structure
+	for _, str := range []string{
+		`{% func F() %}`,
+		`{% func F() %}{% for %}{% endfunc %}`,
+		`{% func F() %}{% if a %}{% endfunc %}`,
+		`{% func F() %}{% switch a %}{% case 1 %}{% endfunc %}`,
+		`{% stripspace %}`,
+		`{% func F() %}{% plain %}{% endfunc %}`,
+		`{% code package %}var x = 1`,
+		`{% endfunc %}`,
+		`{% func F() %}{% endfor %}{% endfunc %}`,
+		`{% func F() %}{% else %}{% endfunc %}`,
+		`{% endstripspace %}`,
+		`{% func F() %}{% if a %}{% else %}{% elseif b %}{% endif %}{% endfunc %}`,
+		`{% func F() %}{% if a %}{% else %}{% else %}{% endif %}{% endfunc %}`,
+		`{% func F() %}{% unless a %}{% elseif b %}{% endunless %}{% endfunc %}`,
+		`{% func F() %}{% switch a %}{%s a %}{% case 1 %}{% endswitch %}{% endfunc %}`,
+		`{% func F() %}{% endfunc G %}`,
+		`{% macro m() %}{% endmacro n %}`,
+
+		// tags outside funcs
+		`{%s a %}`,
+		`{%= F() %}`,
+		`{% for %}{% endfor %}`,
+		`{% if a %}{% endif %}`,
+		`{% return %}`,
+		`{% defer f() %}`,
+		`{% cdata %}{% endcdata %}`,
+
+		// tags inside funcs
+		`{% func F() %}{% const a = 1 %}{% endfunc %}`,
+		`{% func F() %}{% package foo %}{% endfunc %}`,
+		`{% func F() %}{% import "fmt" %}{% endfunc %}`,
+		`{% func F() %}{% interface A { F() } %}{% endfunc %}`,
+
+		// unknown tags
+		`{% foobar %}`,
+		`{% func F() %}{% foobar %}{% endfunc %}`,
+		`{% func F() %}{%=w F() %}{% endfunc %}`,
+		`{% func F() %}{%=? a.F() %}{% endfunc %}`,
+		`{% func F() %}{%f.foo 1.2 %}{% endfunc %}`,
+		`{% func F() %}{%v:foo a %}{% endfunc %}`,
+
+		// extra values after tags
+		`{% func F() %}{% for %}{% endfor foo %}{% endfunc %}`,
+		`{% func F() %}{% if a %}{% else if b %}{% endif %}{% endfunc %}`,
+		`{% func F() %}{% if a %}{% endif foo %}{% endfunc %}`,
+		`{% func F() %}{% switch a %}{% default foo %}{% endswitch %}{% endfunc %}`,
+		`{% func F() %}{% switch a %}{% case 1 %}{% endswitch foo %}{% endfunc %}`,
+		`{% func F() %}{% cdata foo %}{% endcdata %}{% endfunc %}`,
+		`{% func F() %}{% spaceless %}{% endspaceless foo %}{% endfunc %}`,
+
+		// the order of build, package and import tags
+		`{% build linux %}{% build amd64 %}`,
+		`{% package foo %}{% build linux %}`,
+		`{% import "fmt" %}{% package foo %}`,
+		`{% package foo %}{% package bar %}`,
+		`{% func F() %}{% endfunc %}{% import "fmt" %}`,
+	} {
+		testParseASTMatchesCompiler(t, str, "./foobar.tpl")
+	}
+
+	// valid template structure
+	for _, str := range []string{
+		"Hello\n{% build linux %}{% package foo %}{% import \"fmt\" %}{% import \"io\" %}{% func F() %}{% endfunc F %}",
+		`{% stripspace %}{% func F() %}{% space %}{% newline %}{% endfunc %}{% endstripspace %}`,
+		`{% func F() %}{%s? a.b %}{%f.2= x %}{%v:stringer x %}{%=uh G() %}{% endfunc %}`,
+	} {
+		testParseASTMatchesCompiler(t, str, "./foobar.tpl")
+	}
+}
+
+func testParseASTMatchesCompiler(t *testing.T, str, filePath string) {
+	t.Helper()
+	errCompile := parse(&bytes.Buffer{}, strings.NewReader(str), filePath, "memory")
+	_, errAST := ParseAST(strings.NewReader(str), filePath)
+	if (errCompile == nil) != (errAST == nil) {
+		t.Fatalf("ParseAST and the code generator disagree on %q from %q:\nParseAST error: %v\ncode generator error: %v", str, filePath, errAST, errCompile)
+	}
+}
+
+func testParseASTSuccess(t *testing.T, str string) *Template {
+	tpl, err := ParseAST(bytes.NewBufferString(str), "memory")
+	if err != nil {
+		t.Fatalf("unexpected error when parsing %q: %s", str, err)
+	}
+	return tpl
+}
+
+func testParseASTFailure(t *testing.T, str string) {
+	t.Helper()
+	_, err := ParseAST(bytes.NewBufferString(str), "memory")
+	if err == nil {
+		t.Fatalf("expecting error when parsing %q", str)
+	}
+	checkParseErrorKind(t, str, err)
+}
+
+func dumpNodes(nodes []Node) string {
+	var bb bytes.Buffer
+	Walk(nodes, func(n Node) bool {
+		fmt.Fprintf(&bb, "%#v\n", n)
+		return true
+	})
+	return bb.String()
+}
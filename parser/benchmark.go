@@ -0,0 +1,177 @@
+package parser
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	goparser "go/parser"
+	"go/types"
+	"io"
+)
+
+// benchmarkFunc is a template func the benchmark is generated for.
+type benchmarkFunc struct {
+	f *funcType
+
+	// skipReason is set if the benchmark cannot be generated for f.
+	skipReason string
+}
+
+// addBenchmarkFunc registers the top-level func f for benchmark generation.
+func (p *parser) addBenchmarkFunc(f *funcType) {
+	bf := &benchmarkFunc{f: f}
+	switch {
+	case len(f.recvType) > 0:
+		bf.skipReason = "methods require receiver value"
+	default:
+		bf.skipReason = benchmarkArgsSkipReason(f.args)
+	}
+	if len(bf.skipReason) > 0 && p.logger != nil {
+		p.logger.Info("skipping benchmark", "func", f.name, "pos", p.tracePos(), "reason", bf.skipReason)
+	}
+	p.benchmarkFuncs = append(p.benchmarkFuncs, bf)
+}
+
+// benchmarkArgsSkipReason returns the reason why zero values cannot be
+// used for func args.
+//
+// Empty string is returned if all the args may be zero values.
+func benchmarkArgsSkipReason(args string) string {
+	for _, field := range argFields(args) {
+		if !isZeroValueSafeType(field.Type) {
+			return fmt.Sprintf("cannot synthesize zero value for args of type %s", types.ExprString(field.Type))
+		}
+	}
+	return ""
+}
+
+// argFields returns the fields for func args in the form ", a int, b string".
+func argFields(args string) []*ast.Field {
+	if len(args) == 0 {
+		return nil
+	}
+	// skip the first ', '
+	expr, err := goparser.ParseExpr(fmt.Sprintf("func (%s)", args[2:]))
+	if err != nil {
+		// args are already validated by parseFuncSignature.
+		panic(fmt.Sprintf("BUG: cannot parse func args %q: %s", args, err))
+	}
+	return expr.(*ast.FuncType).Params.List
+}
+
+// isZeroValueSafeType returns true if the zero value of the given type
+// may be passed to the template func.
+//
+// Only builtin types and composite types built of them are supported,
+// since nil pointers, interfaces and funcs usually lead to panics
+// and named types may require imports.
+func isZeroValueSafeType(expr ast.Expr) bool {
+	switch x := expr.(type) {
+	case *ast.Ident:
+		return zeroValueSafeTypes[x.Name]
+	case *ast.Ellipsis:
+		return isZeroValueSafeType(x.Elt)
+	case *ast.ArrayType:
+		return isZeroValueSafeType(x.Elt)
+	case *ast.MapType:
+		return isZeroValueSafeType(x.Key) && isZeroValueSafeType(x.Value)
+	case *ast.ParenExpr:
+		return isZeroValueSafeType(x.X)
+	default:
+		return false
+	}
+}
+
+var zeroValueSafeTypes = map[string]bool{
+	"bool":       true,
+	"string":     true,
+	"byte":       true,
+	"rune":       true,
+	"int":        true,
+	"int8":       true,
+	"int16":      true,
+	"int32":      true,
+	"int64":      true,
+	"uint":       true,
+	"uint8":      true,
+	"uint16":     true,
+	"uint32":     true,
+	"uint64":     true,
+	"uintptr":    true,
+	"float32":    true,
+	"float64":    true,
+	"complex64":  true,
+	"complex128": true,
+}
+
+// emitBenchmarks writes Go code with benchmarks for p.benchmarkFuncs to w.
+func (p *parser) emitBenchmarks(w io.Writer) error {
+	var bb bytes.Buffer
+	p.emitBanner(&bb)
+	fmt.Fprintf(&bb, `package %s
+
+import (
+	qtio%s "io/ioutil"
+	"testing"
+
+	qt%s "github.com/valyala/quicktemplate"
+)
+
+var (
+	_ = qtio%s.Discard
+	_ = qt%s.AcquireWriter
+)
+`, p.packageName, mangleSuffix, mangleSuffix, mangleSuffix, mangleSuffix)
+	for _, bf := range p.benchmarkFuncs {
+		emitBenchmark(&bb, bf, p.writerVar)
+	}
+	code, err := format.Source(bb.Bytes())
+	if err != nil {
+		return fmt.Errorf("error when formatting benchmarks for %q: %s", p.s.filePath, err)
+	}
+	_, err = w.Write(code)
+	return err
+}
+
+func emitBenchmark(bb *bytes.Buffer, bf *benchmarkFunc, writerVar string) {
+	f := bf.f
+	name := benchmarkName(f)
+	if len(bf.skipReason) > 0 {
+		fmt.Fprintf(bb, "\n// %s is skipped: %s\n", name, bf.skipReason)
+		return
+	}
+	fmt.Fprintf(bb, "\nfunc %s(b%s *testing.B) {\n", name, mangleSuffix)
+	fields := argFields(f.args)
+	if len(fields) > 0 {
+		fmt.Fprintf(bb, "var (\n")
+		for _, field := range fields {
+			typ := field.Type
+			if e, ok := typ.(*ast.Ellipsis); ok {
+				typ = &ast.ArrayType{Elt: e.Elt}
+			}
+			for _, n := range field.Names {
+				fmt.Fprintf(bb, "%s %s\n", n.Name, types.ExprString(typ))
+			}
+		}
+		fmt.Fprintf(bb, ")\n")
+	}
+	fmt.Fprintf(bb, "%s := qt%s.AcquireWriter(qtio%s.Discard)\n", writerVar, mangleSuffix, mangleSuffix)
+	fmt.Fprintf(bb, "defer qt%s.ReleaseWriter(%s)\n", mangleSuffix, writerVar)
+	fmt.Fprintf(bb, "b%s.ReportAllocs()\n", mangleSuffix)
+	fmt.Fprintf(bb, "for i%s := 0; i%s < b%s.N; i%s++ {\n", mangleSuffix, mangleSuffix, mangleSuffix, mangleSuffix)
+	fmt.Fprintf(bb, "%s\n", f.CallStream(writerVar))
+	fmt.Fprintf(bb, "}\n}\n")
+}
+
+// benchmarkName returns the name of the benchmark for f.
+//
+// Benchmarks for unexported funcs are prefixed with an underscore,
+// since go test ignores benchmarks starting with lowercase letter
+// after the Benchmark prefix.
+func benchmarkName(f *funcType) string {
+	if isUpper(f.name[0]) {
+		return "Benchmark" + f.name
+	}
+	return "Benchmark_" + f.name
+}
@@ -0,0 +1,6 @@
+/*
+Package parser compiles quicktemplate files into Go code.
+
+The package is used by qtc. See https://github.com/valyala/quicktemplate/qtc for details.
+*/
+package parser
@@ -0,0 +1,150 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ParseError is the error found in the template when compiling it.
+//
+// Errors occurred when reading the template source aren't ParseError.
+// Use errors.Is and errors.As for checking the underlying error,
+// i.e. io.ErrUnexpectedEOF for templates ending inside a tag.
+type ParseError struct {
+	// File is the path to the template file with the error.
+	File string
+
+	// Line is the line with the error. Lines start from 1.
+	Line int
+
+	// Col is the position of the token with the error in the line.
+	Col int
+
+	// Msg is the error message without the position.
+	Msg string
+
+	// Kind is the kind of the error.
+	Kind ErrorKind
+
+	err error
+}
+
+// Error formats the error as gofmt does, i.e. file:line:col: message.
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("%s:%d:%d: %s", e.File, e.Line, e.Col, e.Msg)
+}
+
+// Unwrap returns the underlying error.
+func (e *ParseError) Unwrap() error {
+	return e.err
+}
+
+// newParseError returns ParseError for err found at the current token of s.
+//
+// The error is prefixed with file:line:col of the token,
+// so editors and go generate may locate it.
+func newParseError(s *scanner, err error) *ParseError {
+	t := s.Token()
+	return &ParseError{
+		File: s.filePath,
+		Line: t.line + 1,
+		Col:  t.pos,
+		Msg:  err.Error(),
+		Kind: errorKind(err),
+		err:  err,
+	}
+}
+
+// ErrorKind is the kind of ParseError.
+//
+// The zero ErrorKind isn't valid, so every ParseError has one of the kinds below.
+type ErrorKind int
+
+const (
+	// KindUnexpectedToken is the kind of errors for unknown tags and tags
+	// found at the place they cannot be used at, i.e. else tag outside if.
+	KindUnexpectedToken ErrorKind = iota + 1
+
+	// KindUnclosedTag is the kind of errors for tags without
+	// the closing tag, i.e. func without endfunc or {% without %}.
+	KindUnclosedTag
+
+	// KindEmptyExpression is the kind of errors for tags missing
+	// the required expression, i.e. {% if %}.
+	KindEmptyExpression
+
+	// KindInvalidCode is the kind of errors for Go code in tags,
+	// which cannot be parsed, i.e. {%s a b %}.
+	KindInvalidCode
+
+	// KindInvalidFunc is the kind of errors for invalid func definitions,
+	// i.e. conflicting modifiers or funcs generating the same names.
+	KindInvalidFunc
+
+	// KindMisplacedTag is the kind of errors for known tags used
+	// in the context they aren't allowed in, i.e. break outside for loop
+	// or package tag after funcs.
+	KindMisplacedTag
+
+	// KindInclude is the kind of errors for files, which cannot be
+	// included via include and cat tags, i.e. missing files or include cycles.
+	KindInclude
+)
+
+var errorKindStrMap = map[ErrorKind]string{
+	KindUnexpectedToken: "unexpected token",
+	KindUnclosedTag:     "unclosed tag",
+	KindEmptyExpression: "empty expression",
+	KindInvalidCode:     "invalid code",
+	KindInvalidFunc:     "invalid func",
+	KindMisplacedTag:    "misplaced tag",
+	KindInclude:         "include",
+}
+
+func (k ErrorKind) String() string {
+	if s, ok := errorKindStrMap[k]; ok {
+		return s
+	}
+	return fmt.Sprintf("ErrorKind(%d)", int(k))
+}
+
+// kindError is the error with the known kind.
+type kindError struct {
+	kind ErrorKind
+	err  error
+}
+
+func (e *kindError) Error() string {
+	return e.err.Error()
+}
+
+func (e *kindError) Unwrap() error {
+	return e.err
+}
+
+// errorf works like fmt.Errorf and marks the returned error with the given kind.
+func errorf(kind ErrorKind, format string, args ...interface{}) error {
+	return &kindError{
+		kind: kind,
+		err:  fmt.Errorf(format, args...),
+	}
+}
+
+// errorKind returns the kind of err.
+//
+// The kind is taken from the innermost error marked with errorf,
+// since outer errors usually just add the context to it.
+// The template ending inside a tag means the tag isn't closed.
+func errorKind(err error) ErrorKind {
+	var kind ErrorKind
+	for ; err != nil; err = errors.Unwrap(err) {
+		if ke, ok := err.(*kindError); ok {
+			kind = ke.kind
+		}
+		if err == io.ErrUnexpectedEOF {
+			kind = KindUnclosedTag
+		}
+	}
+	return kind
+}
@@ -0,0 +1,195 @@
+package parser
+
+import (
+	"bytes"
+	"io"
+	"strings"
+)
+
+// Format writes the template from r to w in the canonical form.
+//
+// Tags are normalized to {% name contents %} form, while output tags
+// are normalized to {%s contents %} form. Tag contents, including Go code,
+// are preserved verbatim.
+//
+// Leading whitespace before tags starting a line is replaced with tabs
+// according to the tag nesting depth only where the whitespace doesn't
+// affect the template output: in the text outside funcs, in the text before
+// the first case in switch and inside stripspace and collapsespace blocks.
+// Static text is preserved exactly everywhere else.
+func Format(w io.Writer, r io.Reader, filePath string) error {
+	tpl, err := ParseAST(r, filePath)
+	if err != nil {
+		return err
+	}
+	var f formatter
+	f.formatNodes(tpl.Nodes, 0, true)
+	_, err = w.Write(f.bytes())
+	return err
+}
+
+type formatItem struct {
+	s string
+
+	// isTag is set if s is a tag.
+	isTag bool
+
+	// depth is the nesting depth for the tag.
+	depth int
+
+	// reindent is set if the whitespace at the end of the text
+	// may be changed.
+	reindent bool
+}
+
+type formatter struct {
+	items []formatItem
+
+	// spaceBlockDepth is the number of the enclosing stripspace
+	// and collapsespace blocks.
+	spaceBlockDepth int
+}
+
+func (f *formatter) text(s string, reindent bool) {
+	f.items = append(f.items, formatItem{
+		s:        s,
+		reindent: reindent,
+	})
+}
+
+func (f *formatter) tag(name, contents string, depth int) {
+	var s string
+	switch {
+	case strings.IndexByte(contents, '\n') >= 0:
+		s = "{% " + name + "\n" + contents + "\n%}"
+	case len(contents) > 0:
+		s = "{% " + name + " " + contents + " %}"
+	default:
+		s = "{% " + name + " %}"
+	}
+	f.items = append(f.items, formatItem{
+		s:     s,
+		isTag: true,
+		depth: depth,
+	})
+}
+
+func (f *formatter) outputTag(name, contents string, depth int) {
+	s := "{%" + name + " " + contents + " %}"
+	if strings.IndexByte(contents, '\n') >= 0 {
+		s = "{%" + name + "\n" + contents + "\n%}"
+	}
+	f.items = append(f.items, formatItem{
+		s:     s,
+		isTag: true,
+		depth: depth,
+	})
+}
+
+func (f *formatter) formatNodes(nodes []Node, depth int, reindent bool) {
+	for _, n := range nodes {
+		switch x := n.(type) {
+		case *Text:
+			f.text(x.Value, reindent)
+		case *Output:
+			f.outputTag(x.Filter, x.Expr, depth)
+		case *Call:
+			f.outputTag(x.Filter, x.Expr, depth)
+		case *Code:
+			if x.Block {
+				contents := ""
+				if x.Package {
+					contents = "package"
+				}
+				f.tag("code", contents, depth)
+				f.text(x.Code, false)
+				f.tag("endcode", "", depth)
+				continue
+			}
+			f.tag("code", x.Code, depth)
+		case *FuncDef:
+			name := "func"
+			if x.Macro {
+				name = "macro"
+			}
+			f.tag(name, x.Def, depth)
+			f.formatNodes(x.Body, depth+1, f.spaceBlockDepth > 0)
+			f.tag("end"+name, x.EndName, depth)
+		case *For:
+			f.tag("for", x.Stmt, depth)
+			f.formatNodes(x.Body, depth+1, reindent)
+			f.tag("endfor", "", depth)
+		case *If:
+			for _, b := range x.Branches {
+				f.tag(b.Tag, b.Cond, depth)
+				f.formatNodes(b.Body, depth+1, reindent)
+			}
+			f.tag("end"+x.Branches[0].Tag, "", depth)
+		case *Switch:
+			f.tag("switch", x.Stmt, depth)
+			f.text(x.Comment, true)
+			for _, c := range x.Cases {
+				f.tag(c.Tag, c.Expr, depth)
+				f.formatNodes(c.Body, depth+1, reindent)
+			}
+			f.tag("endswitch", "", depth)
+		case *Raw:
+			f.tag(x.Name, "", depth)
+			f.text(x.Value, false)
+			f.tag(rawEndTags[x.Name], "", depth)
+		case *Block:
+			if x.Name == "cdata" || x.Name == "stripnewlines" || x.Name == "spaceless" {
+				// Whitespace inside cdata and spaceless is written to the output as is.
+				// Only newlines are dropped inside stripnewlines.
+				f.tag(x.Name, x.Contents, depth)
+				f.formatNodes(x.Body, depth, false)
+				f.tag(blockEndTags[x.Name], "", depth)
+				continue
+			}
+			if x.Name == "with" {
+				f.tag(x.Name, x.Contents, depth)
+				f.formatNodes(x.Body, depth+1, f.spaceBlockDepth > 0)
+				f.tag(blockEndTags[x.Name], "", depth)
+				continue
+			}
+
+			// Whitespace is insignificant inside stripspace and collapsespace
+			// as long as it isn't removed completely.
+			f.tag(x.Name, x.Contents, depth)
+			f.spaceBlockDepth++
+			f.formatNodes(x.Body, depth, true)
+			f.spaceBlockDepth--
+			f.tag(blockEndTags[x.Name], "", depth)
+		case *Tag:
+			if x.Name == "#" {
+				f.outputTag(x.Name, x.Contents, depth)
+				continue
+			}
+			f.tag(x.Name, x.Contents, depth)
+		default:
+			panic("BUG: unexpected node type")
+		}
+	}
+}
+
+func (f *formatter) bytes() []byte {
+	var bb bytes.Buffer
+	for i, it := range f.items {
+		s := it.s
+		if it.reindent && i+1 < len(f.items) && f.items[i+1].isTag {
+			s = reindentTail(s, f.items[i+1].depth)
+		}
+		bb.WriteString(s)
+	}
+	return bb.Bytes()
+}
+
+// reindentTail replaces the whitespace after the last newline in s
+// with depth tabs.
+func reindentTail(s string, depth int) string {
+	n := strings.LastIndexByte(s, '\n')
+	if n < 0 || len(stripLeadingSpace([]byte(s[n+1:]))) > 0 {
+		return s
+	}
+	return s[:n+1] + strings.Repeat("\t", depth)
+}
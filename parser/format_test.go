@@ -0,0 +1,108 @@
+package parser
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+func TestFormatNormalize(t *testing.T) {
+	testFormat(t, "Foo func\n   {%func Foo(n  int)%}\n  {%if n>0%}\n{%s=  fmt.Sprint(n)%}\n     {%elseif n < 0 %}negative{%else%}\n  zero\n    {%endif%}\n{%endfunc%}",
+		"Foo func\n{% func Foo(n  int) %}\n  {% if n>0 %}\n{%s= fmt.Sprint(n) %}\n     {% elseif n < 0 %}negative{% else %}\n  zero\n    {% endif %}\n{% endfunc %}")
+
+	// macro
+	testFormat(t, "{%macro  badge(n int)%}\n{%d n%}\n{%endmacro%}", "{% macro badge(n int) %}\n{%d n %}\n{% endmacro %}")
+
+	// func name in the end tag is preserved
+	testFormat(t, "{%func Foo()%}foo{%endfunc   Foo%}{%macro bar()%}{%endmacro bar%}",
+		"{% func Foo() %}foo{% endfunc Foo %}{% macro bar() %}{% endmacro bar %}")
+
+	// elif alias is preserved
+	testFormat(t, "{%func F(n int)%}{%if n>0%}positive{%elif  n<0%}negative{%endif%}{%endfunc%}",
+		"{% func F(n int) %}{% if n>0 %}positive{% elif n<0 %}negative{% endif %}{% endfunc %}")
+
+	// cdata
+	testFormat(t, "{%func F()%}\n{%cdata%}\n{%s s%}\n{%endcdata%}\n{%endfunc%}",
+		"{% func F() %}\n{% cdata %}\n{%s s %}\n{% endcdata %}\n{% endfunc %}")
+
+	// escaped tag delimiters are preserved
+	testFormat(t, "{%func F()%}{%% example %}{%endfunc%}",
+		"{% func F() %}{%% example %}{% endfunc %}")
+
+	// default args
+	testFormat(t, "{%func F(a int, s string = \"x\")%}{%endfunc%}",
+		"{% func F(a int, s string = \"x\") %}{% endfunc %}")
+
+	// typed value tags
+	testFormat(t, "{%func F(n int)%}{%v:int  n%}{%v:string=  s%}{%endfunc%}",
+		"{% func F(n int) %}{%v:int n %}{%v:string= s %}{% endfunc %}")
+
+	// with
+	testFormat(t, "{%func F()%}\n  {%with  a = 1,b = 2%}\n{%d a+b%}\n  {%endwith%}{%endfunc%}",
+		"{% func F() %}\n  {% with a = 1,b = 2 %}\n{%d a+b %}\n  {% endwith %}{% endfunc %}")
+
+	// whitespace inside spaceless is written to the output
+	testFormat(t, "{%func F()%}{%spaceless%}\n  <a>\n    {%s s%}\n  </a>\n{%endspaceless%}{%endfunc%}",
+		"{% func F() %}{% spaceless %}\n  <a>\n    {%s s %}\n  </a>\n{% endspaceless %}{% endfunc %}")
+
+	// whitespace inside stripnewlines is written to the output
+	testFormat(t, "{%func F()%}{%stripnewlines%}\n  <a>\n    {%s s%}\n  </a>\n{%endstripnewlines%}{%endfunc%}",
+		"{% func F() %}{% stripnewlines %}\n  <a>\n    {%s s %}\n  </a>\n{% endstripnewlines %}{% endfunc %}")
+
+	// unless
+	testFormat(t, "{%func F(ok bool)%}{%unless  ok%}failed{%else%}ok{%endunless%}{%endfunc%}",
+		"{% func F(ok bool) %}{% unless ok %}failed{% else %}ok{% endunless %}{% endfunc %}")
+
+	// whitespace inside stripspace and collapsespace is re-indented
+	testFormat(t, "{%stripspace%}\n   {%func F()%}\n{%for%}\n      {%d 1%}\n  {%endfor%}\n{%endfunc%}\n{%endstripspace%}",
+		"{% stripspace %}\n{% func F() %}\n\t{% for %}\n\t\t{%d 1 %}\n\t{% endfor %}\n{% endfunc %}\n{% endstripspace %}")
+	testFormat(t, "{%func F()%}{%collapsespace%}\n  {%switch%}  text before case\n     {%case 1%}\n{%default%}{%endswitch%}\n{%endcollapsespace%}{%endfunc%}",
+		"{% func F() %}{% collapsespace %}\n\t{% switch %}  text before case\n\t{% case 1 %}\n\t{% default %}{% endswitch %}\n\t{% endcollapsespace %}{% endfunc %}")
+
+	// single-line comments
+	testFormat(t, "{%#note%}{%  #  another note%}", "{%# note %}{%# another note %}")
+
+	// multi-line contents and raw blocks are preserved
+	testFormat(t, "{%code\n  type A struct {\n    S string\n  }\n%}\n  {%plain%}  {%  foo%}  {%endplain%}  {% comment %}{%bar{%endcomment%}",
+		"{% code\ntype A struct {\n    S string\n  }\n%}\n{% plain %}  {%  foo%}  {% endplain %}  {% comment %}{%bar{% endcomment %}")
+	testFormat(t, "{%func F()%}\n{%code   package%}\n  var a = `{%foo%}`\n{%endcode%}{%endfunc%}",
+		"{% func F() %}\n{% code package %}\n  var a = `{%foo%}`\n{% endcode %}{% endfunc %}")
+}
+
+func TestFormatIdempotent(t *testing.T) {
+	for _, filename := range []string{"testdata/test.qtpl", "../testdata/templates/integration.qtpl"} {
+		data, err := ioutil.ReadFile(filename)
+		if err != nil {
+			t.Fatalf("cannot read %q: %s", filename, err)
+		}
+		formatted := testFormatString(t, string(data))
+		if s := testFormatString(t, formatted); s != formatted {
+			t.Fatalf("formatting isn't idempotent for %q\n%s\nExpecting\n%s", filename, s, formatted)
+		}
+	}
+}
+
+func TestFormatFailure(t *testing.T) {
+	var bb bytes.Buffer
+	if err := Format(&bb, bytes.NewBufferString("{% func F() %}"), "memory"); err == nil {
+		t.Fatalf("expecting error for the template without endfunc")
+	}
+}
+
+func testFormat(t *testing.T, str, expected string) {
+	s := testFormatString(t, str)
+	if s != expected {
+		t.Fatalf("unexpected formatted template\n%q\nExpecting\n%q", s, expected)
+	}
+	if s = testFormatString(t, s); s != expected {
+		t.Fatalf("formatting isn't idempotent\n%q\nExpecting\n%q", s, expected)
+	}
+}
+
+func testFormatString(t *testing.T, str string) string {
+	var bb bytes.Buffer
+	if err := Format(&bb, bytes.NewBufferString(str), "memory"); err != nil {
+		t.Fatalf("unexpected error when formatting %q: %s", str, err)
+	}
+	return bb.String()
+}
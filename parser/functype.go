@@ -0,0 +1,864 @@
+package parser
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	goparser "go/parser"
+	goscanner "go/scanner"
+	gotoken "go/token"
+	"go/types"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type funcType struct {
+	name       string
+	recvType   string
+	defPrefix  string
+	callPrefix string
+	argNames   string
+	args       string
+
+	// streamOnly is set for funcs defined with 'stream' modifier.
+	// Only the stream func is generated for such funcs.
+	streamOnly bool
+
+	// escapeMode is set for funcs defined with 'html' or 'text' modifier.
+	// Output tags such as {%s %} aren't html-escaped in 'text' funcs.
+	// Funcs without the modifier inherit the mode of the enclosing func.
+	escapeMode string
+
+	// ctx is set for funcs defined with 'ctx' modifier.
+	// Such funcs accept ctx context.Context as the first arg.
+	ctx bool
+
+	// errResult is set for funcs defined with 'err' modifier.
+	// The stream and write funcs return error for such funcs,
+	// while the string func returns (string, error).
+	errResult bool
+
+	// private is set for funcs defined with 'private' modifier.
+	// The first letter of the name is lowercased for such funcs,
+	// so all the generated funcs are unexported.
+	private bool
+
+	// sizeHint is the expected output size set via trailing hint(N)
+	// such as {% func Page() hint(8192) %}. The buffer for the string
+	// func output is pre-sized to sizeHint bytes.
+	sizeHint int
+
+	// inline is set for funcs defined with 'inline' modifier.
+	// {%= F(...) %} calls following such funcs in the template file
+	// are expanded into the func body instead of the func call.
+	inline bool
+
+	// writerTo is set for funcs defined with 'writerto' modifier.
+	// The type capturing the func args and implementing io.WriterTo
+	// is generated for such funcs. See writerToName for details.
+	writerTo bool
+
+	// defaults contains default values for the trailing args defined
+	// in the form `arg type = value`. See defaultsFunc for details.
+	defaults []string
+
+	// requiredArgs and requiredArgNames contain the args
+	// without default values.
+	requiredArgs     string
+	requiredArgNames string
+
+	// chanArgs contains the names of the args with channel types.
+	// The loop over such args may be written as {% for x in ch %}.
+	chanArgs []string
+}
+
+func parseFuncDef(b []byte) (*funcType, error) {
+	// The hint is ambiguous with methods named 'hint',
+	// so fall back to the func without the hint on error.
+	if def, hint, ok := trimFuncHint(b); ok {
+		if f, err := parseFuncDefModifiers(def); err == nil {
+			n, err := parseSizeHint(hint)
+			if err != nil {
+				return nil, err
+			}
+			f.sizeHint = n
+			return f, nil
+		}
+	}
+	return parseFuncDefModifiers(b)
+}
+
+func parseFuncDefModifiers(b []byte) (*funcType, error) {
+	// Modifiers are ambiguous with funcs named 'stream', 'html', 'text', 'ctx', 'err', 'private', 'inline' or 'writerto',
+	// so fall back to the func without modifiers on error.
+	def := b
+	var modifiers []string
+	for {
+		d, modifier := trimFuncModifier(def)
+		if len(modifier) == 0 {
+			break
+		}
+		def = d
+		modifiers = append(modifiers, modifier)
+	}
+	if len(modifiers) > 0 {
+		if f, err := parseFuncSignature(def); err == nil {
+			if err = f.setModifiers(modifiers); err != nil {
+				return nil, err
+			}
+			if err = f.validateInline(); err != nil {
+				return nil, err
+			}
+			return f, nil
+		}
+	}
+	return parseFuncSignature(b)
+}
+
+// trimFuncHint removes the trailing hint(N) from the func definition.
+func trimFuncHint(b []byte) ([]byte, string, bool) {
+	b = stripTrailingSpace(b)
+	if len(b) == 0 || b[len(b)-1] != ')' {
+		return b, "", false
+	}
+	n := bytes.LastIndex(b, []byte("hint"))
+	if n < 0 {
+		return b, "", false
+	}
+	def := stripTrailingSpace(b[:n])
+	if len(def) == 0 || def[len(def)-1] != ')' {
+		return b, "", false
+	}
+	args := stripLeadingSpace(b[n+len("hint"):])
+	if len(args) < 2 || args[0] != '(' || bytes.ContainsAny(args[1:len(args)-1], "()") {
+		return b, "", false
+	}
+	return def, string(bytes.TrimSpace(args[1 : len(args)-1])), true
+}
+
+// parseSizeHint parses the value of hint(N), which must be
+// a positive integer literal.
+func parseSizeHint(s string) (int, error) {
+	expr, err := goparser.ParseExpr(s)
+	if err != nil {
+		return 0, errorf(KindInvalidFunc, "invalid hint(%s): %s", s, err)
+	}
+	lit, ok := expr.(*ast.BasicLit)
+	if !ok || lit.Kind != gotoken.INT {
+		return 0, errorf(KindInvalidFunc, "invalid hint(%s): the hint must be an integer literal", s)
+	}
+	n, err := strconv.ParseInt(lit.Value, 0, 32)
+	if err != nil {
+		return 0, errorf(KindInvalidFunc, "invalid hint(%s): %s", s, err)
+	}
+	if n <= 0 {
+		return 0, errorf(KindInvalidFunc, "invalid hint(%s): the hint must be positive", s)
+	}
+	return int(n), nil
+}
+
+var funcModifiers = []string{"stream", "html", "text", "ctx", "err", "private", "inline", "writerto"}
+
+// trimFuncModifier removes the leading modifier from the func definition.
+func trimFuncModifier(b []byte) ([]byte, string) {
+	for _, modifier := range funcModifiers {
+		if !bytes.HasPrefix(b, []byte(modifier)) {
+			continue
+		}
+		def := stripLeadingSpace(b[len(modifier):])
+		if len(def) == len(b)-len(modifier) {
+			// missing whitespace after the modifier
+			continue
+		}
+		return def, modifier
+	}
+	return b, ""
+}
+
+func (f *funcType) setModifiers(modifiers []string) error {
+	for _, modifier := range modifiers {
+		switch modifier {
+		case "stream":
+			if f.streamOnly {
+				return errorf(KindInvalidFunc, "duplicate %q modifier", modifier)
+			}
+			f.streamOnly = true
+		case "html", "text":
+			if len(f.escapeMode) > 0 {
+				return errorf(KindInvalidFunc, "%q modifier cannot be used together with %q modifier", modifier, f.escapeMode)
+			}
+			f.escapeMode = modifier
+		case "ctx":
+			if f.ctx {
+				return errorf(KindInvalidFunc, "duplicate %q modifier", modifier)
+			}
+			if f.hasArg("ctx") {
+				return errorf(KindInvalidFunc, "%q modifier cannot be used together with the arg named ctx", modifier)
+			}
+			f.ctx = true
+			f.args = fmt.Sprintf(", ctx qtctx%s.Context%s", mangleSuffix, f.args)
+			f.argNames = ", ctx" + f.argNames
+			f.requiredArgs = fmt.Sprintf(", ctx qtctx%s.Context%s", mangleSuffix, f.requiredArgs)
+			f.requiredArgNames = ", ctx" + f.requiredArgNames
+		case "err":
+			if f.errResult {
+				return errorf(KindInvalidFunc, "duplicate %q modifier", modifier)
+			}
+			f.errResult = true
+		case "private":
+			if f.private {
+				return errorf(KindInvalidFunc, "duplicate %q modifier", modifier)
+			}
+			f.private = true
+			r, size := utf8.DecodeRuneInString(f.name)
+			f.name = string(unicode.ToLower(r)) + f.name[size:]
+		case "inline":
+			if f.inline {
+				return errorf(KindInvalidFunc, "duplicate %q modifier", modifier)
+			}
+			f.inline = true
+		case "writerto":
+			if f.writerTo {
+				return errorf(KindInvalidFunc, "duplicate %q modifier", modifier)
+			}
+			if len(f.defPrefix) > 0 {
+				return errorf(KindInvalidFunc, "%q modifier cannot be used for methods", modifier)
+			}
+			f.writerTo = true
+		}
+	}
+	return nil
+}
+
+// writerToName returns the name of the type implementing io.WriterTo
+// for the func with writerto modifier, i.e. PageWriterTo for Page.
+func (f *funcType) writerToName() string {
+	return f.name + "WriterTo"
+}
+
+// newWriterToName returns the name of the func creating the type
+// returned by writerToName, i.e. NewPageWriterTo for Page
+// and newPageWriterTo for page.
+func (f *funcType) newWriterToName() string {
+	if isUpper(f.name[0]) {
+		return "New" + f.writerToName()
+	}
+	r, size := utf8.DecodeRuneInString(f.name)
+	return "new" + string(unicode.ToUpper(r)) + f.name[size:] + "WriterTo"
+}
+
+// validateInline verifies whether calls to f may be expanded into its body.
+//
+// Args are bound to local variables at the call site, so only funcs
+// with plain args may be inlined.
+func (f *funcType) validateInline() error {
+	if !f.inline {
+		return nil
+	}
+	switch {
+	case len(f.defPrefix) > 0:
+		return errorf(KindInvalidFunc, "%q modifier cannot be used for methods", "inline")
+	case f.ctx:
+		return errorf(KindInvalidFunc, "%q modifier cannot be used together with %q modifier", "inline", "ctx")
+	case f.errResult:
+		return errorf(KindInvalidFunc, "%q modifier cannot be used together with %q modifier", "inline", "err")
+	case len(f.defaults) > 0:
+		return errorf(KindInvalidFunc, "%q modifier cannot be used for funcs with default arg values", "inline")
+	case strings.HasSuffix(f.argNames, "..."):
+		return errorf(KindInvalidFunc, "%q modifier cannot be used for funcs with variadic args", "inline")
+	}
+	return nil
+}
+
+// funcArg is the arg of the func.
+type funcArg struct {
+	name string
+	typ  string
+}
+
+// argList returns the args of the func one by one.
+func (f *funcType) argList() []funcArg {
+	if len(f.args) == 0 {
+		return nil
+	}
+	exprStr := fmt.Sprintf("func (%s)", f.args[len(", "):])
+	expr, err := goparser.ParseExpr(exprStr)
+	if err != nil {
+		panic(fmt.Sprintf("BUG: cannot parse args %q of func %q: %s", f.args, f.name, err))
+	}
+	var args []funcArg
+	for _, field := range expr.(*ast.FuncType).Params.List {
+		typ := exprStr[field.Type.Pos()-1 : field.Type.End()-1]
+		for _, n := range field.Names {
+			args = append(args, funcArg{
+				name: n.Name,
+				typ:  typ,
+			})
+		}
+	}
+	return args
+}
+
+// hasArg returns true if f has the arg with the given name.
+func (f *funcType) hasArg(name string) bool {
+	for _, arg := range strings.Split(f.argNames, ", ") {
+		if strings.TrimSuffix(arg, "...") == name {
+			return true
+		}
+	}
+	return false
+}
+
+// declaredIdents returns the identifiers declared by f inside the func body,
+// i.e. the receiver and the args.
+func (f *funcType) declaredIdents() []string {
+	var names []string
+	if len(f.recvType) > 0 {
+		names = append(names, strings.TrimSuffix(f.callPrefix, "."))
+	}
+	for _, arg := range strings.Split(f.argNames, ", ") {
+		if len(arg) > 0 {
+			names = append(names, strings.TrimSuffix(arg, "..."))
+		}
+	}
+	return names
+}
+
+func parseFuncSignature(b []byte) (*funcType, error) {
+	defStr := string(b)
+
+	// extract func name
+	n := strings.Index(defStr, "(")
+	if n < 0 {
+		return nil, errorf(KindInvalidCode, "cannot find '(' in function definition")
+	}
+	name := strings.TrimSpace(defStr[:n])
+	defStr = defStr[n+1:]
+	defPrefix := ""
+	callPrefix := ""
+	recvType := ""
+	if len(name) == 0 {
+		// Either empty func name or valid method definition. Let's check.
+
+		// parse method receiver
+		n = strings.Index(defStr, ")")
+		if n < 0 {
+			return nil, errorf(KindInvalidCode, "cannot find ')' in func")
+		}
+		recvStr := defStr[:n]
+		defStr = defStr[n+1:]
+		exprStr := fmt.Sprintf("func (%s)", recvStr)
+		expr, err := goparser.ParseExpr(exprStr)
+		if err != nil {
+			return nil, errorf(KindInvalidCode, "invalid method definition: %s", err)
+		}
+		ft, ok := expr.(*ast.FuncType)
+		if !ok {
+			return nil, errorf(KindInvalidCode, "invalid method definition: %q", recvStr)
+		}
+		if len(ft.Params.List) != 1 || len(ft.Params.List[0].Names) != 1 {
+			// method receiver must contain only one param
+			return nil, errorf(KindInvalidFunc, "missing func or method name")
+		}
+		recvName := ft.Params.List[0].Names[0].Name
+		if err = validateIdent(recvName); err != nil {
+			return nil, errorf(KindInvalidCode, "invalid method receiver: %s", err)
+		}
+		recvType = strings.TrimPrefix(types.ExprString(ft.Params.List[0].Type), "*")
+		defPrefix = fmt.Sprintf("(%s) ", fieldListString(exprStr, ft.Params.List))
+		callPrefix = recvName + "."
+
+		// extract method name
+		n = strings.Index(defStr, "(")
+		if n < 0 {
+			return nil, errorf(KindInvalidFunc, "missing func name")
+		}
+		name = strings.TrimSpace(defStr[:n])
+		if len(name) == 0 {
+			return nil, errorf(KindInvalidFunc, "missing method name")
+		}
+		defStr = defStr[n+1:]
+	}
+
+	// validate and collect func args
+	if len(defStr) == 0 || defStr[len(defStr)-1] != ')' {
+		return nil, errorf(KindInvalidCode, "missing ')' at the end of func")
+	}
+	args, defaults, err := splitArgDefaults(defStr[:len(defStr)-1])
+	if err != nil {
+		return nil, errorf(KindInvalidCode, "invalid func args: %s", err)
+	}
+	exprStr := fmt.Sprintf("func (%s)", args)
+	expr, err := goparser.ParseExpr(exprStr)
+	if err != nil {
+		return nil, errorf(KindInvalidCode, "invalid func args: %s", err)
+	}
+	ft, ok := expr.(*ast.FuncType)
+	if !ok {
+		return nil, errorf(KindInvalidCode, "invalid func args: %q", args)
+	}
+	if ft.Results != nil {
+		return nil, errorf(KindInvalidFunc, "func mustn't return any results")
+	}
+
+	// The trailing comma and newlines are valid in Go arg lists,
+	// but they are dropped, since args are joined with other args
+	// in the generated funcs.
+	args = fieldListString(exprStr, ft.Params.List)
+
+	// extract arg names
+	var tmp, required, chanArgs []string
+	for _, f := range ft.Params.List {
+		if len(f.Names) == 0 {
+			return nil, errorf(KindInvalidFunc, "func cannot contain untyped arguments")
+		}
+		for _, n := range f.Names {
+			if n == nil {
+				return nil, errorf(KindInvalidFunc, "func cannot contain untyped arguments")
+			}
+			if err = validateIdent(n.Name); err != nil {
+				return nil, errorf(KindInvalidCode, "invalid func args: %s", err)
+			}
+			_, isVariadic := f.Type.(*ast.Ellipsis)
+			if len(defaults) > 0 && len(defaults[len(tmp)]) > 0 {
+				if isVariadic {
+					return nil, errorf(KindInvalidFunc, "variadic arg %q cannot have default value", n.Name)
+				}
+			} else if len(required) < len(tmp) {
+				return nil, errorf(KindInvalidFunc, "arg %q must have default value, since it follows args with default values", n.Name)
+			} else {
+				required = append(required, n.Name+" "+exprStr[f.Type.Pos()-1:f.Type.End()-1])
+			}
+			if isVariadic {
+				tmp = append(tmp, n.Name+"...")
+			} else {
+				tmp = append(tmp, n.Name)
+			}
+			if _, ok := f.Type.(*ast.ChanType); ok {
+				chanArgs = append(chanArgs, n.Name)
+			}
+		}
+	}
+	argNames := strings.Join(tmp, ", ")
+	requiredArgNames := strings.Join(tmp[:len(required)], ", ")
+	requiredArgs := strings.Join(required, ", ")
+	if len(required) < len(tmp) {
+		defaults = defaults[len(required):]
+	} else {
+		defaults = nil
+	}
+
+	if len(args) > 0 {
+		args = ", " + args
+	}
+	if len(argNames) > 0 {
+		argNames = ", " + argNames
+	}
+	if len(requiredArgs) > 0 {
+		requiredArgs = ", " + requiredArgs
+		requiredArgNames = ", " + requiredArgNames
+	}
+	return &funcType{
+		name:             name,
+		recvType:         recvType,
+		defPrefix:        defPrefix,
+		callPrefix:       callPrefix,
+		argNames:         argNames,
+		args:             args,
+		defaults:         defaults,
+		requiredArgs:     requiredArgs,
+		requiredArgNames: requiredArgNames,
+		chanArgs:         chanArgs,
+	}, nil
+}
+
+// splitArgDefaults removes default values from func args
+// in the form `a int, b string = "foo"`, since Go doesn't accept them.
+//
+// defaults contains the default value for each arg name or an empty string
+// if the arg has no default value. nil defaults are returned if args
+// have no default values.
+func splitArgDefaults(args string) (string, []string, error) {
+	src := []byte(args)
+	fset := gotoken.NewFileSet()
+	f := fset.AddFile("", -1, len(src))
+	var sc goscanner.Scanner
+	sc.Init(f, src, nil, goscanner.ScanComments)
+	var dst bytes.Buffer
+	var defaults []string
+	depth := 0
+	argStart := 0
+	assign := -1
+	hasDefaults := false
+	addArg := func(end int) error {
+		if assign < 0 {
+			dst.Write(src[argStart:end])
+			defaults = append(defaults, "")
+			return nil
+		}
+		dst.Write(stripTrailingSpace(src[argStart:assign]))
+		v := string(bytes.TrimSpace(src[assign+1 : end]))
+		if err := validateArgDefault(v); err != nil {
+			return err
+		}
+		defaults = append(defaults, v)
+		hasDefaults = true
+		return nil
+	}
+	for {
+		pos, tok, _ := sc.Scan()
+		switch tok {
+		case gotoken.EOF:
+			if err := addArg(len(src)); err != nil {
+				return "", nil, err
+			}
+			if !hasDefaults {
+				return args, nil, nil
+			}
+			return dst.String(), defaults, nil
+		case gotoken.LPAREN, gotoken.LBRACK, gotoken.LBRACE:
+			depth++
+		case gotoken.RPAREN, gotoken.RBRACK, gotoken.RBRACE:
+			depth--
+		case gotoken.ASSIGN:
+			if depth == 0 {
+				if assign >= 0 {
+					return "", nil, errorf(KindUnexpectedToken, "unexpected '=' in %q", src[argStart:])
+				}
+				assign = f.Offset(pos)
+			}
+		case gotoken.COMMA:
+			if depth == 0 {
+				n := f.Offset(pos)
+				if err := addArg(n); err != nil {
+					return "", nil, err
+				}
+				dst.WriteByte(',')
+				argStart = n + 1
+				assign = -1
+			}
+		}
+	}
+}
+
+// validateArgDefault verifies whether v is a constant expression,
+// which may be used as the default value for func arg.
+func validateArgDefault(v string) error {
+	if len(v) == 0 {
+		return errorf(KindInvalidFunc, "missing default value after '='")
+	}
+	expr, err := goparser.ParseExpr(v)
+	if err != nil {
+		return errorf(KindInvalidCode, "invalid default value %q: %s", v, err)
+	}
+	if !isConstExpr(expr) {
+		return errorf(KindInvalidFunc, "default value %q must be a constant expression", v)
+	}
+	return nil
+}
+
+// isConstExpr returns true if expr may be a constant expression.
+//
+// Identifiers and qualified identifiers are assumed to refer constants,
+// since their types are unknown to the parser.
+func isConstExpr(expr ast.Expr) bool {
+	switch x := expr.(type) {
+	case *ast.BasicLit, *ast.Ident:
+		return true
+	case *ast.SelectorExpr:
+		_, ok := x.X.(*ast.Ident)
+		return ok
+	case *ast.ParenExpr:
+		return isConstExpr(x.X)
+	case *ast.UnaryExpr:
+		switch x.Op {
+		case gotoken.ADD, gotoken.SUB, gotoken.XOR, gotoken.NOT:
+			return isConstExpr(x.X)
+		}
+		return false
+	case *ast.BinaryExpr:
+		return isConstExpr(x.X) && isConstExpr(x.Y)
+	default:
+		return false
+	}
+}
+
+// defaultsFunc returns the func calling f with default values
+// for the trailing args. For instance, FDefaults(a int)
+// calls F(a, "foo") for {% func F(a int, b string = "foo") %}.
+//
+// nil is returned if f has no args with default values.
+func (f *funcType) defaultsFunc() *funcType {
+	if len(f.defaults) == 0 {
+		return nil
+	}
+	df := *f
+	df.name = f.name + "Defaults"
+	df.args = f.requiredArgs
+	df.argNames = f.requiredArgNames
+	df.defaults = nil
+	return &df
+}
+
+// withDefaults returns f with the default values passed to the trailing args.
+func (f *funcType) withDefaults() *funcType {
+	cf := *f
+	cf.argNames = f.requiredArgNames + ", " + strings.Join(f.defaults, ", ")
+	return &cf
+}
+
+// fieldListString returns the source code for the fields parsed from exprStr.
+//
+// Whitespace and comments between the fields are normalized, so multi-line
+// field lists are returned on a single line.
+func fieldListString(exprStr string, fields []*ast.Field) string {
+	a := make([]string, 0, len(fields))
+	for _, f := range fields {
+		typ := exprStr[f.Type.Pos()-1 : f.Type.End()-1]
+		if len(f.Names) == 0 {
+			a = append(a, typ)
+			continue
+		}
+		names := make([]string, 0, len(f.Names))
+		for _, n := range f.Names {
+			names = append(names, n.Name)
+		}
+		a = append(a, strings.Join(names, ", ")+" "+typ)
+	}
+	return strings.Join(a, ", ")
+}
+
+func parseFuncCall(b []byte) (*funcType, error) {
+	exprStr := string(b)
+	expr, err := goparser.ParseExpr(exprStr)
+	if err != nil {
+		return nil, err
+	}
+	ce, ok := expr.(*ast.CallExpr)
+	if !ok {
+		return nil, errorf(KindInvalidCode, "missing function call")
+	}
+	callPrefix, name, err := getCallName(ce)
+	if err != nil {
+		return nil, err
+	}
+	argNames := exprStr[ce.Lparen : ce.Rparen-1]
+
+	if len(argNames) > 0 {
+		argNames = ", " + argNames
+	}
+	return &funcType{
+		name:       name,
+		callPrefix: callPrefix,
+		argNames:   argNames,
+	}, nil
+}
+
+// parseFuncValue parses 'call r' contents of the output func tag,
+// where r is a func value accepting io.Writer.
+//
+// ok is false if b doesn't start with 'call' modifier. Contents such as
+// 'call (x)' are ordinary func calls, so they aren't treated as func values.
+func parseFuncValue(b []byte) (name string, ok bool, err error) {
+	const modifier = "call"
+	if !bytes.HasPrefix(b, []byte(modifier)) {
+		return "", false, nil
+	}
+	v := stripLeadingSpace(b[len(modifier):])
+	if len(v) == len(b)-len(modifier) {
+		// missing whitespace after the modifier
+		return "", false, nil
+	}
+	if _, err := goparser.ParseExpr(string(b)); err == nil {
+		return "", false, nil
+	}
+	name = string(stripTrailingSpace(v))
+	expr, err := goparser.ParseExpr(name)
+	if err != nil {
+		return "", true, err
+	}
+	if !isSelectorChain(expr) {
+		return "", true, errorf(KindInvalidCode, "func value %q must be identifier or selector", name)
+	}
+	return name, true, nil
+}
+
+// isSelectorChain returns true if expr is an identifier
+// or a chain of selectors such as a.b.c.
+func isSelectorChain(expr ast.Expr) bool {
+	switch x := expr.(type) {
+	case *ast.Ident:
+		return true
+	case *ast.SelectorExpr:
+		return isSelectorChain(x.X)
+	default:
+		return false
+	}
+}
+
+func (f *funcType) DefStream(dst string) string {
+	return fmt.Sprintf("%s%s%s(%s *qt%s.Writer%s)%s", f.defPrefix, f.prefixStream(), f.name, dst, mangleSuffix, f.args, f.errResultType())
+}
+
+func (f *funcType) CallStream(dst string) string {
+	return fmt.Sprintf("%s%s%s(%s%s)", f.callPrefix, f.prefixStream(), f.name, dst, f.argNames)
+}
+
+func (f *funcType) DefWrite(dst string) string {
+	return fmt.Sprintf("%s%s%s(%s qtio%s.Writer%s)%s", f.defPrefix, f.prefixWrite(), f.name, dst, mangleSuffix, f.args, f.errResultType())
+}
+
+// errResultType returns the result type of the stream and write funcs.
+func (f *funcType) errResultType() string {
+	if f.errResult {
+		return " error"
+	}
+	return ""
+}
+
+func (f *funcType) CallWrite(dst string) string {
+	return fmt.Sprintf("%s%s%s(%s%s)", f.callPrefix, f.prefixWrite(), f.name, dst, f.argNames)
+}
+
+func (f *funcType) DefWriteErr(dst string) string {
+	return fmt.Sprintf("%s%s%sErr(%s qtio%s.Writer%s) error", f.defPrefix, f.prefixWrite(), f.name, dst, mangleSuffix, f.args)
+}
+
+func (f *funcType) DefStreamClosure(dst string) string {
+	return fmt.Sprintf("%s%s := func(%s *qt%s.Writer%s)", f.prefixStream(), f.name, dst, mangleSuffix, f.args)
+}
+
+func (f *funcType) DefWriteClosure(dst string) string {
+	return fmt.Sprintf("%s%s := func(%s qtio%s.Writer%s)", f.prefixWrite(), f.name, dst, mangleSuffix, f.args)
+}
+
+func (f *funcType) DefAppend(dst string) string {
+	return fmt.Sprintf("%s%s%s(%s []byte%s) []byte", f.defPrefix, f.prefixAppend(), f.name, dst, f.args)
+}
+
+func (f *funcType) CallString() string {
+	argNames := f.argNames
+	if len(argNames) > 0 {
+		// skip the first ', '
+		argNames = argNames[2:]
+	}
+	return fmt.Sprintf("%s%s(%s)", f.callPrefix, f.name, argNames)
+}
+
+func (f *funcType) DefString() string {
+	args := f.args
+	if len(args) > 0 {
+		// skip the first ', '
+		args = args[2:]
+	}
+	if f.errResult {
+		return fmt.Sprintf("%s%s(%s) (string, error)", f.defPrefix, f.name, args)
+	}
+	return fmt.Sprintf("%s%s(%s) string", f.defPrefix, f.name, args)
+}
+
+// generatedName is a name of the func generated for the template.
+type generatedName struct {
+	// name is prefixed with the receiver type for methods.
+	name string
+
+	// desc is human-readable description for error messages.
+	desc string
+
+	// line is the template line with the func definition.
+	line int
+}
+
+// generatedNames returns names of the funcs generated for f.
+//
+// appendFuncs and errFuncs must be set if append and error-returning
+// write funcs are generated.
+func (f *funcType) generatedNames(appendFuncs, errFuncs bool) []generatedName {
+	prefix := ""
+	desc := "func " + f.name
+	if len(f.recvType) > 0 {
+		prefix = f.recvType + "."
+		desc = "method " + prefix + f.name
+	}
+	var names []generatedName
+	if df := f.defaultsFunc(); df != nil {
+		names = df.generatedNames(false, false)
+	}
+	if f.writerTo {
+		names = append(names, []generatedName{
+			{name: f.writerToName(), desc: "the io.WriterTo type of " + desc},
+			{name: f.newWriterToName(), desc: "the io.WriterTo constructor of " + desc},
+		}...)
+	}
+	if f.streamOnly {
+		return append(names, generatedName{name: prefix + f.prefixStream() + f.name, desc: "stream-only " + desc})
+	}
+	names = append(names, []generatedName{
+		{name: prefix + f.name, desc: desc},
+		{name: prefix + f.prefixStream() + f.name, desc: "the stream wrapper of " + desc},
+		{name: prefix + f.prefixWrite() + f.name, desc: "the write wrapper of " + desc},
+	}...)
+	if f.errResult {
+		// Append and error-returning write funcs aren't generated
+		// for funcs with err modifier, since their write func returns error.
+		return names
+	}
+	if appendFuncs {
+		names = append(names, generatedName{name: prefix + f.prefixAppend() + f.name, desc: "the append wrapper of " + desc})
+	}
+	if errFuncs {
+		names = append(names, generatedName{name: prefix + f.prefixWrite() + f.name + "Err", desc: "the error-returning write wrapper of " + desc})
+	}
+	return names
+}
+
+func (f *funcType) prefixWrite() string {
+	s := "write"
+	if isUpper(f.name[0]) {
+		s = "Write"
+	}
+	return s
+}
+
+func (f *funcType) prefixAppend() string {
+	s := "append"
+	if isUpper(f.name[0]) {
+		s = "Append"
+	}
+	return s
+}
+
+func (f *funcType) prefixStream() string {
+	s := "stream"
+	if isUpper(f.name[0]) {
+		s = "Stream"
+	}
+	return s
+}
+
+func getCallName(ce *ast.CallExpr) (string, string, error) {
+	callPrefix := ""
+	name := ""
+	expr := ce.Fun
+	for {
+		switch x := expr.(type) {
+		case *ast.Ident:
+			if len(callPrefix) == 0 && len(name) == 0 {
+				return "", x.Name, nil
+			}
+			callPrefix = x.Name + "." + callPrefix
+			return callPrefix, name, nil
+		case *ast.SelectorExpr:
+			if len(name) == 0 {
+				name = x.Sel.Name
+			} else {
+				callPrefix = x.Sel.Name + "." + callPrefix
+			}
+			expr = x.X
+		default:
+			return "", "", errorf(KindUnexpectedToken, "unexpected function name")
+		}
+	}
+}
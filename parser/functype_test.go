@@ -0,0 +1,506 @@
+package parser
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseFuncCallSuccess(t *testing.T) {
+	// func without args
+	testParseFuncCallSuccess(t, "f()", "streamf(qw422016)")
+
+	// func with args
+	testParseFuncCallSuccess(t, "Foo(a, b)", "StreamFoo(qw422016, a, b)")
+
+	// method without args
+	testParseFuncCallSuccess(t, "a.f()", "a.streamf(qw422016)")
+
+	// method with args
+	testParseFuncCallSuccess(t, "a.f(xx)", "a.streamf(qw422016, xx)")
+
+	// chained method
+	testParseFuncCallSuccess(t, "foo.bar.Baz(x, y)", "foo.bar.StreamBaz(qw422016, x, y)")
+
+	// complex args
+	testParseFuncCallSuccess(t, `as.ffs.SS(
+		func(x int, y string) {
+			panic("foobar")
+		},
+		map[string]int{
+			"foo":1,
+			"bar":2,
+		},
+		qawe)`,
+		`as.ffs.StreamSS(qw422016, 
+		func(x int, y string) {
+			panic("foobar")
+		},
+		map[string]int{
+			"foo":1,
+			"bar":2,
+		},
+		qawe)`)
+}
+
+func TestParseFuncCallFailure(t *testing.T) {
+	testParseFuncCallFailure(t, "")
+
+	// non-func
+	testParseFuncCallFailure(t, "foobar")
+	testParseFuncCallFailure(t, "a, b, c")
+	testParseFuncCallFailure(t, "{}")
+	testParseFuncCallFailure(t, "(a)")
+	testParseFuncCallFailure(t, "(f())")
+
+	// inline func
+	testParseFuncCallFailure(t, "func() {}()")
+	testParseFuncCallFailure(t, "func a() {}()")
+
+	// nonempty tail after func call
+	testParseFuncCallFailure(t, "f(); f1()")
+	testParseFuncCallFailure(t, "f()\nf1()")
+	testParseFuncCallFailure(t, "f()\n for {}")
+}
+
+func testParseFuncCallFailure(t *testing.T, s string) {
+	_, err := parseFuncCall([]byte(s))
+	if err == nil {
+		t.Fatalf("expecting non-nil error when parsing %q", s)
+	}
+}
+
+func testParseFuncCallSuccess(t *testing.T, s, callStream string) {
+	f, err := parseFuncCall([]byte(s))
+	if err != nil {
+		t.Fatalf("unexpected error when parsing %q: %s", s, err)
+	}
+	cs := f.CallStream("qw422016")
+	if cs != callStream {
+		t.Fatalf("unexpected CallStream: %q. Expecting %q. s=%q", cs, callStream, s)
+	}
+}
+
+func TestParseFuncDefSuccess(t *testing.T) {
+	// private func without args
+	testParseFuncDefSuccess(t, "xx()", "xx() string",
+		"streamxx(qw422016 *qt422016.Writer)", "streamxx(qw422016)",
+		"writexx(qq422016 qtio422016.Writer)", "writexx(qq422016)")
+
+	// public func with a single arg
+	testParseFuncDefSuccess(t, "F(a int)", "F(a int) string",
+		"StreamF(qw422016 *qt422016.Writer, a int)", "StreamF(qw422016, a)",
+		"WriteF(qq422016 qtio422016.Writer, a int)", "WriteF(qq422016, a)")
+
+	// public method without args
+	testParseFuncDefSuccess(t, "(f *foo) M()", "(f *foo) M() string",
+		"(f *foo) StreamM(qw422016 *qt422016.Writer)", "f.StreamM(qw422016)",
+		"(f *foo) WriteM(qq422016 qtio422016.Writer)", "f.WriteM(qq422016)")
+
+	// private method with three args
+	testParseFuncDefSuccess(t, "(f *Foo) bar(x, y string, z int)", "(f *Foo) bar(x, y string, z int) string",
+		"(f *Foo) streambar(qw422016 *qt422016.Writer, x, y string, z int)", "f.streambar(qw422016, x, y, z)",
+		"(f *Foo) writebar(qq422016 qtio422016.Writer, x, y string, z int)", "f.writebar(qq422016, x, y, z)")
+
+	// method with complex args
+	testParseFuncDefSuccess(t, "(t TPL) Head(h1, h2 func(x, y int), h3 map[int]struct{})", "(t TPL) Head(h1, h2 func(x, y int), h3 map[int]struct{}) string",
+		"(t TPL) StreamHead(qw422016 *qt422016.Writer, h1, h2 func(x, y int), h3 map[int]struct{})", "t.StreamHead(qw422016, h1, h2, h3)",
+		"(t TPL) WriteHead(qq422016 qtio422016.Writer, h1, h2 func(x, y int), h3 map[int]struct{})", "t.WriteHead(qq422016, h1, h2, h3)")
+
+	// method with variadic arguments
+	testParseFuncDefSuccess(t, "(t TPL) Head(name string, num int, otherNames ...string)", "(t TPL) Head(name string, num int, otherNames ...string) string",
+		"(t TPL) StreamHead(qw422016 *qt422016.Writer, name string, num int, otherNames ...string)", "t.StreamHead(qw422016, name, num, otherNames...)",
+		"(t TPL) WriteHead(qq422016 qtio422016.Writer, name string, num int, otherNames ...string)", "t.WriteHead(qq422016, name, num, otherNames...)")
+
+	// trailing comma
+	testParseFuncDefSuccess(t, "F(a int,)", "F(a int) string",
+		"StreamF(qw422016 *qt422016.Writer, a int)", "StreamF(qw422016, a)",
+		"WriteF(qq422016 qtio422016.Writer, a int)", "WriteF(qq422016, a)")
+	testParseFuncDefSuccess(t, "(f *foo) M(a int, b ...string, )", "(f *foo) M(a int, b ...string) string",
+		"(f *foo) StreamM(qw422016 *qt422016.Writer, a int, b ...string)", "f.StreamM(qw422016, a, b...)",
+		"(f *foo) WriteM(qq422016 qtio422016.Writer, a int, b ...string)", "f.WriteM(qq422016, a, b...)")
+
+	// multi-line args
+	testParseFuncDefSuccess(t, "F(\n\ta int,\n\tb string,\n)", "F(a int, b string) string",
+		"StreamF(qw422016 *qt422016.Writer, a int, b string)", "StreamF(qw422016, a, b)",
+		"WriteF(qq422016 qtio422016.Writer, a int, b string)", "WriteF(qq422016, a, b)")
+	testParseFuncDefSuccess(t, "(\n\tf *foo,\n) M (\n\ta,\n\tb int, // a and b\n\tc\tmap[string]int, /* c */\n)", "(f *foo) M(a, b int, c map[string]int) string",
+		"(f *foo) StreamM(qw422016 *qt422016.Writer, a, b int, c map[string]int)", "f.StreamM(qw422016, a, b, c)",
+		"(f *foo) WriteM(qq422016 qtio422016.Writer, a, b int, c map[string]int)", "f.WriteM(qq422016, a, b, c)")
+}
+
+func TestParseFuncDefStreamModifier(t *testing.T) {
+	testParseFuncDefStreamOnly(t, "stream F(a int)", true, "StreamF(qw422016 *qt422016.Writer, a int)")
+	testParseFuncDefStreamOnly(t, "stream\t(f *foo) M()", true, "(f *foo) StreamM(qw422016 *qt422016.Writer)")
+
+	// funcs named stream
+	testParseFuncDefStreamOnly(t, "stream(a int)", false, "streamstream(qw422016 *qt422016.Writer, a int)")
+	testParseFuncDefStreamOnly(t, "streamF(a int)", false, "streamstreamF(qw422016 *qt422016.Writer, a int)")
+	testParseFuncDefStreamOnly(t, "(f *foo) stream()", false, "(f *foo) streamstream(qw422016 *qt422016.Writer)")
+
+	// missing func after the modifier
+	testParseFuncDefFailure(t, "stream ")
+}
+
+func TestParseFuncDefEscapeModifier(t *testing.T) {
+	testParseFuncDefEscapeMode(t, "html F(a int)", "html", false, "F(a int) string")
+	testParseFuncDefEscapeMode(t, "text\tF()", "text", false, "F() string")
+	testParseFuncDefEscapeMode(t, "F()", "", false, "F() string")
+
+	// combined with stream modifier
+	testParseFuncDefEscapeMode(t, "stream text F()", "text", true, "F() string")
+	testParseFuncDefEscapeMode(t, "html stream (f *foo) M()", "html", true, "(f *foo) M() string")
+
+	// funcs named html and text
+	testParseFuncDefEscapeMode(t, "html()", "", false, "html() string")
+	testParseFuncDefEscapeMode(t, "textF(a int)", "", false, "textF(a int) string")
+	testParseFuncDefEscapeMode(t, "stream text()", "", true, "text() string")
+	testParseFuncDefEscapeMode(t, "text html()", "text", false, "html() string")
+
+	// conflicting modifiers
+	testParseFuncDefFailure(t, "html text F()")
+	testParseFuncDefFailure(t, "text text F()")
+	testParseFuncDefFailure(t, "stream stream F()")
+}
+
+func TestParseFuncDefCtxModifier(t *testing.T) {
+	testParseFuncDefSuccess(t, "ctx F(a int)", "F(ctx qtctx422016.Context, a int) string",
+		"StreamF(qw422016 *qt422016.Writer, ctx qtctx422016.Context, a int)", "StreamF(qw422016, ctx, a)",
+		"WriteF(qq422016 qtio422016.Writer, ctx qtctx422016.Context, a int)", "WriteF(qq422016, ctx, a)")
+	testParseFuncDefSuccess(t, "stream ctx (f *foo) M()", "(f *foo) M(ctx qtctx422016.Context) string",
+		"(f *foo) StreamM(qw422016 *qt422016.Writer, ctx qtctx422016.Context)", "f.StreamM(qw422016, ctx)",
+		"(f *foo) WriteM(qq422016 qtio422016.Writer, ctx qtctx422016.Context)", "f.WriteM(qq422016, ctx)")
+
+	// funcs named ctx
+	testParseFuncDefSuccess(t, "ctx(a int)", "ctx(a int) string",
+		"streamctx(qw422016 *qt422016.Writer, a int)", "streamctx(qw422016, a)",
+		"writectx(qq422016 qtio422016.Writer, a int)", "writectx(qq422016, a)")
+	testParseFuncDefSuccess(t, "ctxF()", "ctxF() string",
+		"streamctxF(qw422016 *qt422016.Writer)", "streamctxF(qw422016)",
+		"writectxF(qq422016 qtio422016.Writer)", "writectxF(qq422016)")
+
+	// duplicate modifier and the arg named ctx
+	testParseFuncDefFailure(t, "ctx ctx F()")
+	testParseFuncDefFailure(t, "ctx F(ctx context.Context)")
+	testParseFuncDefFailure(t, "ctx F(a int, ctx ...string)")
+}
+
+func TestParseFuncDefErrModifier(t *testing.T) {
+	testParseFuncDefSuccess(t, "err F(a int)", "F(a int) (string, error)",
+		"StreamF(qw422016 *qt422016.Writer, a int) error", "StreamF(qw422016, a)",
+		"WriteF(qq422016 qtio422016.Writer, a int) error", "WriteF(qq422016, a)")
+	testParseFuncDefSuccess(t, "ctx err (f *foo) M()", "(f *foo) M(ctx qtctx422016.Context) (string, error)",
+		"(f *foo) StreamM(qw422016 *qt422016.Writer, ctx qtctx422016.Context) error", "f.StreamM(qw422016, ctx)",
+		"(f *foo) WriteM(qq422016 qtio422016.Writer, ctx qtctx422016.Context) error", "f.WriteM(qq422016, ctx)")
+
+	// funcs named err
+	testParseFuncDefSuccess(t, "err(a int)", "err(a int) string",
+		"streamerr(qw422016 *qt422016.Writer, a int)", "streamerr(qw422016, a)",
+		"writeerr(qq422016 qtio422016.Writer, a int)", "writeerr(qq422016, a)")
+	testParseFuncDefSuccess(t, "err err()", "err() (string, error)",
+		"streamerr(qw422016 *qt422016.Writer) error", "streamerr(qw422016)",
+		"writeerr(qq422016 qtio422016.Writer) error", "writeerr(qq422016)")
+
+	// duplicate modifier
+	testParseFuncDefFailure(t, "err err F()")
+}
+
+func TestParseFuncDefPrivateModifier(t *testing.T) {
+	testParseFuncDefSuccess(t, "private X(a int)", "x(a int) string",
+		"streamx(qw422016 *qt422016.Writer, a int)", "streamx(qw422016, a)",
+		"writex(qq422016 qtio422016.Writer, a int)", "writex(qq422016, a)")
+	testParseFuncDefSuccess(t, "X(a int)", "X(a int) string",
+		"StreamX(qw422016 *qt422016.Writer, a int)", "StreamX(qw422016, a)",
+		"WriteX(qq422016 qtio422016.Writer, a int)", "WriteX(qq422016, a)")
+	testParseFuncDefSuccess(t, "private ctx (f *foo) M()", "(f *foo) m(ctx qtctx422016.Context) string",
+		"(f *foo) streamm(qw422016 *qt422016.Writer, ctx qtctx422016.Context)", "f.streamm(qw422016, ctx)",
+		"(f *foo) writem(qq422016 qtio422016.Writer, ctx qtctx422016.Context)", "f.writem(qq422016, ctx)")
+
+	// already unexported func
+	testParseFuncDefSuccess(t, "private x()", "x() string",
+		"streamx(qw422016 *qt422016.Writer)", "streamx(qw422016)",
+		"writex(qq422016 qtio422016.Writer)", "writex(qq422016)")
+
+	// funcs named private
+	testParseFuncDefSuccess(t, "private()", "private() string",
+		"streamprivate(qw422016 *qt422016.Writer)", "streamprivate(qw422016)",
+		"writeprivate(qq422016 qtio422016.Writer)", "writeprivate(qq422016)")
+	testParseFuncDefSuccess(t, "stream private()", "private() string",
+		"streamprivate(qw422016 *qt422016.Writer)", "streamprivate(qw422016)",
+		"writeprivate(qq422016 qtio422016.Writer)", "writeprivate(qq422016)")
+
+	// duplicate modifier
+	testParseFuncDefFailure(t, "private private X()")
+}
+
+func TestParseFuncDefInlineModifier(t *testing.T) {
+	testParseFuncDefSuccess(t, "inline X(a int, b string)", "X(a int, b string) string",
+		"StreamX(qw422016 *qt422016.Writer, a int, b string)", "StreamX(qw422016, a, b)",
+		"WriteX(qq422016 qtio422016.Writer, a int, b string)", "WriteX(qq422016, a, b)")
+	testParseFuncDefSuccess(t, "inline private X()", "x() string",
+		"streamx(qw422016 *qt422016.Writer)", "streamx(qw422016)",
+		"writex(qq422016 qtio422016.Writer)", "writex(qq422016)")
+
+	f, err := parseFuncDef([]byte("inline X(a, b int, c map[string][]int)"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	args := f.argList()
+	expectedArgs := []funcArg{{"a", "int"}, {"b", "int"}, {"c", "map[string][]int"}}
+	if !reflect.DeepEqual(args, expectedArgs) {
+		t.Fatalf("unexpected inline args; got %v; want %v", args, expectedArgs)
+	}
+
+	// func named inline
+	testParseFuncDefSuccess(t, "inline()", "inline() string",
+		"streaminline(qw422016 *qt422016.Writer)", "streaminline(qw422016)",
+		"writeinline(qq422016 qtio422016.Writer)", "writeinline(qq422016)")
+
+	// duplicate modifier
+	testParseFuncDefFailure(t, "inline inline X()")
+
+	// funcs, which cannot be inlined
+	testParseFuncDefFailure(t, "inline (f *foo) M()")
+	testParseFuncDefFailure(t, "inline ctx X()")
+	testParseFuncDefFailure(t, "inline err X()")
+	testParseFuncDefFailure(t, "inline X(a int, b string = \"foo\")")
+	testParseFuncDefFailure(t, "inline X(a ...int)")
+}
+
+func TestParseFuncDefWriterToModifier(t *testing.T) {
+	testParseFuncDefWriterTo(t, "writerto Page(title string)", "Page(title string) string", "PageWriterTo", "NewPageWriterTo")
+	testParseFuncDefWriterTo(t, "writerto private Page()", "page() string", "pageWriterTo", "newPageWriterTo")
+	testParseFuncDefWriterTo(t, "err stream writerto Page(a ...int)", "Page(a ...int) (string, error)", "PageWriterTo", "NewPageWriterTo")
+
+	// func named writerto
+	testParseFuncDefSuccess(t, "writerto()", "writerto() string",
+		"streamwriterto(qw422016 *qt422016.Writer)", "streamwriterto(qw422016)",
+		"writewriterto(qq422016 qtio422016.Writer)", "writewriterto(qq422016)")
+
+	// duplicate modifier
+	testParseFuncDefFailure(t, "writerto writerto Page()")
+
+	// methods
+	testParseFuncDefFailure(t, "writerto (p *Page) Body()")
+}
+
+func testParseFuncDefWriterTo(t *testing.T, s, def, typeName, newName string) {
+	f, err := parseFuncDef([]byte(s))
+	if err != nil {
+		t.Fatalf("cannot parse %q: %s", s, err)
+	}
+	if !f.writerTo {
+		t.Fatalf("writerTo must be set for %q", s)
+	}
+	if f.DefString() != def {
+		t.Fatalf("unexpected DefString: %q. Expecting %q. s=%q", f.DefString(), def, s)
+	}
+	if f.writerToName() != typeName {
+		t.Fatalf("unexpected writerToName: %q. Expecting %q. s=%q", f.writerToName(), typeName, s)
+	}
+	if f.newWriterToName() != newName {
+		t.Fatalf("unexpected newWriterToName: %q. Expecting %q. s=%q", f.newWriterToName(), newName, s)
+	}
+}
+
+func TestParseFuncDefSizeHint(t *testing.T) {
+	testParseFuncDefSizeHint(t, "Page() hint(8192)", 8192, "Page() string")
+	testParseFuncDefSizeHint(t, "private Page(s string) hint( 0x2000 )", 8192, "page(s string) string")
+	testParseFuncDefSizeHint(t, "(p *P) Body() hint(100)", 100, "(p *P) Body() string")
+	testParseFuncDefSizeHint(t, "Page()hint(1)", 1, "Page() string")
+
+	// funcs and methods named hint
+	testParseFuncDefSizeHint(t, "hint(n int)", 0, "hint(n int) string")
+	testParseFuncDefSizeHint(t, "(p *P) hint(n int)", 0, "(p *P) hint(n int) string")
+
+	// invalid hints
+	testParseFuncDefFailure(t, "Page() hint(0)")
+	testParseFuncDefFailure(t, "Page() hint(-1)")
+	testParseFuncDefFailure(t, "Page() hint(n)")
+	testParseFuncDefFailure(t, "Page() hint(1.5)")
+	testParseFuncDefFailure(t, "Page() hint(\"100\")")
+	testParseFuncDefFailure(t, "Page() hint(1e10)")
+	testParseFuncDefFailure(t, "Page() hint(99999999999)")
+}
+
+func testParseFuncDefSizeHint(t *testing.T, s string, sizeHint int, def string) {
+	f, err := parseFuncDef([]byte(s))
+	if err != nil {
+		t.Fatalf("cannot parse %q: %s", s, err)
+	}
+	if f.sizeHint != sizeHint {
+		t.Fatalf("unexpected sizeHint: %d. Expecting %d. s=%q", f.sizeHint, sizeHint, s)
+	}
+	if f.DefString() != def {
+		t.Fatalf("unexpected DefString: %q. Expecting %q. s=%q", f.DefString(), def, s)
+	}
+}
+
+func testParseFuncDefEscapeMode(t *testing.T, s, escapeMode string, streamOnly bool, def string) {
+	f, err := parseFuncDef([]byte(s))
+	if err != nil {
+		t.Fatalf("cannot parse %q: %s", s, err)
+	}
+	if f.escapeMode != escapeMode {
+		t.Fatalf("unexpected escapeMode: %q. Expecting %q. s=%q", f.escapeMode, escapeMode, s)
+	}
+	if f.streamOnly != streamOnly {
+		t.Fatalf("unexpected streamOnly: %v. Expecting %v. s=%q", f.streamOnly, streamOnly, s)
+	}
+	if f.DefString() != def {
+		t.Fatalf("unexpected DefString: %q. Expecting %q. s=%q", f.DefString(), def, s)
+	}
+}
+
+func testParseFuncDefStreamOnly(t *testing.T, s string, streamOnly bool, defStream string) {
+	f, err := parseFuncDef([]byte(s))
+	if err != nil {
+		t.Fatalf("cannot parse %q: %s", s, err)
+	}
+	if f.streamOnly != streamOnly {
+		t.Fatalf("unexpected streamOnly: %v. Expecting %v. s=%q", f.streamOnly, streamOnly, s)
+	}
+	ds := f.DefStream("qw422016")
+	if ds != defStream {
+		t.Fatalf("unexpected DefStream: %q. Expecting %q. s=%q", ds, defStream, s)
+	}
+}
+
+func TestParseFuncDefDefaults(t *testing.T) {
+	// default values are stripped from the generated funcs
+	testParseFuncDefSuccess(t, `Card(title string, subtitle string = "", n int = -1)`, "Card(title string, subtitle string, n int) string",
+		"StreamCard(qw422016 *qt422016.Writer, title string, subtitle string, n int)", "StreamCard(qw422016, title, subtitle, n)",
+		"WriteCard(qq422016 qtio422016.Writer, title string, subtitle string, n int)", "WriteCard(qq422016, title, subtitle, n)")
+	testParseFuncDefDefaults(t, `Card(title string, subtitle string = "", n int = -1)`,
+		"CardDefaults(title string) string", `StreamCard(qw422016, title, "", -1)`, `Card(title, "", -1)`)
+
+	// all the args may have default values
+	testParseFuncDefDefaults(t, `F(a int = 1 << 2, c string = pkg.Name)`,
+		"FDefaults() string", "StreamF(qw422016, 1 << 2, pkg.Name)", "F(1 << 2, pkg.Name)")
+	testParseFuncDefDefaults(t, `F(a, b int = (1 + 2) * 3)`,
+		"FDefaults(a int) string", "StreamF(qw422016, a, (1 + 2) * 3)", "F(a, (1 + 2) * 3)")
+
+	// methods and ctx funcs
+	testParseFuncDefDefaults(t, `(p *Page) Row(a int, m map[string]int, b bool = !true)`,
+		"(p *Page) RowDefaults(a int, m map[string]int) string", "p.StreamRow(qw422016, a, m, !true)", "p.Row(a, m, !true)")
+	testParseFuncDefDefaults(t, `ctx F(a int, s string = "x")`,
+		"FDefaults(ctx qtctx422016.Context, a int) string", `StreamF(qw422016, ctx, a, "x")`, `F(ctx, a, "x")`)
+
+	// funcs without default values have no defaults func
+	f, err := parseFuncDef([]byte("F(a int, b string)"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if f.defaultsFunc() != nil {
+		t.Fatalf("unexpected defaults func for %q", "F(a int, b string)")
+	}
+
+	// '=' inside arg types isn't a default value
+	testParseFuncDefSuccess(t, "F(a [2]int, f func(x int))", "F(a [2]int, f func(x int)) string",
+		"StreamF(qw422016 *qt422016.Writer, a [2]int, f func(x int))", "StreamF(qw422016, a, f)",
+		"WriteF(qq422016 qtio422016.Writer, a [2]int, f func(x int))", "WriteF(qq422016, a, f)")
+
+	testParseFuncDefFailureMsg(t, `F(a int = 1, b string)`, `arg "b" must have default value, since it follows args with default values`)
+	testParseFuncDefFailureMsg(t, `F(a int, b ...string = nil)`, `variadic arg "b" cannot have default value`)
+	testParseFuncDefFailureMsg(t, `F(a int =)`, "missing default value after '='")
+	testParseFuncDefFailureMsg(t, `F(a int = 1 = 2)`, "unexpected '='")
+	testParseFuncDefFailureMsg(t, `F(a int = f())`, `default value "f()" must be a constant expression`)
+	testParseFuncDefFailureMsg(t, `F(a []int = []int{1})`, "must be a constant expression")
+	testParseFuncDefFailureMsg(t, `F(a int = x.y.z)`, "must be a constant expression")
+	testParseFuncDefFailureMsg(t, `F(a int = 1 +)`, "invalid default value")
+}
+
+func testParseFuncDefDefaults(t *testing.T, s, defString, callStream, callString string) {
+	t.Helper()
+	f, err := parseFuncDef([]byte(s))
+	if err != nil {
+		t.Fatalf("cannot parse %q: %s", s, err)
+	}
+	df := f.defaultsFunc()
+	if df == nil {
+		t.Fatalf("missing defaults func for %q", s)
+	}
+	if ds := df.DefString(); ds != defString {
+		t.Fatalf("unexpected DefString: %q. Expecting %q. s=%q", ds, defString, s)
+	}
+	cf := f.withDefaults()
+	if cs := cf.CallStream("qw422016"); cs != callStream {
+		t.Fatalf("unexpected CallStream: %q. Expecting %q. s=%q", cs, callStream, s)
+	}
+	if cs := cf.CallString(); cs != callString {
+		t.Fatalf("unexpected CallString: %q. Expecting %q. s=%q", cs, callString, s)
+	}
+}
+
+func testParseFuncDefFailureMsg(t *testing.T, s, expectedMsg string) {
+	t.Helper()
+	f, err := parseFuncDef([]byte(s))
+	if err == nil {
+		t.Fatalf("expecting error when parsing %q. got %#v", s, f)
+	}
+	if !strings.Contains(err.Error(), expectedMsg) {
+		t.Fatalf("unexpected error when parsing %q: %q. Expecting %q", s, err, expectedMsg)
+	}
+}
+
+func TestParseFuncDefFailure(t *testing.T) {
+	testParseFuncDefFailure(t, "")
+
+	// invalid syntax
+	testParseFuncDefFailure(t, "foobar")
+	testParseFuncDefFailure(t, "f() {")
+	testParseFuncDefFailure(t, "for {}")
+	testParseFuncDefFailure(t, "0()A()")
+
+	// lone comma
+	testParseFuncDefFailure(t, "f(,)")
+	testParseFuncDefFailure(t, "f(a int,,)")
+
+	// missing func name
+	testParseFuncDefFailure(t, "()")
+	testParseFuncDefFailure(t, "(a int, b string)")
+
+	// missing method name
+	testParseFuncDefFailure(t, "(x XX) ()")
+	testParseFuncDefFailure(t, "(x XX) (y, z string)")
+
+	// func with return values
+	testParseFuncDefFailure(t, "f() string")
+	testParseFuncDefFailure(t, "f() (int, string)")
+	testParseFuncDefFailure(t, "(x XX) f() string")
+	testParseFuncDefFailure(t, "(x XX) f(a int) (int, string)")
+}
+
+func testParseFuncDefFailure(t *testing.T, s string) {
+	f, err := parseFuncDef([]byte(s))
+	if err == nil {
+		t.Fatalf("expecting error when parsing %q. got %#v", s, f)
+	}
+}
+
+func testParseFuncDefSuccess(t *testing.T, s, defString, defStream, callStream, defWrite, callWrite string) {
+	f, err := parseFuncDef([]byte(s))
+	if err != nil {
+		t.Fatalf("cannot parse %q: %s", s, err)
+	}
+	ds := f.DefString()
+	if ds != defString {
+		t.Fatalf("unexpected DefString: %q. Expecting %q. s=%q", ds, defString, s)
+	}
+	ds = f.DefStream("qw422016")
+	if ds != defStream {
+		t.Fatalf("unexpected DefStream: %q. Expecting %q. s=%q", ds, defStream, s)
+	}
+	cs := f.CallStream("qw422016")
+	if cs != callStream {
+		t.Fatalf("unexpected CallStream: %q. Expecting %q. s=%q", cs, callStream, s)
+	}
+	dw := f.DefWrite("qq422016")
+	if dw != defWrite {
+		t.Fatalf("unexpected DefWrite: %q. Expecting %q. s=%q", dw, defWrite, s)
+	}
+	cw := f.CallWrite("qq422016")
+	if cw != callWrite {
+		t.Fatalf("unexpected CallWrite: %q. Expecting %q. s=%q", cw, callWrite, s)
+	}
+}
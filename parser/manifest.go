@@ -0,0 +1,104 @@
+package parser
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/types"
+	"io"
+	"strings"
+)
+
+// manifest describes the funcs generated for the template file.
+//
+// It is written to ParseOptions.Manifest as JSON, so tools may wire
+// templates into routers or document the available renderers
+// without parsing the generated code.
+type manifest struct {
+	// File is the path to the template file.
+	File string `json:"file"`
+
+	// Package is the package name of the generated code.
+	Package string `json:"package"`
+
+	Funcs []manifestFunc `json:"funcs"`
+}
+
+// manifestFunc describes the top-level template func or macro.
+type manifestFunc struct {
+	// Name is the name of the func as defined in the template,
+	// i.e. Page for {% func Page() %}.
+	Name string `json:"name"`
+
+	// Receiver is the receiver type for methods such as *Page.
+	Receiver string `json:"receiver,omitempty"`
+
+	Params []manifestParam `json:"params"`
+
+	// Exported is set if the generated funcs are exported.
+	Exported bool `json:"exported"`
+
+	// Generated contains the names of all the funcs generated
+	// for the template func, i.e. Page, StreamPage and WritePage.
+	Generated []string `json:"generated"`
+
+	// Line is the template line with the func definition.
+	Line int `json:"line"`
+}
+
+// manifestParam is the param of the template func.
+type manifestParam struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// addManifestFunc registers the top-level func f defined at the given
+// template line for the manifest.
+func (p *parser) addManifestFunc(f *funcType, line int) {
+	mf := manifestFunc{
+		Name:     f.name,
+		Params:   []manifestParam{},
+		Exported: isUpper(f.name[0]),
+		Line:     line + 1,
+	}
+	if len(f.defPrefix) > 0 {
+		fields := argFields(", " + strings.TrimSuffix(strings.TrimPrefix(f.defPrefix, "("), ") "))
+		mf.Receiver = types.ExprString(fields[0].Type)
+	}
+	for _, field := range argFields(f.args) {
+		// ctx modifier adds the arg of the mangled context.Context type.
+		typ := strings.Replace(types.ExprString(field.Type), "qtctx"+mangleSuffix+".", "context.", 1)
+		for _, n := range field.Names {
+			mf.Params = append(mf.Params, manifestParam{
+				Name: n.Name,
+				Type: typ,
+			})
+		}
+	}
+	prefix := ""
+	if len(f.recvType) > 0 {
+		prefix = f.recvType + "."
+	}
+	for _, n := range f.generatedNames(p.appendFuncs, p.errFuncs) {
+		mf.Generated = append(mf.Generated, strings.TrimPrefix(n.name, prefix))
+	}
+	p.manifestFuncs = append(p.manifestFuncs, mf)
+}
+
+// emitManifest writes the manifest for p.manifestFuncs to w.
+func (p *parser) emitManifest(w io.Writer) error {
+	m := &manifest{
+		File:    p.s.filePath,
+		Package: p.packageName,
+		Funcs:   p.manifestFuncs,
+	}
+	if m.Funcs == nil {
+		m.Funcs = []manifestFunc{}
+	}
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("cannot marshal manifest for %q: %s", p.s.filePath, err)
+	}
+	data = append(data, '\n')
+	_, err = w.Write(data)
+	return err
+}
@@ -0,0 +1,96 @@
+package parser
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ParseFS compiles the templates matching the pattern in fsys.
+//
+// The pattern has fs.Glob syntax such as "templates/*.qtpl". Files referred
+// by cat and include tags are read from fsys too, so templates embedded
+// via embed.FS may be compiled at go generate time.
+//
+// The code generated for the template at fsys path "dir/foo.qtpl" is written
+// to "dir/foo.qtpl.go" inside opts.OutputDir. The default package name
+// is the name of the directory the generated file is written to.
+// Benchmarks for opts.GenBenchmarks and manifests for opts.GenManifest
+// are written near the generated files.
+//
+// All the matching templates are compiled even if some of them are broken.
+// The returned error contains errors for all the broken templates.
+func ParseFS(fsys fs.FS, pattern string, opts ParseOptions) error {
+	names, err := fs.Glob(fsys, pattern)
+	if err != nil {
+		return fmt.Errorf("invalid pattern %q: %s", pattern, err)
+	}
+	if len(names) == 0 {
+		return fmt.Errorf("no templates match pattern %q", pattern)
+	}
+	opts.fsys = fsys
+	var errs []string
+	for _, name := range names {
+		if err := compileFS(fsys, name, opts); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return fmt.Errorf("cannot compile %d out of %d template files:\n%s",
+		len(errs), len(names), strings.Join(errs, "\n"))
+}
+
+func compileFS(fsys fs.FS, name string, opts ParseOptions) error {
+	src, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return fmt.Errorf("cannot read file %q: %s", name, err)
+	}
+	outfile := filepath.Join(opts.OutputDir, filepath.FromSlash(OutputPath(name)))
+	packageName, err := PackageName(outfile)
+	if err != nil {
+		return fmt.Errorf("cannot determine package name for %q: %s", name, err)
+	}
+	var benchmarks bytes.Buffer
+	if opts.GenBenchmarks {
+		opts.Benchmarks = &benchmarks
+	}
+	var manifest bytes.Buffer
+	if opts.GenManifest {
+		opts.Manifest = &manifest
+	}
+	var uglyCode bytes.Buffer
+	if err = Parse(&uglyCode, bytes.NewReader(src), name, packageName, &opts); err != nil {
+		// The error is already prefixed with file:line:col.
+		return err
+	}
+	code, err := format.Source(uglyCode.Bytes())
+	if err != nil {
+		return fmt.Errorf("error when formatting compiled code for %q: %s", name, err)
+	}
+	if err = os.MkdirAll(filepath.Dir(outfile), 0777); err != nil {
+		return fmt.Errorf("cannot create directory for %q: %s", outfile, err)
+	}
+	if err = ioutil.WriteFile(outfile, code, 0666); err != nil {
+		return fmt.Errorf("error when writing file %q: %s", outfile, err)
+	}
+	if opts.GenBenchmarks {
+		benchfile := filepath.Join(opts.OutputDir, filepath.FromSlash(name)) + "_timing_test.go"
+		if err = ioutil.WriteFile(benchfile, benchmarks.Bytes(), 0666); err != nil {
+			return fmt.Errorf("error when writing file %q: %s", benchfile, err)
+		}
+	}
+	if opts.GenManifest {
+		manifestfile := filepath.Join(opts.OutputDir, filepath.FromSlash(name)) + ".manifest.json"
+		if err = ioutil.WriteFile(manifestfile, manifest.Bytes(), 0666); err != nil {
+			return fmt.Errorf("error when writing file %q: %s", manifestfile, err)
+		}
+	}
+	return nil
+}
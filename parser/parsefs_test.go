@@ -0,0 +1,108 @@
+package parser
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestParseFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"templates/a.qtpl": &fstest.MapFile{
+			Data: []byte(`{% func A(name string) %}Hello, {%s name %}!{% include "partials/footer.qtpl" %}{% endfunc %}`),
+		},
+		"templates/b.qtpl": &fstest.MapFile{
+			Data: []byte(`{% func B() %}<b>{%= A("b") %}</b>{% endfunc %}`),
+		},
+		"templates/partials/footer.qtpl": &fstest.MapFile{
+			Data: []byte(`<footer>{% cat "/static/note.txt" %}</footer>`),
+		},
+		"static/note.txt": &fstest.MapFile{
+			Data: []byte("embedded note"),
+		},
+	}
+	dir := t.TempDir()
+	if err := ParseFS(fsys, "templates/*.qtpl", ParseOptions{OutputDir: dir}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// templates are compiled to the package named after their directory
+	codeA := readGeneratedFile(t, filepath.Join(dir, "templates", "a.qtpl.go"))
+	for _, s := range []string{
+		"package templates\n",
+		"//line templates/a.qtpl:1\n",
+		"func StreamA(qw422016 *qt422016.Writer, name string) {\n",
+		"//line templates/partials/footer.qtpl:1\n",
+		"qw422016.N().S(`embedded note`)\n",
+	} {
+		if !strings.Contains(codeA, s) {
+			t.Fatalf("cannot find %q in the generated code:\n%s", s, codeA)
+		}
+	}
+	codeB := readGeneratedFile(t, filepath.Join(dir, "templates", "b.qtpl.go"))
+	if !strings.Contains(codeB, "StreamA(qw422016, \"b\")\n") {
+		t.Fatalf("cannot find StreamA call in the generated code:\n%s", codeB)
+	}
+
+	// included files aren't compiled unless they match the pattern
+	if _, err := os.Stat(filepath.Join(dir, "templates", "partials", "footer.qtpl.go")); !os.IsNotExist(err) {
+		t.Fatalf("unexpected compiled partial; err=%v", err)
+	}
+
+	// templates at the filesystem root get the output directory name as the package name
+	fsys = fstest.MapFS{
+		"root.qtpl": &fstest.MapFile{Data: []byte(`{% func Root() %}root{% endfunc %}`)},
+	}
+	outDir := filepath.Join(dir, "views")
+	if err := ParseFS(fsys, "*.qtpl", ParseOptions{OutputDir: outDir}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	code := readGeneratedFile(t, filepath.Join(outDir, "root.qtpl.go"))
+	if !strings.Contains(code, "package views\n") {
+		t.Fatalf("unexpected package name in the generated code:\n%s", code)
+	}
+}
+
+func TestParseFSFailure(t *testing.T) {
+	fsys := fstest.MapFS{
+		"templates/ok.qtpl":      &fstest.MapFile{Data: []byte(`{% func OK() %}ok{% endfunc %}`)},
+		"templates/broken.qtpl":  &fstest.MapFile{Data: []byte(`{% func Broken() %}`)},
+		"templates/outside.qtpl": &fstest.MapFile{Data: []byte(`{% func Outside() %}{% include "../../x.qtpl" %}{% endfunc %}`)},
+	}
+	dir := t.TempDir()
+	err := ParseFS(fsys, "templates/*.qtpl", ParseOptions{OutputDir: dir})
+	if err == nil {
+		t.Fatalf("expecting error")
+	}
+	for _, s := range []string{
+		"cannot compile 2 out of 3 template files",
+		"templates/broken.qtpl:",
+		"refers to the file outside the filesystem",
+	} {
+		if !strings.Contains(err.Error(), s) {
+			t.Fatalf("cannot find %q in the error: %s", s, err)
+		}
+	}
+
+	// valid templates are compiled regardless of broken templates
+	readGeneratedFile(t, filepath.Join(dir, "templates", "ok.qtpl.go"))
+
+	if err := ParseFS(fsys, "*.qtpl", ParseOptions{OutputDir: dir}); err == nil || !strings.Contains(err.Error(), "no templates match pattern") {
+		t.Fatalf("unexpected error for the pattern without matches: %v", err)
+	}
+	if err := ParseFS(fsys, "[", ParseOptions{OutputDir: dir}); err == nil || !strings.Contains(err.Error(), "invalid pattern") {
+		t.Fatalf("unexpected error for invalid pattern: %v", err)
+	}
+}
+
+func readGeneratedFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("cannot read the generated file: %s", err)
+	}
+	return string(data)
+}
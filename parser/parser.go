@@ -0,0 +1,4529 @@
+package parser
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/build/constraint"
+	"go/format"
+	goparser "go/parser"
+	goscanner "go/scanner"
+	gotoken "go/token"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"log/slog"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+type parser struct {
+	s               *scanner
+	w               io.Writer
+	packageName     string
+	prefix          string
+	forDepth        int
+	switchDepth     int
+	skipOutputDepth int
+
+	importsUseEmitted  bool
+	packageNameEmitted bool
+	buildEmitted       bool
+
+	// funcDoc is the doc comment for the func being parsed.
+	funcDoc []byte
+
+	// scopes contains variables declared via assign tag
+	// in the enclosing Go scopes.
+	scopes []map[string]bool
+
+	// funcNames contains names of the generated funcs.
+	funcNames map[string]generatedName
+
+	// appendFuncs is set if append funcs must be generated.
+	appendFuncs bool
+
+	// errFuncs is set if error-returning write funcs must be generated.
+	errFuncs bool
+
+	// packageCode contains package-level code found inside the current func.
+	packageCode bytes.Buffer
+
+	// escapeMode is the escape mode of the func being parsed.
+	// See funcType.escapeMode for details.
+	escapeMode string
+
+	// ctxFuncs contains names of the funcs defined with ctx modifier
+	// in the template file. Calls to these funcs from {%= %} tags
+	// inside ctx funcs are passed the ctx arg automatically.
+	ctxFuncs map[string]bool
+
+	// importsW is the writer for the imports of the generated code.
+	// The code following the imports is written to body until
+	// the template is parsed, so only the used imports are emitted.
+	// See emitImports for details.
+	importsW    io.Writer
+	importsLine []byte
+	body        bytes.Buffer
+
+	// ctxFunc is set when parsing ctx func or the func nested inside it.
+	ctxFunc bool
+
+	// errResultFuncs contains names of the funcs defined with err modifier
+	// in the template file. Errors returned by these funcs called from
+	// {%= %} tags are returned from the calling func.
+	errResultFuncs map[string]bool
+
+	// errResultFunc is set when parsing func with err modifier.
+	// Closures nested inside such funcs don't return errors.
+	errResultFunc bool
+
+	// funcReturned is set if the return tag is found at the top level
+	// of the func being parsed, so the func needs no trailing return.
+	funcReturned bool
+
+	// inlineFuncs contains the funcs defined with inline modifier
+	// in the template file so far. {%= %} calls to these funcs
+	// are expanded into the func body.
+	inlineFuncs map[string]*inlineFunc
+
+	// inlineFunc is set when parsing func with inline modifier.
+	inlineFunc bool
+
+	// cdataDepth is the number of the enclosing cdata blocks.
+	cdataDepth int
+
+	// spacelessDepth is the number of the enclosing spaceless blocks.
+	spacelessDepth int
+
+	// spacelessLast is the last non-whitespace char of the text emitted
+	// inside spaceless block. It is reset by tags writing output.
+	spacelessLast byte
+
+	// spacelessSpace is the whitespace after '>' at the end of the text
+	// emitted inside spaceless block. It is written before the next
+	// output tag or text unless the text starts with '<'.
+	// It is dropped if the next tag emits code without output, i.e. if or for.
+	spacelessSpace []byte
+
+	// loops contains labels for the enclosing for loops.
+	// The innermost loop is the last one.
+	loops []*loopLabel
+
+	// loopsCount is the number of for loops seen so far.
+	// It is used for generating unique loop labels.
+	loopsCount int
+
+	// packageIdents contains package-level identifiers declared
+	// in the template code.
+	packageIdents map[string]bool
+
+	// idents contains identifiers declared in the template code
+	// in the enclosing Go scopes, i.e. func args, for loop variables
+	// and variables declared in code tags. It is in sync with scopes.
+	// The value is true for func args with channel types.
+	idents []map[string]bool
+
+	// includes contains absolute paths for the files being included.
+	// The first item is the template file.
+	includes []string
+
+	// banner is the custom comment at the top of the generated files.
+	banner string
+
+	// genBenchmarks is set if benchmarks must be generated for funcs.
+	genBenchmarks bool
+
+	// benchmarkFuncs contains top-level funcs for benchmark generation.
+	benchmarkFuncs []*benchmarkFunc
+
+	// genManifest is set if the manifest must be generated.
+	genManifest bool
+
+	// manifestFuncs contains top-level funcs for the manifest.
+	manifestFuncs []manifestFunc
+
+	// writerVar is the name of the template writer in the generated code.
+	writerVar string
+
+	// writerArg is the name of io.Writer arg in the generated write funcs.
+	writerArg string
+
+	// preserveComments is set if template comments must be emitted
+	// as Go comments.
+	preserveComments bool
+
+	// logger is used for logging parse progress if set.
+	logger *slog.Logger
+
+	// fsys is the filesystem files referred by cat and include tags
+	// are read from. Files are read from the OS filesystem if fsys is nil.
+	fsys fs.FS
+}
+
+// ParseOptions contains optional settings for the template parser.
+type ParseOptions struct {
+	// TagOpen and TagClose are the delimiters for template tags.
+	// Each delimiter must contain exactly two bytes, i.e. "<%" and "%>".
+	// Default {% and %} delimiters are used if both are empty.
+	TagOpen  string
+	TagClose string
+
+	// MustacheMode enables {{ expr }} and {{{ expr }}} shorthands for
+	// output tags alongside the ordinary tags. This eases migrating
+	// templates from text/template and Handlebars.
+	//
+	// {{ expr }} is equivalent to {%v expr %}, while {{{ expr }}}
+	// is equivalent to {%v= expr %}, i.e. it writes expr without escaping.
+	MustacheMode bool
+
+	// MustacheTag is the output tag used for {{ expr }} in MustacheMode.
+	// For instance, "s" makes {{ expr }} equivalent to {%s expr %}
+	// and {{{ expr }}} equivalent to {%s= expr %}. By default "v" is used.
+	MustacheTag string
+
+	// Banner is the comment at the top of the generated files.
+	// Each line of the banner must start with //.
+	//
+	// The default banner is `// Code generated by qtc from "file.qtpl". DO NOT EDIT.`
+	// Go tools treat the file as generated only if it contains a line
+	// matching `^// Code generated .* DO NOT EDIT\.$` regexp.
+	Banner string
+
+	// AppendFuncs enables generating AppendF(dst []byte, ...) []byte
+	// for each {% func F(...) %} in addition to StreamF, WriteF and F.
+	// AppendF appends the template output to dst without allocations
+	// if dst has enough capacity.
+	AppendFuncs bool
+
+	// ErrFuncs enables generating WriteFErr(w io.Writer, ...) error
+	// for each {% func F(...) %} in addition to StreamF, WriteF and F.
+	// WriteFErr returns the first error returned by w, so the caller
+	// may detect broken connections. Writes to w are skipped after the error.
+	ErrFuncs bool
+
+	// GenBenchmarks enables generating BenchmarkF(b *testing.B) for each
+	// {% func F(...) %}, which calls StreamF with zero-value args in a loop.
+	// Funcs with args of types other than builtin types, slices, arrays
+	// and maps of builtin types are skipped.
+	//
+	// The benchmarks' code is written to Benchmarks, which usually
+	// is a _test.go file.
+	GenBenchmarks bool
+	Benchmarks    io.Writer
+
+	// GenManifest enables writing JSON manifest for the template file
+	// to Manifest, which usually is a .manifest.json file.
+	// The manifest lists each top-level func with its name, params
+	// (name and type), whether it is exported and the generated funcs,
+	// so tools may wire templates into routers or document them.
+	GenManifest bool
+	Manifest    io.Writer
+
+	// WriterVarName is the name of the template writer variable
+	// in the generated code. It is passed as the first arg to StreamF.
+	// By default "qw422016" is used.
+	//
+	// Output tags write to the variable, so func args and variables
+	// in the template mustn't have the same name.
+	WriterVarName string
+
+	// StreamWriterArgName is the name of io.Writer arg in the generated
+	// WriteF funcs. By default "qq422016" is used.
+	StreamWriterArgName string
+
+	// PreserveComments enables emitting {%# ... %} and {% comment %}
+	// contents as Go comments at the corresponding position
+	// in the generated code. Template comments are dropped by default.
+	PreserveComments bool
+
+	// Logger enables logging parse progress at debug level.
+	// Entering and exiting the template, func, for and if tags
+	// is logged with the tag name and the file:line:col position,
+	// so it is possible to locate the tag a parse error is triggered by.
+	// Funcs skipped by GenBenchmarks are logged at info level.
+	// Nothing is logged if Logger is nil.
+	Logger *slog.Logger
+
+	// OutputDir is the directory ParseFS writes the generated code to.
+	// The current directory is used if OutputDir is empty.
+	OutputDir string
+
+	// fsys is set by ParseFS. See parser.fsys for details.
+	fsys fs.FS
+}
+
+func (opts *ParseOptions) writerNames() (string, string, error) {
+	writerVar := "qw" + mangleSuffix
+	writerArg := "qq" + mangleSuffix
+	if opts == nil {
+		return writerVar, writerArg, nil
+	}
+	if len(opts.WriterVarName) > 0 {
+		writerVar = opts.WriterVarName
+	}
+	if len(opts.StreamWriterArgName) > 0 {
+		writerArg = opts.StreamWriterArgName
+	}
+	for _, name := range []string{writerVar, writerArg} {
+		if !gotoken.IsIdentifier(name) || name == "_" {
+			return "", "", fmt.Errorf("invalid writer name %q: it must be a valid Go identifier", name)
+		}
+	}
+	if writerVar == writerArg {
+		return "", "", fmt.Errorf("WriterVarName and StreamWriterArgName must differ; got %q", writerVar)
+	}
+	return writerVar, writerArg, nil
+}
+
+func (opts *ParseOptions) delims() ([]byte, []byte, error) {
+	if opts == nil || (len(opts.TagOpen) == 0 && len(opts.TagClose) == 0) {
+		return defaultTagOpen, defaultTagClose, nil
+	}
+	tagOpen := []byte(opts.TagOpen)
+	tagClose := []byte(opts.TagClose)
+	if err := validateDelims(tagOpen, tagClose); err != nil {
+		return nil, nil, err
+	}
+	return tagOpen, tagClose, nil
+}
+
+func (opts *ParseOptions) mustacheTag() (string, error) {
+	if opts == nil || !opts.MustacheMode {
+		return "", nil
+	}
+	tagOpen, _, err := opts.delims()
+	if err != nil {
+		return "", err
+	}
+	if tagOpen[0] == '{' && tagOpen[1] == '{' {
+		return "", fmt.Errorf("MustacheMode cannot be used with %q tag delimiters", tagOpen)
+	}
+	if len(opts.MustacheTag) == 0 {
+		return "v", nil
+	}
+	if !isOutputTagName(opts.MustacheTag) || strings.HasSuffix(opts.MustacheTag, "=") {
+		return "", fmt.Errorf("invalid MustacheTag %q: it must be the name of output tag without '=', i.e. \"s\" or \"v\"", opts.MustacheTag)
+	}
+	return opts.MustacheTag, nil
+}
+
+// Validate returns an error if opts cannot be used for compiling templates.
+func (opts *ParseOptions) Validate() error {
+	if _, _, err := opts.delims(); err != nil {
+		return err
+	}
+	if _, _, err := opts.writerNames(); err != nil {
+		return err
+	}
+	if _, err := opts.mustacheTag(); err != nil {
+		return err
+	}
+	if opts != nil && len(opts.Banner) > 0 {
+		if err := validateBanner(opts.Banner); err != nil {
+			return fmt.Errorf("invalid banner: %s", err)
+		}
+	}
+	return nil
+}
+
+func parse(w io.Writer, r io.Reader, filePath, packageName string) error {
+	return Parse(w, r, filePath, packageName, nil)
+}
+
+// Parse compiles the template from r into Go code and writes it to w.
+//
+// The written code isn't formatted, so it may be inspected even if it
+// contains errors. Use go/format for formatting it.
+// The packageName is used unless the template contains package tag.
+// See PackageName for obtaining the default package name for filePath.
+func Parse(w io.Writer, r io.Reader, filePath, packageName string, opts *ParseOptions) error {
+	tagOpen, tagClose, err := opts.delims()
+	if err != nil {
+		return err
+	}
+	writerVar, writerArg, err := opts.writerNames()
+	if err != nil {
+		return err
+	}
+	mustacheTag, err := opts.mustacheTag()
+	if err != nil {
+		return err
+	}
+	src, err := ioutil.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("cannot read %q: %w", filePath, err)
+	}
+	ctxFuncs, errResultFuncs := collectModifierFuncs(src, filePath, tagOpen, tagClose)
+	p := &parser{
+		s:              newScannerDelims(bytes.NewReader(src), filePath, tagOpen, tagClose),
+		w:              w,
+		packageName:    packageName,
+		writerVar:      writerVar,
+		writerArg:      writerArg,
+		ctxFuncs:       ctxFuncs,
+		errResultFuncs: errResultFuncs,
+	}
+	p.s.mustacheTag = mustacheTag
+	if opts != nil {
+		if len(opts.Banner) > 0 {
+			if err := validateBanner(opts.Banner); err != nil {
+				return fmt.Errorf("invalid banner: %s", err)
+			}
+			p.banner = opts.Banner
+		}
+		p.appendFuncs = opts.AppendFuncs
+		p.errFuncs = opts.ErrFuncs
+		p.genBenchmarks = opts.GenBenchmarks
+		if p.genBenchmarks && opts.Benchmarks == nil {
+			return fmt.Errorf("missing Benchmarks writer for GenBenchmarks option")
+		}
+		p.genManifest = opts.GenManifest
+		if p.genManifest && opts.Manifest == nil {
+			return fmt.Errorf("missing Manifest writer for GenManifest option")
+		}
+		if opts.PreserveComments {
+			p.preserveComments = true
+			p.s.onComment = p.emitTemplateComment
+		}
+		p.logger = opts.Logger
+		p.fsys = opts.fsys
+	}
+	if err := p.parseTemplate(); err != nil {
+		return newParseError(p.s, err)
+	}
+	if p.genBenchmarks {
+		if err := p.emitBenchmarks(opts.Benchmarks); err != nil {
+			return err
+		}
+	}
+	if p.genManifest {
+		return p.emitManifest(opts.Manifest)
+	}
+	return nil
+}
+
+// collectModifierFuncs returns names of the funcs defined with ctx and err
+// modifiers in the template src, so calls to them may be found before
+// the funcs are defined.
+//
+// Parse errors are ignored, since they are reported when the template
+// is parsed.
+func collectModifierFuncs(src []byte, filePath string, tagOpen, tagClose []byte) (ctxFuncs, errResultFuncs map[string]bool) {
+	s := newScannerDelims(bytes.NewReader(src), filePath, tagOpen, tagClose)
+	for s.Next() {
+		t := s.Token()
+		if t.ID != tagName {
+			continue
+		}
+		tagNameStr := string(t.Value)
+		if !s.Next() {
+			break
+		}
+		t = s.Token()
+		if t.ID != tagContents {
+			continue
+		}
+		if tagNameStr == "code" && len(t.Value) == 0 {
+			// Code blocks aren't tokenized, so skip them as the parser does.
+			s.readCodeBlock()
+			continue
+		}
+		if tagNameStr == "code" && isPackageCodeTag(t.Value) {
+			if !s.readRawBlock("endcode") {
+				break
+			}
+			continue
+		}
+		if tagNameStr != "func" && tagNameStr != "macro" {
+			continue
+		}
+		f, err := parseFuncDef(t.Value)
+		if err != nil {
+			continue
+		}
+		if len(f.defPrefix) > 0 {
+			// The receiver type is unknown at method call sites.
+			continue
+		}
+		if f.ctx {
+			if ctxFuncs == nil {
+				ctxFuncs = make(map[string]bool)
+			}
+			ctxFuncs[f.name] = true
+		}
+		if f.errResult {
+			if errResultFuncs == nil {
+				errResultFuncs = make(map[string]bool)
+			}
+			errResultFuncs[f.name] = true
+		}
+	}
+	return ctxFuncs, errResultFuncs
+}
+
+// CompileString compiles the template src into Go code.
+//
+// The filePath is used in the generated code comments and for determining
+// the default package name. The file at filePath isn't accessed.
+// Files referred by cat and include tags are read relative to filePath.
+func CompileString(src, filePath string) (string, error) {
+	return CompileStringWithOptions(src, filePath, nil)
+}
+
+// CompileStringWithOptions compiles the template src into Go code
+// using the given opts.
+//
+// See CompileString for details.
+func CompileStringWithOptions(src, filePath string, opts *ParseOptions) (string, error) {
+	packageName, err := PackageName(filePath)
+	if err != nil {
+		return "", fmt.Errorf("cannot determine package name for %q: %s", filePath, err)
+	}
+	var bb bytes.Buffer
+	if err = Parse(&bb, strings.NewReader(src), filePath, packageName, opts); err != nil {
+		return "", err
+	}
+	code, err := format.Source(bb.Bytes())
+	if err != nil {
+		return "", fmt.Errorf("error when formatting compiled code for %q: %s", filePath, err)
+	}
+	return string(code), nil
+}
+
+func (p *parser) parseTemplate() (err error) {
+	defer p.traceTag("template")(&err)
+	s := p.s
+	p.emitBanner(p.w)
+	for s.Next() {
+		t := s.Token()
+		switch t.ID {
+		case text:
+			p.parseTemplateText(t.Value)
+		case tagName:
+			switch string(t.Value) {
+			case "build":
+				if p.packageNameEmitted || p.buildEmitted {
+					return errorf(KindMisplacedTag, "build constraint must be at the top of the template before package name. Found at %s", s.Context())
+				}
+				if err := p.parseBuild(); err != nil {
+					return err
+				}
+			case "package":
+				if p.packageNameEmitted {
+					return errorf(KindMisplacedTag, "package name must be at the top of the template. Found at %s", s.Context())
+				}
+				if err := p.parsePackageName(); err != nil {
+					return err
+				}
+			case "import":
+				p.emitPackageName()
+				if p.importsUseEmitted {
+					return errorf(KindMisplacedTag, "imports must be at the top of the template. Found at %s", s.Context())
+				}
+				if err := p.parseImport(); err != nil {
+					return err
+				}
+			default:
+				p.emitPackageName()
+				p.emitImportsUse()
+				switch string(t.Value) {
+				case "interface", "iface":
+					if err := p.parseInterface(); err != nil {
+						return err
+					}
+				case "code":
+					if err := p.parseTemplateCode(); err != nil {
+						return err
+					}
+				case "const":
+					if err := p.parseConst(); err != nil {
+						return err
+					}
+				case "func", "macro":
+					if err := p.parseFunc(string(t.Value)); err != nil {
+						return err
+					}
+				case "defer":
+					return errorf(KindMisplacedTag, "found defer tag outside func at %s", s.Context())
+				default:
+					return errorf(KindUnexpectedToken, "unexpected tag found outside func: %q at %s", t.Value, s.Context())
+				}
+			}
+		default:
+			return errorf(KindUnexpectedToken, "unexpected token found %s outside func at %s", t, s.Context())
+		}
+	}
+	// The template may contain only text or nothing at all.
+	p.emitPackageName()
+	p.emitImportsUse()
+	if err := s.LastError(); err != nil {
+		return fmt.Errorf("cannot parse template: %w", err)
+	}
+	return p.emitImports()
+}
+
+// emitBanner writes the comment marking the generated file to w.
+//
+// The default banner matches the `^// Code generated .* DO NOT EDIT\.$`
+// regexp, so Go tools recognize the file as generated.
+func (p *parser) emitBanner(w io.Writer) {
+	if len(p.banner) > 0 {
+		fmt.Fprintf(w, "%s\n\n", p.banner)
+		return
+	}
+	fmt.Fprintf(w, `// Code generated by qtc from %q. DO NOT EDIT.
+// See https://github.com/valyala/quicktemplate for details.
+
+`,
+		filepath.Base(p.s.filePath))
+}
+
+// validateBanner verifies whether all the banner lines are Go comments.
+func validateBanner(banner string) error {
+	for _, line := range strings.Split(banner, "\n") {
+		if !strings.HasPrefix(line, "//") {
+			return fmt.Errorf("each banner line must start with //; got %q", line)
+		}
+	}
+	return nil
+}
+
+func (p *parser) emitPackageName() {
+	if !p.packageNameEmitted {
+		p.Printf("package %s\n", p.packageName)
+		p.packageNameEmitted = true
+	}
+}
+
+// traceTag logs entering the tag at the current position if the logger is set.
+//
+// The returned func logs exiting the tag together with the parse error
+// if any. It must be called when the tag is parsed.
+func (p *parser) traceTag(tag string) func(err *error) {
+	if p.logger == nil {
+		return func(err *error) {}
+	}
+	p.logger.Debug("enter", "tag", tag, "pos", p.tracePos())
+	return func(err *error) {
+		if *err != nil {
+			p.logger.Debug("exit", "tag", tag, "pos", p.tracePos(), "err", *err)
+			return
+		}
+		p.logger.Debug("exit", "tag", tag, "pos", p.tracePos())
+	}
+}
+
+// tracePos returns file:line:col of the current token.
+func (p *parser) tracePos() string {
+	t := p.s.Token()
+	return fmt.Sprintf("%s:%d:%d", p.s.filePath, t.line+1, t.pos)
+}
+
+// parseTemplateText emits the text outside funcs as a comment.
+//
+// The last paragraph of the text immediately preceding a func
+// becomes the doc comment for the generated funcs.
+func (p *parser) parseTemplateText(text []byte) {
+	s := p.s
+	text = append([]byte(nil), text...)
+	if !s.Next() {
+		p.emitComment(text)
+		return
+	}
+	t := s.Token()
+	isFunc := t.ID == tagName && (string(t.Value) == "func" || string(t.Value) == "macro")
+	s.Rewind()
+	if !isFunc {
+		p.emitComment(text)
+		return
+	}
+	comment, doc := splitDocComment(text)
+	if len(comment) > 0 {
+		p.emitComment(comment)
+	}
+	p.funcDoc = doc
+}
+
+// splitDocComment splits the text preceding a func into a comment
+// and a doc comment.
+//
+// The doc comment is the last paragraph of the text, which isn't
+// separated from the func by empty lines.
+func splitDocComment(text []byte) ([]byte, []byte) {
+	lines := bytes.Split(text, []byte("\n"))
+	n := len(lines) - 1
+	if len(stripLeadingSpace(lines[n])) == 0 {
+		// The func tag starts at the new line.
+		n--
+	}
+	end := n + 1
+	for n >= 0 && len(stripLeadingSpace(lines[n])) > 0 {
+		n--
+	}
+	if end == n+1 {
+		return text, nil
+	}
+	comment := bytes.Join(lines[:n+1], []byte("\n"))
+	doc := bytes.Join(lines[n+1:end], []byte("\n"))
+	return comment, doc
+}
+
+// emitFuncDoc emits doc comment for the generated func.
+func (p *parser) emitFuncDoc() {
+	if len(p.funcDoc) > 0 {
+		p.writeComment(p.funcDoc)
+	}
+}
+
+// emitTemplateComment emits the contents of the template comment tag
+// as Go comment at the current position in the generated code.
+func (p *parser) emitTemplateComment(comment []byte) {
+	if p.skipOutputDepth > 0 {
+		return
+	}
+	comment = bytes.TrimSpace(comment)
+	if len(comment) == 0 {
+		return
+	}
+	for _, line := range bytes.Split(comment, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			fmt.Fprintf(p.w, "%s//\n", p.prefix)
+		} else {
+			fmt.Fprintf(p.w, "%s// %s\n", p.prefix, line)
+		}
+	}
+}
+
+func (p *parser) emitComment(comment []byte) {
+	p.writeComment(comment)
+	fmt.Fprintf(p.w, "\n")
+}
+
+func (p *parser) writeComment(comment []byte) {
+	isFirstNonemptyLine := false
+	for len(comment) > 0 {
+		n := bytes.IndexByte(comment, '\n')
+		if n < 0 {
+			n = len(comment)
+		}
+		line := stripTrailingSpace(comment[:n])
+		if bytes.HasPrefix(line, []byte("//")) {
+			line = line[2:]
+			if len(line) > 0 && isSpace(line[0]) {
+				line = line[1:]
+			}
+		}
+		if len(line) == 0 {
+			if isFirstNonemptyLine {
+				fmt.Fprintf(p.w, "//\n")
+			}
+		} else {
+			fmt.Fprintf(p.w, "// %s\n", line)
+			isFirstNonemptyLine = true
+		}
+
+		if n < len(comment) {
+			comment = comment[n+1:]
+		} else {
+			comment = comment[n:]
+		}
+	}
+}
+
+// emitImportsUse starts writing the code following the imports.
+//
+// The code is written to p.body, since the imports needed by the code
+// are known only after the whole template is parsed.
+// See emitImports for details.
+func (p *parser) emitImportsUse() {
+	if p.importsUseEmitted {
+		return
+	}
+	var bb bytes.Buffer
+	p.s.WriteLineComment(&bb)
+	p.importsLine = bb.Bytes()
+	p.importsW = p.w
+	p.w = &p.body
+	p.importsUseEmitted = true
+}
+
+// runtimeImports contains the packages, which may be referred
+// by the generated code via the given mangled names.
+var runtimeImports = []struct {
+	name string
+	path string
+}{
+	{"qtctx", "context"},
+	{"qtio", "io"},
+	{"qt", "github.com/valyala/quicktemplate"},
+}
+
+// emitImports writes the imports referred by the generated code
+// followed by the code itself.
+//
+// For example, io package is imported only if write funcs are generated,
+// while context package is imported only if ctx funcs are generated.
+func (p *parser) emitImports() error {
+	code := p.body.Bytes()
+	w := p.importsW
+	// Standard packages are grouped before the quicktemplate package.
+	var std, other []string
+	for _, ri := range runtimeImports {
+		name := ri.name + mangleSuffix
+		if !bytes.Contains(code, []byte(name+".")) {
+			continue
+		}
+		imp := fmt.Sprintf("%s %q", name, ri.path)
+		if strings.Contains(ri.path, ".") {
+			other = append(other, imp)
+		} else {
+			std = append(std, imp)
+		}
+	}
+	if len(std)+len(other) > 0 {
+		imports := strings.Join(std, "\n\t")
+		if len(std) > 0 && len(other) > 0 {
+			imports += "\n\n\t"
+		}
+		imports += strings.Join(other, "\n\t")
+		w.Write(p.importsLine)
+		fmt.Fprintf(w, "import (\n\t%s\n)\n", imports)
+	}
+	_, err := w.Write(code)
+	return err
+}
+
+// parseFunc parses the top-level func or macro depending on tagNameStr.
+func (p *parser) parseFunc(tagNameStr string) (err error) {
+	defer p.traceTag(tagNameStr)(&err)
+	s := p.s
+	line := s.Token().line
+	t, err := expectTagContents(s)
+	if err != nil {
+		return err
+	}
+	funcStr := tagNameStr + " " + string(t.Value)
+	endTag := "end" + tagNameStr
+	f, err := p.parseFuncOrMacroDef(tagNameStr, t.Value)
+	if err != nil {
+		return errorf(KindInvalidFunc, "error in %q at %s: %w", funcStr, s.Context(), err)
+	}
+	if err = p.registerFuncNames(f); err != nil {
+		return errorf(KindInvalidFunc, "error in %q at %s: %w", funcStr, s.Context(), err)
+	}
+	if p.genBenchmarks && tagNameStr == "func" {
+		p.addBenchmarkFunc(f)
+	}
+	if p.genManifest {
+		p.addManifestFunc(f, line)
+	}
+	p.emitFuncStart(f)
+	p.declareIdents([]string{f.name})
+	p.pushScope()
+	p.declareIdents(f.declaredIdents())
+	p.declareChanIdents(f.chanArgs)
+	p.escapeMode = f.escapeMode
+	p.ctxFunc = f.ctx
+	p.errResultFunc = f.errResult
+	p.funcReturned = false
+	var inl *inlineFunc
+	if f.inline {
+		inl = p.startInlineFunc(f)
+	}
+	for s.Next() {
+		t := s.Token()
+		switch t.ID {
+		case text:
+			p.emitText(t.Value)
+		case tagName:
+			ok, err := p.tryParseCommonTags(t.Value)
+			if err != nil {
+				return fmt.Errorf("error in %q: %w", funcStr, err)
+			}
+			if ok {
+				continue
+			}
+			switch string(t.Value) {
+			case endTag:
+				if err = p.parseFuncEndName(f, endTag, line); err != nil {
+					return err
+				}
+				if inl != nil {
+					p.endInlineFunc(f, inl)
+				}
+				p.popScope()
+				p.emitFuncEnd(f)
+				p.escapeMode = ""
+				p.ctxFunc = false
+				p.errResultFunc = false
+				p.funcDoc = nil
+				p.w.Write(p.packageCode.Bytes())
+				p.packageCode.Reset()
+				return nil
+			default:
+				return p.unexpectedTagError(t.Value, endTag, line, funcStr)
+			}
+		default:
+			return errorf(KindUnexpectedToken, "unexpected token found when parsing %q: %s at %s", funcStr, t, s.Context())
+		}
+	}
+	if err := s.LastError(); err != nil {
+		return fmt.Errorf("cannot parse %q: %w", funcStr, err)
+	}
+	return errorf(KindUnclosedTag, "cannot find %s tag for %q at %s", endTag, funcStr, s.Context())
+}
+
+// parseFuncEndName parses the optional func name in endfunc and endmacro
+// tags such as {% endfunc F %} and verifies whether it matches the name
+// of f defined at the given line.
+func (p *parser) parseFuncEndName(f *funcType, endTag string, line int) error {
+	s := p.s
+	t, err := expectTagContents(s)
+	if err != nil {
+		return err
+	}
+	if len(t.Value) == 0 {
+		return nil
+	}
+	if name := string(t.Value); name != f.name {
+		return errorf(KindUnexpectedToken, "%s %s at %s doesn't match %s %s defined at %s:%d",
+			endTag, name, s.Context(), endTagBlocks[endTag], f.name, s.filePath, line+1)
+	}
+	return nil
+}
+
+// registerFuncNames verifies whether funcs generated for f don't collide
+// with the funcs generated for the previously defined templates.
+func (p *parser) registerFuncNames(f *funcType) error {
+	if p.funcNames == nil {
+		p.funcNames = make(map[string]generatedName)
+	}
+	line := p.s.t.line + 1
+	names := f.generatedNames(p.appendFuncs, p.errFuncs)
+	for _, n := range names {
+		prev, ok := p.funcNames[n.name]
+		if !ok {
+			continue
+		}
+		if prev.desc == n.desc {
+			return errorf(KindInvalidFunc, "duplicate %s at line %d: it is already defined at line %d", n.desc, line, prev.line)
+		}
+		return errorf(KindInvalidFunc, "%s collides with %s defined at line %d", n.desc, prev.desc, prev.line)
+	}
+	for _, n := range names {
+		n.line = line
+		p.funcNames[n.name] = n
+	}
+	return nil
+}
+
+// endTagBlocks maps end tags to the descriptions of the blocks they close.
+var endTagBlocks = map[string]string{
+	"endfunc":      "func",
+	"endmacro":     "macro",
+	"endfor":       "for loop",
+	"endif":        "if statement",
+	"endunless":    "unless statement",
+	"endswitch":    "switch statement",
+	"endwith":      "with block",
+	"endcdata":     "cdata block",
+	"endspaceless": "spaceless block",
+}
+
+// unexpectedTagError returns the error for the unexpected tag found
+// in stmtStr block, which is opened at the given line and is closed
+// by endTag.
+//
+// The error mentions the expected end tag if the unexpected tag closes
+// another block, e.g. {% endif %} inside {% for %} loop.
+func (p *parser) unexpectedTagError(tag []byte, endTag string, line int, stmtStr string) error {
+	s := p.s
+	if _, ok := endTagBlocks[string(tag)]; ok {
+		return errorf(KindUnclosedTag, "expected %s to close %s opened at %s:%d, found %s at %s",
+			endTag, endTagBlocks[endTag], s.filePath, line+1, tag, s.Context())
+	}
+	return errorf(KindUnexpectedToken, "unexpected tag found in %q: %q at %s", stmtStr, tag, s.Context())
+}
+
+// parseFuncOrMacroDef parses the definition of the func or macro
+// depending on tagNameStr.
+//
+// Macros are lightweight file-local snippets, so only the unexported
+// stream func is generated for them.
+func (p *parser) parseFuncOrMacroDef(tagNameStr string, def []byte) (*funcType, error) {
+	f, err := parseFuncDef(def)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range f.declaredIdents() {
+		if err = p.validateIdent(name); err != nil {
+			return nil, errorf(KindInvalidCode, "invalid func args: %w", err)
+		}
+	}
+	if f.sizeHint > 0 && (f.streamOnly || tagNameStr == "macro") {
+		return nil, errorf(KindInvalidFunc, "hint(%d) cannot be used for %s %q, since the string func isn't generated for it", f.sizeHint, tagNameStr, f.name)
+	}
+	if tagNameStr != "macro" {
+		return f, nil
+	}
+	if len(f.defPrefix) > 0 {
+		return nil, errorf(KindInvalidFunc, "macro cannot be a method")
+	}
+	if f.writerTo {
+		return nil, errorf(KindInvalidFunc, "%q modifier cannot be used for macros", "writerto")
+	}
+	if isUpper(f.name[0]) {
+		return nil, errorf(KindInvalidFunc, "macro name %q must be unexported", f.name)
+	}
+	if err := f.setModifiers([]string{"stream"}); err != nil {
+		return nil, errorf(KindInvalidFunc, "redundant %q modifier: only the stream func is generated for macros", "stream")
+	}
+	return f, nil
+}
+
+// parseFuncClosure parses func or macro nested inside another func.
+//
+// The nested func is emitted as a pair of closures assigned to local
+// variables, so it may be called via {%= %} only from the enclosing func.
+// Only the stream closure is emitted for macros.
+func (p *parser) parseFuncClosure(tagNameStr string) error {
+	s := p.s
+	line := s.Token().line
+	t, err := expectTagContents(s)
+	if err != nil {
+		return err
+	}
+	funcStr := tagNameStr + " " + string(t.Value)
+	endTag := "end" + tagNameStr
+	f, err := p.parseFuncOrMacroDef(tagNameStr, t.Value)
+	if err != nil {
+		return errorf(KindInvalidFunc, "error in %q at %s: %w", funcStr, s.Context(), err)
+	}
+	if len(f.defPrefix) > 0 {
+		return errorf(KindInvalidFunc, "nested func %q cannot be a method at %s", funcStr, s.Context())
+	}
+	if len(f.defaults) > 0 {
+		return errorf(KindInvalidFunc, "nested func %q cannot have args with default values at %s", funcStr, s.Context())
+	}
+	if f.errResult {
+		return errorf(KindInvalidFunc, "nested func %q cannot have %q modifier at %s", funcStr, "err", s.Context())
+	}
+	if f.inline {
+		return errorf(KindInvalidFunc, "nested func %q cannot have %q modifier at %s", funcStr, "inline", s.Context())
+	}
+	if f.writerTo {
+		return errorf(KindInvalidFunc, "nested func %q cannot have %q modifier at %s", funcStr, "writerto", s.Context())
+	}
+	if f.sizeHint > 0 {
+		return errorf(KindInvalidFunc, "nested func %q cannot have hint(%d), since the string func isn't generated for it at %s", funcStr, f.sizeHint, s.Context())
+	}
+
+	// break and continue mustn't cross the closure boundary.
+	forDepth, switchDepth, loops, cdataDepth := p.forDepth, p.switchDepth, p.loops, p.cdataDepth
+	p.forDepth, p.switchDepth, p.loops, p.cdataDepth = 0, 0, nil, 0
+	prefix := p.prefix
+	escapeMode, ctxFunc, errResultFunc := p.escapeMode, p.ctxFunc, p.errResultFunc
+	p.errResultFunc = false
+	if len(f.escapeMode) > 0 {
+		p.escapeMode = f.escapeMode
+	}
+	if f.ctx {
+		p.ctxFunc = true
+	}
+
+	p.Printf("%s {", f.DefStreamClosure(p.writerVar))
+	p.prefix += "\t"
+	p.pushScope()
+	p.declareIdents(f.declaredIdents())
+	p.declareChanIdents(f.chanArgs)
+	for s.Next() {
+		t := s.Token()
+		switch t.ID {
+		case text:
+			p.emitText(t.Value)
+		case tagName:
+			ok, err := p.tryParseCommonTags(t.Value)
+			if err != nil {
+				return fmt.Errorf("error in %q: %w", funcStr, err)
+			}
+			if ok {
+				continue
+			}
+			switch string(t.Value) {
+			case endTag:
+				if err = p.parseFuncEndName(f, endTag, line); err != nil {
+					return err
+				}
+				p.popScope()
+				p.prefix = prefix
+				p.Printf("}")
+				p.emitFuncClosureWrite(f)
+				p.forDepth, p.switchDepth, p.loops, p.cdataDepth = forDepth, switchDepth, loops, cdataDepth
+				p.escapeMode, p.ctxFunc, p.errResultFunc = escapeMode, ctxFunc, errResultFunc
+				return nil
+			default:
+				return p.unexpectedTagError(t.Value, endTag, line, funcStr)
+			}
+		default:
+			return errorf(KindUnexpectedToken, "unexpected token found when parsing %q: %s at %s", funcStr, t, s.Context())
+		}
+	}
+	if err := s.LastError(); err != nil {
+		return fmt.Errorf("cannot parse %q: %w", funcStr, err)
+	}
+	return errorf(KindUnclosedTag, "cannot find %s tag for %q at %s", endTag, funcStr, s.Context())
+}
+
+func (p *parser) emitFuncClosureWrite(f *funcType) {
+	if f.streamOnly {
+		p.Printf("_ = %s%s", f.prefixStream(), f.name)
+		return
+	}
+	prefix := p.prefix
+	p.Printf("%s {", f.DefWriteClosure(p.writerArg))
+	p.prefix += "\t"
+	p.Printf("%s := qt%s.AcquireWriter(%s)", p.writerVar, mangleSuffix, p.writerArg)
+	p.Printf("%s", f.CallStream(p.writerVar))
+	p.Printf("qt%s.ReleaseWriter(%s)", mangleSuffix, p.writerVar)
+	p.prefix = prefix
+	p.Printf("}")
+
+	// Closures may be left unused by the enclosing func.
+	p.Printf("_ = %s%s", f.prefixStream(), f.name)
+	p.Printf("_ = %s%s", f.prefixWrite(), f.name)
+}
+
+func (p *parser) parseFor() (err error) {
+	defer p.traceTag("for")(&err)
+	s := p.s
+	line := s.Token().line
+	t, err := expectTagContents(s)
+	if err != nil {
+		return err
+	}
+	forStr := "for " + string(t.Value)
+	stmt, guard, err := splitForGuard(t.Value)
+	if err != nil {
+		return errorf(KindInvalidCode, "invalid statement %q at %s: %s", forStr, s.Context(), err)
+	}
+	stmt, isChan, err := expandForInChan(p.expandForInChanIdent(stmt))
+	if err == nil && !isChan {
+		stmt, err = expandForIn(stmt)
+	}
+	if err != nil {
+		return errorf(KindInvalidCode, "invalid statement %q at %s: %s", forStr, s.Context(), err)
+	}
+	if err = validateForStmt(stmt); err != nil {
+		return errorf(KindInvalidCode, "invalid statement %q at %s: %s", forStr, s.Context(), err)
+	}
+	// The statement may contain the mangled identifiers after the expansion,
+	// so only the writer is checked.
+	stmtIdents := forStmtIdents(stmt)
+	for _, name := range stmtIdents {
+		if err = p.validateWriterIdent(name); err != nil {
+			return errorf(KindInvalidCode, "invalid statement %q at %s: %s", forStr, s.Context(), err)
+		}
+	}
+
+	// The loop is written to a buffer, since its label may be emitted
+	// only after break or continue referring to it is found.
+	// Go doesn't allow unused labels.
+	w := p.w
+	var bb bytes.Buffer
+	p.w = &bb
+	p.loopsCount++
+	label := &loopLabel{
+		name:   fmt.Sprintf("qfor%s_%d", mangleSuffix, p.loopsCount),
+		sepVar: fmt.Sprintf("qsep%s_%d", mangleSuffix, p.loopsCount),
+	}
+	p.loops = append(p.loops, label)
+
+	// Range loops referring loop variable in the body are emitted
+	// with the loop state. See quicktemplate.Loop for details.
+	// Channel loops have no loop state, since their length is unknown.
+	var loopStart, loopHeader bytes.Buffer
+	if start, end, ok := rangeExprBounds(stmt); ok && !isChan {
+		rangeVar := fmt.Sprintf("qr%s_%d", mangleSuffix, p.loopsCount)
+		p.w = &loopStart
+		p.Printf("{")
+		p.Printf("%s := %s", rangeVar, stmt[start:end])
+		if isIntRangeExpr(stmt[start:end]) {
+			// Go 1.22 range over integer iterates the integer times.
+			p.Printf("loop := qt%s.NewLoop(int(%s))", mangleSuffix, rangeVar)
+		} else {
+			// Range over string iterates runes instead of bytes,
+			// so the loop length is determined at runtime.
+			p.Printf("loop := qt%s.NewRangeLoop(%s, len(%s))", mangleSuffix, rangeVar, rangeVar)
+		}
+		p.Printf("_ = loop")
+		p.w = &loopHeader
+		p.Printf("for %s%s%s {", stmt[:start], rangeVar, stmt[end:])
+		p.Printf("\tloop.Next()")
+		p.w = &bb
+	}
+
+	p.Printf("for %s {", stmt)
+	header := append([]byte(nil), bb.Bytes()...)
+	bb.Reset()
+	p.prefix += "\t"
+	if len(guard) > 0 {
+		p.Printf("if !(%s) {", guard)
+		p.Printf("\tcontinue")
+		p.Printf("}")
+	}
+	p.forDepth++
+	p.pushScope()
+	p.declareIdents(stmtIdents)
+	// The loop state isn't emitted if loop variable is declared
+	// in the template, since it would shadow the variable.
+	loopDeclared := p.isIdentDeclared("loop")
+	for s.Next() {
+		t := s.Token()
+		switch t.ID {
+		case text:
+			p.emitText(t.Value)
+		case tagName:
+			ok, err := p.tryParseCommonTags(t.Value)
+			if err != nil {
+				return fmt.Errorf("error in %q: %w", forStr, err)
+			}
+			if ok {
+				continue
+			}
+			switch string(t.Value) {
+			case "endfor":
+				if err = skipTagContents(s); err != nil {
+					return err
+				}
+				p.popScope()
+				p.forDepth--
+				if err := p.unindent(); err != nil {
+					return err
+				}
+				p.Printf("}")
+				p.loops = p.loops[:len(p.loops)-1]
+				p.w = w
+				useLoop := loopHeader.Len() > 0 && !loopDeclared && refersLoopVar(bb.Bytes())
+				if useLoop && len(guard) > 0 {
+					// Skipped iterations would be counted by the loop state,
+					// so loop.Index, loop.First and loop.Last would be wrong.
+					return errorf(KindInvalidCode, "loop state cannot be used in the guarded loop %q at %s", forStr, s.Context())
+				}
+				if useLoop {
+					w.Write(loopStart.Bytes())
+					header = loopHeader.Bytes()
+				}
+				if label.sepUsed {
+					p.Printf("%s := false", label.sepVar)
+				}
+				if label.used {
+					fmt.Fprintf(w, "%s%s:\n", p.prefix, label.name)
+				}
+				w.Write(header)
+				_, err = bb.WriteTo(w)
+				if useLoop {
+					p.Printf("}")
+				}
+				return err
+			default:
+				return p.unexpectedTagError(t.Value, "endfor", line, forStr)
+			}
+		default:
+			return errorf(KindUnexpectedToken, "unexpected token found when parsing %q: %s at %s", forStr, t, s.Context())
+		}
+	}
+	if err := s.LastError(); err != nil {
+		return fmt.Errorf("cannot parse %q: %w", forStr, err)
+	}
+	return errorf(KindUnclosedTag, "cannot find endfor tag for %q at %s", forStr, s.Context())
+}
+
+func (p *parser) parseDefault(typeSwitch bool) error {
+	s := p.s
+	if err := skipTagContents(s); err != nil {
+		return err
+	}
+	stmtStr := "default"
+	p.Printf("default:")
+	p.prefix += "\t"
+	p.pushScope()
+	for s.Next() {
+		t := s.Token()
+		switch t.ID {
+		case text:
+			p.emitText(t.Value)
+		case tagName:
+			if string(t.Value) == "fallthrough" {
+				if err := p.parseFallthrough(typeSwitch); err != nil {
+					return fmt.Errorf("error in %q: %w", stmtStr, err)
+				}
+				continue
+			}
+			ok, err := p.tryParseCommonTags(t.Value)
+			if err != nil {
+				return fmt.Errorf("error in %q: %w", stmtStr, err)
+			}
+			if !ok {
+				s.Rewind()
+				p.popScope()
+				if err := p.unindent(); err != nil {
+					return err
+				}
+				return nil
+			}
+		default:
+			return errorf(KindUnexpectedToken, "unexpected token found when parsing %q: %s at %s", stmtStr, t, s.Context())
+		}
+	}
+	if err := s.LastError(); err != nil {
+		return fmt.Errorf("cannot parse %q: %w", stmtStr, err)
+	}
+	return errorf(KindUnclosedTag, "cannot find end of %q at %s", stmtStr, s.Context())
+}
+
+func (p *parser) parseCase(typeSwitch bool) error {
+	s := p.s
+	t, err := expectTagContents(s)
+	if err != nil {
+		return err
+	}
+	caseStr := "case " + string(t.Value)
+	if err = validateCaseStmt(t.Value); err != nil {
+		return errorf(KindInvalidCode, "invalid statement %q at %s: %s", caseStr, s.Context(), err)
+	}
+	p.Printf("case %s:", t.Value)
+	p.prefix += "\t"
+	p.pushScope()
+	for s.Next() {
+		t := s.Token()
+		switch t.ID {
+		case text:
+			p.emitText(t.Value)
+		case tagName:
+			if string(t.Value) == "fallthrough" {
+				if err := p.parseFallthrough(typeSwitch); err != nil {
+					return fmt.Errorf("error in %q: %w", caseStr, err)
+				}
+				continue
+			}
+			ok, err := p.tryParseCommonTags(t.Value)
+			if err != nil {
+				return fmt.Errorf("error in %q: %w", caseStr, err)
+			}
+			if !ok {
+				s.Rewind()
+				p.popScope()
+				if err := p.unindent(); err != nil {
+					return err
+				}
+				return nil
+			}
+		default:
+			return errorf(KindUnexpectedToken, "unexpected token found when parsing %q: %s at %s", caseStr, t, s.Context())
+		}
+	}
+	if err := s.LastError(); err != nil {
+		return fmt.Errorf("cannot parse %q: %w", caseStr, err)
+	}
+	return errorf(KindUnclosedTag, "cannot find end of %q at %s", caseStr, s.Context())
+}
+
+// parseFallthrough emits fallthrough at the end of switch case.
+//
+// Go requires fallthrough to be the last statement in the case,
+// so the contents after it up to the next case are skipped.
+// fallthrough isn't allowed in the final case and in type switches.
+func (p *parser) parseFallthrough(typeSwitch bool) error {
+	s := p.s
+	if err := skipTagContents(s); err != nil {
+		return err
+	}
+	if typeSwitch {
+		return errorf(KindMisplacedTag, "cannot fallthrough in type switch at %s", s.Context())
+	}
+	if err := p.skipAfterStmt("fallthrough"); err != nil {
+		return err
+	}
+	if !s.Next() {
+		// The error is reported by the caller.
+		return nil
+	}
+	t := s.Token()
+	s.Rewind()
+	switch string(t.Value) {
+	case "case", "default":
+		return nil
+	case "endswitch":
+		return errorf(KindMisplacedTag, "cannot fallthrough final case in switch at %s", s.Context())
+	default:
+		return errorf(KindMisplacedTag, "fallthrough tag must be the last statement in switch case, found %q at %s", t.Value, s.Context())
+	}
+}
+
+func (p *parser) parseCat() error {
+	s := p.s
+	t, err := expectTagContents(s)
+	if err != nil {
+		return err
+	}
+	filename, err := strconv.Unquote(string(t.Value))
+	if err != nil {
+		return errorf(KindInvalidCode, "invalid cat value %q at %s: %s", t.Value, s.Context(), err)
+	}
+
+	data, err := p.readFile(s.filePath, filename)
+	if err != nil {
+		return errorf(KindInclude, "cannot cat file %q at %s: %w", filename, s.Context(), err)
+	}
+	p.emitText(data)
+	return nil
+}
+
+// parseCDATA parses cdata block.
+//
+// The block contents are wrapped into <![CDATA[ ... ]]>. Output tags
+// inside the block aren't html-escaped, while every "]]>" in the contents
+// is split between adjacent CDATA sections.
+func (p *parser) parseCDATA() error {
+	s := p.s
+	line := s.Token().line
+	if err := skipTagContents(s); err != nil {
+		return err
+	}
+	stmtStr := "cdata"
+	p.Printf("%s.N().S(`<![CDATA[`)", p.writerVar)
+	p.Printf("{")
+	p.prefix += "\t"
+	p.Printf("%s := qt%s.AcquireCDATAWriter(%s)", p.writerVar, mangleSuffix, p.writerVar)
+
+	// break and continue mustn't leave the block unclosed.
+	forDepth, switchDepth, loops, escapeMode := p.forDepth, p.switchDepth, p.loops, p.escapeMode
+	p.forDepth, p.switchDepth, p.loops, p.escapeMode = 0, 0, nil, "text"
+	p.cdataDepth++
+	for s.Next() {
+		t := s.Token()
+		switch t.ID {
+		case text:
+			p.emitText(t.Value)
+		case tagName:
+			ok, err := p.tryParseCommonTags(t.Value)
+			if err != nil {
+				return fmt.Errorf("error in %q: %w", stmtStr, err)
+			}
+			if ok {
+				continue
+			}
+			switch string(t.Value) {
+			case "endcdata":
+				if err = skipTagContents(s); err != nil {
+					return err
+				}
+				p.cdataDepth--
+				p.forDepth, p.switchDepth, p.loops, p.escapeMode = forDepth, switchDepth, loops, escapeMode
+				p.Printf("qt%s.ReleaseCDATAWriter(%s)", mangleSuffix, p.writerVar)
+				if err := p.unindent(); err != nil {
+					return err
+				}
+				p.Printf("}")
+				p.Printf("%s.N().S(`]]>`)", p.writerVar)
+				return nil
+			default:
+				return p.unexpectedTagError(t.Value, "endcdata", line, stmtStr)
+			}
+		default:
+			return errorf(KindUnexpectedToken, "unexpected token found when parsing %q: %s at %s", stmtStr, t, s.Context())
+		}
+	}
+	if err := s.LastError(); err != nil {
+		return fmt.Errorf("cannot parse %q: %w", stmtStr, err)
+	}
+	return errorf(KindUnclosedTag, "cannot find endcdata tag for %q at %s", stmtStr, s.Context())
+}
+
+// parseSpaceless parses spaceless block.
+//
+// Whitespace between '>' and '<' is removed from the text inside the block,
+// while whitespace inside the text such as "hello   world" is preserved.
+// Tags without output such as if and for don't break the whitespace
+// between '>' and '<', while output tags do.
+func (p *parser) parseSpaceless() error {
+	s := p.s
+	line := s.Token().line
+	if err := skipTagContents(s); err != nil {
+		return err
+	}
+	stmtStr := "spaceless"
+	p.spacelessDepth++
+	p.spacelessLast = 0
+	for s.Next() {
+		t := s.Token()
+		switch t.ID {
+		case text:
+			p.emitText(t.Value)
+		case tagName:
+			ok, err := p.tryParseCommonTags(t.Value)
+			if err != nil {
+				return fmt.Errorf("error in %q: %w", stmtStr, err)
+			}
+			if ok {
+				continue
+			}
+			switch string(t.Value) {
+			case "endspaceless":
+				if err = skipTagContents(s); err != nil {
+					return err
+				}
+				p.spacelessDepth--
+				p.spacelessLast = 0
+				p.spacelessSpace = nil
+				return nil
+			default:
+				return p.unexpectedTagError(t.Value, "endspaceless", line, stmtStr)
+			}
+		default:
+			return errorf(KindUnexpectedToken, "unexpected token found when parsing %q: %s at %s", stmtStr, t, s.Context())
+		}
+	}
+	if err := s.LastError(); err != nil {
+		return fmt.Errorf("cannot parse %q: %w", stmtStr, err)
+	}
+	return errorf(KindUnclosedTag, "cannot find endspaceless tag for %q at %s", stmtStr, s.Context())
+}
+
+// isSpacelessOutputTag returns true if the tag writes output unknown
+// at compile time, so the whitespace before the tag is preserved
+// inside spaceless block.
+func isSpacelessOutputTag(tagNameStr string) bool {
+	if isOutputTagName(tagNameStr) || strings.HasPrefix(tagNameStr, "=") {
+		return true
+	}
+	switch tagNameStr {
+	case "printf", "raw", "copy", "cdata", "sep":
+		return true
+	}
+	return false
+}
+
+// flushSpaceless writes the whitespace held after '>' before the output tag
+// inside spaceless block.
+func (p *parser) flushSpaceless() {
+	space := p.spacelessSpace
+	p.spacelessSpace = nil
+	p.spacelessLast = 0
+	if len(space) > 0 {
+		p.emitRawText(space)
+	}
+}
+
+// spacelessText removes whitespace between '>' and '<' from the text
+// inside spaceless block.
+//
+// The trailing whitespace after '>' is returned in space. It must be held
+// in p.spacelessSpace until the next text or tag is found.
+func (p *parser) spacelessText(text []byte) (dst, space []byte) {
+	space = p.spacelessSpace
+	p.spacelessSpace = nil
+	last := p.spacelessLast
+	for len(text) > 0 {
+		n := 0
+		for n < len(text) && isSpace(text[n]) {
+			n++
+		}
+		if n == len(text) {
+			space = append(space, text...)
+			break
+		}
+		if last != '>' || text[n] != '<' {
+			dst = append(dst, space...)
+			dst = append(dst, text[:n]...)
+		}
+		space = nil
+		text = text[n:]
+		n = 0
+		for n < len(text) && !isSpace(text[n]) {
+			n++
+		}
+		dst = append(dst, text[:n]...)
+		last = text[n-1]
+		text = text[n:]
+	}
+	if len(space) > 0 && last != '>' {
+		dst = append(dst, space...)
+		space = nil
+	}
+	p.spacelessLast = last
+	return dst, space
+}
+
+// parseInclude parses the included template file at the current position.
+//
+// The included file may contain only text and tags allowed in func body.
+func (p *parser) parseInclude() error {
+	s := p.s
+	t, err := expectTagContents(s)
+	if err != nil {
+		return err
+	}
+	filename, err := strconv.Unquote(string(t.Value))
+	if err != nil {
+		return errorf(KindInvalidCode, "invalid include value %q at %s: %s", t.Value, s.Context(), err)
+	}
+	path, err := p.includePath(s.filePath, filename)
+	if err != nil {
+		return errorf(KindInclude, "cannot include file %q at %s: %w", filename, s.Context(), err)
+	}
+	if err = p.pushInclude(path); err != nil {
+		return errorf(KindInclude, "cannot include file %q at %s: %w", filename, s.Context(), err)
+	}
+	data, err := p.readIncludedFile(path)
+	if err != nil {
+		return errorf(KindInclude, "cannot include file %q at %s: %w", filename, s.Context(), err)
+	}
+
+	// break and continue mustn't cross the include boundary,
+	// so the included file may be used in any context.
+	forDepth, switchDepth, loops := p.forDepth, p.switchDepth, p.loops
+	p.forDepth, p.switchDepth, p.loops = 0, 0, nil
+
+	p.s = newScannerDelims(bytes.NewReader(data), path, s.tagOpen, s.tagClose)
+	p.s.mustacheTag = s.mustacheTag
+	if p.preserveComments {
+		p.s.onComment = p.emitTemplateComment
+	}
+	err = p.parseIncludedFile()
+	if err != nil {
+		// The position in the nested scanner isn't reported otherwise.
+		err = newParseError(p.s, err)
+	}
+	p.s = s
+	p.forDepth, p.switchDepth, p.loops = forDepth, switchDepth, loops
+	p.includes = p.includes[:len(p.includes)-1]
+	if err != nil {
+		return fmt.Errorf("error in the file %q included at %s: %w", filename, s.Context(), err)
+	}
+	return nil
+}
+
+// includePath returns the path to filename referred from the file at cwd.
+func (p *parser) includePath(cwd, filename string) (string, error) {
+	if p.fsys == nil {
+		return includePath(cwd, filename)
+	}
+	return fsIncludePath(cwd, filename)
+}
+
+// readIncludedFile reads the file at the path returned by includePath.
+func (p *parser) readIncludedFile(path string) ([]byte, error) {
+	if p.fsys == nil {
+		return ioutil.ReadFile(path)
+	}
+	return fs.ReadFile(p.fsys, path)
+}
+
+// readFile reads filename referred from the file at cwd by cat tag.
+func (p *parser) readFile(cwd, filename string) ([]byte, error) {
+	if p.fsys == nil {
+		return readFile(cwd, filename)
+	}
+	path, err := fsIncludePath(cwd, filename)
+	if err != nil {
+		return nil, err
+	}
+	return fs.ReadFile(p.fsys, path)
+}
+
+// pushInclude registers the file at path as being included.
+func (p *parser) pushInclude(path string) error {
+	if len(p.includes) == 0 {
+		filePathAbs, err := filepath.Abs(p.s.filePath)
+		if err != nil {
+			return err
+		}
+		p.includes = append(p.includes, filePathAbs)
+	}
+	pathAbs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	for i, f := range p.includes {
+		if f == pathAbs {
+			cycle := append(p.includes[i:], pathAbs)
+			for j := range cycle {
+				cycle[j] = filepath.Base(cycle[j])
+			}
+			return errorf(KindInclude, "include cycle found: %s", strings.Join(cycle, " -> "))
+		}
+	}
+	p.includes = append(p.includes, pathAbs)
+	return nil
+}
+
+func (p *parser) parseIncludedFile() error {
+	s := p.s
+	for s.Next() {
+		t := s.Token()
+		switch t.ID {
+		case text:
+			p.emitText(t.Value)
+		case tagName:
+			ok, err := p.tryParseCommonTags(t.Value)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				return errorf(KindUnexpectedToken, "unexpected tag found: %q at %s", t.Value, s.Context())
+			}
+		default:
+			return errorf(KindUnexpectedToken, "unexpected token found %s at %s", t, s.Context())
+		}
+	}
+	return s.LastError()
+}
+
+func (p *parser) parseSwitch() error {
+	s := p.s
+	line := s.Token().line
+	t, err := expectTagContents(s)
+	if err != nil {
+		return err
+	}
+	switchStr := "switch " + string(t.Value)
+	if err = validateSwitchStmt(t.Value); err != nil {
+		return errorf(KindInvalidCode, "invalid statement %q at %s: %s", switchStr, s.Context(), err)
+	}
+	typeSwitch := isTypeSwitchStmt(t.Value)
+	p.Printf("switch %s {", t.Value)
+	caseNum := 0
+	defaultFound := false
+	p.switchDepth++
+	for s.Next() {
+		t := s.Token()
+		switch t.ID {
+		case text:
+			if caseNum == 0 {
+				comment := stripLeadingSpace(t.Value)
+				if len(comment) > 0 {
+					p.emitComment(comment)
+				}
+			} else {
+				p.emitText(t.Value)
+			}
+		case tagName:
+			switch string(t.Value) {
+			case "endswitch":
+				if caseNum == 0 {
+					return errorf(KindEmptyExpression, "empty statement %q found at %s", switchStr, s.Context())
+				}
+				if err = skipTagContents(s); err != nil {
+					return err
+				}
+				p.switchDepth--
+				p.Printf("}")
+				return nil
+			case "case":
+				caseNum++
+				if err = p.parseCase(typeSwitch); err != nil {
+					return err
+				}
+			case "default":
+				if defaultFound {
+					return errorf(KindUnexpectedToken, "duplicate default tag found in %q at %s", switchStr, s.Context())
+				}
+				defaultFound = true
+				caseNum++
+				if err = p.parseDefault(typeSwitch); err != nil {
+					return err
+				}
+			default:
+				return p.unexpectedTagError(t.Value, "endswitch", line, switchStr)
+			}
+		default:
+			return errorf(KindUnexpectedToken, "unexpected token found when parsing %q: %s at %s", switchStr, t, s.Context())
+		}
+	}
+	if err := s.LastError(); err != nil {
+		return fmt.Errorf("cannot parse %q: %w", switchStr, err)
+	}
+	return errorf(KindUnclosedTag, "cannot find endswitch tag for %q at %s", switchStr, s.Context())
+}
+
+func (p *parser) parseIf() (err error) {
+	defer p.traceTag("if")(&err)
+	s := p.s
+	line := s.Token().line
+	t, err := expectTagContents(s)
+	if err != nil {
+		return err
+	}
+	if len(t.Value) == 0 {
+		return errorf(KindEmptyExpression, "empty if condition at %s", s.Context())
+	}
+	ifStr := "if " + string(t.Value)
+	if err = validateIfStmt(t.Value); err != nil {
+		return errorf(KindInvalidCode, "invalid statement %q at %s: %s", ifStr, s.Context(), err)
+	}
+	p.Printf("if %s {", t.Value)
+	return p.parseIfBranches(ifStr, "endif", line)
+}
+
+// parseUnless parses {% unless cond %}, which is the negated {% if cond %}.
+func (p *parser) parseUnless() error {
+	s := p.s
+	line := s.Token().line
+	t, err := expectTagContents(s)
+	if err != nil {
+		return err
+	}
+	if len(t.Value) == 0 {
+		return errorf(KindEmptyExpression, "empty unless condition at %s", s.Context())
+	}
+	unlessStr := "unless " + string(t.Value)
+
+	// The condition is wrapped into !(...), so it must be an expression.
+	if _, err = goparser.ParseExpr(string(t.Value)); err != nil {
+		return errorf(KindInvalidCode, "invalid condition %q at %s: %s", unlessStr, s.Context(), err)
+	}
+	p.Printf("if !(%s) {", t.Value)
+	return p.parseIfBranches(unlessStr, "endunless", line)
+}
+
+// parseIfBranches parses the if body with the optional elseif and else
+// branches until the endTag.
+//
+// elseif branches are allowed only in if.
+func (p *parser) parseIfBranches(ifStr, endTag string, line int) error {
+	s := p.s
+	p.prefix += "\t"
+	p.pushScope()
+	elseUsed := false
+	for s.Next() {
+		t := s.Token()
+		switch t.ID {
+		case text:
+			p.emitText(t.Value)
+		case tagName:
+			ok, err := p.tryParseCommonTags(t.Value)
+			if err != nil {
+				return fmt.Errorf("error in %q: %w", ifStr, err)
+			}
+			if ok {
+				continue
+			}
+			switch string(t.Value) {
+			case endTag:
+				if err = skipTagContents(s); err != nil {
+					return err
+				}
+				p.popScope()
+				if err := p.unindent(); err != nil {
+					return err
+				}
+				p.Printf("}")
+				return nil
+			case "else":
+				if elseUsed {
+					return errorf(KindUnexpectedToken, "duplicate else branch found for %q at %s", ifStr, s.Context())
+				}
+				if err = skipTagContents(s); err != nil {
+					return err
+				}
+				p.popScope()
+				if err := p.unindent(); err != nil {
+					return err
+				}
+				p.Printf("} else {")
+				p.prefix += "\t"
+				p.pushScope()
+				elseUsed = true
+			case "elseif", "elif":
+				// elif is an alias for elseif.
+				tagStr := string(t.Value)
+				if endTag != "endif" {
+					return errorf(KindUnexpectedToken, "unexpected %s branch found in %q at %s", tagStr, ifStr, s.Context())
+				}
+				if elseUsed {
+					return errorf(KindUnexpectedToken, "unexpected %s branch found after else branch for %q at %s",
+						tagStr, ifStr, s.Context())
+				}
+				t, err = expectTagContents(s)
+				if err != nil {
+					return err
+				}
+				if len(t.Value) == 0 {
+					return errorf(KindEmptyExpression, "empty %s condition for %q at %s", tagStr, ifStr, s.Context())
+				}
+				if err = validateIfStmt(t.Value); err != nil {
+					return errorf(KindInvalidCode, "invalid statement \"%s %s\" for %q at %s: %s", tagStr, t.Value, ifStr, s.Context(), err)
+				}
+				p.popScope()
+				if err := p.unindent(); err != nil {
+					return err
+				}
+				p.Printf("} else if %s {", t.Value)
+				p.prefix += "\t"
+				p.pushScope()
+			default:
+				return p.unexpectedTagError(t.Value, endTag, line, ifStr)
+			}
+		default:
+			return errorf(KindUnexpectedToken, "unexpected token found when parsing %q: %s at %s", ifStr, t, s.Context())
+		}
+	}
+	if err := s.LastError(); err != nil {
+		return fmt.Errorf("cannot parse %q: %w", ifStr, err)
+	}
+	return errorf(KindUnclosedTag, "cannot find %s tag for %q at %s", endTag, ifStr, s.Context())
+}
+
+func (p *parser) tryParseCommonTags(tagBytes []byte) (bool, error) {
+	tagNameStr, safeDeref := splitSafeDerefTagName(string(tagBytes))
+	tagNameStr, prec := splitTagNamePrec(tagNameStr)
+	tagNameStr, stringer, err := splitTagNameType(tagNameStr)
+	if err != nil {
+		return false, fmt.Errorf("%w at %s", err, p.s.Context())
+	}
+	if p.spacelessDepth > 0 && isSpacelessOutputTag(tagNameStr) {
+		p.flushSpaceless()
+	}
+	if safeDeref {
+		if !isOutputTagName(tagNameStr) {
+			return false, errorf(KindUnexpectedToken, "unexpected tag %q: only output tags may be used with '?' at %s", tagBytes, p.s.Context())
+		}
+		if err := p.parseSafeDerefOutputTag(tagNameStr, prec, stringer); err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+	switch tagNameStr {
+	case "s", "v", "d", "f", "q", "z", "j", "u", "a", "js", "x", "css",
+		"s=", "v=", "d=", "f=", "q=", "z=", "j=", "u=", "a=", "js=", "x=", "css=",
+		"sz", "qz", "jz", "uz", "az", "xz",
+		"sz=", "qz=", "jz=", "uz=", "az=", "xz=",
+		"dn", "dn=":
+		if err := p.parseOutputTag(tagNameStr, prec, stringer); err != nil {
+			return false, err
+		}
+	case "=", "=h", "=u", "=uh", "=q", "=qh", "=j", "=jh":
+		if err := p.parseOutputFunc(tagNameStr); err != nil {
+			return false, err
+		}
+	case "fallthrough":
+		return false, errorf(KindMisplacedTag, "fallthrough tag may be used only at the end of switch case at %s", p.s.Context())
+	case "return":
+		if p.cdataDepth > 0 {
+			return false, errorf(KindMisplacedTag, "found return tag inside cdata block at %s", p.s.Context())
+		}
+		if err := p.parseReturn(); err != nil {
+			return false, err
+		}
+	case "cdata":
+		if err := p.parseCDATA(); err != nil {
+			return false, err
+		}
+	case "spaceless":
+		if err := p.parseSpaceless(); err != nil {
+			return false, err
+		}
+	case "break", "continue":
+		if err := p.parseBreakContinue(tagNameStr); err != nil {
+			return false, err
+		}
+	case "sep":
+		if err := p.parseSep(); err != nil {
+			return false, err
+		}
+	case "code":
+		if err := p.parseFuncCode(); err != nil {
+			return false, err
+		}
+	case "defer":
+		if err := p.parseDefer(); err != nil {
+			return false, err
+		}
+	case "printf":
+		if err := p.parsePrintf(); err != nil {
+			return false, err
+		}
+	case "raw":
+		if err := p.parseRaw(); err != nil {
+			return false, err
+		}
+	case "copy":
+		if err := p.parseCopy(); err != nil {
+			return false, err
+		}
+	case "assign":
+		if err := p.parseAssign(); err != nil {
+			return false, err
+		}
+	case "with":
+		if err := p.parseWith(); err != nil {
+			return false, err
+		}
+	case "for":
+		if err := p.parseFor(); err != nil {
+			return false, err
+		}
+	case "if":
+		if err := p.parseIf(); err != nil {
+			return false, err
+		}
+	case "unless":
+		if err := p.parseUnless(); err != nil {
+			return false, err
+		}
+	case "switch":
+		if err := p.parseSwitch(); err != nil {
+			return false, err
+		}
+	case "cat":
+		if err := p.parseCat(); err != nil {
+			return false, err
+		}
+	case "include":
+		if err := p.parseInclude(); err != nil {
+			return false, err
+		}
+	case "func", "macro":
+		if err := p.parseFuncClosure(tagNameStr); err != nil {
+			return false, err
+		}
+	default:
+		return false, nil
+	}
+	return true, nil
+}
+
+func isOutputTagName(tagName string) bool {
+	switch tagName {
+	case "s", "v", "d", "f", "q", "z", "j", "u", "a", "js", "x", "css",
+		"s=", "v=", "d=", "f=", "q=", "z=", "j=", "u=", "a=", "js=", "x=", "css=",
+		"sz", "qz", "jz", "uz", "az", "xz",
+		"sz=", "qz=", "jz=", "uz=", "az=", "xz=",
+		"dn", "dn=":
+		return true
+	}
+	return false
+}
+
+// splitSafeDerefTagName removes '?' modifier from tag names like 's?' and 's?='.
+func splitSafeDerefTagName(tagName string) (string, bool) {
+	s := strings.TrimSuffix(tagName, "=")
+	if !strings.HasSuffix(s, "?") {
+		return tagName, false
+	}
+	return s[:len(s)-1] + tagName[len(s):], true
+}
+
+func splitTagNamePrec(tagName string) (string, int) {
+	parts := strings.Split(tagName, ".")
+	if len(parts) == 2 && parts[0] == "f" {
+		p := parts[1]
+		if strings.HasSuffix(p, "=") {
+			p = p[:len(p)-1]
+		}
+		if len(p) == 0 {
+			return "f", 0
+		}
+		prec, err := strconv.Atoi(p)
+		if err == nil && prec >= 0 {
+			return "f", prec
+		}
+	}
+	return tagName, -1
+}
+
+// valueTypeTags maps types in {%v:type %} tags to the specialized output tags.
+var valueTypeTags = map[string]string{
+	"string":   "s",
+	"int":      "d",
+	"float":    "f",
+	"stringer": "s",
+}
+
+// splitTagNameType converts tag names like 'v:int' and 'v:int=' into
+// the corresponding output tag names such as 'd' and 'd='.
+//
+// This allows avoiding reflection in {%v %} for values of known types.
+// stringer is set for 'v:stringer' tags, whose values must be converted
+// to strings via String() call.
+func splitTagNameType(tagName string) (string, bool, error) {
+	if !strings.HasPrefix(tagName, "v:") {
+		return tagName, false, nil
+	}
+	typ := strings.TrimSuffix(tagName[len("v:"):], "=")
+	t, ok := valueTypeTags[typ]
+	if !ok {
+		return "", false, errorf(KindUnexpectedToken, "unsupported type %q in %q tag; supported types: string, int, float, stringer", typ, tagName)
+	}
+	return t + tagName[len("v:")+len(typ):], typ == "stringer", nil
+}
+
+// parseBreakContinue parses break and continue tags.
+//
+// The optional tag value N refers to the N-th enclosing for loop,
+// so {% break 2 %} breaks out of the outer loop from the inner one.
+func (p *parser) parseBreakContinue(tagStr string) error {
+	s := p.s
+	t, err := expectTagContents(s)
+	if err != nil {
+		return err
+	}
+	if len(t.Value) == 0 {
+		if tagStr == "break" && p.forDepth <= 0 && p.switchDepth <= 0 {
+			return errorf(KindMisplacedTag, "found break tag outside for loop and switch block")
+		}
+		if tagStr == "continue" && p.forDepth <= 0 {
+			return errorf(KindMisplacedTag, "found continue tag outside for loop")
+		}
+		return p.skipAfterStmt(tagStr)
+	}
+	n, err := strconv.Atoi(string(t.Value))
+	if err != nil || n <= 0 {
+		return errorf(KindInvalidCode, "invalid %s value %q at %s: it must be a positive integer", tagStr, t.Value, s.Context())
+	}
+	if n > p.forDepth {
+		return errorf(KindMisplacedTag, "%s %d at %s exceeds the number of enclosing for loops: %d", tagStr, n, s.Context(), p.forDepth)
+	}
+	loop := p.loops[len(p.loops)-n]
+	if p.skipOutputDepth == 0 {
+		loop.used = true
+	}
+	return p.skipAfterStmt(tagStr + " " + loop.name)
+}
+
+// parseSep parses sep tag, which writes the separator between loop items.
+//
+// The separator is written every time the tag is reached in the innermost
+// for loop except the first time, so {% for _, s := range a %}{% sep ", " %}{%s s %}{% endfor %}
+// writes "a, b, c". Items skipped via continue before the tag don't get
+// the separator.
+func (p *parser) parseSep() error {
+	s := p.s
+	t, err := expectTagContents(s)
+	if err != nil {
+		return err
+	}
+	if p.forDepth <= 0 {
+		return errorf(KindMisplacedTag, "found sep tag outside for loop at %s", s.Context())
+	}
+	if _, n, err := scanStringLit(t.Value); err != nil || n != len(t.Value) {
+		return errorf(KindInvalidCode, "sep tag value must be a string literal, found %q at %s", t.Value, s.Context())
+	}
+	loop := p.loops[len(p.loops)-1]
+	if p.skipOutputDepth == 0 {
+		loop.sepUsed = true
+	}
+	p.Printf("if %s {", loop.sepVar)
+	p.Printf("\t%s.N().S(%s)", p.writerVar, t.Value)
+	p.Printf("}")
+	p.Printf("%s = true", loop.sepVar)
+	return nil
+}
+
+// loopLabel is a label for the for loop.
+type loopLabel struct {
+	name string
+
+	// used is set if the label is referred by break or continue.
+	used bool
+
+	// sepVar is the name of the flag, which is set after the first
+	// {% sep %} tag in the loop.
+	sepVar string
+
+	// sepUsed is set if the loop contains sep tags.
+	sepUsed bool
+}
+
+// parseReturn parses return tag.
+//
+// Funcs with err modifier may return an error via {% return err %},
+// while {% return %} returns nil error from them.
+func (p *parser) parseReturn() error {
+	s := p.s
+	t, err := expectTagContents(s)
+	if err != nil {
+		return err
+	}
+	if p.inlineFunc {
+		return errorf(KindMisplacedTag, "return tag cannot be used in func with inline modifier at %s, since it would return from the calling func", s.Context())
+	}
+	if !p.errResultFunc {
+		if len(t.Value) > 0 {
+			return errorf(KindUnexpectedToken, "unexpected extra value after return: %q at %s; only funcs with err modifier may return errors", t.Value, s.Context())
+		}
+		return p.skipAfterStmt("return")
+	}
+	value := "nil"
+	if len(t.Value) > 0 {
+		if _, err := goparser.ParseExpr(string(t.Value)); err != nil {
+			return errorf(KindInvalidCode, "invalid return value %q at %s: %s", t.Value, s.Context(), err)
+		}
+		value = string(t.Value)
+	}
+	if p.prefix == "\t" && p.skipOutputDepth == 0 {
+		p.funcReturned = true
+	}
+	return p.skipAfterStmt("return " + value)
+}
+
+func (p *parser) skipAfterStmt(tagStr string) error {
+	s := p.s
+	p.Printf("%s", tagStr)
+	p.skipOutputDepth++
+	defer func() {
+		p.skipOutputDepth--
+	}()
+	for s.Next() {
+		t := s.Token()
+		switch t.ID {
+		case text:
+			// skip text
+		case tagName:
+			ok, err := p.tryParseCommonTags(t.Value)
+			if err != nil {
+				return fmt.Errorf("error when parsing contents after %q: %w", tagStr, err)
+			}
+			if ok {
+				continue
+			}
+			switch string(t.Value) {
+			case "endfunc", "endmacro", "endfor", "endif", "endunless", "else", "elseif", "elif", "case", "default", "endswitch", "endwith":
+				s.Rewind()
+				return nil
+			default:
+				return errorf(KindUnexpectedToken, "unexpected tag found after %q: %q at %s", tagStr, t.Value, s.Context())
+			}
+		default:
+			return errorf(KindUnexpectedToken, "unexpected token found when parsing contents after %q: %s at %s", tagStr, t, s.Context())
+		}
+	}
+	if err := s.LastError(); err != nil {
+		return fmt.Errorf("cannot parse contents after %q: %w", tagStr, err)
+	}
+	return errorf(KindUnclosedTag, "cannot find closing tag after %q at %s", tagStr, s.Context())
+}
+
+func (p *parser) parseInterface() error {
+	s := p.s
+	t, err := expectTagContents(s)
+	if err != nil {
+		return err
+	}
+
+	n := bytes.IndexByte(t.Value, '{')
+	if n < 0 {
+		return errorf(KindInvalidCode, "missing '{' in interface at %s", s.Context())
+	}
+	ifname := string(stripTrailingSpace(t.Value[:n]))
+	if len(ifname) == 0 {
+		return errorf(KindEmptyExpression, "missing interface name at %s", s.Context())
+	}
+	p.Printf("type %s interface {", ifname)
+	p.prefix = "\t"
+
+	tail := t.Value[n:]
+	exprStr := fmt.Sprintf("interface %s", tail)
+	expr, err := goparser.ParseExpr(exprStr)
+	if err != nil {
+		return errorf(KindInvalidCode, "error when parsing interface at %s: %s", s.Context(), err)
+	}
+	it, ok := expr.(*ast.InterfaceType)
+	if !ok {
+		return errorf(KindUnexpectedToken, "unexpected interface type at %s: %T", s.Context(), expr)
+	}
+	methods := it.Methods.List
+	if len(methods) == 0 {
+		return errorf(KindInvalidCode, "interface must contain at least one method at %s", s.Context())
+	}
+
+	for _, m := range it.Methods.List {
+		methodStr := exprStr[m.Pos()-1 : m.End()-1]
+		f, err := parseFuncDef([]byte(methodStr))
+		if err != nil {
+			return errorf(KindInvalidCode, "when when parsing %q at %s: %s", methodStr, s.Context(), err)
+		}
+		p.Printf("%s string", methodStr)
+		p.Printf("%s", f.DefStream(p.writerVar))
+		p.Printf("%s", f.DefWrite(p.writerArg))
+	}
+	p.prefix = ""
+	p.Printf("}")
+	return nil
+}
+
+func (p *parser) parsePackageName() error {
+	t, err := expectTagContents(p.s)
+	if err != nil {
+		return err
+	}
+	if len(t.Value) == 0 {
+		return errorf(KindEmptyExpression, "empty package name found at %s", p.s.Context())
+	}
+	if err = validatePackageName(t.Value); err != nil {
+		return errorf(KindInvalidCode, "invalid package name found at %s: %s", p.s.Context(), err)
+	}
+	p.packageName = string(t.Value)
+	p.emitPackageName()
+	return nil
+}
+
+// parseBuild emits the build constraint for the generated file.
+//
+// The constraint is written as //go:build line followed by a blank line,
+// so Go tools don't confuse it with the package doc comment.
+func (p *parser) parseBuild() error {
+	t, err := expectTagContents(p.s)
+	if err != nil {
+		return err
+	}
+	if len(t.Value) == 0 {
+		return errorf(KindEmptyExpression, "empty build constraint found at %s", p.s.Context())
+	}
+	if err = validateBuildConstraint(t.Value); err != nil {
+		return errorf(KindInvalidCode, "invalid build constraint found at %s: %s", p.s.Context(), err)
+	}
+	fmt.Fprintf(p.w, "//go:build %s\n\n", t.Value)
+	p.buildEmitted = true
+	return nil
+}
+
+func (p *parser) parseImport() error {
+	t, err := expectTagContents(p.s)
+	if err != nil {
+		return err
+	}
+	if len(t.Value) == 0 {
+		return errorf(KindEmptyExpression, "empty import found at %s", p.s.Context())
+	}
+	if err = validateImport(t.Value); err != nil {
+		return errorf(KindInvalidCode, "invalid import found at %s: %s", p.s.Context(), err)
+	}
+	p.Printf("import %s\n", t.Value)
+	return nil
+}
+
+func (p *parser) parseTemplateCode() error {
+	t, err := expectTagContents(p.s)
+	if err != nil {
+		return err
+	}
+	code := t.Value
+	switch {
+	case isPackageCodeTag(code):
+		return p.parsePackageCode(p.w)
+	case len(code) == 0:
+		// Empty code tag without endcode is no-op for backwards compatibility.
+		if !p.s.readCodeBlock() {
+			return nil
+		}
+		code = p.s.Token().Value
+	}
+	if err = p.validateTemplateCode(code); err != nil {
+		return errorf(KindInvalidCode, "invalid code at %s: %s", p.s.Context(), err)
+	}
+	p.declarePackageIdents(templateCodeIdents(code))
+	p.Printf("%s\n", indentCode(code, p.prefix))
+	return nil
+}
+
+// parseConst emits package-level const declaration.
+//
+// Both `{% const Name = value %}` and grouped `{% const ( ... ) %}`
+// declarations are supported.
+func (p *parser) parseConst() error {
+	t, err := expectTagContents(p.s)
+	if err != nil {
+		return err
+	}
+	if len(t.Value) == 0 {
+		return errorf(KindEmptyExpression, "empty const declaration found at %s", p.s.Context())
+	}
+	if err = validateConst(t.Value); err != nil {
+		return errorf(KindInvalidCode, "invalid const declaration found at %s: %s", p.s.Context(), err)
+	}
+	p.Printf("const %s\n", indentCode(t.Value, p.prefix))
+	return nil
+}
+
+func (p *parser) parseFuncCode() error {
+	t, err := expectTagContents(p.s)
+	if err != nil {
+		return err
+	}
+	code := t.Value
+	switch {
+	case isPackageCodeTag(code):
+		if p.inlineFunc {
+			return errorf(KindMisplacedTag, "package-level code cannot be used in func with inline modifier at %s, since it would be duplicated at each call", p.s.Context())
+		}
+		// Package-level code cannot be emitted inside func,
+		// so it is emitted after the enclosing top-level func.
+		return p.parsePackageCode(&p.packageCode)
+	case len(code) == 0:
+		// Empty code tag without endcode is no-op for backwards compatibility.
+		if !p.s.readCodeBlock() {
+			return nil
+		}
+		code = p.s.Token().Value
+	}
+	if err = p.validateFuncCode(code); err != nil {
+		return errorf(KindInvalidCode, "invalid code at %s: %s", p.s.Context(), err)
+	}
+	p.declareIdents(funcCodeIdents(code))
+	p.Printf("%s\n", indentCode(code, p.prefix))
+	return nil
+}
+
+// parseDefer emits the deferred func call.
+//
+// The call is executed when the enclosing func returns, i.e. after
+// the func body is written to qw and before the writer is released.
+func (p *parser) parseDefer() error {
+	s := p.s
+	t, err := expectTagContents(s)
+	if err != nil {
+		return err
+	}
+	if p.cdataDepth > 0 {
+		// The deferred call would run after the cdata writer is released.
+		return errorf(KindMisplacedTag, "found defer tag inside cdata block at %s", s.Context())
+	}
+	if p.inlineFunc {
+		return errorf(KindMisplacedTag, "defer tag cannot be used in func with inline modifier at %s, since the deferred call would run when the calling func returns", s.Context())
+	}
+	expr, err := goparser.ParseExpr(string(t.Value))
+	if err != nil {
+		return errorf(KindInvalidCode, "invalid statement \"defer %s\" at %s: %s", t.Value, s.Context(), err)
+	}
+	if _, ok := expr.(*ast.CallExpr); !ok {
+		return errorf(KindInvalidCode, "invalid statement \"defer %s\" at %s: expression must be function call", t.Value, s.Context())
+	}
+	p.Printf("defer %s", t.Value)
+	return nil
+}
+
+// parsePrintf emits the output formatted according to the format string.
+//
+// The output is written directly to qw via QWriter.Printf,
+// so the formatted string isn't allocated.
+func (p *parser) parsePrintf() error {
+	s := p.s
+	t, err := expectTagContents(s)
+	if err != nil {
+		return err
+	}
+	expr, err := goparser.ParseExpr(fmt.Sprintf("printf(%s)", t.Value))
+	if err != nil {
+		return errorf(KindInvalidCode, "invalid printf args %q at %s: %s", t.Value, s.Context(), err)
+	}
+	ce := expr.(*ast.CallExpr)
+	if len(ce.Args) == 0 {
+		return errorf(KindEmptyExpression, "missing format string in printf tag at %s", s.Context())
+	}
+	if bl, ok := ce.Args[0].(*ast.BasicLit); !ok || bl.Kind != gotoken.STRING {
+		return errorf(KindInvalidCode, "printf format must be a string literal in %q at %s", t.Value, s.Context())
+	}
+	filter := "N"
+	if p.escapeMode != "text" {
+		filter = "E"
+	}
+	p.Printf("%s.%s().Printf(%s)", p.writerVar, filter, t.Value)
+	return nil
+}
+
+// parseCopy emits streaming of the io.Reader contents to the output.
+//
+// The contents are written as is without escaping via QWriter.Copy,
+// so they aren't buffered in memory.
+func (p *parser) parseCopy() error {
+	s := p.s
+	t, err := expectTagContents(s)
+	if err != nil {
+		return err
+	}
+	if len(bytes.TrimSpace(t.Value)) == 0 {
+		return errorf(KindEmptyExpression, "empty reader in copy tag at %s", s.Context())
+	}
+	if _, err := goparser.ParseExpr(string(t.Value)); err != nil {
+		return errorf(KindInvalidCode, "invalid reader %q in copy tag at %s: %s", t.Value, s.Context(), err)
+	}
+	p.Printf("%s.N().Copy(%s)", p.writerVar, t.Value)
+	return nil
+}
+
+// parseRaw emits the write of the trusted string or byte slice
+// without html escaping, i.e. {% raw s %} is equivalent to {%s= s %}
+// for strings and to {%z= s %} for byte slices.
+//
+// Values of other types are written as {%v= %} does.
+func (p *parser) parseRaw() error {
+	s := p.s
+	t, err := expectTagContents(s)
+	if err != nil {
+		return err
+	}
+	if len(bytes.TrimSpace(t.Value)) == 0 {
+		return errorf(KindEmptyExpression, "empty expression in raw tag at %s", s.Context())
+	}
+	if err := validateOutputTagValue(t.Value); err != nil {
+		return errorf(KindInvalidCode, "invalid raw tag value at %s: %s", s.Context(), err)
+	}
+	// The value is boxed into the interface only for the type switch,
+	// so strings and byte slices are written without memory allocations.
+	p.Printf("switch qv%s := %s; qr%s := interface{}(qv%s).(type) {", mangleSuffix, t.Value, mangleSuffix, mangleSuffix)
+	p.Printf("case string:")
+	p.Printf("\t%s.N().S(qr%s)", p.writerVar, mangleSuffix)
+	p.Printf("case []byte:")
+	p.Printf("\t%s.N().Z(qr%s)", p.writerVar, mangleSuffix)
+	p.Printf("default:")
+	p.Printf("\t%s.N().V(qv%s)", p.writerVar, mangleSuffix)
+	p.Printf("}")
+	return nil
+}
+
+// parseAssign emits either declaration or assignment for the variable
+// depending on whether the variable has been already declared via assign
+// tag in the current or the enclosing scopes.
+func (p *parser) parseAssign() error {
+	s := p.s
+	t, err := expectTagContents(s)
+	if err != nil {
+		return err
+	}
+	name, expr, err := splitAssignStmt(t.Value)
+	if err == nil {
+		err = p.validateIdent(name)
+	}
+	if err != nil {
+		return errorf(KindInvalidCode, "invalid statement \"assign %s\" at %s: %s", t.Value, s.Context(), err)
+	}
+	op := ":="
+	if name == "_" || p.isDeclared(name) {
+		op = "="
+	} else {
+		p.declare(name)
+	}
+	p.Printf("%s %s %s", name, op, expr)
+	return nil
+}
+
+// parseWith emits the block with variables declared via
+// 'name = expr' bindings.
+//
+// The variables are visible only inside the block.
+func (p *parser) parseWith() error {
+	s := p.s
+	line := s.Token().line
+	t, err := expectTagContents(s)
+	if err != nil {
+		return err
+	}
+	stmtStr := "with " + string(t.Value)
+	bindings, err := splitWithBindings(t.Value)
+	for i := 0; err == nil && i < len(bindings); i++ {
+		err = p.validateIdent(bindings[i].name)
+	}
+	if err != nil {
+		return errorf(KindInvalidCode, "invalid statement %q at %s: %s", stmtStr, s.Context(), err)
+	}
+	p.Printf("{")
+	p.prefix += "\t"
+	p.pushScope()
+	for _, b := range bindings {
+		p.Printf("%s := %s", b.name, b.expr)
+		if b.name != "_" {
+			p.declare(b.name)
+		}
+	}
+	for s.Next() {
+		t := s.Token()
+		switch t.ID {
+		case text:
+			p.emitText(t.Value)
+		case tagName:
+			ok, err := p.tryParseCommonTags(t.Value)
+			if err != nil {
+				return fmt.Errorf("error in %q: %w", stmtStr, err)
+			}
+			if ok {
+				continue
+			}
+			switch string(t.Value) {
+			case "endwith":
+				if err = skipTagContents(s); err != nil {
+					return err
+				}
+				p.popScope()
+				if err := p.unindent(); err != nil {
+					return err
+				}
+				p.Printf("}")
+				return nil
+			default:
+				return p.unexpectedTagError(t.Value, "endwith", line, stmtStr)
+			}
+		default:
+			return errorf(KindUnexpectedToken, "unexpected token found when parsing %q: %s at %s", stmtStr, t, s.Context())
+		}
+	}
+	if err := s.LastError(); err != nil {
+		return fmt.Errorf("cannot parse %q: %w", stmtStr, err)
+	}
+	return errorf(KindUnclosedTag, "cannot find endwith tag for %q at %s", stmtStr, s.Context())
+}
+
+// withBinding is 'name = expr' binding in with tag.
+type withBinding struct {
+	name string
+	expr string
+}
+
+// splitWithBindings splits 'a = x, b = y' into bindings.
+//
+// Commas inside parens, brackets, braces and literals don't separate
+// bindings.
+func splitWithBindings(stmt []byte) ([]withBinding, error) {
+	if len(stmt) == 0 {
+		return nil, errorf(KindInvalidCode, "missing 'name = expr' bindings")
+	}
+	fset := gotoken.NewFileSet()
+	f := fset.AddFile("", -1, len(stmt))
+	var sc goscanner.Scanner
+	sc.Init(f, stmt, nil, 0)
+	var parts [][]byte
+	depth := 0
+	start := 0
+	for {
+		pos, tok, _ := sc.Scan()
+		if tok == gotoken.EOF {
+			break
+		}
+		switch tok {
+		case gotoken.LPAREN, gotoken.LBRACK, gotoken.LBRACE:
+			depth++
+		case gotoken.RPAREN, gotoken.RBRACK, gotoken.RBRACE:
+			depth--
+		case gotoken.COMMA:
+			if depth == 0 {
+				n := f.Offset(pos)
+				parts = append(parts, stmt[start:n])
+				start = n + 1
+			}
+		}
+	}
+	parts = append(parts, stmt[start:])
+
+	var bindings []withBinding
+	names := make(map[string]bool)
+	for _, part := range parts {
+		name, expr, err := splitAssignStmt(stripLeadingSpace(stripTrailingSpace(part)))
+		if err != nil {
+			return nil, err
+		}
+		if names[name] && name != "_" {
+			return nil, errorf(KindInvalidCode, "duplicate binding for %q", name)
+		}
+		names[name] = true
+		bindings = append(bindings, withBinding{name: name, expr: expr})
+	}
+	return bindings, nil
+}
+
+// splitAssignStmt splits 'name = expr' into name and expr.
+func splitAssignStmt(stmt []byte) (string, string, error) {
+	n := bytes.IndexByte(stmt, '=')
+	if n < 0 {
+		return "", "", errorf(KindInvalidCode, "missing '='")
+	}
+	name := string(stripTrailingSpace(stmt[:n]))
+	x, err := goparser.ParseExpr(name)
+	if err != nil {
+		return "", "", errorf(KindInvalidCode, "invalid left side %q: %s", name, err)
+	}
+	if _, ok := x.(*ast.Ident); !ok {
+		return "", "", errorf(KindInvalidCode, "left side %q must be an identifier", name)
+	}
+	if err = validateIdent(name); err != nil {
+		return "", "", err
+	}
+	expr := stripLeadingSpace(stmt[n+1:])
+	if len(expr) == 0 {
+		return "", "", errorf(KindEmptyExpression, "missing expression after '='")
+	}
+	if err = validateOutputTagValue(expr); err != nil {
+		return "", "", errorf(KindInvalidCode, "invalid expression %q: %s", expr, err)
+	}
+	return name, string(expr), nil
+}
+
+// validateIdent returns an error if the user-declared identifier name
+// shadows the template writer or the mangled identifiers
+// in the generated code.
+func (p *parser) validateIdent(name string) error {
+	if err := p.validateWriterIdent(name); err != nil {
+		return err
+	}
+	return validateIdent(name)
+}
+
+// validateWriterIdent returns an error if the user-declared identifier name
+// shadows the template writer, which may be set via ParseOptions.
+func (p *parser) validateWriterIdent(name string) error {
+	if name == p.writerVar || name == p.writerArg {
+		return errorf(KindInvalidCode, "identifier %q conflicts with the template writer", name)
+	}
+	return nil
+}
+
+func (p *parser) pushScope() {
+	p.scopes = append(p.scopes, nil)
+	p.idents = append(p.idents, nil)
+}
+
+func (p *parser) popScope() {
+	p.scopes = p.scopes[:len(p.scopes)-1]
+	p.idents = p.idents[:len(p.idents)-1]
+}
+
+// declareIdents declares identifiers from the template code
+// in the current Go scope.
+//
+// Identifiers are declared at package level outside funcs.
+func (p *parser) declareIdents(names []string) {
+	n := len(p.idents) - 1
+	if n < 0 {
+		p.declarePackageIdents(names)
+		return
+	}
+	if p.idents[n] == nil {
+		p.idents[n] = make(map[string]bool)
+	}
+	for _, name := range names {
+		p.idents[n][name] = false
+	}
+}
+
+// declareChanIdents declares identifiers with channel types
+// in the current Go scope.
+func (p *parser) declareChanIdents(names []string) {
+	n := len(p.idents) - 1
+	if len(names) == 0 || n < 0 {
+		return
+	}
+	if p.idents[n] == nil {
+		p.idents[n] = make(map[string]bool)
+	}
+	for _, name := range names {
+		p.idents[n][name] = true
+	}
+}
+
+// isChanIdent returns true if the identifier visible at the current position
+// is known to have channel type.
+func (p *parser) isChanIdent(name string) bool {
+	for i := len(p.idents) - 1; i >= 0; i-- {
+		if p.scopes[i][name] {
+			return false
+		}
+		if isChan, ok := p.idents[i][name]; ok {
+			return isChan
+		}
+	}
+	return false
+}
+
+func (p *parser) declarePackageIdents(names []string) {
+	if p.packageIdents == nil {
+		p.packageIdents = make(map[string]bool)
+	}
+	for _, name := range names {
+		p.packageIdents[name] = true
+	}
+}
+
+// isIdentDeclared returns true if the identifier is declared
+// in the template code visible at the current position.
+func (p *parser) isIdentDeclared(name string) bool {
+	if p.packageIdents[name] || p.isDeclared(name) {
+		return true
+	}
+	for _, idents := range p.idents {
+		if _, ok := idents[name]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *parser) declare(name string) {
+	n := len(p.scopes) - 1
+	if p.scopes[n] == nil {
+		p.scopes[n] = make(map[string]bool)
+	}
+	p.scopes[n][name] = true
+}
+
+func (p *parser) isDeclared(name string) bool {
+	for _, scope := range p.scopes {
+		if scope[name] {
+			return true
+		}
+	}
+	return false
+}
+
+func isPackageCodeTag(contents []byte) bool {
+	return string(contents) == "package"
+}
+
+// readCodeBlock returns unparsed Go code until endcode tag.
+func (p *parser) readCodeBlock() ([]byte, error) {
+	s := p.s
+	if !s.readRawBlock("endcode") {
+		return nil, errorf(KindUnclosedTag, "cannot find endcode tag for code block at %s: %s", s.Context(), s.err)
+	}
+	return s.Token().Value, nil
+}
+
+// parsePackageCode parses {% code package %} ... {% endcode %} block
+// and emits its contents to w.
+func (p *parser) parsePackageCode(w io.Writer) error {
+	s := p.s
+	code, err := p.readCodeBlock()
+	if err != nil {
+		return err
+	}
+	if err = p.validateTemplateCode(code); err != nil {
+		return errorf(KindInvalidCode, "invalid package code at %s: %s", s.Context(), err)
+	}
+	p.declarePackageIdents(templateCodeIdents(code))
+
+	// The code must be emitted even after return tag.
+	pw, prefix, skipOutputDepth := p.w, p.prefix, p.skipOutputDepth
+	p.w, p.prefix, p.skipOutputDepth = w, "", 0
+	p.Printf("%s\n", code)
+	p.w, p.prefix, p.skipOutputDepth = pw, prefix, skipOutputDepth
+	return nil
+}
+
+func (p *parser) parseOutputTag(tagNameStr string, prec int, stringer bool) error {
+	s := p.s
+	t, err := expectTagContents(s)
+	if err != nil {
+		return err
+	}
+	if len(bytes.TrimSpace(t.Value)) == 0 {
+		return errorf(KindEmptyExpression, "empty expression in %s tag at %s", tagNameStr, s.Context())
+	}
+	filters, stmt, err := splitOutputFilters(t.Value)
+	if err != nil {
+		return errorf(KindInvalidCode, "invalid output tag value at %s: %s", s.Context(), err)
+	}
+	if stringer {
+		// The value is converted to string before applying other filters.
+		filters = append(filters, outputFilter{name: "stringer"})
+	}
+	if len(filters) > 0 && !isStringOutputTag(tagNameStr) {
+		return errorf(KindInvalidCode, "%s filter cannot be used in %s tag at %s; it may be used only in tags writing strings and byte slices",
+			filters[0].name, tagNameStr, s.Context())
+	}
+	sep := ""
+	if strings.TrimSuffix(tagNameStr, "=") == "dn" {
+		sep, stmt = splitNumberSep(stmt)
+	}
+	cond, a, b, err := splitTernary(stmt)
+	if err != nil {
+		return errorf(KindInvalidCode, "invalid output tag value at %s: %s", s.Context(), err)
+	}
+	if cond == nil {
+		return p.emitOutputTag(tagNameStr, prec, sep, stmt, filters)
+	}
+
+	// Go has no ternary operator, so `cond ? a : b` is emitted as if-else.
+	if _, err = goparser.ParseExpr(string(cond)); err != nil {
+		return errorf(KindInvalidCode, "invalid condition %q in the output tag value at %s: %s", cond, s.Context(), err)
+	}
+	p.Printf("if %s {", cond)
+	p.prefix += "\t"
+	if err = p.emitOutputTag(tagNameStr, prec, sep, a, filters); err != nil {
+		return err
+	}
+	if err := p.unindent(); err != nil {
+		return err
+	}
+	p.Printf("} else {")
+	p.prefix += "\t"
+	if err = p.emitOutputTag(tagNameStr, prec, sep, b, filters); err != nil {
+		return err
+	}
+	if err := p.unindent(); err != nil {
+		return err
+	}
+	p.Printf("}")
+	return nil
+}
+
+// emitOutputTag emits the code for the output tag.
+//
+// sep is the string literal with the thousands separator for dn tag.
+func (p *parser) emitOutputTag(tagNameStr string, prec int, sep string, stmt []byte, filters []outputFilter) error {
+	s := p.s
+	value := string(stmt)
+	expr, discarded, err := splitDiscardedResults(stmt)
+	if err != nil {
+		return errorf(KindInvalidCode, "invalid output tag value at %s: %s", s.Context(), err)
+	}
+	if discarded > 0 {
+		// The expression returns multiple values. Output only the first one.
+		value = "qv" + mangleSuffix
+		p.Printf("{")
+		p.Printf("%s%s := %s", value, strings.Repeat(", _", discarded), expr)
+	} else if err = validateOutputTagValue(stmt); err != nil {
+		return errorf(KindInvalidCode, "invalid output tag value at %s: %s", s.Context(), err)
+	}
+	// Numbers written by d and f tags are always html-safe,
+	// so they are written without escaping regardless of '='.
+	filter := "N"
+	switch tagNameStr {
+	case "s", "v", "q", "z", "j", "sz", "qz", "jz":
+		if p.escapeMode != "text" {
+			filter = "E"
+		}
+	case "dn":
+		// The custom separator may contain chars requiring escaping.
+		if len(sep) > 0 && p.escapeMode != "text" {
+			filter = "E"
+		}
+	}
+	if strings.HasSuffix(tagNameStr, "=") {
+		tagNameStr = tagNameStr[:len(tagNameStr)-1]
+	}
+	value = applyOutputFilters(filters, value, strings.HasSuffix(tagNameStr, "z"))
+	if tagNameStr == "f" && prec >= 0 {
+		p.Printf("%s.N().FPrec(%s, %d)", p.writerVar, value, prec)
+	} else if tagNameStr == "dn" && len(sep) > 0 {
+		p.Printf("%s.%s().DNSep(%s, %s)", p.writerVar, filter, value, sep)
+	} else {
+		tagNameStr = strings.ToUpper(tagNameStr)
+		p.Printf("%s.%s().%s(%s)", p.writerVar, filter, tagNameStr, value)
+	}
+	if discarded > 0 {
+		p.Printf("}")
+	}
+
+	return nil
+}
+
+// outputFilter is a filter applied to the output tag value before
+// the escaping, i.e. trim or trimset.
+type outputFilter struct {
+	name string
+
+	// cutset is the string literal with chars to trim for trimset filter.
+	cutset string
+}
+
+// splitOutputFilters splits the leading filters from the output tag value.
+//
+// For instance, `trim trimset ".," s` is split into trim and trimset
+// filters and s. The filters are applied from right to left,
+// i.e. trim is applied after trimset.
+//
+// Filter names are recognized only if they are followed by whitespace
+// and the value isn't a valid Go expression, so variables and funcs
+// named trim may be used in output tags.
+func splitOutputFilters(stmt []byte) ([]outputFilter, []byte, error) {
+	var filters []outputFilter
+	for {
+		if _, err := goparser.ParseExpr(string(stmt)); err == nil {
+			return filters, stmt, nil
+		}
+		name := ""
+		for _, filterName := range []string{"trimset", "trim"} {
+			if bytes.HasPrefix(stmt, []byte(filterName)) && len(stmt) > len(filterName) && isSpace(stmt[len(filterName)]) {
+				name = filterName
+				break
+			}
+		}
+		if len(name) == 0 {
+			return filters, stmt, nil
+		}
+		stmt = stripLeadingSpace(stmt[len(name):])
+		f := outputFilter{name: name}
+		if name == "trimset" {
+			cutset, n, err := scanStringLit(stmt)
+			if err != nil {
+				return nil, nil, errorf(KindInvalidCode, "trimset filter must be followed by string literal with chars to trim: %s", err)
+			}
+			if n == len(stmt) || !isSpace(stmt[n]) {
+				return nil, nil, errorf(KindInvalidCode, "missing value after trimset %s filter", cutset)
+			}
+			f.cutset = cutset
+			stmt = stripLeadingSpace(stmt[n:])
+		}
+		filters = append(filters, f)
+	}
+}
+
+// splitNumberSep splits the leading string literal with the thousands
+// separator from dn tag value, i.e. `"." n` is split into "." and n.
+//
+// The string literal followed by whitespace is always the separator,
+// since integer values cannot start with it. So `"." -n` is split
+// into "." and -n instead of being parsed as binary expression.
+func splitNumberSep(stmt []byte) (string, []byte) {
+	sep, n, err := scanStringLit(stmt)
+	if err != nil || n == len(stmt) || !isSpace(stmt[n]) {
+		// The value is validated later.
+		return "", stmt
+	}
+	return sep, stripLeadingSpace(stmt[n:])
+}
+
+// scanStringLit returns the string literal at the start of b
+// and its length in bytes.
+func scanStringLit(b []byte) (string, int, error) {
+	fset := gotoken.NewFileSet()
+	f := fset.AddFile("", -1, len(b))
+	var sc goscanner.Scanner
+	sc.Init(f, b, nil, 0)
+	pos, tok, lit := sc.Scan()
+	if tok != gotoken.STRING {
+		return "", 0, errorf(KindUnexpectedToken, "unexpected token %q", lit)
+	}
+	return lit, f.Offset(pos) + len(lit), nil
+}
+
+// isStringOutputTag returns true if the output tag writes strings
+// or byte slices.
+func isStringOutputTag(tagNameStr string) bool {
+	switch strings.TrimSuffix(tagNameStr, "=") {
+	case "s", "q", "j", "u", "a", "js", "x", "css",
+		"z", "sz", "qz", "jz", "uz", "az", "xz":
+		return true
+	}
+	return false
+}
+
+// applyOutputFilters wraps the value into calls of the runtime helpers
+// for the given filters.
+//
+// isBytes must be set if the value is a byte slice.
+func applyOutputFilters(filters []outputFilter, value string, isBytes bool) string {
+	suffix := ""
+	if isBytes {
+		suffix = "Z"
+	}
+	for i := len(filters) - 1; i >= 0; i-- {
+		f := filters[i]
+		switch f.name {
+		case "trim":
+			value = fmt.Sprintf("qt%s.Trim%s(%s)", mangleSuffix, suffix, value)
+		case "trimset":
+			value = fmt.Sprintf("qt%s.TrimSet%s(%s, %s)", mangleSuffix, suffix, value, f.cutset)
+		case "stringer":
+			value = stringerCall(value)
+		default:
+			panic(fmt.Sprintf("BUG: unexpected output filter %q", f.name))
+		}
+	}
+	return value
+}
+
+// stringerCall returns String() call on the given value.
+//
+// The value is wrapped into parens unless it is an operand
+// such as x, x.y, f() or a[i].
+func stringerCall(value string) string {
+	expr, err := goparser.ParseExpr(value)
+	if err == nil {
+		switch expr.(type) {
+		case *ast.Ident, *ast.SelectorExpr, *ast.CallExpr, *ast.IndexExpr, *ast.ParenExpr:
+			return value + ".String()"
+		}
+	}
+	return "(" + value + ").String()"
+}
+
+// parseSafeDerefOutputTag parses output tag with '?' modifier.
+//
+// The tag value must be a chain of field selectors such as a.b.c.
+// Nothing is written if any intermediate value in the chain is nil.
+func (p *parser) parseSafeDerefOutputTag(tagNameStr string, prec int, stringer bool) error {
+	s := p.s
+	t, err := expectTagContents(s)
+	if err != nil {
+		return err
+	}
+	stmt := t.Value
+	if strings.TrimSuffix(tagNameStr, "=") == "dn" {
+		_, stmt = splitNumberSep(stmt)
+	}
+	guard, err := selectorChainGuard(stmt)
+	if err != nil {
+		return errorf(KindInvalidCode, "invalid value for safe dereference at %s: %s", s.Context(), err)
+	}
+	p.Printf("if %s {", guard)
+	p.prefix += "\t"
+	s.Rewind()
+	if err = p.parseOutputTag(tagNameStr, prec, stringer); err != nil {
+		return err
+	}
+	if err := p.unindent(); err != nil {
+		return err
+	}
+	p.Printf("}")
+	return nil
+}
+
+// selectorChainGuard returns a condition checking that all the intermediate
+// values in the selector chain such as a.b.c are non-nil.
+func selectorChainGuard(stmt []byte) (string, error) {
+	exprStr := string(stmt)
+	expr, err := goparser.ParseExpr(exprStr)
+	if err != nil {
+		return "", err
+	}
+	var intermediates []string
+	for {
+		switch x := expr.(type) {
+		case *ast.SelectorExpr:
+			expr = x.X
+			intermediates = append(intermediates, exprStr[x.X.Pos()-1:x.X.End()-1])
+			continue
+		case *ast.Ident:
+			if len(intermediates) == 0 {
+				return "", errorf(KindInvalidCode, "expecting field selector, found identifier %q", x.Name)
+			}
+		default:
+			return "", errorf(KindInvalidCode, "only field selectors are supported, found %T", x)
+		}
+		break
+	}
+	var conds []string
+	for i := len(intermediates) - 1; i >= 0; i-- {
+		conds = append(conds, intermediates[i]+" != nil")
+	}
+	return strings.Join(conds, " && "), nil
+}
+
+// splitTernary splits the output tag value in the form `cond ? a : b`
+// into cond, a and b.
+//
+// Only a single '?' and ':' pair outside parens, brackets and braces
+// is recognized, so literals and composite values such as `"a?b"`
+// or `m[k:]` are left as is. nil cond is returned if stmt isn't
+// a ternary expression.
+func splitTernary(stmt []byte) ([]byte, []byte, []byte, error) {
+	fset := gotoken.NewFileSet()
+	f := fset.AddFile("", -1, len(stmt))
+	var sc goscanner.Scanner
+	sc.Init(f, stmt, nil, 0)
+	depth := 0
+	question, colon := -1, -1
+	for {
+		pos, tok, lit := sc.Scan()
+		if tok == gotoken.EOF {
+			break
+		}
+		switch tok {
+		case gotoken.LPAREN, gotoken.LBRACK, gotoken.LBRACE:
+			depth++
+		case gotoken.RPAREN, gotoken.RBRACK, gotoken.RBRACE:
+			depth--
+		case gotoken.ILLEGAL:
+			if lit != "?" || depth > 0 {
+				continue
+			}
+			if question >= 0 {
+				return nil, nil, nil, errorf(KindInvalidCode, "only a single '?' is allowed outside parens")
+			}
+			question = f.Offset(pos)
+		case gotoken.COLON:
+			if question < 0 || depth > 0 {
+				continue
+			}
+			if colon >= 0 {
+				return nil, nil, nil, errorf(KindInvalidCode, "only a single ':' is allowed after '?' outside parens")
+			}
+			colon = f.Offset(pos)
+		}
+	}
+	if question < 0 {
+		return nil, nil, nil, nil
+	}
+	if colon < 0 {
+		return nil, nil, nil, errorf(KindInvalidCode, "missing ':' after '?'")
+	}
+	cond := bytes.TrimSpace(stmt[:question])
+	a := bytes.TrimSpace(stmt[question+1 : colon])
+	b := bytes.TrimSpace(stmt[colon+1:])
+	if len(cond) == 0 || len(a) == 0 || len(b) == 0 {
+		return nil, nil, nil, errorf(KindInvalidCode, "cond, a and b cannot be empty in `cond ? a : b`")
+	}
+	return cond, a, b, nil
+}
+
+// splitDiscardedResults splits output tag value in the form 'expr, _, ..., _'
+// into expr and the number of discarded results.
+//
+// Zero discarded results are returned if the value doesn't have such form.
+func splitDiscardedResults(stmt []byte) (string, int, error) {
+	exprStr := fmt.Sprintf("f(%s)", stmt)
+	expr, err := goparser.ParseExpr(exprStr)
+	if err != nil {
+		return "", 0, nil
+	}
+	ce, ok := expr.(*ast.CallExpr)
+	if !ok || len(ce.Args) < 2 || ce.Ellipsis.IsValid() {
+		return "", 0, nil
+	}
+	for _, arg := range ce.Args[1:] {
+		id, ok := arg.(*ast.Ident)
+		if !ok || id.Name != "_" {
+			return "", 0, nil
+		}
+	}
+	first := ce.Args[0]
+	if id, ok := first.(*ast.Ident); ok && id.Name == "_" {
+		return "", 0, errorf(KindInvalidCode, "the first value cannot be discarded")
+	}
+	return exprStr[first.Pos()-1 : first.End()-1], len(ce.Args) - 1, nil
+}
+
+func (p *parser) parseOutputFunc(tagNameStr string) error {
+	s := p.s
+	t, err := expectTagContents(s)
+	if err != nil {
+		return err
+	}
+	if len(bytes.TrimSpace(t.Value)) == 0 {
+		return errorf(KindEmptyExpression, "empty expression in %s tag at %s", tagNameStr, s.Context())
+	}
+	if tagNameStr == "=" {
+		ok, err := p.tryInlineFuncCall(t.Value)
+		if err != nil {
+			return errorf(KindInvalidCode, "error at %s: %w", s.Context(), err)
+		}
+		if ok {
+			return nil
+		}
+	}
+	callWrite, callStream, errResult, err := p.parseOutputFuncCall(t.Value)
+	if err != nil {
+		return errorf(KindInvalidCode, "error at %s: %w", s.Context(), err)
+	}
+	if errResult {
+		if !p.errResultFunc {
+			return errorf(KindMisplacedTag, "cannot call %q defined with err modifier from func without err modifier, since the returned error would be lost at %s", t.Value, s.Context())
+		}
+		if p.cdataDepth > 0 {
+			return errorf(KindMisplacedTag, "cannot call %q defined with err modifier inside cdata block at %s", t.Value, s.Context())
+		}
+	}
+	filter := "N"
+	tagNameStr = tagNameStr[1:]
+	if strings.HasSuffix(tagNameStr, "h") {
+		tagNameStr = tagNameStr[:len(tagNameStr)-1]
+		switch tagNameStr {
+		case "", "q", "j":
+			filter = "E"
+		}
+	}
+
+	if len(tagNameStr) > 0 || filter == "E" {
+		tagNameStr = strings.ToUpper(tagNameStr)
+		p.Printf("{")
+		p.Printf("qb%s := qt%s.AcquireByteBuffer()", mangleSuffix, mangleSuffix)
+		if errResult {
+			p.Printf("if qe%s := %s; qe%s != nil {", mangleSuffix, callWrite("qb"+mangleSuffix), mangleSuffix)
+			p.Printf("\tqt%s.ReleaseByteBuffer(qb%s)", mangleSuffix, mangleSuffix)
+			p.Printf("\treturn qe%s", mangleSuffix)
+			p.Printf("}")
+		} else {
+			p.Printf("%s", callWrite("qb"+mangleSuffix))
+		}
+		p.Printf("%s.%s().%sZ(qb%s.B)", p.writerVar, filter, tagNameStr, mangleSuffix)
+		p.Printf("qt%s.ReleaseByteBuffer(qb%s)", mangleSuffix, mangleSuffix)
+		p.Printf("}")
+	} else if errResult {
+		p.Printf("if qe%s := %s; qe%s != nil {", mangleSuffix, callStream(p.writerVar), mangleSuffix)
+		p.Printf("\treturn qe%s", mangleSuffix)
+		p.Printf("}")
+	} else {
+		p.Printf("%s", callStream(p.writerVar))
+	}
+
+	return nil
+}
+
+// inlineFunc is the func defined with inline modifier.
+type inlineFunc struct {
+	args []funcArg
+
+	// body is the template source of the func body.
+	body []byte
+
+	// filePath and line point to the start of the body.
+	filePath string
+	line     int
+
+	escapeMode string
+
+	// whitespace control depths at the start of the body.
+	collapseSpaceDepth int
+	stripSpaceDepth    int
+	stripNewlinesDepth int
+}
+
+// startInlineFunc starts recording the body of the func f
+// with inline modifier.
+func (p *parser) startInlineFunc(f *funcType) *inlineFunc {
+	s := p.s
+	s.startRecord()
+	p.inlineFunc = true
+	return &inlineFunc{
+		args:               f.argList(),
+		filePath:           s.filePath,
+		line:               s.line,
+		escapeMode:         f.escapeMode,
+		collapseSpaceDepth: s.collapseSpaceDepth,
+		stripSpaceDepth:    s.stripSpaceDepth,
+		stripNewlinesDepth: s.stripNewlinesDepth,
+	}
+}
+
+// endInlineFunc registers inl for expanding the following calls to f.
+func (p *parser) endInlineFunc(f *funcType, inl *inlineFunc) {
+	inl.body = p.s.stopRecord()
+	p.inlineFunc = false
+	if p.inlineFuncs == nil {
+		p.inlineFuncs = make(map[string]*inlineFunc)
+	}
+	p.inlineFuncs[f.name] = inl
+}
+
+// tryInlineFuncCall expands {%= F(...) %} call to the func F defined
+// with inline modifier into the body of F.
+//
+// The body is enclosed into a block, where args are bound to local
+// variables, so the output matches the output of the func call.
+// false is returned if the call cannot be expanded. Then the ordinary
+// func call must be emitted.
+func (p *parser) tryInlineFuncCall(b []byte) (bool, error) {
+	if len(p.inlineFuncs) == 0 {
+		return false, nil
+	}
+	exprStr := string(b)
+	expr, err := goparser.ParseExpr(exprStr)
+	if err != nil {
+		// The error is reported when parsing the ordinary call.
+		return false, nil
+	}
+	ce, ok := expr.(*ast.CallExpr)
+	if !ok || ce.Ellipsis.IsValid() {
+		return false, nil
+	}
+	id, ok := ce.Fun.(*ast.Ident)
+	if !ok || p.isDeclared(id.Name) {
+		return false, nil
+	}
+	inl := p.inlineFuncs[id.Name]
+	if inl == nil || len(ce.Args) != len(inl.args) {
+		return false, nil
+	}
+	// Args are bound one by one, so the arg value mustn't refer
+	// to the args bound before it.
+	for i, arg := range ce.Args {
+		if refersInlineArgs(arg, inl.args[:i]) {
+			return false, nil
+		}
+	}
+
+	p.Printf("{")
+	p.prefix += "\t"
+	p.pushScope()
+	for i, arg := range inl.args {
+		p.Printf("var %s %s = %s", arg.name, arg.typ, exprStr[ce.Args[i].Pos()-1:ce.Args[i].End()-1])
+		p.Printf("_ = %s", arg.name)
+		p.declare(arg.name)
+	}
+
+	// break and continue mustn't cross the func boundary.
+	s := p.s
+	forDepth, switchDepth, loops := p.forDepth, p.switchDepth, p.loops
+	p.forDepth, p.switchDepth, p.loops = 0, 0, nil
+	escapeMode, ctxFunc, errResultFunc := p.escapeMode, p.ctxFunc, p.errResultFunc
+	p.escapeMode, p.ctxFunc, p.errResultFunc = inl.escapeMode, false, false
+
+	p.s = newScannerDelims(bytes.NewReader(inl.body), inl.filePath, s.tagOpen, s.tagClose)
+	p.s.line = inl.line
+	p.s.mustacheTag = s.mustacheTag
+	p.s.collapseSpaceDepth = inl.collapseSpaceDepth
+	p.s.stripSpaceDepth = inl.stripSpaceDepth
+	p.s.stripNewlinesDepth = inl.stripNewlinesDepth
+	if p.preserveComments {
+		p.s.onComment = p.emitTemplateComment
+	}
+	err = p.parseIncludedFile()
+	if err != nil {
+		// The position in the nested scanner isn't reported otherwise.
+		err = newParseError(p.s, err)
+	}
+	p.s = s
+	p.forDepth, p.switchDepth, p.loops = forDepth, switchDepth, loops
+	p.escapeMode, p.ctxFunc, p.errResultFunc = escapeMode, ctxFunc, errResultFunc
+	if err != nil {
+		return false, fmt.Errorf("cannot inline %q: %w", b, err)
+	}
+
+	p.popScope()
+	if err := p.unindent(); err != nil {
+		return false, err
+	}
+	p.Printf("}")
+	return true, nil
+}
+
+// refersInlineArgs returns true if expr refers to any of args.
+func refersInlineArgs(expr ast.Expr, args []funcArg) bool {
+	found := false
+	ast.Inspect(expr, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok {
+			for _, arg := range args {
+				if id.Name == arg.name {
+					found = true
+				}
+			}
+		}
+		return !found
+	})
+	return found
+}
+
+// parseOutputFuncCall returns funcs generating the call of the template func
+// or the func value from {%= %} tag contents for the given writer.
+//
+// The ctx arg is passed to ctx funcs called from inside ctx funcs.
+// errResult is set if the called func is defined with err modifier
+// in the template file.
+func (p *parser) parseOutputFuncCall(b []byte) (callWrite, callStream func(dst string) string, errResult bool, err error) {
+	name, ok, err := parseFuncValue(b)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	if ok {
+		callWrite = func(dst string) string {
+			return fmt.Sprintf("%s(%s)", name, dst)
+		}
+		callStream = func(dst string) string {
+			return fmt.Sprintf("%s(%s.N())", name, dst)
+		}
+		return callWrite, callStream, false, nil
+	}
+	f, err := parseFuncCall(b)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	if p.ctxFunc && len(f.callPrefix) == 0 && p.ctxFuncs[f.name] {
+		f.argNames = ", ctx" + f.argNames
+	}
+	errResult = len(f.callPrefix) == 0 && p.errResultFuncs[f.name]
+	return f.CallWrite, f.CallStream, errResult, nil
+}
+
+func (p *parser) emitText(text []byte) {
+	if p.spacelessDepth == 0 {
+		p.emitRawText(text)
+		return
+	}
+	text, space := p.spacelessText(text)
+	p.emitRawText(text)
+	p.spacelessSpace = space
+}
+
+// emitRawText emits the text as is.
+func (p *parser) emitRawText(text []byte) {
+	for len(text) > 0 {
+		n := bytes.IndexByte(text, '`')
+		if n < 0 {
+			p.Printf("%s.N().S(`%s`)", p.writerVar, text)
+			return
+		}
+		p.Printf("%s.N().S(`%s`)", p.writerVar, text[:n])
+		p.Printf("%s.N().S(\"`\")", p.writerVar)
+		text = text[n+1:]
+	}
+}
+
+func (p *parser) emitFuncStart(f *funcType) {
+	p.emitFuncDoc()
+	p.Printf("func %s {", f.DefStream(p.writerVar))
+	p.prefix = "\t"
+}
+
+func (p *parser) emitFuncEnd(f *funcType) {
+	if f.errResult && !p.funcReturned {
+		p.Printf("return nil")
+	}
+	p.prefix = ""
+	p.Printf("}\n")
+	if f.writerTo {
+		p.emitFuncWriterTo(f)
+	}
+	if f.streamOnly {
+		p.emitFuncDefaults(f)
+		return
+	}
+	if f.errResult {
+		p.emitFuncEndErrResult(f)
+		return
+	}
+
+	p.emitFuncDoc()
+	p.Printf("func %s {", f.DefWrite(p.writerArg))
+	p.prefix = "\t"
+	p.Printf("%s := qt%s.AcquireWriter(%s)", p.writerVar, mangleSuffix, p.writerArg)
+	p.Printf("%s", f.CallStream(p.writerVar))
+	p.Printf("qt%s.ReleaseWriter(%s)", mangleSuffix, p.writerVar)
+	p.prefix = ""
+	p.Printf("}\n")
+
+	p.emitFuncDoc()
+	p.Printf("func %s {", f.DefString())
+	p.prefix = "\t"
+	p.emitAcquireStringBuffer(f)
+	p.Printf("%s", f.CallWrite("qb"+mangleSuffix))
+	p.Printf("qs%s := string(qb%s.B)", mangleSuffix, mangleSuffix)
+	p.Printf("qt%s.ReleaseByteBuffer(qb%s)", mangleSuffix, mangleSuffix)
+	p.Printf("return qs%s", mangleSuffix)
+	p.prefix = ""
+	p.Printf("}\n")
+
+	if p.appendFuncs {
+		p.emitFuncAppend(f)
+	}
+	if p.errFuncs {
+		p.emitFuncWriteErr(f)
+	}
+	p.emitFuncDefaults(f)
+}
+
+// emitAcquireStringBuffer emits acquiring the buffer for the string func
+// output. The buffer is pre-sized if f has the size hint.
+func (p *parser) emitAcquireStringBuffer(f *funcType) {
+	if f.sizeHint > 0 {
+		p.Printf("qb%s := qt%s.AcquireByteBufferSize(%d)", mangleSuffix, mangleSuffix, f.sizeHint)
+		return
+	}
+	p.Printf("qb%s := qt%s.AcquireByteBuffer()", mangleSuffix, mangleSuffix)
+}
+
+// emitFuncEndErrResult emits the write and string funcs for the func
+// with err modifier.
+//
+// The write func returns the error returned by the stream func or the first
+// write error. The string func returns an empty string on error.
+// Append and error-returning write funcs aren't emitted for such funcs.
+func (p *parser) emitFuncEndErrResult(f *funcType) {
+	p.emitFuncDoc()
+	p.Printf("func %s {", f.DefWrite(p.writerArg))
+	p.prefix = "\t"
+	p.Printf("%s := qt%s.AcquireWriter(%s)", p.writerVar, mangleSuffix, p.writerArg)
+	p.Printf("qe%s := %s", mangleSuffix, f.CallStream(p.writerVar))
+	p.Printf("if qe%s == nil {", mangleSuffix)
+	p.Printf("\tqe%s = %s.Err()", mangleSuffix, p.writerVar)
+	p.Printf("}")
+	p.Printf("qt%s.ReleaseWriter(%s)", mangleSuffix, p.writerVar)
+	p.Printf("return qe%s", mangleSuffix)
+	p.prefix = ""
+	p.Printf("}\n")
+
+	p.emitFuncDoc()
+	p.Printf("func %s {", f.DefString())
+	p.prefix = "\t"
+	p.emitAcquireStringBuffer(f)
+	p.Printf("if qe%s := %s; qe%s != nil {", mangleSuffix, f.CallWrite("qb"+mangleSuffix), mangleSuffix)
+	p.Printf("\tqt%s.ReleaseByteBuffer(qb%s)", mangleSuffix, mangleSuffix)
+	p.Printf("\treturn \"\", qe%s", mangleSuffix)
+	p.Printf("}")
+	p.Printf("qs%s := string(qb%s.B)", mangleSuffix, mangleSuffix)
+	p.Printf("qt%s.ReleaseByteBuffer(qb%s)", mangleSuffix, mangleSuffix)
+	p.Printf("return qs%s, nil", mangleSuffix)
+	p.prefix = ""
+	p.Printf("}\n")
+
+	p.emitFuncDefaults(f)
+}
+
+// emitFuncDefaults emits the funcs calling f with default values
+// for the trailing args if f has args with default values.
+//
+// Only the stream, write and string funcs are emitted.
+func (p *parser) emitFuncDefaults(f *funcType) {
+	df := f.defaultsFunc()
+	if df == nil {
+		return
+	}
+	cf := f.withDefaults()
+	ret := ""
+	if f.errResult {
+		ret = "return "
+	}
+	emitDoc := func(name string) {
+		if p.skipOutputDepth == 0 {
+			fmt.Fprintf(p.w, "// %s calls %s with default values for the omitted args.\n", name, strings.TrimSuffix(name, "Defaults"))
+		}
+	}
+
+	emitDoc(df.prefixStream() + df.name)
+	p.Printf("func %s {", df.DefStream(p.writerVar))
+	p.prefix = "\t"
+	p.Printf("%s%s", ret, cf.CallStream(p.writerVar))
+	p.prefix = ""
+	p.Printf("}\n")
+	if f.streamOnly {
+		return
+	}
+
+	emitDoc(df.prefixWrite() + df.name)
+	p.Printf("func %s {", df.DefWrite(p.writerArg))
+	p.prefix = "\t"
+	p.Printf("%s%s", ret, cf.CallWrite(p.writerArg))
+	p.prefix = ""
+	p.Printf("}\n")
+
+	emitDoc(df.name)
+	p.Printf("func %s {", df.DefString())
+	p.prefix = "\t"
+	p.Printf("return %s", cf.CallString())
+	p.prefix = ""
+	p.Printf("}\n")
+}
+
+// emitFuncWriterTo emits the type implementing io.WriterTo for the func
+// with writerto modifier.
+//
+// The type captures the func args, so the output may be written later
+// by io.Copy and other APIs accepting io.WriterTo.
+func (p *parser) emitFuncWriterTo(f *funcType) {
+	typeName := f.writerToName()
+	args := f.argList()
+	emitDoc := func(format string, args ...interface{}) {
+		if p.skipOutputDepth == 0 {
+			fmt.Fprintf(p.w, "// "+format+"\n", args...)
+		}
+	}
+
+	emitDoc("%s writes the output of %s called with the captured args.", typeName, f.name)
+	p.Printf("type %s struct {", typeName)
+	for _, arg := range args {
+		typ := arg.typ
+		if strings.HasPrefix(typ, "...") {
+			typ = "[]" + typ[len("..."):]
+		}
+		p.Printf("\t%s %s", arg.name, typ)
+	}
+	p.Printf("}\n")
+
+	emitDoc("%s returns %s capturing the given args.", f.newWriterToName(), typeName)
+	p.Printf("func %s(%s) %s {", f.newWriterToName(), strings.TrimPrefix(f.args, ", "), typeName)
+	p.prefix = "\t"
+	p.Printf("return %s{", typeName)
+	for _, arg := range args {
+		p.Printf("\t%s: %s,", arg.name, arg.name)
+	}
+	p.Printf("}")
+	p.prefix = ""
+	p.Printf("}\n")
+
+	recv := "qa" + mangleSuffix
+	callArgs := make([]string, 0, len(args)+1)
+	callArgs = append(callArgs, p.writerVar)
+	for _, arg := range args {
+		a := recv + "." + arg.name
+		if strings.HasPrefix(arg.typ, "...") {
+			a += "..."
+		}
+		callArgs = append(callArgs, a)
+	}
+	call := fmt.Sprintf("%s%s(%s)", f.prefixStream(), f.name, strings.Join(callArgs, ", "))
+
+	emitDoc("WriteTo implements io.WriterTo.")
+	p.Printf("func (%s %s) WriteTo(%s qtio%s.Writer) (int64, error) {", recv, typeName, p.writerArg, mangleSuffix)
+	p.prefix = "\t"
+	p.Printf("%s := qt%s.AcquireCountingWriter(%s)", p.writerVar, mangleSuffix, p.writerArg)
+	if f.errResult {
+		p.Printf("qe%s := %s", mangleSuffix, call)
+		p.Printf("if qe%s == nil {", mangleSuffix)
+		p.Printf("\tqe%s = %s.Err()", mangleSuffix, p.writerVar)
+		p.Printf("}")
+	} else {
+		p.Printf("%s", call)
+		p.Printf("qe%s := %s.Err()", mangleSuffix, p.writerVar)
+	}
+	p.Printf("qn%s := qt%s.ReleaseCountingWriter(%s)", mangleSuffix, mangleSuffix, p.writerVar)
+	p.Printf("return qn%s, qe%s", mangleSuffix, mangleSuffix)
+	p.prefix = ""
+	p.Printf("}\n")
+}
+
+// emitFuncWriteErr emits the write func returning the first write error.
+func (p *parser) emitFuncWriteErr(f *funcType) {
+	p.emitFuncDoc()
+	p.Printf("func %s {", f.DefWriteErr(p.writerArg))
+	p.prefix = "\t"
+	p.Printf("%s := qt%s.AcquireWriter(%s)", p.writerVar, mangleSuffix, p.writerArg)
+	p.Printf("%s", f.CallStream(p.writerVar))
+	p.Printf("qe%s := %s.Err()", mangleSuffix, p.writerVar)
+	p.Printf("qt%s.ReleaseWriter(%s)", mangleSuffix, p.writerVar)
+	p.Printf("return qe%s", mangleSuffix)
+	p.prefix = ""
+	p.Printf("}\n")
+}
+
+// emitFuncAppend emits the func appending the template output to dst.
+//
+// The pooled byte buffer temporarily holds dst, so the output is written
+// directly to dst.
+func (p *parser) emitFuncAppend(f *funcType) {
+	p.emitFuncDoc()
+	p.Printf("func %s {", f.DefAppend("dst"+mangleSuffix))
+	p.prefix = "\t"
+	p.Printf("qb%s := qt%s.AcquireByteBuffer()", mangleSuffix, mangleSuffix)
+	p.Printf("qz%s := qb%s.B", mangleSuffix, mangleSuffix)
+	p.Printf("qb%s.B = dst%s", mangleSuffix, mangleSuffix)
+	p.Printf("%s", f.CallWrite("qb"+mangleSuffix))
+	p.Printf("dst%s = qb%s.B", mangleSuffix, mangleSuffix)
+	p.Printf("qb%s.B = qz%s", mangleSuffix, mangleSuffix)
+	p.Printf("qt%s.ReleaseByteBuffer(qb%s)", mangleSuffix, mangleSuffix)
+	p.Printf("return dst%s", mangleSuffix)
+	p.prefix = ""
+	p.Printf("}\n")
+}
+
+// unindent removes a single indentation level from p.prefix.
+//
+// An error is returned instead of panicking if the indentation is
+// unbalanced, since this means a bug in the parser.
+func (p *parser) unindent() error {
+	if len(p.prefix) == 0 {
+		return fmt.Errorf("BUG: unbalanced indentation in the generated code at %s", p.s.Context())
+	}
+	p.prefix = p.prefix[1:]
+	return nil
+}
+
+// Printf writes the line with the generated code to p.w.
+//
+// The format must be a constant, while the template contents such as
+// the code from {% code %} must be passed in args, i.e. p.Printf("%s", code),
+// since they may contain verbs like %s.
+func (p *parser) Printf(format string, args ...interface{}) {
+	// The whitespace held inside spaceless block is dropped
+	// if the code without output such as if or for follows it.
+	// See spacelessText for details.
+	p.spacelessSpace = nil
+	if p.skipOutputDepth > 0 {
+		return
+	}
+	w := p.w
+	fmt.Fprintf(w, "%s", p.prefix)
+	p.s.WriteLineComment(w)
+	fmt.Fprintf(w, "%s", p.prefix)
+	fmt.Fprintf(w, format, args...)
+	fmt.Fprintf(w, "\n")
+}
+
+func skipTagContents(s *scanner) error {
+	tagName := string(s.Token().Value)
+	t, err := expectTagContents(s)
+	if err != nil {
+		return err
+	}
+	if len(t.Value) > 0 {
+		return errorf(KindUnexpectedToken, "unexpected extra value after %s: %q at %s", tagName, t.Value, s.Context())
+	}
+	return err
+}
+
+func expectTagContents(s *scanner) (*token, error) {
+	return expectToken(s, tagContents)
+}
+
+func expectToken(s *scanner, id int) (*token, error) {
+	if !s.Next() {
+		err := s.LastError()
+		if err == nil {
+			// The template ends before the token.
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, fmt.Errorf("cannot find token %s: %w", tokenIDToStr(id), err)
+	}
+	t := s.Token()
+	if t.ID != id {
+		return nil, errorf(KindUnexpectedToken, "unexpected token found %s. Expecting %s at %s", t, tokenIDToStr(id), s.Context())
+	}
+	return t, nil
+}
+
+func validateOutputTagValue(stmt []byte) error {
+	exprStr := string(stmt)
+	_, err := goparser.ParseExpr(exprStr)
+	return err
+}
+
+// expandForIn expands `in` for statements into Go for statements.
+//
+// The following forms are supported:
+//
+//	i in range(end)              - i := 0; i < end; i++
+//	i in range(start, end)       - i := start; i < end; i++
+//	i in range(start, end, step) - i := start; i < end; i += step
+//	x in items                   - _, x := range items
+//	i, x in items                - i, x := range items
+//
+// The end is evaluated only once. The loop counts down if the step
+// is a negative number such as -2.
+//
+// stmt is returned as is if it doesn't have the `in` form.
+// Channel loops are expanded by expandForInChan.
+func expandForIn(stmt []byte) ([]byte, error) {
+	n := bytes.Index(stmt, []byte(" in "))
+	if n < 0 {
+		return stmt, nil
+	}
+	var names []string
+	for _, name := range strings.Split(string(stmt[:n]), ",") {
+		name = strings.TrimSpace(name)
+		if validateIdent(name) != nil && name != "_" {
+			return stmt, nil
+		}
+		names = append(names, name)
+	}
+	rangeStr := stripLeadingSpace(stmt[n+len(" in "):])
+	if !bytes.HasPrefix(rangeStr, []byte("range(")) && !bytes.HasPrefix(rangeStr, []byte("range (")) {
+		return expandForInItems(stmt, names, rangeStr)
+	}
+	if len(names) != 1 || names[0] == "_" {
+		return stmt, nil
+	}
+	return expandForInRange(names[0], rangeStr)
+}
+
+// expandForInItems expands `x in items` and `i, x in items` for statements
+// into range loop statements.
+//
+// i is the index of x in items.
+func expandForInItems(stmt []byte, names []string, items []byte) ([]byte, error) {
+	if len(names) > 2 {
+		return stmt, nil
+	}
+	if _, err := goparser.ParseExpr(string(items)); err != nil {
+		return stmt, nil
+	}
+	if len(names) == 1 {
+		names = []string{"_", names[0]}
+	}
+	return []byte(fmt.Sprintf("%s := range %s", strings.Join(names, ", "), items)), nil
+}
+
+// expandForInRange expands `i in range(...)` for statement
+// into the counted loop statement. See expandForIn for details.
+func expandForInRange(name string, rangeStr []byte) ([]byte, error) {
+	// range is a keyword, so substitute it with an identifier
+	// for parsing the args.
+	exprStr := "f" + string(rangeStr[len("range"):])
+	expr, err := goparser.ParseExpr(exprStr)
+	if err != nil {
+		return nil, errorf(KindInvalidCode, "invalid range(): %s", err)
+	}
+	ce, ok := expr.(*ast.CallExpr)
+	if ok {
+		_, ok = ce.Fun.(*ast.Ident)
+	}
+	if !ok {
+		return nil, errorf(KindUnexpectedToken, "unexpected value after range(): %q", rangeStr)
+	}
+	if ce.Ellipsis.IsValid() {
+		return nil, errorf(KindInvalidCode, "range() doesn't accept variadic args")
+	}
+	var args []string
+	for _, arg := range ce.Args {
+		args = append(args, exprStr[arg.Pos()-1:arg.End()-1])
+	}
+	start, step := "0", "1"
+	var end string
+	switch len(args) {
+	case 1:
+		end = args[0]
+	case 2:
+		start, end = args[0], args[1]
+	case 3:
+		start, end, step = args[0], args[1], args[2]
+	default:
+		return nil, errorf(KindInvalidCode, "range() accepts from 1 to 3 args; got %d args", len(args))
+	}
+
+	cmp, incr := "<", "++"
+	if step != "1" {
+		incr = " += " + step
+		if v, err := strconv.ParseInt(step, 0, 64); err == nil {
+			switch {
+			case v == 0:
+				return nil, errorf(KindInvalidCode, "range() step cannot be zero")
+			case v < 0:
+				cmp = ">"
+			}
+		}
+	}
+	endVar := "qend" + mangleSuffix
+	return []byte(fmt.Sprintf("%s, %s := %s, %s; %s %s %s; %s%s", name, endVar, start, end, name, cmp, endVar, name, incr)), nil
+}
+
+// expandForInChanIdent expands `x in ch` and `x in ch while ctx`
+// for statements into `x in <-ch` if ch is known to be a channel,
+// since `for _, x := range ch` doesn't compile for channels.
+func (p *parser) expandForInChanIdent(stmt []byte) []byte {
+	n := bytes.Index(stmt, []byte(" in "))
+	if n < 0 {
+		return stmt
+	}
+	chStr, _, _ := splitForWhile(stmt[n+len(" in "):])
+	if !p.isChanIdent(string(bytes.TrimSpace(chStr))) {
+		return stmt
+	}
+	var bb bytes.Buffer
+	bb.Write(stmt[:n+len(" in ")])
+	bb.WriteString("<-")
+	bb.Write(stripLeadingSpace(stmt[n+len(" in "):]))
+	return bb.Bytes()
+}
+
+// expandForInChan expands `x in <-ch` and `x in <-ch while ctx`
+// for statements into range loops over the channel ch.
+//
+// The loop with `while ctx` stops when ctx is done.
+//
+// isChan is false if stmt isn't a channel loop.
+func expandForInChan(stmt []byte) ([]byte, bool, error) {
+	n := bytes.Index(stmt, []byte(" in "))
+	if n < 0 {
+		return stmt, false, nil
+	}
+	name := string(bytes.TrimSpace(stmt[:n]))
+	chStr, ctxStr, hasCtx := splitForWhile(stmt[n+len(" in "):])
+	chStr = stripLeadingSpace(chStr)
+	if !bytes.HasPrefix(chStr, []byte("<-")) {
+		if hasCtx {
+			return nil, false, errorf(KindInvalidCode, "while may be used only in channel loops such as `x in <-ch while ctx`")
+		}
+		return stmt, false, nil
+	}
+	if !gotoken.IsIdentifier(name) {
+		return nil, false, errorf(KindInvalidCode, "channel loop accepts a single variable; got %q", name)
+	}
+	if err := validateIdent(name); err != nil {
+		return nil, false, err
+	}
+	chStr = bytes.TrimSpace(chStr[len("<-"):])
+	if len(chStr) == 0 {
+		return nil, false, errorf(KindEmptyExpression, "missing channel after <-")
+	}
+	if _, err := goparser.ParseExpr(string(chStr)); err != nil {
+		return nil, false, errorf(KindInvalidCode, "invalid channel %q: %s", chStr, err)
+	}
+	if !hasCtx {
+		return []byte(fmt.Sprintf("%s := range %s", name, chStr)), true, nil
+	}
+	if len(ctxStr) == 0 {
+		return nil, false, errorf(KindEmptyExpression, "missing context after while")
+	}
+	if _, err := goparser.ParseExpr(string(ctxStr)); err != nil {
+		return nil, false, errorf(KindInvalidCode, "invalid context %q: %s", ctxStr, err)
+	}
+	return []byte(fmt.Sprintf("%s := range qt%s.RecvContext(%s, %s)", name, mangleSuffix, ctxStr, chStr)), true, nil
+}
+
+// splitForWhile splits s in the form `ch while ctx` into ch and ctx.
+//
+// hasCtx is false if s has no top-level while.
+func splitForWhile(s []byte) ([]byte, []byte, bool) {
+	fset := gotoken.NewFileSet()
+	f := fset.AddFile("", -1, len(s))
+	var sc goscanner.Scanner
+	sc.Init(f, s, nil, 0)
+	depth := 0
+	for {
+		pos, tok, lit := sc.Scan()
+		switch tok {
+		case gotoken.EOF:
+			return s, nil, false
+		case gotoken.LPAREN, gotoken.LBRACK, gotoken.LBRACE:
+			depth++
+		case gotoken.RPAREN, gotoken.RBRACK, gotoken.RBRACE:
+			depth--
+		case gotoken.IDENT:
+			if depth > 0 || lit != "while" {
+				continue
+			}
+			n := f.Offset(pos)
+			return stripTrailingSpace(s[:n]), bytes.TrimSpace(s[n+len("while"):]), true
+		}
+	}
+}
+
+// splitForGuard splits the for statement in the form `stmt if guard`
+// into stmt and guard.
+//
+// Iterations with false guard are skipped. nil guard is returned
+// if the statement has no guard.
+func splitForGuard(stmt []byte) ([]byte, []byte, error) {
+	fset := gotoken.NewFileSet()
+	f := fset.AddFile("", -1, len(stmt))
+	var sc goscanner.Scanner
+	sc.Init(f, stmt, nil, 0)
+	depth := 0
+	for {
+		pos, tok, _ := sc.Scan()
+		switch tok {
+		case gotoken.EOF:
+			return stmt, nil, nil
+		case gotoken.LPAREN, gotoken.LBRACK, gotoken.LBRACE:
+			depth++
+		case gotoken.RPAREN, gotoken.RBRACK, gotoken.RBRACE:
+			depth--
+		case gotoken.IF:
+			if depth > 0 {
+				continue
+			}
+			n := f.Offset(pos)
+			stmt, guard := stripTrailingSpace(stmt[:n]), bytes.TrimSpace(stmt[n+len("if"):])
+			if len(stmt) == 0 {
+				return nil, nil, errorf(KindInvalidCode, "missing loop statement before if")
+			}
+			if err := validateForGuard(guard); err != nil {
+				return nil, nil, err
+			}
+			return stmt, guard, nil
+		}
+	}
+}
+
+// validateForGuard verifies whether the guard is a boolean expression.
+//
+// Only expressions, which cannot be boolean, are rejected here.
+// The remaining type errors are caught by Go compiler.
+func validateForGuard(guard []byte) error {
+	if len(guard) == 0 {
+		return errorf(KindEmptyExpression, "missing condition after if")
+	}
+	expr, err := goparser.ParseExpr(string(guard))
+	if err != nil {
+		return errorf(KindInvalidCode, "invalid condition %q: %s", guard, err)
+	}
+	for {
+		x, ok := expr.(*ast.ParenExpr)
+		if !ok {
+			break
+		}
+		expr = x.X
+	}
+	isBool := true
+	switch x := expr.(type) {
+	case *ast.BasicLit, *ast.CompositeLit, *ast.FuncLit, *ast.SliceExpr:
+		isBool = false
+	case *ast.UnaryExpr:
+		isBool = x.Op == gotoken.NOT || x.Op == gotoken.ARROW
+	case *ast.BinaryExpr:
+		switch x.Op {
+		case gotoken.LAND, gotoken.LOR, gotoken.EQL, gotoken.NEQ, gotoken.LSS, gotoken.LEQ, gotoken.GTR, gotoken.GEQ:
+		default:
+			isBool = false
+		}
+	}
+	if !isBool {
+		return errorf(KindInvalidCode, "condition %q must be a boolean expression", guard)
+	}
+	return nil
+}
+
+func validateForStmt(stmt []byte) error {
+	exprStr := fmt.Sprintf("func () { for %s {} }", stmt)
+	_, err := goparser.ParseExpr(exprStr)
+	return err
+}
+
+// rangeExprBounds returns the bounds of the range expression in the for
+// statement such as `i, x := range items`.
+//
+// ok is false if stmt isn't a range loop.
+func rangeExprBounds(stmt []byte) (int, int, bool) {
+	prefix := "func () { for "
+	exprStr := fmt.Sprintf("%s%s {} }", prefix, stmt)
+	expr, err := goparser.ParseExpr(exprStr)
+	if err != nil {
+		return 0, 0, false
+	}
+	fl, ok := expr.(*ast.FuncLit)
+	if !ok || len(fl.Body.List) != 1 {
+		return 0, 0, false
+	}
+	rs, ok := fl.Body.List[0].(*ast.RangeStmt)
+	if !ok {
+		return 0, 0, false
+	}
+	return int(rs.X.Pos()) - 1 - len(prefix), int(rs.X.End()) - 1 - len(prefix), true
+}
+
+// isIntRangeExpr returns true if the range expression is known to be
+// an integer without type info, so the loop iterates over the integer.
+func isIntRangeExpr(exprStr []byte) bool {
+	expr, err := goparser.ParseExpr(string(exprStr))
+	if err != nil {
+		return false
+	}
+	return isIntExpr(expr)
+}
+
+// isIntExpr returns true if expr is an integer literal, len() or cap() call,
+// conversion to integer type or arithmetic expression with such operands.
+//
+// Integer variables aren't detected, since their types are unknown
+// to the parser. They may be converted to int explicitly, i.e. int(n).
+func isIntExpr(expr ast.Expr) bool {
+	switch x := expr.(type) {
+	case *ast.BasicLit:
+		return x.Kind == gotoken.INT
+	case *ast.CallExpr:
+		id, ok := x.Fun.(*ast.Ident)
+		return ok && intFuncs[id.Name]
+	case *ast.ParenExpr:
+		return isIntExpr(x.X)
+	case *ast.UnaryExpr:
+		switch x.Op {
+		case gotoken.ADD, gotoken.SUB, gotoken.XOR:
+			return isIntExpr(x.X)
+		}
+		return false
+	case *ast.BinaryExpr:
+		switch x.Op {
+		case gotoken.ADD, gotoken.SUB, gotoken.MUL, gotoken.QUO, gotoken.REM,
+			gotoken.AND, gotoken.OR, gotoken.XOR, gotoken.AND_NOT:
+			// Both operands have the same type in Go.
+			return isIntExpr(x.X) || isIntExpr(x.Y)
+		case gotoken.SHL, gotoken.SHR:
+			return isIntExpr(x.X)
+		}
+		return false
+	default:
+		return false
+	}
+}
+
+// intFuncs contains builtin funcs and conversions returning integers.
+var intFuncs = map[string]bool{
+	"len":     true,
+	"cap":     true,
+	"int":     true,
+	"int8":    true,
+	"int16":   true,
+	"int32":   true,
+	"int64":   true,
+	"uint":    true,
+	"uint8":   true,
+	"uint16":  true,
+	"uint32":  true,
+	"uint64":  true,
+	"uintptr": true,
+	"byte":    true,
+	"rune":    true,
+}
+
+// refersLoopVar returns true if the generated code of the loop body
+// refers loop variable of the loop.
+//
+// References to loop variables declared inside the body such as
+// the loop state of nested loops are ignored.
+func refersLoopVar(code []byte) bool {
+	// The code ends with the closing brace of the loop.
+	codeStr := fmt.Sprintf("package foo\nfunc _() {\nfor {\n%s\n}", code)
+	fset := gotoken.NewFileSet()
+	f, err := goparser.ParseFile(fset, "", codeStr, 0)
+	if err != nil {
+		return refersLoopIdent(code)
+	}
+	found := false
+	ast.Inspect(f, func(n ast.Node) bool {
+		switch x := n.(type) {
+		case *ast.SelectorExpr:
+			ast.Inspect(x.X, func(n ast.Node) bool {
+				id, ok := n.(*ast.Ident)
+				found = found || (ok && id.Name == "loop" && id.Obj == nil)
+				return !found
+			})
+			return false
+		case *ast.Ident:
+			found = found || (x.Name == "loop" && x.Obj == nil)
+		}
+		return !found
+	})
+	return found
+}
+
+// refersLoopIdent returns true if the code contains loop identifier.
+func refersLoopIdent(code []byte) bool {
+	fset := gotoken.NewFileSet()
+	f := fset.AddFile("", -1, len(code))
+	var sc goscanner.Scanner
+	sc.Init(f, code, nil, 0)
+	prevTok := gotoken.ILLEGAL
+	for {
+		_, tok, lit := sc.Scan()
+		if tok == gotoken.EOF {
+			return false
+		}
+		if tok == gotoken.IDENT && lit == "loop" && prevTok != gotoken.PERIOD {
+			return true
+		}
+		prevTok = tok
+	}
+}
+
+// forStmtIdents returns the variables declared in the for statement.
+func forStmtIdents(stmt []byte) []string {
+	expr, err := goparser.ParseExpr(fmt.Sprintf("func () { for %s {} }", stmt))
+	if err != nil {
+		return nil
+	}
+	fl, ok := expr.(*ast.FuncLit)
+	if !ok || len(fl.Body.List) != 1 {
+		return nil
+	}
+	switch x := fl.Body.List[0].(type) {
+	case *ast.ForStmt:
+		if x.Init != nil {
+			return stmtsIdents([]ast.Stmt{x.Init})
+		}
+	case *ast.RangeStmt:
+		if x.Tok == gotoken.DEFINE {
+			return exprsIdents([]ast.Expr{x.Key, x.Value})
+		}
+	}
+	return nil
+}
+
+// funcCodeIdents returns the identifiers declared at the top level
+// of the code inside func.
+func funcCodeIdents(code []byte) []string {
+	expr, err := goparser.ParseExpr(fmt.Sprintf("func () { %s\n }", code))
+	if err != nil {
+		return nil
+	}
+	fl, ok := expr.(*ast.FuncLit)
+	if !ok {
+		return nil
+	}
+	return stmtsIdents(fl.Body.List)
+}
+
+// templateCodeIdents returns package-level identifiers declared
+// in the code outside funcs.
+func templateCodeIdents(code []byte) []string {
+	codeStr := fmt.Sprintf("package foo\n%s", code)
+	fset := gotoken.NewFileSet()
+	f, err := goparser.ParseFile(fset, "", codeStr, 0)
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for _, decl := range f.Decls {
+		switch x := decl.(type) {
+		case *ast.GenDecl:
+			names = append(names, specsIdents(x.Specs)...)
+		case *ast.FuncDecl:
+			if x.Recv == nil {
+				names = append(names, x.Name.Name)
+			}
+		}
+	}
+	return names
+}
+
+func stmtsIdents(stmts []ast.Stmt) []string {
+	var names []string
+	for _, stmt := range stmts {
+		switch x := stmt.(type) {
+		case *ast.AssignStmt:
+			if x.Tok == gotoken.DEFINE {
+				names = append(names, exprsIdents(x.Lhs)...)
+			}
+		case *ast.DeclStmt:
+			if gd, ok := x.Decl.(*ast.GenDecl); ok {
+				names = append(names, specsIdents(gd.Specs)...)
+			}
+		}
+	}
+	return names
+}
+
+func specsIdents(specs []ast.Spec) []string {
+	var names []string
+	for _, spec := range specs {
+		switch x := spec.(type) {
+		case *ast.ValueSpec:
+			for _, ident := range x.Names {
+				names = append(names, ident.Name)
+			}
+		case *ast.TypeSpec:
+			names = append(names, x.Name.Name)
+		}
+	}
+	return names
+}
+
+func exprsIdents(exprs []ast.Expr) []string {
+	var names []string
+	for _, e := range exprs {
+		if ident, ok := e.(*ast.Ident); ok && ident.Name != "_" {
+			names = append(names, ident.Name)
+		}
+	}
+	return names
+}
+
+func validateIfStmt(stmt []byte) error {
+	exprStr := fmt.Sprintf("func () { if %s {} }", stmt)
+	_, err := goparser.ParseExpr(exprStr)
+	return err
+}
+
+func validateSwitchStmt(stmt []byte) error {
+	exprStr := fmt.Sprintf("func () { switch %s {} }", stmt)
+	_, err := goparser.ParseExpr(exprStr)
+	return err
+}
+
+// isTypeSwitchStmt returns true if stmt is a type switch statement
+// such as `x := v.(type)`.
+//
+// stmt must be already validated with validateSwitchStmt.
+func isTypeSwitchStmt(stmt []byte) bool {
+	exprStr := fmt.Sprintf("func () { switch %s {} }", stmt)
+	expr, err := goparser.ParseExpr(exprStr)
+	if err != nil {
+		return false
+	}
+	_, ok := expr.(*ast.FuncLit).Body.List[0].(*ast.TypeSwitchStmt)
+	return ok
+}
+
+func validateCaseStmt(stmt []byte) error {
+	exprStr := fmt.Sprintf("func () { switch {case %s:} }", stmt)
+	_, err := goparser.ParseExpr(exprStr)
+	return err
+}
+
+// indentCode indents all the lines of the multi-line code
+// except the first one with prefix.
+//
+// The common leading whitespace of the indented lines is removed.
+// Lines inside multi-line raw string literals are left as is.
+func indentCode(code []byte, prefix string) []byte {
+	lines := bytes.Split(code, []byte("\n"))
+	if len(lines) == 1 {
+		return code
+	}
+	inRawString := rawStringLines(code, len(lines))
+	var indent []byte
+	indentFound := false
+	for i, line := range lines[1:] {
+		if inRawString[i+1] || len(stripLeadingSpace(line)) == 0 {
+			continue
+		}
+		lineIndent := line[:len(line)-len(stripLeadingSpace(line))]
+		if !indentFound {
+			indent = lineIndent
+			indentFound = true
+			continue
+		}
+		n := 0
+		for n < len(indent) && n < len(lineIndent) && indent[n] == lineIndent[n] {
+			n++
+		}
+		indent = indent[:n]
+	}
+	var bb bytes.Buffer
+	bb.Write(lines[0])
+	for i, line := range lines[1:] {
+		bb.WriteByte('\n')
+		switch {
+		case inRawString[i+1]:
+			bb.Write(line)
+		case len(stripLeadingSpace(line)) == 0:
+			// skip trailing whitespace on empty lines
+		default:
+			bb.WriteString(prefix)
+			bb.Write(line[len(indent):])
+		}
+	}
+	return bb.Bytes()
+}
+
+// rawStringLines returns whether the given lines of code start inside
+// multi-line raw string literals.
+func rawStringLines(code []byte, linesCount int) []bool {
+	inRawString := make([]bool, linesCount)
+	fset := gotoken.NewFileSet()
+	f := fset.AddFile("", -1, len(code))
+	var sc goscanner.Scanner
+	sc.Init(f, code, nil, 0)
+	for {
+		pos, tok, lit := sc.Scan()
+		if tok == gotoken.EOF {
+			return inRawString
+		}
+		if tok != gotoken.STRING || lit[0] != '`' {
+			continue
+		}
+		start := f.Line(pos)
+		end := start + strings.Count(lit, "\n")
+		for line := start + 1; line <= end; line++ {
+			inRawString[line-1] = true
+		}
+	}
+}
+
+func (p *parser) validateFuncCode(code []byte) error {
+	exprStr := fmt.Sprintf("func () { for { %s\n } }", code)
+	expr, err := goparser.ParseExpr(exprStr)
+	if err != nil {
+		return err
+	}
+	return p.validateDeclaredIdents(expr)
+}
+
+func (p *parser) validateTemplateCode(code []byte) error {
+	codeStr := fmt.Sprintf("package foo\nvar _ = a\n%s", code)
+	fset := gotoken.NewFileSet()
+	f, err := goparser.ParseFile(fset, "", codeStr, 0)
+	if err != nil {
+		return err
+	}
+	return p.validateDeclaredIdents(f)
+}
+
+// validateDeclaredIdents verifies that the identifiers declared in the code
+// don't shadow the identifiers used by the generated code.
+func (p *parser) validateDeclaredIdents(node ast.Node) error {
+	var err error
+	check := func(ident *ast.Ident) {
+		if err == nil && ident != nil {
+			err = p.validateIdent(ident.Name)
+		}
+	}
+	checkFields := func(fl *ast.FieldList) {
+		if fl == nil {
+			return
+		}
+		for _, f := range fl.List {
+			for _, ident := range f.Names {
+				check(ident)
+			}
+		}
+	}
+	ast.Inspect(node, func(n ast.Node) bool {
+		switch x := n.(type) {
+		case *ast.AssignStmt:
+			if x.Tok == gotoken.DEFINE {
+				for _, e := range x.Lhs {
+					ident, _ := e.(*ast.Ident)
+					check(ident)
+				}
+			}
+		case *ast.RangeStmt:
+			if x.Tok == gotoken.DEFINE {
+				ident, _ := x.Key.(*ast.Ident)
+				check(ident)
+				ident, _ = x.Value.(*ast.Ident)
+				check(ident)
+			}
+		case *ast.ValueSpec:
+			for _, ident := range x.Names {
+				check(ident)
+			}
+		case *ast.TypeSpec:
+			check(x.Name)
+		case *ast.FuncDecl:
+			check(x.Name)
+			checkFields(x.Recv)
+		case *ast.FuncType:
+			checkFields(x.Params)
+			checkFields(x.Results)
+		}
+		return err == nil
+	})
+	return err
+}
+
+func validatePackageName(code []byte) error {
+	codeStr := fmt.Sprintf("package %s", code)
+	fset := gotoken.NewFileSet()
+	_, err := goparser.ParseFile(fset, "", codeStr, 0)
+	return err
+}
+
+func validateBuildConstraint(code []byte) error {
+	if bytes.IndexByte(code, '\n') >= 0 {
+		return errorf(KindInvalidCode, "build constraint must be on a single line")
+	}
+	_, err := constraint.Parse(fmt.Sprintf("//go:build %s", code))
+	return err
+}
+
+func validateImport(code []byte) error {
+	codeStr := fmt.Sprintf("package foo\nimport %s", code)
+	fset := gotoken.NewFileSet()
+	f, err := goparser.ParseFile(fset, "", codeStr, 0)
+	if err != nil {
+		return err
+	}
+	for _, d := range f.Decls {
+		gd, ok := d.(*ast.GenDecl)
+		if !ok {
+			return errorf(KindUnexpectedToken, "unexpected code found: %T. Expecting ast.GenDecl", d)
+		}
+		for _, s := range gd.Specs {
+			if _, ok := s.(*ast.ImportSpec); !ok {
+				return errorf(KindUnexpectedToken, "unexpected code found: %T. Expecting ast.ImportSpec", s)
+			}
+		}
+	}
+	return nil
+}
+
+func validateConst(code []byte) error {
+	codeStr := fmt.Sprintf("package foo\nconst %s", code)
+	fset := gotoken.NewFileSet()
+	f, err := goparser.ParseFile(fset, "", codeStr, 0)
+	if err != nil {
+		return err
+	}
+	if len(f.Decls) != 1 {
+		return errorf(KindUnexpectedToken, "unexpected code found after const declaration")
+	}
+	specs := f.Decls[0].(*ast.GenDecl).Specs
+	if len(specs) == 0 {
+		return errorf(KindInvalidCode, "missing consts in the declaration")
+	}
+	// Only subsequent consts in the group may omit the value.
+	if len(specs[0].(*ast.ValueSpec).Values) == 0 {
+		return errorf(KindInvalidCode, "missing value for the first const")
+	}
+	return nil
+}
@@ -0,0 +1,3538 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	goast "go/ast"
+	"go/build/constraint"
+	"go/format"
+	goparser "go/parser"
+	gotoken "go/token"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/valyala/quicktemplate"
+)
+
+func TestParsePackageName(t *testing.T) {
+	// empty template
+	testParseSuccess(t, ``)
+	testParseCode(t, ``, "package memory\n")
+
+	// No package name
+	testParseSuccess(t, `foobar`)
+	testParseCode(t, `foobar`, "// foobar\n", "package memory\n")
+
+	// explicit package name
+	testParseSuccess(t, `{% package foobar %}`)
+
+	// package name with imports
+	testParseSuccess(t, `Package: {%
+		package foobar
+	%}
+	import
+	{% import "aa/bb/cc" %}
+	yet another import
+	{% import (
+		"xxx.com/aaa"
+	) %}`)
+
+	// invalid package name
+	testParseFailure(t, `{% package foo bar %}`)
+	testParseFailure(t, `{% package "foobar" %}`)
+	testParseFailure(t, `{% package x(foobar) %}`)
+
+	// multiple package names
+	testParseFailure(t, `{% package foo %}{% package bar %}`)
+
+	// package name not at the top of the template
+	testParseFailure(t, `{% import "foo" %}{% package bar %}`)
+	testParseFailure(t, `{% func foo() %}{% endfunc %}{% package bar %}`)
+	testParseFailure(t, `{% func foo() %}{% package bar %}{% endfunc %}`)
+}
+
+func TestParseBuild(t *testing.T) {
+	testParseCode(t, `{% build linux && amd64 %}`, "//go:build linux && amd64\n\n")
+	testParseCode(t, `{% build !windows %}{% package foo %}{% func f() %}{% endfunc %}`, "//go:build !windows\n\n")
+	testParseCode(t, "Platform-specific templates.\n{% build linux || (darwin && !cgo) %}\n{% import \"fmt\" %}",
+		"// Platform-specific templates.\n\n//go:build linux || (darwin && !cgo)\n\n")
+
+	// The constraint must be recognized by Go tools.
+	code, err := CompileString("Doc.\n{% build linux && amd64 %}\n{% func F() %}{% endfunc %}", "./foobar.tpl")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	fset := gotoken.NewFileSet()
+	f, err := goparser.ParseFile(fset, "", code, goparser.ParseComments)
+	if err != nil {
+		t.Fatalf("cannot parse the generated code: %s\n%s", err, code)
+	}
+	var buildLine *goast.Comment
+	for _, cg := range f.Comments {
+		for _, c := range cg.List {
+			if constraint.IsGoBuild(c.Text) {
+				buildLine = c
+			}
+		}
+	}
+	if buildLine == nil {
+		t.Fatalf("cannot find //go:build line in the generated code:\n%s", code)
+	}
+	if buildLine.Pos() > f.Package {
+		t.Fatalf("//go:build line must precede the package clause:\n%s", code)
+	}
+	if f.Doc != nil && f.Doc.Pos() <= buildLine.Pos() {
+		t.Fatalf("//go:build line mustn't be a part of the package doc comment:\n%s", code)
+	}
+	n := fset.Position(buildLine.End()).Offset
+	if !strings.HasPrefix(code[n:], "\n\n") {
+		t.Fatalf("//go:build line must be followed by a blank line:\n%s", code)
+	}
+	expr, err := constraint.Parse(buildLine.Text)
+	if err != nil {
+		t.Fatalf("cannot parse %q: %s", buildLine.Text, err)
+	}
+	if !expr.Eval(func(tag string) bool { return tag == "linux" || tag == "amd64" }) {
+		t.Fatalf("unexpected build constraint %q", buildLine.Text)
+	}
+
+	// empty or invalid constraint
+	testParseFailureMsg(t, `{% build %}`, "empty build constraint")
+	testParseFailureMsg(t, `{% build linux && %}`, "invalid build constraint")
+	testParseFailureMsg(t, `{% build "linux" %}`, "invalid build constraint")
+	testParseFailureMsg(t, "{% build linux\n|| darwin %}", "build constraint must be on a single line")
+
+	// the constraint must be at the top of the template
+	testParseFailureMsg(t, `{% package foo %}{% build linux %}`, "build constraint must be at the top of the template")
+	testParseFailureMsg(t, `{% import "foo" %}{% build linux %}`, "build constraint must be at the top of the template")
+	testParseFailureMsg(t, `{% func f() %}{% endfunc %}{% build linux %}`, "build constraint must be at the top of the template")
+	testParseFailureMsg(t, `{% build linux %}{% build amd64 %}`, "build constraint must be at the top of the template")
+}
+
+func TestParseOutputFunc(t *testing.T) {
+	// func without args
+	testParseSuccess(t, `{% func f() %}{%= f() %}{% endfunc %}`)
+	testParseSuccess(t, `{% func f() %}{%= x.y.f() %}{% endfunc %}`)
+
+	// func with args
+	testParseSuccess(t, `{% func f() %}{%= f(1, "foo", bar) %}{% endfunc %}`)
+	testParseSuccess(t, `{% func f() %}{%= x.y.f(1, "foo", bar) %}{% endfunc %}`)
+
+	// html modifier (=h)
+	testParseSuccess(t, `{% func f() %}{%=h f(1, "foo", bar) %}{% endfunc %}`)
+	testParseSuccess(t, `{% func f() %}{%=h x.y.f(1, "foo", bar) %}{% endfunc %}`)
+
+	// urlencode modifier (=u)
+	testParseSuccess(t, `{% func f() %}{%=u f(1, "foo", bar) %}{% endfunc %}`)
+	testParseSuccess(t, `{% func f() %}{%=u x.y.f(1, "foo", bar) %}{% endfunc %}`)
+	testParseSuccess(t, `{% func f() %}{%=uh f(1, "foo", bar) %}{% endfunc %}`)
+	testParseSuccess(t, `{% func f() %}{%=uh x.y.f(1, "foo", bar) %}{% endfunc %}`)
+
+	// quoted json string modifier (=q)
+	testParseSuccess(t, `{% func f() %}{%=q f(1, "foo", bar) %}{% endfunc %}`)
+	testParseSuccess(t, `{% func f() %}{%=q x.y.f(1, "foo", bar) %}{% endfunc %}`)
+	testParseSuccess(t, `{% func f() %}{%=qh f(1, "foo", bar) %}{% endfunc %}`)
+	testParseSuccess(t, `{% func f() %}{%=qh x.y.f(1, "foo", bar) %}{% endfunc %}`)
+
+	// unquoted json string modifier (=j)
+	testParseSuccess(t, `{% func f() %}{%=j f(1, "foo", bar) %}{% endfunc %}`)
+	testParseSuccess(t, `{% func f() %}{%=j x.y.f(1, "foo", bar) %}{% endfunc %}`)
+	testParseSuccess(t, `{% func f() %}{%=jh f(1, "foo", bar) %}{% endfunc %}`)
+	testParseSuccess(t, `{% func f() %}{%=jh x.y.f(1, "foo", bar) %}{% endfunc %}`)
+
+	// unknown modifier
+	testParseFailure(t, `{% func f() %}{%=w f(1, "foo", bar) %}{% endfunc %}`)
+	testParseFailure(t, `{% func f() %}{%=ww x.y.f(1, "foo", bar) %}{% endfunc %}`)
+	testParseFailure(t, `{% func f() %}{%=wwh f(1, "foo", bar) %}{% endfunc %}`)
+	testParseFailure(t, `{% func f() %}{%=wh x.y.f(1, "foo", bar) %}{% endfunc %}`)
+}
+
+func TestParseOutputFuncStreamsWriter(t *testing.T) {
+	// {%= %} passes the already acquired writer to the nested stream func
+	// instead of acquiring a new one in the nested Write func.
+	tpl := `{% func f(n int) %}{%= g(n) %}{%= x.y.G(n) %}{% endfunc %}`
+	testParseCode(t, tpl, "\tstreamg(qw422016, n)\n", "\tx.y.StreamG(qw422016, n)\n")
+
+	code, err := CompileString(tpl, "./foobar.tpl")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	n := strings.Index(code, "func Streamf(")
+	if n < 0 {
+		n = strings.Index(code, "func streamf(")
+	}
+	if n < 0 {
+		t.Fatalf("cannot find stream func in the generated code:\n%s", code)
+	}
+	body := code[n:]
+	body = body[:strings.Index(body, "\n}\n")]
+	if strings.Contains(body, "AcquireWriter") || strings.Contains(body, "ReleaseWriter") {
+		t.Fatalf("unexpected writer re-acquiring in the stream func:\n%s", body)
+	}
+}
+
+func TestParseCat(t *testing.T) {
+	// relative paths
+	testParseSuccess(t, `{% func a() %}{% cat "parser.go" %}{% endfunc %}`)
+	testParseSuccess(t, `{% func a() %}{% cat "./parser.go" %}{% endfunc %}`)
+	testParseSuccess(t, `{% func a() %}{% cat "../parser/parser.go" %}{% endfunc %}`)
+
+	// multi-cat
+	testParseSuccess(t, `{% func a() %}{% cat "parser.go" %}{% cat "./parser.go" %}{% endfunc %}`)
+
+	// non-existing file
+	testParseFailure(t, `{% func a() %}{% cat "non-existing-file.go" %}{% endfunc %}`)
+
+	// non-const string
+	testParseFailure(t, `{% func a() %}{% cat "foobar"+".baz" %}{% endfunc %}`)
+	testParseFailure(t, `{% func a() %}{% cat foobar %}{% endfunc %}`)
+}
+
+func TestParseUnexpectedValueAfterTag(t *testing.T) {
+	// endfunc
+	testParseSuccess(t, "{% func a() %}{% endfunc %}")
+	testParseFailure(t, "{% func a() %}{% endfunc foo bar %}")
+
+	// endfor
+	testParseSuccess(t, "{% func a() %}{% for %}{% endfor %}{% endfunc %}")
+	testParseFailure(t, "{% func a() %}{% for %}{% endfor foo bar %}{% endfunc %}")
+
+	// endif
+	testParseSuccess(t, "{% func a() %}{% if true %}{% endif %}{% endfunc %}")
+	testParseFailure(t, "{% func a() %}{% if true %}{% endif foo bar %}{% endfunc %}")
+
+	// endswitch
+	testParseSuccess(t, "{% func a() %}{% switch %}{% case true %}{% endswitch %}{% endfunc %}")
+	testParseFailure(t, "{% func a() %}{% switch %}{% case true %}{% endswitch foobar %}{% endfunc %}")
+
+	// else
+	testParseSuccess(t, "{% func a() %}{% if true %}{% else %}{% endif %}{% endfunc %}")
+	testParseFailure(t, "{% func a() %}{% if true %}{% else foo bar %}{% endif %}{% endfunc %}")
+
+	// return
+	testParseSuccess(t, "{% func a() %}{% return %}{% endfunc %}")
+	testParseFailure(t, "{% func a() %}{% return foobar %}{% endfunc %}")
+
+	// break
+	testParseSuccess(t, "{% func a() %}{% for %}{% break %}{% endfor %}{% endfunc %}")
+	testParseFailure(t, "{% func a() %}{% for %}{% break foobar %}{% endfor %}{% endfunc %}")
+
+	// default
+	testParseSuccess(t, "{% func a() %}{% switch %}{% default %}{% endswitch %}{% endfunc %}")
+	testParseFailure(t, "{% func a() %}{% switch %}{% default foobar %}{% endswitch %}{% endfunc %}")
+}
+
+func TestParseFPrecFailure(t *testing.T) {
+	// negative precision
+	testParseFailure(t, "{% func a()%}{%f.-1 1.2 %}{% endfunc %}")
+
+	// non-numeric precision
+	testParseFailure(t, "{% func a()%}{%f.foo 1.2 %}{% endfunc %}")
+
+	// more than one dot
+	testParseFailure(t, "{% func a()%}{%f.1.234 1.2 %}{% endfunc %}")
+	testParseFailure(t, "{% func a()%}{%f.1.foo 1.2 %}{% endfunc %}")
+}
+
+func TestParseFPrecSuccess(t *testing.T) {
+	// no precision
+	testParseSuccess(t, "{% func a()%}{%f 1.2 %}{% endfunc %}")
+	testParseSuccess(t, "{% func a()%}{%f= 1.2 %}{% endfunc %}")
+
+	// precision set
+	testParseSuccess(t, "{% func a()%}{%f.1 1.234 %}{% endfunc %}")
+	testParseSuccess(t, "{% func a()%}{%f.10= 1.234 %}{% endfunc %}")
+
+	// missing precision
+	testParseSuccess(t, "{% func a()%}{%f. 1.234 %}{% endfunc %}")
+	testParseSuccess(t, "{% func a()%}{%f.= 1.234 %}{% endfunc %}")
+}
+
+func TestParseDN(t *testing.T) {
+	testParseCode(t, "{% func a(n int) %}{%dn n %}{%dn= -n %}{% endfunc %}",
+		"qw422016.N().DN(n)\n", "qw422016.N().DN(-n)\n")
+
+	// custom separator
+	testParseCode(t, "{% func a(n int) %}{%dn \".\" n %}{%dn= `'` n %}{%dn? \" \" a.b.n %}{% endfunc %}",
+		"qw422016.E().DNSep(n, \".\")\n", "qw422016.N().DNSep(n, `'`)\n", "if a != nil && a.b != nil {", "qw422016.E().DNSep(a.b.n, \" \")\n")
+	testParseCode(t, "{% func a(n int) %}{%dn \".\" n > 0 ? n : -n %}{% endfunc %}",
+		"qw422016.E().DNSep(n, \".\")\n", "qw422016.E().DNSep(-n, \".\")\n")
+
+	testParseCode(t, "{% func a(n int) %}{%dn \".\" -n %}{% endfunc %}", "qw422016.E().DNSep(-n, \".\")\n")
+
+	// missing value after separator
+	testParseFailure(t, "{% func a() %}{%dn \".\"n %}{% endfunc %}")
+
+	// invalid value
+	testParseFailure(t, "{% func a() %}{%dn \".\" n) %}{% endfunc %}")
+}
+
+func TestParseSwitchCaseSuccess(t *testing.T) {
+	// single-case switch
+	testParseSuccess(t, "{%func a()%}{%switch n%}{%case 1%}aaa{%endswitch%}{%endfunc%}")
+
+	// multi-case switch
+	testParseSuccess(t, "{%func a()%}{%switch%}\n\t  {%case foo()%}\nfoobar{%case bar()%}{%endswitch%}{%endfunc%}")
+
+	// default statement
+	testParseSuccess(t, "{%func a()%}{%switch%}{%default%}{%endswitch%}{%endfunc%}")
+
+	// switch with break
+	testParseSuccess(t, "{%func a()%}{%switch n%}{%case 1%}aaa{%break%}ignore{%endswitch%}{%endfunc%}")
+
+	// complex switch
+	testParseSuccess(t, `{%func f()%}{% for %}
+		{%switch foo() %}
+		The text before the first case
+		is converted into a comment
+		{%case "foobar" %}
+			{% switch %}
+			{% case bar() %}
+				aaaa{% break %}
+				ignore this line
+			{% case baz() %}
+				bbbb
+			{% endswitch %}
+		{% case "aaa" %}
+			{% for i := 0; i < 10; i++ %}
+				foobar
+			{% endfor %}
+		{% case "qwe", "sdfdf" %}
+			aaaa
+			{% return %}
+		{% case "www" %}
+			break from the switch
+			{% break %}
+		{% default %}
+			foobar
+		{%endswitch%}
+		{% if 42 == 2 %}
+			break for the loop
+			{% break %}
+			ignore this
+		{% endif %}
+	{% endfor %}{%endfunc%}`)
+}
+
+func TestParseSwitchFallthrough(t *testing.T) {
+	testParseCode(t, `{% func f(n int) %}{% switch n %}
+		{% case 1 %}
+			one
+			{% fallthrough %}
+		{% case 2 %}
+			two
+		{% endswitch %}{% endfunc %}`,
+		"\tcase 1:\n",
+		"\t\t//line ./foobar.tpl:4\n\t\tfallthrough\n\t//line ./foobar.tpl:5\n\tcase 2:\n")
+
+	// the contents after fallthrough are skipped
+	testParseCode(t, `{% func f(n int) %}{% switch %}{% case n > 0 %}a{% fallthrough %}skip this{%s "and this" %}{% default %}b{% case n < 0 %}c{% endswitch %}{% endfunc %}`,
+		"\t\tfallthrough\n\t//line ./foobar.tpl:1\n\tdefault:\n")
+	testParseCode(t, `{% func f(n int) %}{% switch n %}{% default %}a{% fallthrough %}{% case 1 %}b{% endswitch %}{% endfunc %}`,
+		"\t\tfallthrough\n\t//line ./foobar.tpl:1\n\tcase 1:\n")
+
+	// fallthrough outside switch case
+	testParseFailureMsg(t, `{% func f() %}{% fallthrough %}{% endfunc %}`, "fallthrough tag may be used only at the end of switch case")
+	testParseFailureMsg(t, `{% func f() %}{% for %}{% fallthrough %}{% endfor %}{% endfunc %}`, "fallthrough tag may be used only at the end of switch case")
+	testParseFailureMsg(t, `{% func f(n int) %}{% switch n %}{% case 1 %}{% if n > 0 %}{% fallthrough %}{% endif %}{% case 2 %}{% endswitch %}{% endfunc %}`,
+		"fallthrough tag may be used only at the end of switch case")
+	testParseFailure(t, `{% fallthrough %}`)
+
+	// fallthrough in the final case
+	testParseFailureMsg(t, `{% func f(n int) %}{% switch n %}{% case 1 %}a{% fallthrough %}{% endswitch %}{% endfunc %}`, "cannot fallthrough final case in switch")
+	testParseFailureMsg(t, `{% func f(n int) %}{% switch n %}{% case 1 %}a{% default %}b{% fallthrough %}{% endswitch %}{% endfunc %}`, "cannot fallthrough final case in switch")
+
+	// fallthrough in type switch
+	testParseFailureMsg(t, `{% func f(v interface{}) %}{% switch x := v.(type) %}{% case int %}{%d x %}{% fallthrough %}{% case string %}{% endswitch %}{% endfunc %}`,
+		"cannot fallthrough in type switch")
+
+	// fallthrough with value
+	testParseFailure(t, `{% func f(n int) %}{% switch n %}{% case 1 %}{% fallthrough 2 %}{% case 2 %}{% endswitch %}{% endfunc %}`)
+}
+
+func TestParseSwitchCaseFailure(t *testing.T) {
+	// missing endswitch
+	testParseFailure(t, "{%func a()%}{%switch%}{%endfunc%}")
+
+	// empty switch
+	testParseFailure(t, "{%func f()%}{%switch%}{%endswitch%}{%endfunc%}")
+
+	// case outside switch
+	testParseFailure(t, "{%func f()%}{%case%}{%endfunc%}")
+
+	// the first tag inside switch is non-case
+	testParseFailure(t, "{%func f()%}{%switch%}{%return%}{%endswitch%}{%endfunc%}")
+	testParseFailure(t, "{%func F()%}{%switch%}{%break%}{%endswitch%}{%endfunc%}")
+	testParseFailure(t, "{%func f()%}{%switch 1%}{%return%}{%case 1%}aaa{%endswitch%}{%endfunc%}")
+
+	// empty case
+	testParseFailure(t, "{%func f()%}{%switch%}{%case%}aaa{%endswitch%}{%endfunc%}")
+
+	// multiple default statements
+	testParseFailure(t, "{%func f()%}{%switch%}{%case%}aaa{%default%}bbb{%default%}{%endswitch%}{%endfunc%}")
+}
+
+func TestParseBreakContinueReturn(t *testing.T) {
+	testParseSuccess(t, `{% func a() %}{% for %}{% continue %}{% break %}{% return %}{% endfor %}{% endfunc %}`)
+	testParseSuccess(t, `{% func a() %}{% for %}
+		{% if f1() %}{% continue %}skip this{%s "and this" %}{% endif %}
+		{% if f2() %}{% break %}{% for %}{% endfor %}skip this{% endif %}
+		{% if f3() %}{% return %}foo{% if f4() %}{% for %}noop{% endfor %}{% endif %}bar skip this{% endif %}
+		text
+	{% endfor %}{% endfunc %}`)
+}
+
+func TestParseBreakContinueN(t *testing.T) {
+	// break 2 from the inner loop
+	testParseCode(t, `{% func a() %}{% for i := 0; i < 3; i++ %}{% for j := 0; j < 3; j++ %}{% if j == i %}{% break 2 %}{% endif %}{%d j %}{% endfor %}{% endfor %}{% endfunc %}`,
+		"\tqfor422016_1:\n\t//line ./foobar.tpl:1\n\tfor i := 0; i < 3; i++ {\n",
+		"\t\t\t\tbreak qfor422016_1\n")
+
+	// continue 2 from the inner loop
+	testParseCode(t, `{% func a() %}{% for %}{% for %}{% continue 2 %}{% endfor %}{% endfor %}{% endfunc %}`,
+		"\tqfor422016_1:\n",
+		"\t\t\tcontinue qfor422016_1\n")
+
+	// break 1 refers the innermost loop, so it leaves the loop from switch
+	testParseCode(t, `{% func a() %}{% for %}{% for %}{% switch %}{% case true %}{% break 1 %}{% endswitch %}{% endfor %}{% endfor %}{% endfunc %}`,
+		"\t\tqfor422016_2:\n",
+		"break qfor422016_2\n")
+
+	// labels are emitted only for the referred loops
+	code, err := CompileString(`{% func a() %}{% for %}{% for %}{% for %}{% break 3 %}{% endfor %}{% endfor %}{% endfor %}{% endfunc %}`, "foobar.qtpl")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !strings.Contains(code, "qfor422016_1:") {
+		t.Fatalf("cannot find the label for the outer loop in the compiled code:\n%s", code)
+	}
+	if strings.Contains(code, "qfor422016_2:") || strings.Contains(code, "qfor422016_3:") {
+		t.Fatalf("unexpected labels for unreferred loops in the compiled code:\n%s", code)
+	}
+
+	// skipped break doesn't emit the label
+	code, err = CompileString(`{% func a() %}{% for %}{% for %}{% return %}{% break 2 %}{% endfor %}{% endfor %}{% endfunc %}`, "foobar.qtpl")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if strings.Contains(code, "qfor422016_1") {
+		t.Fatalf("unexpected label for the skipped break in the compiled code:\n%s", code)
+	}
+
+	// N exceeds the number of enclosing loops
+	testParseFailureMsg(t, `{% func a() %}{% for %}{% for %}{% break 3 %}{% endfor %}{% endfor %}{% endfunc %}`,
+		"exceeds the number of enclosing for loops: 2")
+	testParseFailure(t, `{% func a() %}{% switch %}{% case true %}{% break 1 %}{% endswitch %}{% endfunc %}`)
+	testParseFailure(t, `{% func a() %}{% continue 1 %}{% endfunc %}`)
+
+	// N mustn't cross the closure boundary
+	testParseFailure(t, `{% func a() %}{% for %}{% func b() %}{% for %}{% break 2 %}{% endfor %}{% endfunc %}{% endfor %}{% endfunc %}`)
+
+	// invalid N
+	testParseFailureMsg(t, `{% func a() %}{% for %}{% break 0 %}{% endfor %}{% endfunc %}`, "it must be a positive integer")
+	testParseFailure(t, `{% func a() %}{% for %}{% break -1 %}{% endfor %}{% endfunc %}`)
+	testParseFailure(t, `{% func a() %}{% for %}{% continue n %}{% endfor %}{% endfunc %}`)
+}
+
+func TestParseSep(t *testing.T) {
+	testParseCode(t, `{% func a(items []string) %}{% for _, s := range items %}{% sep ", " %}{%s s %}{% endfor %}{% endfunc %}`,
+		"\tqsep422016_1 := false\n\t//line ./foobar.tpl:1\n\tfor _, s := range items {\n",
+		"\t\tif qsep422016_1 {\n\t\t//line ./foobar.tpl:1\n\t\t\tqw422016.N().S(\", \")\n",
+		"\t\tqsep422016_1 = true\n")
+
+	// nested loops have independent separators
+	testParseCode(t, `{% func a(rows [][]string) %}{% for _, row := range rows %}{% sep "; " %}{% for _, s := range row %}{% sep `+"`,`"+` %}{%s s %}{% endfor %}{% endfor %}{% endfunc %}`,
+		"\tqsep422016_1 := false\n",
+		"\t\tqsep422016_2 := false\n",
+		"qw422016.N().S(\"; \")\n",
+		"qw422016.N().S(`,`)\n",
+		"\t\t\tqsep422016_2 = true\n")
+
+	// the flag isn't emitted for loops without sep
+	code, err := CompileString(`{% func a() %}{% for %}{% for %}{% sep "," %}{% endfor %}{% break %}{% endfor %}{% endfunc %}`, "foobar.qtpl")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if strings.Contains(code, "qsep422016_1") {
+		t.Fatalf("unexpected flag for the loop without sep in the compiled code:\n%s", code)
+	}
+
+	// sep mustn't cross the closure boundary
+	testParseFailureMsg(t, `{% func a() %}{% sep "," %}{% endfunc %}`, "found sep tag outside for loop")
+	testParseFailure(t, `{% func a() %}{% for %}{% func b() %}{% sep "," %}{% endfunc %}{% endfor %}{% endfunc %}`)
+
+	// invalid separator
+	testParseFailureMsg(t, `{% func a() %}{% for %}{% sep %}{% endfor %}{% endfunc %}`, "sep tag value must be a string literal")
+	testParseFailure(t, `{% func a(s string) %}{% for %}{% sep s %}{% endfor %}{% endfunc %}`)
+	testParseFailure(t, `{% func a() %}{% for %}{% sep "," + "" %}{% endfor %}{% endfunc %}`)
+}
+
+func TestParseForLoopVar(t *testing.T) {
+	// loop state is emitted for range loops referring loop variable
+	testParseCode(t, `{% func f(items []string) %}{% for _, s := range items %}{% if loop.First %}first{% endif %}{%s s %}{% endfor %}{% endfunc %}`,
+		"\tqr422016_1 := items\n",
+		"\tloop := qt422016.NewRangeLoop(qr422016_1, len(qr422016_1))\n",
+		"\tfor _, s := range qr422016_1 {\n",
+		"\t\tloop.Next()\n",
+		"\t\tif loop.First {\n")
+	testParseCode(t, `{% func f() %}{% for range getItems() %}{%d loop.Index %}{% endfor %}{% endfunc %}`,
+		"\tqr422016_1 := getItems()\n", "\tfor range qr422016_1 {\n")
+
+	// loops not referring loop variable are emitted as is
+	for _, tpl := range []string{
+		`{% func f(items []string) %}{% for _, s := range items %}{%s s %}{%s s.loop %}{%s "loop" %}{% endfor %}{% endfunc %}`,
+		`{% func f() %}{% for i := 0; i < 3; i++ %}{%d i %}{% endfor %}{% endfunc %}`,
+		`{% func f(items []string) %}{% for _, s := range items %}{% return %}{%d loop.Index %}{% endfor %}{% endfunc %}`,
+	} {
+		code, err := CompileString(tpl, "foobar.qtpl")
+		if err != nil {
+			t.Fatalf("unexpected error when compiling %q: %s", tpl, err)
+		}
+		if strings.Contains(code, "loop := qt422016.New") {
+			t.Fatalf("unexpected loop state in the code compiled from %q:\n%s", tpl, code)
+		}
+	}
+
+	// loop declared in the template isn't shadowed by the loop state
+	for _, tpl := range []string{
+		`{% func f(loops []string) %}{% for _, loop := range loops %}{%s loop %}{% endfor %}{% endfunc %}`,
+		`{% func f(loop int, xs []string) %}{% for _, x := range xs %}{%s x %}{%d loop %}{% endfor %}{% endfunc %}`,
+		`{% func f(xs []string) %}{% code loop := 1 %}{% for _, x := range xs %}{%s x %}{%d loop %}{% endfor %}{% endfunc %}`,
+		`{% code var loop = 1 %}{% func f(xs []string) %}{% for _, x := range xs %}{%s x %}{%d loop %}{% endfor %}{% endfunc %}`,
+		`{% func f(xs []string) %}{% for loop, x := range xs %}{%s x %}{%d loop %}{% endfor %}{% endfunc %}`,
+	} {
+		code, err := CompileString(tpl, "foobar.qtpl")
+		if err != nil {
+			t.Fatalf("unexpected error when compiling %q: %s", tpl, err)
+		}
+		if strings.Contains(code, "loop := qt422016.New") {
+			t.Fatalf("unexpected loop state in the code compiled from %q:\n%s", tpl, code)
+		}
+		if _, err := goparser.ParseFile(gotoken.NewFileSet(), "", code, 0); err != nil {
+			t.Fatalf("cannot parse the code compiled from %q: %s\n%s", tpl, err, code)
+		}
+	}
+
+	// nested loops have separate loop state
+	testParseCode(t, `{% func f(rows [][]string) %}{% for _, row := range rows %}{% for _, cell := range row %}{%d loop.Index %}{% endfor %}{%d loop.Index %}{% endfor %}{% endfunc %}`,
+		"\tloop := qt422016.NewRangeLoop(qr422016_1, len(qr422016_1))\n",
+		"\t\tloop := qt422016.NewRangeLoop(qr422016_2, len(qr422016_2))\n")
+
+	// loop state works together with break N
+	testParseCode(t, `{% func f(rows [][]string) %}{% for _, row := range rows %}{% for range row %}{% if loop.Last %}{% break 2 %}{% endif %}{% endfor %}{% endfor %}{% endfunc %}`,
+		"\tqfor422016_1:\n\t//line ./foobar.tpl:1\n\tfor _, row := range rows {\n",
+		"\t\tqr422016_2 := row\n",
+		"break qfor422016_1\n")
+	testParseCode(t, `{% func f(rows [][]string) %}{% for _, row := range rows %}{%d loop.Index %}{% for range row %}{% if loop.Last %}{% break 2 %}{% endif %}{% endfor %}{% endfor %}{% endfunc %}`,
+		"	qfor422016_1:\n\t//line ./foobar.tpl:1\n\tfor _, row := range qr422016_1 {\n",
+		"\t\tqr422016_2 := row\n",
+		"break qfor422016_1\n")
+}
+
+func TestParseForInRange(t *testing.T) {
+	testParseCode(t, `{% func f() %}{% for i in range(3) %}{%d i %}{% endfor %}{% endfunc %}`,
+		"\tfor i, qend422016 := 0, 3; i < qend422016; i++ {\n")
+	testParseCode(t, `{% func f() %}{% for i in range(1, 4) %}{%d i %}{% endfor %}{% endfunc %}`,
+		"\tfor i, qend422016 := 1, 4; i < qend422016; i++ {\n")
+	testParseCode(t, `{% func f() %}{% for i in range(0, 10, 2) %}{%d i %}{% endfor %}{% endfunc %}`,
+		"\tfor i, qend422016 := 0, 10; i < qend422016; i += 2 {\n")
+	testParseCode(t, `{% func f(n int) %}{% for i in range(n, 0, -1) %}{%d i %}{% endfor %}{% endfunc %}`,
+		"\tfor i, qend422016 := n, 0; i > qend422016; i += -1 {\n")
+	testParseCode(t, `{% func f(items []string) %}{% for j in range(len(items) - 1) %}{%s items[j] %}{% endfor %}{% endfunc %}`,
+		"\tfor j, qend422016 := 0, len(items) - 1; j < qend422016; j++ {\n")
+
+	// for loops with ' in ' are left as is
+	testParseCode(t, `{% func f() %}{% for _, s := range strings.Split("a in b", " in ") %}{%s s %}{% endfor %}{% endfunc %}`,
+		"\tfor _, s := range strings.Split(\"a in b\", \" in \") {\n")
+
+	// invalid range() args
+	testParseFailureMsg(t, `{% func f() %}{% for i in range() %}{% endfor %}{% endfunc %}`, "range() accepts from 1 to 3 args; got 0 args")
+	testParseFailureMsg(t, `{% func f() %}{% for i in range(1, 2, 3, 4) %}{% endfor %}{% endfunc %}`, "range() accepts from 1 to 3 args; got 4 args")
+	testParseFailureMsg(t, `{% func f() %}{% for i in range(1, 2, 0) %}{% endfor %}{% endfunc %}`, "range() step cannot be zero")
+	testParseFailureMsg(t, `{% func f() %}{% for i in range(1, %}{% endfor %}{% endfunc %}`, "invalid range()")
+	testParseFailureMsg(t, `{% func f(a []int) %}{% for i in range(a...) %}{% endfor %}{% endfunc %}`, "range() doesn't accept variadic args")
+	testParseFailureMsg(t, `{% func f() %}{% for i in range(1)[0] %}{% endfor %}{% endfunc %}`, "unexpected value after range()")
+	testParseFailureMsg(t, `{% func f() %}{% for i in range(1)(2) %}{% endfor %}{% endfunc %}`, "unexpected value after range()")
+}
+
+func TestParseForRangeInt(t *testing.T) {
+	// Go 1.22 range over integer is passed as is
+	testParseCode(t, `{% func f() %}{% for i := range 10 %}{%d i %}{% endfor %}{% endfunc %}`,
+		"\tfor i := range 10 {\n")
+	testParseCode(t, `{% func f(n int) %}{% for i := range n %}{%d i %}{% endfor %}{% endfunc %}`,
+		"\tfor i := range n {\n")
+	testParseCode(t, `{% func f(n int) %}{% for range n %}x{% endfor %}{% endfunc %}`,
+		"\tfor range n {\n")
+	testParseCode(t, `{% func f() %}{% for i := 0; i < 10; i += 2 %}{%d i %}{% endfor %}{% endfunc %}`,
+		"\tfor i := 0; i < 10; i += 2 {\n")
+
+	// loop state for integers known at parse time
+	testParseCode(t, `{% func f() %}{% for i := range 10 %}{%d loop.Index %}{% endfor %}{% endfunc %}`,
+		"\tqr422016_1 := 10\n", "\tloop := qt422016.NewLoop(int(qr422016_1))\n", "\tfor i := range qr422016_1 {\n")
+	testParseCode(t, `{% func f(items []string) %}{% for i := range len(items) - 1 %}{%d loop.Index %}{% endfor %}{% endfunc %}`,
+		"\tqr422016_1 := len(items) - 1\n", "\tloop := qt422016.NewLoop(int(qr422016_1))\n")
+	testParseCode(t, `{% func f(n int8) %}{% for range int(n) %}{%d loop.Index %}{% endfor %}{% endfunc %}`,
+		"\tloop := qt422016.NewLoop(int(qr422016_1))\n")
+
+	// other range expressions are assumed to support len()
+	testParseCode(t, `{% func f(items []string) %}{% for i := range items[1:] %}{%d loop.Index %}{% endfor %}{% endfunc %}`,
+		"\tloop := qt422016.NewRangeLoop(qr422016_1, len(qr422016_1))\n")
+
+	// strings are iterated by runes, so their length is determined at runtime
+	testParseCode(t, `{% func f(s string) %}{% for _, r := range s %}{%s string(r) %}{% if !loop.Last %},{% endif %}{% endfor %}{% endfunc %}`,
+		"\tqr422016_1 := s\n", "\tloop := qt422016.NewRangeLoop(qr422016_1, len(qr422016_1))\n")
+
+	for _, s := range []string{"10", "-1", "len(a)", "cap(a)*2", "(len(a) - n)", "n + len(a)", "int64(n)", "1 << n", "^0"} {
+		if !isIntRangeExpr([]byte(s)) {
+			t.Fatalf("expecting integer range expression %q", s)
+		}
+	}
+	for _, s := range []string{"n", "items", "a[1:]", "f(n)", "m.Len()", "1.5", `"abc"`, "n << 1", "len(a) > 0", "x.len(a)"} {
+		if isIntRangeExpr([]byte(s)) {
+			t.Fatalf("unexpected integer range expression %q", s)
+		}
+	}
+}
+
+func TestParseForIn(t *testing.T) {
+	testParseCode(t, `{% func f(items []string) %}{% for x in items %}{%s x %}{% endfor %}{% endfunc %}`,
+		"\tfor _, x := range items {\n")
+	testParseCode(t, `{% func f(items []string) %}{% for i, x in items %}{%d i %}{%s x %}{% endfor %}{% endfunc %}`,
+		"\tfor i, x := range items {\n")
+	testParseCode(t, `{% func f(m map[string]int) %}{% for k, _ in m %}{%s k %}{% endfor %}{% endfunc %}`,
+		"\tfor k, _ := range m {\n")
+}
+
+func TestParseForGuard(t *testing.T) {
+	testParseCode(t, `{% func f(items []*item) %}{% for x in items if x.Active %}{%s x.Name %}{% endfor %}{% endfunc %}`,
+		"\tfor _, x := range items {\n",
+		"\t\tif !(x.Active) {\n",
+		"\t\t\tcontinue\n")
+	testParseCode(t, `{% func f(items []*item) %}{% for i, x in items if x.Active && i > 0 %}{%d i %}{% endfor %}{% endfunc %}`,
+		"\tfor i, x := range items {\n",
+		"\t\tif !(x.Active && i > 0) {\n")
+	testParseCode(t, `{% func f(items []string) %}{% for _, s := range items if s != "" %}{%s s %}{% endfor %}{% endfunc %}`,
+		"\tfor _, s := range items {\n",
+		"\t\tif !(s != \"\") {\n")
+	testParseCode(t, `{% func f() %}{% for i in range(10) if i%2 == 0 %}{%d i %}{% endfor %}{% endfunc %}`,
+		"\tfor i, qend422016 := 0, 10; i < qend422016; i++ {\n",
+		"\t\tif !(i%2 == 0) {\n")
+
+	// if inside the range expression isn't a guard
+	testParseCode(t, `{% func f() %}{% for _, x := range func() []int { if true { return nil }; return nil }() %}{%d x %}{% endfor %}{% endfunc %}`,
+		"if true { return nil }; return nil }() {\n")
+
+	// the loop state would count skipped items
+	testParseFailureMsg(t, `{% func f(items []string) %}{% for _, s := range items if s != "" %}{%d loop.Index %}{% endfor %}{% endfunc %}`, "loop state cannot be used in the guarded loop")
+	testParseFailureMsg(t, `{% func f(items []string) %}{% for s in items if s != "" %}{% if loop.Last %}last{% endif %}{% endfor %}{% endfunc %}`, "loop state cannot be used in the guarded loop")
+	testParseErrorKind(t, `{% func f(items []string) %}{% for s in items if s != "" %}{% if loop.First %}first{% endif %}{% endfor %}{% endfunc %}`, KindInvalidCode, 1, 105)
+
+	// the loop state of the nested unguarded loop is allowed
+	testParseCode(t, `{% func f(rows [][]string) %}{% for row in rows if len(row) > 0 %}{% for s in row %}{%d loop.Index %}{%s s %}{% endfor %}{% endfor %}{% endfunc %}`,
+		"\tfor _, row := range rows {\n",
+		"\t\tif !(len(row) > 0) {\n",
+		"\t\tloop := qt422016.NewRangeLoop(qr422016_2, len(qr422016_2))\n")
+
+	// the declared loop variable isn't the loop state
+	testParseCode(t, `{% func f(loop int, items []string) %}{% for s in items if s != "" %}{%d loop %}{% endfor %}{% endfunc %}`,
+		"\tfor _, s := range items {\n")
+
+	testParseFailureMsg(t, `{% func f(items []string) %}{% for x in items if %}{% endfor %}{% endfunc %}`, "missing condition after if")
+	testParseFailureMsg(t, `{% func f() %}{% for if true %}{% endfor %}{% endfunc %}`, "missing loop statement before if")
+	testParseFailureMsg(t, `{% func f(items []string) %}{% for x in items if x + "a" %}{% endfor %}{% endfunc %}`, "must be a boolean expression")
+	testParseFailureMsg(t, `{% func f(items []string) %}{% for x in items if 1 %}{% endfor %}{% endfunc %}`, "must be a boolean expression")
+	testParseFailureMsg(t, `{% func f(items []string) %}{% for x in items if x == %}{% endfor %}{% endfunc %}`, "invalid condition")
+}
+
+func TestParseForInChan(t *testing.T) {
+	testParseCode(t, `{% func f(ch chan string) %}{% for x in <-ch %}{%s x %}{% endfor %}{% endfunc %}`,
+		"\tfor x := range ch {\n")
+	testParseCode(t, `{% func f(ctx context.Context, ch <-chan string) %}{% for x in <-ch while ctx %}{%s x %}{% endfor %}{% endfunc %}`,
+		"\tfor x := range qt422016.RecvContext(ctx, ch) {\n")
+	testParseCode(t, `{% func f(s *state) %}{% for x in <-s.results() while s.ctx if x != "" %}{%s x %}{% endfor %}{% endfunc %}`,
+		"\tfor x := range qt422016.RecvContext(s.ctx, s.results()) {\n",
+		"\t\tif !(x != \"\") {\n")
+
+	// channel args may be ranged over without <-
+	testParseCode(t, `{% func f(ch chan string) %}{% for x in ch %}{%s x %}{% endfor %}{% endfunc %}`,
+		"\tfor x := range ch {\n")
+	testParseCode(t, `{% func f(ctx context.Context, ch <-chan string) %}{% for x in ch while ctx %}{%s x %}{% endfor %}{% endfunc %}`,
+		"\tfor x := range qt422016.RecvContext(ctx, ch) {\n")
+	testParseCode(t, `{% func f(ch chan string) %}{% func g() %}{% for x in ch %}{%s x %}{% endfor %}{% endfunc %}{% endfunc %}`,
+		"\t\tfor x := range ch {\n")
+
+	// the shadowed channel arg isn't a channel
+	testParseCode(t, `{% func f(ch chan string, xs [][]string) %}{% for _, ch := range xs %}{% for x in ch %}{%s x %}{% endfor %}{% endfor %}{% endfunc %}`,
+		"\t\tfor _, x := range ch {\n")
+	testParseCode(t, `{% func f(ch chan string, xs []string) %}{% with ch = xs %}{% for x in ch %}{%s x %}{% endfor %}{% endwith %}{% endfunc %}`,
+		"\tfor _, x := range ch {\n")
+
+	// while inside the channel expression isn't a context
+	testParseCode(t, `{% func f() %}{% for x in <-get(while) while ctx %}{%s x %}{% endfor %}{% endfunc %}`,
+		"\tfor x := range qt422016.RecvContext(ctx, get(while)) {\n")
+
+	// channel loops have no loop state
+	code, err := CompileString(`{% func f(ch chan string) %}{% for x in <-ch %}{%s x %}{% endfor %}{% endfunc %}`, "./foobar.tpl")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if strings.Contains(code, "NewLoop") {
+		t.Fatalf("unexpected loop state in the channel loop:\n%s", code)
+	}
+
+	testParseFailureMsg(t, `{% func f() %}{% for i, x in <-ch %}{% endfor %}{% endfunc %}`, "channel loop accepts a single variable")
+	testParseFailureMsg(t, `{% func f() %}{% for x in <- %}{% endfor %}{% endfunc %}`, "missing channel after <-")
+	testParseFailureMsg(t, `{% func f() %}{% for x in <-ch) %}{% endfor %}{% endfunc %}`, "invalid channel")
+	testParseFailureMsg(t, `{% func f() %}{% for x in <-ch while %}{% endfor %}{% endfunc %}`, "missing context after while")
+	testParseFailureMsg(t, `{% func f() %}{% for x in <-ch while ctx( %}{% endfor %}{% endfunc %}`, "invalid context")
+	testParseFailureMsg(t, `{% func f() %}{% for x in items while ctx %}{% endfor %}{% endfunc %}`, "while may be used only in channel loops")
+	testParseFailureMsg(t, `{% func f(ch chan string) %}{% for i, x in ch %}{% endfor %}{% endfunc %}`, "channel loop accepts a single variable")
+}
+
+func TestParseFuncDefaults(t *testing.T) {
+	testParseCode(t, `{% func Card(title string, subtitle string = "") %}{%s title %}{% endfunc %}`,
+		"func StreamCard(qw422016 *qt422016.Writer, title string, subtitle string) {\n",
+		"// StreamCardDefaults calls StreamCard with default values for the omitted args.\n",
+		"func StreamCardDefaults(qw422016 *qt422016.Writer, title string) {\n",
+		"\tStreamCard(qw422016, title, \"\")\n",
+		"func WriteCardDefaults(qq422016 qtio422016.Writer, title string) {\n",
+		"\tWriteCard(qq422016, title, \"\")\n",
+		"func CardDefaults(title string) string {\n",
+		"\treturn Card(title, \"\")\n")
+
+	// only the stream func is generated for stream funcs and macros
+	testParseCode(t, `{% macro m(n int = 1) %}{%d n %}{% endmacro %}`,
+		"func streammDefaults(qw422016 *qt422016.Writer) {\n",
+		"\tstreamm(qw422016, 1)\n")
+
+	testParseFailureMsg(t, `{% func F(a int = 1) %}{% endfunc %}{% func FDefaults() %}{% endfunc %}`,
+		"func FDefaults at line 1: it is already defined at line 1")
+	testParseFailureMsg(t, `{% func F() %}{% func g(a int = 1) %}{% endfunc %}{% endfunc %}`,
+		"cannot have args with default values")
+	testParseFailureMsg(t, `{% func F(a int = f()) %}{% endfunc %}`,
+		"must be a constant expression")
+}
+
+func TestParseFuncClosureSuccess(t *testing.T) {
+	// closure defined and called inside a for loop
+	testParseSuccess(t, `{% func a(items []string) %}
+		{% func item(i int, s string) %}<li>{%d i %}: {%s s %}</li>{% endfunc %}
+		{% for i, s := range items %}
+			{%= item(i, s) %}
+			{%=h item(i, s) %}
+		{% endfor %}
+	{% endfunc %}`)
+
+	// closure defined inside a for loop
+	testParseSuccess(t, `{% func a() %}{% for %}{% func b() %}{% return %}{% endfunc %}{%= b() %}{% break %}{% endfor %}{% endfunc %}`)
+
+	// nested closures
+	testParseSuccess(t, `{% func a() %}{% func b() %}{% func c() %}c{% endfunc %}{%= c() %}{% endfunc %}{%= b() %}{% endfunc %}`)
+
+	// loops inside closure
+	testParseSuccess(t, `{% func a() %}{% func b(n int) %}{% for i := 0; i < n; i++ %}{% continue %}{% endfor %}{% endfunc %}{% endfunc %}`)
+}
+
+func TestParseFuncClosureFailure(t *testing.T) {
+	// method closure
+	testParseFailure(t, `{% func a() %}{% func (s *S) b() %}{% endfunc %}{% endfunc %}`)
+
+	// break and continue mustn't leave the closure
+	testParseFailure(t, `{% func a() %}{% for %}{% func b() %}{% break %}{% endfunc %}{% endfor %}{% endfunc %}`)
+	testParseFailure(t, `{% func a() %}{% for %}{% func b() %}{% continue %}{% endfunc %}{% endfor %}{% endfunc %}`)
+
+	// missing endfunc for closure
+	testParseFailure(t, `{% func a() %}{% func b() %}{% endfunc %}`)
+
+	// invalid closure definition
+	testParseFailure(t, `{% func a() %}{% func b %}{% endfunc %}{% endfunc %}`)
+}
+
+func TestParseIfInitStmt(t *testing.T) {
+	// if with init statement
+	testParseCode(t, `{% func f(m map[string]int) %}{% if v, ok := m["a"]; ok %}{%d v %}{% endif %}{% endfunc %}`,
+		`if v, ok := m["a"]; ok {`)
+
+	// elseif with init statement
+	testParseCode(t, `{% func f(m map[string]int) %}{% if len(m) == 0 %}{% elseif v, ok := m["a"]; ok %}{%d v %}{% else %}{%d len(m) %}{% endif %}{% endfunc %}`,
+		`if len(m) == 0 {`, `} else if v, ok := m["a"]; ok {`, "qw422016.N().D(v)", "} else {")
+	testParseCode(t, `{% func f() %}{% if n := a(); n > 0 %}{% elseif k := b(n); k > n %}{%d k %}{% endif %}{% endfunc %}`,
+		`if n := a(); n > 0 {`, `} else if k := b(n); k > n {`)
+
+	// empty elseif condition
+	testParseFailure(t, `{% func f() %}{% if a %}{% elseif %}{% endif %}{% endfunc %}`)
+
+	// invalid elseif statements
+	testParseFailure(t, `{% func f() %}{% if a %}{% elseif v := 1 %}{% endif %}{% endfunc %}`)
+	testParseFailure(t, `{% func f() %}{% if a %}{% elseif v, ok := m[k] ok %}{% endif %}{% endfunc %}`)
+	testParseFailure(t, `{% func f() %}{% if a %}{% elseif b { %}{% endif %}{% endfunc %}`)
+}
+
+func TestParseIfElseOrder(t *testing.T) {
+	// elif is an alias for elseif
+	testParseCode(t, `{% func f(n int) %}{% if n == 1 %}one{% elif n == 2 %}two{% elseif n == 3 %}three{% else %}many{% endif %}{% endfunc %}`,
+		"if n == 1 {", "} else if n == 2 {", "} else if n == 3 {", "} else {")
+	testParseCode(t, `{% func f(m map[string]int) %}{% if len(m) == 0 %}{% elif v, ok := m["a"]; ok %}{%d v %}{% endif %}{% endfunc %}`,
+		`} else if v, ok := m["a"]; ok {`)
+	testParseFailureMsg(t, `{% func f() %}{% if a %}{% elif %}{% endif %}{% endfunc %}`, "empty elif condition")
+	testParseFailureMsg(t, `{% func f() %}{% if a %}{% elif b { %}{% endif %}{% endfunc %}`, `invalid statement "elif b {"`)
+
+	// duplicate else
+	testParseFailureMsg(t, `{% func f() %}{% if a %}{% else %}{% else %}{% endif %}{% endfunc %}`, "duplicate else branch")
+	testParseFailureMsg(t, `{% func f() %}{% if a %}{% elseif b %}{% else %}{% elseif c %}{% else %}{% endif %}{% endfunc %}`,
+		"unexpected elseif branch found after else branch")
+
+	// elseif and elif after else
+	testParseFailureMsg(t, `{% func f() %}{% if a %}{% else %}{% elseif b %}{% endif %}{% endfunc %}`,
+		"unexpected elseif branch found after else branch")
+	testParseFailureMsg(t, `{% func f() %}{% if a %}{% else %}{% elif b %}{% endif %}{% endfunc %}`,
+		"unexpected elif branch found after else branch")
+
+	// branches outside if
+	testParseFailure(t, `{% func f() %}{% elif a %}{% endfunc %}`)
+	testParseFailure(t, `{% func f() %}{% else %}{% endfunc %}`)
+
+	// elif is a closing tag for the contents skipped after return
+	testParseSuccess(t, `{% func f() %}{% if a %}{% return %}skip{% elif b %}b{% endif %}{% endfunc %}`)
+}
+
+func TestParseUnless(t *testing.T) {
+	// simple unless
+	testParseCode(t, `{% func f(ok bool) %}{% unless ok %}failed{% endunless %}{% endfunc %}`,
+		"if !(ok) {", "qw422016.N().S(`failed`)")
+
+	// unless with else
+	testParseCode(t, `{% func f(n int) %}{% unless n > 0 %}non-positive{% else %}positive{% endunless %}{% endfunc %}`,
+		"if !(n > 0) {", "qw422016.N().S(`non-positive`)", "} else {", "qw422016.N().S(`positive`)")
+
+	// operator precedence is preserved
+	testParseCode(t, `{% func f(a, b bool) %}{% unless a || b %}neither{% endunless %}{% endfunc %}`,
+		"if !(a || b) {")
+
+	// nested unless and if
+	testParseSuccess(t, `{% func f(a, b bool) %}{% unless a %}{% if b %}b{% endif %}{% unless b %}{% return %}skip{% endunless %}{% endunless %}{% endfunc %}`)
+
+	// empty and invalid conditions
+	testParseFailureMsg(t, `{% func f() %}{% unless %}{% endunless %}{% endfunc %}`, "empty unless condition")
+	testParseFailure(t, `{% func f() %}{% unless a { %}{% endunless %}{% endfunc %}`)
+	testParseFailure(t, `{% func f() %}{% unless ok := f(); ok %}{% endunless %}{% endfunc %}`)
+
+	// elseif isn't allowed in unless
+	testParseFailureMsg(t, `{% func f() %}{% unless a %}{% elseif b %}{% endunless %}{% endfunc %}`,
+		"unexpected elseif branch found in \"unless a\"")
+	testParseFailure(t, `{% func f() %}{% unless a %}{% elif b %}{% endunless %}{% endfunc %}`)
+
+	// duplicate else
+	testParseFailure(t, `{% func f() %}{% unless a %}{% else %}{% else %}{% endunless %}{% endfunc %}`)
+
+	// mismatched end tags
+	testParseFailure(t, `{% func f() %}{% unless a %}{% endif %}{% endfunc %}`)
+	testParseFailure(t, `{% func f() %}{% if a %}{% endunless %}{% endfunc %}`)
+	testParseFailureMsg(t, `{% func f() %}{% unless a %}`, "cannot find endunless tag")
+}
+
+func TestParseTernaryOutput(t *testing.T) {
+	// string ternary
+	testParseCode(t, `{% func f(ok bool) %}{%s= ok ? "yes" : "no" %}{% endfunc %}`,
+		"if ok {\n", "qw422016.N().S(\"yes\")\n", "} else {\n", "qw422016.N().S(\"no\")\n")
+	testParseCode(t, `{% func f(a, b string) %}{%s len(a) > len(b) ? a : b %}{% endfunc %}`,
+		"if len(a) > len(b) {\n", "qw422016.E().S(a)\n", "qw422016.E().S(b)\n")
+
+	// int ternary
+	testParseCode(t, `{% func f(n int) %}{%d n < 0 ? -n : n %}{% endfunc %}`,
+		"if n < 0 {\n", "qw422016.N().D(-n)\n", "qw422016.N().D(n)\n")
+
+	// float ternary with precision
+	testParseCode(t, `{% func f(x float64) %}{%f.2 x > 1 ? x : 1 %}{% endfunc %}`,
+		"qw422016.N().FPrec(x, 2)\n", "qw422016.N().FPrec(1, 2)\n")
+
+	// colons and question marks in literals, brackets and braces don't trigger the rewrite
+	testParseCode(t, `{% func f() %}{%s "a?b" %}{%s "a?b:c" %}{%s= string('?') %}{% endfunc %}`,
+		`qw422016.E().S("a?b")`, `qw422016.E().S("a?b:c")`, `qw422016.N().S(string('?'))`)
+	testParseCode(t, `{% func f(s string) %}{%s s[1:] %}{%d map[string]int{"a?": 1}["a?"] %}{% endfunc %}`,
+		"qw422016.E().S(s[1:])", `qw422016.N().D(map[string]int{"a?": 1}["a?"])`)
+	testParseCode(t, `{% func f(ok bool, s string) %}{%s ok ? s[:1] : "b:c?" %}{% endfunc %}`,
+		"if ok {\n", "qw422016.E().S(s[:1])\n", `qw422016.E().S("b:c?")`)
+
+	// invalid ternaries
+	testParseFailureMsg(t, `{% func f() %}{%s ok ? "yes" %}{% endfunc %}`, "missing ':' after '?'")
+	testParseFailure(t, `{% func f() %}{%s a ? b ? c : d : e %}{% endfunc %}`)
+	testParseFailure(t, `{% func f() %}{%s a ? b : c : d %}{% endfunc %}`)
+	testParseFailure(t, `{% func f() %}{%s ? a : b %}{% endfunc %}`)
+	testParseFailure(t, `{% func f() %}{%s a ? : b %}{% endfunc %}`)
+	testParseFailure(t, `{% func f() %}{%s a { ? b : c %}{% endfunc %}`)
+	testParseFailure(t, `{% func f() %}{%s a ? b { : c %}{% endfunc %}`)
+}
+
+func TestParseFuncEscapeMode(t *testing.T) {
+	// html and text funcs in the same file
+	code, err := CompileString(`{% func html H(s string) %}{%s s %}{%v s %}{%q s %}{% endfunc %}
+{% func text T(s string) %}{%s s %}{%v s %}{%q s %}{%d 1 %}{% endfunc %}
+{% func D(s string) %}{%s s %}{%v s %}{%q s %}{% endfunc %}`, "foobar.qtpl")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for name, expectedFilter := range map[string]string{"H": "E", "T": "N", "D": "E"} {
+		n := strings.Index(code, "func Stream"+name+"(")
+		if n < 0 {
+			t.Fatalf("cannot find Stream%s in the compiled code:\n%s", name, code)
+		}
+		body := code[n:]
+		body = body[:strings.Index(body, "\n}\n")]
+		for _, s := range []string{"S(s)", "V(s)", "Q(s)"} {
+			expected := "qw422016." + expectedFilter + "()." + s
+			if !strings.Contains(body, expected) {
+				t.Fatalf("cannot find %q in Stream%s:\n%s", expected, name, body)
+			}
+		}
+	}
+
+	// the mode doesn't leak into the next func
+	testParseCode(t, `{% func text T(s string) %}{%s s %}{% endfunc %}{% func D(s string) %}{%s= s %}{%s s %}{% endfunc %}`,
+		"qw422016.N().S(s)\n//line ./foobar.tpl:1\n}",
+		"func StreamD(qw422016 *qt422016.Writer, s string) {\n\t//line ./foobar.tpl:1\n\tqw422016.N().S(s)\n\t//line ./foobar.tpl:1\n\tqw422016.E().S(s)\n")
+
+	// nested funcs inherit the mode unless it is overridden
+	testParseCode(t, `{% func text T(s string) %}{% func a() %}{%s s %}{% endfunc %}{% func html b() %}{%s s %}{% endfunc %}{%s s %}{% endfunc %}`,
+		"streama := func(qw422016 *qt422016.Writer) {\n\t\t//line ./foobar.tpl:1\n\t\tqw422016.N().S(s)\n",
+		"streamb := func(qw422016 *qt422016.Writer) {\n\t\t//line ./foobar.tpl:1\n\t\tqw422016.E().S(s)\n",
+		"_ = writeb\n\t//line ./foobar.tpl:1\n\tqw422016.N().S(s)\n")
+
+	// conflicting modifiers
+	testParseFailure(t, `{% func html text F() %}{% endfunc %}`)
+}
+
+func TestParseBracesInLiterals(t *testing.T) {
+	testParseCode(t, `{% func f(s string) %}{% if s == "}" %}{% elseif s == "{" %}{% endif %}{% endfunc %}`,
+		`if s == "}" {`, `} else if s == "{" {`)
+	testParseCode(t, "{% func f(r rune) %}{% if r == '}' %}{% endif %}{% for _, c := range `}}` %}{% endfor %}{% endfunc %}",
+		"if r == '}' {", "for _, c := range `}}` {")
+	testParseCode(t, "{% func f() %}{% code s := `{\n}` + \"}\" %}{%s= s %}{% endfunc %}",
+		"s := `{\n}` + \"}\"")
+	testParseCode(t, `{% code var braces = map[rune]string{'}': "}", '{': "{"} %}`,
+		`var braces = map[rune]string{'}': "}", '{': "{"}`)
+	testParseCode(t, `{% func f(n int) %}{%s fmt.Sprintf("%d}%%", n) %}{% endfunc %}`,
+		`qw422016.E().S(fmt.Sprintf("%d}%%", n))`)
+}
+
+func TestParseOutputTagSuccess(t *testing.T) {
+	// identifier
+	testParseSuccess(t, "{%func a()%}{%s foobar %}{%endfunc%}")
+
+	// method call
+	testParseSuccess(t, "{%func a()%}{%s foo.bar.baz(a, b, &A{d:e}) %}{%endfunc%}")
+
+	// inline function call
+	testParseSuccess(t, "{%func f()%}{%s func() string { return foo.bar(baz, aaa) }() %}{%endfunc%}")
+
+	// map
+	testParseSuccess(t, `{%func f()%}{%v map[int]string{1:"foo", 2:"bar"} %}{%endfunc%}`)
+
+	// jsons-safe string
+	testParseSuccess(t, `{% func f() %}{%j "foo\nbar" %}{%endfunc%}`)
+
+	// url-encoded string
+	testParseSuccess(t, `{% func A() %}{%u "fooab" %}{%endfunc%}`)
+
+	// attribute value
+	testParseCode(t, `{% func f(s string, z []byte) %}<a title="{%a s %}" href="{%a= s %}" class="{%az z %}">{% endfunc %}`,
+		"qw422016.N().A(s)\n", "qw422016.N().AZ(z)\n")
+
+	// js string
+	testParseCode(t, `{% func f(s string) %}<script>var s = "{%js s %}", t = '{%js= s + "x" %}';</script>{% endfunc %}`,
+		"qw422016.N().JS(s)\n", "qw422016.N().JS(s + \"x\")\n")
+
+	// xml
+	testParseCode(t, `{% func f(s string, z []byte) %}<item title="{%x s %}">{%x= s %}{%xz z %}</item>{% endfunc %}`,
+		"qw422016.N().X(s)\n", "qw422016.N().XZ(z)\n")
+
+	// css
+	testParseCode(t, `{% func f(color string) %}<p style="color: {%css color %}">{% endfunc %}`,
+		"qw422016.N().CSS(color)\n")
+	testParseCode(t, `{% func f(s string) %}<style>p { font-family: {%css= trim s %} }</style>{% endfunc %}`,
+		"qw422016.N().CSS(qt422016.Trim(s))\n")
+}
+
+func TestParseCDATA(t *testing.T) {
+	testParseCode(t, "{% func f(s string) %}<d>{% cdata %}<b>{%s s %}{%=h g() %}{% endcdata %}</d>{% endfunc %}",
+		"qw422016.N().S(`<d>`)\n",
+		"\tqw422016.N().S(`<![CDATA[`)\n",
+		"\t\tqw422016 := qt422016.AcquireCDATAWriter(qw422016)\n",
+		"\t\tqw422016.N().S(`<b>`)\n",
+		"\t\tqw422016.N().S(s)\n",
+		"\t\tqw422016.E().Z(qb422016.B)\n",
+		"\t\tqt422016.ReleaseCDATAWriter(qw422016)\n",
+		"\tqw422016.N().S(`]]>`)\n",
+		"\tqw422016.N().S(`</d>`)\n")
+
+	// html escaping is restored after the block
+	testParseCode(t, "{% func f(s string) %}{% cdata %}{%s s %}{% endcdata %}{%s s %}{% endfunc %}",
+		"\t\tqw422016.N().S(s)\n", "}\n\t//line ./foobar.tpl:1\n\tqw422016.N().S(`]]>`)\n\t//line ./foobar.tpl:1\n\tqw422016.E().S(s)\n")
+
+	// loops inside the block
+	testParseSuccess(t, "{% func f(items []string) %}{% cdata %}{% for _, s := range items %}{% if s == \"\" %}{% break %}{% endif %}{%s s %}{% endfor %}{% endcdata %}{% endfunc %}")
+	testParseSuccess(t, "{% func f(items []string) %}{% cdata %}{% func g() %}{% return %}{% endfunc %}{%= g() %}{% endcdata %}{% endfunc %}")
+
+	// break, continue and return mustn't leave the block unclosed
+	testParseFailure(t, "{% func f() %}{% for %}{% cdata %}{% break %}{% endcdata %}{% endfor %}{% endfunc %}")
+	testParseFailure(t, "{% func f() %}{% for %}{% cdata %}{% continue %}{% endcdata %}{% endfor %}{% endfunc %}")
+	testParseFailureMsg(t, "{% func f() %}{% cdata %}{% return %}{% endcdata %}{% endfunc %}", "found return tag inside cdata block")
+	testParseFailure(t, "{% func f() %}{% cdata %}{% if true %}{% return %}{% endif %}{% endcdata %}{% endfunc %}")
+
+	// missing endcdata
+	testParseFailureMsg(t, "{% func f() %}{% cdata %}foo{% endfunc %}", "expected endcdata to close cdata block opened at ./foobar.tpl:1, found endfunc")
+	testParseFailureMsg(t, "{% func f() %}{% cdata %}foo", "cannot find endcdata tag")
+
+	// unexpected value
+	testParseFailure(t, "{% func f() %}{% cdata foo %}{% endcdata %}{% endfunc %}")
+
+	// cdata outside func
+	testParseFailure(t, "{% cdata %}{% endcdata %}")
+}
+
+func TestParseSpaceless(t *testing.T) {
+	// whitespace between tags is removed, while whitespace inside text is preserved
+	testParseCode(t, "{% func f() %}{% spaceless %}<div>  <span>hello   world</span>\n\t</div> {% endspaceless %}{% endfunc %}",
+		"qw422016.N().S(`<div><span>hello   world</span></div>`)\n")
+
+	// whitespace after '>' is removed before the next text starting with '<'
+	testParseCode(t, "{% func f(s string) %}{% spaceless %}<a>  {% if s != \"\" %} <b>{% endif %}{% endspaceless %}{% endfunc %}",
+		"qw422016.N().S(`<a>`)\n", "qw422016.N().S(`<b>`)\n")
+
+	// whitespace before output tags is preserved
+	testParseCode(t, "{% func f(s string) %}{% spaceless %}<a> {%s s %} <b>{% endspaceless %}{% endfunc %}",
+		"qw422016.N().S(`<a>`)\n", "qw422016.N().S(` `)\n", "qw422016.E().S(s)\n", "qw422016.N().S(` <b>`)\n")
+
+	// whitespace before text not starting with '<' is preserved
+	testParseCode(t, "{% func f() %}{% spaceless %}<a>  {% code x := 1 %}text{%d x %}{% endspaceless %}  <b>{% endfunc %}",
+		"qw422016.N().S(`<a>`)\n", "qw422016.N().S(`text`)\n", "qw422016.N().S(`  <b>`)\n")
+
+	// missing endspaceless
+	testParseFailureMsg(t, "{% func f() %}{% spaceless %}foo{% endfunc %}", "expected endspaceless to close spaceless block opened at ./foobar.tpl:1, found endfunc")
+	testParseFailureMsg(t, "{% func f() %}{% spaceless %}foo", "cannot find endspaceless tag")
+
+	// unexpected value
+	testParseFailure(t, "{% func f() %}{% spaceless foo %}{% endspaceless %}{% endfunc %}")
+}
+
+func TestParseOutputTagEmptyExpression(t *testing.T) {
+	for _, tag := range []string{"s", "s=", "v", "d", "dn", "f", "f.2", "q", "z", "j", "u", "sz", "a", "js"} {
+		testParseFailureMsg(t, "{% func f() %}{%"+tag+" %}{% endfunc %}", "empty expression in "+strings.Split(tag, ".")[0]+" tag at ")
+		testParseFailureMsg(t, "{% func f() %}{%"+tag+"  \n\t %}{% endfunc %}", "empty expression in ")
+	}
+	for _, tag := range []string{"=", "=h", "=u", "=q", "=jh"} {
+		testParseFailureMsg(t, "{% func f() %}{%"+tag+" %}{% endfunc %}", "empty expression in "+tag+" tag at ")
+	}
+}
+
+func TestParseEscapedTagOpen(t *testing.T) {
+	testParseCode(t, "{% func f() %}Use {%% example %} tag{% endfunc %}",
+		"qw422016.N().S(`Use {% example %} tag`)\n")
+	testParseCode(t, "Comment with {%% tag %}\n{% func f() %}{%%{%s x %}{%%%}{% endfunc %}",
+		"// Comment with {% tag %}\n",
+		"qw422016.N().S(`{%`)\n",
+		"qw422016.N().S(`{%%}`)\n")
+}
+
+func TestParseOutputTagNumeric(t *testing.T) {
+	// numbers are written without html escaping
+	for _, tpl := range []string{
+		"{% func f(n int, x float64) %}{%d n %}{%f x %}{%f.2 x %}{% endfunc %}",
+		"{% func f(n int, x float64) %}{%d= n %}{%f= x %}{%f.2= x %}{% endfunc %}",
+		"{% func html f(n int, x float64) %}{%d n %}{%f x %}{%f.2 x %}{% endfunc %}",
+	} {
+		testParseCode(t, tpl, "qw422016.N().D(n)\n", "qw422016.N().F(x)\n", "qw422016.N().FPrec(x, 2)\n")
+		code, err := CompileString(tpl, "./foobar.tpl")
+		if err != nil {
+			t.Fatalf("unexpected error when compiling %q: %s", tpl, err)
+		}
+		if strings.Contains(code, "E().D(") || strings.Contains(code, "E().F") {
+			t.Fatalf("unexpected html escaping of numbers in the code compiled from %q:\n%s", tpl, code)
+		}
+	}
+
+	// d and d= tags produce the same code
+	code, err := CompileString("{% func f(n int) %}{%d n %}{% endfunc %}", "./foobar.tpl")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	codeUnescaped, err := CompileString("{% func f(n int) %}{%d= n %}{% endfunc %}", "./foobar.tpl")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if code != codeUnescaped {
+		t.Fatalf("unexpected code for d= tag\n%s\nExpecting\n%s", codeUnescaped, code)
+	}
+}
+
+func TestParseOutputTagValueType(t *testing.T) {
+	testParseCode(t, "{% func f() %}{%v:string s %}{%v:string= s %}{% endfunc %}",
+		"qw422016.E().S(s)\n", "qw422016.N().S(s)\n")
+	testParseCode(t, "{% func f() %}{%v:int n %}{%v:int= n %}{% endfunc %}",
+		"qw422016.N().D(n)\n")
+	testParseCode(t, "{% func f() %}{%v:float x %}{% endfunc %}",
+		"qw422016.N().F(x)\n")
+
+	// specialized tags work together with ternary and discarded results
+	testParseCode(t, "{% func f() %}{%v:int ok ? 1 : 2 %}{%v:string m[k], _ %}{% endfunc %}",
+		"qw422016.N().D(1)\n", "qw422016.E().S(qv422016)\n")
+
+	// stringer values are written via String() without reflection
+	testParseCode(t, "{% func f() %}{%v:stringer x %}{%v:stringer= x.y %}{% endfunc %}",
+		"qw422016.E().S(x.String())\n", "qw422016.N().S(x.y.String())\n")
+	testParseCode(t, "{% func f() %}{%v:stringer *p %}{%v:stringer lookup(k), _ %}{% endfunc %}",
+		"qw422016.E().S((*p).String())\n", "qw422016.E().S(qv422016.String())\n")
+	testParseCode(t, "{% func f() %}{%v:stringer ok ? x : y %}{%v:stringer trim x %}{% endfunc %}",
+		"qw422016.E().S(x.String())\n", "qw422016.E().S(y.String())\n", "qw422016.E().S(qt422016.Trim(x.String()))\n")
+
+	testParseFailureMsg(t, "{% func f() %}{%v:bool ok %}{% endfunc %}", `unsupported type "bool" in "v:bool" tag; supported types: string, int, float, stringer`)
+	testParseFailureMsg(t, "{% func f() %}{%v: x %}{% endfunc %}", `unsupported type "" in "v:" tag`)
+	testParseFailureMsg(t, "{% func f() %}{%v:int %}{% endfunc %}", "empty expression in d tag")
+}
+
+func TestParseOutputTagDiscardedResults(t *testing.T) {
+	testParseSuccess(t, `{% func f() %}{%s lookup(key), _ %}{% endfunc %}`)
+	testParseSuccess(t, `{% func f() %}{%s= lookup(key), _ %}{% endfunc %}`)
+	testParseSuccess(t, `{% func f() %}{%d strconv.Atoi(s), _ %}{% endfunc %}`)
+	testParseSuccess(t, `{% func f() %}{%f.2 x.Parse(a, b), _, _ %}{% endfunc %}`)
+	testParseSuccess(t, `{% func f() %}{%v m["foo"], _ %}{% endfunc %}`)
+
+	testParseCode(t, `{% func f() %}{%s= lookup(key), _ %}{% endfunc %}`,
+		"qv422016, _ := lookup(key)", "qw422016.N().S(qv422016)")
+	testParseCode(t, `{% func f() %}{%d parse(s), _, _ %}{% endfunc %}`,
+		"qv422016, _, _ := parse(s)", "qw422016.N().D(qv422016)")
+
+	// the first value cannot be discarded
+	testParseFailure(t, `{% func f() %}{%s _, _ %}{% endfunc %}`)
+
+	// only blank identifiers may follow the expression
+	testParseFailure(t, `{% func f() %}{%s lookup(key), ok %}{% endfunc %}`)
+	testParseFailure(t, `{% func f() %}{%s lookup(key), _, b %}{% endfunc %}`)
+}
+
+func TestParseSafeDerefOutputTag(t *testing.T) {
+	testParseSuccess(t, `{% func f() %}{%s? user.Profile.Name %}{% endfunc %}`)
+	testParseSuccess(t, `{% func f() %}{%s?= user.Profile.Name %}{% endfunc %}`)
+	testParseSuccess(t, `{% func f() %}{%d? a.b %}{%f.2? a.b.c %}{%v?= a.b.c.d %}{% endfunc %}`)
+
+	testParseCode(t, `{% func f() %}{%s? user.Profile.Name %}{% endfunc %}`,
+		"if user != nil && user.Profile != nil {", "qw422016.E().S(user.Profile.Name)")
+	testParseCode(t, `{% func f() %}{%f.2?= a.b %}{% endfunc %}`,
+		"if a != nil {", "qw422016.N().FPrec(a.b, 2)")
+
+	// non-selector values
+	testParseFailure(t, `{% func f() %}{%s? user %}{% endfunc %}`)
+	testParseFailure(t, `{% func f() %}{%s? user.Profile().Name %}{% endfunc %}`)
+	testParseFailure(t, `{% func f() %}{%s? users[0].Name %}{% endfunc %}`)
+	testParseFailure(t, `{% func f() %}{%s? %}{% endfunc %}`)
+
+	// non-output tags
+	testParseFailure(t, `{% func f() %}{%=? a.b() %}{% endfunc %}`)
+	testParseFailure(t, `{% func f() %}{%for? %}{%endfor%}{% endfunc %}`)
+}
+
+func TestParseOutputTagFailure(t *testing.T) {
+	// empty tag
+	testParseFailure(t, "{%func f()%}{%s %}{%endfunc%}")
+
+	// multiple arguments
+	testParseFailure(t, "{%func f()%}{%s a, b %}{%endfunc%}")
+
+	// invalid code
+	testParseFailure(t, "{%func f()%}{%s f(a, %}{%endfunc%}")
+	testParseFailure(t, "{%func f()%}{%s Foo{Bar:1 %}{%endfunc%}")
+
+	// unsupported code
+	testParseFailure(t, "{%func f()%}{%s if (a) {} %}{%endfunc%}")
+	testParseFailure(t, "{%func f()%}{%s for {} %}{%endfunc%}")
+}
+
+func TestParseTemplateCodeSuccess(t *testing.T) {
+	// empty code
+	testParseSuccess(t, "{% code %}{% endcode %}")
+	testParseSuccess(t, "{% func f() %}{% code %}{% endcode %}{% endfunc %}")
+
+	// comment
+	testParseSuccess(t, `{% code // foobar %}`)
+	testParseSuccess(t, `{% func f() %}{% code // foobar %}{% endfunc %}`)
+	testParseSuccess(t, `{% code
+		// foo
+		// bar
+	%}`)
+	testParseSuccess(t, `{% func f() %}{% code
+		// foo
+		// bar
+	%}{% endfunc %}`)
+	testParseSuccess(t, `{%
+		code
+		/*
+			foo
+			bar
+		*/
+	%}`)
+	testParseSuccess(t, `{% func f() %}{%
+		code
+		/*
+			foo
+			bar
+		*/
+	%}{% endfunc %}`)
+
+	testParseSuccess(t, `{% code var a int %}`)
+	testParseSuccess(t, `{% func f() %}{% code var a int %}{% endfunc %}`)
+	testParseSuccess(t, `{% func f() %}{% code a := 0 %}{% endfunc %}`)
+	testParseSuccess(t, `{% func f() %}{% code type A struct{} %}{% endfunc %}`)
+
+	// declarations
+	testParseSuccess(t, `{%code
+		// comment
+		type Foo struct {}
+		var b = &Foo{}
+
+		func (f *Foo) Bar() {}
+
+		// yet another comment
+		func Bar(baz int) string {
+			return fmt.Sprintf("%d", baz)
+		}
+	%}`)
+}
+
+func TestParseFuncCodeIndent(t *testing.T) {
+	// all the lines are indented with the func body indentation
+	testParseCode(t, "{% func f() %}{% for %}{% code\n\t\tx := 1\n\t\ty := 2\n\t%}{% endfor %}{% endfunc %}",
+		"\t\tx := 1\n\t\ty := 2\n")
+
+	// the relative indentation is preserved
+	testParseCode(t, "{% func f() %}{% code %}\n\t\tif x {\n\t\t\ty()\n\t\t}\n{% endcode %}{% endfunc %}",
+		"\tif x {\n\t\ty()\n\t}\n")
+
+	// multi-line raw strings are left as is
+	testParseCode(t, "{% func f() %}{% code\n\tx := `a\n  b`\n\ty := x\n%}{% endfunc %}",
+		"\tx := `a\n  b`\n\ty := x\n")
+}
+
+func TestParseTemplateCodeFailure(t *testing.T) {
+	// import inside the code
+	testParseFailure(t, `{% code import "foo" %}`)
+
+	// incomplete code
+	testParseFailure(t, `{% code type A struct { %}`)
+	testParseFailure(t, `{% code func F() { %}`)
+
+	// invalid code
+	testParseFailure(t, `{%code { %}`)
+	testParseFailure(t, `{%code {} %}`)
+	testParseFailure(t, `{%code ( %}`)
+	testParseFailure(t, `{%code () %}`)
+}
+
+func TestParseImportSuccess(t *testing.T) {
+	// single line import
+	testParseSuccess(t, `{% import "github.com/foo/bar" %}`)
+
+	// multiline import
+	testParseSuccess(t, `{% import (
+		"foo"
+		xxx "bar/baz/aaa"
+
+		"yyy.com/zzz"
+	) %}`)
+
+	// multiple imports
+	testParseSuccess(t, `{% import "foo" %}
+		baaas
+		{% import (
+			"bar"
+			"baasd"
+		)
+		%}
+		sddf
+	`)
+}
+
+func TestParseImportFailure(t *testing.T) {
+	// empty import
+	testParseFailure(t, `{%import %}`)
+
+	// invalid import
+	testParseFailure(t, `{%import foo %}`)
+
+	// non-import code
+	testParseFailure(t, `{%import {"foo"} %}`)
+	testParseFailure(t, `{%import "foo"
+		type A struct {}
+	%}`)
+	testParseFailure(t, `{%import type a struct{} %}`)
+}
+
+func TestParseFailure(t *testing.T) {
+	// unknown tag
+	testParseFailure(t, "{% foobar %}")
+
+	// unexpected tag outside func
+	testParseFailure(t, "aaa{% for %}bbb{%endfor%}")
+	testParseFailure(t, "{% return %}")
+	testParseFailure(t, "{% break %}")
+	testParseFailure(t, "{% if 1==1 %}aaa{%endif%}")
+	testParseFailure(t, "{%s abc %}")
+	testParseFailure(t, "{%v= aaaa(xx) %}")
+	testParseFailure(t, "{%= a() %}")
+
+	// import after func and/or code
+	testParseFailure(t, `{%code var i = 0 %}{%import "fmt"%}`)
+	testParseFailure(t, `{%func f()%}{%endfunc%}{%import "fmt"%}`)
+
+	// missing endfunc
+	testParseFailure(t, "{%func a() %}aaaa")
+
+	// empty func name
+	testParseFailure(t, "{% func () %}aaa{% endfunc %}")
+	testParseFailure(t, "{% func (a int, b string) %}aaa{% endfunc %}")
+
+	// empty func arguments
+	testParseFailure(t, "{% func aaa %}aaa{% endfunc %}")
+
+	// func with anonymous argument
+	testParseFailure(t, "{% func a(x int, string) %}{%endfunc%}")
+
+	// func with incorrect arguments' list
+	testParseFailure(t, "{% func x(foo, bar) %}{%endfunc%}")
+	testParseFailure(t, "{% func x(foo bar baz) %}{%endfunc%}")
+
+	// empty if condition
+	testParseFailure(t, "{% func a() %}{% if    %}aaaa{% endif %}{% endfunc %}")
+
+	// else with content
+	testParseFailure(t, "{% func a() %}{% if 3 == 4%}aaaa{% else if 3 ==  5 %}bug{% endif %}{% endfunc %}")
+
+	// missing endif
+	testParseFailure(t, "{%func a() %}{%if foo %}aaa{% endfunc %}")
+
+	// missing endfor
+	testParseFailure(t, "{%func a()%}{%for %}aaa{%endfunc%}")
+
+	// break outside for
+	testParseFailure(t, "{%func a()%}{%break%}{%endfunc%}")
+
+	// invalid if condition
+	testParseFailure(t, "{%func a()%}{%if a = b %}{%endif%}{%endfunc%}")
+	testParseFailure(t, "{%func f()%}{%if a { %}{%endif%}{%endfunc%}")
+
+	// invalid for
+	testParseFailure(t, "{%func a()%}{%for a = b %}{%endfor%}{%endfunc%}")
+	testParseFailure(t, "{%func f()%}{%for { %}{%endfor%}{%endfunc%}")
+
+	// invalid code inside func
+	testParseFailure(t, "{%func f()%}{%code } %}{%endfunc%}")
+	testParseFailure(t, "{%func f()%}{%code { %}{%endfunc%}")
+
+	// interface inside func
+	testParseFailure(t, "{%func f()%}{%interface A { Foo() } %}{%endfunc%}")
+
+	// interface without name
+	testParseFailure(t, "{%interface  { Foo() } %}")
+
+	// empty interface
+	testParseFailure(t, "{% interface Foo {} %}")
+
+	// invalid interface
+	testParseFailure(t, "{%interface aaaa %}")
+	testParseFailure(t, "{%interface aa { Foo() %}")
+
+	// unnamed method
+	testParseFailure(t, "{%func (s *S) () %}{%endfunc%}")
+
+	// empty method arguments
+	testParseFailure(t, "{%func (s *S) Foo %}{%endfunc %}")
+
+	// method with return values
+	testParseFailure(t, "{%func (s *S) Foo() string %}{%endfunc%}")
+	testParseFailure(t, "{%func (s *S) Bar() (int, string) %}{%endfunc%}")
+}
+
+func TestParserSuccess(t *testing.T) {
+	// empty template
+	testParseSuccess(t, "")
+
+	// template without code and funcs
+	testParseSuccess(t, "foobar\nbaz")
+
+	// template with code
+	testParseSuccess(t, "{%code var a struct {}\nconst n = 123%}")
+
+	// import
+	testParseSuccess(t, `{%import "foobar"%}`)
+	testParseSuccess(t, `{% import (
+	"foo"
+	"bar"
+)%}`)
+	testParseSuccess(t, `{%import "foo"%}{%import "bar"%}`)
+
+	// func
+	testParseSuccess(t, "{%func a()%}{%endfunc%}")
+
+	// func with with condition
+	testParseSuccess(t, "{%func a(x bool)%}{%if x%}foobar{%endif%}{%endfunc%}")
+
+	// func with complex arguments
+	testParseSuccess(t, "{%func f(h1, h2 func(x, y int) string, d int)%}{%endfunc%}")
+
+	// for
+	testParseSuccess(t, "{%func a()%}{%for%}aaa{%endfor%}{%endfunc%}")
+
+	// return
+	testParseSuccess(t, "{%func a()%}{%return%}{%endfunc%}")
+
+	// nested for
+	testParseSuccess(t, "{%func a()%}{%for i := 0; i < 10; i++ %}{%for j := 0; j < i; j++%}aaa{%endfor%}{%endfor%}{%endfunc%}")
+
+	// plain containing arbitrary tags
+	testParseSuccess(t, "{%func f()%}{%plain%}This {%endfunc%} is ignored{%endplain%}{%endfunc%}")
+
+	// comment with arbitrary tags
+	testParseSuccess(t, "{%func f()%}{%comment%}This {%endfunc%} is ignored{%endcomment%}{%endfunc%}")
+
+	// complex if
+	testParseSuccess(t, "{%func a()%}{%if n, err := w.Write(p); err != nil %}{%endif%}{%endfunc%}")
+
+	// complex for
+	testParseSuccess(t, "{%func a()%}{%for i, n := 0, len(s); i < n && f(i); i++ %}{%endfor%}{%endfunc%}")
+
+	// complex code inside func
+	testParseSuccess(t, `{%func f()%}{%code
+		type A struct{}
+		var aa []A
+		for i := 0; i < 10; i++ {
+			aa = append(aa, &A{})
+			if i == 42 {
+				break
+			}
+		}
+		return
+	%}{%endfunc%}`)
+
+	// break inside for loop
+	testParseSuccess(t, `{%func f()%}{%for%}
+		{% if a() %}
+			{% break
+  	 %}
+		{% 	
+else   
+%}
+			{% return   %}
+		{% endif %}
+	{%endfor%}{%endfunc%}`)
+
+	// interface
+	testParseSuccess(t, "{%interface Foo { Bar()\nBaz() } %}")
+	testParseSuccess(t, "{%iface Foo { Bar()\nBaz() } %}")
+
+	// method
+	testParseSuccess(t, "{%func (s *S) Foo(bar, baz string) %}{%endfunc%}")
+}
+
+func TestCompileString(t *testing.T) {
+	code, err := CompileString(`{% func Hi() %}hello{% endfunc %}`, "templates/hi.qtpl")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for _, s := range []string{
+		"package templates\n",
+		"func StreamHi(qw422016 *qt422016.Writer) {",
+		"func WriteHi(qq422016 qtio422016.Writer) {",
+		"func Hi() string {",
+		"qw422016.N().S(`hello`)",
+	} {
+		if !strings.Contains(code, s) {
+			t.Fatalf("cannot find %q in the compiled code:\n%s", s, code)
+		}
+	}
+
+	// invalid template
+	if _, err = CompileString(`{% func Hi() %}hello`, "templates/hi.qtpl"); err == nil {
+		t.Fatalf("expecting error for the template without endfunc")
+	}
+}
+
+func TestCompileStringDeterministic(t *testing.T) {
+	src := `{% import "fmt" %}
+{% import (
+	"strings"
+	str "strconv"
+) %}
+{% import "io" %}
+{% const (
+	a = 1
+	b = 2
+) %}
+{% func ctx Page(items []string) %}
+	{% with s = strings.Join(items, ","), n = len(items) %}{%s s %}{%d n %}{% endwith %}
+	{% for i in range(a, b) %}{%s str.Itoa(i) %}{%s fmt.Sprint(i) %}{% endfor %}
+	{%= row() %}
+{% endfunc %}
+{% func ctx row() %}{% code var _ io.Writer %}{% endfunc %}`
+	testCompileStringDeterministic(t, src, "templates/page.qtpl", nil)
+	testCompileStringDeterministic(t, src, "templates/page.qtpl", &ParseOptions{
+		AppendFuncs: true,
+		ErrFuncs:    true,
+	})
+
+	data, err := ioutil.ReadFile("../testdata/templates/integration.qtpl")
+	if err != nil {
+		t.Fatalf("cannot read integration template: %s", err)
+	}
+	testCompileStringDeterministic(t, string(data), "../testdata/templates/integration.qtpl", nil)
+}
+
+func testCompileStringDeterministic(t *testing.T, src, filePath string, opts *ParseOptions) {
+	expectedCode, err := CompileStringWithOptions(src, filePath, opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for i := 0; i < 10; i++ {
+		code, err := CompileStringWithOptions(src, filePath, opts)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if code != expectedCode {
+			t.Fatalf("the compiled code differs between runs for %q:\n%s\nExpecting\n%s", filePath, code, expectedCode)
+		}
+	}
+}
+
+func TestCompileStringDelims(t *testing.T) {
+	src := `Page template.
+{% import "fmt" %}
+{% func Page(items []string) %}
+	{% for i, item := range items %}
+		{% if i > 0 %}, {% endif %}
+		{%s fmt.Sprintf("%d%%", i) %}{%q item %}
+	{% endfor %}
+	{% plain %}{% raw %}{% endplain %}
+{% endfunc %}`
+	expectedCode, err := CompileString(src, "templates/page.qtpl")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !strings.Contains(expectedCode, "qw422016.E().S(fmt.Sprintf(\"%d%%\", i))") {
+		t.Fatalf("unexpected compiled code:\n%s", expectedCode)
+	}
+
+	for _, d := range [][2]string{{"<%", "%>"}, {"[[", "]]"}} {
+		// the original delimiters become plain text in plain blocks
+		tplSrc := strings.Replace(src, "{% raw %}", "<<RAW>>", 1)
+		tplSrc = strings.Replace(tplSrc, "{%", d[0], -1)
+		tplSrc = strings.Replace(tplSrc, "%}", d[1], -1)
+		tplSrc = strings.Replace(tplSrc, "<<RAW>>", "{% raw %}", 1)
+		opts := &ParseOptions{
+			TagOpen:  d[0],
+			TagClose: d[1],
+		}
+		code, err := CompileStringWithOptions(tplSrc, "templates/page.qtpl", opts)
+		if err != nil {
+			t.Fatalf("unexpected error for delimiters %q: %s", d, err)
+		}
+		if code != expectedCode {
+			t.Fatalf("unexpected code for delimiters %q:\n%s\nExpecting\n%s", d, code, expectedCode)
+		}
+	}
+
+	// invalid delimiters
+	for _, d := range [][2]string{{"<", ">"}, {"<%%", "%>"}, {"<%", ""}, {"<a", "a>"}, {"< ", " >"}, {"<=", "=>"}} {
+		opts := &ParseOptions{
+			TagOpen:  d[0],
+			TagClose: d[1],
+		}
+		if _, err := CompileStringWithOptions(src, "templates/page.qtpl", opts); err == nil {
+			t.Fatalf("expecting error for delimiters %q", d)
+		}
+	}
+}
+
+func TestParseMustacheMode(t *testing.T) {
+	f := func(src, expectedSrc string, opts *ParseOptions) {
+		t.Helper()
+		code, err := CompileStringWithOptions(src, "./foobar.tpl", opts)
+		if err != nil {
+			t.Fatalf("unexpected error when compiling %q: %s", src, err)
+		}
+		expectedCode, err := CompileString(expectedSrc, "./foobar.tpl")
+		if err != nil {
+			t.Fatalf("unexpected error when compiling %q: %s", expectedSrc, err)
+		}
+		if code != expectedCode {
+			t.Fatalf("unexpected code for %q:\n%s\nExpecting\n%s", src, code, expectedCode)
+		}
+	}
+	opts := &ParseOptions{
+		MustacheMode: true,
+	}
+
+	f(`{% func F(name string, items []int) %}
+	Hello, {{ name }}! {{{name}}}
+	{% for _, n := range items %}<li>{{ n }}</li>{% endfor %}
+	{{ map[string]int{"a": 1}["a"] }} {{ "}}" }} {{{ "}}}" }}}
+	{ {x} }{%s name %}
+{% endfunc %}`, `{% func F(name string, items []int) %}
+	Hello, {%v name %}! {%v= name %}
+	{% for _, n := range items %}<li>{%v n %}</li>{% endfor %}
+	{%v map[string]int{"a": 1}["a"] %} {%v "}}" %} {%v= "}}}" %}
+	{ {x} }{%s name %}
+{% endfunc %}`, opts)
+
+	// custom output tag
+	f(`{% func F(name string) %}{{ name }}{{{ name }}}{% endfunc %}`,
+		`{% func F(name string) %}{%s name %}{%s= name %}{% endfunc %}`,
+		&ParseOptions{
+			MustacheMode: true,
+			MustacheTag:  "s",
+		})
+
+	// custom delimiters
+	f(`<% func F(name string) %>{{ name }}<%s name %><% endfunc %>`,
+		`{% func F(name string) %}{%v name %}{%s name %}{% endfunc %}`,
+		&ParseOptions{
+			MustacheMode: true,
+			TagOpen:      "<%",
+			TagClose:     "%>",
+		})
+
+	// plain blocks keep mustache tags as is
+	testParseCodeWithOptions := func(src, substr string) {
+		t.Helper()
+		code, err := CompileStringWithOptions(src, "./foobar.tpl", opts)
+		if err != nil {
+			t.Fatalf("unexpected error when compiling %q: %s", src, err)
+		}
+		if !strings.Contains(code, substr) {
+			t.Fatalf("missing %q in the code compiled from %q:\n%s", substr, src, code)
+		}
+	}
+	testParseCodeWithOptions(`{% func F() %}{% plain %}{{ x }}{% endplain %}{% endfunc %}`, "qw422016.N().S(`{{ x }}`)\n")
+
+	// mustache tags are ordinary text by default
+	testParseCode(t, `{% func F() %}{{ x }}{% endfunc %}`, "qw422016.N().S(`{{ x }}`)\n")
+
+	// invalid mustache tags
+	for _, src := range []string{
+		`{% func F() %}{{ x {% endfunc %}`,
+		`{% func F() %}{{{ x }}{% endfunc %}`,
+		`{% func F() %}{{ }}{% endfunc %}`,
+		`{% func F() %}{{`,
+	} {
+		if _, err := CompileStringWithOptions(src, "./foobar.tpl", opts); err == nil {
+			t.Fatalf("expecting error for %q", src)
+		}
+	}
+
+	// invalid options
+	for _, o := range []*ParseOptions{
+		{MustacheMode: true, MustacheTag: "s="},
+		{MustacheMode: true, MustacheTag: "foo"},
+		{MustacheMode: true, TagOpen: "{{", TagClose: "}}"},
+	} {
+		if _, err := CompileStringWithOptions(`{% func F() %}{% endfunc %}`, "./foobar.tpl", o); err == nil {
+			t.Fatalf("expecting error for options %+v", o)
+		}
+	}
+}
+
+func TestParsePreserveComments(t *testing.T) {
+	src := `{% func F(items []string) %}
+	{%# note %}
+	<ul>{%# before items %}{% for _, s := range items %}{%#inside loop%}<li>{%s s %}</li>{% endfor %}</ul>
+	{% comment %}
+		multi-line
+		comment
+	{% endcomment %}
+	{% return %}{%# skipped %}
+{% endfunc %}`
+	code, err := CompileStringWithOptions(src, "./foobar.tpl", &ParseOptions{
+		PreserveComments: true,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for _, s := range []string{
+		"\t// note\n",
+		"<ul>`)\n\t// before items\n",
+		"\t\t// inside loop\n\t\t//line ./foobar.tpl:3\n\t\tqw422016.N().S(`<li>`)\n",
+		"\t// multi-line\n\t// comment\n",
+	} {
+		if !strings.Contains(code, s) {
+			t.Fatalf("cannot find %q in the code compiled with PreserveComments:\n%s", s, code)
+		}
+	}
+	if strings.Contains(code, "skipped") {
+		t.Fatalf("unexpected comment after return tag in the compiled code:\n%s", code)
+	}
+
+	// the text around comments is written as without PreserveComments
+	codeWithoutComments, err := CompileString(src, "./foobar.tpl")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for _, s := range []string{"note", "before items", "inside loop", "multi-line"} {
+		if strings.Contains(codeWithoutComments, s) {
+			t.Fatalf("unexpected comment %q in the code compiled without PreserveComments:\n%s", s, codeWithoutComments)
+		}
+	}
+	commentRe := regexp.MustCompile(`(?m)^\s*// (note|before items|inside loop|multi-line|comment)\n`)
+	if stripped := commentRe.ReplaceAllString(code, ""); stripped != codeWithoutComments {
+		t.Fatalf("unexpected code compiled with PreserveComments\n%s\nExpecting the code without comments\n%s", code, codeWithoutComments)
+	}
+}
+
+func TestParseBanner(t *testing.T) {
+	// See https://golang.org/s/generatedcode
+	generatedRe := regexp.MustCompile(`(?m)^// Code generated .* DO NOT EDIT\.$`)
+
+	src := `{% func F() %}foo{% endfunc %}`
+	code, err := CompileString(src, "templates/page.html.qtpl")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expectedPrefix := "// Code generated by qtc from \"page.html.qtpl\". DO NOT EDIT.\n"
+	if !strings.HasPrefix(code, expectedPrefix) {
+		t.Fatalf("missing %q at the top of the compiled code:\n%s", expectedPrefix, code)
+	}
+	if !generatedRe.MatchString(code) {
+		t.Fatalf("the compiled code doesn't match %q:\n%s", generatedRe, code)
+	}
+
+	// custom banner
+	banner := "// Code generated by mytool from page.html.qtpl. DO NOT EDIT.\n//\n// Copyright Foo Inc."
+	var bb bytes.Buffer
+	code, err = CompileStringWithOptions(src, "templates/page.html.qtpl", &ParseOptions{
+		Banner:        banner,
+		GenBenchmarks: true,
+		Benchmarks:    &bb,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !strings.HasPrefix(code, banner+"\n\n") {
+		t.Fatalf("missing custom banner at the top of the compiled code:\n%s", code)
+	}
+	if strings.Contains(code, "Code generated by qtc") {
+		t.Fatalf("unexpected default banner in the compiled code:\n%s", code)
+	}
+	if !strings.HasPrefix(bb.String(), banner+"\n\npackage templates\n") {
+		t.Fatalf("missing custom banner at the top of the generated benchmarks:\n%s", bb.String())
+	}
+
+	// invalid banner
+	_, err = CompileStringWithOptions(src, "templates/page.html.qtpl", &ParseOptions{Banner: "// foo\nbar"})
+	if err == nil || !strings.Contains(err.Error(), `each banner line must start with //; got "bar"`) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestParseFuncDocComment(t *testing.T) {
+	code, err := CompileString(`Unrelated comment.
+
+Render renders x.
+It is exported.
+{% func Render(x int) %}{%d x %}{% endfunc %}
+
+Separated by the empty line, so it isn't a doc comment.
+
+{% func (p *Page) Body() %}{% endfunc %}`, "templates/doc.qtpl")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for _, s := range []string{
+		"// Unrelated comment.\n\n",
+		"// Render renders x.\n// It is exported.\n//\n//line templates/doc.qtpl:5\nfunc StreamRender(",
+		"// Render renders x.\n// It is exported.\n//\n//line templates/doc.qtpl:5\nfunc WriteRender(",
+		"// Render renders x.\n// It is exported.\n//\n//line templates/doc.qtpl:5\nfunc Render(x int) string {",
+		"// Separated by the empty line, so it isn't a doc comment.\n//\n\n//line templates/doc.qtpl:9\nfunc (p *Page) StreamBody(",
+		"}\n\n//line templates/doc.qtpl:9\nfunc (p *Page) Body() string {",
+	} {
+		if !strings.Contains(code, s) {
+			t.Fatalf("cannot find %q in the compiled code:\n%s", s, code)
+		}
+	}
+}
+
+func TestParseSingleLineComment(t *testing.T) {
+	testParseSuccess(t, `{%# top-level comment %}{% func f() %}{%# comment %}{% endfunc %}`)
+	testParseSuccess(t, `{% func f() %}{% for %}{%# comment %}{% if a %}{%# comment %}{% else %}{%# comment %}{% endif %}{% endfor %}{% endfunc %}`)
+
+	code, err := CompileString("foo{%# top-level secret %}bar{% func F() %}foo{%# secret %}bar{% endfunc %}", "templates/comment.qtpl")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if strings.Contains(code, "secret") {
+		t.Fatalf("comment leaked into the compiled code:\n%s", code)
+	}
+	for _, s := range []string{"// foo\n", "// bar\n", "qw422016.N().S(`foo`)\n\t//line templates/comment.qtpl:1\n\tqw422016.N().S(`bar`)"} {
+		if !strings.Contains(code, s) {
+			t.Fatalf("cannot find %q in the compiled code:\n%s", s, code)
+		}
+	}
+}
+
+func testParseFailure(t *testing.T, str string) {
+	r := bytes.NewBufferString(str)
+	w := &bytes.Buffer{}
+	err := parse(w, r, "./foobar.tpl", "memory")
+	if err == nil {
+		t.Fatalf("expecting error when parsing %q", str)
+	}
+	checkParseErrorKind(t, str, err)
+}
+
+// checkParseErrorKind verifies that err is ParseError with the known kind.
+func checkParseErrorKind(t *testing.T, str string, err error) {
+	t.Helper()
+	var pe *ParseError
+	if !errors.As(err, &pe) {
+		t.Fatalf("expecting ParseError when parsing %q; got %T: %v", str, err, err)
+	}
+	if _, ok := errorKindStrMap[pe.Kind]; !ok {
+		t.Fatalf("unexpected error kind when parsing %q: %q. Error: %s", str, pe.Kind, err)
+	}
+}
+
+func testParseSuccess(t *testing.T, str string) {
+	r := bytes.NewBufferString(str)
+	w := &bytes.Buffer{}
+	if err := parse(w, r, "./foobar.tpl", "memory"); err != nil {
+		t.Fatalf("unexpected error when parsing %q: %s", str, err)
+	}
+}
+
+func TestParseSpaceInStripspace(t *testing.T) {
+	testParseCode(t, "{% func f() %}{% stripspace %}\n\t<b>\n\t\t{% space %}\n\t</b>\n{% endstripspace %}{% endfunc %}",
+		"qw422016.N().S(`<b>`)\n",
+		"qw422016.N().S(` `)\n",
+		"qw422016.N().S(`</b>`)\n")
+}
+
+func TestParserUnindent(t *testing.T) {
+	p := &parser{
+		s:      newScanner(bytes.NewBufferString(""), "./foobar.tpl"),
+		prefix: "\t",
+	}
+	if err := p.unindent(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if p.prefix != "" {
+		t.Fatalf("unexpected prefix %q. Expecting empty prefix", p.prefix)
+	}
+
+	// unbalanced indentation must result in error instead of panic
+	if err := p.unindent(); err == nil {
+		t.Fatalf("expecting error on unbalanced indentation")
+	}
+}
+
+func FuzzParseNestedTags(f *testing.F) {
+	for _, s := range []string{
+		"{% func f() %}{% if a %}{% elseif b %}{% else %}{% endif %}{% endfunc %}",
+		"{% func f() %}{% if a %}{% for %}{% elseif b %}{% endfor %}{% endif %}{% endfunc %}",
+		"{% func f() %}{% for %}{% if a %}{% endfor %}{% endif %}{% endfunc %}",
+		"{% func f() %}{% if a %}{% else %}{% elseif b %}{% endif %}{% endfunc %}",
+		"{% func f() %}{% switch a %}{% case 1 %}{% if b %}{% case 2 %}{% endswitch %}{% endfunc %}",
+		"{% func f() %}{% with a = 1 %}{% if a %}{% endwith %}{% endif %}{% endfunc %}",
+		"{% func f() %}{% cdata %}{% for %}{% endcdata %}{% endfor %}{% endfunc %}",
+		"{% func f() %}{% unless a %}{% elseif b %}{% endunless %}{% endfunc %}",
+		"{% func f() %}{% func g() %}{% if a %}{% endfunc %}{% endif %}{% endfunc %}",
+		"{% func f() %}{%s? a ? b : c %}{%s a ? b : c %}{% endfunc %}",
+		"{% func f() %}{% endif %}{% endfor %}{% endswitch %}{% endfunc %}",
+	} {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		// parse errors are expected, while panics aren't
+		var w bytes.Buffer
+		_ = parse(&w, bytes.NewBufferString(s), "./foobar.tpl", "memory")
+	})
+}
+
+// FuzzParse verifies that CompileString either returns valid Go code
+// or an error for arbitrary templates.
+//
+// Run it with `go test -run=FuzzParse -fuzz=FuzzParse`. The corpus is seeded
+// with the templates from the repository and testdata/fuzz/FuzzParse.
+func FuzzParse(f *testing.F) {
+	for _, pattern := range []string{
+		"testdata/*.qtpl",
+		"testdata/include/*.qtpl",
+		"../testdata/templates/*.qtpl",
+		"../examples/basicserver/templates/*.qtpl",
+	} {
+		paths, err := filepath.Glob(pattern)
+		if err != nil {
+			f.Fatalf("unexpected error for %q: %s", pattern, err)
+		}
+		for _, path := range paths {
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				f.Fatalf("cannot read %q: %s", path, err)
+			}
+			f.Add(string(data))
+		}
+	}
+	f.Fuzz(func(t *testing.T, src string) {
+		code, err := CompileString(src, "testdata/fuzz.qtpl")
+		if err != nil {
+			return
+		}
+		fset := gotoken.NewFileSet()
+		if _, err = goparser.ParseFile(fset, "", code, 0); err != nil {
+			t.Fatalf("invalid code generated for %q: %s\n%s", src, err, code)
+		}
+	})
+}
+
+func TestParseConst(t *testing.T) {
+	// single const
+	testParseCode(t, "{% const MaxItems = 100 %}", "const MaxItems = 100\n")
+	testParseCode(t, "{% const Title string = `{% title %}` %}", "const Title string = `{% title %}`\n")
+
+	// grouped consts
+	testParseCode(t, "{% const ( A = iota; B; C ) %}", "const ( A = iota; B; C )\n")
+	testParseCode(t, "{% const (\n\ta = 1\n\tb = \"%}\"\n) %}", "const (\n\ta = 1\n\tb = \"%}\"\n)\n")
+
+	// consts between funcs are emitted at package scope
+	code, err := CompileString("{% func F() %}{%d MaxItems %}{% endfunc %}\n{% const MaxItems = 10 %}\n{% func G() %}{%s prefix %}{% endfunc %}\n{% const (\n\tprefix = \"p\"\n\tsuffix = \"s\"\n) %}",
+		"templates/const.qtpl")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	f, err := goparser.ParseFile(gotoken.NewFileSet(), "", code, 0)
+	if err != nil {
+		t.Fatalf("cannot parse the generated code: %s\n%s", err, code)
+	}
+	var consts []string
+	for _, d := range f.Decls {
+		gd, ok := d.(*goast.GenDecl)
+		if !ok || gd.Tok != gotoken.CONST {
+			continue
+		}
+		for _, spec := range gd.Specs {
+			for _, n := range spec.(*goast.ValueSpec).Names {
+				consts = append(consts, n.Name)
+			}
+		}
+	}
+	if strings.Join(consts, ",") != "MaxItems,prefix,suffix" {
+		t.Fatalf("unexpected package-level consts %q in the generated code:\n%s", consts, code)
+	}
+
+	// invalid declarations
+	testParseFailureMsg(t, "{% const %}", "empty const declaration")
+	testParseFailureMsg(t, "{% const a %}", "missing value for the first const")
+	testParseFailureMsg(t, "{% const () %}", "missing consts in the declaration")
+	testParseFailure(t, "{% const a = %}")
+	testParseFailure(t, "{% const ( a = 1 %}")
+	testParseFailureMsg(t, "{% const a = 1\nvar b = 2 %}", "unexpected code found after const declaration")
+	testParseFailure(t, "{% const a = 1; func f() {} %}")
+
+	// const inside func
+	testParseFailure(t, "{% func f() %}{% const a = 1 %}{% endfunc %}")
+}
+
+func TestParseMultiLineFuncSignature(t *testing.T) {
+	code, err := CompileString("{% func Render(\n\ta int,\n\tb string,\n) %}{%d a %}{%s b %}{% endfunc %}", "templates/signature.qtpl")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err = goparser.ParseFile(gotoken.NewFileSet(), "", code, 0); err != nil {
+		t.Fatalf("cannot parse the generated code: %s\n%s", err, code)
+	}
+	for _, s := range []string{
+		"func StreamRender(qw422016 *qt422016.Writer, a int, b string) {\n",
+		"func WriteRender(qq422016 qtio422016.Writer, a int, b string) {\n",
+		"func Render(a int, b string) string {\n",
+		"\tStreamRender(qw422016, a, b)\n",
+		"\tWriteRender(qb422016, a, b)\n",
+	} {
+		if !strings.Contains(code, s) {
+			t.Fatalf("cannot find %q in the generated code:\n%s", s, code)
+		}
+	}
+}
+
+func TestParsePrintf(t *testing.T) {
+	testParseCode(t, `{% func f(n int) %}{% printf "%d items", n %}{% endfunc %}`,
+		"qw422016.E().Printf(\"%d items\", n)\n")
+	testParseCode(t, "{% func f(args []interface{}) %}{% printf `%s=%v`, args... %}{% endfunc %}",
+		"qw422016.E().Printf(`%s=%v`, args...)\n")
+	testParseCode(t, `{% func f() %}{% printf "%%}" %}{% endfunc %}`,
+		"qw422016.E().Printf(\"%%}\")\n")
+
+	// no html escaping in text funcs and cdata
+	testParseCode(t, `{% func text f(n int) %}{% printf "%d", n %}{% endfunc %}`,
+		"qw422016.N().Printf(\"%d\", n)\n")
+	testParseCode(t, `{% func f(n int) %}{% cdata %}{% printf "%d", n %}{% endcdata %}{% endfunc %}`,
+		"qw422016.N().Printf(\"%d\", n)\n")
+
+	// invalid format
+	testParseFailureMsg(t, `{% func f() %}{% printf %}{% endfunc %}`, "missing format string in printf tag")
+	testParseFailureMsg(t, `{% func f(format string) %}{% printf format, 1 %}{% endfunc %}`, "printf format must be a string literal")
+	testParseFailureMsg(t, `{% func f() %}{% printf 123 %}{% endfunc %}`, "printf format must be a string literal")
+	testParseFailure(t, `{% func f() %}{% printf "%d" x %}{% endfunc %}`)
+
+	// outside func
+	testParseFailure(t, `{% printf "foo" %}`)
+}
+
+func TestParseMultiLineOutputTag(t *testing.T) {
+	// Newlines inside the expression are preserved in the generated code,
+	// while the following line comments refer the proper template lines.
+	testParseCode(t, "{% func f(a, b int) %}{%s= fmt.Sprintf(\n\t\"%d-%d\",\n\ta, b) %}\n{%d a %}{% endfunc %}",
+		"qw422016.N().S(fmt.Sprintf(\n\t\"%d-%d\",\n\ta, b))\n",
+		"//line ./foobar.tpl:3\n\tqw422016.N().S(`\n`)\n",
+		"//line ./foobar.tpl:4\n\tqw422016.N().D(a)\n")
+	testParseCode(t, "{% func f(a, b int) %}{%d a +\n\tb %}{%=h g(\n\ta) %}{% endfunc %}",
+		"qw422016.N().D(a +\n\tb)\n", "writeg(qb422016, \n\ta)\n")
+	testParseCode(t, "{% func f(n int) %}{%s n > 0 ?\n\t\"pos\" :\n\t\"neg\" %}{% endfunc %}",
+		"if n > 0 {\n", "qw422016.E().S(\"pos\")\n", "qw422016.E().S(\"neg\")\n")
+	testParseCode(t, "{% func f(x string) %}{%s= x + // comment\n\t\"a\" %}{% endfunc %}",
+		"qw422016.N().S(x + // comment\n\t\"a\")\n")
+
+	// The generated code compiles
+	code, err := CompileString("{% import \"fmt\" %}{% func F(a, b int) %}{%s= fmt.Sprintf(\n\t\"%d-%d\",\n\ta, b) %}{% endfunc %}", "templates/multiline.qtpl")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !strings.Contains(code, "qw422016.N().S(fmt.Sprintf(\n\t\t\"%d-%d\",\n\t\ta, b))\n") {
+		t.Fatalf("cannot find multi-line expression in the compiled code:\n%s", code)
+	}
+}
+
+func TestParseOutputFilters(t *testing.T) {
+	// escaping is applied after trimming
+	testParseCode(t, "{% func f(s string) %}{%s trim s %}{% endfunc %}",
+		"qw422016.E().S(qt422016.Trim(s))\n")
+	testParseCode(t, "{% func f(s string) %}{%s= trim s %}{%q trim s %}{% endfunc %}",
+		"qw422016.N().S(qt422016.Trim(s))\n", "qw422016.E().Q(qt422016.Trim(s))\n")
+	testParseCode(t, "{% func f(b []byte) %}{%z trim b %}{%uz= trim b %}{% endfunc %}",
+		"qw422016.E().Z(qt422016.TrimZ(b))\n", "qw422016.N().UZ(qt422016.TrimZ(b))\n")
+	testParseCode(t, "{% func f(s string) %}{%s trimset \".,\" s %}{%z trimset `/` []byte(s) %}{% endfunc %}",
+		"qw422016.E().S(qt422016.TrimSet(s, \".,\"))\n", "qw422016.E().Z(qt422016.TrimSetZ([]byte(s), `/`))\n")
+
+	// filters are composable and applied from right to left
+	testParseCode(t, "{% func f(s string) %}{%s trim trimset \".\"  s %}{% endfunc %}",
+		"qw422016.E().S(qt422016.Trim(qt422016.TrimSet(s, \".\")))\n")
+
+	// filters are applied to ternary branches and to the first of multiple values
+	testParseCode(t, "{% func f(ok bool) %}{%s trim ok ? \" a \" : \" b \" %}{% endfunc %}",
+		"qw422016.E().S(qt422016.Trim(\" a \"))\n", "qw422016.E().S(qt422016.Trim(\" b \"))\n")
+	testParseCode(t, "{% func f(m map[string]string) %}{%s trim m[\"k\"], _ %}{% endfunc %}",
+		"qv422016, _ := m[\"k\"]\n", "qw422016.E().S(qt422016.Trim(qv422016))\n")
+
+	// variables and funcs named trim are used as usual
+	testParseCode(t, "{% func f(trim string) %}{%s trim %}{%s trim + \"a\" %}{% endfunc %}",
+		"qw422016.E().S(trim)\n", "qw422016.E().S(trim + \"a\")\n")
+	testParseCode(t, "{% func f() %}{%s trim (\"a\") %}{% endfunc %}",
+		"qw422016.E().S(trim (\"a\"))\n")
+
+	// invalid filters
+	testParseFailureMsg(t, "{% func f(n int) %}{%d trim n %}{% endfunc %}", "trim filter cannot be used in d tag")
+	testParseFailureMsg(t, "{% func f(v interface{}) %}{%v trimset \".\" v %}{% endfunc %}", "trimset filter cannot be used in v tag")
+	testParseFailureMsg(t, "{% func f(s string) %}{%s trimset s %}{% endfunc %}", "trimset filter must be followed by string literal")
+	testParseFailureMsg(t, "{% func f(s string) %}{%s trimset \".\" %}{% endfunc %}", "missing value after trimset")
+	testParseFailure(t, "{% func f(s string) %}{%s trim s s %}{% endfunc %}")
+}
+
+func TestParseMismatchedEndTag(t *testing.T) {
+	// for
+	testParseFailureMsg(t, "{% func f() %}{% for %}{% endif %}{% endfunc %}", "expected endfor to close for loop opened at ./foobar.tpl:1, found endif")
+	testParseFailureMsg(t, "{% func f() %}\n{% for %}{% endunless %}{% endfunc %}", "expected endfor to close for loop opened at ./foobar.tpl:2, found endunless")
+	testParseFailureMsg(t, "{% func f() %}{% for %}{% endswitch %}{% endfunc %}", "expected endfor to close for loop opened at ./foobar.tpl:1, found endswitch")
+	testParseFailureMsg(t, "{% func f() %}{% for %}{% endfunc %}", "expected endfor to close for loop opened at ./foobar.tpl:1, found endfunc")
+
+	// if and unless
+	testParseFailureMsg(t, "{% func f() %}{% if true %}\n{% endfor %}{% endfunc %}", "expected endif to close if statement opened at ./foobar.tpl:1, found endfor")
+	testParseFailureMsg(t, "{% func f() %}{% if true %}{% else %}{% endunless %}{% endfunc %}", "expected endif to close if statement opened at ./foobar.tpl:1, found endunless")
+	testParseFailureMsg(t, "{% func f() %}{% if true %}{% endfunc %}", "expected endif to close if statement opened at ./foobar.tpl:1, found endfunc")
+	testParseFailureMsg(t, "{% func f() %}{% unless true %}{% endif %}{% endfunc %}", "expected endunless to close unless statement opened at ./foobar.tpl:1, found endif")
+
+	// switch
+	testParseFailureMsg(t, "{% func f() %}{% switch %}{% case 1 %}{% endif %}{% endfunc %}", "expected endswitch to close switch statement opened at ./foobar.tpl:1, found endif")
+	testParseFailureMsg(t, "{% func f() %}{% switch %}{% default %}{% endfor %}{% endfunc %}", "expected endswitch to close switch statement opened at ./foobar.tpl:1, found endfor")
+
+	// with and cdata
+	testParseFailureMsg(t, "{% func f() %}{% with x = 1 %}{% endfor %}{% endfunc %}", "expected endwith to close with block opened at ./foobar.tpl:1, found endfor")
+	testParseFailureMsg(t, "{% func f() %}{% cdata %}{% endwith %}{% endfunc %}", "expected endcdata to close cdata block opened at ./foobar.tpl:1, found endwith")
+
+	// func
+	testParseFailureMsg(t, "{% func f() %}{% endfor %}", "expected endfunc to close func opened at ./foobar.tpl:1, found endfor")
+	testParseFailureMsg(t, "\n\n{% func f() %}{% endif %}", "expected endfunc to close func opened at ./foobar.tpl:3, found endif")
+	testParseFailureMsg(t, "{% func f() %}{% func g() %}{% endswitch %}{% endfunc %}{% endfunc %}", "expected endfunc to close func opened at ./foobar.tpl:1, found endswitch")
+
+	// named endfunc and endmacro
+	testParseSuccess(t, "{% func Render() %}foo{% endfunc Render %}")
+	testParseSuccess(t, "{% func Render() %}foo{% endfunc %}")
+	testParseSuccess(t, "{% func (p *Page) Body() %}foo{% endfunc Body %}")
+	testParseSuccess(t, "{% macro badge(n int) %}{%d n %}{% endmacro badge %}")
+	testParseSuccess(t, "{% func F() %}{% func item(s string) %}{%s s %}{% endfunc item %}{% endfunc F %}")
+	testParseFailureMsg(t, "{% func Render() %}\nfoo{% endfunc Header %}", "./foobar.tpl:2:15: endfunc Header at")
+	testParseFailureMsg(t, "{% func Render() %}\nfoo{% endfunc Header %}", "doesn't match func Render defined at ./foobar.tpl:1")
+	testParseFailureMsg(t, "{% macro badge(n int) %}{% endmacro item %}", "endmacro item at")
+	testParseFailureMsg(t, "{% macro badge(n int) %}{% endmacro item %}", "doesn't match macro badge defined at ./foobar.tpl:1")
+	testParseFailureMsg(t, "{% func F() %}{% func item() %}{% endfunc F %}{% endfunc F %}", "doesn't match func item defined at ./foobar.tpl:1")
+	testParseFailureMsg(t, "{% func (p *Page) Body() %}{% endfunc Page %}", "doesn't match func Body defined at ./foobar.tpl:1")
+
+	// nested blocks report the innermost block
+	testParseFailureMsg(t, "{% func f() %}{% for %}\n{% if true %}{% endfor %}{% endif %}{% endfunc %}", "expected endif to close if statement opened at ./foobar.tpl:2, found endfor")
+
+	// other unexpected tags
+	testParseFailureMsg(t, "{% func f() %}{% for %}{% foobar %}{% endfor %}{% endfunc %}", `unexpected tag found in "for ": "foobar"`)
+}
+
+func TestParseRaw(t *testing.T) {
+	testParseCode(t, "{% func f(s string) %}{% raw s %}{% endfunc %}",
+		"switch qv422016 := s; qr422016 := interface{}(qv422016).(type) {\n",
+		"case string:\n", "qw422016.N().S(qr422016)\n",
+		"case []byte:\n", "qw422016.N().Z(qr422016)\n",
+		"default:\n", "qw422016.N().V(qv422016)\n")
+
+	// no html escaping in html funcs
+	testParseCode(t, "{% func html f(p *Page) %}{% raw p.Body() %}{% endfunc %}",
+		"switch qv422016 := p.Body(); qr422016 := interface{}(qv422016).(type) {\n",
+		"qw422016.N().S(qr422016)\n")
+
+	// invalid value
+	testParseFailureMsg(t, "{% func f() %}{% raw %}{% endfunc %}", "empty expression in raw tag")
+	testParseFailureMsg(t, "{% func f() %}{% raw a b %}{% endfunc %}", "invalid raw tag value")
+
+	// outside func
+	testParseFailure(t, "{% raw s %}")
+}
+
+func TestParseCopy(t *testing.T) {
+	testParseCode(t, "{% func f(r io.Reader) %}<pre>{% copy r %}</pre>{% endfunc %}",
+		"qw422016.N().Copy(r)\n")
+	testParseCode(t, "{% func html f(name string) %}{% copy strings.NewReader(name) %}{% endfunc %}",
+		"qw422016.N().Copy(strings.NewReader(name))\n")
+
+	// invalid reader
+	testParseFailureMsg(t, "{% func f() %}{% copy %}{% endfunc %}", "empty reader in copy tag")
+	testParseFailureMsg(t, "{% func f(r io.Reader) %}{% copy r r %}{% endfunc %}", "invalid reader")
+
+	// outside func
+	testParseFailure(t, "{% copy r %}")
+}
+
+func TestParseCallFuncValue(t *testing.T) {
+	testParseCode(t, "{% func f(r func(w io.Writer)) %}{%= call r %}{% endfunc %}",
+		"r(qw422016.N())\n")
+	testParseCode(t, "{% func f(p *Page) %}{%=  call  p.Header.Render  %}{% endfunc %}",
+		"p.Header.Render(qw422016.N())\n")
+	testParseCode(t, "{% func f(r func(w io.Writer)) %}{%=h call r %}{% endfunc %}",
+		"qb422016 := qt422016.AcquireByteBuffer()\n", "r(qb422016)\n", "qw422016.E().Z(qb422016.B)\n")
+	testParseCode(t, "{% func f(r func(w io.Writer)) %}{%=uh call r %}{% endfunc %}",
+		"r(qb422016)\n", "qw422016.N().UZ(qb422016.B)\n")
+
+	// funcs named call are called as usual
+	testParseCode(t, "{% func f() %}{%= call() %}{%= call (1) %}{%= caller(2) %}{% endfunc %}",
+		"streamcall(qw422016)\n", "streamcall(qw422016, 1)\n", "streamcaller(qw422016, 2)\n")
+
+	// invalid func values
+	testParseFailureMsg(t, "{% func f() %}{%= call r() %}{% endfunc %}", `func value "r()" must be identifier or selector`)
+	testParseFailureMsg(t, "{% func f() %}{%= call rs[0] %}{% endfunc %}", `func value "rs[0]" must be identifier or selector`)
+	testParseFailureMsg(t, "{% func f() %}{%= call f().r %}{% endfunc %}", `func value "f().r" must be identifier or selector`)
+	testParseFailure(t, "{% func f() %}{%= call %}{% endfunc %}")
+	testParseFailure(t, "{% func f() %}{%= call r s %}{% endfunc %}")
+}
+
+func TestParseShadowedWriter(t *testing.T) {
+	// The generated code uses mangled names, so short names may be used freely
+	testParseCode(t, "{% func f(w io.Writer, qw, qq string) %}{% code qb := w %}{%s qw %}{% endfunc %}",
+		"func streamf(qw422016 *qt422016.Writer, w io.Writer, qw, qq string) {\n",
+		"qb := w\n", "qw422016.E().S(qw)\n")
+
+	// the writer may be used in code without being declared
+	testParseSuccess(t, "{% func f() %}{% code helper(qw422016) %}{% endfunc %}")
+
+	// func args
+	testParseFailureMsg(t, "{% func f(qw422016 string) %}{% endfunc %}", `identifier "qw422016" conflicts with the template writer`)
+	testParseFailureMsg(t, "{% func f(a int, qq422016 io.Writer) %}{% endfunc %}", `identifier "qq422016" conflicts with the template writer`)
+	testParseFailureMsg(t, "{% func (qw422016 *T) f() %}{% endfunc %}", `identifier "qw422016" conflicts with the template writer`)
+	testParseFailureMsg(t, "{% func f(qt422016 int) %}{% endfunc %}", `identifier "qt422016" conflicts with the identifiers generated by qtc`)
+
+	// code inside func
+	testParseFailureMsg(t, "{% func f() %}{% code qw422016 := 1 %}{% endfunc %}", `identifier "qw422016" conflicts with the template writer`)
+	testParseFailureMsg(t, "{% func f() %}{% code var qb422016 bytes.Buffer %}{% endfunc %}", `identifier "qb422016" conflicts with the template writer`)
+	testParseFailureMsg(t, "{% func f() %}{% code for _, qw422016 := range a {} %}{% endfunc %}", `identifier "qw422016" conflicts with the template writer`)
+	testParseFailureMsg(t, "{% func f() %}{% code g := func(qw422016 int) {} %}{% endfunc %}", `identifier "qw422016" conflicts with the template writer`)
+
+	// package-level code
+	testParseFailureMsg(t, "{% code var qt422016 = 1 %}", `identifier "qt422016" conflicts with the identifiers generated by qtc`)
+	testParseFailureMsg(t, "{% code func qw422016() {} %}", `identifier "qw422016" conflicts with the template writer`)
+	testParseFailureMsg(t, "{% func f() %}{% code package %}type qtio422016 int{% endcode %}{% endfunc %}", `identifier "qtio422016" conflicts with the identifiers generated by qtc`)
+
+	// assign and with tags
+	testParseFailureMsg(t, "{% func f() %}{% assign qw422016 = 1 %}{% endfunc %}", `identifier "qw422016" conflicts with the template writer`)
+	testParseFailureMsg(t, "{% func f() %}{% with qs422016 = 1 %}{% endwith %}{% endfunc %}", `identifier "qs422016" conflicts with the identifiers generated by qtc`)
+}
+
+func TestParseDefer(t *testing.T) {
+	testParseCode(t, "{% func f() %}{% code r := acquire() %}{% defer release(r) %}{%s r.Name %}{% endfunc %}",
+		"r := acquire()\n", "defer release(r)\n", "qw422016.E().S(r.Name)\n")
+	testParseCode(t, "{% func f() %}{% for _, r := range rs %}{% defer func() { r.Close() }() %}{% endfor %}{% endfunc %}",
+		"\t\tdefer func() { r.Close() }()\n")
+
+	// nested funcs
+	testParseCode(t, "{% func f() %}{% func g() %}{% defer foo() %}{% endfunc %}{% endfunc %}",
+		"defer foo()\n")
+
+	// not a func call
+	testParseFailureMsg(t, "{% func f() %}{% defer foo %}{% endfunc %}", "expression must be function call")
+	testParseFailure(t, "{% func f() %}{% defer %}{% endfunc %}")
+	testParseFailure(t, "{% func f() %}{% defer foo( %}{% endfunc %}")
+
+	// outside func
+	testParseFailureMsg(t, "{% defer foo() %}", "found defer tag outside func")
+
+	// inside cdata
+	testParseFailureMsg(t, "{% func f() %}{% cdata %}{% defer foo() %}{% endcdata %}{% endfunc %}", "found defer tag inside cdata block")
+}
+
+func TestParseAssign(t *testing.T) {
+	// the first assignment declares the variable
+	testParseCode(t, "{% func f() %}{% assign x = foo(bar) %}{%d x %}{% endfunc %}",
+		"x := foo(bar)\n")
+
+	// subsequent assignments reassign it
+	testParseCode(t, "{% func f() %}{% assign x = 1 %}{% for %}{% assign x = x + 1 %}{% endfor %}{% assign x = 3 %}{% endfunc %}",
+		"\tx := 1\n", "\t\tx = x + 1\n", "\n\tx = 3\n")
+
+	// variables declared in the inner scopes aren't visible outside
+	testParseCode(t, "{% func f() %}{% if a %}{% assign x = 1 %}{% else %}{% assign x = 2 %}{% endif %}{% assign x = 3 %}{% endfunc %}",
+		"\t\tx := 1\n", "\t\tx := 2\n", "\n\tx := 3\n")
+	testParseCode(t, "{% func f() %}{% switch %}{% case a %}{% assign x = 1 %}{% default %}{% assign x = 2 %}{% endswitch %}{% endfunc %}",
+		"\tx := 1\n", "\tx := 2\n")
+	testParseCode(t, "{% func f() %}{% assign x = 1 %}{% endfunc %}{% func g() %}{% assign x = 2 %}{% endfunc %}",
+		"x := 1\n", "x := 2\n")
+
+	// blank identifier
+	testParseCode(t, "{% func f() %}{% assign _ = foo() %}{% endfunc %}", "_ = foo()\n")
+
+	// invalid left side
+	testParseFailure(t, "{% func f() %}{% assign x.y = 1 %}{% endfunc %}")
+	testParseFailure(t, "{% func f() %}{% assign x, y = 1, 2 %}{% endfunc %}")
+	testParseFailure(t, "{% func f() %}{% assign a[0] = 1 %}{% endfunc %}")
+	testParseFailure(t, "{% func f() %}{% assign x := 1 %}{% endfunc %}")
+	testParseFailure(t, "{% func f() %}{% assign = 1 %}{% endfunc %}")
+
+	// invalid right side
+	testParseFailure(t, "{% func f() %}{% assign x %}{% endfunc %}")
+	testParseFailure(t, "{% func f() %}{% assign x = %}{% endfunc %}")
+	testParseFailure(t, "{% func f() %}{% assign x == 1 %}{% endfunc %}")
+	testParseFailure(t, "{% func f() %}{% assign x = 1 + %}{% endfunc %}")
+
+	// assign outside func
+	testParseFailure(t, "{% assign x = 1 %}")
+}
+
+func TestParseWith(t *testing.T) {
+	// single binding
+	testParseCode(t, "{% func f(ctx *Ctx) %}{% with user = ctx.CurrentUser() %}{%s user.Name %}{% endwith %}{% endfunc %}",
+		"\t{\n",
+		"\t\tuser := ctx.CurrentUser()\n",
+		"\t\tqw422016.E().S(user.Name)\n",
+		"\t}\n")
+
+	// multiple bindings may refer the previous ones
+	testParseCode(t, "{% func f() %}{% with a = g(1, 2), b = []int{a, 3}, c = a + len(b) %}{%d c %}{% endwith %}{% endfunc %}",
+		"\t\ta := g(1, 2)\n",
+		"\t\tb := []int{a, 3}\n",
+		"\t\tc := a + len(b)\n")
+
+	// assign reassigns the variables bound inside the block
+	testParseCode(t, "{% func f() %}{% with x = 1 %}{% assign x = 2 %}{% endwith %}{% endfunc %}",
+		"\t\tx := 1\n", "\t\tx = 2\n")
+
+	// the variables are out of scope after endwith
+	testParseCode(t, "{% func f() %}{% with x = 1 %}{%d x %}{% endwith %}{% assign x = 2 %}{% endfunc %}",
+		"\t}\n", "\tx := 2\n")
+
+	// return inside with
+	testParseSuccess(t, "{% func f() %}{% with x = 1 %}{%d x %}{% return %}{% endwith %}{% endfunc %}")
+
+	testParseFailureMsg(t, "{% func f() %}{% with %}{% endwith %}{% endfunc %}", "missing 'name = expr' bindings")
+	testParseFailureMsg(t, "{% func f() %}{% with x %}{% endwith %}{% endfunc %}", "missing '='")
+	testParseFailureMsg(t, "{% func f() %}{% with x = 1, x = 2 %}{% endwith %}{% endfunc %}", `duplicate binding for "x"`)
+	testParseFailureMsg(t, "{% func f() %}{% with x = 1, %}{% endwith %}{% endfunc %}", "missing '='")
+	testParseFailureMsg(t, "{% func f() %}{% with x = 1 %}{% endfunc %}", "expected endwith to close with block opened at ./foobar.tpl:1, found endfunc")
+	testParseFailureMsg(t, "{% func f() %}{% endwith %}{% endfunc %}", "expected endfunc to close func opened at ./foobar.tpl:1, found endwith")
+}
+
+func TestParseFuncNameCollision(t *testing.T) {
+	testParseFailureMsg(t, "{% func F() %}{% endfunc %}{% func StreamF() %}{% endfunc %}",
+		"func StreamF collides with the stream wrapper of func F")
+	testParseFailureMsg(t, "{% func WriteF() %}{% endfunc %}{% func F() %}{% endfunc %}",
+		"the write wrapper of func F collides with func WriteF")
+	testParseFailureMsg(t, "{% func f() %}{% endfunc %}{% func streamf(n int) %}{% endfunc %}",
+		"func streamf collides with the stream wrapper of func f")
+	testParseFailureMsg(t, "{% func (p *Page) Body() %}{% endfunc %}{% func (p Page) StreamBody() %}{% endfunc %}",
+		"method Page.StreamBody collides with the stream wrapper of method Page.Body")
+
+	// near misses
+	testParseSuccess(t, "{% func F() %}{% endfunc %}{% func FStream() %}{% endfunc %}{% func Streamf() %}{% endfunc %}")
+	testParseSuccess(t, "{% func F() %}{% endfunc %}{% func f() %}{% endfunc %}")
+	testParseSuccess(t, "{% func F() %}{% endfunc %}{% func (p *Page) StreamF() %}{% endfunc %}{% func (p *Page) G() %}{% endfunc %}")
+	testParseSuccess(t, "{% func (p *Page) Body() %}{% endfunc %}{% func (p *Other) StreamBody() %}{% endfunc %}")
+}
+
+func TestParseDuplicateFunc(t *testing.T) {
+	testParseFailureMsg(t, "{% func Render() %}{% endfunc %}\n\n{% func Render(n int) %}{% endfunc %}",
+		"duplicate func Render at line 3: it is already defined at line 1")
+	testParseFailureMsg(t, "{% func (p *Page) Body() %}\n{% endfunc %}\n{% func (p Page) Body() %}{% endfunc %}",
+		"duplicate method Page.Body at line 3: it is already defined at line 1")
+
+	// methods with the same name on distinct types
+	testParseSuccess(t, "{% func (p *Page) Body() %}{% endfunc %}{% func (p *Other) Body() %}{% endfunc %}{% func Body() %}{% endfunc %}")
+}
+
+func TestParseFuncStreamOnly(t *testing.T) {
+	code, err := CompileString(`{% func stream Render(x int) %}{%d x %}{% endfunc %}
+{% func Page() %}{%= Render(42) %}{% func stream li() %}<li>{% endfunc %}{%= li() %}{% endfunc %}`, "templates/stream.qtpl")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for _, s := range []string{
+		"func StreamRender(qw422016 *qt422016.Writer, x int) {",
+		"StreamRender(qw422016, 42)",
+		"streamli := func(qw422016 *qt422016.Writer) {",
+		"func Page() string {",
+	} {
+		if !strings.Contains(code, s) {
+			t.Fatalf("cannot find %q in the compiled code:\n%s", s, code)
+		}
+	}
+	for _, s := range []string{
+		"func WriteRender(",
+		"func Render(",
+		"writeli",
+	} {
+		if strings.Contains(code, s) {
+			t.Fatalf("unexpected %q found in the compiled code:\n%s", s, code)
+		}
+	}
+
+	// write and string funcs aren't generated for stream-only func
+	testParseSuccess(t, "{% func stream Render() %}{% endfunc %}{% func WriteRender() %}{% endfunc %}")
+	testParseFailureMsg(t, "{% func Render() %}{% endfunc %}{% func stream Render() %}{% endfunc %}",
+		"stream-only func Render collides with the stream wrapper of func Render")
+}
+
+func TestParseFuncPrivate(t *testing.T) {
+	code, err := CompileString(`{% func private X(n int) %}{%d n %}{% endfunc %}
+{% func Page() %}{%= x(42) %}{% endfunc %}`, "templates/private.qtpl")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for _, s := range []string{
+		"func streamx(qw422016 *qt422016.Writer, n int) {",
+		"func writex(qq422016 qtio422016.Writer, n int) {",
+		"func x(n int) string {",
+		"streamx(qw422016, 42)",
+		"func StreamPage(qw422016 *qt422016.Writer) {",
+		"func WritePage(qq422016 qtio422016.Writer) {",
+		"func Page() string {",
+	} {
+		if !strings.Contains(code, s) {
+			t.Fatalf("cannot find %q in the compiled code:\n%s", s, code)
+		}
+	}
+	for _, s := range []string{
+		"StreamX(",
+		"WriteX(",
+		"func X(",
+	} {
+		if strings.Contains(code, s) {
+			t.Fatalf("unexpected %q found in the compiled code:\n%s", s, code)
+		}
+	}
+
+	// the unexported name collides with the func defined without the modifier
+	testParseFailure(t, "{% func private X() %}{% endfunc %}{% func x() %}{% endfunc %}")
+}
+
+func TestParseFuncInline(t *testing.T) {
+	code, err := CompileString(`{% func Before() %}{%= icon("x") %}{% endfunc %}
+{% func inline icon(name string) %}<i class="{%s name %}"></i>{% endfunc %}
+{% func inline text pair(a, b int) %}{%s "<" %}{%d a %},{%d b %}{% endfunc %}
+{% func Page(names []string) %}
+	{% for i, name := range names %}{%= icon(name) %}{%= pair(i, len(name)) %}{% endfor %}
+	{%=h icon("y") %}
+	{% code a := 1 %}{%= pair(2, a) %}
+{% endfunc %}`, "templates/inline.qtpl")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for _, s := range []string{
+		// calls before the definition aren't expanded
+		"func StreamBefore(qw422016 *qt422016.Writer) {\n\t//line templates/inline.qtpl:1\n\tstreamicon(qw422016, \"x\")\n",
+
+		// the func is generated as usual
+		"func streamicon(qw422016 *qt422016.Writer, name string) {",
+		"func icon(name string) string {",
+
+		// calls are expanded into the func body
+		"\t\t{\n\t\t\t//line templates/inline.qtpl:5\n\t\t\tvar name string = name\n\t\t\t//line templates/inline.qtpl:5\n\t\t\t_ = name\n" +
+			"\t\t\t//line templates/inline.qtpl:2\n\t\t\tqw422016.N().S(`<i class=\"`)\n\t\t\t//line templates/inline.qtpl:2\n\t\t\tqw422016.E().S(name)\n",
+		"\t\t\tvar a int = i\n\t\t\t//line templates/inline.qtpl:5\n\t\t\t_ = a\n\t\t\t//line templates/inline.qtpl:5\n\t\t\tvar b int = len(name)\n",
+
+		// the escape mode of the inlined func is preserved
+		"\t\t\tqw422016.N().S(\"<\")\n",
+
+		// filtered calls aren't expanded
+		"\twriteicon(qb422016, \"y\")\n",
+
+		// the arg referring to the preceding arg name isn't bound
+		"\tstreampair(qw422016, 2, a)\n",
+	} {
+		if !strings.Contains(code, s) {
+			t.Fatalf("cannot find %q in the compiled code:\n%s", s, code)
+		}
+	}
+	if strings.Contains(code, "streampair(qw422016, i, len(name))") {
+		t.Fatalf("unexpected call to inline func found in the compiled code:\n%s", code)
+	}
+
+	// funcs with complex bodies cannot be inlined
+	testParseFailureMsg(t, "{% func inline F(n int) %}{% if n > 0 %}{% return %}{% endif %}{% endfunc %}",
+		"return tag cannot be used in func with inline modifier")
+	testParseFailureMsg(t, "{% func inline F() %}{% code package %}var x = 1{% endcode %}{% endfunc %}",
+		"package-level code cannot be used in func with inline modifier")
+	testParseFailureMsg(t, "{% func inline F(w io.Closer) %}{% defer w.Close() %}foo{% endfunc %}",
+		"defer tag cannot be used in func with inline modifier")
+	testParseFailureMsg(t, "{% func inline F(w io.Closer) %}{% if w != nil %}{% defer w.Close() %}{% endif %}{% endfunc %}",
+		"defer tag cannot be used in func with inline modifier")
+	testParseFailureMsg(t, "{% func F() %}{% func inline g() %}{% endfunc %}{% endfunc %}",
+		`nested func "func inline g()" cannot have "inline" modifier`)
+}
+
+func TestParseFuncWriterTo(t *testing.T) {
+	code, err := CompileString(`{% func writerto Page(title string, n int) %}{%s title %}{%d n %}{% endfunc %}
+{% func writerto err stream list(items ...string) %}{% for _, s := range items %}{%s s %}{% endfor %}{% endfunc %}`, "templates/writerto.qtpl")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for _, s := range []string{
+		"type PageWriterTo struct {",
+		"\ttitle string\n",
+		"func NewPageWriterTo(title string, n int) PageWriterTo {",
+		"\t\ttitle: title,\n",
+		"func (qa422016 PageWriterTo) WriteTo(qq422016 qtio422016.Writer) (int64, error) {\n" +
+			"\t//line templates/writerto.qtpl:1\n\tqw422016 := qt422016.AcquireCountingWriter(qq422016)\n" +
+			"\t//line templates/writerto.qtpl:1\n\tStreamPage(qw422016, qa422016.title, qa422016.n)\n" +
+			"\t//line templates/writerto.qtpl:1\n\tqe422016 := qw422016.Err()\n" +
+			"\t//line templates/writerto.qtpl:1\n\tqn422016 := qt422016.ReleaseCountingWriter(qw422016)\n",
+
+		// variadic args are captured as slices
+		"\titems []string\n",
+		"func newListWriterTo(items ...string) listWriterTo {",
+
+		// errors returned by err funcs are returned
+		"\tqe422016 := streamlist(qw422016, qa422016.items...)\n",
+	} {
+		if !strings.Contains(code, s) {
+			t.Fatalf("cannot find %q in the compiled code:\n%s", s, code)
+		}
+	}
+
+	testParseFailureMsg(t, "{% macro writerto m() %}{% endmacro %}",
+		`"writerto" modifier cannot be used for macros`)
+	testParseFailureMsg(t, "{% func F() %}{% func writerto g() %}{% endfunc %}{% endfunc %}",
+		`nested func "func writerto g()" cannot have "writerto" modifier`)
+	testParseFailureMsg(t, "{% func writerto Page() %}{% endfunc %}{% code type PageWriterTo int %}{% func NewPageWriterTo() %}{% endfunc %}",
+		"collides with the io.WriterTo constructor of func Page")
+}
+
+func TestParseFuncSizeHint(t *testing.T) {
+	code, err := CompileStringWithOptions(`{% func Page(s string) hint(8192) %}{%s s %}{% endfunc %}
+{% func err E() hint(100) %}{% endfunc %}
+{% func NoHint() %}{% endfunc %}`, "templates/hint.qtpl", &ParseOptions{
+		ErrFuncs: true,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for _, s := range []string{
+		"func Page(s string) string {\n\t//line templates/hint.qtpl:1\n\tqb422016 := qt422016.AcquireByteBufferSize(8192)\n",
+		"func E() (string, error) {\n\t//line templates/hint.qtpl:2\n\tqb422016 := qt422016.AcquireByteBufferSize(100)\n",
+		"func NoHint() string {\n\t//line templates/hint.qtpl:3\n\tqb422016 := qt422016.AcquireByteBuffer()\n",
+	} {
+		if !strings.Contains(code, s) {
+			t.Fatalf("cannot find %q in the compiled code:\n%s", s, code)
+		}
+	}
+
+	testParseFailureMsg(t, "{% func Page() hint(0) %}{% endfunc %}", "the hint must be positive")
+	testParseFailureMsg(t, "{% func Page() hint(n) %}{% endfunc %}", "the hint must be an integer literal")
+	testParseFailureMsg(t, "{% func stream Page() hint(100) %}{% endfunc %}",
+		`hint(100) cannot be used for func "Page", since the string func isn't generated for it`)
+	testParseFailureMsg(t, "{% macro m() hint(100) %}{% endmacro %}",
+		`hint(100) cannot be used for macro "m"`)
+	testParseFailureMsg(t, "{% func F() %}{% func g() hint(100) %}{% endfunc %}{% endfunc %}",
+		`nested func "func g() hint(100)" cannot have hint(100)`)
+}
+
+func TestParseFuncErr(t *testing.T) {
+	code, err := CompileStringWithOptions(`{% func err F(s string) %}{% if s == "" %}{% return errEmpty %}{% endif %}{%s s %}{% endfunc %}
+{% func err G(a []string) %}{% for _, s := range a %}{%= F(s) %}{%=h F(s) %}{% if s == "." %}{% return %}{% endif %}{% endfor %}{% endfunc %}
+{% func err H() %}{% return nil %}{% endfunc %}`, "templates/err.qtpl", &ParseOptions{
+		AppendFuncs: true,
+		ErrFuncs:    true,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for _, s := range []string{
+		"func StreamF(qw422016 *qt422016.Writer, s string) error {",
+		"\t\treturn errEmpty\n",
+		"\tqw422016.E().S(s)\n\t//line templates/err.qtpl:1\n\treturn nil\n",
+		"\tqe422016 := StreamF(qw422016, s)\n",
+		"\t\tqe422016 = qw422016.Err()\n",
+		"func F(s string) (string, error) {",
+		"\tif qe422016 := WriteF(qb422016, s); qe422016 != nil {\n",
+		"\t\treturn \"\", qe422016\n",
+		"\treturn qs422016, nil\n",
+
+		// errors returned by the called funcs are returned
+		"\t\tif qe422016 := StreamF(qw422016, s); qe422016 != nil {\n",
+		"\t\t\tif qe422016 := WriteF(qb422016, s); qe422016 != nil {\n",
+		"\t\t\t\tqt422016.ReleaseByteBuffer(qb422016)\n",
+		"\t\t\t\treturn qe422016\n",
+		"\t\t\treturn nil\n",
+
+		// no trailing return after the return tag
+		"\treturn nil\n//line templates/err.qtpl:3\n}\n",
+	} {
+		if !strings.Contains(code, s) {
+			t.Fatalf("cannot find %q in the compiled code:\n%s", s, code)
+		}
+	}
+	for _, s := range []string{
+		"AppendF(",
+		"WriteFErr(",
+		"\treturn nil\n\t//line templates/err.qtpl:3\n\treturn nil\n",
+	} {
+		if strings.Contains(code, s) {
+			t.Fatalf("unexpected %q found in the compiled code:\n%s", s, code)
+		}
+	}
+
+	// defaults funcs return errors
+	testParseCode(t, "{% func err F(s string = \"\") %}{% endfunc %}",
+		"func StreamFDefaults(qw422016 *qt422016.Writer) error {\n\t//line ./foobar.tpl:1\n\treturn StreamF(qw422016, \"\")\n",
+		"func WriteFDefaults(qq422016 qtio422016.Writer) error {\n\t//line ./foobar.tpl:1\n\treturn WriteF(qq422016, \"\")\n",
+		"func FDefaults() (string, error) {\n\t//line ./foobar.tpl:1\n\treturn F(\"\")\n")
+
+	// closures nested inside err funcs don't return errors
+	testParseCode(t, "{% func err F() %}{% func g() %}{% return %}{% endfunc %}{%= g() %}{% endfunc %}",
+		"\t\treturn\n")
+	testParseFailureMsg(t, "{% func err F() %}{% func g() %}{% return nil %}{% endfunc %}{% endfunc %}",
+		"only funcs with err modifier may return errors")
+	testParseFailureMsg(t, "{% func err F() %}{% func g() %}{%= F() %}{% endfunc %}{% endfunc %}",
+		"defined with err modifier from func without err modifier")
+	testParseFailureMsg(t, "{% func F() %}{% func err g() %}{% endfunc %}{% endfunc %}",
+		`cannot have "err" modifier`)
+
+	// errors mustn't be lost
+	testParseFailureMsg(t, "{% func err F() %}{% endfunc %}{% func G() %}{%= F() %}{% endfunc %}",
+		`cannot call "F()" defined with err modifier from func without err modifier`)
+	testParseFailureMsg(t, "{% func G() %}{%=h F() %}{% endfunc %}{% func err F() %}{% endfunc %}",
+		`cannot call "F()" defined with err modifier from func without err modifier`)
+	testParseFailureMsg(t, "{% func err F() %}{% cdata %}{%= F() %}{% endcdata %}{% endfunc %}",
+		`cannot call "F()" defined with err modifier inside cdata block`)
+
+	// invalid return values
+	testParseFailureMsg(t, "{% func F() %}{% return err %}{% endfunc %}", "only funcs with err modifier may return errors")
+	testParseFailureMsg(t, "{% func err F() %}{% return err) %}{% endfunc %}", "invalid return value")
+}
+
+func TestParseMacro(t *testing.T) {
+	code, err := CompileString(`{% macro badge(n int) %}<b>{%d n %}</b>{% endmacro %}
+{% func Page(n int) %}{%= badge(n) %}{% macro li(s string) %}<li>{%s s %}</li>{% endmacro %}{%= li("x") %}{% endfunc %}`, "templates/macro.qtpl")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for _, s := range []string{
+		"func streambadge(qw422016 *qt422016.Writer, n int) {",
+		"streambadge(qw422016, n)",
+		"streamli := func(qw422016 *qt422016.Writer, s string) {",
+		"_ = streamli",
+		"streamli(qw422016, \"x\")",
+		"func Page(n int) string {",
+	} {
+		if !strings.Contains(code, s) {
+			t.Fatalf("cannot find %q in the compiled code:\n%s", s, code)
+		}
+	}
+	// Only the stream func is generated for macros
+	for _, s := range []string{
+		"func badge(",
+		"func writebadge(",
+		"writeli",
+	} {
+		if strings.Contains(code, s) {
+			t.Fatalf("unexpected %q found in the compiled code:\n%s", s, code)
+		}
+	}
+
+	// modifiers
+	testParseCode(t, "{% macro text row(s string) %}{%s s %}{% endmacro %}",
+		"func streamrow(qw422016 *qt422016.Writer, s string) {", "qw422016.N().S(s)")
+
+	// invalid macros
+	testParseFailureMsg(t, "{% macro Badge() %}{% endmacro %}", `macro name "Badge" must be unexported`)
+	testParseFailureMsg(t, "{% macro (p *Page) badge() %}{% endmacro %}", "macro cannot be a method")
+	testParseFailureMsg(t, "{% macro stream badge() %}{% endmacro %}", `redundant "stream" modifier`)
+	testParseFailureMsg(t, "{% func Page() %}{% macro Li() %}{% endmacro %}{% endfunc %}", `macro name "Li" must be unexported`)
+	testParseFailureMsg(t, "{% macro badge() %}{% endfunc %}", "expected endmacro to close macro opened at ./foobar.tpl:1, found endfunc")
+	testParseFailureMsg(t, "{% func Page() %}{% endmacro %}", "expected endfunc to close func opened at ./foobar.tpl:1, found endmacro")
+	testParseFailureMsg(t, "{% macro badge() %}", "cannot find endmacro tag")
+
+	// macros share func namespace
+	testParseFailureMsg(t, "{% macro badge() %}{% endmacro %}{% func stream badge() %}{% endfunc %}",
+		"duplicate stream-only func badge")
+}
+
+func TestParseAppendFuncs(t *testing.T) {
+	src := `{% func F(n int) %}{%d n %}{% endfunc %}{% func (p *Page) body() %}{% endfunc %}{% func stream S() %}{% endfunc %}`
+	code, err := CompileStringWithOptions(src, "templates/append.qtpl", &ParseOptions{AppendFuncs: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for _, s := range []string{
+		"func AppendF(dst422016 []byte, n int) []byte {",
+		"\tqb422016.B = dst422016\n",
+		"\tWriteF(qb422016, n)\n",
+		"\tdst422016 = qb422016.B\n",
+		"\treturn dst422016\n",
+		"func (p *Page) appendbody(dst422016 []byte) []byte {",
+		"\tp.writebody(qb422016)\n",
+		"func F(n int) string {",
+	} {
+		if !strings.Contains(code, s) {
+			t.Fatalf("cannot find %q in the compiled code:\n%s", s, code)
+		}
+	}
+	if strings.Contains(code, "AppendS") {
+		t.Fatalf("unexpected append func for stream-only func:\n%s", code)
+	}
+
+	// append funcs are disabled by default
+	code, err = CompileString(src, "templates/append.qtpl")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if strings.Contains(code, "AppendF") {
+		t.Fatalf("unexpected append func in the compiled code:\n%s", code)
+	}
+
+	// name collision
+	_, err = CompileStringWithOptions(`{% func F() %}{% endfunc %}{% func AppendF() %}{% endfunc %}`, "templates/append.qtpl", &ParseOptions{AppendFuncs: true})
+	if err == nil || !strings.Contains(err.Error(), "func AppendF collides with the append wrapper of func F") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestParseOptionsValidate(t *testing.T) {
+	for _, opts := range []*ParseOptions{
+		nil,
+		{},
+		{TagOpen: "<%", TagClose: "%>", MustacheMode: true, MustacheTag: "s"},
+		{WriterVarName: "w", StreamWriterArgName: "ww", Banner: "// foo"},
+	} {
+		if err := opts.Validate(); err != nil {
+			t.Fatalf("unexpected error for %+v: %s", opts, err)
+		}
+	}
+	for _, opts := range []*ParseOptions{
+		{TagOpen: "<%"},
+		{TagOpen: "<%%", TagClose: "%>"},
+		{TagOpen: "{{", TagClose: "}}", MustacheMode: true},
+		{MustacheMode: true, MustacheTag: "s="},
+		{WriterVarName: "w", StreamWriterArgName: "w"},
+		{Banner: "foo"},
+	} {
+		if err := opts.Validate(); err == nil {
+			t.Fatalf("expecting error for %+v", opts)
+		}
+	}
+}
+
+func TestParseWriterNames(t *testing.T) {
+	src := "{% func F(qw, w string) %}{%s qw %}{%= G(w) %}{% cdata %}{%s w %}{% endcdata %}{% func g() %}{% endfunc %}{% endfunc %}" +
+		"{% func G(s string) %}{% printf `%s`, s %}{% endfunc %}"
+	opts := &ParseOptions{
+		WriterVarName:       "__qw",
+		StreamWriterArgName: "__w",
+		AppendFuncs:         true,
+		ErrFuncs:            true,
+	}
+	code, err := CompileStringWithOptions(src, "templates/writer.qtpl", opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err = goparser.ParseFile(gotoken.NewFileSet(), "", code, 0); err != nil {
+		t.Fatalf("cannot parse the generated code: %s\n%s", err, code)
+	}
+	for _, s := range []string{
+		"func StreamF(__qw *qt422016.Writer, qw, w string) {\n",
+		"\t__qw.E().S(qw)\n",
+		"\tStreamG(__qw, w)\n",
+		"\t\t__qw := qt422016.AcquireCDATAWriter(__qw)\n",
+		"\tstreamg := func(__qw *qt422016.Writer) {\n",
+		"\t__qw.E().Printf(`%s`, s)\n",
+		"func WriteF(__w qtio422016.Writer, qw, w string) {\n",
+		"\t__qw := qt422016.AcquireWriter(__w)\n",
+		"\tStreamF(__qw, qw, w)\n",
+		"\tqt422016.ReleaseWriter(__qw)\n",
+		"func WriteFErr(__w qtio422016.Writer, qw, w string) error {\n",
+		"\tqe422016 := __qw.Err()\n",
+	} {
+		if !strings.Contains(code, s) {
+			t.Fatalf("cannot find %q in the compiled code:\n%s", s, code)
+		}
+	}
+	for _, s := range []string{"qw422016", "qq422016"} {
+		if strings.Contains(code, s) {
+			t.Fatalf("unexpected %q in the compiled code:\n%s", s, code)
+		}
+	}
+
+	// invalid names
+	for _, opts := range []*ParseOptions{
+		{WriterVarName: "1qw"},
+		{WriterVarName: "func"},
+		{StreamWriterArgName: "a.b"},
+		{StreamWriterArgName: "_"},
+		{WriterVarName: "w", StreamWriterArgName: "w"},
+	} {
+		if _, err := CompileStringWithOptions(src, "templates/writer.qtpl", opts); err == nil {
+			t.Fatalf("expecting error for WriterVarName=%q, StreamWriterArgName=%q", opts.WriterVarName, opts.StreamWriterArgName)
+		}
+	}
+
+	// identifiers shadowing the custom writer names
+	opts = &ParseOptions{
+		WriterVarName:       "__qw",
+		StreamWriterArgName: "__w",
+	}
+	for _, tpl := range []string{
+		"{% func F(__qw string) %}{% endfunc %}",
+		"{% func F(__w string) %}{% endfunc %}",
+		"{% func (__qw *T) F() %}{% endfunc %}",
+		"{% func F() %}{% code __qw := 1 %}{% endfunc %}",
+		"{% func F() %}{% code var __w int %}{% endfunc %}",
+		"{% code var __qw int %}",
+		"{% func F() %}{% assign __qw = 1 %}{% endfunc %}",
+		"{% func F() %}{% with __w = 1 %}{% endwith %}{% endfunc %}",
+		"{% func F(xs []int) %}{% for _, __qw := range xs %}{% endfor %}{% endfunc %}",
+		"{% func F() %}{% for __w in 3 %}{% endfor %}{% endfunc %}",
+	} {
+		_, err := CompileStringWithOptions(tpl, "templates/writer.qtpl", opts)
+		if err == nil {
+			t.Fatalf("expecting error for %q", tpl)
+		}
+		if !strings.Contains(err.Error(), "conflicts with the template writer") {
+			t.Fatalf("unexpected error for %q: %s", tpl, err)
+		}
+	}
+}
+
+func TestParseErrFuncs(t *testing.T) {
+	src := `{% func F(n int) %}{%d n %}{% endfunc %}{% func (p *Page) body() %}{% endfunc %}{% func stream S() %}{% endfunc %}`
+	code, err := CompileStringWithOptions(src, "templates/err.qtpl", &ParseOptions{ErrFuncs: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for _, s := range []string{
+		"func WriteFErr(qq422016 qtio422016.Writer, n int) error {",
+		"\tStreamF(qw422016, n)\n",
+		"\tqe422016 := qw422016.Err()\n",
+		"\treturn qe422016\n",
+		"func (p *Page) writebodyErr(qq422016 qtio422016.Writer) error {",
+	} {
+		if !strings.Contains(code, s) {
+			t.Fatalf("cannot find %q in the compiled code:\n%s", s, code)
+		}
+	}
+	if strings.Contains(code, "SErr") {
+		t.Fatalf("unexpected error-returning func for stream-only func:\n%s", code)
+	}
+
+	// error-returning funcs are disabled by default
+	code, err = CompileString(src, "templates/err.qtpl")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if strings.Contains(code, "WriteFErr") {
+		t.Fatalf("unexpected error-returning func in the compiled code:\n%s", code)
+	}
+
+	// name collision
+	_, err = CompileStringWithOptions(`{% func F() %}{% endfunc %}{% func WriteFErr() %}{% endfunc %}`, "templates/err.qtpl", &ParseOptions{ErrFuncs: true})
+	if err == nil || !strings.Contains(err.Error(), "func WriteFErr collides with the error-returning write wrapper of func F") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestParseGenBenchmarks(t *testing.T) {
+	src := `{% import "io" %}
+{% func F() %}foo{% endfunc %}
+{% func g(n int, ss ...[]string) %}{%d n %}{% endfunc %}
+{% func R(r io.Reader) %}{% endfunc %}
+{% func (p *Page) Body() %}{% endfunc %}`
+	var bb bytes.Buffer
+	code, err := CompileStringWithOptions(src, "templates/bench.qtpl", &ParseOptions{GenBenchmarks: true, Benchmarks: &bb})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if strings.Contains(code, "Benchmark") {
+		t.Fatalf("unexpected benchmarks in the compiled code:\n%s", code)
+	}
+	benchmarks := bb.String()
+	for _, s := range []string{
+		"package templates\n",
+		"func BenchmarkF(b422016 *testing.B) {\n",
+		"\tqw422016 := qt422016.AcquireWriter(qtio422016.Discard)\n",
+		"\t\tStreamF(qw422016)\n",
+		"func Benchmark_g(b422016 *testing.B) {\n",
+		"\t\tn  int\n",
+		"\t\tss [][]string\n",
+		"\t\tstreamg(qw422016, n, ss...)\n",
+		"// BenchmarkR is skipped: cannot synthesize zero value for args of type io.Reader\n",
+		"// BenchmarkBody is skipped: methods require receiver value\n",
+	} {
+		if !strings.Contains(benchmarks, s) {
+			t.Fatalf("cannot find %q in the generated benchmarks:\n%s", s, benchmarks)
+		}
+	}
+	if strings.Contains(benchmarks, "StreamR(") {
+		t.Fatalf("unexpected benchmark for func with io.Reader arg:\n%s", benchmarks)
+	}
+
+	// the Benchmarks writer is mandatory
+	_, err = CompileStringWithOptions(src, "templates/bench.qtpl", &ParseOptions{GenBenchmarks: true})
+	if err == nil {
+		t.Fatalf("expecting non-nil error when Benchmarks writer is missing")
+	}
+}
+
+func TestParseGenManifest(t *testing.T) {
+	src := `{% func Page(title string, items []Item) %}{%s title %}{% endfunc %}
+{% func ctx private row(n, m int, attrs ...string) %}{%d n %}{% endfunc %}
+{% func (p *Page) Body() %}{% endfunc %}
+{% macro badge(n int) %}{%d n %}{% endmacro %}`
+	var bb bytes.Buffer
+	_, err := CompileStringWithOptions(src, "templates/page.qtpl", &ParseOptions{
+		AppendFuncs: true,
+		GenManifest: true,
+		Manifest:    &bb,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var m manifest
+	if err := json.Unmarshal(bb.Bytes(), &m); err != nil {
+		t.Fatalf("cannot unmarshal manifest: %s\n%s", err, bb.Bytes())
+	}
+	expectedManifest := manifest{
+		File:    "templates/page.qtpl",
+		Package: "templates",
+		Funcs: []manifestFunc{
+			{
+				Name:      "Page",
+				Params:    []manifestParam{{"title", "string"}, {"items", "[]Item"}},
+				Exported:  true,
+				Generated: []string{"Page", "StreamPage", "WritePage", "AppendPage"},
+				Line:      1,
+			},
+			{
+				Name:      "row",
+				Params:    []manifestParam{{"ctx", "context.Context"}, {"n", "int"}, {"m", "int"}, {"attrs", "...string"}},
+				Generated: []string{"row", "streamrow", "writerow", "appendrow"},
+				Line:      2,
+			},
+			{
+				Name:      "Body",
+				Receiver:  "*Page",
+				Params:    []manifestParam{},
+				Exported:  true,
+				Generated: []string{"Body", "StreamBody", "WriteBody", "AppendBody"},
+				Line:      3,
+			},
+			{
+				Name:      "badge",
+				Params:    []manifestParam{{"n", "int"}},
+				Generated: []string{"streambadge"},
+				Line:      4,
+			},
+		},
+	}
+	if !reflect.DeepEqual(m, expectedManifest) {
+		t.Fatalf("unexpected manifest\n%s\nExpecting\n%+v", bb.Bytes(), expectedManifest)
+	}
+
+	// empty template
+	bb.Reset()
+	if _, err = CompileStringWithOptions(`{% import "fmt" %}`, "templates/empty.qtpl", &ParseOptions{GenManifest: true, Manifest: &bb}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !strings.Contains(bb.String(), `"funcs": []`) {
+		t.Fatalf("expecting empty funcs list in the manifest:\n%s", bb.Bytes())
+	}
+
+	// the Manifest writer is mandatory
+	if _, err = CompileStringWithOptions(src, "templates/page.qtpl", &ParseOptions{GenManifest: true}); err == nil {
+		t.Fatalf("expecting non-nil error when Manifest writer is missing")
+	}
+}
+
+func TestParseCodeBlock(t *testing.T) {
+	// multi-line block with braces and {% %}-looking text in strings
+	testParseCode(t, "{% func f() %}{% code %}\n\tm := map[string]string{\n\t\t\"a\": \"50%}\",\n\t\t\"b\": `{% if %}`,\n\t}\n{% endcode %}{%s m[\"a\"] %}{% endfunc %}",
+		"//line ./foobar.tpl:1\n\t\n\tm := map[string]string{\n\t\t\"a\": \"50%}\",\n\t\t\"b\": `{% if %}`,\n\t}\n\n",
+		"qw422016.E().S(m[\"a\"])")
+
+	// code block outside func
+	testParseCode(t, "{% code %}\ntype T struct {\n\tS string // %}\n}\n{% endcode %}",
+		"//line ./foobar.tpl:1\n\ntype T struct {\n\tS string // %}\n}\n\n")
+
+	// the generated code points to the template lines
+	code, err := CompileString("{% func F() %}\n{% code %}\nx := 1\n\ny := x\n{% endcode %}\n{%d y %}\n{% endfunc %}", "templates/block.qtpl")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for _, s := range []string{
+		"//line templates/block.qtpl:2\n\n\tx := 1\n\n\ty := x\n",
+		"//line templates/block.qtpl:7\n\tqw422016.N().D(y)\n",
+	} {
+		if !strings.Contains(code, s) {
+			t.Fatalf("cannot find %q in the compiled code:\n%s", s, code)
+		}
+	}
+
+	// empty code tag without endcode is no-op
+	testParseCode(t, "{% func f() %}{% code %}x := 1{% endfunc %}",
+		"qw422016.N().S(`x := 1`)\n")
+	testParseSuccess(t, "{% code %}type T int")
+	testParseCode(t, "{% func f() %}{% code %}a{% code %}\nx := 1\n{% endcode %}{%d x %}{% endfunc %}",
+		"qw422016.N().S(`a`)\n",
+		"\n\tx := 1\n\n",
+		"qw422016.N().D(x)\n")
+
+	// endcode of the following code block doesn't match empty code tag
+	testParseCode(t, "{% func f() %}{% code %}a{% code x := 1 %}{%d x %}{% code %}\ny := x\n{% endcode %}{%d y %}{% endfunc %}",
+		"qw422016.N().S(`a`)\n",
+		"\tx := 1\n",
+		"qw422016.N().D(x)\n",
+		"\n\ty := x\n\n",
+		"qw422016.N().D(y)\n")
+	testParseFailure(t, "{% func f() %}{% code %}x := 1{%")
+
+	// invalid code
+	testParseFailure(t, "{% func f() %}{% code %}x := {{% endcode %}{% endfunc %}")
+	testParseFailure(t, "{% code %}x := 1{% endcode %}")
+}
+
+func TestParseTopLevelTypes(t *testing.T) {
+	// types and methods declared at the top level may be used in funcs
+	for _, tpl := range []string{
+		// single-tag code
+		`{% code
+type Foo struct {
+	Name string
+	Tags map[string]int
+}
+
+func (f *Foo) Title() string {
+	if f.Name == "" {
+		return "anonymous"
+	}
+	return "Mr. " + f.Name
+}
+%}
+{% func Greet(f *Foo) %}Hello, {%s f.Title() %}{% endfunc %}`,
+
+		// code block, which may contain %} in strings
+		`{% code %}
+type Foo struct {
+	Name string
+	Tags map[string]int
+}
+
+func (f *Foo) Title() string {
+	if f.Name == "" {
+		return "100%}"
+	}
+	return "Mr. " + f.Name
+}
+{% endcode %}
+{% func Greet(f *Foo) %}Hello, {%s f.Title() %}{% endfunc %}`,
+	} {
+		code, err := CompileString(tpl, "templates/types.qtpl")
+		if err != nil {
+			t.Fatalf("unexpected error when compiling %q: %s", tpl, err)
+		}
+		f, err := goparser.ParseFile(gotoken.NewFileSet(), "", code, 0)
+		if err != nil {
+			t.Fatalf("cannot parse the compiled code: %s\n%s", err, code)
+		}
+		var hasType, hasMethod bool
+		for _, d := range f.Decls {
+			switch d := d.(type) {
+			case *goast.GenDecl:
+				for _, spec := range d.Specs {
+					if ts, ok := spec.(*goast.TypeSpec); ok && ts.Name.Name == "Foo" {
+						_, hasType = ts.Type.(*goast.StructType)
+					}
+				}
+			case *goast.FuncDecl:
+				if d.Name.Name == "Title" && d.Recv != nil {
+					hasMethod = true
+				}
+			}
+		}
+		if !hasType || !hasMethod {
+			t.Fatalf("cannot find package-level Foo struct type with Title method in the compiled code:\n%s", code)
+		}
+		for _, s := range []string{
+			"func StreamGreet(qw422016 *qt422016.Writer, f *Foo) {",
+			"qw422016.E().S(f.Title())\n",
+		} {
+			if !strings.Contains(code, s) {
+				t.Fatalf("cannot find %q in the compiled code:\n%s", s, code)
+			}
+		}
+	}
+}
+
+func TestParseCodeFormatVerbs(t *testing.T) {
+	// Printf-like verbs in the user code are written as is.
+	testParseCode(t, "{% func f(x string) %}{% code s := fmt.Sprintf(\"%s\", x) %}{%s s %}{% endfunc %}",
+		"\ts := fmt.Sprintf(\"%s\", x)\n")
+	testParseCode(t, "{% func f(x string) %}{% code %}\ns := fmt.Sprintf(`%v %d%%`, x, 1)\n{% endcode %}{% endfunc %}",
+		"\ts := fmt.Sprintf(`%v %d%%`, x, 1)\n")
+	testParseCode(t, "{% code var format = \"%s%!\" %}",
+		"var format = \"%s%!\"\n")
+	testParseCode(t, "{% func f(n int) %}{% if n%2 == 0 %}{% for i := 0; i < n%3; i++ %}{% endfor %}{% endif %}{% endfunc %}",
+		"if n%2 == 0 {\n", "for i := 0; i < n%3; i++ {\n")
+	testParseCode(t, "{% func f(n int) %}{% switch n % 2 %}{% case 0 %}{% endswitch %}{% endfunc %}",
+		"switch n % 2 {\n")
+}
+
+func TestParseSpecialChars(t *testing.T) {
+	// text
+	testParseCode(t, "{% func f() %}100% %s %d%% %!(EXTRA) \\n\\{% endfunc %}",
+		"qw422016.N().S(`100% %s %d%% %!(EXTRA) \\n\\`)\n")
+	testParseCode(t, "{% func f() %}a`b``%s`{% endfunc %}",
+		"qw422016.N().S(`a`)\n", "qw422016.N().S(\"`\")\n", "qw422016.N().S(`b`)\n", "qw422016.N().S(`%s`)\n")
+
+	// output tags and func calls
+	testParseCode(t, "{% func f() %}{%s \"%s`\\\"\" %}{%= g(`%d\\`) %}{%d len(\"%%\") %}{% endfunc %}",
+		"qw422016.E().S(\"%s`\\\"\")\n", "streamg(qw422016, `%d\\`)\n", "qw422016.N().D(len(\"%%\"))\n")
+
+	// comments, func names and the file path
+	code, err := CompileString("{% func f() %}{% endfunc %}\n100% `comment` \\ %s\n{% func g() %}{% endfunc %}", "templates/100%s.qtpl")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for _, s := range []string{
+		"// 100% `comment` \\ %s\n",
+		"//line templates/100%s.qtpl:1\n",
+		`from "100%s.qtpl"`,
+	} {
+		if !strings.Contains(code, s) {
+			t.Fatalf("cannot find %q in the compiled code:\n%s", s, code)
+		}
+	}
+	if strings.Contains(code, "%!") {
+		t.Fatalf("unexpected format error found in the compiled code:\n%s", code)
+	}
+}
+
+func TestParsePackageCode(t *testing.T) {
+	code, err := CompileString(`{% func F() %}
+	{% code package %}
+var counter = map[string]int{"{%": 1}
+	{% endcode %}
+	{%d counter["{%"] %}
+	{% return %}
+	{% code package %}func helper() {}{% endcode %}
+{% endfunc %}
+{% code package %}var top = 1{% endcode %}
+{% func G() %}{% endfunc %}`, "templates/pkg.qtpl")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	n := strings.Index(code, "func F() string {")
+	if n < 0 {
+		t.Fatalf("cannot find F in the compiled code:\n%s", code)
+	}
+	tail := code[n:]
+	for _, s := range []string{
+		"//line templates/pkg.qtpl:2\n\nvar counter = map[string]int{\"{%\": 1}\n",
+		"//line templates/pkg.qtpl:7\nfunc helper() {}\n",
+		"//line templates/pkg.qtpl:9\nvar top = 1\n",
+	} {
+		if !strings.Contains(tail, s) {
+			t.Fatalf("cannot find %q after F in the compiled code:\n%s", s, code)
+		}
+	}
+	if !strings.Contains(code, "\tqw422016.N().D(counter[\"{%\"])\n") {
+		t.Fatalf("unexpected output code:\n%s", code)
+	}
+
+	// package code inside nested func is emitted after the top-level func
+	testParseCode(t, "{% func F() %}{% func g() %}{% code package %}var x = 1{% endcode %}{% endfunc %}{% endfunc %}",
+		"}\n\n//line ./foobar.tpl:1\nvar x = 1\n")
+
+	// missing endcode
+	testParseFailure(t, "{% func F() %}{% code package %}var x = 1{% endfunc %}")
+
+	// invalid package-level code
+	testParseFailure(t, "{% func F() %}{% code package %}x := 1{% endcode %}{% endfunc %}")
+	testParseFailure(t, "{% code package %}x := 1{% endcode %}")
+
+	// endcode outside code block
+	testParseFailure(t, "{% func F() %}{% endcode %}{% endfunc %}")
+}
+
+func testParseFailureMsg(t *testing.T, str, expectedMsg string) {
+	r := bytes.NewBufferString(str)
+	w := &bytes.Buffer{}
+	err := parse(w, r, "./foobar.tpl", "memory")
+	if err == nil {
+		t.Fatalf("expecting error when parsing %q", str)
+	}
+	if !strings.Contains(err.Error(), expectedMsg) {
+		t.Fatalf("unexpected error when parsing %q: %s. Expecting %q", str, err, expectedMsg)
+	}
+	checkParseErrorKind(t, str, err)
+
+	// The position is reported only once in gofmt form.
+	if !strings.HasPrefix(err.Error(), "./foobar.tpl:") {
+		t.Fatalf("missing position at the start of the error when parsing %q: %s", str, err)
+	}
+	if legacyPositionRe.MatchString(err.Error()) {
+		t.Fatalf("duplicate position in the error when parsing %q: %s", str, err)
+	}
+}
+
+var legacyPositionRe = regexp.MustCompile(`file ".*", line \d+, pos \d+`)
+
+func testParseCode(t *testing.T, str string, expectedCode ...string) {
+	r := bytes.NewBufferString(str)
+	w := &bytes.Buffer{}
+	if err := parse(w, r, "./foobar.tpl", "memory"); err != nil {
+		t.Fatalf("unexpected error when parsing %q: %s", str, err)
+	}
+	code := w.String()
+	for _, c := range expectedCode {
+		if !strings.Contains(code, c) {
+			t.Fatalf("cannot find %q in the code generated for %q:\n%s", c, str, code)
+		}
+	}
+}
+
+func TestParseInclude(t *testing.T) {
+	// simple include sharing the func scope
+	testParseCode(t, `{% func f(name string) %}<p>{% include "testdata/include/greeting.qtpl" %}</p>{% endfunc %}`,
+		"qw422016.N().S(`<p>`)",
+		"//line testdata/include/greeting.qtpl:1\n\tqw422016.N().S(`Hello, `)\n",
+		"qw422016.E().S(name)",
+		"qw422016.N().S(`!`)",
+		"//line ./foobar.tpl:1\n\tqw422016.N().S(`</p>`)\n")
+
+	// nested includes are resolved relative to the including file
+	code, err := CompileString(`{% func L(name string, items []string) %}{% include "partials/list.qtpl" %}{% endfunc %}`, "testdata/include/main.qtpl")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for _, s := range []string{
+		"for _, item := range items {",
+		"//line testdata/include/partials/item.qtpl:1\n\t\tqw422016.N().S(`<li>`)\n",
+		"//line testdata/include/greeting.qtpl:1\n\t\tqw422016.N().S(`Hello, `)\n",
+	} {
+		if !strings.Contains(code, s) {
+			t.Fatalf("cannot find %q in the compiled code:\n%s", s, code)
+		}
+	}
+
+	// include cycles
+	testParseFailureMsg(t, `{% func f() %}{% include "testdata/include/cycle_a.qtpl" %}{% endfunc %}`,
+		"include cycle found: cycle_a.qtpl -> cycle_b.qtpl -> cycle_a.qtpl")
+	testParseFailureMsg(t, `{% func f() %}{% include "testdata/include/self.qtpl" %}{% endfunc %}`,
+		"include cycle found: self.qtpl -> self.qtpl")
+
+	// the same file may be included multiple times
+	testParseSuccess(t, `{% func f(name string) %}{% include "testdata/include/greeting.qtpl" %}{% include "testdata/include/greeting.qtpl" %}{% endfunc %}`)
+
+	// non-existing file
+	testParseFailure(t, `{% func f() %}{% include "testdata/include/non-existing.qtpl" %}{% endfunc %}`)
+
+	// non-const string
+	testParseFailure(t, `{% func f() %}{% include "foo"+".qtpl" %}{% endfunc %}`)
+	testParseFailure(t, `{% func f() %}{% include foo %}{% endfunc %}`)
+
+	// tags must be balanced inside the included file
+	testParseFailure(t, `{% func f() %}{% include "testdata/include/unclosed.qtpl" %}{% endif %}{% endfunc %}`)
+	testParseFailure(t, `{% func f() %}{% include "testdata/include/endfunc.qtpl" %}`)
+
+	// the position in the included file is reported
+	testParseFailureMsg(t, `{% func f() %}{% include "testdata/include/unclosed.qtpl" %}{% endfunc %}`,
+		`: testdata/include/unclosed.qtpl:1:16: cannot find endif tag`)
+
+	// include outside func
+	testParseFailure(t, `{% include "testdata/include/greeting.qtpl" %}`)
+}
+
+func TestParseIncludeLoops(t *testing.T) {
+	// loops inside the included file
+	testParseCode(t, `{% func f(items []string) %}{% include "testdata/include/loop.qtpl" %}{% endfunc %}`,
+		"\tqfor422016_1:\n",
+		"\t\t\tbreak\n",
+		"\t\t\tcontinue qfor422016_1\n")
+	testParseCode(t, `{% func f(items []string) %}{% for %}{% include "testdata/include/loop.qtpl" %}{% break %}{% endfor %}{% endfunc %}`,
+		"\t\tqfor422016_2:\n",
+		"\t\t\t\tcontinue qfor422016_2\n")
+
+	// the depth is restored after the include
+	testParseSuccess(t, `{% func f(items []string) %}{% for %}{% include "testdata/include/loop.qtpl" %}{% continue %}{% endfor %}{% endfunc %}`)
+	testParseFailure(t, `{% func f(items []string) %}{% include "testdata/include/loop.qtpl" %}{% break %}{% endfunc %}`)
+
+	// break and continue outside loops in the included file
+	testParseFailureMsg(t, `{% func f() %}{% include "testdata/include/break.qtpl" %}{% endfunc %}`,
+		"found break tag outside for loop and switch block")
+	testParseFailureMsg(t, `{% func f() %}{% for %}{% include "testdata/include/break.qtpl" %}{% endfor %}{% endfunc %}`,
+		"found break tag outside for loop and switch block")
+	testParseFailure(t, `{% func f() %}{% switch %}{% case true %}{% include "testdata/include/break.qtpl" %}{% endswitch %}{% endfunc %}`)
+	testParseFailureMsg(t, `{% func f() %}{% for %}{% include "testdata/include/continue.qtpl" %}{% endfor %}{% endfunc %}`,
+		"found continue tag outside for loop")
+
+	// break N mustn't refer loops outside the included file
+	testParseFailureMsg(t, `{% func f() %}{% for %}{% include "testdata/include/break2.qtpl" %}{% endfor %}{% endfunc %}`,
+		"exceeds the number of enclosing for loops: 1")
+}
+
+func TestGetPackageName(t *testing.T) {
+	f := func(filename, expectedName string) {
+		name, err := PackageName(filename)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %s", filename, err)
+		}
+		if name != expectedName {
+			t.Fatalf("unexpected package name for %q: %q. Expecting %q", filename, name, expectedName)
+		}
+	}
+	f("templates/index.qtpl", "templates")
+	f("templates/page.html.qtpl", "templates")
+	f("templates/.hidden.qtpl", "templates")
+	f("/foo/bar/templates/a.b.c.qtpl", "templates")
+	f("./views/index.qtpl", "views")
+
+	// directory names, which cannot be used as package names
+	fe := func(filename string) {
+		t.Helper()
+		_, err := PackageName(filename)
+		if err == nil {
+			t.Fatalf("expecting non-nil error for %q", filename)
+		}
+		if !strings.Contains(err.Error(), "isn't a valid Go identifier") {
+			t.Fatalf("unexpected error for %q: %s", filename, err)
+		}
+	}
+	fe("/index.qtpl")
+	fe("my-templates/index.qtpl")
+	fe("1views/index.qtpl")
+	fe("func/index.qtpl")
+	fe("_/index.qtpl")
+
+	// the error is returned when compiling the template
+	_, err := CompileString("{% func F() %}{% endfunc %}", "my-templates/index.qtpl")
+	if err == nil || !strings.Contains(err.Error(), `cannot determine package name for "my-templates/index.qtpl"`) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestParseImportsUsed(t *testing.T) {
+	// Only the packages referred by the generated code are imported.
+	testParseImports(t, `{% func F(s string) %}{%s s %}{% endfunc %}`,
+		`"io"`, `"github.com/valyala/quicktemplate"`)
+	testParseImports(t, `{% func stream F(s string) %}{%s s %}{% endfunc %}`,
+		`"github.com/valyala/quicktemplate"`)
+	testParseImports(t, `{% func ctx F() %}{% endfunc %}`,
+		`"context"`, `"io"`, `"github.com/valyala/quicktemplate"`)
+	testParseImports(t, `{% code type T int %}`)
+	testParseImports(t, `text only`)
+
+	// printf is formatted by QWriter.Printf, so fmt isn't imported.
+	testParseImports(t, `{% func F(n int) %}{% printf "%d items", n %}{% endfunc %}`,
+		`"io"`, `"github.com/valyala/quicktemplate"`)
+
+	// Packages imported by the template are kept as is.
+	testParseImports(t, `{% import "fmt" %}{% func F(n int) %}{%s fmt.Sprint(n) %}{% endfunc %}`,
+		`"fmt"`, `"io"`, `"github.com/valyala/quicktemplate"`)
+}
+
+func testParseImports(t *testing.T, src string, expectedImports ...string) {
+	t.Helper()
+
+	code, err := CompileString(src, "templates/imports.qtpl")
+	if err != nil {
+		t.Fatalf("unexpected error when compiling %q: %s", src, err)
+	}
+	f, err := goparser.ParseFile(gotoken.NewFileSet(), "", code, goparser.ImportsOnly)
+	if err != nil {
+		t.Fatalf("cannot parse the compiled code for %q: %s\n%s", src, err, code)
+	}
+	var imports []string
+	for _, spec := range f.Imports {
+		imports = append(imports, spec.Path.Value)
+	}
+	sort.Strings(imports)
+	sort.Strings(expectedImports)
+	if !reflect.DeepEqual(imports, expectedImports) && len(imports)+len(expectedImports) > 0 {
+		t.Fatalf("unexpected imports for %q; got %q; want %q\n%s", src, imports, expectedImports, code)
+	}
+}
+
+func TestParseFile(t *testing.T) {
+	filename := "testdata/test.qtpl"
+	f, err := os.Open(filename)
+	if err != nil {
+		t.Fatalf("cannot open file %q: %s", filename, err)
+	}
+	defer f.Close()
+
+	packageName, err := PackageName(filename)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	w := quicktemplate.AcquireByteBuffer()
+	if err := parse(w, f, filename, packageName); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	code, err := format.Source(w.B)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	quicktemplate.ReleaseByteBuffer(w)
+
+	expectedFilename := filename + ".compiled"
+	expectedCode, err := ioutil.ReadFile(expectedFilename)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if !bytes.Equal(code, expectedCode) {
+		t.Fatalf("unexpected code: %q\nExpecting %q", code, expectedCode)
+	}
+
+}
+
+func TestParseErrorPosition(t *testing.T) {
+	// Errors must point to the offending token, not to the token following it.
+	testParseFailureMsg(t, "{% func f() %}\n\n{% if\n  a b\n %}{% endif %}{% endfunc %}", "./foobar.tpl:4:3: ")
+	testParseFailureMsg(t, "{% func f() %}{% for %}\n\n\n  {% endif %}\nfoo{% endfor %}{% endfunc %}", "./foobar.tpl:4:6: ")
+	testParseFailureMsg(t, "{% func f() %}\n{%s a b %}\nfoo\n{% endfunc %}", "./foobar.tpl:2:5: ")
+}
+
+func TestParseErrorTypes(t *testing.T) {
+	// read errors are returned as is without ParseError
+	errRead := errors.New("disk failure")
+	r := io.MultiReader(strings.NewReader("{% func F() %}foo"), iotest.ErrReader(errRead))
+	err := parse(&bytes.Buffer{}, r, "./foobar.tpl", "memory")
+	if !errors.Is(err, errRead) {
+		t.Fatalf("unexpected error: %v. Expecting %v", err, errRead)
+	}
+	var pe *ParseError
+	if errors.As(err, &pe) {
+		t.Fatalf("unexpected ParseError for read error: %s", err)
+	}
+
+	// syntax errors are returned as ParseError
+	err = parse(&bytes.Buffer{}, strings.NewReader("{% func f() %}\n{%s a b %}\nfoo\n{% endfunc %}"), "./foobar.tpl", "memory")
+	if !errors.As(err, &pe) {
+		t.Fatalf("expecting ParseError; got %T: %v", err, err)
+	}
+	if pe.File != "./foobar.tpl" || pe.Line != 2 || pe.Col != 5 {
+		t.Fatalf("unexpected error position: %s:%d:%d. Expecting ./foobar.tpl:2:5", pe.File, pe.Line, pe.Col)
+	}
+	if !strings.HasPrefix(err.Error(), "./foobar.tpl:2:5: ") || !strings.HasSuffix(err.Error(), pe.Msg) {
+		t.Fatalf("unexpected error message: %q", err)
+	}
+
+	// the template ending inside the tag
+	err = parse(&bytes.Buffer{}, strings.NewReader("{% func f() %}{% if true %}foo{% endif"), "./foobar.tpl", "memory")
+	if !errors.As(err, &pe) {
+		t.Fatalf("expecting ParseError; got %T: %v", err, err)
+	}
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("unexpected error: %v. Expecting %v", err, io.ErrUnexpectedEOF)
+	}
+
+	// errors when reading the included files are returned
+	_, err = CompileString(`{% func f() %}{% cat "missing.txt" %}{% endfunc %}`, "testdata/foo.qtpl")
+	if !errors.As(err, &pe) {
+		t.Fatalf("expecting ParseError; got %T: %v", err, err)
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("unexpected error: %v. Expecting %v", err, fs.ErrNotExist)
+	}
+}
+
+func TestParseErrorKind(t *testing.T) {
+	// unexpected token
+	testParseErrorKind(t, "{% func f() %}\n{% else %}\n{% endfunc %}", KindUnexpectedToken, 2, 4)
+	testParseErrorKind(t, "foo\n{% endfunc %}", KindUnexpectedToken, 2, 4)
+	testParseErrorKind(t, "{% func f() %}{% for %}{% endfor g %}{% endfunc %}", KindUnexpectedToken, 1, 34)
+	testParseErrorKind(t, "{% func f() %}{% endfunc g %}", KindUnexpectedToken, 1, 26)
+
+	// unclosed tag
+	testParseErrorKind(t, "{% func f() %}\nfoo", KindUnclosedTag, 2, 3)
+	testParseErrorKind(t, "{% func f() %}{% if a %}foo{% endfunc %}", KindUnclosedTag, 1, 31)
+	testParseErrorKind(t, "{% func f() %}{%s a", KindUnclosedTag, 1, 19)
+
+	// empty expression
+	testParseErrorKind(t, "{% func f() %}\n  {% if %}{% endif %}{% endfunc %}", KindEmptyExpression, 2, 9)
+	testParseErrorKind(t, "{% func f() %}{% copy %}{% endfunc %}", KindEmptyExpression, 1, 23)
+
+	// invalid code
+	testParseErrorKind(t, "{% func f() %}\n{%s a b %}\n{% endfunc %}", KindInvalidCode, 2, 5)
+	testParseErrorKind(t, "{% func f(a b c) %}{% endfunc %}", KindInvalidCode, 1, 9)
+
+	// invalid funcs
+	testParseErrorKind(t, "{% func html text f() %}{% endfunc %}", KindInvalidFunc, 1, 9)
+	testParseErrorKind(t, "{% func f() %}{% endfunc %}\n{% func f() %}{% endfunc %}", KindInvalidFunc, 2, 9)
+
+	// misplaced tags
+	testParseErrorKind(t, "{% func f() %}{% break %}{% endfunc %}", KindMisplacedTag, 1, 24)
+	testParseErrorKind(t, "{% func f() %}{% endfunc %}{% package foo %}", KindMisplacedTag, 1, 31)
+
+	// include errors
+	testParseErrorKind(t, "{% func f() %}{% include \"testdata/missing.qtpl\" %}{% endfunc %}", KindInclude, 1, 26)
+	testParseErrorKind(t, "{% func f() %}{% include \"testdata/include/cycle_a.qtpl\" %}{% endfunc %}", KindInclude, 1, 26)
+}
+
+func testParseErrorKind(t *testing.T, str string, kind ErrorKind, line, col int) {
+	t.Helper()
+	err := parse(&bytes.Buffer{}, strings.NewReader(str), "./foobar.tpl", "memory")
+	var pe *ParseError
+	if !errors.As(err, &pe) {
+		t.Fatalf("expecting ParseError when parsing %q; got %T: %v", str, err, err)
+	}
+	if pe.Kind != kind {
+		t.Fatalf("unexpected error kind when parsing %q: %q. Expecting %q. Error: %s", str, pe.Kind, kind, err)
+	}
+	if pe.Line != line || pe.Col != col {
+		t.Fatalf("unexpected error position when parsing %q: %d:%d. Expecting %d:%d. Error: %s", str, pe.Line, pe.Col, line, col, err)
+	}
+}
+
+func TestParseCtxFunc(t *testing.T) {
+	// ctx is passed to ctx funcs defined before and after the caller
+	testParseCode(t, "{% func ctx child() %}{% endfunc %}{% func ctx Parent(s string) %}{%= child() %}{%=h Other(s) %}{% endfunc %}{% func ctx Other(s string) %}{% endfunc %}",
+		"qtctx422016 \"context\"",
+		"func StreamParent(qw422016 *qt422016.Writer, ctx qtctx422016.Context, s string) {",
+		"streamchild(qw422016, ctx)\n",
+		"WriteOther(qb422016, ctx, s)\n",
+		"StreamParent(qw422016, ctx, s)\n",
+		"func Parent(ctx qtctx422016.Context, s string) string {")
+
+	// ctx is passed to nested ctx funcs and from funcs nested inside ctx funcs
+	testParseCode(t, "{% func ctx F() %}{% func ctx li(s string) %}{% func g() %}{%= child() %}{% endfunc %}{% endfunc %}{%= li(\"a\") %}{% endfunc %}{% func ctx child() %}{% endfunc %}",
+		"streamli := func(qw422016 *qt422016.Writer, ctx qtctx422016.Context, s string) {",
+		"streamchild(qw422016, ctx)\n",
+		"streamli(qw422016, ctx, \"a\")\n")
+
+	// ctx isn't passed from funcs without ctx modifier and to methods
+	testParseCode(t, "{% func ctx child() %}{% endfunc %}{% func F(c context.Context) %}{%= child(c) %}{% endfunc %}",
+		"streamchild(qw422016, c)\n")
+	testParseCode(t, "{% func ctx (p *P) M() %}{% endfunc %}{% func ctx F(p *P) %}{%= p.M(ctx) %}{% endfunc %}",
+		"p.StreamM(qw422016, ctx)\n")
+
+	// ctx funcs inside code blocks are found
+	testParseCode(t, "{% code %}var x = `{%`{% endcode %}{% func ctx child() %}{% endfunc %}{% func ctx F() %}{%= child() %}{% endfunc %}",
+		"streamchild(qw422016, ctx)\n")
+
+	// context isn't imported without ctx funcs
+	r := bytes.NewBufferString("{% func F() %}{% endfunc %}")
+	w := &bytes.Buffer{}
+	if err := parse(w, r, "./foobar.tpl", "memory"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if strings.Contains(w.String(), "qtctx422016") {
+		t.Fatalf("unexpected context import in the generated code:\n%s", w.String())
+	}
+}
+
+func TestParseLogger(t *testing.T) {
+	var bb bytes.Buffer
+	opts := &ParseOptions{
+		Logger: slog.New(slog.NewTextHandler(&bb, &slog.HandlerOptions{
+			Level: slog.LevelDebug,
+			ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+				if a.Key == slog.TimeKey || a.Key == slog.LevelKey {
+					return slog.Attr{}
+				}
+				return a
+			},
+		})),
+	}
+
+	// nested tags are exited in the reverse order
+	src := "{% func f(items []int) %}\n{% for _, x := range items %}{% if x > 0 %}{%d x %}{% endif %}{% endfor %}\n{% endfunc %}"
+	if _, err := CompileStringWithOptions(src, "foobar.qtpl", opts); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expectedLogs := `msg=enter tag=template pos=foobar.qtpl:1:0
+msg=enter tag=func pos=foobar.qtpl:1:4
+msg=enter tag=for pos=foobar.qtpl:2:4
+msg=enter tag=if pos=foobar.qtpl:2:33
+msg=exit tag=if pos=foobar.qtpl:2:61
+msg=exit tag=for pos=foobar.qtpl:2:73
+msg=exit tag=func pos=foobar.qtpl:3:12
+msg=exit tag=template pos=foobar.qtpl:3:13
+`
+	if bb.String() != expectedLogs {
+		t.Fatalf("unexpected logs\n%s\nExpecting\n%s", bb.String(), expectedLogs)
+	}
+
+	// the error is logged when exiting the tag it is triggered in
+	bb.Reset()
+	src = "{% func f() %}{% if true %}{% for i := 0; i < %}{% endfor %}{% endif %}{% endfunc %}"
+	if _, err := CompileStringWithOptions(src, "foobar.qtpl", opts); err == nil {
+		t.Fatalf("expecting error")
+	}
+	logs := strings.Split(strings.TrimSpace(bb.String()), "\n")
+	if len(logs) != 8 {
+		t.Fatalf("unexpected number of log lines: %d. Expecting 8; logs:\n%s", len(logs), bb.String())
+	}
+	if !strings.HasPrefix(logs[3], "msg=enter tag=for pos=foobar.qtpl:1:31") {
+		t.Fatalf("expecting enter to for tag; got %q", logs[3])
+	}
+	if !strings.HasPrefix(logs[4], "msg=exit tag=for ") || !strings.Contains(logs[4], " err=") {
+		t.Fatalf("expecting exit from for tag with the error; got %q", logs[4])
+	}
+	if !strings.HasPrefix(logs[7], "msg=exit tag=template ") || !strings.Contains(logs[7], " err=") {
+		t.Fatalf("expecting exit from template with the error; got %q", logs[7])
+	}
+}
@@ -0,0 +1,787 @@
+package parser
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// token ids
+const (
+	text = iota
+	tagName
+	tagContents
+)
+
+var tokenStrMap = map[int]string{
+	text:        "text",
+	tagName:     "tagName",
+	tagContents: "tagContents",
+}
+
+func tokenIDToStr(id int) string {
+	str := tokenStrMap[id]
+	if str == "" {
+		panic(fmt.Sprintf("unknown tokenID=%d", id))
+	}
+	return str
+}
+
+type token struct {
+	ID    int
+	Value []byte
+
+	line int
+	pos  int
+}
+
+func (t *token) init(id, line, pos int) {
+	t.ID = id
+	t.Value = t.Value[:0]
+
+	t.line = line
+	t.pos = pos
+}
+
+func (t *token) String() string {
+	return fmt.Sprintf("Token %q, value %q", tokenIDToStr(t.ID), t.Value)
+}
+
+type scanner struct {
+	r   *bufio.Reader
+	t   token
+	c   byte
+	err error
+
+	filePath string
+
+	line    int
+	lineStr []byte
+
+	nextTokenID int
+
+	capture       bool
+	capturedValue []byte
+
+	// record and recordedValue are similar to capture and capturedValue,
+	// but they may be used together with capture, i.e. for recording
+	// func bodies containing plain and comment blocks.
+	record        bool
+	recordedValue []byte
+
+	collapseSpaceDepth int
+	stripSpaceDepth    int
+	stripNewlinesDepth int
+	rewind             bool
+
+	// raw disables special handling for comment, plain and whitespace
+	// control tags. They are returned as ordinary tags.
+	// Escaped tag delimiters are returned as is in text tokens.
+	raw bool
+
+	// tagOpen and tagClose are two-byte tag delimiters.
+	tagOpen  []byte
+	tagClose []byte
+
+	// onComment is called with the contents of comment tags if set.
+	// The comment is valid only until the callback returns.
+	onComment func(comment []byte)
+
+	// mustacheTag is the output tag name returned for {{ expr }} tags.
+	// {{{ expr }}} tags are returned as mustacheTag followed by '='.
+	// Mustache tags aren't recognized if mustacheTag is empty.
+	mustacheTag string
+
+	// mustacheBraces is the number of braces around the mustache tag
+	// being read, i.e. 2 for {{ expr }} and 3 for {{{ expr }}}.
+	mustacheBraces int
+}
+
+var (
+	defaultTagOpen  = []byte("{%")
+	defaultTagClose = []byte("%}")
+
+	mustacheTagClose = []byte("}}")
+)
+
+func newScanner(r io.Reader, filePath string) *scanner {
+	return newScannerDelims(r, filePath, defaultTagOpen, defaultTagClose)
+}
+
+// newScannerDelims returns a scanner for templates with the given
+// tag delimiters. Delimiters must be validated with validateDelims.
+func newScannerDelims(r io.Reader, filePath string, tagOpen, tagClose []byte) *scanner {
+	return &scanner{
+		r:        bufio.NewReader(r),
+		filePath: filePath,
+		tagOpen:  tagOpen,
+		tagClose: tagClose,
+	}
+}
+
+// validateDelims verifies whether the given tag delimiters may be used
+// by the scanner.
+func validateDelims(tagOpen, tagClose []byte) error {
+	if len(tagOpen) != 2 || len(tagClose) != 2 {
+		return fmt.Errorf("tag delimiters must contain exactly two bytes; got %q and %q", tagOpen, tagClose)
+	}
+	for _, c := range append(append([]byte{}, tagOpen...), tagClose...) {
+		if isSpace(c) || isTagNameChar(c) || c == '#' {
+			return fmt.Errorf("tag delimiters %q and %q cannot contain %q", tagOpen, tagClose, c)
+		}
+	}
+	return nil
+}
+
+func (s *scanner) Rewind() {
+	if s.rewind {
+		panic("BUG: duplicate Rewind call")
+	}
+	s.rewind = true
+}
+
+func (s *scanner) Next() bool {
+	if s.rewind {
+		s.rewind = false
+		return true
+	}
+	if s.err != nil && s.err != io.ErrUnexpectedEOF {
+		// The scanner cannot proceed after the error, since the reader
+		// position may be inconsistent with the current token.
+		return false
+	}
+
+	for {
+		if !s.scanToken() {
+			return false
+		}
+		switch s.t.ID {
+		case text:
+			if len(s.t.Value) == 0 {
+				// skip empty text
+				continue
+			}
+		case tagName:
+			if s.raw {
+				break
+			}
+			switch string(s.t.Value) {
+			case "#":
+				// single-line comment
+				if !s.readTagContents() {
+					return false
+				}
+				if s.onComment != nil {
+					s.onComment(s.t.Value)
+				}
+				continue
+			case "comment":
+				if !s.skipComment() {
+					return false
+				}
+				continue
+			case "plain":
+				if !s.readPlain() {
+					return false
+				}
+				if len(s.t.Value) == 0 {
+					// skip empty text
+					continue
+				}
+			case "collapsespace":
+				if !s.readTagContents() {
+					return false
+				}
+				s.collapseSpaceDepth++
+				continue
+			case "stripspace":
+				if !s.readTagContents() {
+					return false
+				}
+				s.stripSpaceDepth++
+				continue
+			case "stripnewlines":
+				if !s.readTagContents() {
+					return false
+				}
+				s.stripNewlinesDepth++
+				continue
+			case "endcollapsespace":
+				if s.collapseSpaceDepth == 0 {
+					s.err = errorf(KindUnexpectedToken, "endcollapsespace tag found without the corresponding collapsespace tag")
+					return false
+				}
+				if !s.readTagContents() {
+					return false
+				}
+				s.collapseSpaceDepth--
+				continue
+			case "endstripspace":
+				if s.stripSpaceDepth == 0 {
+					s.err = errorf(KindUnexpectedToken, "endstripspace tag found without the corresponding stripspace tag")
+					return false
+				}
+				if !s.readTagContents() {
+					return false
+				}
+				s.stripSpaceDepth--
+				continue
+			case "endstripnewlines":
+				if s.stripNewlinesDepth == 0 {
+					s.err = errorf(KindUnexpectedToken, "endstripnewlines tag found without the corresponding stripnewlines tag")
+					return false
+				}
+				if !s.readTagContents() {
+					return false
+				}
+				s.stripNewlinesDepth--
+				continue
+			case "space":
+				if !s.readTagContents() {
+					return false
+				}
+				s.t.init(text, s.t.line, s.t.pos)
+				s.t.Value = append(s.t.Value[:0], ' ')
+				return true
+			case "newline":
+				if !s.readTagContents() {
+					return false
+				}
+				s.t.init(text, s.t.line, s.t.pos)
+				s.t.Value = append(s.t.Value[:0], '\n')
+				return true
+			}
+		}
+		return true
+	}
+}
+
+func (s *scanner) readPlain() bool {
+	if !s.readTagContents() {
+		return false
+	}
+	return s.readRawBlock("endplain")
+}
+
+// readRawBlock reads unparsed contents until the given tag
+// into text token.
+func (s *scanner) readRawBlock(tagName string) bool {
+	startLine := s.line
+	startPos := s.pos()
+	v, ok := s.readRawUntilTag(tagName)
+	s.t.init(text, startLine, startPos)
+	if ok {
+		s.t.Value = append(s.t.Value[:0], v...)
+	}
+	return ok
+}
+
+// readCodeBlock reads unparsed contents until endcode tag into text token
+// like readRawBlock.
+//
+// The scanner is restored to the current position if there is no matching
+// endcode tag, i.e. if the input or the next code tag is reached before it.
+// This keeps empty {% code %} tags without endcode as no-op.
+func (s *scanner) readCodeBlock() bool {
+	startLine := s.line
+	startPos := s.pos()
+	v, ok := s.tryReadRawUntilTag("endcode", func(v []byte) bool {
+		return !s.hasCodeTag(v)
+	})
+	if ok {
+		s.t.init(text, startLine, startPos)
+		s.t.Value = append(s.t.Value[:0], v...)
+	}
+	return ok
+}
+
+// tryReadRawUntilTag returns unparsed contents until the given tag
+// if isValid returns true for them.
+//
+// Otherwise the scanner is restored to the current position, so the input
+// is read again by the next call.
+func (s *scanner) tryReadRawUntilTag(tagName string, isValid func(v []byte) bool) ([]byte, bool) {
+	t := s.t
+	t.Value = append([]byte(nil), s.t.Value...)
+	c, err, line, nextTokenID := s.c, s.err, s.line, s.nextTokenID
+	lineStr := append([]byte(nil), s.lineStr...)
+	recordedLen := len(s.recordedValue)
+
+	s.startCapture()
+	ok := s.skipUntilTag(tagName)
+	consumed := s.stopCapture()
+	if ok {
+		v := consumed[:bytes.LastIndex(consumed, s.tagOpen)]
+		if isValid(v) {
+			return v, true
+		}
+	}
+
+	consumed = append([]byte(nil), consumed...)
+	s.r = bufio.NewReader(io.MultiReader(bytes.NewReader(consumed), s.r))
+	s.t = t
+	s.c, s.err, s.line, s.nextTokenID = c, err, line, nextTokenID
+	s.lineStr = lineStr
+	if s.record {
+		s.recordedValue = s.recordedValue[:recordedLen]
+	}
+	return nil, false
+}
+
+// hasCodeTag returns true if v contains code tag.
+func (s *scanner) hasCodeTag(v []byte) bool {
+	for {
+		n := bytes.Index(v, s.tagOpen)
+		if n < 0 {
+			return false
+		}
+		v = bytes.TrimLeft(v[n+len(s.tagOpen):], " \t\r\n")
+		if !bytes.HasPrefix(v, []byte("code")) {
+			continue
+		}
+		rest := v[len("code"):]
+		if len(rest) == 0 || isSpace(rest[0]) || bytes.HasPrefix(rest, s.tagClose) {
+			return true
+		}
+	}
+}
+
+// readRawUntilTag returns unparsed contents until the given tag.
+//
+// The returned value is valid until the next call to readRawUntilTag.
+func (s *scanner) readRawUntilTag(tagName string) ([]byte, bool) {
+	s.startCapture()
+	ok := s.skipUntilTag(tagName)
+	v := s.stopCapture()
+	if ok {
+		n := bytes.LastIndex(v, s.tagOpen)
+		v = v[:n]
+	}
+	return v, ok
+}
+
+func (s *scanner) skipComment() bool {
+	if !s.readTagContents() {
+		return false
+	}
+	if s.onComment == nil {
+		return s.skipUntilTag("endcomment")
+	}
+	v, ok := s.readRawUntilTag("endcomment")
+	if ok {
+		s.onComment(v)
+	}
+	return ok
+}
+
+func (s *scanner) skipUntilTag(tagName string) bool {
+	ok := false
+	for {
+		if !s.nextByte() {
+			break
+		}
+		if s.c != s.tagOpen[0] {
+			continue
+		}
+		if !s.nextByte() {
+			break
+		}
+		if s.c != s.tagOpen[1] {
+			s.unreadByte('~')
+			continue
+		}
+		ok = s.readTagName()
+		s.nextTokenID = text
+		if !ok {
+			s.err = nil
+			continue
+		}
+		if string(s.t.Value) == tagName {
+			ok = s.readTagContents()
+			break
+		}
+		// The tag doesn't match, so it mustn't be reported as found
+		// if the input ends here.
+		ok = false
+	}
+	if !ok {
+		s.err = errorf(KindUnclosedTag, "cannot find %q tag: %w", tagName, s.err)
+	}
+	return ok
+}
+
+func (s *scanner) scanToken() bool {
+	switch s.nextTokenID {
+	case text:
+		return s.readText()
+	case tagName:
+		return s.readTagName()
+	case tagContents:
+		return s.readTagContents()
+	default:
+		panic(fmt.Sprintf("BUG: unknown nextTokenID %d", s.nextTokenID))
+	}
+}
+
+func (s *scanner) readText() bool {
+	s.t.init(text, s.line, s.pos())
+	ok := false
+	for {
+		if !s.nextByte() {
+			ok = (len(s.t.Value) > 0)
+			break
+		}
+		if s.c == '{' && len(s.mustacheTag) > 0 && !s.raw {
+			if !s.nextByte() {
+				s.appendByte()
+				ok = true
+				break
+			}
+			if s.c == '{' {
+				s.mustacheBraces = 2
+				if s.nextByte() {
+					if s.c == '{' {
+						s.mustacheBraces = 3
+					} else {
+						s.unreadByte('{')
+					}
+				}
+				s.nextTokenID = tagName
+				ok = true
+				break
+			}
+			// Not a mustache tag. The byte is read again below,
+			// since it may start the ordinary tag.
+			s.unreadByte('{')
+		}
+		if s.c != s.tagOpen[0] {
+			s.appendByte()
+			continue
+		}
+		if !s.nextByte() {
+			s.appendByte()
+			ok = true
+			break
+		}
+		if s.c == s.tagOpen[1] {
+			if !s.nextByte() {
+				s.nextTokenID = tagName
+				ok = true
+				break
+			}
+			if s.c != s.tagOpen[1] {
+				s.unreadByte(s.tagOpen[1])
+				s.nextTokenID = tagName
+				ok = true
+				break
+			}
+			// {%% is an escaped {% in the text.
+			s.t.Value = append(s.t.Value, s.tagOpen...)
+			if s.raw {
+				s.appendByte()
+			}
+			continue
+		}
+		s.unreadByte(s.tagOpen[0])
+		s.appendByte()
+	}
+	if s.stripSpaceDepth > 0 {
+		s.t.Value = stripSpace(s.t.Value)
+	} else if s.collapseSpaceDepth > 0 {
+		s.t.Value = collapseSpace(s.t.Value)
+	} else if s.stripNewlinesDepth > 0 {
+		s.t.Value = stripNewlines(s.t.Value)
+	}
+	return ok
+}
+
+func (s *scanner) readTagName() bool {
+	if s.mustacheBraces > 0 {
+		// {{ expr }} is returned as {%v expr %}, while {{{ expr }}}
+		// is returned as {%v= expr %}.
+		s.t.init(tagName, s.line, s.pos())
+		s.t.Value = append(s.t.Value, s.mustacheTag...)
+		if s.mustacheBraces == 3 {
+			s.t.Value = append(s.t.Value, '=')
+		}
+		s.nextTokenID = tagContents
+		return true
+	}
+	s.skipSpace()
+	s.t.init(tagName, s.line, s.pos())
+	if s.c == '#' {
+		// single-line comment tag may be immediately followed by its contents.
+		s.appendByte()
+		s.nextTokenID = tagContents
+		return true
+	}
+	for {
+		if s.isSpace() || s.c == s.tagClose[0] {
+			if s.c == s.tagClose[0] {
+				s.unreadByte('~')
+			}
+			s.nextTokenID = tagContents
+			return true
+		}
+		if isTagNameChar(s.c) {
+			s.appendByte()
+			if !s.nextByte() {
+				return false
+			}
+			continue
+		}
+		s.err = errorf(KindUnexpectedToken, "unexpected character: '%c'", s.c)
+		s.unreadByte('~')
+		return false
+	}
+}
+
+func (s *scanner) readTagContents() bool {
+	// Go literals may contain the closing delimiter in all the tags except tags
+	// with free-form contents. s.t contains the tag name at the moment.
+	skipLiterals := !isFreeFormTag(s.t.Value)
+	tagClose := s.tagClose
+	if s.mustacheBraces > 0 {
+		tagClose = mustacheTagClose
+	}
+
+	s.skipSpace()
+	s.t.init(tagContents, s.line, s.pos())
+	state := goCode
+	prev := byte(0)
+	for {
+		if state == goLiteral {
+			s.appendByte()
+			if s.c == '\\' && prev != '`' {
+				if !s.nextByte() {
+					return false
+				}
+				s.appendByte()
+			} else if s.c == prev {
+				state = goCode
+			}
+			if !s.nextByte() {
+				return false
+			}
+			continue
+		}
+		if s.c != tagClose[0] {
+			s.appendByte()
+			if skipLiterals {
+				state, prev = nextGoCodeState(state, prev, s.c)
+			}
+			if !s.nextByte() {
+				return false
+			}
+			continue
+		}
+		if !s.nextByte() {
+			s.appendByte()
+			return false
+		}
+		if s.c == tagClose[1] {
+			if s.mustacheBraces == 3 && (!s.nextByte() || s.c != '}') {
+				if s.err == nil {
+					s.err = errorf(KindUnclosedTag, "missing '}}}' after {{{ tag contents")
+				}
+				return false
+			}
+			s.mustacheBraces = 0
+			s.nextTokenID = text
+			s.t.Value = stripTrailingSpace(s.t.Value)
+			return true
+		}
+		s.unreadByte(tagClose[0])
+		s.appendByte()
+		prev = tagClose[0]
+		if !s.nextByte() {
+			return false
+		}
+	}
+}
+
+// states for Go code inside tag contents
+const (
+	goCode = iota
+	goLiteral
+	goLineComment
+	goBlockComment
+)
+
+// nextGoCodeState returns the next state after the given c.
+//
+// prev holds the previous char outside literals and the opening quote
+// inside literals.
+func nextGoCodeState(state int, prev, c byte) (int, byte) {
+	switch state {
+	case goCode:
+		switch {
+		case c == '"' || c == '\'' || c == '`':
+			return goLiteral, c
+		case prev == '/' && c == '/':
+			return goLineComment, 0
+		case prev == '/' && c == '*':
+			return goBlockComment, 0
+		}
+	case goLineComment:
+		if c == '\n' {
+			return goCode, 0
+		}
+	case goBlockComment:
+		if prev == '*' && c == '/' {
+			return goCode, 0
+		}
+	}
+	return state, c
+}
+
+func isTagNameChar(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c == '=' || c == '.' || c == '?' || c == ':'
+}
+
+// isFreeFormTag returns true for tags with contents other than Go code.
+func isFreeFormTag(tagName []byte) bool {
+	switch string(tagName) {
+	case "#", "comment", "endcomment", "plain", "endplain":
+		return true
+	}
+	return false
+}
+
+func (s *scanner) skipSpace() {
+	for s.nextByte() && s.isSpace() {
+	}
+}
+
+func (s *scanner) isSpace() bool {
+	return isSpace(s.c)
+}
+
+func (s *scanner) nextByte() bool {
+	if s.err != nil {
+		return false
+	}
+	c, err := s.r.ReadByte()
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		s.err = err
+		return false
+	}
+	if c == '\n' {
+		s.line++
+		s.lineStr = s.lineStr[:0]
+	} else {
+		s.lineStr = append(s.lineStr, c)
+	}
+	s.c = c
+	if s.capture {
+		s.capturedValue = append(s.capturedValue, c)
+	}
+	if s.record {
+		s.recordedValue = append(s.recordedValue, c)
+	}
+	return true
+}
+
+func (s *scanner) startCapture() {
+	s.capture = true
+	s.capturedValue = s.capturedValue[:0]
+}
+
+func (s *scanner) stopCapture() []byte {
+	s.capture = false
+	v := s.capturedValue
+	s.capturedValue = s.capturedValue[:0]
+	return v
+}
+
+func (s *scanner) startRecord() {
+	s.record = true
+	s.recordedValue = s.recordedValue[:0]
+}
+
+// stopRecord returns the source read since startRecord call
+// until the start of the current tag.
+func (s *scanner) stopRecord() []byte {
+	s.record = false
+	v := s.recordedValue
+	if n := bytes.LastIndex(v, s.tagOpen); n >= 0 {
+		v = v[:n]
+	}
+	return append([]byte(nil), v...)
+}
+
+func (s *scanner) Token() *token {
+	return &s.t
+}
+
+func (s *scanner) LastError() error {
+	if s.err == nil {
+		return nil
+	}
+	if s.err == io.ErrUnexpectedEOF && s.t.ID == text {
+		if s.collapseSpaceDepth > 0 {
+			return errorf(KindUnclosedTag, "missing endcollapsespace tag at %s", s.Context())
+		}
+		if s.stripSpaceDepth > 0 {
+			return errorf(KindUnclosedTag, "missing endstripspace tag at %s", s.Context())
+		}
+		if s.stripNewlinesDepth > 0 {
+			return errorf(KindUnclosedTag, "missing endstripnewlines tag at %s", s.Context())
+		}
+		return nil
+	}
+
+	return fmt.Errorf("error when reading %s at %s: %w",
+		tokenIDToStr(s.t.ID), s.Context(), s.err)
+}
+
+func (s *scanner) appendByte() {
+	s.t.Value = append(s.t.Value, s.c)
+}
+
+func (s *scanner) unreadByte(c byte) {
+	if err := s.r.UnreadByte(); err != nil {
+		panic(fmt.Sprintf("BUG: bufio.Reader.UnreadByte returned non-nil error: %s", err))
+	}
+	if s.capture {
+		s.capturedValue = s.capturedValue[:len(s.capturedValue)-1]
+	}
+	if s.record {
+		s.recordedValue = s.recordedValue[:len(s.recordedValue)-1]
+	}
+	if s.c == '\n' {
+		s.line--
+		s.lineStr = s.lineStr[:0] // TODO: use correct line
+	} else {
+		s.lineStr = s.lineStr[:len(s.lineStr)-1]
+	}
+	s.c = c
+}
+
+func (s *scanner) pos() int {
+	return len(s.lineStr)
+}
+
+// Context returns the current token and line for error messages.
+//
+// The file and the position aren't included, since they are already
+// reported by ParseError.
+func (s *scanner) Context() string {
+	t := s.Token()
+	return fmt.Sprintf("token %s, last line %s", snippet(t.Value), snippet(s.lineStr))
+}
+
+func (s *scanner) WriteLineComment(w io.Writer) {
+	fmt.Fprintf(w, "//line %s:%d\n", s.filePath, s.t.line+1)
+}
+
+func snippet(s []byte) string {
+	if len(s) <= 40 {
+		return fmt.Sprintf("%q", s)
+	}
+	return fmt.Sprintf("%q ... %q", s[:20], s[len(s)-20:])
+}
@@ -0,0 +1,481 @@
+package parser
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestScannerTagNameWithDotAndEqual(t *testing.T) {
+	testScannerSuccess(t, "{%foo.bar.34 baz aaa%} awer{% aa= %}",
+		[]tt{
+			{ID: tagName, Value: "foo.bar.34"},
+			{ID: tagContents, Value: "baz aaa"},
+			{ID: text, Value: " awer"},
+			{ID: tagName, Value: "aa="},
+			{ID: tagContents, Value: ""},
+		})
+}
+
+func TestScannerStripspaceSuccess(t *testing.T) {
+	testScannerSuccess(t, "  aa\n\t {%stripspace%} \t\n  f\too \n   b  ar \n\r\t {%  bar baz  asd %}\n\nbaz \n\t \taaa  \n{%endstripspace%} bb  ", []tt{
+		{ID: text, Value: "  aa\n\t "},
+		{ID: text, Value: "f\toob  ar"},
+		{ID: tagName, Value: "bar"},
+		{ID: tagContents, Value: "baz  asd"},
+		{ID: text, Value: "bazaaa"},
+		{ID: text, Value: " bb  "},
+	})
+	testScannerSuccess(t, "{%stripspace  %}{% stripspace fobar %} {%space%}  a\taa\n\r\t bb  b  {%endstripspace  %}  {%endstripspace  baz%}", []tt{
+		{ID: text, Value: " "},
+		{ID: text, Value: "a\taabb  b"},
+	})
+
+	// sripspace wins over collapsespace
+	testScannerSuccess(t, "{%stripspace%} {%collapsespace%}foo\n\t bar{%endcollapsespace%} \r\n\t {%endstripspace%}", []tt{
+		{ID: text, Value: "foobar"},
+	})
+}
+
+func TestScannerSpaceNewline(t *testing.T) {
+	testScannerSuccess(t, "a{% space %}b{% newline %}c", []tt{
+		{ID: text, Value: "a"},
+		{ID: text, Value: " "},
+		{ID: text, Value: "b"},
+		{ID: text, Value: "\n"},
+		{ID: text, Value: "c"},
+	})
+
+	// explicit space and newline survive stripspace and collapsespace
+	testScannerSuccess(t, "{% stripspace %}\n\ta\n\t{% space %}\n\tb  {%newline%}  c\n{% endstripspace %}", []tt{
+		{ID: text, Value: "a"},
+		{ID: text, Value: " "},
+		{ID: text, Value: "b"},
+		{ID: text, Value: "\n"},
+		{ID: text, Value: "c"},
+	})
+	testScannerSuccess(t, "{% collapsespace %}a{% newline %}\n\n{% space %}{% space %}b{% endcollapsespace %}", []tt{
+		{ID: text, Value: "a"},
+		{ID: text, Value: "\n"},
+		{ID: text, Value: " "},
+		{ID: text, Value: " "},
+		{ID: text, Value: " "},
+		{ID: text, Value: "b"},
+	})
+
+	// unexpected contents
+	testScannerFailure(t, "{% space")
+	testScannerFailure(t, "{% newline %")
+}
+
+func TestScannerStripspaceFailure(t *testing.T) {
+	// incomplete stripspace tag
+	testScannerFailure(t, "{%stripspace   ")
+
+	// incomplete endstripspace tag
+	testScannerFailure(t, "{%stripspace%}aaa{%endstripspace")
+
+	// missing endstripspace
+	testScannerFailure(t, "{%stripspace%} foobar")
+
+	// missing stripspace
+	testScannerFailure(t, "aaa{%endstripspace%}")
+
+	// missing the second endstripspace
+	testScannerFailure(t, "{%stripspace%}{%stripspace%}aaaa{%endstripspace%}")
+}
+
+func TestScannerStripnewlinesSuccess(t *testing.T) {
+	testScannerSuccess(t, "a\n{%stripnewlines%}\n  f\too \r\n  bar\n{% bar baz %}\n\tbaz \n{%endstripnewlines%}\nbb", []tt{
+		{ID: text, Value: "a\n"},
+		{ID: text, Value: "  f\too   bar"},
+		{ID: tagName, Value: "bar"},
+		{ID: tagContents, Value: "baz"},
+		{ID: text, Value: "\tbaz "},
+		{ID: text, Value: "\nbb"},
+	})
+
+	// explicit newline survives stripnewlines
+	testScannerSuccess(t, "{% stripnewlines %}a\n{% newline %}\nb\r{% endstripnewlines %}", []tt{
+		{ID: text, Value: "a"},
+		{ID: text, Value: "\n"},
+		{ID: text, Value: "b\r"},
+	})
+
+	// stripspace wins over stripnewlines
+	testScannerSuccess(t, "{%stripnewlines%}{%stripspace%} foo\n bar {%endstripspace%} a \n b{%endstripnewlines%}", []tt{
+		{ID: text, Value: "foobar"},
+		{ID: text, Value: " a  b"},
+	})
+}
+
+func TestScannerStripnewlinesFailure(t *testing.T) {
+	// incomplete stripnewlines tag
+	testScannerFailure(t, "{%stripnewlines   ")
+
+	// incomplete endstripnewlines tag
+	testScannerFailure(t, "{%stripnewlines%}aaa{%endstripnewlines")
+
+	// missing endstripnewlines
+	testScannerFailure(t, "{%stripnewlines%} foobar")
+
+	// missing stripnewlines
+	testScannerFailure(t, "aaa{%endstripnewlines%}")
+
+	// missing the second endstripnewlines
+	testScannerFailure(t, "{%stripnewlines%}{%stripnewlines%}aaaa{%endstripnewlines%}")
+}
+
+func TestScannerCollapsespaceSuccess(t *testing.T) {
+	testScannerSuccess(t, "  aa\n\t {%collapsespace%} \t\n  foo \n   bar{%  bar baz  asd %}\n\nbaz \n   \n{%endcollapsespace%} bb  ", []tt{
+		{ID: text, Value: "  aa\n\t "},
+		{ID: text, Value: " foo bar"},
+		{ID: tagName, Value: "bar"},
+		{ID: tagContents, Value: "baz  asd"},
+		{ID: text, Value: " baz "},
+		{ID: text, Value: " bb  "},
+	})
+	testScannerSuccess(t, "{%collapsespace  %}{% collapsespace fobar %} {%space%}  aaa\n\r\t bbb  {%endcollapsespace  %}  {%endcollapsespace  baz%}", []tt{
+		{ID: text, Value: " "},
+		{ID: text, Value: " "},
+		{ID: text, Value: " aaa bbb "},
+		{ID: text, Value: " "},
+	})
+}
+
+func TestScannerCollapsespaceFailure(t *testing.T) {
+	// incomplete collapsespace tag
+	testScannerFailure(t, "{%collapsespace   ")
+
+	// incomplete endcollapsespace tag
+	testScannerFailure(t, "{%collapsespace%}aaa{%endcollapsespace")
+
+	// missing endcollapsespace
+	testScannerFailure(t, "{%collapsespace%} foobar")
+
+	// missing collapsespace
+	testScannerFailure(t, "aaa{%endcollapsespace%}")
+
+	// missing the second endcollapsespace
+	testScannerFailure(t, "{%collapsespace%}{%collapsespace%}aaaa{%endcollapsespace%}")
+}
+
+func TestScannerPlainSuccess(t *testing.T) {
+	testScannerSuccess(t, "{%plain%}{%endplain%}", nil)
+	testScannerSuccess(t, "{%plain%}{%foo bar%}asdf{%endplain%}", []tt{
+		{ID: text, Value: "{%foo bar%}asdf"},
+	})
+	testScannerSuccess(t, "{%plain%}{%foo{%endplain%}", []tt{
+		{ID: text, Value: "{%foo"},
+	})
+	testScannerSuccess(t, "aa{%plain%}bbb{%cc%}{%endplain%}{%plain%}dsff{%endplain%}", []tt{
+		{ID: text, Value: "aa"},
+		{ID: text, Value: "bbb{%cc%}"},
+		{ID: text, Value: "dsff"},
+	})
+	testScannerSuccess(t, "mmm{%plain%}aa{% bar {%%% }baz{%endplain%}nnn", []tt{
+		{ID: text, Value: "mmm"},
+		{ID: text, Value: "aa{% bar {%%% }baz"},
+		{ID: text, Value: "nnn"},
+	})
+	testScannerSuccess(t, "{% plain dsd %}0{%comment%}123{%endcomment%}45{% endplain aaa %}", []tt{
+		{ID: text, Value: "0{%comment%}123{%endcomment%}45"},
+	})
+}
+
+func TestScannerPlainFailure(t *testing.T) {
+	testScannerFailure(t, "{%plain%}sdfds")
+	testScannerFailure(t, "{%plain%}aaaa%{%endplain")
+	testScannerFailure(t, "{%plain%}{%endplain%")
+}
+
+func TestScannerCommentSuccess(t *testing.T) {
+	testScannerSuccess(t, "{%comment%}{%endcomment%}", nil)
+	testScannerSuccess(t, "{%comment%}foo{%endcomment%}", nil)
+	testScannerSuccess(t, "{%comment%}foo{%endcomment%}{%comment%}sss{%endcomment%}", nil)
+	testScannerSuccess(t, "{%comment%}foo{%bar%}{%endcomment%}", nil)
+	testScannerSuccess(t, "{%comment%}foo{%bar {%endcomment%}", nil)
+	testScannerSuccess(t, "{%comment%}foo{%bar&^{%endcomment%}", nil)
+	testScannerSuccess(t, "{%comment%}foo{% bar\n\rs%{%endcomment%}", nil)
+	testScannerSuccess(t, "xx{%x%}www{% comment aux data %}aaa{% comment %}{% endcomment %}yy", []tt{
+		{ID: text, Value: "xx"},
+		{ID: tagName, Value: "x"},
+		{ID: tagContents, Value: ""},
+		{ID: text, Value: "www"},
+		{ID: text, Value: "yy"},
+	})
+}
+
+func TestScannerCommentFailure(t *testing.T) {
+	testScannerFailure(t, "{%comment%}...no endcomment")
+	testScannerFailure(t, "{% comment %}foobar{% endcomment")
+}
+
+func TestScannerSingleLineCommentSuccess(t *testing.T) {
+	testScannerSuccess(t, "{%# comment %}", nil)
+	testScannerSuccess(t, "{%#%}{% # %}{%#comment%}", nil)
+	testScannerSuccess(t, "foo{%# comment with {% and } %}bar", []tt{
+		{ID: text, Value: "foo"},
+		{ID: text, Value: "bar"},
+	})
+	testScannerSuccess(t, "{%stripspace%}\n  foo\n  {%# comment %}\n  bar\n{%endstripspace%}", []tt{
+		{ID: text, Value: "foo"},
+		{ID: text, Value: "bar"},
+	})
+	testScannerSuccess(t, "{%collapsespace%}foo {%# comment %} bar{%endcollapsespace%}", []tt{
+		{ID: text, Value: "foo "},
+		{ID: text, Value: " bar"},
+	})
+}
+
+func TestScannerSingleLineCommentFailure(t *testing.T) {
+	testScannerFailure(t, "{%# comment")
+	testScannerFailure(t, "{%# comment %")
+}
+
+func TestScannerSuccess(t *testing.T) {
+	testScannerSuccess(t, "", nil)
+	testScannerSuccess(t, "a%}{foo}bar", []tt{
+		{ID: text, Value: "a%}{foo}bar"},
+	})
+	testScannerSuccess(t, "{% foo bar baz(a, b, 123) %}", []tt{
+		{ID: tagName, Value: "foo"},
+		{ID: tagContents, Value: "bar baz(a, b, 123)"},
+	})
+	testScannerSuccess(t, "foo{%bar%}baz", []tt{
+		{ID: text, Value: "foo"},
+		{ID: tagName, Value: "bar"},
+		{ID: tagContents, Value: ""},
+		{ID: text, Value: "baz"},
+	})
+	testScannerSuccess(t, "{{{%\n\r\tfoo bar\n\rbaz%%\n   \r %}}", []tt{
+		{ID: text, Value: "{{"},
+		{ID: tagName, Value: "foo"},
+		{ID: tagContents, Value: "bar\n\rbaz%%"},
+		{ID: text, Value: "}"},
+	})
+	testScannerSuccess(t, "{% %}", []tt{
+		{ID: tagName, Value: ""},
+		{ID: tagContents, Value: ""},
+	})
+	testScannerSuccess(t, "{% %aaa bb%}", []tt{
+		{ID: tagName, Value: ""},
+		{ID: tagContents, Value: "%aaa bb"},
+	})
+	testScannerSuccess(t, "foo{% bar %}{% baz aa (123)%}321", []tt{
+		{ID: text, Value: "foo"},
+		{ID: tagName, Value: "bar"},
+		{ID: tagContents, Value: ""},
+		{ID: tagName, Value: "baz"},
+		{ID: tagContents, Value: "aa (123)"},
+		{ID: text, Value: "321"},
+	})
+}
+
+func TestScannerBracesInLiterals(t *testing.T) {
+	testScannerSuccess(t, `{% if s == "}" %}`, []tt{
+		{ID: tagName, Value: "if"},
+		{ID: tagContents, Value: `s == "}"`},
+	})
+	testScannerSuccess(t, "{% if r == '}' || s == `}{` %}", []tt{
+		{ID: tagName, Value: "if"},
+		{ID: tagContents, Value: "r == '}' || s == `}{`"},
+	})
+	testScannerSuccess(t, `{% code m := map[string]string{"}": "{%"} %}`, []tt{
+		{ID: tagName, Value: "code"},
+		{ID: tagContents, Value: `m := map[string]string{"}": "{%"}`},
+	})
+	testScannerSuccess(t, `{%s fmt.Sprintf("100%%, %d}", n) %}`, []tt{
+		{ID: tagName, Value: "s"},
+		{ID: tagContents, Value: `fmt.Sprintf("100%%, %d}", n)`},
+	})
+}
+
+func TestScannerPercentBraceInLiterals(t *testing.T) {
+	testScannerSuccess(t, `{% code s := "50%}" %}foo`, []tt{
+		{ID: tagName, Value: "code"},
+		{ID: tagContents, Value: `s := "50%}"`},
+		{ID: text, Value: "foo"},
+	})
+	testScannerSuccess(t, `{% code s := "a\"%}" + "b" %}`, []tt{
+		{ID: tagName, Value: "code"},
+		{ID: tagContents, Value: `s := "a\"%}" + "b"`},
+	})
+	testScannerSuccess(t, "{% code s := `%}\n%}` %}", []tt{
+		{ID: tagName, Value: "code"},
+		{ID: tagContents, Value: "s := `%}\n%}`"},
+	})
+	testScannerSuccess(t, `{% if c == '%' || c == '\'' %}x{% endif %}`, []tt{
+		{ID: tagName, Value: "if"},
+		{ID: tagContents, Value: `c == '%' || c == '\''`},
+		{ID: text, Value: "x"},
+		{ID: tagName, Value: "endif"},
+		{ID: tagContents, Value: ""},
+	})
+
+	// quotes inside comments and free-form tags don't start literals
+	testScannerSuccess(t, "{% code // don't %}a{% code /* \" */ %}b", []tt{
+		{ID: tagName, Value: "code"},
+		{ID: tagContents, Value: "// don't"},
+		{ID: text, Value: "a"},
+		{ID: tagName, Value: "code"},
+		{ID: tagContents, Value: `/* " */`},
+		{ID: text, Value: "b"},
+	})
+	testScannerSuccess(t, "{%# don't %}a{% comment don't %}b{% endcomment %}", []tt{
+		{ID: text, Value: "a"},
+	})
+}
+
+func TestScannerEscapedTagOpen(t *testing.T) {
+	testScannerSuccess(t, "{%%", []tt{
+		{ID: text, Value: "{%"},
+	})
+	testScannerSuccess(t, "{%%}", []tt{
+		{ID: text, Value: "{%}"},
+	})
+	testScannerSuccess(t, "a{%% }foo", []tt{
+		{ID: text, Value: "a{% }foo"},
+	})
+	testScannerSuccess(t, "use {%% example %} for {%%%%s x %}", []tt{
+		{ID: text, Value: "use {% example %} for {%%%s x %}"},
+	})
+	testScannerSuccess(t, "a{%% b {%s c %}{%%", []tt{
+		{ID: text, Value: "a{% b "},
+		{ID: tagName, Value: "s"},
+		{ID: tagContents, Value: "c"},
+		{ID: text, Value: "{%"},
+	})
+
+	// escapes aren't processed inside plain
+	testScannerSuccess(t, "{%plain%}{%%{%endplain%}", []tt{
+		{ID: text, Value: "{%%"},
+	})
+
+	// custom delimiters
+	s := newScannerDelims(bytes.NewBufferString("<%% foo %> <%s bar %>"), "memory", []byte("<%"), []byte("%>"))
+	if !s.Next() || s.Token().ID != text || string(s.Token().Value) != "<% foo %> " {
+		t.Fatalf("unexpected token: %s", s.Token())
+	}
+
+	// raw scanner preserves escapes
+	s = newScanner(bytes.NewBufferString("a{%%b"), "memory")
+	s.raw = true
+	if !s.Next() || s.Token().ID != text || string(s.Token().Value) != "a{%%b" {
+		t.Fatalf("unexpected token: %s", s.Token())
+	}
+}
+
+func TestScannerRawBlock(t *testing.T) {
+	str := "if x {\n\ts := \"%}{%\"\n}\n{% endcodex %}\n{% endcode %}tail"
+	s := newScanner(bytes.NewBufferString(str), "memory")
+	if !s.readRawBlock("endcode") {
+		t.Fatalf("unexpected error: %s", s.LastError())
+	}
+	tok := s.Token()
+	expectedS := "if x {\n\ts := \"%}{%\"\n}\n{% endcodex %}\n"
+	if tok.ID != text || string(tok.Value) != expectedS {
+		t.Fatalf("unexpected token %s. Expecting text %q", tok, expectedS)
+	}
+	if !s.Next() || string(s.Token().Value) != "tail" {
+		t.Fatalf("unexpected token after raw block: %s", s.Token())
+	}
+}
+
+func TestScannerFailure(t *testing.T) {
+	testScannerFailure(t, "a{%")
+	testScannerFailure(t, "a{%foo")
+	testScannerFailure(t, "a{% % }foo")
+	testScannerFailure(t, "a{% foo %")
+	testScannerFailure(t, "b{% fo() %}bar")
+	testScannerFailure(t, "aa{% foo bar")
+	testScannerFailure(t, `a{% code s := "%}`)
+	testScannerFailure(t, "a{% code s := `%}")
+	testScannerFailure(t, "0{%!")
+}
+
+func testScannerFailure(t *testing.T, str string) {
+	r := bytes.NewBufferString(str)
+	s := newScanner(r, "memory")
+	var tokens []tt
+	for s.Next() {
+		tokens = append(tokens, tt{
+			ID:    s.Token().ID,
+			Value: string(s.Token().Value),
+		})
+	}
+	if err := s.LastError(); err == nil {
+		t.Fatalf("expecting error when scanning %q. got tokens %v", str, tokens)
+	}
+	if s.Next() {
+		t.Fatalf("unexpected token after the error when scanning %q: %s", str, s.Token())
+	}
+}
+
+func testScannerSuccess(t *testing.T, str string, expectedTokens []tt) {
+	r := bytes.NewBufferString(str)
+	s := newScanner(r, "memory")
+	var tokens []tt
+	for s.Next() {
+		tokens = append(tokens, tt{
+			ID:    s.Token().ID,
+			Value: string(s.Token().Value),
+		})
+	}
+	if err := s.LastError(); err != nil {
+		t.Fatalf("unexpected error: %s. str=%q", err, str)
+	}
+	if !reflect.DeepEqual(tokens, expectedTokens) {
+		t.Fatalf("unexpected tokens %v. Expecting %v. str=%q", tokens, expectedTokens, str)
+	}
+}
+
+type tt struct {
+	ID    int
+	Value string
+}
+
+func TestScannerTokenPosition(t *testing.T) {
+	// Positions must point to the start of the token even if it spans multiple lines.
+	testScannerTokenPosition(t, "foo\n{% if\n  a &&\n  b %}bar{% endif %}", []tp{
+		{ID: text, line: 0, pos: 0},
+		{ID: tagName, line: 1, pos: 4},
+		{ID: tagContents, line: 2, pos: 3},
+		{ID: text, line: 3, pos: 6},
+		{ID: tagName, line: 3, pos: 13},
+		{ID: tagContents, line: 3, pos: 19},
+	})
+	testScannerTokenPosition(t, "{%s `a\nb` %}\n\n{% endfunc %}", []tp{
+		{ID: tagName, line: 0, pos: 3},
+		{ID: tagContents, line: 0, pos: 5},
+		{ID: text, line: 1, pos: 5},
+		{ID: tagName, line: 3, pos: 4},
+		{ID: tagContents, line: 3, pos: 12},
+	})
+}
+
+func testScannerTokenPosition(t *testing.T, str string, expectedTokens []tp) {
+	r := bytes.NewBufferString(str)
+	s := newScanner(r, "memory")
+	var tokens []tp
+	for s.Next() {
+		tok := s.Token()
+		tokens = append(tokens, tp{
+			ID:   tok.ID,
+			line: tok.line,
+			pos:  tok.pos,
+		})
+	}
+	if err := s.LastError(); err != nil {
+		t.Fatalf("unexpected error: %s. str=%q", err, str)
+	}
+	if !reflect.DeepEqual(tokens, expectedTokens) {
+		t.Fatalf("unexpected token positions %v. Expecting %v. str=%q", tokens, expectedTokens, str)
+	}
+}
+
+type tp struct {
+	ID   int
+	line int
+	pos  int
+}
@@ -0,0 +1,226 @@
+package parser
+
+import (
+	"bytes"
+	"fmt"
+	gotoken "go/token"
+	"io/fs"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// mangleSuffix is used for mangling quicktemplate-specific names
+// in the generated code, so they don't clash with user-provided names.
+const mangleSuffix = "422016"
+
+// validateIdent returns an error if the user-declared identifier name
+// shadows the mangled identifiers in the generated code.
+func validateIdent(name string) error {
+	if !strings.HasSuffix(name, mangleSuffix) {
+		return nil
+	}
+	switch name {
+	case "qw" + mangleSuffix, "qq" + mangleSuffix, "qb" + mangleSuffix:
+		return errorf(KindInvalidCode, "identifier %q conflicts with the template writer", name)
+	default:
+		return errorf(KindInvalidCode, "identifier %q conflicts with the identifiers generated by qtc", name)
+	}
+}
+
+func stripLeadingSpace(b []byte) []byte {
+	for len(b) > 0 && isSpace(b[0]) {
+		b = b[1:]
+	}
+	return b
+}
+
+func stripTrailingSpace(b []byte) []byte {
+	for len(b) > 0 && isSpace(b[len(b)-1]) {
+		b = b[:len(b)-1]
+	}
+	return b
+}
+
+func collapseSpace(b []byte) []byte {
+	return stripSpaceExt(b, true)
+}
+
+func stripSpace(b []byte) []byte {
+	return stripSpaceExt(b, false)
+}
+
+func stripSpaceExt(b []byte, isCollapse bool) []byte {
+	if len(b) == 0 {
+		return b
+	}
+
+	var dst []byte
+	if isCollapse && isSpace(b[0]) {
+		dst = append(dst, ' ')
+	}
+	isLastSpace := isSpace(b[len(b)-1])
+	for len(b) > 0 {
+		n := bytes.IndexByte(b, '\n')
+		if n < 0 {
+			n = len(b)
+		}
+		z := b[:n]
+		if n == len(b) {
+			b = b[n:]
+		} else {
+			b = b[n+1:]
+		}
+		z = stripLeadingSpace(z)
+		z = stripTrailingSpace(z)
+		if len(z) == 0 {
+			continue
+		}
+		dst = append(dst, z...)
+		if isCollapse {
+			dst = append(dst, ' ')
+		}
+	}
+	if isCollapse && !isLastSpace && len(dst) > 0 {
+		dst = dst[:len(dst)-1]
+	}
+	return dst
+}
+
+// stripNewlines removes "\n" and "\r\n" line endings from b,
+// while leaving the remaining whitespace intact.
+func stripNewlines(b []byte) []byte {
+	var dst []byte
+	for len(b) > 0 {
+		n := bytes.IndexByte(b, '\n')
+		if n < 0 {
+			return append(dst, b...)
+		}
+		z := b[:n]
+		if len(z) > 0 && z[len(z)-1] == '\r' {
+			z = z[:len(z)-1]
+		}
+		dst = append(dst, z...)
+		b = b[n+1:]
+	}
+	return dst
+}
+
+func isSpace(c byte) bool {
+	return unicode.IsSpace(rune(c))
+}
+
+func isUpper(c byte) bool {
+	return unicode.IsUpper(rune(c))
+}
+
+// PackageName returns the default package name for the template file.
+//
+// The package name is the name of the directory containing the file,
+// so dots and extensions in the file name don't affect it.
+// An error is returned if the directory name isn't a valid package name,
+// since the generated code wouldn't compile.
+func PackageName(filename string) (string, error) {
+	filenameAbs, err := filepath.Abs(filename)
+	if err != nil {
+		return "", err
+	}
+	dir, _ := filepath.Split(filenameAbs)
+	name := filepath.Base(dir)
+	if !gotoken.IsIdentifier(name) || name == "_" {
+		return "", fmt.Errorf("the name of the directory %q containing the template file cannot be used as package name, "+
+			"since it isn't a valid Go identifier; move the template file to the directory with a valid name such as \"templates\"", dir)
+	}
+	return name, nil
+}
+
+// includePath returns the path to filename referred from the file at cwd.
+func includePath(cwd, filename string) (string, error) {
+	if len(filename) == 0 {
+		return "", errorf(KindInclude, "filename cannot be empty")
+	}
+	if filename[0] == '/' {
+		return filename, nil
+	}
+	dir, _ := filepath.Split(cwd)
+	return filepath.Join(dir, filename), nil
+}
+
+// fsIncludePath returns the path to filename referred from the file at cwd
+// in fs.FS.
+//
+// fs.FS paths are slash-separated and relative to the filesystem root,
+// so absolute filenames such as "/partials/a.qtpl" refer the files
+// relative to the root.
+func fsIncludePath(cwd, filename string) (string, error) {
+	if len(filename) == 0 {
+		return "", errorf(KindInclude, "filename cannot be empty")
+	}
+	var name string
+	if filename[0] == '/' {
+		name = path.Clean(filename[1:])
+	} else {
+		name = path.Join(path.Dir(cwd), filename)
+	}
+	if !fs.ValidPath(name) {
+		return "", errorf(KindInclude, "%q refers to the file outside the filesystem", filename)
+	}
+	return name, nil
+}
+
+func readFile(cwd, filename string) ([]byte, error) {
+	if len(filename) == 0 {
+		return nil, errorf(KindInclude, "filename cannot be empty")
+	}
+	if filename[0] != '/' {
+		cwdAbs, err := filepath.Abs(cwd)
+		if err != nil {
+			return nil, err
+		}
+		dir, _ := filepath.Split(cwdAbs)
+		filename = filepath.Join(dir, filename)
+	}
+
+	return ioutil.ReadFile(filename)
+}
+
+// OutputPath returns the path to the Go file compiled from the template
+// file at srcPath, i.e. "templates/foo.qtpl" -> "templates/foo.qtpl.go".
+//
+// Windows paths with drive letters and backslashes are handled
+// regardless of the current OS. Mixed separators are converted
+// to backslashes for Windows paths and duplicate separators are removed.
+func OutputPath(srcPath string) string {
+	sep := byte('/')
+	if isWindowsPath(srcPath) {
+		sep = '\\'
+	}
+	b := make([]byte, 0, len(srcPath)+len(".go"))
+	for i := 0; i < len(srcPath); i++ {
+		c := srcPath[i]
+		if c != '/' && c != '\\' {
+			b = append(b, c)
+			continue
+		}
+		// Preserve the leading double separator in UNC paths like \\host\share.
+		if len(b) > 0 && b[len(b)-1] == sep && !(sep == '\\' && len(b) == 1) {
+			continue
+		}
+		b = append(b, sep)
+	}
+	return string(b) + ".go"
+}
+
+// isWindowsPath returns true if path starts with a drive letter
+// or contains backslashes.
+func isWindowsPath(path string) bool {
+	if len(path) >= 2 && path[1] == ':' {
+		c := path[0]
+		if (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') {
+			return true
+		}
+	}
+	return strings.IndexByte(path, '\\') >= 0
+}
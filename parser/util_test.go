@@ -0,0 +1,31 @@
+package parser
+
+import (
+	"testing"
+)
+
+func TestOutputPath(t *testing.T) {
+	f := func(srcPath, expectedPath string) {
+		path := OutputPath(srcPath)
+		if path != expectedPath {
+			t.Fatalf("unexpected output path for %q: %q. Expecting %q", srcPath, path, expectedPath)
+		}
+	}
+
+	// unix paths
+	f("foo.qtpl", "foo.qtpl.go")
+	f("templates/foo.qtpl", "templates/foo.qtpl.go")
+	f("/abs/templates/page.html.qtpl", "/abs/templates/page.html.qtpl.go")
+	f("./templates//foo.qtpl", "./templates/foo.qtpl.go")
+
+	// windows paths
+	f(`templates\foo.qtpl`, `templates\foo.qtpl.go`)
+	f(`C:\project\templates\foo.qtpl`, `C:\project\templates\foo.qtpl.go`)
+	f(`c:/project/templates/foo.qtpl`, `c:\project\templates\foo.qtpl.go`)
+	f(`D:foo.qtpl`, `D:foo.qtpl.go`)
+	f(`\\host\share\foo.qtpl`, `\\host\share\foo.qtpl.go`)
+
+	// mixed separators
+	f(`C:\project/templates\\sub//foo.qtpl`, `C:\project\templates\sub\foo.qtpl.go`)
+	f(`templates/sub\foo.qtpl`, `templates\sub\foo.qtpl.go`)
+}
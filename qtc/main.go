@@ -1,14 +1,19 @@
 package main
 
 import (
+	"bytes"
 	"flag"
+	"fmt"
 	"go/format"
 	"io/ioutil"
 	"log"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"sort"
 	"strings"
+
+	"github.com/valyala/quicktemplate/parser"
 )
 
 var (
@@ -20,18 +25,79 @@ var (
 	file = flag.String("file", "", "Path to template file to compile.\n"+
 		"Flags -dir and -ext are ignored if file is set.\n"+
 		"The compiled file will be placed near the original file with .go extension added.")
-	ext = flag.String("ext", "qtpl", "Only files with this extension are compiled")
+	ext    = flag.String("ext", "qtpl", "Only files with this extension are compiled")
+	delims = flag.String("delims", "", "Space-separated tag delimiters, i.e. \"<% %>\".\n"+
+		"Default {% %} delimiters are used if empty")
+	mustache = flag.String("mustache", "", "Output tag to use for {{ expr }} shorthand, i.e. \"v\" or \"s\".\n"+
+		"{{{ expr }}} is the shorthand for the unescaped output tag. The shorthand is disabled if empty")
+	appendFuncs = flag.Bool("append", false, "Whether to generate AppendF(dst []byte, ...) []byte for each template func F.\n"+
+		"AppendF appends the template output to dst")
+	errFuncs = flag.Bool("err", false, "Whether to generate WriteFErr(w io.Writer, ...) error for each template func F.\n"+
+		"WriteFErr returns the first error returned by w")
+	genBenchmarks = flag.Bool("benchmarks", false, "Whether to generate BenchmarkF for each template func F with zero-value args.\n"+
+		"Benchmarks are placed near the original file with _timing_test.go suffix added")
+	genManifest = flag.Bool("manifest", false, "Whether to generate JSON manifest listing template funcs with their params.\n"+
+		"Manifests are placed near the original file with .manifest.json suffix added")
+	preserveComments = flag.Bool("comments", false, "Whether to emit template comments as Go comments in the generated code")
+	trace            = flag.Bool("trace", false, "Whether to log entering and exiting template, func, for and if tags to stderr.\n"+
+		"This helps locating the tag a parse error is triggered by")
+	dryRun = flag.Bool("dryrun", false, "Whether to validate templates without writing the generated code.\n"+
+		"The generated code is type-checked together with .go files in template directories\n"+
+		"if all the templates are parsed successfully. See typecheck flag for details")
+	typeCheck = flag.Bool("typecheck", true, "Whether to type-check the generated code in dry-run mode")
 )
 
 var logger = log.New(os.Stderr, "qtc: ", log.LstdFlags)
 
 var filesCompiled int
 
+// dryRunCode contains the code generated in dry-run mode
+// keyed by the output file path.
+var dryRunCode = make(map[string][]byte)
+
+var parseOpts parser.ParseOptions
+
 func main() {
 	flag.Parse()
 
+	parseOpts.AppendFuncs = *appendFuncs
+	parseOpts.ErrFuncs = *errFuncs
+	parseOpts.GenBenchmarks = *genBenchmarks
+	parseOpts.GenManifest = *genManifest
+	parseOpts.PreserveComments = *preserveComments
+	logLevel := slog.LevelInfo
+	if *trace {
+		logLevel = slog.LevelDebug
+	}
+	parseOpts.Logger = slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: logLevel,
+	}))
+	if len(*delims) > 0 {
+		d := strings.Fields(*delims)
+		if len(d) != 2 {
+			logger.Fatalf("delims must contain opening and closing delimiters separated by space; got %q", *delims)
+		}
+		parseOpts.TagOpen = d[0]
+		parseOpts.TagClose = d[1]
+		if err := parseOpts.Validate(); err != nil {
+			logger.Fatalf("invalid delims %q: %s", *delims, err)
+		}
+	}
+	if len(*mustache) > 0 {
+		parseOpts.MustacheMode = true
+		parseOpts.MustacheTag = *mustache
+		if err := parseOpts.Validate(); err != nil {
+			logger.Fatalf("invalid mustache %q: %s", *mustache, err)
+		}
+	}
+
 	if len(*file) > 0 {
-		compileSingleFile(*file)
+		if err := compileSingleFile(*file); err != nil {
+			logger.Fatalf("%s", err)
+		}
+		if err := validateGenerated([]string{*file}); err != nil {
+			logger.Fatalf("%s", err)
+		}
 		return
 	}
 
@@ -46,11 +112,28 @@ func main() {
 	}
 
 	logger.Printf("Compiling *%s template files in directory %q", *ext, *dir)
-	compileDir(*dir)
+	var filenames []string
+	collectFiles(*dir, &filenames)
+	err := compileFiles(filenames)
 	logger.Printf("Total files compiled: %d", filesCompiled)
+	if err != nil {
+		logger.Fatalf("%s", err)
+	}
+	if err := validateGenerated(filenames); err != nil {
+		logger.Fatalf("%s", err)
+	}
 }
 
-func compileSingleFile(filename string) {
+// validateGenerated type-checks the code generated for filenames
+// in dry-run mode.
+func validateGenerated(filenames []string) error {
+	if !*dryRun || !*typeCheck {
+		return nil
+	}
+	return typeCheckFiles(filenames, dryRunCode)
+}
+
+func compileSingleFile(filename string) error {
 	fi, err := os.Stat(filename)
 	if err != nil {
 		logger.Fatalf("cannot stat file %q: %s", filename, err)
@@ -58,10 +141,12 @@ func compileSingleFile(filename string) {
 	if fi.IsDir() {
 		logger.Fatalf("cannot compile directory %q. Use -dir flag", filename)
 	}
-	compileFile(filename)
+	return compileFile(filename)
 }
 
-func compileDir(path string) {
+// collectFiles appends template files found in the given path
+// and its subdirectories to filenames.
+func collectFiles(path string, filenames *[]string) {
 	fi, err := os.Stat(path)
 	if err != nil {
 		logger.Fatalf("cannot compile files in %q: %s", path, err)
@@ -90,63 +175,103 @@ func compileDir(path string) {
 			names = append(names, name)
 		} else {
 			subPath := filepath.Join(path, name)
-			compileDir(subPath)
+			collectFiles(subPath, filenames)
 		}
 	}
 	sort.Strings(names)
 
 	for _, name := range names {
 		if strings.HasSuffix(name, *ext) {
-			filename := filepath.Join(path, name)
-			compileFile(filename)
+			*filenames = append(*filenames, filepath.Join(path, name))
 		}
 	}
 }
 
-func compileFile(infile string) {
-	outfile := infile + ".go"
-	logger.Printf("Compiling %q to %q...", infile, outfile)
+// compileFiles compiles the given template files.
+//
+// It doesn't stop at the first broken file, so go generate reports
+// all the broken templates in a single run. The returned error contains
+// errors for all the files, which couldn't be compiled.
+func compileFiles(filenames []string) error {
+	var errs []string
+	for _, filename := range filenames {
+		if err := compileFile(filename); err != nil {
+			logger.Printf("%s", err)
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return fmt.Errorf("cannot compile %d out of %d template files:\n%s",
+		len(errs), len(filenames), strings.Join(errs, "\n"))
+}
 
-	inf, err := os.Open(infile)
-	if err != nil {
-		logger.Fatalf("cannot open file %q: %s", infile, err)
+func compileFile(infile string) error {
+	outfile := parser.OutputPath(infile)
+	if *dryRun {
+		logger.Printf("Validating %q...", infile)
+	} else {
+		logger.Printf("Compiling %q to %q...", infile, outfile)
 	}
 
-	tmpfile := outfile + ".tmp"
-	outf, err := os.Create(tmpfile)
+	src, err := ioutil.ReadFile(infile)
 	if err != nil {
-		logger.Fatalf("cannot create file %q: %s", tmpfile, err)
+		return fmt.Errorf("cannot read file %q: %s", infile, err)
 	}
 
-	packageName, err := getPackageName(infile)
+	packageName, err := parser.PackageName(infile)
 	if err != nil {
-		logger.Fatalf("cannot determine package name for %q: %s", infile, err)
+		return fmt.Errorf("cannot determine package name for %q: %s", infile, err)
 	}
-	if err = parse(outf, inf, infile, packageName); err != nil {
-		logger.Fatalf("error when parsing file %q: %s", infile, err)
+	opts := parseOpts
+	var benchmarks bytes.Buffer
+	if opts.GenBenchmarks {
+		opts.Benchmarks = &benchmarks
 	}
-	if err = outf.Close(); err != nil {
-		logger.Fatalf("error when closing file %q: %s", tmpfile, err)
+	var manifest bytes.Buffer
+	if opts.GenManifest {
+		opts.Manifest = &manifest
 	}
-	if err = inf.Close(); err != nil {
-		logger.Fatalf("error when closing file %q: %s", infile, err)
+	var uglyCode bytes.Buffer
+	if err = parser.Parse(&uglyCode, bytes.NewReader(src), infile, packageName, &opts); err != nil {
+		// The error is already prefixed with file:line:col.
+		return err
 	}
 
 	// prettify the output file
-	uglyCode, err := ioutil.ReadFile(tmpfile)
-	if err != nil {
-		logger.Fatalf("cannot read file %q: %s", tmpfile, err)
+	prettyCode, err := format.Source(uglyCode.Bytes())
+	if err != nil && *dryRun {
+		return fmt.Errorf("error when formatting compiled code for %q: %s", infile, err)
 	}
-	prettyCode, err := format.Source(uglyCode)
 	if err != nil {
-		logger.Fatalf("error when formatting compiled code for %q: %s. See %q for details", infile, err, tmpfile)
+		tmpfile := outfile + ".tmp"
+		if werr := ioutil.WriteFile(tmpfile, uglyCode.Bytes(), 0666); werr != nil {
+			return fmt.Errorf("error when formatting compiled code for %q: %s", infile, err)
+		}
+		return fmt.Errorf("error when formatting compiled code for %q: %s. See %q for details", infile, err, tmpfile)
+	}
+	if *dryRun {
+		dryRunCode[outfile] = prettyCode
+		filesCompiled++
+		return nil
 	}
 	if err = ioutil.WriteFile(outfile, prettyCode, 0666); err != nil {
-		logger.Fatalf("error when writing file %q: %s", outfile, err)
+		return fmt.Errorf("error when writing file %q: %s", outfile, err)
 	}
-	if err = os.Remove(tmpfile); err != nil {
-		logger.Fatalf("error when removing file %q: %s", tmpfile, err)
+	if opts.GenBenchmarks {
+		benchfile := infile + "_timing_test.go"
+		if err = ioutil.WriteFile(benchfile, benchmarks.Bytes(), 0666); err != nil {
+			return fmt.Errorf("error when writing file %q: %s", benchfile, err)
+		}
+	}
+	if opts.GenManifest {
+		manifestfile := infile + ".manifest.json"
+		if err = ioutil.WriteFile(manifestfile, manifest.Bytes(), 0666); err != nil {
+			return fmt.Errorf("error when writing file %q: %s", manifestfile, err)
+		}
 	}
 
 	filesCompiled++
+	return nil
 }
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/valyala/quicktemplate/parser"
+)
+
+func TestCompileFilesErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "qtc")
+	if err != nil {
+		t.Fatalf("cannot create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"a.qtpl": "{% func A() %}{% for %}{% endif %}{% endfunc %}",
+		"b.qtpl": "{% func B() %}ok{% endfunc %}",
+		"c.qtpl": "{% func C() %}\n\t{%s %}\n{% endfunc %}",
+	}
+	var filenames []string
+	for name, src := range files {
+		filename := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(filename, []byte(src), 0666); err != nil {
+			t.Fatalf("cannot write %q: %s", filename, err)
+		}
+		filenames = append(filenames, filename)
+	}
+	saveExt := *ext
+	*ext = ".qtpl"
+	defer func() { *ext = saveExt }()
+	var collected []string
+	collectFiles(dir, &collected)
+	if len(collected) != len(filenames) {
+		t.Fatalf("unexpected files collected: %q. Expecting %d files", collected, len(filenames))
+	}
+
+	err = compileFiles(collected)
+	if err == nil {
+		t.Fatalf("expecting non-nil error")
+	}
+	errStr := err.Error()
+	for _, s := range []string{
+		"cannot compile 2 out of 3 template files",
+		filepath.Join(dir, "a.qtpl") + ":1:27: ",
+		"expected endfor to close for loop",
+		filepath.Join(dir, "c.qtpl") + ":2:6: ",
+		"empty expression in s tag",
+	} {
+		if !strings.Contains(errStr, s) {
+			t.Fatalf("cannot find %q in the error:\n%s", s, errStr)
+		}
+	}
+
+	// The valid file is compiled despite the errors in other files.
+	if _, err := os.Stat(filepath.Join(dir, "b.qtpl.go")); err != nil {
+		t.Fatalf("cannot find the compiled valid file: %s", err)
+	}
+	for _, name := range []string{"a.qtpl.go", "c.qtpl.go", "a.qtpl.go.tmp"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			t.Fatalf("unexpected file %q found for the broken template", name)
+		}
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	saveDryRun := *dryRun
+	*dryRun = true
+	defer func() { *dryRun = saveDryRun }()
+
+	filenames := []string{"testdata/dryrun/broken.qtpl", "testdata/dryrun/ok.qtpl"}
+	if err := compileFiles(filenames); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for _, filename := range filenames {
+		outfile := parser.OutputPath(filename)
+		if _, err := os.Stat(outfile); err == nil {
+			os.Remove(outfile)
+			t.Fatalf("unexpected file %q written in dry-run mode", outfile)
+		}
+		if _, ok := dryRunCode[outfile]; !ok {
+			t.Fatalf("missing the code generated for %q", filename)
+		}
+	}
+
+	// The code referring undefined variable doesn't type-check,
+	// while the code referring helper from .go file does.
+	err := typeCheckFiles(filenames, dryRunCode)
+	if err == nil {
+		t.Fatalf("expecting non-nil error")
+	}
+	errStr := err.Error()
+	if !strings.Contains(errStr, "testdata/dryrun/broken.qtpl:3: undefined: undefinedVar") {
+		t.Fatalf("cannot find the type-check error for the undefined variable in:\n%s", errStr)
+	}
+	if strings.Contains(errStr, "ok.qtpl") || strings.Contains(errStr, "greeting") {
+		t.Fatalf("unexpected type-check error for the valid template:\n%s", errStr)
+	}
+
+	// Valid templates type-check
+	if err := typeCheckFiles(filenames[1:], dryRunCode); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
+
+func TestCompileEmptyFiles(t *testing.T) {
+	saveDryRun := *dryRun
+	*dryRun = true
+	defer func() { *dryRun = saveDryRun }()
+
+	filenames := []string{"testdata/empty/comment.qtpl", "testdata/empty/empty.qtpl", "testdata/empty/whitespace.qtpl"}
+	if err := compileFiles(filenames); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for _, filename := range filenames {
+		code := string(dryRunCode[parser.OutputPath(filename)])
+		if !strings.Contains(code, "\npackage empty\n") {
+			t.Fatalf("cannot find package declaration in the code generated for %q:\n%s", filename, code)
+		}
+		if strings.Contains(code, "func ") {
+			t.Fatalf("unexpected func in the code generated for %q:\n%s", filename, code)
+		}
+	}
+
+	// The generated empty package compiles.
+	if err := typeCheckFiles(filenames, dryRunCode); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
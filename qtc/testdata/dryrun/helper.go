@@ -0,0 +1,5 @@
+package dryrun
+
+func greeting(name string) string {
+	return "Hello, " + name
+}
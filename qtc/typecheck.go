@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/importer"
+	goparser "go/parser"
+	gotoken "go/token"
+	"go/types"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/valyala/quicktemplate/parser"
+)
+
+// typeCheckFiles type-checks the code generated for the given template
+// files together with .go files in the template directories.
+//
+// generated must contain the generated code keyed by the output file path.
+// Errors for all the directories are returned.
+func typeCheckFiles(filenames []string, generated map[string][]byte) error {
+	dirs := make(map[string]map[string][]byte)
+	for _, filename := range filenames {
+		outfile := parser.OutputPath(filename)
+		code, ok := generated[outfile]
+		if !ok {
+			return fmt.Errorf("BUG: missing the generated code for %q", filename)
+		}
+		dir := filepath.Dir(filename)
+		if dirs[dir] == nil {
+			dirs[dir] = make(map[string][]byte)
+		}
+		dirs[dir][outfile] = code
+	}
+	var dirNames []string
+	for dir := range dirs {
+		dirNames = append(dirNames, dir)
+	}
+	sort.Strings(dirNames)
+
+	var errs []string
+	for _, dir := range dirNames {
+		if err := typeCheckDir(dir, dirs[dir]); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return fmt.Errorf("type-check failed for the generated code:\n%s", strings.Join(errs, "\n"))
+}
+
+// typeCheckDir type-checks the generated code for templates in dir
+// together with .go files in dir.
+//
+// The previously generated files for the templates are replaced
+// with the generated code. Test files are skipped.
+func typeCheckDir(dir string, generated map[string][]byte) error {
+	fset := gotoken.NewFileSet()
+	var files []*ast.File
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("cannot read files in %q: %s", dir, err)
+	}
+	for _, fi := range fis {
+		name := fi.Name()
+		path := filepath.Join(dir, name)
+		if fi.IsDir() || !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		if _, ok := generated[path]; ok {
+			continue
+		}
+		if ok, err := build.Default.MatchFile(dir, name); err != nil || !ok {
+			continue
+		}
+		f, err := goparser.ParseFile(fset, path, nil, 0)
+		if err != nil {
+			return fmt.Errorf("cannot parse %q: %s", path, err)
+		}
+		files = append(files, f)
+	}
+	var outfiles []string
+	for outfile := range generated {
+		outfiles = append(outfiles, outfile)
+	}
+	sort.Strings(outfiles)
+	for _, outfile := range outfiles {
+		// The generated code refers template files via //line comments
+		// relative to the current directory, while relative paths in //line
+		// comments are resolved against the directory of the parsed file.
+		// So parse the generated code under the file name without directory.
+		code := unindentLineComments(generated[outfile])
+		f, err := goparser.ParseFile(fset, filepath.Base(outfile), code, 0)
+		if err != nil {
+			return fmt.Errorf("cannot parse the code generated for %q: %s", outfile, err)
+		}
+		files = append(files, f)
+	}
+
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return fmt.Errorf("cannot determine absolute path for %q: %s", dir, err)
+	}
+	var errs []string
+	conf := types.Config{
+		Importer: &dirImporter{
+			imp: importer.ForCompiler(fset, "source", nil).(types.ImporterFrom),
+			dir: absDir,
+		},
+		Error: func(err error) {
+			errs = append(errs, err.Error())
+		},
+	}
+	// Errors are collected by conf.Error.
+	_, _ = conf.Check(dir, fset, files, nil)
+	if len(errs) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%s", strings.Join(errs, "\n"))
+}
+
+// unindentLineComments moves //line comments to the beginning of lines,
+// since gofmt indents them inside funcs, while Go recognizes only
+// //line comments starting at the beginning of line.
+//
+// This makes type-check errors point to template lines.
+func unindentLineComments(code []byte) []byte {
+	return lineCommentRe.ReplaceAll(code, []byte("\n//line "))
+}
+
+var lineCommentRe = regexp.MustCompile(`\n[ \t]+//line `)
+
+// dirImporter imports packages relative to dir, since the files with
+// the generated code have no directory in their names.
+type dirImporter struct {
+	imp types.ImporterFrom
+	dir string
+}
+
+func (di *dirImporter) Import(path string) (*types.Package, error) {
+	return di.ImportFrom(path, di.dir, 0)
+}
+
+func (di *dirImporter) ImportFrom(path, _ string, mode types.ImportMode) (*types.Package, error) {
+	return di.imp.ImportFrom(path, di.dir, mode)
+}
@@ -1,94 +1,1619 @@
-// This file is automatically generated by qtc from "bench.qtpl".
+// Code generated by qtc from "bench.qtpl". DO NOT EDIT.
 // See https://github.com/valyala/quicktemplate for details.
 
 //line testdata/templates/bench.qtpl:1
 package templates
 
 //line testdata/templates/bench.qtpl:1
+import (
+	"fmt"
+	"strconv"
+)
+
+//line testdata/templates/bench.qtpl:6
 import (
 	qtio422016 "io"
 
 	qt422016 "github.com/valyala/quicktemplate"
 )
 
-//line testdata/templates/bench.qtpl:1
-var (
-	_ = qtio422016.Copy
-	_ = qt422016.AcquireByteBuffer
-)
-
-//line testdata/templates/bench.qtpl:3
+//line testdata/templates/bench.qtpl:8
 type BenchRow struct {
 	ID      int
 	Message string
 	Print   bool
 }
 
-//line testdata/templates/bench.qtpl:11
+type BenchID int
+
+func (id BenchID) String() string {
+	return "id-" + strconv.Itoa(int(id))
+}
+
+//line testdata/templates/bench.qtpl:22
 func StreamBenchPage(qw422016 *qt422016.Writer, rows []BenchRow) {
-	//line testdata/templates/bench.qtpl:11
+	//line testdata/templates/bench.qtpl:22
 	qw422016.N().S(`<html>
 	<head><title>test</title></head>
 	<body>
 		<ul>
 		`)
-	//line testdata/templates/bench.qtpl:15
+	//line testdata/templates/bench.qtpl:26
 	for _, row := range rows {
-		//line testdata/templates/bench.qtpl:15
+		//line testdata/templates/bench.qtpl:26
 		qw422016.N().S(`
 			`)
-		//line testdata/templates/bench.qtpl:16
+		//line testdata/templates/bench.qtpl:27
 		if row.Print {
-			//line testdata/templates/bench.qtpl:16
+			//line testdata/templates/bench.qtpl:27
 			qw422016.N().S(`
 				<li>ID=`)
-			//line testdata/templates/bench.qtpl:17
+			//line testdata/templates/bench.qtpl:28
 			qw422016.N().D(row.ID)
-			//line testdata/templates/bench.qtpl:17
+			//line testdata/templates/bench.qtpl:28
 			qw422016.N().S(`, Message=`)
-			//line testdata/templates/bench.qtpl:17
+			//line testdata/templates/bench.qtpl:28
 			qw422016.E().S(row.Message)
-			//line testdata/templates/bench.qtpl:17
+			//line testdata/templates/bench.qtpl:28
 			qw422016.N().S(`</li>
 			`)
-			//line testdata/templates/bench.qtpl:18
+			//line testdata/templates/bench.qtpl:29
 		}
-		//line testdata/templates/bench.qtpl:18
+		//line testdata/templates/bench.qtpl:29
 		qw422016.N().S(`
 		`)
-		//line testdata/templates/bench.qtpl:19
+		//line testdata/templates/bench.qtpl:30
 	}
-	//line testdata/templates/bench.qtpl:19
+	//line testdata/templates/bench.qtpl:30
 	qw422016.N().S(`
 		</ul>
 	</body>
 </html>
 `)
-//line testdata/templates/bench.qtpl:23
+//line testdata/templates/bench.qtpl:34
 }
 
-//line testdata/templates/bench.qtpl:23
+//line testdata/templates/bench.qtpl:34
 func WriteBenchPage(qq422016 qtio422016.Writer, rows []BenchRow) {
-	//line testdata/templates/bench.qtpl:23
+	//line testdata/templates/bench.qtpl:34
 	qw422016 := qt422016.AcquireWriter(qq422016)
-	//line testdata/templates/bench.qtpl:23
+	//line testdata/templates/bench.qtpl:34
 	StreamBenchPage(qw422016, rows)
-	//line testdata/templates/bench.qtpl:23
+	//line testdata/templates/bench.qtpl:34
 	qt422016.ReleaseWriter(qw422016)
-//line testdata/templates/bench.qtpl:23
+//line testdata/templates/bench.qtpl:34
 }
 
-//line testdata/templates/bench.qtpl:23
+//line testdata/templates/bench.qtpl:34
 func BenchPage(rows []BenchRow) string {
-	//line testdata/templates/bench.qtpl:23
+	//line testdata/templates/bench.qtpl:34
+	qb422016 := qt422016.AcquireByteBuffer()
+	//line testdata/templates/bench.qtpl:34
+	WriteBenchPage(qb422016, rows)
+	//line testdata/templates/bench.qtpl:34
+	qs422016 := string(qb422016.B)
+	//line testdata/templates/bench.qtpl:34
+	qt422016.ReleaseByteBuffer(qb422016)
+	//line testdata/templates/bench.qtpl:34
+	return qs422016
+//line testdata/templates/bench.qtpl:34
+}
+
+//line testdata/templates/bench.qtpl:34
+func AppendBenchPage(dst422016 []byte, rows []BenchRow) []byte {
+	//line testdata/templates/bench.qtpl:34
 	qb422016 := qt422016.AcquireByteBuffer()
-	//line testdata/templates/bench.qtpl:23
+	//line testdata/templates/bench.qtpl:34
+	qz422016 := qb422016.B
+	//line testdata/templates/bench.qtpl:34
+	qb422016.B = dst422016
+	//line testdata/templates/bench.qtpl:34
 	WriteBenchPage(qb422016, rows)
-	//line testdata/templates/bench.qtpl:23
+	//line testdata/templates/bench.qtpl:34
+	dst422016 = qb422016.B
+	//line testdata/templates/bench.qtpl:34
+	qb422016.B = qz422016
+	//line testdata/templates/bench.qtpl:34
+	qt422016.ReleaseByteBuffer(qb422016)
+	//line testdata/templates/bench.qtpl:34
+	return dst422016
+//line testdata/templates/bench.qtpl:34
+}
+
+//line testdata/templates/bench.qtpl:34
+func WriteBenchPageErr(qq422016 qtio422016.Writer, rows []BenchRow) error {
+	//line testdata/templates/bench.qtpl:34
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	//line testdata/templates/bench.qtpl:34
+	StreamBenchPage(qw422016, rows)
+	//line testdata/templates/bench.qtpl:34
+	qe422016 := qw422016.Err()
+	//line testdata/templates/bench.qtpl:34
+	qt422016.ReleaseWriter(qw422016)
+	//line testdata/templates/bench.qtpl:34
+	return qe422016
+//line testdata/templates/bench.qtpl:34
+}
+
+//line testdata/templates/bench.qtpl:36
+func StreamBenchValue(qw422016 *qt422016.Writer, n int) {
+	//line testdata/templates/bench.qtpl:36
+	qw422016.E().V(n)
+//line testdata/templates/bench.qtpl:36
+}
+
+//line testdata/templates/bench.qtpl:36
+func WriteBenchValue(qq422016 qtio422016.Writer, n int) {
+	//line testdata/templates/bench.qtpl:36
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	//line testdata/templates/bench.qtpl:36
+	StreamBenchValue(qw422016, n)
+	//line testdata/templates/bench.qtpl:36
+	qt422016.ReleaseWriter(qw422016)
+//line testdata/templates/bench.qtpl:36
+}
+
+//line testdata/templates/bench.qtpl:36
+func BenchValue(n int) string {
+	//line testdata/templates/bench.qtpl:36
+	qb422016 := qt422016.AcquireByteBuffer()
+	//line testdata/templates/bench.qtpl:36
+	WriteBenchValue(qb422016, n)
+	//line testdata/templates/bench.qtpl:36
+	qs422016 := string(qb422016.B)
+	//line testdata/templates/bench.qtpl:36
+	qt422016.ReleaseByteBuffer(qb422016)
+	//line testdata/templates/bench.qtpl:36
+	return qs422016
+//line testdata/templates/bench.qtpl:36
+}
+
+//line testdata/templates/bench.qtpl:36
+func AppendBenchValue(dst422016 []byte, n int) []byte {
+	//line testdata/templates/bench.qtpl:36
+	qb422016 := qt422016.AcquireByteBuffer()
+	//line testdata/templates/bench.qtpl:36
+	qz422016 := qb422016.B
+	//line testdata/templates/bench.qtpl:36
+	qb422016.B = dst422016
+	//line testdata/templates/bench.qtpl:36
+	WriteBenchValue(qb422016, n)
+	//line testdata/templates/bench.qtpl:36
+	dst422016 = qb422016.B
+	//line testdata/templates/bench.qtpl:36
+	qb422016.B = qz422016
+	//line testdata/templates/bench.qtpl:36
+	qt422016.ReleaseByteBuffer(qb422016)
+	//line testdata/templates/bench.qtpl:36
+	return dst422016
+//line testdata/templates/bench.qtpl:36
+}
+
+//line testdata/templates/bench.qtpl:36
+func WriteBenchValueErr(qq422016 qtio422016.Writer, n int) error {
+	//line testdata/templates/bench.qtpl:36
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	//line testdata/templates/bench.qtpl:36
+	StreamBenchValue(qw422016, n)
+	//line testdata/templates/bench.qtpl:36
+	qe422016 := qw422016.Err()
+	//line testdata/templates/bench.qtpl:36
+	qt422016.ReleaseWriter(qw422016)
+	//line testdata/templates/bench.qtpl:36
+	return qe422016
+//line testdata/templates/bench.qtpl:36
+}
+
+//line testdata/templates/bench.qtpl:38
+func StreamBenchValueInt(qw422016 *qt422016.Writer, n int) {
+	//line testdata/templates/bench.qtpl:38
+	qw422016.N().D(n)
+//line testdata/templates/bench.qtpl:38
+}
+
+//line testdata/templates/bench.qtpl:38
+func WriteBenchValueInt(qq422016 qtio422016.Writer, n int) {
+	//line testdata/templates/bench.qtpl:38
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	//line testdata/templates/bench.qtpl:38
+	StreamBenchValueInt(qw422016, n)
+	//line testdata/templates/bench.qtpl:38
+	qt422016.ReleaseWriter(qw422016)
+//line testdata/templates/bench.qtpl:38
+}
+
+//line testdata/templates/bench.qtpl:38
+func BenchValueInt(n int) string {
+	//line testdata/templates/bench.qtpl:38
+	qb422016 := qt422016.AcquireByteBuffer()
+	//line testdata/templates/bench.qtpl:38
+	WriteBenchValueInt(qb422016, n)
+	//line testdata/templates/bench.qtpl:38
+	qs422016 := string(qb422016.B)
+	//line testdata/templates/bench.qtpl:38
+	qt422016.ReleaseByteBuffer(qb422016)
+	//line testdata/templates/bench.qtpl:38
+	return qs422016
+//line testdata/templates/bench.qtpl:38
+}
+
+//line testdata/templates/bench.qtpl:38
+func AppendBenchValueInt(dst422016 []byte, n int) []byte {
+	//line testdata/templates/bench.qtpl:38
+	qb422016 := qt422016.AcquireByteBuffer()
+	//line testdata/templates/bench.qtpl:38
+	qz422016 := qb422016.B
+	//line testdata/templates/bench.qtpl:38
+	qb422016.B = dst422016
+	//line testdata/templates/bench.qtpl:38
+	WriteBenchValueInt(qb422016, n)
+	//line testdata/templates/bench.qtpl:38
+	dst422016 = qb422016.B
+	//line testdata/templates/bench.qtpl:38
+	qb422016.B = qz422016
+	//line testdata/templates/bench.qtpl:38
+	qt422016.ReleaseByteBuffer(qb422016)
+	//line testdata/templates/bench.qtpl:38
+	return dst422016
+//line testdata/templates/bench.qtpl:38
+}
+
+//line testdata/templates/bench.qtpl:38
+func WriteBenchValueIntErr(qq422016 qtio422016.Writer, n int) error {
+	//line testdata/templates/bench.qtpl:38
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	//line testdata/templates/bench.qtpl:38
+	StreamBenchValueInt(qw422016, n)
+	//line testdata/templates/bench.qtpl:38
+	qe422016 := qw422016.Err()
+	//line testdata/templates/bench.qtpl:38
+	qt422016.ReleaseWriter(qw422016)
+	//line testdata/templates/bench.qtpl:38
+	return qe422016
+//line testdata/templates/bench.qtpl:38
+}
+
+//line testdata/templates/bench.qtpl:40
+func StreamBenchValueStringer(qw422016 *qt422016.Writer, n int) {
+	//line testdata/templates/bench.qtpl:40
+	qw422016.E().V(BenchID(n))
+//line testdata/templates/bench.qtpl:40
+}
+
+//line testdata/templates/bench.qtpl:40
+func WriteBenchValueStringer(qq422016 qtio422016.Writer, n int) {
+	//line testdata/templates/bench.qtpl:40
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	//line testdata/templates/bench.qtpl:40
+	StreamBenchValueStringer(qw422016, n)
+	//line testdata/templates/bench.qtpl:40
+	qt422016.ReleaseWriter(qw422016)
+//line testdata/templates/bench.qtpl:40
+}
+
+//line testdata/templates/bench.qtpl:40
+func BenchValueStringer(n int) string {
+	//line testdata/templates/bench.qtpl:40
+	qb422016 := qt422016.AcquireByteBuffer()
+	//line testdata/templates/bench.qtpl:40
+	WriteBenchValueStringer(qb422016, n)
+	//line testdata/templates/bench.qtpl:40
+	qs422016 := string(qb422016.B)
+	//line testdata/templates/bench.qtpl:40
+	qt422016.ReleaseByteBuffer(qb422016)
+	//line testdata/templates/bench.qtpl:40
+	return qs422016
+//line testdata/templates/bench.qtpl:40
+}
+
+//line testdata/templates/bench.qtpl:40
+func AppendBenchValueStringer(dst422016 []byte, n int) []byte {
+	//line testdata/templates/bench.qtpl:40
+	qb422016 := qt422016.AcquireByteBuffer()
+	//line testdata/templates/bench.qtpl:40
+	qz422016 := qb422016.B
+	//line testdata/templates/bench.qtpl:40
+	qb422016.B = dst422016
+	//line testdata/templates/bench.qtpl:40
+	WriteBenchValueStringer(qb422016, n)
+	//line testdata/templates/bench.qtpl:40
+	dst422016 = qb422016.B
+	//line testdata/templates/bench.qtpl:40
+	qb422016.B = qz422016
+	//line testdata/templates/bench.qtpl:40
+	qt422016.ReleaseByteBuffer(qb422016)
+	//line testdata/templates/bench.qtpl:40
+	return dst422016
+//line testdata/templates/bench.qtpl:40
+}
+
+//line testdata/templates/bench.qtpl:40
+func WriteBenchValueStringerErr(qq422016 qtio422016.Writer, n int) error {
+	//line testdata/templates/bench.qtpl:40
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	//line testdata/templates/bench.qtpl:40
+	StreamBenchValueStringer(qw422016, n)
+	//line testdata/templates/bench.qtpl:40
+	qe422016 := qw422016.Err()
+	//line testdata/templates/bench.qtpl:40
+	qt422016.ReleaseWriter(qw422016)
+	//line testdata/templates/bench.qtpl:40
+	return qe422016
+//line testdata/templates/bench.qtpl:40
+}
+
+//line testdata/templates/bench.qtpl:42
+func StreamBenchValueStringerTag(qw422016 *qt422016.Writer, n int) {
+	//line testdata/templates/bench.qtpl:42
+	qw422016.E().S(BenchID(n).String())
+//line testdata/templates/bench.qtpl:42
+}
+
+//line testdata/templates/bench.qtpl:42
+func WriteBenchValueStringerTag(qq422016 qtio422016.Writer, n int) {
+	//line testdata/templates/bench.qtpl:42
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	//line testdata/templates/bench.qtpl:42
+	StreamBenchValueStringerTag(qw422016, n)
+	//line testdata/templates/bench.qtpl:42
+	qt422016.ReleaseWriter(qw422016)
+//line testdata/templates/bench.qtpl:42
+}
+
+//line testdata/templates/bench.qtpl:42
+func BenchValueStringerTag(n int) string {
+	//line testdata/templates/bench.qtpl:42
+	qb422016 := qt422016.AcquireByteBuffer()
+	//line testdata/templates/bench.qtpl:42
+	WriteBenchValueStringerTag(qb422016, n)
+	//line testdata/templates/bench.qtpl:42
+	qs422016 := string(qb422016.B)
+	//line testdata/templates/bench.qtpl:42
+	qt422016.ReleaseByteBuffer(qb422016)
+	//line testdata/templates/bench.qtpl:42
+	return qs422016
+//line testdata/templates/bench.qtpl:42
+}
+
+//line testdata/templates/bench.qtpl:42
+func AppendBenchValueStringerTag(dst422016 []byte, n int) []byte {
+	//line testdata/templates/bench.qtpl:42
+	qb422016 := qt422016.AcquireByteBuffer()
+	//line testdata/templates/bench.qtpl:42
+	qz422016 := qb422016.B
+	//line testdata/templates/bench.qtpl:42
+	qb422016.B = dst422016
+	//line testdata/templates/bench.qtpl:42
+	WriteBenchValueStringerTag(qb422016, n)
+	//line testdata/templates/bench.qtpl:42
+	dst422016 = qb422016.B
+	//line testdata/templates/bench.qtpl:42
+	qb422016.B = qz422016
+	//line testdata/templates/bench.qtpl:42
+	qt422016.ReleaseByteBuffer(qb422016)
+	//line testdata/templates/bench.qtpl:42
+	return dst422016
+//line testdata/templates/bench.qtpl:42
+}
+
+//line testdata/templates/bench.qtpl:42
+func WriteBenchValueStringerTagErr(qq422016 qtio422016.Writer, n int) error {
+	//line testdata/templates/bench.qtpl:42
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	//line testdata/templates/bench.qtpl:42
+	StreamBenchValueStringerTag(qw422016, n)
+	//line testdata/templates/bench.qtpl:42
+	qe422016 := qw422016.Err()
+	//line testdata/templates/bench.qtpl:42
+	qt422016.ReleaseWriter(qw422016)
+	//line testdata/templates/bench.qtpl:42
+	return qe422016
+//line testdata/templates/bench.qtpl:42
+}
+
+//line testdata/templates/bench.qtpl:44
+func StreamBenchPrintf(qw422016 *qt422016.Writer, n int) {
+	//line testdata/templates/bench.qtpl:44
+	qw422016.E().Printf("%d items", n)
+//line testdata/templates/bench.qtpl:44
+}
+
+//line testdata/templates/bench.qtpl:44
+func WriteBenchPrintf(qq422016 qtio422016.Writer, n int) {
+	//line testdata/templates/bench.qtpl:44
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	//line testdata/templates/bench.qtpl:44
+	StreamBenchPrintf(qw422016, n)
+	//line testdata/templates/bench.qtpl:44
+	qt422016.ReleaseWriter(qw422016)
+//line testdata/templates/bench.qtpl:44
+}
+
+//line testdata/templates/bench.qtpl:44
+func BenchPrintf(n int) string {
+	//line testdata/templates/bench.qtpl:44
+	qb422016 := qt422016.AcquireByteBuffer()
+	//line testdata/templates/bench.qtpl:44
+	WriteBenchPrintf(qb422016, n)
+	//line testdata/templates/bench.qtpl:44
+	qs422016 := string(qb422016.B)
+	//line testdata/templates/bench.qtpl:44
+	qt422016.ReleaseByteBuffer(qb422016)
+	//line testdata/templates/bench.qtpl:44
+	return qs422016
+//line testdata/templates/bench.qtpl:44
+}
+
+//line testdata/templates/bench.qtpl:44
+func AppendBenchPrintf(dst422016 []byte, n int) []byte {
+	//line testdata/templates/bench.qtpl:44
+	qb422016 := qt422016.AcquireByteBuffer()
+	//line testdata/templates/bench.qtpl:44
+	qz422016 := qb422016.B
+	//line testdata/templates/bench.qtpl:44
+	qb422016.B = dst422016
+	//line testdata/templates/bench.qtpl:44
+	WriteBenchPrintf(qb422016, n)
+	//line testdata/templates/bench.qtpl:44
+	dst422016 = qb422016.B
+	//line testdata/templates/bench.qtpl:44
+	qb422016.B = qz422016
+	//line testdata/templates/bench.qtpl:44
+	qt422016.ReleaseByteBuffer(qb422016)
+	//line testdata/templates/bench.qtpl:44
+	return dst422016
+//line testdata/templates/bench.qtpl:44
+}
+
+//line testdata/templates/bench.qtpl:44
+func WriteBenchPrintfErr(qq422016 qtio422016.Writer, n int) error {
+	//line testdata/templates/bench.qtpl:44
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	//line testdata/templates/bench.qtpl:44
+	StreamBenchPrintf(qw422016, n)
+	//line testdata/templates/bench.qtpl:44
+	qe422016 := qw422016.Err()
+	//line testdata/templates/bench.qtpl:44
+	qt422016.ReleaseWriter(qw422016)
+	//line testdata/templates/bench.qtpl:44
+	return qe422016
+//line testdata/templates/bench.qtpl:44
+}
+
+//line testdata/templates/bench.qtpl:46
+func StreamBenchSprintf(qw422016 *qt422016.Writer, n int) {
+	//line testdata/templates/bench.qtpl:46
+	qw422016.N().S(fmt.Sprintf("%d items", n))
+//line testdata/templates/bench.qtpl:46
+}
+
+//line testdata/templates/bench.qtpl:46
+func WriteBenchSprintf(qq422016 qtio422016.Writer, n int) {
+	//line testdata/templates/bench.qtpl:46
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	//line testdata/templates/bench.qtpl:46
+	StreamBenchSprintf(qw422016, n)
+	//line testdata/templates/bench.qtpl:46
+	qt422016.ReleaseWriter(qw422016)
+//line testdata/templates/bench.qtpl:46
+}
+
+//line testdata/templates/bench.qtpl:46
+func BenchSprintf(n int) string {
+	//line testdata/templates/bench.qtpl:46
+	qb422016 := qt422016.AcquireByteBuffer()
+	//line testdata/templates/bench.qtpl:46
+	WriteBenchSprintf(qb422016, n)
+	//line testdata/templates/bench.qtpl:46
+	qs422016 := string(qb422016.B)
+	//line testdata/templates/bench.qtpl:46
+	qt422016.ReleaseByteBuffer(qb422016)
+	//line testdata/templates/bench.qtpl:46
+	return qs422016
+//line testdata/templates/bench.qtpl:46
+}
+
+//line testdata/templates/bench.qtpl:46
+func AppendBenchSprintf(dst422016 []byte, n int) []byte {
+	//line testdata/templates/bench.qtpl:46
+	qb422016 := qt422016.AcquireByteBuffer()
+	//line testdata/templates/bench.qtpl:46
+	qz422016 := qb422016.B
+	//line testdata/templates/bench.qtpl:46
+	qb422016.B = dst422016
+	//line testdata/templates/bench.qtpl:46
+	WriteBenchSprintf(qb422016, n)
+	//line testdata/templates/bench.qtpl:46
+	dst422016 = qb422016.B
+	//line testdata/templates/bench.qtpl:46
+	qb422016.B = qz422016
+	//line testdata/templates/bench.qtpl:46
+	qt422016.ReleaseByteBuffer(qb422016)
+	//line testdata/templates/bench.qtpl:46
+	return dst422016
+//line testdata/templates/bench.qtpl:46
+}
+
+//line testdata/templates/bench.qtpl:46
+func WriteBenchSprintfErr(qq422016 qtio422016.Writer, n int) error {
+	//line testdata/templates/bench.qtpl:46
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	//line testdata/templates/bench.qtpl:46
+	StreamBenchSprintf(qw422016, n)
+	//line testdata/templates/bench.qtpl:46
+	qe422016 := qw422016.Err()
+	//line testdata/templates/bench.qtpl:46
+	qt422016.ReleaseWriter(qw422016)
+	//line testdata/templates/bench.qtpl:46
+	return qe422016
+//line testdata/templates/bench.qtpl:46
+}
+
+//line testdata/templates/bench.qtpl:48
+func StreamBenchNested(qw422016 *qt422016.Writer, n int) {
+	//line testdata/templates/bench.qtpl:48
+	qw422016.N().S(`<div>`)
+	//line testdata/templates/bench.qtpl:48
+	streambenchNested4(qw422016, n)
+	//line testdata/templates/bench.qtpl:48
+	qw422016.N().S(`</div>`)
+//line testdata/templates/bench.qtpl:48
+}
+
+//line testdata/templates/bench.qtpl:48
+func WriteBenchNested(qq422016 qtio422016.Writer, n int) {
+	//line testdata/templates/bench.qtpl:48
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	//line testdata/templates/bench.qtpl:48
+	StreamBenchNested(qw422016, n)
+	//line testdata/templates/bench.qtpl:48
+	qt422016.ReleaseWriter(qw422016)
+//line testdata/templates/bench.qtpl:48
+}
+
+//line testdata/templates/bench.qtpl:48
+func BenchNested(n int) string {
+	//line testdata/templates/bench.qtpl:48
+	qb422016 := qt422016.AcquireByteBuffer()
+	//line testdata/templates/bench.qtpl:48
+	WriteBenchNested(qb422016, n)
+	//line testdata/templates/bench.qtpl:48
+	qs422016 := string(qb422016.B)
+	//line testdata/templates/bench.qtpl:48
+	qt422016.ReleaseByteBuffer(qb422016)
+	//line testdata/templates/bench.qtpl:48
+	return qs422016
+//line testdata/templates/bench.qtpl:48
+}
+
+//line testdata/templates/bench.qtpl:48
+func AppendBenchNested(dst422016 []byte, n int) []byte {
+	//line testdata/templates/bench.qtpl:48
+	qb422016 := qt422016.AcquireByteBuffer()
+	//line testdata/templates/bench.qtpl:48
+	qz422016 := qb422016.B
+	//line testdata/templates/bench.qtpl:48
+	qb422016.B = dst422016
+	//line testdata/templates/bench.qtpl:48
+	WriteBenchNested(qb422016, n)
+	//line testdata/templates/bench.qtpl:48
+	dst422016 = qb422016.B
+	//line testdata/templates/bench.qtpl:48
+	qb422016.B = qz422016
+	//line testdata/templates/bench.qtpl:48
+	qt422016.ReleaseByteBuffer(qb422016)
+	//line testdata/templates/bench.qtpl:48
+	return dst422016
+//line testdata/templates/bench.qtpl:48
+}
+
+//line testdata/templates/bench.qtpl:48
+func WriteBenchNestedErr(qq422016 qtio422016.Writer, n int) error {
+	//line testdata/templates/bench.qtpl:48
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	//line testdata/templates/bench.qtpl:48
+	StreamBenchNested(qw422016, n)
+	//line testdata/templates/bench.qtpl:48
+	qe422016 := qw422016.Err()
+	//line testdata/templates/bench.qtpl:48
+	qt422016.ReleaseWriter(qw422016)
+	//line testdata/templates/bench.qtpl:48
+	return qe422016
+//line testdata/templates/bench.qtpl:48
+}
+
+//line testdata/templates/bench.qtpl:49
+func streambenchNested4(qw422016 *qt422016.Writer, n int) {
+	//line testdata/templates/bench.qtpl:49
+	qw422016.N().S(`<div>`)
+	//line testdata/templates/bench.qtpl:49
+	streambenchNested3(qw422016, n)
+	//line testdata/templates/bench.qtpl:49
+	qw422016.N().S(`</div>`)
+//line testdata/templates/bench.qtpl:49
+}
+
+//line testdata/templates/bench.qtpl:49
+func writebenchNested4(qq422016 qtio422016.Writer, n int) {
+	//line testdata/templates/bench.qtpl:49
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	//line testdata/templates/bench.qtpl:49
+	streambenchNested4(qw422016, n)
+	//line testdata/templates/bench.qtpl:49
+	qt422016.ReleaseWriter(qw422016)
+//line testdata/templates/bench.qtpl:49
+}
+
+//line testdata/templates/bench.qtpl:49
+func benchNested4(n int) string {
+	//line testdata/templates/bench.qtpl:49
+	qb422016 := qt422016.AcquireByteBuffer()
+	//line testdata/templates/bench.qtpl:49
+	writebenchNested4(qb422016, n)
+	//line testdata/templates/bench.qtpl:49
 	qs422016 := string(qb422016.B)
-	//line testdata/templates/bench.qtpl:23
+	//line testdata/templates/bench.qtpl:49
 	qt422016.ReleaseByteBuffer(qb422016)
-	//line testdata/templates/bench.qtpl:23
+	//line testdata/templates/bench.qtpl:49
 	return qs422016
-//line testdata/templates/bench.qtpl:23
+//line testdata/templates/bench.qtpl:49
+}
+
+//line testdata/templates/bench.qtpl:49
+func appendbenchNested4(dst422016 []byte, n int) []byte {
+	//line testdata/templates/bench.qtpl:49
+	qb422016 := qt422016.AcquireByteBuffer()
+	//line testdata/templates/bench.qtpl:49
+	qz422016 := qb422016.B
+	//line testdata/templates/bench.qtpl:49
+	qb422016.B = dst422016
+	//line testdata/templates/bench.qtpl:49
+	writebenchNested4(qb422016, n)
+	//line testdata/templates/bench.qtpl:49
+	dst422016 = qb422016.B
+	//line testdata/templates/bench.qtpl:49
+	qb422016.B = qz422016
+	//line testdata/templates/bench.qtpl:49
+	qt422016.ReleaseByteBuffer(qb422016)
+	//line testdata/templates/bench.qtpl:49
+	return dst422016
+//line testdata/templates/bench.qtpl:49
+}
+
+//line testdata/templates/bench.qtpl:49
+func writebenchNested4Err(qq422016 qtio422016.Writer, n int) error {
+	//line testdata/templates/bench.qtpl:49
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	//line testdata/templates/bench.qtpl:49
+	streambenchNested4(qw422016, n)
+	//line testdata/templates/bench.qtpl:49
+	qe422016 := qw422016.Err()
+	//line testdata/templates/bench.qtpl:49
+	qt422016.ReleaseWriter(qw422016)
+	//line testdata/templates/bench.qtpl:49
+	return qe422016
+//line testdata/templates/bench.qtpl:49
+}
+
+//line testdata/templates/bench.qtpl:50
+func streambenchNested3(qw422016 *qt422016.Writer, n int) {
+	//line testdata/templates/bench.qtpl:50
+	qw422016.N().S(`<div>`)
+	//line testdata/templates/bench.qtpl:50
+	streambenchNested2(qw422016, n)
+	//line testdata/templates/bench.qtpl:50
+	qw422016.N().S(`</div>`)
+//line testdata/templates/bench.qtpl:50
+}
+
+//line testdata/templates/bench.qtpl:50
+func writebenchNested3(qq422016 qtio422016.Writer, n int) {
+	//line testdata/templates/bench.qtpl:50
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	//line testdata/templates/bench.qtpl:50
+	streambenchNested3(qw422016, n)
+	//line testdata/templates/bench.qtpl:50
+	qt422016.ReleaseWriter(qw422016)
+//line testdata/templates/bench.qtpl:50
+}
+
+//line testdata/templates/bench.qtpl:50
+func benchNested3(n int) string {
+	//line testdata/templates/bench.qtpl:50
+	qb422016 := qt422016.AcquireByteBuffer()
+	//line testdata/templates/bench.qtpl:50
+	writebenchNested3(qb422016, n)
+	//line testdata/templates/bench.qtpl:50
+	qs422016 := string(qb422016.B)
+	//line testdata/templates/bench.qtpl:50
+	qt422016.ReleaseByteBuffer(qb422016)
+	//line testdata/templates/bench.qtpl:50
+	return qs422016
+//line testdata/templates/bench.qtpl:50
+}
+
+//line testdata/templates/bench.qtpl:50
+func appendbenchNested3(dst422016 []byte, n int) []byte {
+	//line testdata/templates/bench.qtpl:50
+	qb422016 := qt422016.AcquireByteBuffer()
+	//line testdata/templates/bench.qtpl:50
+	qz422016 := qb422016.B
+	//line testdata/templates/bench.qtpl:50
+	qb422016.B = dst422016
+	//line testdata/templates/bench.qtpl:50
+	writebenchNested3(qb422016, n)
+	//line testdata/templates/bench.qtpl:50
+	dst422016 = qb422016.B
+	//line testdata/templates/bench.qtpl:50
+	qb422016.B = qz422016
+	//line testdata/templates/bench.qtpl:50
+	qt422016.ReleaseByteBuffer(qb422016)
+	//line testdata/templates/bench.qtpl:50
+	return dst422016
+//line testdata/templates/bench.qtpl:50
+}
+
+//line testdata/templates/bench.qtpl:50
+func writebenchNested3Err(qq422016 qtio422016.Writer, n int) error {
+	//line testdata/templates/bench.qtpl:50
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	//line testdata/templates/bench.qtpl:50
+	streambenchNested3(qw422016, n)
+	//line testdata/templates/bench.qtpl:50
+	qe422016 := qw422016.Err()
+	//line testdata/templates/bench.qtpl:50
+	qt422016.ReleaseWriter(qw422016)
+	//line testdata/templates/bench.qtpl:50
+	return qe422016
+//line testdata/templates/bench.qtpl:50
+}
+
+//line testdata/templates/bench.qtpl:51
+func streambenchNested2(qw422016 *qt422016.Writer, n int) {
+	//line testdata/templates/bench.qtpl:51
+	qw422016.N().S(`<div>`)
+	//line testdata/templates/bench.qtpl:51
+	streambenchNested1(qw422016, n)
+	//line testdata/templates/bench.qtpl:51
+	qw422016.N().S(`</div>`)
+//line testdata/templates/bench.qtpl:51
+}
+
+//line testdata/templates/bench.qtpl:51
+func writebenchNested2(qq422016 qtio422016.Writer, n int) {
+	//line testdata/templates/bench.qtpl:51
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	//line testdata/templates/bench.qtpl:51
+	streambenchNested2(qw422016, n)
+	//line testdata/templates/bench.qtpl:51
+	qt422016.ReleaseWriter(qw422016)
+//line testdata/templates/bench.qtpl:51
+}
+
+//line testdata/templates/bench.qtpl:51
+func benchNested2(n int) string {
+	//line testdata/templates/bench.qtpl:51
+	qb422016 := qt422016.AcquireByteBuffer()
+	//line testdata/templates/bench.qtpl:51
+	writebenchNested2(qb422016, n)
+	//line testdata/templates/bench.qtpl:51
+	qs422016 := string(qb422016.B)
+	//line testdata/templates/bench.qtpl:51
+	qt422016.ReleaseByteBuffer(qb422016)
+	//line testdata/templates/bench.qtpl:51
+	return qs422016
+//line testdata/templates/bench.qtpl:51
+}
+
+//line testdata/templates/bench.qtpl:51
+func appendbenchNested2(dst422016 []byte, n int) []byte {
+	//line testdata/templates/bench.qtpl:51
+	qb422016 := qt422016.AcquireByteBuffer()
+	//line testdata/templates/bench.qtpl:51
+	qz422016 := qb422016.B
+	//line testdata/templates/bench.qtpl:51
+	qb422016.B = dst422016
+	//line testdata/templates/bench.qtpl:51
+	writebenchNested2(qb422016, n)
+	//line testdata/templates/bench.qtpl:51
+	dst422016 = qb422016.B
+	//line testdata/templates/bench.qtpl:51
+	qb422016.B = qz422016
+	//line testdata/templates/bench.qtpl:51
+	qt422016.ReleaseByteBuffer(qb422016)
+	//line testdata/templates/bench.qtpl:51
+	return dst422016
+//line testdata/templates/bench.qtpl:51
+}
+
+//line testdata/templates/bench.qtpl:51
+func writebenchNested2Err(qq422016 qtio422016.Writer, n int) error {
+	//line testdata/templates/bench.qtpl:51
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	//line testdata/templates/bench.qtpl:51
+	streambenchNested2(qw422016, n)
+	//line testdata/templates/bench.qtpl:51
+	qe422016 := qw422016.Err()
+	//line testdata/templates/bench.qtpl:51
+	qt422016.ReleaseWriter(qw422016)
+	//line testdata/templates/bench.qtpl:51
+	return qe422016
+//line testdata/templates/bench.qtpl:51
+}
+
+//line testdata/templates/bench.qtpl:52
+func streambenchNested1(qw422016 *qt422016.Writer, n int) {
+	//line testdata/templates/bench.qtpl:52
+	qw422016.N().S(`<div>`)
+	//line testdata/templates/bench.qtpl:52
+	qw422016.N().D(n)
+	//line testdata/templates/bench.qtpl:52
+	qw422016.N().S(`</div>`)
+//line testdata/templates/bench.qtpl:52
+}
+
+//line testdata/templates/bench.qtpl:52
+func writebenchNested1(qq422016 qtio422016.Writer, n int) {
+	//line testdata/templates/bench.qtpl:52
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	//line testdata/templates/bench.qtpl:52
+	streambenchNested1(qw422016, n)
+	//line testdata/templates/bench.qtpl:52
+	qt422016.ReleaseWriter(qw422016)
+//line testdata/templates/bench.qtpl:52
+}
+
+//line testdata/templates/bench.qtpl:52
+func benchNested1(n int) string {
+	//line testdata/templates/bench.qtpl:52
+	qb422016 := qt422016.AcquireByteBuffer()
+	//line testdata/templates/bench.qtpl:52
+	writebenchNested1(qb422016, n)
+	//line testdata/templates/bench.qtpl:52
+	qs422016 := string(qb422016.B)
+	//line testdata/templates/bench.qtpl:52
+	qt422016.ReleaseByteBuffer(qb422016)
+	//line testdata/templates/bench.qtpl:52
+	return qs422016
+//line testdata/templates/bench.qtpl:52
+}
+
+//line testdata/templates/bench.qtpl:52
+func appendbenchNested1(dst422016 []byte, n int) []byte {
+	//line testdata/templates/bench.qtpl:52
+	qb422016 := qt422016.AcquireByteBuffer()
+	//line testdata/templates/bench.qtpl:52
+	qz422016 := qb422016.B
+	//line testdata/templates/bench.qtpl:52
+	qb422016.B = dst422016
+	//line testdata/templates/bench.qtpl:52
+	writebenchNested1(qb422016, n)
+	//line testdata/templates/bench.qtpl:52
+	dst422016 = qb422016.B
+	//line testdata/templates/bench.qtpl:52
+	qb422016.B = qz422016
+	//line testdata/templates/bench.qtpl:52
+	qt422016.ReleaseByteBuffer(qb422016)
+	//line testdata/templates/bench.qtpl:52
+	return dst422016
+//line testdata/templates/bench.qtpl:52
+}
+
+//line testdata/templates/bench.qtpl:52
+func writebenchNested1Err(qq422016 qtio422016.Writer, n int) error {
+	//line testdata/templates/bench.qtpl:52
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	//line testdata/templates/bench.qtpl:52
+	streambenchNested1(qw422016, n)
+	//line testdata/templates/bench.qtpl:52
+	qe422016 := qw422016.Err()
+	//line testdata/templates/bench.qtpl:52
+	qt422016.ReleaseWriter(qw422016)
+	//line testdata/templates/bench.qtpl:52
+	return qe422016
+//line testdata/templates/bench.qtpl:52
+}
+
+//line testdata/templates/bench.qtpl:54
+func StreamBenchFlat(qw422016 *qt422016.Writer, n int) {
+	//line testdata/templates/bench.qtpl:54
+	qw422016.N().S(`<div><div><div><div><div>`)
+	//line testdata/templates/bench.qtpl:54
+	qw422016.N().D(n)
+	//line testdata/templates/bench.qtpl:54
+	qw422016.N().S(`</div></div></div></div></div>`)
+//line testdata/templates/bench.qtpl:54
+}
+
+//line testdata/templates/bench.qtpl:54
+func WriteBenchFlat(qq422016 qtio422016.Writer, n int) {
+	//line testdata/templates/bench.qtpl:54
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	//line testdata/templates/bench.qtpl:54
+	StreamBenchFlat(qw422016, n)
+	//line testdata/templates/bench.qtpl:54
+	qt422016.ReleaseWriter(qw422016)
+//line testdata/templates/bench.qtpl:54
+}
+
+//line testdata/templates/bench.qtpl:54
+func BenchFlat(n int) string {
+	//line testdata/templates/bench.qtpl:54
+	qb422016 := qt422016.AcquireByteBuffer()
+	//line testdata/templates/bench.qtpl:54
+	WriteBenchFlat(qb422016, n)
+	//line testdata/templates/bench.qtpl:54
+	qs422016 := string(qb422016.B)
+	//line testdata/templates/bench.qtpl:54
+	qt422016.ReleaseByteBuffer(qb422016)
+	//line testdata/templates/bench.qtpl:54
+	return qs422016
+//line testdata/templates/bench.qtpl:54
+}
+
+//line testdata/templates/bench.qtpl:54
+func AppendBenchFlat(dst422016 []byte, n int) []byte {
+	//line testdata/templates/bench.qtpl:54
+	qb422016 := qt422016.AcquireByteBuffer()
+	//line testdata/templates/bench.qtpl:54
+	qz422016 := qb422016.B
+	//line testdata/templates/bench.qtpl:54
+	qb422016.B = dst422016
+	//line testdata/templates/bench.qtpl:54
+	WriteBenchFlat(qb422016, n)
+	//line testdata/templates/bench.qtpl:54
+	dst422016 = qb422016.B
+	//line testdata/templates/bench.qtpl:54
+	qb422016.B = qz422016
+	//line testdata/templates/bench.qtpl:54
+	qt422016.ReleaseByteBuffer(qb422016)
+	//line testdata/templates/bench.qtpl:54
+	return dst422016
+//line testdata/templates/bench.qtpl:54
+}
+
+//line testdata/templates/bench.qtpl:54
+func WriteBenchFlatErr(qq422016 qtio422016.Writer, n int) error {
+	//line testdata/templates/bench.qtpl:54
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	//line testdata/templates/bench.qtpl:54
+	StreamBenchFlat(qw422016, n)
+	//line testdata/templates/bench.qtpl:54
+	qe422016 := qw422016.Err()
+	//line testdata/templates/bench.qtpl:54
+	qt422016.ReleaseWriter(qw422016)
+	//line testdata/templates/bench.qtpl:54
+	return qe422016
+//line testdata/templates/bench.qtpl:54
+}
+
+//line testdata/templates/bench.qtpl:56
+func streambenchInlined1(qw422016 *qt422016.Writer, n int) {
+	//line testdata/templates/bench.qtpl:56
+	qw422016.N().S(`<div>`)
+	//line testdata/templates/bench.qtpl:56
+	qw422016.N().D(n)
+	//line testdata/templates/bench.qtpl:56
+	qw422016.N().S(`</div>`)
+//line testdata/templates/bench.qtpl:56
+}
+
+//line testdata/templates/bench.qtpl:56
+func writebenchInlined1(qq422016 qtio422016.Writer, n int) {
+	//line testdata/templates/bench.qtpl:56
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	//line testdata/templates/bench.qtpl:56
+	streambenchInlined1(qw422016, n)
+	//line testdata/templates/bench.qtpl:56
+	qt422016.ReleaseWriter(qw422016)
+//line testdata/templates/bench.qtpl:56
+}
+
+//line testdata/templates/bench.qtpl:56
+func benchInlined1(n int) string {
+	//line testdata/templates/bench.qtpl:56
+	qb422016 := qt422016.AcquireByteBuffer()
+	//line testdata/templates/bench.qtpl:56
+	writebenchInlined1(qb422016, n)
+	//line testdata/templates/bench.qtpl:56
+	qs422016 := string(qb422016.B)
+	//line testdata/templates/bench.qtpl:56
+	qt422016.ReleaseByteBuffer(qb422016)
+	//line testdata/templates/bench.qtpl:56
+	return qs422016
+//line testdata/templates/bench.qtpl:56
+}
+
+//line testdata/templates/bench.qtpl:56
+func appendbenchInlined1(dst422016 []byte, n int) []byte {
+	//line testdata/templates/bench.qtpl:56
+	qb422016 := qt422016.AcquireByteBuffer()
+	//line testdata/templates/bench.qtpl:56
+	qz422016 := qb422016.B
+	//line testdata/templates/bench.qtpl:56
+	qb422016.B = dst422016
+	//line testdata/templates/bench.qtpl:56
+	writebenchInlined1(qb422016, n)
+	//line testdata/templates/bench.qtpl:56
+	dst422016 = qb422016.B
+	//line testdata/templates/bench.qtpl:56
+	qb422016.B = qz422016
+	//line testdata/templates/bench.qtpl:56
+	qt422016.ReleaseByteBuffer(qb422016)
+	//line testdata/templates/bench.qtpl:56
+	return dst422016
+//line testdata/templates/bench.qtpl:56
+}
+
+//line testdata/templates/bench.qtpl:56
+func writebenchInlined1Err(qq422016 qtio422016.Writer, n int) error {
+	//line testdata/templates/bench.qtpl:56
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	//line testdata/templates/bench.qtpl:56
+	streambenchInlined1(qw422016, n)
+	//line testdata/templates/bench.qtpl:56
+	qe422016 := qw422016.Err()
+	//line testdata/templates/bench.qtpl:56
+	qt422016.ReleaseWriter(qw422016)
+	//line testdata/templates/bench.qtpl:56
+	return qe422016
+//line testdata/templates/bench.qtpl:56
+}
+
+//line testdata/templates/bench.qtpl:57
+func streambenchInlined2(qw422016 *qt422016.Writer, n int) {
+	//line testdata/templates/bench.qtpl:57
+	qw422016.N().S(`<div>`)
+	//line testdata/templates/bench.qtpl:57
+	{
+		//line testdata/templates/bench.qtpl:57
+		var n int = n
+		//line testdata/templates/bench.qtpl:57
+		_ = n
+		//line testdata/templates/bench.qtpl:56
+		qw422016.N().S(`<div>`)
+		//line testdata/templates/bench.qtpl:56
+		qw422016.N().D(n)
+		//line testdata/templates/bench.qtpl:56
+		qw422016.N().S(`</div>`)
+		//line testdata/templates/bench.qtpl:57
+	}
+	//line testdata/templates/bench.qtpl:57
+	qw422016.N().S(`</div>`)
+//line testdata/templates/bench.qtpl:57
+}
+
+//line testdata/templates/bench.qtpl:57
+func writebenchInlined2(qq422016 qtio422016.Writer, n int) {
+	//line testdata/templates/bench.qtpl:57
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	//line testdata/templates/bench.qtpl:57
+	streambenchInlined2(qw422016, n)
+	//line testdata/templates/bench.qtpl:57
+	qt422016.ReleaseWriter(qw422016)
+//line testdata/templates/bench.qtpl:57
+}
+
+//line testdata/templates/bench.qtpl:57
+func benchInlined2(n int) string {
+	//line testdata/templates/bench.qtpl:57
+	qb422016 := qt422016.AcquireByteBuffer()
+	//line testdata/templates/bench.qtpl:57
+	writebenchInlined2(qb422016, n)
+	//line testdata/templates/bench.qtpl:57
+	qs422016 := string(qb422016.B)
+	//line testdata/templates/bench.qtpl:57
+	qt422016.ReleaseByteBuffer(qb422016)
+	//line testdata/templates/bench.qtpl:57
+	return qs422016
+//line testdata/templates/bench.qtpl:57
+}
+
+//line testdata/templates/bench.qtpl:57
+func appendbenchInlined2(dst422016 []byte, n int) []byte {
+	//line testdata/templates/bench.qtpl:57
+	qb422016 := qt422016.AcquireByteBuffer()
+	//line testdata/templates/bench.qtpl:57
+	qz422016 := qb422016.B
+	//line testdata/templates/bench.qtpl:57
+	qb422016.B = dst422016
+	//line testdata/templates/bench.qtpl:57
+	writebenchInlined2(qb422016, n)
+	//line testdata/templates/bench.qtpl:57
+	dst422016 = qb422016.B
+	//line testdata/templates/bench.qtpl:57
+	qb422016.B = qz422016
+	//line testdata/templates/bench.qtpl:57
+	qt422016.ReleaseByteBuffer(qb422016)
+	//line testdata/templates/bench.qtpl:57
+	return dst422016
+//line testdata/templates/bench.qtpl:57
+}
+
+//line testdata/templates/bench.qtpl:57
+func writebenchInlined2Err(qq422016 qtio422016.Writer, n int) error {
+	//line testdata/templates/bench.qtpl:57
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	//line testdata/templates/bench.qtpl:57
+	streambenchInlined2(qw422016, n)
+	//line testdata/templates/bench.qtpl:57
+	qe422016 := qw422016.Err()
+	//line testdata/templates/bench.qtpl:57
+	qt422016.ReleaseWriter(qw422016)
+	//line testdata/templates/bench.qtpl:57
+	return qe422016
+//line testdata/templates/bench.qtpl:57
+}
+
+//line testdata/templates/bench.qtpl:58
+func streambenchInlined3(qw422016 *qt422016.Writer, n int) {
+	//line testdata/templates/bench.qtpl:58
+	qw422016.N().S(`<div>`)
+	//line testdata/templates/bench.qtpl:58
+	{
+		//line testdata/templates/bench.qtpl:58
+		var n int = n
+		//line testdata/templates/bench.qtpl:58
+		_ = n
+		//line testdata/templates/bench.qtpl:57
+		qw422016.N().S(`<div>`)
+		//line testdata/templates/bench.qtpl:57
+		{
+			//line testdata/templates/bench.qtpl:57
+			var n int = n
+			//line testdata/templates/bench.qtpl:57
+			_ = n
+			//line testdata/templates/bench.qtpl:56
+			qw422016.N().S(`<div>`)
+			//line testdata/templates/bench.qtpl:56
+			qw422016.N().D(n)
+			//line testdata/templates/bench.qtpl:56
+			qw422016.N().S(`</div>`)
+			//line testdata/templates/bench.qtpl:57
+		}
+		//line testdata/templates/bench.qtpl:57
+		qw422016.N().S(`</div>`)
+		//line testdata/templates/bench.qtpl:58
+	}
+	//line testdata/templates/bench.qtpl:58
+	qw422016.N().S(`</div>`)
+//line testdata/templates/bench.qtpl:58
+}
+
+//line testdata/templates/bench.qtpl:58
+func writebenchInlined3(qq422016 qtio422016.Writer, n int) {
+	//line testdata/templates/bench.qtpl:58
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	//line testdata/templates/bench.qtpl:58
+	streambenchInlined3(qw422016, n)
+	//line testdata/templates/bench.qtpl:58
+	qt422016.ReleaseWriter(qw422016)
+//line testdata/templates/bench.qtpl:58
+}
+
+//line testdata/templates/bench.qtpl:58
+func benchInlined3(n int) string {
+	//line testdata/templates/bench.qtpl:58
+	qb422016 := qt422016.AcquireByteBuffer()
+	//line testdata/templates/bench.qtpl:58
+	writebenchInlined3(qb422016, n)
+	//line testdata/templates/bench.qtpl:58
+	qs422016 := string(qb422016.B)
+	//line testdata/templates/bench.qtpl:58
+	qt422016.ReleaseByteBuffer(qb422016)
+	//line testdata/templates/bench.qtpl:58
+	return qs422016
+//line testdata/templates/bench.qtpl:58
+}
+
+//line testdata/templates/bench.qtpl:58
+func appendbenchInlined3(dst422016 []byte, n int) []byte {
+	//line testdata/templates/bench.qtpl:58
+	qb422016 := qt422016.AcquireByteBuffer()
+	//line testdata/templates/bench.qtpl:58
+	qz422016 := qb422016.B
+	//line testdata/templates/bench.qtpl:58
+	qb422016.B = dst422016
+	//line testdata/templates/bench.qtpl:58
+	writebenchInlined3(qb422016, n)
+	//line testdata/templates/bench.qtpl:58
+	dst422016 = qb422016.B
+	//line testdata/templates/bench.qtpl:58
+	qb422016.B = qz422016
+	//line testdata/templates/bench.qtpl:58
+	qt422016.ReleaseByteBuffer(qb422016)
+	//line testdata/templates/bench.qtpl:58
+	return dst422016
+//line testdata/templates/bench.qtpl:58
+}
+
+//line testdata/templates/bench.qtpl:58
+func writebenchInlined3Err(qq422016 qtio422016.Writer, n int) error {
+	//line testdata/templates/bench.qtpl:58
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	//line testdata/templates/bench.qtpl:58
+	streambenchInlined3(qw422016, n)
+	//line testdata/templates/bench.qtpl:58
+	qe422016 := qw422016.Err()
+	//line testdata/templates/bench.qtpl:58
+	qt422016.ReleaseWriter(qw422016)
+	//line testdata/templates/bench.qtpl:58
+	return qe422016
+//line testdata/templates/bench.qtpl:58
+}
+
+//line testdata/templates/bench.qtpl:59
+func streambenchInlined4(qw422016 *qt422016.Writer, n int) {
+	//line testdata/templates/bench.qtpl:59
+	qw422016.N().S(`<div>`)
+	//line testdata/templates/bench.qtpl:59
+	{
+		//line testdata/templates/bench.qtpl:59
+		var n int = n
+		//line testdata/templates/bench.qtpl:59
+		_ = n
+		//line testdata/templates/bench.qtpl:58
+		qw422016.N().S(`<div>`)
+		//line testdata/templates/bench.qtpl:58
+		{
+			//line testdata/templates/bench.qtpl:58
+			var n int = n
+			//line testdata/templates/bench.qtpl:58
+			_ = n
+			//line testdata/templates/bench.qtpl:57
+			qw422016.N().S(`<div>`)
+			//line testdata/templates/bench.qtpl:57
+			{
+				//line testdata/templates/bench.qtpl:57
+				var n int = n
+				//line testdata/templates/bench.qtpl:57
+				_ = n
+				//line testdata/templates/bench.qtpl:56
+				qw422016.N().S(`<div>`)
+				//line testdata/templates/bench.qtpl:56
+				qw422016.N().D(n)
+				//line testdata/templates/bench.qtpl:56
+				qw422016.N().S(`</div>`)
+				//line testdata/templates/bench.qtpl:57
+			}
+			//line testdata/templates/bench.qtpl:57
+			qw422016.N().S(`</div>`)
+			//line testdata/templates/bench.qtpl:58
+		}
+		//line testdata/templates/bench.qtpl:58
+		qw422016.N().S(`</div>`)
+		//line testdata/templates/bench.qtpl:59
+	}
+	//line testdata/templates/bench.qtpl:59
+	qw422016.N().S(`</div>`)
+//line testdata/templates/bench.qtpl:59
+}
+
+//line testdata/templates/bench.qtpl:59
+func writebenchInlined4(qq422016 qtio422016.Writer, n int) {
+	//line testdata/templates/bench.qtpl:59
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	//line testdata/templates/bench.qtpl:59
+	streambenchInlined4(qw422016, n)
+	//line testdata/templates/bench.qtpl:59
+	qt422016.ReleaseWriter(qw422016)
+//line testdata/templates/bench.qtpl:59
+}
+
+//line testdata/templates/bench.qtpl:59
+func benchInlined4(n int) string {
+	//line testdata/templates/bench.qtpl:59
+	qb422016 := qt422016.AcquireByteBuffer()
+	//line testdata/templates/bench.qtpl:59
+	writebenchInlined4(qb422016, n)
+	//line testdata/templates/bench.qtpl:59
+	qs422016 := string(qb422016.B)
+	//line testdata/templates/bench.qtpl:59
+	qt422016.ReleaseByteBuffer(qb422016)
+	//line testdata/templates/bench.qtpl:59
+	return qs422016
+//line testdata/templates/bench.qtpl:59
+}
+
+//line testdata/templates/bench.qtpl:59
+func appendbenchInlined4(dst422016 []byte, n int) []byte {
+	//line testdata/templates/bench.qtpl:59
+	qb422016 := qt422016.AcquireByteBuffer()
+	//line testdata/templates/bench.qtpl:59
+	qz422016 := qb422016.B
+	//line testdata/templates/bench.qtpl:59
+	qb422016.B = dst422016
+	//line testdata/templates/bench.qtpl:59
+	writebenchInlined4(qb422016, n)
+	//line testdata/templates/bench.qtpl:59
+	dst422016 = qb422016.B
+	//line testdata/templates/bench.qtpl:59
+	qb422016.B = qz422016
+	//line testdata/templates/bench.qtpl:59
+	qt422016.ReleaseByteBuffer(qb422016)
+	//line testdata/templates/bench.qtpl:59
+	return dst422016
+//line testdata/templates/bench.qtpl:59
+}
+
+//line testdata/templates/bench.qtpl:59
+func writebenchInlined4Err(qq422016 qtio422016.Writer, n int) error {
+	//line testdata/templates/bench.qtpl:59
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	//line testdata/templates/bench.qtpl:59
+	streambenchInlined4(qw422016, n)
+	//line testdata/templates/bench.qtpl:59
+	qe422016 := qw422016.Err()
+	//line testdata/templates/bench.qtpl:59
+	qt422016.ReleaseWriter(qw422016)
+	//line testdata/templates/bench.qtpl:59
+	return qe422016
+//line testdata/templates/bench.qtpl:59
+}
+
+//line testdata/templates/bench.qtpl:60
+func StreamBenchInlined(qw422016 *qt422016.Writer, n int) {
+	//line testdata/templates/bench.qtpl:60
+	qw422016.N().S(`<div>`)
+	//line testdata/templates/bench.qtpl:60
+	{
+		//line testdata/templates/bench.qtpl:60
+		var n int = n
+		//line testdata/templates/bench.qtpl:60
+		_ = n
+		//line testdata/templates/bench.qtpl:59
+		qw422016.N().S(`<div>`)
+		//line testdata/templates/bench.qtpl:59
+		{
+			//line testdata/templates/bench.qtpl:59
+			var n int = n
+			//line testdata/templates/bench.qtpl:59
+			_ = n
+			//line testdata/templates/bench.qtpl:58
+			qw422016.N().S(`<div>`)
+			//line testdata/templates/bench.qtpl:58
+			{
+				//line testdata/templates/bench.qtpl:58
+				var n int = n
+				//line testdata/templates/bench.qtpl:58
+				_ = n
+				//line testdata/templates/bench.qtpl:57
+				qw422016.N().S(`<div>`)
+				//line testdata/templates/bench.qtpl:57
+				{
+					//line testdata/templates/bench.qtpl:57
+					var n int = n
+					//line testdata/templates/bench.qtpl:57
+					_ = n
+					//line testdata/templates/bench.qtpl:56
+					qw422016.N().S(`<div>`)
+					//line testdata/templates/bench.qtpl:56
+					qw422016.N().D(n)
+					//line testdata/templates/bench.qtpl:56
+					qw422016.N().S(`</div>`)
+					//line testdata/templates/bench.qtpl:57
+				}
+				//line testdata/templates/bench.qtpl:57
+				qw422016.N().S(`</div>`)
+				//line testdata/templates/bench.qtpl:58
+			}
+			//line testdata/templates/bench.qtpl:58
+			qw422016.N().S(`</div>`)
+			//line testdata/templates/bench.qtpl:59
+		}
+		//line testdata/templates/bench.qtpl:59
+		qw422016.N().S(`</div>`)
+		//line testdata/templates/bench.qtpl:60
+	}
+	//line testdata/templates/bench.qtpl:60
+	qw422016.N().S(`</div>`)
+//line testdata/templates/bench.qtpl:60
+}
+
+//line testdata/templates/bench.qtpl:60
+func WriteBenchInlined(qq422016 qtio422016.Writer, n int) {
+	//line testdata/templates/bench.qtpl:60
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	//line testdata/templates/bench.qtpl:60
+	StreamBenchInlined(qw422016, n)
+	//line testdata/templates/bench.qtpl:60
+	qt422016.ReleaseWriter(qw422016)
+//line testdata/templates/bench.qtpl:60
+}
+
+//line testdata/templates/bench.qtpl:60
+func BenchInlined(n int) string {
+	//line testdata/templates/bench.qtpl:60
+	qb422016 := qt422016.AcquireByteBuffer()
+	//line testdata/templates/bench.qtpl:60
+	WriteBenchInlined(qb422016, n)
+	//line testdata/templates/bench.qtpl:60
+	qs422016 := string(qb422016.B)
+	//line testdata/templates/bench.qtpl:60
+	qt422016.ReleaseByteBuffer(qb422016)
+	//line testdata/templates/bench.qtpl:60
+	return qs422016
+//line testdata/templates/bench.qtpl:60
+}
+
+//line testdata/templates/bench.qtpl:60
+func AppendBenchInlined(dst422016 []byte, n int) []byte {
+	//line testdata/templates/bench.qtpl:60
+	qb422016 := qt422016.AcquireByteBuffer()
+	//line testdata/templates/bench.qtpl:60
+	qz422016 := qb422016.B
+	//line testdata/templates/bench.qtpl:60
+	qb422016.B = dst422016
+	//line testdata/templates/bench.qtpl:60
+	WriteBenchInlined(qb422016, n)
+	//line testdata/templates/bench.qtpl:60
+	dst422016 = qb422016.B
+	//line testdata/templates/bench.qtpl:60
+	qb422016.B = qz422016
+	//line testdata/templates/bench.qtpl:60
+	qt422016.ReleaseByteBuffer(qb422016)
+	//line testdata/templates/bench.qtpl:60
+	return dst422016
+//line testdata/templates/bench.qtpl:60
+}
+
+//line testdata/templates/bench.qtpl:60
+func WriteBenchInlinedErr(qq422016 qtio422016.Writer, n int) error {
+	//line testdata/templates/bench.qtpl:60
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	//line testdata/templates/bench.qtpl:60
+	StreamBenchInlined(qw422016, n)
+	//line testdata/templates/bench.qtpl:60
+	qe422016 := qw422016.Err()
+	//line testdata/templates/bench.qtpl:60
+	qt422016.ReleaseWriter(qw422016)
+	//line testdata/templates/bench.qtpl:60
+	return qe422016
+//line testdata/templates/bench.qtpl:60
+}
+
+//line testdata/templates/bench.qtpl:62
+func StreamBenchLarge(qw422016 *qt422016.Writer, rows []BenchRow) {
+	//line testdata/templates/bench.qtpl:62
+	for range 10 {
+		//line testdata/templates/bench.qtpl:62
+		StreamBenchPage(qw422016, rows)
+		//line testdata/templates/bench.qtpl:62
+	}
+//line testdata/templates/bench.qtpl:62
+}
+
+//line testdata/templates/bench.qtpl:62
+func WriteBenchLarge(qq422016 qtio422016.Writer, rows []BenchRow) {
+	//line testdata/templates/bench.qtpl:62
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	//line testdata/templates/bench.qtpl:62
+	StreamBenchLarge(qw422016, rows)
+	//line testdata/templates/bench.qtpl:62
+	qt422016.ReleaseWriter(qw422016)
+//line testdata/templates/bench.qtpl:62
+}
+
+//line testdata/templates/bench.qtpl:62
+func BenchLarge(rows []BenchRow) string {
+	//line testdata/templates/bench.qtpl:62
+	qb422016 := qt422016.AcquireByteBuffer()
+	//line testdata/templates/bench.qtpl:62
+	WriteBenchLarge(qb422016, rows)
+	//line testdata/templates/bench.qtpl:62
+	qs422016 := string(qb422016.B)
+	//line testdata/templates/bench.qtpl:62
+	qt422016.ReleaseByteBuffer(qb422016)
+	//line testdata/templates/bench.qtpl:62
+	return qs422016
+//line testdata/templates/bench.qtpl:62
+}
+
+//line testdata/templates/bench.qtpl:62
+func AppendBenchLarge(dst422016 []byte, rows []BenchRow) []byte {
+	//line testdata/templates/bench.qtpl:62
+	qb422016 := qt422016.AcquireByteBuffer()
+	//line testdata/templates/bench.qtpl:62
+	qz422016 := qb422016.B
+	//line testdata/templates/bench.qtpl:62
+	qb422016.B = dst422016
+	//line testdata/templates/bench.qtpl:62
+	WriteBenchLarge(qb422016, rows)
+	//line testdata/templates/bench.qtpl:62
+	dst422016 = qb422016.B
+	//line testdata/templates/bench.qtpl:62
+	qb422016.B = qz422016
+	//line testdata/templates/bench.qtpl:62
+	qt422016.ReleaseByteBuffer(qb422016)
+	//line testdata/templates/bench.qtpl:62
+	return dst422016
+//line testdata/templates/bench.qtpl:62
+}
+
+//line testdata/templates/bench.qtpl:62
+func WriteBenchLargeErr(qq422016 qtio422016.Writer, rows []BenchRow) error {
+	//line testdata/templates/bench.qtpl:62
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	//line testdata/templates/bench.qtpl:62
+	StreamBenchLarge(qw422016, rows)
+	//line testdata/templates/bench.qtpl:62
+	qe422016 := qw422016.Err()
+	//line testdata/templates/bench.qtpl:62
+	qt422016.ReleaseWriter(qw422016)
+	//line testdata/templates/bench.qtpl:62
+	return qe422016
+//line testdata/templates/bench.qtpl:62
+}
+
+//line testdata/templates/bench.qtpl:63
+func StreamBenchLargeHinted(qw422016 *qt422016.Writer, rows []BenchRow) {
+	//line testdata/templates/bench.qtpl:63
+	for range 10 {
+		//line testdata/templates/bench.qtpl:63
+		StreamBenchPage(qw422016, rows)
+		//line testdata/templates/bench.qtpl:63
+	}
+//line testdata/templates/bench.qtpl:63
+}
+
+//line testdata/templates/bench.qtpl:63
+func WriteBenchLargeHinted(qq422016 qtio422016.Writer, rows []BenchRow) {
+	//line testdata/templates/bench.qtpl:63
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	//line testdata/templates/bench.qtpl:63
+	StreamBenchLargeHinted(qw422016, rows)
+	//line testdata/templates/bench.qtpl:63
+	qt422016.ReleaseWriter(qw422016)
+//line testdata/templates/bench.qtpl:63
+}
+
+//line testdata/templates/bench.qtpl:63
+func BenchLargeHinted(rows []BenchRow) string {
+	//line testdata/templates/bench.qtpl:63
+	qb422016 := qt422016.AcquireByteBufferSize(32768)
+	//line testdata/templates/bench.qtpl:63
+	WriteBenchLargeHinted(qb422016, rows)
+	//line testdata/templates/bench.qtpl:63
+	qs422016 := string(qb422016.B)
+	//line testdata/templates/bench.qtpl:63
+	qt422016.ReleaseByteBuffer(qb422016)
+	//line testdata/templates/bench.qtpl:63
+	return qs422016
+//line testdata/templates/bench.qtpl:63
+}
+
+//line testdata/templates/bench.qtpl:63
+func AppendBenchLargeHinted(dst422016 []byte, rows []BenchRow) []byte {
+	//line testdata/templates/bench.qtpl:63
+	qb422016 := qt422016.AcquireByteBuffer()
+	//line testdata/templates/bench.qtpl:63
+	qz422016 := qb422016.B
+	//line testdata/templates/bench.qtpl:63
+	qb422016.B = dst422016
+	//line testdata/templates/bench.qtpl:63
+	WriteBenchLargeHinted(qb422016, rows)
+	//line testdata/templates/bench.qtpl:63
+	dst422016 = qb422016.B
+	//line testdata/templates/bench.qtpl:63
+	qb422016.B = qz422016
+	//line testdata/templates/bench.qtpl:63
+	qt422016.ReleaseByteBuffer(qb422016)
+	//line testdata/templates/bench.qtpl:63
+	return dst422016
+//line testdata/templates/bench.qtpl:63
+}
+
+//line testdata/templates/bench.qtpl:63
+func WriteBenchLargeHintedErr(qq422016 qtio422016.Writer, rows []BenchRow) error {
+	//line testdata/templates/bench.qtpl:63
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	//line testdata/templates/bench.qtpl:63
+	StreamBenchLargeHinted(qw422016, rows)
+	//line testdata/templates/bench.qtpl:63
+	qe422016 := qw422016.Err()
+	//line testdata/templates/bench.qtpl:63
+	qt422016.ReleaseWriter(qw422016)
+	//line testdata/templates/bench.qtpl:63
+	return qe422016
+//line testdata/templates/bench.qtpl:63
 }
@@ -1,4 +1,4 @@
-// This file is automatically generated by qtc from "integration.qtpl".
+// Code generated by qtc from "integration.qtpl". DO NOT EDIT.
 // See https://github.com/valyala/quicktemplate for details.
 
 // This is a template for integration test.
@@ -9,743 +9,4008 @@
 package templates
 
 //line testdata/templates/integration.qtpl:4
-import "fmt"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
 
-//line testdata/templates/integration.qtpl:6
+//line testdata/templates/integration.qtpl:11
 import (
+	qtctx422016 "context"
 	qtio422016 "io"
 
 	qt422016 "github.com/valyala/quicktemplate"
 )
 
-//line testdata/templates/integration.qtpl:6
-var (
-	_ = qtio422016.Copy
-	_ = qt422016.AcquireByteBuffer
-)
-
-//line testdata/templates/integration.qtpl:6
+//line testdata/templates/integration.qtpl:11
 func StreamIntegration(qw422016 *qt422016.Writer) {
-	//line testdata/templates/integration.qtpl:6
+	//line testdata/templates/integration.qtpl:11
 	qw422016.N().S(`
 	Output tags`)
-	//line testdata/templates/integration.qtpl:6
+	//line testdata/templates/integration.qtpl:11
 	qw422016.N().S("`")
-	//line testdata/templates/integration.qtpl:6
+	//line testdata/templates/integration.qtpl:11
 	qw422016.N().S(` verification.
 
 	`)
-	//line testdata/templates/integration.qtpl:10
+	//line testdata/templates/integration.qtpl:15
 	p := &integrationPage{
 		S: "foobar",
 	}
 
-	//line testdata/templates/integration.qtpl:13
+	//line testdata/templates/integration.qtpl:18
 	qw422016.N().S(`
 	Embedded func template:
 		plain: `)
-	//line testdata/templates/integration.qtpl:15
+	//line testdata/templates/integration.qtpl:20
 	streamembeddedFunc(qw422016, p)
-	//line testdata/templates/integration.qtpl:15
+	//line testdata/templates/integration.qtpl:20
 	qw422016.N().S(`
 		html-escaped: `)
-	//line testdata/templates/integration.qtpl:16
+	//line testdata/templates/integration.qtpl:21
 	{
-		//line testdata/templates/integration.qtpl:16
+		//line testdata/templates/integration.qtpl:21
 		qb422016 := qt422016.AcquireByteBuffer()
-		//line testdata/templates/integration.qtpl:16
+		//line testdata/templates/integration.qtpl:21
 		writeembeddedFunc(qb422016, p)
-		//line testdata/templates/integration.qtpl:16
+		//line testdata/templates/integration.qtpl:21
 		qw422016.E().Z(qb422016.B)
-		//line testdata/templates/integration.qtpl:16
+		//line testdata/templates/integration.qtpl:21
 		qt422016.ReleaseByteBuffer(qb422016)
-		//line testdata/templates/integration.qtpl:16
+		//line testdata/templates/integration.qtpl:21
 	}
-	//line testdata/templates/integration.qtpl:16
+	//line testdata/templates/integration.qtpl:21
 	qw422016.N().S(`
 		url-escaped: `)
-	//line testdata/templates/integration.qtpl:17
+	//line testdata/templates/integration.qtpl:22
 	{
-		//line testdata/templates/integration.qtpl:17
+		//line testdata/templates/integration.qtpl:22
 		qb422016 := qt422016.AcquireByteBuffer()
-		//line testdata/templates/integration.qtpl:17
+		//line testdata/templates/integration.qtpl:22
 		writeembeddedFunc(qb422016, p)
-		//line testdata/templates/integration.qtpl:17
+		//line testdata/templates/integration.qtpl:22
 		qw422016.N().UZ(qb422016.B)
-		//line testdata/templates/integration.qtpl:17
+		//line testdata/templates/integration.qtpl:22
 		qt422016.ReleaseByteBuffer(qb422016)
-		//line testdata/templates/integration.qtpl:17
+		//line testdata/templates/integration.qtpl:22
 	}
-	//line testdata/templates/integration.qtpl:17
+	//line testdata/templates/integration.qtpl:22
 	qw422016.N().S(`
 		quoted json string: `)
-	//line testdata/templates/integration.qtpl:18
+	//line testdata/templates/integration.qtpl:23
 	{
-		//line testdata/templates/integration.qtpl:18
+		//line testdata/templates/integration.qtpl:23
 		qb422016 := qt422016.AcquireByteBuffer()
-		//line testdata/templates/integration.qtpl:18
+		//line testdata/templates/integration.qtpl:23
 		writeembeddedFunc(qb422016, p)
-		//line testdata/templates/integration.qtpl:18
+		//line testdata/templates/integration.qtpl:23
 		qw422016.N().QZ(qb422016.B)
-		//line testdata/templates/integration.qtpl:18
+		//line testdata/templates/integration.qtpl:23
 		qt422016.ReleaseByteBuffer(qb422016)
-		//line testdata/templates/integration.qtpl:18
+		//line testdata/templates/integration.qtpl:23
 	}
-	//line testdata/templates/integration.qtpl:18
+	//line testdata/templates/integration.qtpl:23
 	qw422016.N().S(`
 		unquoted json string: `)
-	//line testdata/templates/integration.qtpl:19
+	//line testdata/templates/integration.qtpl:24
 	{
-		//line testdata/templates/integration.qtpl:19
+		//line testdata/templates/integration.qtpl:24
 		qb422016 := qt422016.AcquireByteBuffer()
-		//line testdata/templates/integration.qtpl:19
+		//line testdata/templates/integration.qtpl:24
 		writeembeddedFunc(qb422016, p)
-		//line testdata/templates/integration.qtpl:19
+		//line testdata/templates/integration.qtpl:24
 		qw422016.N().JZ(qb422016.B)
-		//line testdata/templates/integration.qtpl:19
+		//line testdata/templates/integration.qtpl:24
 		qt422016.ReleaseByteBuffer(qb422016)
-		//line testdata/templates/integration.qtpl:19
+		//line testdata/templates/integration.qtpl:24
 	}
-	//line testdata/templates/integration.qtpl:19
+	//line testdata/templates/integration.qtpl:24
 	qw422016.N().S(`
 		html-escaped url-escaped: `)
-	//line testdata/templates/integration.qtpl:20
+	//line testdata/templates/integration.qtpl:25
 	{
-		//line testdata/templates/integration.qtpl:20
+		//line testdata/templates/integration.qtpl:25
 		qb422016 := qt422016.AcquireByteBuffer()
-		//line testdata/templates/integration.qtpl:20
+		//line testdata/templates/integration.qtpl:25
 		writeembeddedFunc(qb422016, p)
-		//line testdata/templates/integration.qtpl:20
+		//line testdata/templates/integration.qtpl:25
 		qw422016.N().UZ(qb422016.B)
-		//line testdata/templates/integration.qtpl:20
+		//line testdata/templates/integration.qtpl:25
 		qt422016.ReleaseByteBuffer(qb422016)
-		//line testdata/templates/integration.qtpl:20
+		//line testdata/templates/integration.qtpl:25
 	}
-	//line testdata/templates/integration.qtpl:20
+	//line testdata/templates/integration.qtpl:25
 	qw422016.N().S(`
 		html-escaped quoted json string: `)
-	//line testdata/templates/integration.qtpl:21
+	//line testdata/templates/integration.qtpl:26
 	{
-		//line testdata/templates/integration.qtpl:21
+		//line testdata/templates/integration.qtpl:26
 		qb422016 := qt422016.AcquireByteBuffer()
-		//line testdata/templates/integration.qtpl:21
+		//line testdata/templates/integration.qtpl:26
 		writeembeddedFunc(qb422016, p)
-		//line testdata/templates/integration.qtpl:21
+		//line testdata/templates/integration.qtpl:26
 		qw422016.E().QZ(qb422016.B)
-		//line testdata/templates/integration.qtpl:21
+		//line testdata/templates/integration.qtpl:26
 		qt422016.ReleaseByteBuffer(qb422016)
-		//line testdata/templates/integration.qtpl:21
+		//line testdata/templates/integration.qtpl:26
 	}
-	//line testdata/templates/integration.qtpl:21
+	//line testdata/templates/integration.qtpl:26
 	qw422016.N().S(`
 		html-escaped unquoted json string: `)
-	//line testdata/templates/integration.qtpl:22
+	//line testdata/templates/integration.qtpl:27
 	{
-		//line testdata/templates/integration.qtpl:22
+		//line testdata/templates/integration.qtpl:27
 		qb422016 := qt422016.AcquireByteBuffer()
-		//line testdata/templates/integration.qtpl:22
+		//line testdata/templates/integration.qtpl:27
 		writeembeddedFunc(qb422016, p)
-		//line testdata/templates/integration.qtpl:22
+		//line testdata/templates/integration.qtpl:27
 		qw422016.E().JZ(qb422016.B)
-		//line testdata/templates/integration.qtpl:22
+		//line testdata/templates/integration.qtpl:27
 		qt422016.ReleaseByteBuffer(qb422016)
-		//line testdata/templates/integration.qtpl:22
+		//line testdata/templates/integration.qtpl:27
 	}
-	//line testdata/templates/integration.qtpl:22
+	//line testdata/templates/integration.qtpl:27
 	qw422016.N().S(`
 
 	Html-escaped output tags:
 	<ul>
 		<li>`)
-	//line testdata/templates/integration.qtpl:26
+	//line testdata/templates/integration.qtpl:31
 	qw422016.E().S("<b>html-escaped `string</b>")
-	//line testdata/templates/integration.qtpl:26
+	//line testdata/templates/integration.qtpl:31
 	qw422016.N().S(`</li>
 		<li>`)
-	//line testdata/templates/integration.qtpl:27
+	//line testdata/templates/integration.qtpl:32
 	qw422016.E().Z([]byte("<b>html-escaped `byte slice</b>"))
-	//line testdata/templates/integration.qtpl:27
+	//line testdata/templates/integration.qtpl:32
 	qw422016.N().S(`</li>
 		<li>Int: `)
-	//line testdata/templates/integration.qtpl:28
+	//line testdata/templates/integration.qtpl:33
 	qw422016.N().D(42)
-	//line testdata/templates/integration.qtpl:28
+	//line testdata/templates/integration.qtpl:33
+	qw422016.N().S(`</li>
+		<li>Grouped int: `)
+	//line testdata/templates/integration.qtpl:34
+	qw422016.N().DN(1234567)
+	//line testdata/templates/integration.qtpl:34
+	qw422016.N().S(` `)
+	//line testdata/templates/integration.qtpl:34
+	qw422016.N().DN(-1000)
+	//line testdata/templates/integration.qtpl:34
+	qw422016.N().S(` `)
+	//line testdata/templates/integration.qtpl:34
+	qw422016.N().DN(0)
+	//line testdata/templates/integration.qtpl:34
+	qw422016.N().S(` `)
+	//line testdata/templates/integration.qtpl:34
+	qw422016.E().DNSep(1234567, ".")
+	//line testdata/templates/integration.qtpl:34
+	qw422016.N().S(` `)
+	//line testdata/templates/integration.qtpl:34
+	qw422016.E().DNSep(1234567, "'")
+	//line testdata/templates/integration.qtpl:34
 	qw422016.N().S(`</li>
 		<li>Float: `)
-	//line testdata/templates/integration.qtpl:29
+	//line testdata/templates/integration.qtpl:35
 	qw422016.N().F(3.14)
-	//line testdata/templates/integration.qtpl:29
+	//line testdata/templates/integration.qtpl:35
 	qw422016.N().S(`</li>
 		<li>`)
-	//line testdata/templates/integration.qtpl:30
+	//line testdata/templates/integration.qtpl:36
 	qw422016.E().Q(`<quoted> "json"
 				string`)
-	//line testdata/templates/integration.qtpl:31
+	//line testdata/templates/integration.qtpl:37
 	qw422016.N().S(`</li>
 		<li>alert("foo `)
-	//line testdata/templates/integration.qtpl:32
+	//line testdata/templates/integration.qtpl:38
 	qw422016.E().J(`"json"-safe
 				<string>`)
-	//line testdata/templates/integration.qtpl:33
+	//line testdata/templates/integration.qtpl:39
 	qw422016.N().S(` aa" + 'bar `)
-	//line testdata/templates/integration.qtpl:33
+	//line testdata/templates/integration.qtpl:39
 	qw422016.E().J(`';alert("evil")</script>`)
-	//line testdata/templates/integration.qtpl:33
+	//line testdata/templates/integration.qtpl:39
 	qw422016.N().S(`')</li>
 		<li><a href="?`)
-	//line testdata/templates/integration.qtpl:34
+	//line testdata/templates/integration.qtpl:40
 	qw422016.N().U("ключ")
-	//line testdata/templates/integration.qtpl:34
+	//line testdata/templates/integration.qtpl:40
 	qw422016.N().S(`=`)
-	//line testdata/templates/integration.qtpl:34
+	//line testdata/templates/integration.qtpl:40
 	qw422016.N().U("значение&=?123")
-	//line testdata/templates/integration.qtpl:34
+	//line testdata/templates/integration.qtpl:40
 	qw422016.N().S(`">test</a></li>
 		<li>`)
-	//line testdata/templates/integration.qtpl:35
+	//line testdata/templates/integration.qtpl:41
 	qw422016.E().V(struct{ A string }{A: "<b>foobar`</b>"})
-	//line testdata/templates/integration.qtpl:35
+	//line testdata/templates/integration.qtpl:41
 	qw422016.N().S(`</li>
 	</ul>
 
 	Output tags without html escaping
 	<ul>
 		<li>`)
-	//line testdata/templates/integration.qtpl:40
+	//line testdata/templates/integration.qtpl:46
 	qw422016.N().S("<b>html-escaped `string</b>")
-	//line testdata/templates/integration.qtpl:40
+	//line testdata/templates/integration.qtpl:46
 	qw422016.N().S(`</li>
 		<li>`)
-	//line testdata/templates/integration.qtpl:41
+	//line testdata/templates/integration.qtpl:47
 	qw422016.N().Z([]byte("<b>html-escaped `byte slice</b>"))
-	//line testdata/templates/integration.qtpl:41
+	//line testdata/templates/integration.qtpl:47
 	qw422016.N().S(`</li>
 		<li>Int: `)
-	//line testdata/templates/integration.qtpl:42
+	//line testdata/templates/integration.qtpl:48
 	qw422016.N().D(42)
-	//line testdata/templates/integration.qtpl:42
+	//line testdata/templates/integration.qtpl:48
 	qw422016.N().S(`</li>
 		<li>Float: `)
-	//line testdata/templates/integration.qtpl:43
+	//line testdata/templates/integration.qtpl:49
 	qw422016.N().F(3.14)
-	//line testdata/templates/integration.qtpl:43
+	//line testdata/templates/integration.qtpl:49
 	qw422016.N().S(`</li>
 		<li>`)
-	//line testdata/templates/integration.qtpl:44
+	//line testdata/templates/integration.qtpl:50
 	qw422016.N().Q(`<quoted> "json"
 				string`)
-	//line testdata/templates/integration.qtpl:45
+	//line testdata/templates/integration.qtpl:51
 	qw422016.N().S(`</li>
 		<li>alert("foo `)
-	//line testdata/templates/integration.qtpl:46
+	//line testdata/templates/integration.qtpl:52
 	qw422016.N().J(`"json"-safe
 				<string>`)
-	//line testdata/templates/integration.qtpl:47
+	//line testdata/templates/integration.qtpl:53
 	qw422016.N().S(` aa" + 'bar `)
-	//line testdata/templates/integration.qtpl:47
+	//line testdata/templates/integration.qtpl:53
 	qw422016.N().J(`';alert("evil")</script>`)
-	//line testdata/templates/integration.qtpl:47
+	//line testdata/templates/integration.qtpl:53
 	qw422016.N().S(`')</li>
 		<li><a href="?`)
-	//line testdata/templates/integration.qtpl:48
+	//line testdata/templates/integration.qtpl:54
 	qw422016.N().U("ключ")
-	//line testdata/templates/integration.qtpl:48
+	//line testdata/templates/integration.qtpl:54
 	qw422016.N().S(`=`)
-	//line testdata/templates/integration.qtpl:48
+	//line testdata/templates/integration.qtpl:54
 	qw422016.N().U("значение&=?123")
-	//line testdata/templates/integration.qtpl:48
+	//line testdata/templates/integration.qtpl:54
 	qw422016.N().S(`">test</a></li>
 		<li>`)
-	//line testdata/templates/integration.qtpl:49
+	//line testdata/templates/integration.qtpl:55
 	qw422016.N().V(struct{ A string }{A: "<b>foobar`</b>"})
-	//line testdata/templates/integration.qtpl:49
+	//line testdata/templates/integration.qtpl:55
 	qw422016.N().S(`</li>
 	</ul>
 
 	`)
-	//line testdata/templates/integration.qtpl:52
+	//line testdata/templates/integration.qtpl:58
 	qw422016.N().S(`Strip space`)
-	//line testdata/templates/integration.qtpl:53
+	//line testdata/templates/integration.qtpl:59
 	qw422016.N().S(` `)
-	//line testdata/templates/integration.qtpl:53
+	//line testdata/templates/integration.qtpl:59
 	qw422016.N().S(`between lines and tags`)
-	//line testdata/templates/integration.qtpl:55
+	//line testdata/templates/integration.qtpl:61
 	qw422016.N().S(`
 			Tags aren't parsed {%inside %}
 			plain
 		`)
-	//line testdata/templates/integration.qtpl:59
+	//line testdata/templates/integration.qtpl:65
 	// one-liner comment
 
-	//line testdata/templates/integration.qtpl:61
+	//line testdata/templates/integration.qtpl:67
 	// multi-line
 	// comment
 
-	//line testdata/templates/integration.qtpl:65
+	//line testdata/templates/integration.qtpl:71
 	/*
 	  yet another
 	  multi-line comment
 	*/
 
-	//line testdata/templates/integration.qtpl:70
+	//line testdata/templates/integration.qtpl:76
 	qw422016.N().S(`
 
 	`)
-	//line testdata/templates/integration.qtpl:72
+	//line testdata/templates/integration.qtpl:78
 	qw422016.N().S(` Collapse space `)
-	//line testdata/templates/integration.qtpl:73
+	//line testdata/templates/integration.qtpl:79
 	qw422016.N().S(` `)
-	//line testdata/templates/integration.qtpl:73
+	//line testdata/templates/integration.qtpl:79
 	qw422016.N().S(` between `)
-	//line testdata/templates/integration.qtpl:74
+	//line testdata/templates/integration.qtpl:80
 	qw422016.N().S(`
 `)
-	//line testdata/templates/integration.qtpl:74
+	//line testdata/templates/integration.qtpl:80
 	qw422016.N().S(` lines and tags `)
-	//line testdata/templates/integration.qtpl:78
+	//line testdata/templates/integration.qtpl:84
 	qw422016.N().S(` `)
-	//line testdata/templates/integration.qtpl:80
+	//line testdata/templates/integration.qtpl:86
 	for _, s := range []string{"foo", "bar", "baz"} {
-		//line testdata/templates/integration.qtpl:80
+		//line testdata/templates/integration.qtpl:86
 		qw422016.N().S(` `)
-		//line testdata/templates/integration.qtpl:81
+		//line testdata/templates/integration.qtpl:87
 		if s == "bar" {
-			//line testdata/templates/integration.qtpl:81
+			//line testdata/templates/integration.qtpl:87
 			qw422016.N().S(` Bar `)
-			//line testdata/templates/integration.qtpl:83
+			//line testdata/templates/integration.qtpl:89
 		} else if s == "baz" {
-			//line testdata/templates/integration.qtpl:83
+			//line testdata/templates/integration.qtpl:89
 			qw422016.N().S(` Baz `)
-			//line testdata/templates/integration.qtpl:85
+			//line testdata/templates/integration.qtpl:91
 			break
-			//line testdata/templates/integration.qtpl:86
+			//line testdata/templates/integration.qtpl:92
 		} else {
-			//line testdata/templates/integration.qtpl:86
+			//line testdata/templates/integration.qtpl:92
 			qw422016.N().S(` `)
-			//line testdata/templates/integration.qtpl:87
+			//line testdata/templates/integration.qtpl:93
 			if s == "never" {
-				//line testdata/templates/integration.qtpl:87
+				//line testdata/templates/integration.qtpl:93
 				qw422016.N().S(` `)
-				//line testdata/templates/integration.qtpl:88
+				//line testdata/templates/integration.qtpl:94
 				return
-				//line testdata/templates/integration.qtpl:89
+				//line testdata/templates/integration.qtpl:95
 			}
-			//line testdata/templates/integration.qtpl:89
+			//line testdata/templates/integration.qtpl:95
 			qw422016.N().S(` `)
-			//line testdata/templates/integration.qtpl:91
+			//line testdata/templates/integration.qtpl:97
 			switch s {
-			//line testdata/templates/integration.qtpl:92
+			//line testdata/templates/integration.qtpl:98
 			case "foobar":
-				//line testdata/templates/integration.qtpl:92
+				//line testdata/templates/integration.qtpl:98
 				qw422016.N().S(` s = foobar `)
-			//line testdata/templates/integration.qtpl:94
+			//line testdata/templates/integration.qtpl:100
 			case "barbaz":
-				//line testdata/templates/integration.qtpl:94
+				//line testdata/templates/integration.qtpl:100
 				qw422016.N().S(` s = barbaz `)
-			//line testdata/templates/integration.qtpl:96
+			//line testdata/templates/integration.qtpl:102
 			default:
-				//line testdata/templates/integration.qtpl:96
+				//line testdata/templates/integration.qtpl:102
 				qw422016.N().S(` s = `)
-				//line testdata/templates/integration.qtpl:97
+				//line testdata/templates/integration.qtpl:103
 				qw422016.E().S(s)
-				//line testdata/templates/integration.qtpl:97
+				//line testdata/templates/integration.qtpl:103
 				qw422016.N().S(` `)
-				//line testdata/templates/integration.qtpl:98
+				//line testdata/templates/integration.qtpl:104
 			}
-			//line testdata/templates/integration.qtpl:98
+			//line testdata/templates/integration.qtpl:104
 			qw422016.N().S(` `)
-			//line testdata/templates/integration.qtpl:100
+			//line testdata/templates/integration.qtpl:106
 			continue
-			//line testdata/templates/integration.qtpl:101
+			//line testdata/templates/integration.qtpl:107
 		}
-		//line testdata/templates/integration.qtpl:101
+		//line testdata/templates/integration.qtpl:107
 		qw422016.N().S(` `)
-		//line testdata/templates/integration.qtpl:102
+		//line testdata/templates/integration.qtpl:108
 	}
-	//line testdata/templates/integration.qtpl:102
+	//line testdata/templates/integration.qtpl:108
 	qw422016.N().S(` `)
-	//line testdata/templates/integration.qtpl:103
+	//line testdata/templates/integration.qtpl:109
 	qw422016.N().S(`
 
+	Nested func closures:
 	`)
-	//line testdata/templates/integration.qtpl:105
-	qw422016.N().S(`This is a template for integration test.
-It should contains all the quicktemplate stuff.
+	//line testdata/templates/integration.qtpl:112
+	streamli := func(qw422016 *qt422016.Writer, i int, s string) {
+		//line testdata/templates/integration.qtpl:112
+		qw422016.N().S(`<li>`)
+		//line testdata/templates/integration.qtpl:112
+		qw422016.N().D(i)
+		//line testdata/templates/integration.qtpl:112
+		qw422016.N().S(`: `)
+		//line testdata/templates/integration.qtpl:112
+		qw422016.E().S(s)
+		//line testdata/templates/integration.qtpl:112
+		qw422016.N().S(`</li>`)
+		//line testdata/templates/integration.qtpl:112
+	}
+	//line testdata/templates/integration.qtpl:112
+	writeli := func(qq422016 qtio422016.Writer, i int, s string) {
+		//line testdata/templates/integration.qtpl:112
+		qw422016 := qt422016.AcquireWriter(qq422016)
+		//line testdata/templates/integration.qtpl:112
+		streamli(qw422016, i, s)
+		//line testdata/templates/integration.qtpl:112
+		qt422016.ReleaseWriter(qw422016)
+		//line testdata/templates/integration.qtpl:112
+	}
+	//line testdata/templates/integration.qtpl:112
+	_ = streamli
+	//line testdata/templates/integration.qtpl:112
+	_ = writeli
+	//line testdata/templates/integration.qtpl:112
+	qw422016.N().S(`
+	<ul>
+	`)
+	//line testdata/templates/integration.qtpl:114
+	for i, s := range []string{"foo", "<bar>"} {
+		//line testdata/templates/integration.qtpl:114
+		qw422016.N().S(`
+		`)
+		//line testdata/templates/integration.qtpl:115
+		streamli(qw422016, i, s)
+		//line testdata/templates/integration.qtpl:115
+		qw422016.N().S(`
+		`)
+		//line testdata/templates/integration.qtpl:116
+		{
+			//line testdata/templates/integration.qtpl:116
+			qb422016 := qt422016.AcquireByteBuffer()
+			//line testdata/templates/integration.qtpl:116
+			writeli(qb422016, i, s)
+			//line testdata/templates/integration.qtpl:116
+			qw422016.E().Z(qb422016.B)
+			//line testdata/templates/integration.qtpl:116
+			qt422016.ReleaseByteBuffer(qb422016)
+			//line testdata/templates/integration.qtpl:116
+		}
+		//line testdata/templates/integration.qtpl:116
+		qw422016.N().S(`
+	`)
+		//line testdata/templates/integration.qtpl:117
+	}
+	//line testdata/templates/integration.qtpl:117
+	qw422016.N().S(`
+	</ul>
 
-{% import "fmt" %}
+	Multiple return values:
+	`)
+	//line testdata/templates/integration.qtpl:121
+	m := map[string]string{"foo": "<foo>"}
 
-{% func Integration() %}
-	Output tags`)
-	//line testdata/templates/integration.qtpl:105
-	qw422016.N().S("`")
-	//line testdata/templates/integration.qtpl:105
-	qw422016.N().S(` verification.
+	//line testdata/templates/integration.qtpl:121
+	qw422016.N().S(`
+	`)
+	//line testdata/templates/integration.qtpl:122
+	{
+		//line testdata/templates/integration.qtpl:122
+		qv422016, _ := lookup(m, "foo")
+		//line testdata/templates/integration.qtpl:122
+		qw422016.E().S(qv422016)
+		//line testdata/templates/integration.qtpl:122
+	}
+	//line testdata/templates/integration.qtpl:122
+	qw422016.N().S(`, `)
+	//line testdata/templates/integration.qtpl:122
+	{
+		//line testdata/templates/integration.qtpl:122
+		qv422016, _ := lookup(m, "foo")
+		//line testdata/templates/integration.qtpl:122
+		qw422016.N().S(qv422016)
+		//line testdata/templates/integration.qtpl:122
+	}
+	//line testdata/templates/integration.qtpl:122
+	qw422016.N().S(`, `)
+	//line testdata/templates/integration.qtpl:122
+	{
+		//line testdata/templates/integration.qtpl:122
+		qv422016, _ := m["foo"]
+		//line testdata/templates/integration.qtpl:122
+		qw422016.N().S(qv422016)
+		//line testdata/templates/integration.qtpl:122
+	}
+	//line testdata/templates/integration.qtpl:122
+	qw422016.N().S(`, [`)
+	//line testdata/templates/integration.qtpl:122
+	{
+		//line testdata/templates/integration.qtpl:122
+		qv422016, _ := lookup(m, "bar")
+		//line testdata/templates/integration.qtpl:122
+		qw422016.E().S(qv422016)
+		//line testdata/templates/integration.qtpl:122
+	}
+	//line testdata/templates/integration.qtpl:122
+	qw422016.N().S(`]
 
-	{% code
-		p := &integrationPage{
-			S: "foobar",
-		}
-	%}
-	Embedded func template:
-		plain: {%= embeddedFunc(p) %}
-		html-escaped: {%=h embeddedFunc(p) %}
-		url-escaped: {%=u embeddedFunc(p) %}
-		quoted json string: {%=q embeddedFunc(p) %}
-		unquoted json string: {%=j embeddedFunc(p) %}
-		html-escaped url-escaped: {%=uh embeddedFunc(p) %}
-		html-escaped quoted json string: {%=qh embeddedFunc(p) %}
-		html-escaped unquoted json string: {%=jh embeddedFunc(p) %}
+	Safe dereference:
+	`)
+	//line testdata/templates/integration.qtpl:126
+	var nilUser *integrationUser
+	user := &integrationUser{Profile: &integrationProfile{Name: "<John>", Age: 42}}
+	noProfile := &integrationUser{}
 
-	Html-escaped output tags:
-	<ul>
-		<li>{%s "<b>html-escaped `)
-	//line testdata/templates/integration.qtpl:105
-	qw422016.N().S("`")
-	//line testdata/templates/integration.qtpl:105
-	qw422016.N().S(`string</b>" %}</li>
-		<li>{%z []byte("<b>html-escaped `)
-	//line testdata/templates/integration.qtpl:105
-	qw422016.N().S("`")
-	//line testdata/templates/integration.qtpl:105
-	qw422016.N().S(`byte slice</b>") %}</li>
-		<li>Int: {%d 42 %}</li>
-		<li>Float: {%f 3.14 %}</li>
-		<li>{%q `)
-	//line testdata/templates/integration.qtpl:105
-	qw422016.N().S("`")
-	//line testdata/templates/integration.qtpl:105
-	qw422016.N().S(`<quoted> "json"
-				string`)
-	//line testdata/templates/integration.qtpl:105
-	qw422016.N().S("`")
-	//line testdata/templates/integration.qtpl:105
-	qw422016.N().S(` %}</li>
-		<li>alert("foo {%j `)
-	//line testdata/templates/integration.qtpl:105
-	qw422016.N().S("`")
-	//line testdata/templates/integration.qtpl:105
-	qw422016.N().S(`"json"-safe
-				<string>`)
-	//line testdata/templates/integration.qtpl:105
-	qw422016.N().S("`")
-	//line testdata/templates/integration.qtpl:105
-	qw422016.N().S(` %} aa" + 'bar {%j `)
-	//line testdata/templates/integration.qtpl:105
-	qw422016.N().S("`")
-	//line testdata/templates/integration.qtpl:105
-	qw422016.N().S(`';alert("evil")</script>`)
-	//line testdata/templates/integration.qtpl:105
-	qw422016.N().S("`")
-	//line testdata/templates/integration.qtpl:105
-	qw422016.N().S(` %}')</li>
-		<li><a href="?{%u "ключ" %}={%u "значение&=?123" %}">test</a></li>
-		<li>{%v struct{ A string }{A: "<b>foobar`)
-	//line testdata/templates/integration.qtpl:105
-	qw422016.N().S("`")
-	//line testdata/templates/integration.qtpl:105
-	qw422016.N().S(`</b>"} %}</li>
-	</ul>
+	//line testdata/templates/integration.qtpl:129
+	qw422016.N().S(`
+	[`)
+	//line testdata/templates/integration.qtpl:130
+	if nilUser != nil && nilUser.Profile != nil {
+		//line testdata/templates/integration.qtpl:130
+		qw422016.E().S(nilUser.Profile.Name)
+		//line testdata/templates/integration.qtpl:130
+	}
+	//line testdata/templates/integration.qtpl:130
+	qw422016.N().S(`] [`)
+	//line testdata/templates/integration.qtpl:130
+	if noProfile != nil && noProfile.Profile != nil {
+		//line testdata/templates/integration.qtpl:130
+		qw422016.E().S(noProfile.Profile.Name)
+		//line testdata/templates/integration.qtpl:130
+	}
+	//line testdata/templates/integration.qtpl:130
+	qw422016.N().S(`] [`)
+	//line testdata/templates/integration.qtpl:130
+	if noProfile != nil && noProfile.Profile != nil {
+		//line testdata/templates/integration.qtpl:130
+		qw422016.N().D(noProfile.Profile.Age)
+		//line testdata/templates/integration.qtpl:130
+	}
+	//line testdata/templates/integration.qtpl:130
+	qw422016.N().S(`]
+	[`)
+	//line testdata/templates/integration.qtpl:131
+	if user != nil && user.Profile != nil {
+		//line testdata/templates/integration.qtpl:131
+		qw422016.E().S(user.Profile.Name)
+		//line testdata/templates/integration.qtpl:131
+	}
+	//line testdata/templates/integration.qtpl:131
+	qw422016.N().S(`] [`)
+	//line testdata/templates/integration.qtpl:131
+	if user != nil && user.Profile != nil {
+		//line testdata/templates/integration.qtpl:131
+		qw422016.N().S(user.Profile.Name)
+		//line testdata/templates/integration.qtpl:131
+	}
+	//line testdata/templates/integration.qtpl:131
+	qw422016.N().S(`] [`)
+	//line testdata/templates/integration.qtpl:131
+	if user != nil && user.Profile != nil {
+		//line testdata/templates/integration.qtpl:131
+		qw422016.N().D(user.Profile.Age)
+		//line testdata/templates/integration.qtpl:131
+	}
+	//line testdata/templates/integration.qtpl:131
+	qw422016.N().S(`]
 
-	Output tags without html escaping
-	<ul>
-		<li>{%s= "<b>html-escaped `)
-	//line testdata/templates/integration.qtpl:105
-	qw422016.N().S("`")
-	//line testdata/templates/integration.qtpl:105
-	qw422016.N().S(`string</b>" %}</li>
-		<li>{%z= []byte("<b>html-escaped `)
-	//line testdata/templates/integration.qtpl:105
-	qw422016.N().S("`")
-	//line testdata/templates/integration.qtpl:105
-	qw422016.N().S(`byte slice</b>") %}</li>
-		<li>Int: {%d= 42 %}</li>
-		<li>Float: {%f= 3.14 %}</li>
-		<li>{%q= `)
-	//line testdata/templates/integration.qtpl:105
-	qw422016.N().S("`")
-	//line testdata/templates/integration.qtpl:105
-	qw422016.N().S(`<quoted> "json"
-				string`)
-	//line testdata/templates/integration.qtpl:105
+	If with init statement:
+	`)
+	//line testdata/templates/integration.qtpl:134
+	counts := map[string]int{"foo": 1}
+
+	//line testdata/templates/integration.qtpl:134
+	qw422016.N().S(`
+	`)
+	//line testdata/templates/integration.qtpl:135
+	for _, k := range []string{"foo", "bar", "baz"} {
+		//line testdata/templates/integration.qtpl:135
+		qw422016.N().S(`
+		`)
+		//line testdata/templates/integration.qtpl:136
+		if n, ok := counts[k]; ok {
+			//line testdata/templates/integration.qtpl:136
+			qw422016.N().S(`
+			`)
+			//line testdata/templates/integration.qtpl:137
+			qw422016.E().S(k)
+			//line testdata/templates/integration.qtpl:137
+			qw422016.N().S(`=`)
+			//line testdata/templates/integration.qtpl:137
+			qw422016.N().D(n)
+			//line testdata/templates/integration.qtpl:137
+			qw422016.N().S(`
+		`)
+			//line testdata/templates/integration.qtpl:138
+		} else if n := len(k); k == "bar" {
+			//line testdata/templates/integration.qtpl:138
+			qw422016.N().S(`
+			len(`)
+			//line testdata/templates/integration.qtpl:139
+			qw422016.E().S(k)
+			//line testdata/templates/integration.qtpl:139
+			qw422016.N().S(`)=`)
+			//line testdata/templates/integration.qtpl:139
+			qw422016.N().D(n)
+			//line testdata/templates/integration.qtpl:139
+			qw422016.N().S(`
+		`)
+			//line testdata/templates/integration.qtpl:140
+		} else {
+			//line testdata/templates/integration.qtpl:140
+			qw422016.N().S(`
+			`)
+			//line testdata/templates/integration.qtpl:141
+			qw422016.E().S(k)
+			//line testdata/templates/integration.qtpl:141
+			qw422016.N().S(` is missing
+		`)
+			//line testdata/templates/integration.qtpl:142
+		}
+		//line testdata/templates/integration.qtpl:142
+		qw422016.N().S(`
+	`)
+		//line testdata/templates/integration.qtpl:143
+	}
+	//line testdata/templates/integration.qtpl:143
+	qw422016.N().S(`
+
+	Assign:
+	`)
+	//line testdata/templates/integration.qtpl:146
+	total := 0
+	//line testdata/templates/integration.qtpl:146
+	qw422016.N().S(`
+	`)
+	//line testdata/templates/integration.qtpl:147
+	for _, n := range []int{1, 2, 3} {
+		//line testdata/templates/integration.qtpl:147
+		qw422016.N().S(`
+		`)
+		//line testdata/templates/integration.qtpl:148
+		sq := n * n
+		//line testdata/templates/integration.qtpl:148
+		qw422016.N().S(`
+		`)
+		//line testdata/templates/integration.qtpl:149
+		total = total + sq
+		//line testdata/templates/integration.qtpl:149
+		qw422016.N().S(`
+		`)
+		//line testdata/templates/integration.qtpl:150
+		qw422016.N().D(n)
+		//line testdata/templates/integration.qtpl:150
+		qw422016.N().S(`^2=`)
+		//line testdata/templates/integration.qtpl:150
+		qw422016.N().D(sq)
+		//line testdata/templates/integration.qtpl:150
+		qw422016.N().S(`
+	`)
+		//line testdata/templates/integration.qtpl:151
+	}
+	//line testdata/templates/integration.qtpl:151
+	qw422016.N().S(`
+	total=`)
+	//line testdata/templates/integration.qtpl:152
+	qw422016.N().D(total)
+	//line testdata/templates/integration.qtpl:152
+	qw422016.N().S(`
+
+	Stream-only func:
+	`)
+	//line testdata/templates/integration.qtpl:155
+	streamintegrationStream(qw422016, "<foo>")
+	//line testdata/templates/integration.qtpl:155
+	qw422016.N().S(`
+
+	Package code:
+	`)
+	//line testdata/templates/integration.qtpl:160
+	qw422016.N().S(`
+	`)
+	//line testdata/templates/integration.qtpl:161
+	qw422016.N().D(integrationCounts["{%"])
+	//line testdata/templates/integration.qtpl:161
+	qw422016.N().S(`
+
+	Code block:
+	`)
+	//line testdata/templates/integration.qtpl:164
+
+	braces := map[string]string{
+		"open":  "{%",
+		"close": "%}",
+	}
+
+	//line testdata/templates/integration.qtpl:169
+	qw422016.N().S(`
+	`)
+	//line testdata/templates/integration.qtpl:170
+	qw422016.E().S(braces["open"])
+	//line testdata/templates/integration.qtpl:170
+	qw422016.N().S(` `)
+	//line testdata/templates/integration.qtpl:170
+	qw422016.E().S(braces["close"])
+	//line testdata/templates/integration.qtpl:170
+	qw422016.N().S(`
+
+	Explicit space and newline in stripspace:
+	`)
+	//line testdata/templates/integration.qtpl:173
+	qw422016.N().S(`[`)
+	//line testdata/templates/integration.qtpl:175
+	qw422016.N().S(` `)
+	//line testdata/templates/integration.qtpl:175
+	qw422016.N().S(`][`)
+	//line testdata/templates/integration.qtpl:177
+	qw422016.N().S(`
+`)
+	//line testdata/templates/integration.qtpl:177
+	qw422016.N().S(`]`)
+	//line testdata/templates/integration.qtpl:178
+	qw422016.N().S(`
+
+	Strip newlines:
+	`)
+	//line testdata/templates/integration.qtpl:181
+	qw422016.N().S(`	<pre>		  indented  `)
+	//line testdata/templates/integration.qtpl:183
+	qw422016.E().S("line")
+	//line testdata/templates/integration.qtpl:183
+	qw422016.N().S(`	`)
+	//line testdata/templates/integration.qtpl:184
+	qw422016.N().S(`
+`)
+	//line testdata/templates/integration.qtpl:184
+	qw422016.N().S(`</pre>	`)
+	//line testdata/templates/integration.qtpl:185
+	qw422016.N().S(`
+
+	Spaceless:
+	`)
+	//line testdata/templates/integration.qtpl:188
+	qw422016.N().S(`
+	<ul><li>hello   world</li>`)
+	//line testdata/templates/integration.qtpl:191
+	for i := 0; i < 2; i++ {
+		//line testdata/templates/integration.qtpl:191
+		qw422016.N().S(`<li>`)
+		//line testdata/templates/integration.qtpl:192
+		qw422016.N().S(` `)
+		//line testdata/templates/integration.qtpl:192
+		qw422016.N().D(i)
+		//line testdata/templates/integration.qtpl:192
+		qw422016.N().S(` </li>`)
+		//line testdata/templates/integration.qtpl:193
+	}
+	//line testdata/templates/integration.qtpl:193
+	qw422016.N().S(`</ul>`)
+	//line testdata/templates/integration.qtpl:195
+	qw422016.N().S(`
+
+	Break and continue outer loops:
+	`)
+qfor422016_6:
+	//line testdata/templates/integration.qtpl:199
+	for i := 0; i < 3; i++ {
+		//line testdata/templates/integration.qtpl:200
+		for j := 0; j < 3; j++ {
+			//line testdata/templates/integration.qtpl:201
+			if j > i {
+				//line testdata/templates/integration.qtpl:201
+				continue qfor422016_6
+				//line testdata/templates/integration.qtpl:201
+			}
+			//line testdata/templates/integration.qtpl:202
+			if i == 2 {
+				//line testdata/templates/integration.qtpl:202
+				break qfor422016_6
+				//line testdata/templates/integration.qtpl:202
+			}
+			//line testdata/templates/integration.qtpl:202
+			qw422016.N().S(`[`)
+			//line testdata/templates/integration.qtpl:203
+			qw422016.N().D(i)
+			//line testdata/templates/integration.qtpl:203
+			qw422016.N().D(j)
+			//line testdata/templates/integration.qtpl:203
+			qw422016.N().S(`]`)
+			//line testdata/templates/integration.qtpl:204
+		}
+		//line testdata/templates/integration.qtpl:205
+	}
+	//line testdata/templates/integration.qtpl:206
+	qw422016.N().S(`
+
+	Unless:
+	`)
+	//line testdata/templates/integration.qtpl:209
+	for _, n := range []int{-1, 0, 1} {
+		//line testdata/templates/integration.qtpl:209
+		qw422016.N().S(`
+		`)
+		//line testdata/templates/integration.qtpl:210
+		if !(n > 0 || n < 0) {
+			//line testdata/templates/integration.qtpl:210
+			qw422016.N().S(`zero`)
+			//line testdata/templates/integration.qtpl:210
+		} else {
+			//line testdata/templates/integration.qtpl:210
+			qw422016.N().D(n)
+			//line testdata/templates/integration.qtpl:210
+		}
+		//line testdata/templates/integration.qtpl:210
+		qw422016.N().S(`
+	`)
+		//line testdata/templates/integration.qtpl:211
+	}
+	//line testdata/templates/integration.qtpl:211
+	qw422016.N().S(`
+
+	Conditional output:
+	`)
+	//line testdata/templates/integration.qtpl:214
+	for _, n := range []int{-2, 3} {
+		//line testdata/templates/integration.qtpl:214
+		qw422016.N().S(`
+		`)
+		//line testdata/templates/integration.qtpl:215
+		if n < 0 {
+			//line testdata/templates/integration.qtpl:215
+			qw422016.E().S("negative")
+			//line testdata/templates/integration.qtpl:215
+		} else {
+			//line testdata/templates/integration.qtpl:215
+			qw422016.E().S("positive")
+			//line testdata/templates/integration.qtpl:215
+		}
+		//line testdata/templates/integration.qtpl:215
+		qw422016.N().S(` `)
+		//line testdata/templates/integration.qtpl:215
+		if n < 0 {
+			//line testdata/templates/integration.qtpl:215
+			qw422016.N().D(-n)
+			//line testdata/templates/integration.qtpl:215
+		} else {
+			//line testdata/templates/integration.qtpl:215
+			qw422016.N().D(n)
+			//line testdata/templates/integration.qtpl:215
+		}
+		//line testdata/templates/integration.qtpl:215
+		qw422016.N().S(` `)
+		//line testdata/templates/integration.qtpl:215
+		qw422016.E().S("a?b:c")
+		//line testdata/templates/integration.qtpl:215
+		qw422016.N().S(`
+	`)
+		//line testdata/templates/integration.qtpl:216
+	}
+	//line testdata/templates/integration.qtpl:216
+	qw422016.N().S(`
+
+	Attribute value:
+	<a title="`)
+	//line testdata/templates/integration.qtpl:219
+	qw422016.N().A(`say "hi" 'there'`)
+	//line testdata/templates/integration.qtpl:219
+	qw422016.N().S(`" data-x=`)
+	//line testdata/templates/integration.qtpl:219
+	qw422016.N().AZ([]byte("a b=c"))
+	//line testdata/templates/integration.qtpl:219
+	qw422016.N().S(`>
+
+	JS string:
+	<script>var s = "`)
+	//line testdata/templates/integration.qtpl:222
+	qw422016.N().JS("</script>\n" + `\`)
+	//line testdata/templates/integration.qtpl:222
+	qw422016.N().S(`";</script>
+
+	CSS value:
+	<p style="color: `)
+	//line testdata/templates/integration.qtpl:225
+	qw422016.N().CSS("red}body{color:blue;/*")
+	//line testdata/templates/integration.qtpl:225
+	qw422016.N().S(`">
+
+	Stringer value:
+	`)
+	//line testdata/templates/integration.qtpl:228
+	qw422016.E().S(integrationTag("<b>").String())
+	//line testdata/templates/integration.qtpl:228
+	qw422016.N().S(` `)
+	//line testdata/templates/integration.qtpl:228
+	qw422016.E().V(integrationTag("<b>"))
+	//line testdata/templates/integration.qtpl:228
+	qw422016.N().S(` `)
+	//line testdata/templates/integration.qtpl:228
+	qw422016.N().S(integrationTag("<i>").String())
+	//line testdata/templates/integration.qtpl:228
+	qw422016.N().S(`
+
+	Text and html funcs:
+	`)
+	//line testdata/templates/integration.qtpl:231
+	streamintegrationText(qw422016, "<b>")
+	//line testdata/templates/integration.qtpl:231
+	qw422016.N().S(`
+	`)
+	//line testdata/templates/integration.qtpl:232
+	streamintegrationHTML(qw422016, "<b>")
+	//line testdata/templates/integration.qtpl:232
+	qw422016.N().S(`
+
+	Loop state:
+	`)
+	//line testdata/templates/integration.qtpl:236
+	{
+		//line testdata/templates/integration.qtpl:236
+		qr422016_10 := [][]string{{"a", "b", "c"}, {"d"}}
+		//line testdata/templates/integration.qtpl:236
+		loop := qt422016.NewRangeLoop(qr422016_10, len(qr422016_10))
+		//line testdata/templates/integration.qtpl:236
+		_ = loop
+		//line testdata/templates/integration.qtpl:236
+		for _, row := range qr422016_10 {
+			//line testdata/templates/integration.qtpl:236
+			loop.Next()
+			//line testdata/templates/integration.qtpl:237
+			if loop.First {
+				//line testdata/templates/integration.qtpl:237
+				qw422016.N().S(`[`)
+				//line testdata/templates/integration.qtpl:237
+			}
+			//line testdata/templates/integration.qtpl:238
+			{
+				//line testdata/templates/integration.qtpl:238
+				qr422016_11 := row
+				//line testdata/templates/integration.qtpl:238
+				loop := qt422016.NewRangeLoop(qr422016_11, len(qr422016_11))
+				//line testdata/templates/integration.qtpl:238
+				_ = loop
+				//line testdata/templates/integration.qtpl:238
+				for _, cell := range qr422016_11 {
+					//line testdata/templates/integration.qtpl:238
+					loop.Next()
+					//line testdata/templates/integration.qtpl:239
+					qw422016.N().D(loop.Index)
+					//line testdata/templates/integration.qtpl:239
+					qw422016.N().S(`/`)
+					//line testdata/templates/integration.qtpl:239
+					qw422016.N().D(loop.Len)
+					//line testdata/templates/integration.qtpl:239
+					qw422016.N().S(`=`)
+					//line testdata/templates/integration.qtpl:239
+					qw422016.E().S(cell)
+					//line testdata/templates/integration.qtpl:240
+					if loop.First {
+						//line testdata/templates/integration.qtpl:240
+						qw422016.N().S(`(first)`)
+						//line testdata/templates/integration.qtpl:240
+					}
+					//line testdata/templates/integration.qtpl:241
+					if loop.Last {
+						//line testdata/templates/integration.qtpl:241
+						qw422016.N().S(`(last)`)
+						//line testdata/templates/integration.qtpl:241
+					} else {
+						//line testdata/templates/integration.qtpl:241
+						qw422016.N().S(`,`)
+						//line testdata/templates/integration.qtpl:241
+					}
+					//line testdata/templates/integration.qtpl:242
+				}
+				//line testdata/templates/integration.qtpl:242
+			}
+			//line testdata/templates/integration.qtpl:243
+			if loop.Last {
+				//line testdata/templates/integration.qtpl:243
+				qw422016.N().S(`]`)
+				//line testdata/templates/integration.qtpl:243
+			} else {
+				//line testdata/templates/integration.qtpl:243
+				qw422016.N().S(`;`)
+				//line testdata/templates/integration.qtpl:243
+			}
+			//line testdata/templates/integration.qtpl:244
+		}
+		//line testdata/templates/integration.qtpl:244
+	}
+	//line testdata/templates/integration.qtpl:245
+	qw422016.N().S(`
+
+	Loop state over non-ASCII string:
+	`)
+	//line testdata/templates/integration.qtpl:248
+	{
+		//line testdata/templates/integration.qtpl:248
+		qr422016_12 := "hé!"
+		//line testdata/templates/integration.qtpl:248
+		loop := qt422016.NewRangeLoop(qr422016_12, len(qr422016_12))
+		//line testdata/templates/integration.qtpl:248
+		_ = loop
+		//line testdata/templates/integration.qtpl:248
+		for i, r := range qr422016_12 {
+			//line testdata/templates/integration.qtpl:248
+			loop.Next()
+			//line testdata/templates/integration.qtpl:248
+			qw422016.N().D(loop.Index)
+			//line testdata/templates/integration.qtpl:248
+			qw422016.N().D(i)
+			//line testdata/templates/integration.qtpl:248
+			qw422016.E().S(string(r))
+			//line testdata/templates/integration.qtpl:248
+			qw422016.N().D(loop.Len)
+			//line testdata/templates/integration.qtpl:248
+			if loop.Last {
+				//line testdata/templates/integration.qtpl:248
+				qw422016.N().S(`(last)`)
+				//line testdata/templates/integration.qtpl:248
+			} else {
+				//line testdata/templates/integration.qtpl:248
+				qw422016.N().S(`;`)
+				//line testdata/templates/integration.qtpl:248
+			}
+			//line testdata/templates/integration.qtpl:248
+		}
+		//line testdata/templates/integration.qtpl:248
+	}
+	//line testdata/templates/integration.qtpl:248
+	qw422016.N().S(`
+
+	Switch fallthrough:
+	`)
+	//line testdata/templates/integration.qtpl:252
+	for _, n := range []int{1, 2, 3} {
+		//line testdata/templates/integration.qtpl:252
+		qw422016.N().S(`[`)
+		//line testdata/templates/integration.qtpl:254
+		switch n {
+		//line testdata/templates/integration.qtpl:255
+		case 3:
+			//line testdata/templates/integration.qtpl:255
+			qw422016.N().S(`three`)
+			//line testdata/templates/integration.qtpl:257
+			fallthrough
+		//line testdata/templates/integration.qtpl:258
+		case 2:
+			//line testdata/templates/integration.qtpl:258
+			qw422016.N().S(`two`)
+			//line testdata/templates/integration.qtpl:260
+			fallthrough
+		//line testdata/templates/integration.qtpl:261
+		default:
+			//line testdata/templates/integration.qtpl:261
+			qw422016.N().S(`one`)
+			//line testdata/templates/integration.qtpl:263
+		}
+		//line testdata/templates/integration.qtpl:263
+		qw422016.N().S(`]`)
+		//line testdata/templates/integration.qtpl:265
+	}
+	//line testdata/templates/integration.qtpl:266
+	qw422016.N().S(`
+
+	Counted loops:
+	`)
+	//line testdata/templates/integration.qtpl:269
+	qw422016.N().S(`[`)
+	//line testdata/templates/integration.qtpl:270
+	for i, qend422016 := 0, 3; i < qend422016; i++ {
+		//line testdata/templates/integration.qtpl:270
+		qw422016.N().D(i)
+		//line testdata/templates/integration.qtpl:270
+	}
+	//line testdata/templates/integration.qtpl:270
+	qw422016.N().S(`][`)
+	//line testdata/templates/integration.qtpl:271
+	for i, qend422016 := 1, 4; i < qend422016; i++ {
+		//line testdata/templates/integration.qtpl:271
+		qw422016.N().D(i)
+		//line testdata/templates/integration.qtpl:271
+	}
+	//line testdata/templates/integration.qtpl:271
+	qw422016.N().S(`][`)
+	//line testdata/templates/integration.qtpl:272
+	for i, qend422016 := 0, 10; i < qend422016; i += 2 {
+		//line testdata/templates/integration.qtpl:272
+		qw422016.N().D(i)
+		//line testdata/templates/integration.qtpl:272
+	}
+	//line testdata/templates/integration.qtpl:272
+	qw422016.N().S(`][`)
+	//line testdata/templates/integration.qtpl:273
+	for i, qend422016 := 3, 0; i > qend422016; i += -1 {
+		//line testdata/templates/integration.qtpl:273
+		qw422016.N().D(i)
+		//line testdata/templates/integration.qtpl:273
+	}
+	//line testdata/templates/integration.qtpl:273
+	qw422016.N().S(`][`)
+	//line testdata/templates/integration.qtpl:274
+	for i := range 3 {
+		//line testdata/templates/integration.qtpl:274
+		qw422016.N().D(i)
+		//line testdata/templates/integration.qtpl:274
+	}
+	//line testdata/templates/integration.qtpl:274
+	qw422016.N().S(`][`)
+	//line testdata/templates/integration.qtpl:275
+	{
+		//line testdata/templates/integration.qtpl:275
+		qr422016_19 := 4
+		//line testdata/templates/integration.qtpl:275
+		loop := qt422016.NewLoop(int(qr422016_19))
+		//line testdata/templates/integration.qtpl:275
+		_ = loop
+		//line testdata/templates/integration.qtpl:275
+		for i := range qr422016_19 {
+			//line testdata/templates/integration.qtpl:275
+			loop.Next()
+			//line testdata/templates/integration.qtpl:275
+			qw422016.N().D(i)
+			//line testdata/templates/integration.qtpl:275
+			if !loop.Last {
+				//line testdata/templates/integration.qtpl:275
+				qw422016.N().S(`,`)
+				//line testdata/templates/integration.qtpl:275
+			}
+			//line testdata/templates/integration.qtpl:275
+		}
+		//line testdata/templates/integration.qtpl:275
+	}
+	//line testdata/templates/integration.qtpl:275
+	qw422016.N().S(`]`)
+	//line testdata/templates/integration.qtpl:276
+	qw422016.N().S(`
+
+	Guarded loops:
+	`)
+	//line testdata/templates/integration.qtpl:279
+	qw422016.N().S(`[`)
+	//line testdata/templates/integration.qtpl:280
+	for _, s := range []string{"a", "", "b"} {
+		//line testdata/templates/integration.qtpl:280
+		if !(s != "") {
+			//line testdata/templates/integration.qtpl:280
+			continue
+			//line testdata/templates/integration.qtpl:280
+		}
+		//line testdata/templates/integration.qtpl:280
+		qw422016.E().S(s)
+		//line testdata/templates/integration.qtpl:280
+	}
+	//line testdata/templates/integration.qtpl:280
+	qw422016.N().S(`][`)
+	//line testdata/templates/integration.qtpl:281
+	for i, s := range []string{"a", "", "b"} {
+		//line testdata/templates/integration.qtpl:281
+		if !(s != "") {
+			//line testdata/templates/integration.qtpl:281
+			continue
+			//line testdata/templates/integration.qtpl:281
+		}
+		//line testdata/templates/integration.qtpl:281
+		qw422016.N().D(i)
+		//line testdata/templates/integration.qtpl:281
+		qw422016.N().S(`=`)
+		//line testdata/templates/integration.qtpl:281
+		qw422016.E().S(s)
+		//line testdata/templates/integration.qtpl:281
+	}
+	//line testdata/templates/integration.qtpl:281
+	qw422016.N().S(`][`)
+	//line testdata/templates/integration.qtpl:282
+	for i, qend422016 := 0, 10; i < qend422016; i++ {
+		//line testdata/templates/integration.qtpl:282
+		if !(i%3 == 0) {
+			//line testdata/templates/integration.qtpl:282
+			continue
+			//line testdata/templates/integration.qtpl:282
+		}
+		//line testdata/templates/integration.qtpl:282
+		qw422016.N().D(i)
+		//line testdata/templates/integration.qtpl:282
+	}
+	//line testdata/templates/integration.qtpl:282
+	qw422016.N().S(`]`)
+	//line testdata/templates/integration.qtpl:283
+	qw422016.N().S(`
+
+	Channel loops:
+	`)
+	//line testdata/templates/integration.qtpl:287
+	ch := make(chan string, 3)
+	ch <- "a"
+	ch <- "b"
+	ch <- "c"
+	close(ch)
+
+	//line testdata/templates/integration.qtpl:292
+	qw422016.N().S(`
+	[`)
+	//line testdata/templates/integration.qtpl:293
+	for s := range ch {
+		//line testdata/templates/integration.qtpl:293
+		qw422016.E().S(s)
+		//line testdata/templates/integration.qtpl:293
+	}
+	//line testdata/templates/integration.qtpl:293
+	qw422016.N().S(`]
+
+	Separators:
+	`)
+	//line testdata/templates/integration.qtpl:296
+	qw422016.N().S(`[`)
+	//line testdata/templates/integration.qtpl:297
+	qsep422016_24 := false
+	//line testdata/templates/integration.qtpl:297
+	for _, s := range []string{"a", "b", "c"} {
+		//line testdata/templates/integration.qtpl:297
+		if qsep422016_24 {
+			//line testdata/templates/integration.qtpl:297
+			qw422016.N().S(", ")
+			//line testdata/templates/integration.qtpl:297
+		}
+		//line testdata/templates/integration.qtpl:297
+		qsep422016_24 = true
+		//line testdata/templates/integration.qtpl:297
+		qw422016.E().S(s)
+		//line testdata/templates/integration.qtpl:297
+	}
+	//line testdata/templates/integration.qtpl:297
+	qw422016.N().S(`][`)
+	//line testdata/templates/integration.qtpl:301
+	qsep422016_25 := false
+	//line testdata/templates/integration.qtpl:298
+	for _, row := range [][]string{{"a", "b"}, {"c"}} {
+		//line testdata/templates/integration.qtpl:299
+		if qsep422016_25 {
+			//line testdata/templates/integration.qtpl:299
+			qw422016.N().S("; ")
+			//line testdata/templates/integration.qtpl:299
+		}
+		//line testdata/templates/integration.qtpl:299
+		qsep422016_25 = true
+		//line testdata/templates/integration.qtpl:300
+		qsep422016_26 := false
+		//line testdata/templates/integration.qtpl:300
+		for _, s := range row {
+			//line testdata/templates/integration.qtpl:300
+			if qsep422016_26 {
+				//line testdata/templates/integration.qtpl:300
+				qw422016.N().S(",")
+				//line testdata/templates/integration.qtpl:300
+			}
+			//line testdata/templates/integration.qtpl:300
+			qsep422016_26 = true
+			//line testdata/templates/integration.qtpl:300
+			qw422016.E().S(s)
+			//line testdata/templates/integration.qtpl:300
+		}
+		//line testdata/templates/integration.qtpl:301
+	}
+	//line testdata/templates/integration.qtpl:301
+	qw422016.N().S(`][`)
+	//line testdata/templates/integration.qtpl:306
+	qsep422016_27 := false
+	//line testdata/templates/integration.qtpl:302
+	for i, qend422016 := 0, 6; i < qend422016; i++ {
+		//line testdata/templates/integration.qtpl:303
+		if i%2 == 0 {
+			//line testdata/templates/integration.qtpl:303
+			continue
+			//line testdata/templates/integration.qtpl:303
+		}
+		//line testdata/templates/integration.qtpl:304
+		if qsep422016_27 {
+			//line testdata/templates/integration.qtpl:304
+			qw422016.N().S(" | ")
+			//line testdata/templates/integration.qtpl:304
+		}
+		//line testdata/templates/integration.qtpl:304
+		qsep422016_27 = true
+		//line testdata/templates/integration.qtpl:304
+		qw422016.N().D(i)
+		//line testdata/templates/integration.qtpl:305
+		if i == 3 {
+			//line testdata/templates/integration.qtpl:305
+			break
+			//line testdata/templates/integration.qtpl:305
+		}
+		//line testdata/templates/integration.qtpl:306
+	}
+	//line testdata/templates/integration.qtpl:306
+	qw422016.N().S(`]`)
+	//line testdata/templates/integration.qtpl:307
+	qw422016.N().S(`
+
+	With:
+	`)
+	//line testdata/templates/integration.qtpl:310
+	{
+		//line testdata/templates/integration.qtpl:310
+		s := "<with>"
+		//line testdata/templates/integration.qtpl:310
+		n := len(s)
+		//line testdata/templates/integration.qtpl:310
+		qw422016.E().S(s)
+		//line testdata/templates/integration.qtpl:310
+		qw422016.N().S(` `)
+		//line testdata/templates/integration.qtpl:310
+		qw422016.N().D(n)
+		//line testdata/templates/integration.qtpl:310
+	}
+	//line testdata/templates/integration.qtpl:310
+	qw422016.N().S(`
+
+	Defer:
+	`)
+	//line testdata/templates/integration.qtpl:313
+	var deferLog []string
+
+	//line testdata/templates/integration.qtpl:313
+	streamintegrationDefer(qw422016, &deferLog)
+	//line testdata/templates/integration.qtpl:313
+	qw422016.N().S(` `)
+	//line testdata/templates/integration.qtpl:313
+	qw422016.E().S(fmt.Sprint(deferLog))
+	//line testdata/templates/integration.qtpl:313
+	qw422016.N().S(`
+
+	Func values:
+	`)
+	//line testdata/templates/integration.qtpl:316
+	renderer := func(w io.Writer) { fmt.Fprint(w, "<rendered>") }
+
+	//line testdata/templates/integration.qtpl:316
+	qw422016.N().S(`
+	`)
+	//line testdata/templates/integration.qtpl:317
+	streamintegrationCall(qw422016, renderer)
+	//line testdata/templates/integration.qtpl:317
+	qw422016.N().S(`
+
+	Trim filters:
+	[`)
+	//line testdata/templates/integration.qtpl:320
+	qw422016.E().S(qt422016.Trim("  <b>padded</b>\t "))
+	//line testdata/templates/integration.qtpl:320
+	qw422016.N().S(`] [`)
+	//line testdata/templates/integration.qtpl:320
+	qw422016.N().S(qt422016.TrimSet("./path/.", "./"))
+	//line testdata/templates/integration.qtpl:320
+	qw422016.N().S(`] [`)
+	//line testdata/templates/integration.qtpl:320
+	qw422016.E().Z(qt422016.TrimZ(qt422016.TrimSetZ([]byte("- z -"), "-")))
+	//line testdata/templates/integration.qtpl:320
+	qw422016.N().S(`]
+
+	Multi-line output tags:
+	`)
+	//line testdata/templates/integration.qtpl:323
+	qw422016.N().S(fmt.Sprintf(
+		"%d-%s",
+		42, "<b>"))
+	//line testdata/templates/integration.qtpl:325
+	qw422016.N().S(` `)
+	//line testdata/templates/integration.qtpl:325
+	qw422016.N().D(len(
+		"four"))
+	//line testdata/templates/integration.qtpl:326
+	qw422016.N().S(`
+
+	Multi-line func signature:
+	`)
+	//line testdata/templates/integration.qtpl:329
+	streamintegrationSignature(qw422016, 42, "<foo>")
+	//line testdata/templates/integration.qtpl:329
+	qw422016.N().S(`
+
+	Printf:
+	`)
+	//line testdata/templates/integration.qtpl:332
+	qw422016.E().Printf("%d items, %q, %s", 3, "<x>", "a&b")
+	//line testdata/templates/integration.qtpl:332
+	qw422016.N().S(`
+
+	Raw:
+	`)
+	//line testdata/templates/integration.qtpl:335
+	StreamIntegrationRaw(qw422016, "<b>trusted</b>", []byte("<i>fragment</i>"))
+	//line testdata/templates/integration.qtpl:335
+	qw422016.N().S(`
+
+	Macros:
+	`)
+	//line testdata/templates/integration.qtpl:338
+	streamitem := func(qw422016 *qt422016.Writer, s string) {
+		//line testdata/templates/integration.qtpl:338
+		qw422016.N().S(`<li>`)
+		//line testdata/templates/integration.qtpl:338
+		streamintegrationBadge(qw422016, len(s))
+		//line testdata/templates/integration.qtpl:338
+		qw422016.N().S(` `)
+		//line testdata/templates/integration.qtpl:338
+		qw422016.E().S(s)
+		//line testdata/templates/integration.qtpl:338
+		qw422016.N().S(`</li>`)
+		//line testdata/templates/integration.qtpl:338
+	}
+	//line testdata/templates/integration.qtpl:338
+	_ = streamitem
+	//line testdata/templates/integration.qtpl:338
+	qw422016.N().S(`
+	<ul>`)
+	//line testdata/templates/integration.qtpl:339
+	streamitem(qw422016, "<a>")
+	//line testdata/templates/integration.qtpl:339
+	streamitem(qw422016, "bb")
+	//line testdata/templates/integration.qtpl:339
+	qw422016.N().S(`</ul>
+
+	Consts:
+	`)
+	//line testdata/templates/integration.qtpl:342
+	qw422016.E().S(integrationGreeting)
+	//line testdata/templates/integration.qtpl:342
+	qw422016.N().S(` `)
+	//line testdata/templates/integration.qtpl:342
+	qw422016.N().D(integrationMin)
+	//line testdata/templates/integration.qtpl:342
+	qw422016.N().S(`..`)
+	//line testdata/templates/integration.qtpl:342
+	qw422016.N().D(integrationMax)
+	//line testdata/templates/integration.qtpl:342
+	qw422016.N().S(`
+
+	Escaped tag delimiters:
+	Use {% func Name() %} for declaring template funcs.
+
+	Printf verbs, backticks and backslashes:
+	`)
+	//line testdata/templates/integration.qtpl:348
+	verbs := fmt.Sprintf("%s`%d\\", "100%", 42)
+
+	//line testdata/templates/integration.qtpl:348
+	qw422016.N().S(`
+	100% %s %d%% `)
+	//line testdata/templates/integration.qtpl:348
 	qw422016.N().S("`")
-	//line testdata/templates/integration.qtpl:105
-	qw422016.N().S(` %}</li>
-		<li>alert("foo {%j= `)
-	//line testdata/templates/integration.qtpl:105
+	//line testdata/templates/integration.qtpl:348
+	qw422016.N().S(`raw`)
+	//line testdata/templates/integration.qtpl:348
 	qw422016.N().S("`")
-	//line testdata/templates/integration.qtpl:105
-	qw422016.N().S(`"json"-safe
-				<string>`)
-	//line testdata/templates/integration.qtpl:105
+	//line testdata/templates/integration.qtpl:348
+	qw422016.N().S(` \n\ `)
+	//line testdata/templates/integration.qtpl:349
+	qw422016.N().S(verbs)
+	//line testdata/templates/integration.qtpl:349
+	qw422016.N().S(` `)
+	//line testdata/templates/integration.qtpl:349
+	qw422016.N().S(`%v\t`)
+	//line testdata/templates/integration.qtpl:349
+	qw422016.N().S(` `)
+	//line testdata/templates/integration.qtpl:349
+	qw422016.N().D(len("%%"))
+	//line testdata/templates/integration.qtpl:349
+	qw422016.N().S(`
+
+	XML and CDATA:
+	<item title="`)
+	//line testdata/templates/integration.qtpl:352
+	qw422016.N().X("Rock'n'Roll & <Blues>")
+	//line testdata/templates/integration.qtpl:352
+	qw422016.N().S(`">`)
+	//line testdata/templates/integration.qtpl:352
+	qw422016.N().S(`<![CDATA[`)
+	//line testdata/templates/integration.qtpl:352
+	{
+		//line testdata/templates/integration.qtpl:352
+		qw422016 := qt422016.AcquireCDATAWriter(qw422016)
+		//line testdata/templates/integration.qtpl:352
+		qw422016.N().S(`<b>`)
+		//line testdata/templates/integration.qtpl:352
+		qw422016.N().S("end ]]> ")
+		//line testdata/templates/integration.qtpl:352
+		qw422016.N().S(`]]`)
+		//line testdata/templates/integration.qtpl:352
+		qw422016.N().S(">")
+		//line testdata/templates/integration.qtpl:352
+		qw422016.N().S(`</b>`)
+		//line testdata/templates/integration.qtpl:352
+		qt422016.ReleaseCDATAWriter(qw422016)
+		//line testdata/templates/integration.qtpl:352
+	}
+	//line testdata/templates/integration.qtpl:352
+	qw422016.N().S(`]]>`)
+	//line testdata/templates/integration.qtpl:352
+	qw422016.N().S(`</item>
+
+	`)
+	//line testdata/templates/integration.qtpl:354
+	qw422016.N().S(`This is a template for integration test.
+It should contains all the quicktemplate stuff.
+
+{% import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+) %}
+
+{% func Integration() %}
+	Output tags`)
+	//line testdata/templates/integration.qtpl:354
 	qw422016.N().S("`")
-	//line testdata/templates/integration.qtpl:105
-	qw422016.N().S(` %} aa" + 'bar {%j= `)
-	//line testdata/templates/integration.qtpl:105
+	//line testdata/templates/integration.qtpl:354
+	qw422016.N().S(` verification.
+
+	{% code
+		p := &integrationPage{
+			S: "foobar",
+		}
+	%}
+	Embedded func template:
+		plain: {%= embeddedFunc(p) %}
+		html-escaped: {%=h embeddedFunc(p) %}
+		url-escaped: {%=u embeddedFunc(p) %}
+		quoted json string: {%=q embeddedFunc(p) %}
+		unquoted json string: {%=j embeddedFunc(p) %}
+		html-escaped url-escaped: {%=uh embeddedFunc(p) %}
+		html-escaped quoted json string: {%=qh embeddedFunc(p) %}
+		html-escaped unquoted json string: {%=jh embeddedFunc(p) %}
+
+	Html-escaped output tags:
+	<ul>
+		<li>{%s "<b>html-escaped `)
+	//line testdata/templates/integration.qtpl:354
 	qw422016.N().S("`")
-	//line testdata/templates/integration.qtpl:105
-	qw422016.N().S(`';alert("evil")</script>`)
-	//line testdata/templates/integration.qtpl:105
+	//line testdata/templates/integration.qtpl:354
+	qw422016.N().S(`string</b>" %}</li>
+		<li>{%z []byte("<b>html-escaped `)
+	//line testdata/templates/integration.qtpl:354
 	qw422016.N().S("`")
-	//line testdata/templates/integration.qtpl:105
+	//line testdata/templates/integration.qtpl:354
+	qw422016.N().S(`byte slice</b>") %}</li>
+		<li>Int: {%d 42 %}</li>
+		<li>Grouped int: {%dn 1234567 %} {%dn -1000 %} {%dn 0 %} {%dn "." 1234567 %} {%dn "'" 1234567 %}</li>
+		<li>Float: {%f 3.14 %}</li>
+		<li>{%q `)
+	//line testdata/templates/integration.qtpl:354
+	qw422016.N().S("`")
+	//line testdata/templates/integration.qtpl:354
+	qw422016.N().S(`<quoted> "json"
+				string`)
+	//line testdata/templates/integration.qtpl:354
+	qw422016.N().S("`")
+	//line testdata/templates/integration.qtpl:354
+	qw422016.N().S(` %}</li>
+		<li>alert("foo {%j `)
+	//line testdata/templates/integration.qtpl:354
+	qw422016.N().S("`")
+	//line testdata/templates/integration.qtpl:354
+	qw422016.N().S(`"json"-safe
+				<string>`)
+	//line testdata/templates/integration.qtpl:354
+	qw422016.N().S("`")
+	//line testdata/templates/integration.qtpl:354
+	qw422016.N().S(` %} aa" + 'bar {%j `)
+	//line testdata/templates/integration.qtpl:354
+	qw422016.N().S("`")
+	//line testdata/templates/integration.qtpl:354
+	qw422016.N().S(`';alert("evil")</script>`)
+	//line testdata/templates/integration.qtpl:354
+	qw422016.N().S("`")
+	//line testdata/templates/integration.qtpl:354
+	qw422016.N().S(` %}')</li>
+		<li><a href="?{%u "ключ" %}={%u "значение&=?123" %}">test</a></li>
+		<li>{%v struct{ A string }{A: "<b>foobar`)
+	//line testdata/templates/integration.qtpl:354
+	qw422016.N().S("`")
+	//line testdata/templates/integration.qtpl:354
+	qw422016.N().S(`</b>"} %}</li>
+	</ul>
+
+	Output tags without html escaping
+	<ul>
+		<li>{%s= "<b>html-escaped `)
+	//line testdata/templates/integration.qtpl:354
+	qw422016.N().S("`")
+	//line testdata/templates/integration.qtpl:354
+	qw422016.N().S(`string</b>" %}</li>
+		<li>{%z= []byte("<b>html-escaped `)
+	//line testdata/templates/integration.qtpl:354
+	qw422016.N().S("`")
+	//line testdata/templates/integration.qtpl:354
+	qw422016.N().S(`byte slice</b>") %}</li>
+		<li>Int: {%d= 42 %}</li>
+		<li>Float: {%f= 3.14 %}</li>
+		<li>{%q= `)
+	//line testdata/templates/integration.qtpl:354
+	qw422016.N().S("`")
+	//line testdata/templates/integration.qtpl:354
+	qw422016.N().S(`<quoted> "json"
+				string`)
+	//line testdata/templates/integration.qtpl:354
+	qw422016.N().S("`")
+	//line testdata/templates/integration.qtpl:354
+	qw422016.N().S(` %}</li>
+		<li>alert("foo {%j= `)
+	//line testdata/templates/integration.qtpl:354
+	qw422016.N().S("`")
+	//line testdata/templates/integration.qtpl:354
+	qw422016.N().S(`"json"-safe
+				<string>`)
+	//line testdata/templates/integration.qtpl:354
+	qw422016.N().S("`")
+	//line testdata/templates/integration.qtpl:354
+	qw422016.N().S(` %} aa" + 'bar {%j= `)
+	//line testdata/templates/integration.qtpl:354
+	qw422016.N().S("`")
+	//line testdata/templates/integration.qtpl:354
+	qw422016.N().S(`';alert("evil")</script>`)
+	//line testdata/templates/integration.qtpl:354
+	qw422016.N().S("`")
+	//line testdata/templates/integration.qtpl:354
 	qw422016.N().S(` %}')</li>
 		<li><a href="?{%u= "ключ" %}={%u= "значение&=?123" %}">test</a></li>
 		<li>{%v= struct{ A string }{A: "<b>foobar`)
-	//line testdata/templates/integration.qtpl:105
+	//line testdata/templates/integration.qtpl:354
 	qw422016.N().S("`")
-	//line testdata/templates/integration.qtpl:105
+	//line testdata/templates/integration.qtpl:354
 	qw422016.N().S(`</b>"} %}</li>
 	</ul>
 
-	{% stripspace %}
-		Strip space {%space%}
-		between lines and tags
-		{%plain%}
-			Tags aren't parsed {%inside %}
-			plain
-		{%endplain%}
-		{% code // one-liner comment %}
-		{% code
-		// multi-line
-		// comment
-		%}
-		{% code
-		/*
-		  yet another
-		  multi-line comment
-		*/
-		%}
-	{% endstripspace %}
+	{% stripspace %}
+		Strip space {%space%}
+		between lines and tags
+		{%plain%}
+			Tags aren't parsed {%inside %}
+			plain
+		{%endplain%}
+		{% code // one-liner comment %}
+		{% code
+		// multi-line
+		// comment
+		%}
+		{% code
+		/*
+		  yet another
+		  multi-line comment
+		*/
+		%}
+	{% endstripspace %}
+
+	{% collapsespace %}
+		Collapse space {%space %}
+		between {%newline%} lines and tags
+		{%comment%}
+			Comments {%are%}
+			ignored
+		{%endcomment%}
+
+		{% for _, s := range []string{"foo","bar","baz"} %}
+			{% if s == "bar" %}
+				Bar
+			{% elseif s == "baz" %}
+				Baz
+				{% break %}
+			{% else %}
+				{% if s == "never" %}
+					{% return %}
+				{% endif %}
+
+				{% switch s %}
+				{% case "foobar" %}
+					s = foobar
+				{% case "barbaz" %}
+					s = barbaz
+				{% default %}
+					s = {%s s %}
+				{% endswitch %}
+
+				{% continue %}
+			{% endif %}
+		{% endfor %}
+	{% endcollapsespace %}
+
+	Nested func closures:
+	{% func li(i int, s string) %}<li>{%d i %}: {%s s %}</li>{% endfunc %}
+	<ul>
+	{% for i, s := range []string{"foo", "<bar>"} %}
+		{%= li(i, s) %}
+		{%=h li(i, s) %}
+	{% endfor %}
+	</ul>
+
+	Multiple return values:
+	{% code m := map[string]string{"foo": "<foo>"} %}
+	{%s lookup(m, "foo"), _ %}, {%s= lookup(m, "foo"), _ %}, {%s= m["foo"], _ %}, [{%s lookup(m, "bar"), _ %}]
+
+	Safe dereference:
+	{% code
+		var nilUser *integrationUser
+		user := &integrationUser{Profile: &integrationProfile{Name: "<John>", Age: 42}}
+		noProfile := &integrationUser{}
+	%}
+	[{%s? nilUser.Profile.Name %}] [{%s? noProfile.Profile.Name %}] [{%d? noProfile.Profile.Age %}]
+	[{%s? user.Profile.Name %}] [{%s?= user.Profile.Name %}] [{%d? user.Profile.Age %}]
+
+	If with init statement:
+	{% code counts := map[string]int{"foo": 1} %}
+	{% for _, k := range []string{"foo", "bar", "baz"} %}
+		{% if n, ok := counts[k]; ok %}
+			{%s k %}={%d n %}
+		{% elseif n := len(k); k == "bar" %}
+			len({%s k %})={%d n %}
+		{% else %}
+			{%s k %} is missing
+		{% endif %}
+	{% endfor %}
+
+	Assign:
+	{% assign total = 0 %}
+	{% for _, n := range []int{1, 2, 3} %}
+		{% assign sq = n * n %}
+		{% assign total = total + sq %}
+		{%d n %}^2={%d sq %}
+	{% endfor %}
+	total={%d total %}
+
+	Stream-only func:
+	{%= integrationStream("<foo>") %}
+
+	Package code:
+	{% code package %}
+var integrationCounts = map[string]int{"{%": 42}
+	{% endcode %}
+	{%d integrationCounts["{%"] %}
+
+	Code block:
+	{% code %}
+	braces := map[string]string{
+		"open":  "{%",
+		"close": "%}",
+	}
+	{% endcode %}
+	{%s braces["open"] %} {%s braces["close"] %}
+
+	Explicit space and newline in stripspace:
+	{% stripspace %}
+		[
+			{% space %}
+		]
+		[{% newline %}]
+	{% endstripspace %}
+
+	Strip newlines:
+	{% stripnewlines %}
+	<pre>
+		  indented  {%s "line" %}
+	{% newline %}</pre>
+	{% endstripnewlines %}
+
+	Spaceless:
+	{% spaceless %}
+	<ul>
+		<li>hello   world</li>
+		{% for i := 0; i < 2; i++ %}
+			<li> {%d i %} </li>
+		{% endfor %}
+	</ul>
+	{% endspaceless %}
+
+	Break and continue outer loops:
+	{% stripspace %}
+	{% for i := 0; i < 3; i++ %}
+		{% for j := 0; j < 3; j++ %}
+			{% if j > i %}{% continue 2 %}{% endif %}
+			{% if i == 2 %}{% break 2 %}{% endif %}
+			[{%d i %}{%d j %}]
+		{% endfor %}
+	{% endfor %}
+	{% endstripspace %}
+
+	Unless:
+	{% for _, n := range []int{-1, 0, 1} %}
+		{% unless n > 0 || n < 0 %}zero{% else %}{%d n %}{% endunless %}
+	{% endfor %}
+
+	Conditional output:
+	{% for _, n := range []int{-2, 3} %}
+		{%s n < 0 ? "negative" : "positive" %} {%d n < 0 ? -n : n %} {%s "a?b:c" %}
+	{% endfor %}
+
+	Attribute value:
+	<a title="{%a `)
+	//line testdata/templates/integration.qtpl:354
+	qw422016.N().S("`")
+	//line testdata/templates/integration.qtpl:354
+	qw422016.N().S(`say "hi" 'there'`)
+	//line testdata/templates/integration.qtpl:354
+	qw422016.N().S("`")
+	//line testdata/templates/integration.qtpl:354
+	qw422016.N().S(` %}" data-x={%az []byte("a b=c") %}>
+
+	JS string:
+	<script>var s = "{%js "</script>\n" + `)
+	//line testdata/templates/integration.qtpl:354
+	qw422016.N().S("`")
+	//line testdata/templates/integration.qtpl:354
+	qw422016.N().S(`\`)
+	//line testdata/templates/integration.qtpl:354
+	qw422016.N().S("`")
+	//line testdata/templates/integration.qtpl:354
+	qw422016.N().S(` %}";</script>
+
+	CSS value:
+	<p style="color: {%css "red}body{color:blue;/*" %}">
+
+	Stringer value:
+	{%v:stringer integrationTag("<b>") %} {%v integrationTag("<b>") %} {%v:stringer= integrationTag("<i>") %}
+
+	Text and html funcs:
+	{%= integrationText("<b>") %}
+	{%= integrationHTML("<b>") %}
+
+	Loop state:
+	{% stripspace %}
+	{% for _, row := range [][]string{{"a", "b", "c"}, {"d"}} %}
+		{% if loop.First %}[{% endif %}
+		{% for _, cell := range row %}
+			{%d loop.Index %}/{%d loop.Len %}={%s cell %}
+			{% if loop.First %}(first){% endif %}
+			{% if loop.Last %}(last){% else %},{% endif %}
+		{% endfor %}
+		{% if loop.Last %}]{% else %};{% endif %}
+	{% endfor %}
+	{% endstripspace %}
+
+	Loop state over non-ASCII string:
+	{% for i, r := range "hé!" %}{%d loop.Index %}{%d i %}{%s string(r) %}{%d loop.Len %}{% if loop.Last %}(last){% else %};{% endif %}{% endfor %}
+
+	Switch fallthrough:
+	{% stripspace %}
+	{% for _, n := range []int{1, 2, 3} %}
+		[
+		{% switch n %}
+		{% case 3 %}
+			three
+			{% fallthrough %}
+		{% case 2 %}
+			two
+			{% fallthrough %}
+		{% default %}
+			one
+		{% endswitch %}
+		]
+	{% endfor %}
+	{% endstripspace %}
+
+	Counted loops:
+	{% stripspace %}
+		[{% for i in range(3) %}{%d i %}{% endfor %}]
+		[{% for i in range(1, 4) %}{%d i %}{% endfor %}]
+		[{% for i in range(0, 10, 2) %}{%d i %}{% endfor %}]
+		[{% for i in range(3, 0, -1) %}{%d i %}{% endfor %}]
+		[{% for i := range 3 %}{%d i %}{% endfor %}]
+		[{% for i := range 4 %}{%d i %}{% if !loop.Last %},{% endif %}{% endfor %}]
+	{% endstripspace %}
+
+	Guarded loops:
+	{% stripspace %}
+		[{% for s in []string{"a", "", "b"} if s != "" %}{%s s %}{% endfor %}]
+		[{% for i, s in []string{"a", "", "b"} if s != "" %}{%d i %}={%s s %}{% endfor %}]
+		[{% for i in range(10) if i%3 == 0 %}{%d i %}{% endfor %}]
+	{% endstripspace %}
+
+	Channel loops:
+	{% code
+		ch := make(chan string, 3)
+		ch <- "a"
+		ch <- "b"
+		ch <- "c"
+		close(ch)
+	%}
+	[{% for s in <-ch %}{%s s %}{% endfor %}]
+
+	Separators:
+	{% stripspace %}
+		[{% for _, s := range []string{"a", "b", "c"} %}{% sep ", " %}{%s s %}{% endfor %}]
+		[{% for _, row := range [][]string{{"a", "b"}, {"c"}} %}
+			{% sep "; " %}
+			{% for _, s := range row %}{% sep "," %}{%s s %}{% endfor %}
+		{% endfor %}]
+		[{% for i in range(6) %}
+			{% if i%2 == 0 %}{% continue %}{% endif %}
+			{% sep " | " %}{%d i %}
+			{% if i == 3 %}{% break %}{% endif %}
+		{% endfor %}]
+	{% endstripspace %}
+
+	With:
+	{% with s = "<with>", n = len(s) %}{%s s %} {%d n %}{% endwith %}
+
+	Defer:
+	{% code var deferLog []string %}{%= integrationDefer(&deferLog) %} {%s fmt.Sprint(deferLog) %}
+
+	Func values:
+	{% code renderer := func(w io.Writer) { fmt.Fprint(w, "<rendered>") } %}
+	{%= integrationCall(renderer) %}
+
+	Trim filters:
+	[{%s trim "  <b>padded</b>\t " %}] [{%s= trimset "./" "./path/." %}] [{%z trim trimset "-" []byte("- z -") %}]
+
+	Multi-line output tags:
+	{%s= fmt.Sprintf(
+		"%d-%s",
+		42, "<b>") %} {%d len(
+		"four") %}
+
+	Multi-line func signature:
+	{%= integrationSignature(42, "<foo>") %}
+
+	Printf:
+	{% printf "%d items, %q, %s", 3, "<x>", "a&b" %}
+
+	Raw:
+	{%= IntegrationRaw("<b>trusted</b>", []byte("<i>fragment</i>")) %}
+
+	Macros:
+	{% macro item(s string) %}<li>{%= integrationBadge(len(s)) %} {%s s %}</li>{% endmacro %}
+	<ul>{%= item("<a>") %}{%= item("bb") %}</ul>
+
+	Consts:
+	{%s integrationGreeting %} {%d integrationMin %}..{%d integrationMax %}
+
+	Escaped tag delimiters:
+	Use {%% func Name() %} for declaring template funcs.
+
+	Printf verbs, backticks and backslashes:
+	{% code verbs := fmt.Sprintf("%s`)
+	//line testdata/templates/integration.qtpl:354
+	qw422016.N().S("`")
+	//line testdata/templates/integration.qtpl:354
+	qw422016.N().S(`%d\\", "100%", 42) %}
+	100% %s %d%% `)
+	//line testdata/templates/integration.qtpl:354
+	qw422016.N().S("`")
+	//line testdata/templates/integration.qtpl:354
+	qw422016.N().S(`raw`)
+	//line testdata/templates/integration.qtpl:354
+	qw422016.N().S("`")
+	//line testdata/templates/integration.qtpl:354
+	qw422016.N().S(` \n\ {%s= verbs %} {%s= `)
+	//line testdata/templates/integration.qtpl:354
+	qw422016.N().S("`")
+	//line testdata/templates/integration.qtpl:354
+	qw422016.N().S(`%v\t`)
+	//line testdata/templates/integration.qtpl:354
+	qw422016.N().S("`")
+	//line testdata/templates/integration.qtpl:354
+	qw422016.N().S(` %} {%d len("%%") %}
+
+	XML and CDATA:
+	<item title="{%x "Rock'n'Roll & <Blues>" %}">{% cdata %}<b>{%s "end ]]> " %}]]{%s ">" %}</b>{% endcdata %}</item>
+
+	{% cat "integration.qtpl" %}
+
+	tail of the func
+{% endfunc %}
+
+{%
+interface Page {
+	Header()
+	Body()
+}
+%}
+
+{% func embeddedFunc(p Page) %}
+	Page's header: {%= p.Header() %}
+	Body: {%s= fmt.Sprintf("<b>%s</b>", p.Body()) %}
+{% endfunc %}
+
+{% func integrationDefer(log *[]string) %}{% stripspace %}
+	{% defer func() { *log = append(*log, "deferred") }() %}
+	{% code *log = append(*log, "body") %}
+	body
+{% endstripspace %}{% endfunc %}
+
+{% func integrationCall(r func(w io.Writer)) %}[{%= call r %}] [{%=h call r %}]{% endfunc %}
+
+{% macro integrationBadge(n int) %}<b>{%d n %}</b>{% endmacro %}
+
+{% const integrationGreeting = "<hello>" %}
+
+{% const (
+	integrationMin = 1
+	integrationMax = 3
+) %}
+
+{% func integrationSignature(
+	n int,
+	s string,
+) %}{%d n %}={%s s %}{% endfunc %}
+
+IntegrationProgress calls progress after writing each item.
+{% func IntegrationProgress(n int, progress func(i int)) %}
+	{% for i := 0; i < n; i++ %}<p>{%d i %}</p>{% code progress(i) %}{% endfor %}
+{% endfunc %}
+
+IntegrationRaw writes trusted html via raw tag.
+{% func IntegrationRaw(s string, b []byte) %}{% raw s %} {% raw b %} {% raw 42 %}{% endfunc %}
+
+IntegrationUnescaped writes the same values as IntegrationRaw via output tags.
+{% func IntegrationUnescaped(s string, b []byte) %}{%s= s %} {%z= b %} {%v= 42 %}{% endfunc %}
+
+IntegrationCopy streams r contents via copy tag.
+{% func IntegrationCopy(r io.Reader) %}<pre>{% copy r %}</pre>{% endfunc %}
+
+IntegrationChan renders values received from ch until ch is closed or ctx is done.
+{% func IntegrationChan(ctx context.Context, ch <-chan string) %}<ul>{% for s in <-ch while ctx %}<li>{%s s %}</li>{% endfor %}</ul>{% endfunc %}
+
+IntegrationChanArg renders values received from ch until ch is closed.
+{% func IntegrationChanArg(ch <-chan string) %}<ul>{% for s in ch %}<li>{%s s %}</li>{% endfor %}</ul>{% endfunc %}
+
+IntegrationCard renders the card with optional subtitle and count.
+{% func IntegrationCard(title string, subtitle string = "none", count int = -1) %}<h1>{%s title %}</h1><h2>{%s subtitle %}</h2><p>{%d count %}</p>{% endfunc %}
+
+IntegrationItems renders items. It returns ErrIntegrationEmptyItem for empty items.
+{% func err writerto IntegrationItems(items []string) %}<ul>{% for _, s := range items %}{%= integrationItem(s) %}{% endfor %}</ul>{% endfunc %}
+
+IntegrationGreeting greets name with the given tags. IntegrationGreetingWriterTo
+implements io.WriterTo for it.
+{% func writerto IntegrationGreeting(name string, tags ...string) %}Hello, {%s name %}!{% for _, t := range tags %} #{%s t %}{% endfor %}{% endfunc %}
+
+{% func err integrationItem(s string) %}{% if s == "" %}{% return ErrIntegrationEmptyItem %}{% endif %}<li>{%s s %}</li>{% endfunc %}
+
+{% code
+// ErrIntegrationEmptyItem is returned by IntegrationItems for empty items.
+var ErrIntegrationEmptyItem = errors.New("empty item")
+%}
+
+IntegrationCtx forwards ctx to the nested template without passing it explicitly.
+{% func ctx IntegrationCtx(name string) %}<p>{%= integrationCtxName(name) %}</p>{% endfunc %}
+
+{% func ctx integrationCtxName(name string) %}{%s name %}={%v ctx.Value(IntegrationCtxKey{}) %}{% endfunc %}
+
+{% code
+// IntegrationCtxKey is the key for the value rendered by IntegrationCtx.
+type IntegrationCtxKey struct{}
+%}
+
+{% func stream integrationStream(s string) %}[{%s s %}]{% endfunc %}
+
+{% func text integrationText(s string) %}{%s s %} {%q s %}{% endfunc %}
+
+{% func html integrationHTML(s string) %}{%s s %} {%q s %}{% endfunc %}
+
+{% code
+func lookup(m map[string]string, k string) (string, bool) {
+	v, ok := m[k]
+	return v, ok
+}
+%}
+
+{% code
+type integrationUser struct {
+	Profile *integrationProfile
+}
+
+type integrationProfile struct {
+	Name string
+	Age  int
+}
+%}
+
+{% code
+type integrationTag string
+
+func (t integrationTag) String() string {
+	return "tag:" + string(t)
+}
+%}
+
+{% code
+type integrationPage struct {
+	S string
+}
+%}
+
+{% func (p *integrationPage) Header() %}Header{% endfunc %}
+
+{% func (p *integrationPage) Body() %}
+	S={%q p.S %}
+{% endfunc %}
+`)
+	//line testdata/templates/integration.qtpl:354
+	qw422016.N().S(`
+
+	tail of the func
+`)
+//line testdata/templates/integration.qtpl:357
+}
+
+//line testdata/templates/integration.qtpl:357
+func WriteIntegration(qq422016 qtio422016.Writer) {
+	//line testdata/templates/integration.qtpl:357
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	//line testdata/templates/integration.qtpl:357
+	StreamIntegration(qw422016)
+	//line testdata/templates/integration.qtpl:357
+	qt422016.ReleaseWriter(qw422016)
+//line testdata/templates/integration.qtpl:357
+}
+
+//line testdata/templates/integration.qtpl:357
+func Integration() string {
+	//line testdata/templates/integration.qtpl:357
+	qb422016 := qt422016.AcquireByteBuffer()
+	//line testdata/templates/integration.qtpl:357
+	WriteIntegration(qb422016)
+	//line testdata/templates/integration.qtpl:357
+	qs422016 := string(qb422016.B)
+	//line testdata/templates/integration.qtpl:357
+	qt422016.ReleaseByteBuffer(qb422016)
+	//line testdata/templates/integration.qtpl:357
+	return qs422016
+//line testdata/templates/integration.qtpl:357
+}
+
+//line testdata/templates/integration.qtpl:357
+func AppendIntegration(dst422016 []byte) []byte {
+	//line testdata/templates/integration.qtpl:357
+	qb422016 := qt422016.AcquireByteBuffer()
+	//line testdata/templates/integration.qtpl:357
+	qz422016 := qb422016.B
+	//line testdata/templates/integration.qtpl:357
+	qb422016.B = dst422016
+	//line testdata/templates/integration.qtpl:357
+	WriteIntegration(qb422016)
+	//line testdata/templates/integration.qtpl:357
+	dst422016 = qb422016.B
+	//line testdata/templates/integration.qtpl:357
+	qb422016.B = qz422016
+	//line testdata/templates/integration.qtpl:357
+	qt422016.ReleaseByteBuffer(qb422016)
+	//line testdata/templates/integration.qtpl:357
+	return dst422016
+//line testdata/templates/integration.qtpl:357
+}
+
+//line testdata/templates/integration.qtpl:357
+func WriteIntegrationErr(qq422016 qtio422016.Writer) error {
+	//line testdata/templates/integration.qtpl:357
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	//line testdata/templates/integration.qtpl:357
+	StreamIntegration(qw422016)
+	//line testdata/templates/integration.qtpl:357
+	qe422016 := qw422016.Err()
+	//line testdata/templates/integration.qtpl:357
+	qt422016.ReleaseWriter(qw422016)
+	//line testdata/templates/integration.qtpl:357
+	return qe422016
+//line testdata/templates/integration.qtpl:357
+}
+
+//line testdata/templates/integration.qtpl:158
+
+var integrationCounts = map[string]int{"{%": 42}
+
+//line testdata/templates/integration.qtpl:360
+type Page interface {
+	//line testdata/templates/integration.qtpl:360
+	Header() string
+	//line testdata/templates/integration.qtpl:360
+	StreamHeader(qw422016 *qt422016.Writer)
+	//line testdata/templates/integration.qtpl:360
+	WriteHeader(qq422016 qtio422016.Writer)
+	//line testdata/templates/integration.qtpl:360
+	Body() string
+	//line testdata/templates/integration.qtpl:360
+	StreamBody(qw422016 *qt422016.Writer)
+	//line testdata/templates/integration.qtpl:360
+	WriteBody(qq422016 qtio422016.Writer)
+//line testdata/templates/integration.qtpl:360
+}
+
+//line testdata/templates/integration.qtpl:366
+func streamembeddedFunc(qw422016 *qt422016.Writer, p Page) {
+	//line testdata/templates/integration.qtpl:366
+	qw422016.N().S(`
+	Page's header: `)
+	//line testdata/templates/integration.qtpl:367
+	p.StreamHeader(qw422016)
+	//line testdata/templates/integration.qtpl:367
+	qw422016.N().S(`
+	Body: `)
+	//line testdata/templates/integration.qtpl:368
+	qw422016.N().S(fmt.Sprintf("<b>%s</b>", p.Body()))
+	//line testdata/templates/integration.qtpl:368
+	qw422016.N().S(`
+`)
+//line testdata/templates/integration.qtpl:369
+}
+
+//line testdata/templates/integration.qtpl:369
+func writeembeddedFunc(qq422016 qtio422016.Writer, p Page) {
+	//line testdata/templates/integration.qtpl:369
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	//line testdata/templates/integration.qtpl:369
+	streamembeddedFunc(qw422016, p)
+	//line testdata/templates/integration.qtpl:369
+	qt422016.ReleaseWriter(qw422016)
+//line testdata/templates/integration.qtpl:369
+}
+
+//line testdata/templates/integration.qtpl:369
+func embeddedFunc(p Page) string {
+	//line testdata/templates/integration.qtpl:369
+	qb422016 := qt422016.AcquireByteBuffer()
+	//line testdata/templates/integration.qtpl:369
+	writeembeddedFunc(qb422016, p)
+	//line testdata/templates/integration.qtpl:369
+	qs422016 := string(qb422016.B)
+	//line testdata/templates/integration.qtpl:369
+	qt422016.ReleaseByteBuffer(qb422016)
+	//line testdata/templates/integration.qtpl:369
+	return qs422016
+//line testdata/templates/integration.qtpl:369
+}
+
+//line testdata/templates/integration.qtpl:369
+func appendembeddedFunc(dst422016 []byte, p Page) []byte {
+	//line testdata/templates/integration.qtpl:369
+	qb422016 := qt422016.AcquireByteBuffer()
+	//line testdata/templates/integration.qtpl:369
+	qz422016 := qb422016.B
+	//line testdata/templates/integration.qtpl:369
+	qb422016.B = dst422016
+	//line testdata/templates/integration.qtpl:369
+	writeembeddedFunc(qb422016, p)
+	//line testdata/templates/integration.qtpl:369
+	dst422016 = qb422016.B
+	//line testdata/templates/integration.qtpl:369
+	qb422016.B = qz422016
+	//line testdata/templates/integration.qtpl:369
+	qt422016.ReleaseByteBuffer(qb422016)
+	//line testdata/templates/integration.qtpl:369
+	return dst422016
+//line testdata/templates/integration.qtpl:369
+}
+
+//line testdata/templates/integration.qtpl:369
+func writeembeddedFuncErr(qq422016 qtio422016.Writer, p Page) error {
+	//line testdata/templates/integration.qtpl:369
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	//line testdata/templates/integration.qtpl:369
+	streamembeddedFunc(qw422016, p)
+	//line testdata/templates/integration.qtpl:369
+	qe422016 := qw422016.Err()
+	//line testdata/templates/integration.qtpl:369
+	qt422016.ReleaseWriter(qw422016)
+	//line testdata/templates/integration.qtpl:369
+	return qe422016
+//line testdata/templates/integration.qtpl:369
+}
+
+//line testdata/templates/integration.qtpl:371
+func streamintegrationDefer(qw422016 *qt422016.Writer, log *[]string) {
+	//line testdata/templates/integration.qtpl:372
+	defer func() { *log = append(*log, "deferred") }()
+	//line testdata/templates/integration.qtpl:373
+	*log = append(*log, "body")
+
+	//line testdata/templates/integration.qtpl:373
+	qw422016.N().S(`body`)
+//line testdata/templates/integration.qtpl:375
+}
+
+//line testdata/templates/integration.qtpl:375
+func writeintegrationDefer(qq422016 qtio422016.Writer, log *[]string) {
+	//line testdata/templates/integration.qtpl:375
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	//line testdata/templates/integration.qtpl:375
+	streamintegrationDefer(qw422016, log)
+	//line testdata/templates/integration.qtpl:375
+	qt422016.ReleaseWriter(qw422016)
+//line testdata/templates/integration.qtpl:375
+}
+
+//line testdata/templates/integration.qtpl:375
+func integrationDefer(log *[]string) string {
+	//line testdata/templates/integration.qtpl:375
+	qb422016 := qt422016.AcquireByteBuffer()
+	//line testdata/templates/integration.qtpl:375
+	writeintegrationDefer(qb422016, log)
+	//line testdata/templates/integration.qtpl:375
+	qs422016 := string(qb422016.B)
+	//line testdata/templates/integration.qtpl:375
+	qt422016.ReleaseByteBuffer(qb422016)
+	//line testdata/templates/integration.qtpl:375
+	return qs422016
+//line testdata/templates/integration.qtpl:375
+}
+
+//line testdata/templates/integration.qtpl:375
+func appendintegrationDefer(dst422016 []byte, log *[]string) []byte {
+	//line testdata/templates/integration.qtpl:375
+	qb422016 := qt422016.AcquireByteBuffer()
+	//line testdata/templates/integration.qtpl:375
+	qz422016 := qb422016.B
+	//line testdata/templates/integration.qtpl:375
+	qb422016.B = dst422016
+	//line testdata/templates/integration.qtpl:375
+	writeintegrationDefer(qb422016, log)
+	//line testdata/templates/integration.qtpl:375
+	dst422016 = qb422016.B
+	//line testdata/templates/integration.qtpl:375
+	qb422016.B = qz422016
+	//line testdata/templates/integration.qtpl:375
+	qt422016.ReleaseByteBuffer(qb422016)
+	//line testdata/templates/integration.qtpl:375
+	return dst422016
+//line testdata/templates/integration.qtpl:375
+}
+
+//line testdata/templates/integration.qtpl:375
+func writeintegrationDeferErr(qq422016 qtio422016.Writer, log *[]string) error {
+	//line testdata/templates/integration.qtpl:375
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	//line testdata/templates/integration.qtpl:375
+	streamintegrationDefer(qw422016, log)
+	//line testdata/templates/integration.qtpl:375
+	qe422016 := qw422016.Err()
+	//line testdata/templates/integration.qtpl:375
+	qt422016.ReleaseWriter(qw422016)
+	//line testdata/templates/integration.qtpl:375
+	return qe422016
+//line testdata/templates/integration.qtpl:375
+}
+
+//line testdata/templates/integration.qtpl:377
+func streamintegrationCall(qw422016 *qt422016.Writer, r func(w io.Writer)) {
+	//line testdata/templates/integration.qtpl:377
+	qw422016.N().S(`[`)
+	//line testdata/templates/integration.qtpl:377
+	r(qw422016.N())
+	//line testdata/templates/integration.qtpl:377
+	qw422016.N().S(`] [`)
+	//line testdata/templates/integration.qtpl:377
+	{
+		//line testdata/templates/integration.qtpl:377
+		qb422016 := qt422016.AcquireByteBuffer()
+		//line testdata/templates/integration.qtpl:377
+		r(qb422016)
+		//line testdata/templates/integration.qtpl:377
+		qw422016.E().Z(qb422016.B)
+		//line testdata/templates/integration.qtpl:377
+		qt422016.ReleaseByteBuffer(qb422016)
+		//line testdata/templates/integration.qtpl:377
+	}
+	//line testdata/templates/integration.qtpl:377
+	qw422016.N().S(`]`)
+//line testdata/templates/integration.qtpl:377
+}
+
+//line testdata/templates/integration.qtpl:377
+func writeintegrationCall(qq422016 qtio422016.Writer, r func(w io.Writer)) {
+	//line testdata/templates/integration.qtpl:377
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	//line testdata/templates/integration.qtpl:377
+	streamintegrationCall(qw422016, r)
+	//line testdata/templates/integration.qtpl:377
+	qt422016.ReleaseWriter(qw422016)
+//line testdata/templates/integration.qtpl:377
+}
+
+//line testdata/templates/integration.qtpl:377
+func integrationCall(r func(w io.Writer)) string {
+	//line testdata/templates/integration.qtpl:377
+	qb422016 := qt422016.AcquireByteBuffer()
+	//line testdata/templates/integration.qtpl:377
+	writeintegrationCall(qb422016, r)
+	//line testdata/templates/integration.qtpl:377
+	qs422016 := string(qb422016.B)
+	//line testdata/templates/integration.qtpl:377
+	qt422016.ReleaseByteBuffer(qb422016)
+	//line testdata/templates/integration.qtpl:377
+	return qs422016
+//line testdata/templates/integration.qtpl:377
+}
+
+//line testdata/templates/integration.qtpl:377
+func appendintegrationCall(dst422016 []byte, r func(w io.Writer)) []byte {
+	//line testdata/templates/integration.qtpl:377
+	qb422016 := qt422016.AcquireByteBuffer()
+	//line testdata/templates/integration.qtpl:377
+	qz422016 := qb422016.B
+	//line testdata/templates/integration.qtpl:377
+	qb422016.B = dst422016
+	//line testdata/templates/integration.qtpl:377
+	writeintegrationCall(qb422016, r)
+	//line testdata/templates/integration.qtpl:377
+	dst422016 = qb422016.B
+	//line testdata/templates/integration.qtpl:377
+	qb422016.B = qz422016
+	//line testdata/templates/integration.qtpl:377
+	qt422016.ReleaseByteBuffer(qb422016)
+	//line testdata/templates/integration.qtpl:377
+	return dst422016
+//line testdata/templates/integration.qtpl:377
+}
+
+//line testdata/templates/integration.qtpl:377
+func writeintegrationCallErr(qq422016 qtio422016.Writer, r func(w io.Writer)) error {
+	//line testdata/templates/integration.qtpl:377
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	//line testdata/templates/integration.qtpl:377
+	streamintegrationCall(qw422016, r)
+	//line testdata/templates/integration.qtpl:377
+	qe422016 := qw422016.Err()
+	//line testdata/templates/integration.qtpl:377
+	qt422016.ReleaseWriter(qw422016)
+	//line testdata/templates/integration.qtpl:377
+	return qe422016
+//line testdata/templates/integration.qtpl:377
+}
+
+//line testdata/templates/integration.qtpl:379
+func streamintegrationBadge(qw422016 *qt422016.Writer, n int) {
+	//line testdata/templates/integration.qtpl:379
+	qw422016.N().S(`<b>`)
+	//line testdata/templates/integration.qtpl:379
+	qw422016.N().D(n)
+	//line testdata/templates/integration.qtpl:379
+	qw422016.N().S(`</b>`)
+//line testdata/templates/integration.qtpl:379
+}
+
+//line testdata/templates/integration.qtpl:381
+const integrationGreeting = "<hello>"
+
+//line testdata/templates/integration.qtpl:383
+const (
+	integrationMin = 1
+	integrationMax = 3
+)
+
+//line testdata/templates/integration.qtpl:388
+func streamintegrationSignature(qw422016 *qt422016.Writer, n int, s string) {
+	//line testdata/templates/integration.qtpl:391
+	qw422016.N().D(n)
+	//line testdata/templates/integration.qtpl:391
+	qw422016.N().S(`=`)
+	//line testdata/templates/integration.qtpl:391
+	qw422016.E().S(s)
+//line testdata/templates/integration.qtpl:391
+}
+
+//line testdata/templates/integration.qtpl:391
+func writeintegrationSignature(qq422016 qtio422016.Writer, n int, s string) {
+	//line testdata/templates/integration.qtpl:391
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	//line testdata/templates/integration.qtpl:391
+	streamintegrationSignature(qw422016, n, s)
+	//line testdata/templates/integration.qtpl:391
+	qt422016.ReleaseWriter(qw422016)
+//line testdata/templates/integration.qtpl:391
+}
+
+//line testdata/templates/integration.qtpl:391
+func integrationSignature(n int, s string) string {
+	//line testdata/templates/integration.qtpl:391
+	qb422016 := qt422016.AcquireByteBuffer()
+	//line testdata/templates/integration.qtpl:391
+	writeintegrationSignature(qb422016, n, s)
+	//line testdata/templates/integration.qtpl:391
+	qs422016 := string(qb422016.B)
+	//line testdata/templates/integration.qtpl:391
+	qt422016.ReleaseByteBuffer(qb422016)
+	//line testdata/templates/integration.qtpl:391
+	return qs422016
+//line testdata/templates/integration.qtpl:391
+}
+
+//line testdata/templates/integration.qtpl:391
+func appendintegrationSignature(dst422016 []byte, n int, s string) []byte {
+	//line testdata/templates/integration.qtpl:391
+	qb422016 := qt422016.AcquireByteBuffer()
+	//line testdata/templates/integration.qtpl:391
+	qz422016 := qb422016.B
+	//line testdata/templates/integration.qtpl:391
+	qb422016.B = dst422016
+	//line testdata/templates/integration.qtpl:391
+	writeintegrationSignature(qb422016, n, s)
+	//line testdata/templates/integration.qtpl:391
+	dst422016 = qb422016.B
+	//line testdata/templates/integration.qtpl:391
+	qb422016.B = qz422016
+	//line testdata/templates/integration.qtpl:391
+	qt422016.ReleaseByteBuffer(qb422016)
+	//line testdata/templates/integration.qtpl:391
+	return dst422016
+//line testdata/templates/integration.qtpl:391
+}
+
+//line testdata/templates/integration.qtpl:391
+func writeintegrationSignatureErr(qq422016 qtio422016.Writer, n int, s string) error {
+	//line testdata/templates/integration.qtpl:391
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	//line testdata/templates/integration.qtpl:391
+	streamintegrationSignature(qw422016, n, s)
+	//line testdata/templates/integration.qtpl:391
+	qe422016 := qw422016.Err()
+	//line testdata/templates/integration.qtpl:391
+	qt422016.ReleaseWriter(qw422016)
+	//line testdata/templates/integration.qtpl:391
+	return qe422016
+//line testdata/templates/integration.qtpl:391
+}
+
+// IntegrationProgress calls progress after writing each item.
+//
+//line testdata/templates/integration.qtpl:394
+func StreamIntegrationProgress(qw422016 *qt422016.Writer, n int, progress func(i int)) {
+	//line testdata/templates/integration.qtpl:394
+	qw422016.N().S(`
+	`)
+	//line testdata/templates/integration.qtpl:395
+	for i := 0; i < n; i++ {
+		//line testdata/templates/integration.qtpl:395
+		qw422016.N().S(`<p>`)
+		//line testdata/templates/integration.qtpl:395
+		qw422016.N().D(i)
+		//line testdata/templates/integration.qtpl:395
+		qw422016.N().S(`</p>`)
+		//line testdata/templates/integration.qtpl:395
+		progress(i)
+
+		//line testdata/templates/integration.qtpl:395
+	}
+	//line testdata/templates/integration.qtpl:395
+	qw422016.N().S(`
+`)
+//line testdata/templates/integration.qtpl:396
+}
+
+// IntegrationProgress calls progress after writing each item.
+//
+//line testdata/templates/integration.qtpl:396
+func WriteIntegrationProgress(qq422016 qtio422016.Writer, n int, progress func(i int)) {
+	//line testdata/templates/integration.qtpl:396
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	//line testdata/templates/integration.qtpl:396
+	StreamIntegrationProgress(qw422016, n, progress)
+	//line testdata/templates/integration.qtpl:396
+	qt422016.ReleaseWriter(qw422016)
+//line testdata/templates/integration.qtpl:396
+}
+
+// IntegrationProgress calls progress after writing each item.
+//
+//line testdata/templates/integration.qtpl:396
+func IntegrationProgress(n int, progress func(i int)) string {
+	//line testdata/templates/integration.qtpl:396
+	qb422016 := qt422016.AcquireByteBuffer()
+	//line testdata/templates/integration.qtpl:396
+	WriteIntegrationProgress(qb422016, n, progress)
+	//line testdata/templates/integration.qtpl:396
+	qs422016 := string(qb422016.B)
+	//line testdata/templates/integration.qtpl:396
+	qt422016.ReleaseByteBuffer(qb422016)
+	//line testdata/templates/integration.qtpl:396
+	return qs422016
+//line testdata/templates/integration.qtpl:396
+}
+
+// IntegrationProgress calls progress after writing each item.
+//
+//line testdata/templates/integration.qtpl:396
+func AppendIntegrationProgress(dst422016 []byte, n int, progress func(i int)) []byte {
+	//line testdata/templates/integration.qtpl:396
+	qb422016 := qt422016.AcquireByteBuffer()
+	//line testdata/templates/integration.qtpl:396
+	qz422016 := qb422016.B
+	//line testdata/templates/integration.qtpl:396
+	qb422016.B = dst422016
+	//line testdata/templates/integration.qtpl:396
+	WriteIntegrationProgress(qb422016, n, progress)
+	//line testdata/templates/integration.qtpl:396
+	dst422016 = qb422016.B
+	//line testdata/templates/integration.qtpl:396
+	qb422016.B = qz422016
+	//line testdata/templates/integration.qtpl:396
+	qt422016.ReleaseByteBuffer(qb422016)
+	//line testdata/templates/integration.qtpl:396
+	return dst422016
+//line testdata/templates/integration.qtpl:396
+}
+
+// IntegrationProgress calls progress after writing each item.
+//
+//line testdata/templates/integration.qtpl:396
+func WriteIntegrationProgressErr(qq422016 qtio422016.Writer, n int, progress func(i int)) error {
+	//line testdata/templates/integration.qtpl:396
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	//line testdata/templates/integration.qtpl:396
+	StreamIntegrationProgress(qw422016, n, progress)
+	//line testdata/templates/integration.qtpl:396
+	qe422016 := qw422016.Err()
+	//line testdata/templates/integration.qtpl:396
+	qt422016.ReleaseWriter(qw422016)
+	//line testdata/templates/integration.qtpl:396
+	return qe422016
+//line testdata/templates/integration.qtpl:396
+}
+
+// IntegrationRaw writes trusted html via raw tag.
+//
+//line testdata/templates/integration.qtpl:399
+func StreamIntegrationRaw(qw422016 *qt422016.Writer, s string, b []byte) {
+	//line testdata/templates/integration.qtpl:399
+	switch qv422016 := s; qr422016 := interface{}(qv422016).(type) {
+	//line testdata/templates/integration.qtpl:399
+	case string:
+		//line testdata/templates/integration.qtpl:399
+		qw422016.N().S(qr422016)
+	//line testdata/templates/integration.qtpl:399
+	case []byte:
+		//line testdata/templates/integration.qtpl:399
+		qw422016.N().Z(qr422016)
+	//line testdata/templates/integration.qtpl:399
+	default:
+		//line testdata/templates/integration.qtpl:399
+		qw422016.N().V(qv422016)
+		//line testdata/templates/integration.qtpl:399
+	}
+	//line testdata/templates/integration.qtpl:399
+	qw422016.N().S(` `)
+	//line testdata/templates/integration.qtpl:399
+	switch qv422016 := b; qr422016 := interface{}(qv422016).(type) {
+	//line testdata/templates/integration.qtpl:399
+	case string:
+		//line testdata/templates/integration.qtpl:399
+		qw422016.N().S(qr422016)
+	//line testdata/templates/integration.qtpl:399
+	case []byte:
+		//line testdata/templates/integration.qtpl:399
+		qw422016.N().Z(qr422016)
+	//line testdata/templates/integration.qtpl:399
+	default:
+		//line testdata/templates/integration.qtpl:399
+		qw422016.N().V(qv422016)
+		//line testdata/templates/integration.qtpl:399
+	}
+	//line testdata/templates/integration.qtpl:399
+	qw422016.N().S(` `)
+	//line testdata/templates/integration.qtpl:399
+	switch qv422016 := 42; qr422016 := interface{}(qv422016).(type) {
+	//line testdata/templates/integration.qtpl:399
+	case string:
+		//line testdata/templates/integration.qtpl:399
+		qw422016.N().S(qr422016)
+	//line testdata/templates/integration.qtpl:399
+	case []byte:
+		//line testdata/templates/integration.qtpl:399
+		qw422016.N().Z(qr422016)
+	//line testdata/templates/integration.qtpl:399
+	default:
+		//line testdata/templates/integration.qtpl:399
+		qw422016.N().V(qv422016)
+		//line testdata/templates/integration.qtpl:399
+	}
+//line testdata/templates/integration.qtpl:399
+}
+
+// IntegrationRaw writes trusted html via raw tag.
+//
+//line testdata/templates/integration.qtpl:399
+func WriteIntegrationRaw(qq422016 qtio422016.Writer, s string, b []byte) {
+	//line testdata/templates/integration.qtpl:399
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	//line testdata/templates/integration.qtpl:399
+	StreamIntegrationRaw(qw422016, s, b)
+	//line testdata/templates/integration.qtpl:399
+	qt422016.ReleaseWriter(qw422016)
+//line testdata/templates/integration.qtpl:399
+}
+
+// IntegrationRaw writes trusted html via raw tag.
+//
+//line testdata/templates/integration.qtpl:399
+func IntegrationRaw(s string, b []byte) string {
+	//line testdata/templates/integration.qtpl:399
+	qb422016 := qt422016.AcquireByteBuffer()
+	//line testdata/templates/integration.qtpl:399
+	WriteIntegrationRaw(qb422016, s, b)
+	//line testdata/templates/integration.qtpl:399
+	qs422016 := string(qb422016.B)
+	//line testdata/templates/integration.qtpl:399
+	qt422016.ReleaseByteBuffer(qb422016)
+	//line testdata/templates/integration.qtpl:399
+	return qs422016
+//line testdata/templates/integration.qtpl:399
+}
+
+// IntegrationRaw writes trusted html via raw tag.
+//
+//line testdata/templates/integration.qtpl:399
+func AppendIntegrationRaw(dst422016 []byte, s string, b []byte) []byte {
+	//line testdata/templates/integration.qtpl:399
+	qb422016 := qt422016.AcquireByteBuffer()
+	//line testdata/templates/integration.qtpl:399
+	qz422016 := qb422016.B
+	//line testdata/templates/integration.qtpl:399
+	qb422016.B = dst422016
+	//line testdata/templates/integration.qtpl:399
+	WriteIntegrationRaw(qb422016, s, b)
+	//line testdata/templates/integration.qtpl:399
+	dst422016 = qb422016.B
+	//line testdata/templates/integration.qtpl:399
+	qb422016.B = qz422016
+	//line testdata/templates/integration.qtpl:399
+	qt422016.ReleaseByteBuffer(qb422016)
+	//line testdata/templates/integration.qtpl:399
+	return dst422016
+//line testdata/templates/integration.qtpl:399
+}
+
+// IntegrationRaw writes trusted html via raw tag.
+//
+//line testdata/templates/integration.qtpl:399
+func WriteIntegrationRawErr(qq422016 qtio422016.Writer, s string, b []byte) error {
+	//line testdata/templates/integration.qtpl:399
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	//line testdata/templates/integration.qtpl:399
+	StreamIntegrationRaw(qw422016, s, b)
+	//line testdata/templates/integration.qtpl:399
+	qe422016 := qw422016.Err()
+	//line testdata/templates/integration.qtpl:399
+	qt422016.ReleaseWriter(qw422016)
+	//line testdata/templates/integration.qtpl:399
+	return qe422016
+//line testdata/templates/integration.qtpl:399
+}
+
+// IntegrationUnescaped writes the same values as IntegrationRaw via output tags.
+//
+//line testdata/templates/integration.qtpl:402
+func StreamIntegrationUnescaped(qw422016 *qt422016.Writer, s string, b []byte) {
+	//line testdata/templates/integration.qtpl:402
+	qw422016.N().S(s)
+	//line testdata/templates/integration.qtpl:402
+	qw422016.N().S(` `)
+	//line testdata/templates/integration.qtpl:402
+	qw422016.N().Z(b)
+	//line testdata/templates/integration.qtpl:402
+	qw422016.N().S(` `)
+	//line testdata/templates/integration.qtpl:402
+	qw422016.N().V(42)
+//line testdata/templates/integration.qtpl:402
+}
+
+// IntegrationUnescaped writes the same values as IntegrationRaw via output tags.
+//
+//line testdata/templates/integration.qtpl:402
+func WriteIntegrationUnescaped(qq422016 qtio422016.Writer, s string, b []byte) {
+	//line testdata/templates/integration.qtpl:402
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	//line testdata/templates/integration.qtpl:402
+	StreamIntegrationUnescaped(qw422016, s, b)
+	//line testdata/templates/integration.qtpl:402
+	qt422016.ReleaseWriter(qw422016)
+//line testdata/templates/integration.qtpl:402
+}
+
+// IntegrationUnescaped writes the same values as IntegrationRaw via output tags.
+//
+//line testdata/templates/integration.qtpl:402
+func IntegrationUnescaped(s string, b []byte) string {
+	//line testdata/templates/integration.qtpl:402
+	qb422016 := qt422016.AcquireByteBuffer()
+	//line testdata/templates/integration.qtpl:402
+	WriteIntegrationUnescaped(qb422016, s, b)
+	//line testdata/templates/integration.qtpl:402
+	qs422016 := string(qb422016.B)
+	//line testdata/templates/integration.qtpl:402
+	qt422016.ReleaseByteBuffer(qb422016)
+	//line testdata/templates/integration.qtpl:402
+	return qs422016
+//line testdata/templates/integration.qtpl:402
+}
+
+// IntegrationUnescaped writes the same values as IntegrationRaw via output tags.
+//
+//line testdata/templates/integration.qtpl:402
+func AppendIntegrationUnescaped(dst422016 []byte, s string, b []byte) []byte {
+	//line testdata/templates/integration.qtpl:402
+	qb422016 := qt422016.AcquireByteBuffer()
+	//line testdata/templates/integration.qtpl:402
+	qz422016 := qb422016.B
+	//line testdata/templates/integration.qtpl:402
+	qb422016.B = dst422016
+	//line testdata/templates/integration.qtpl:402
+	WriteIntegrationUnescaped(qb422016, s, b)
+	//line testdata/templates/integration.qtpl:402
+	dst422016 = qb422016.B
+	//line testdata/templates/integration.qtpl:402
+	qb422016.B = qz422016
+	//line testdata/templates/integration.qtpl:402
+	qt422016.ReleaseByteBuffer(qb422016)
+	//line testdata/templates/integration.qtpl:402
+	return dst422016
+//line testdata/templates/integration.qtpl:402
+}
+
+// IntegrationUnescaped writes the same values as IntegrationRaw via output tags.
+//
+//line testdata/templates/integration.qtpl:402
+func WriteIntegrationUnescapedErr(qq422016 qtio422016.Writer, s string, b []byte) error {
+	//line testdata/templates/integration.qtpl:402
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	//line testdata/templates/integration.qtpl:402
+	StreamIntegrationUnescaped(qw422016, s, b)
+	//line testdata/templates/integration.qtpl:402
+	qe422016 := qw422016.Err()
+	//line testdata/templates/integration.qtpl:402
+	qt422016.ReleaseWriter(qw422016)
+	//line testdata/templates/integration.qtpl:402
+	return qe422016
+//line testdata/templates/integration.qtpl:402
+}
+
+// IntegrationCopy streams r contents via copy tag.
+//
+//line testdata/templates/integration.qtpl:405
+func StreamIntegrationCopy(qw422016 *qt422016.Writer, r io.Reader) {
+	//line testdata/templates/integration.qtpl:405
+	qw422016.N().S(`<pre>`)
+	//line testdata/templates/integration.qtpl:405
+	qw422016.N().Copy(r)
+	//line testdata/templates/integration.qtpl:405
+	qw422016.N().S(`</pre>`)
+//line testdata/templates/integration.qtpl:405
+}
+
+// IntegrationCopy streams r contents via copy tag.
+//
+//line testdata/templates/integration.qtpl:405
+func WriteIntegrationCopy(qq422016 qtio422016.Writer, r io.Reader) {
+	//line testdata/templates/integration.qtpl:405
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	//line testdata/templates/integration.qtpl:405
+	StreamIntegrationCopy(qw422016, r)
+	//line testdata/templates/integration.qtpl:405
+	qt422016.ReleaseWriter(qw422016)
+//line testdata/templates/integration.qtpl:405
+}
+
+// IntegrationCopy streams r contents via copy tag.
+//
+//line testdata/templates/integration.qtpl:405
+func IntegrationCopy(r io.Reader) string {
+	//line testdata/templates/integration.qtpl:405
+	qb422016 := qt422016.AcquireByteBuffer()
+	//line testdata/templates/integration.qtpl:405
+	WriteIntegrationCopy(qb422016, r)
+	//line testdata/templates/integration.qtpl:405
+	qs422016 := string(qb422016.B)
+	//line testdata/templates/integration.qtpl:405
+	qt422016.ReleaseByteBuffer(qb422016)
+	//line testdata/templates/integration.qtpl:405
+	return qs422016
+//line testdata/templates/integration.qtpl:405
+}
+
+// IntegrationCopy streams r contents via copy tag.
+//
+//line testdata/templates/integration.qtpl:405
+func AppendIntegrationCopy(dst422016 []byte, r io.Reader) []byte {
+	//line testdata/templates/integration.qtpl:405
+	qb422016 := qt422016.AcquireByteBuffer()
+	//line testdata/templates/integration.qtpl:405
+	qz422016 := qb422016.B
+	//line testdata/templates/integration.qtpl:405
+	qb422016.B = dst422016
+	//line testdata/templates/integration.qtpl:405
+	WriteIntegrationCopy(qb422016, r)
+	//line testdata/templates/integration.qtpl:405
+	dst422016 = qb422016.B
+	//line testdata/templates/integration.qtpl:405
+	qb422016.B = qz422016
+	//line testdata/templates/integration.qtpl:405
+	qt422016.ReleaseByteBuffer(qb422016)
+	//line testdata/templates/integration.qtpl:405
+	return dst422016
+//line testdata/templates/integration.qtpl:405
+}
+
+// IntegrationCopy streams r contents via copy tag.
+//
+//line testdata/templates/integration.qtpl:405
+func WriteIntegrationCopyErr(qq422016 qtio422016.Writer, r io.Reader) error {
+	//line testdata/templates/integration.qtpl:405
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	//line testdata/templates/integration.qtpl:405
+	StreamIntegrationCopy(qw422016, r)
+	//line testdata/templates/integration.qtpl:405
+	qe422016 := qw422016.Err()
+	//line testdata/templates/integration.qtpl:405
+	qt422016.ReleaseWriter(qw422016)
+	//line testdata/templates/integration.qtpl:405
+	return qe422016
+//line testdata/templates/integration.qtpl:405
+}
+
+// IntegrationChan renders values received from ch until ch is closed or ctx is done.
+//
+//line testdata/templates/integration.qtpl:408
+func StreamIntegrationChan(qw422016 *qt422016.Writer, ctx context.Context, ch <-chan string) {
+	//line testdata/templates/integration.qtpl:408
+	qw422016.N().S(`<ul>`)
+	//line testdata/templates/integration.qtpl:408
+	for s := range qt422016.RecvContext(ctx, ch) {
+		//line testdata/templates/integration.qtpl:408
+		qw422016.N().S(`<li>`)
+		//line testdata/templates/integration.qtpl:408
+		qw422016.E().S(s)
+		//line testdata/templates/integration.qtpl:408
+		qw422016.N().S(`</li>`)
+		//line testdata/templates/integration.qtpl:408
+	}
+	//line testdata/templates/integration.qtpl:408
+	qw422016.N().S(`</ul>`)
+//line testdata/templates/integration.qtpl:408
+}
+
+// IntegrationChan renders values received from ch until ch is closed or ctx is done.
+//
+//line testdata/templates/integration.qtpl:408
+func WriteIntegrationChan(qq422016 qtio422016.Writer, ctx context.Context, ch <-chan string) {
+	//line testdata/templates/integration.qtpl:408
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	//line testdata/templates/integration.qtpl:408
+	StreamIntegrationChan(qw422016, ctx, ch)
+	//line testdata/templates/integration.qtpl:408
+	qt422016.ReleaseWriter(qw422016)
+//line testdata/templates/integration.qtpl:408
+}
+
+// IntegrationChan renders values received from ch until ch is closed or ctx is done.
+//
+//line testdata/templates/integration.qtpl:408
+func IntegrationChan(ctx context.Context, ch <-chan string) string {
+	//line testdata/templates/integration.qtpl:408
+	qb422016 := qt422016.AcquireByteBuffer()
+	//line testdata/templates/integration.qtpl:408
+	WriteIntegrationChan(qb422016, ctx, ch)
+	//line testdata/templates/integration.qtpl:408
+	qs422016 := string(qb422016.B)
+	//line testdata/templates/integration.qtpl:408
+	qt422016.ReleaseByteBuffer(qb422016)
+	//line testdata/templates/integration.qtpl:408
+	return qs422016
+//line testdata/templates/integration.qtpl:408
+}
+
+// IntegrationChan renders values received from ch until ch is closed or ctx is done.
+//
+//line testdata/templates/integration.qtpl:408
+func AppendIntegrationChan(dst422016 []byte, ctx context.Context, ch <-chan string) []byte {
+	//line testdata/templates/integration.qtpl:408
+	qb422016 := qt422016.AcquireByteBuffer()
+	//line testdata/templates/integration.qtpl:408
+	qz422016 := qb422016.B
+	//line testdata/templates/integration.qtpl:408
+	qb422016.B = dst422016
+	//line testdata/templates/integration.qtpl:408
+	WriteIntegrationChan(qb422016, ctx, ch)
+	//line testdata/templates/integration.qtpl:408
+	dst422016 = qb422016.B
+	//line testdata/templates/integration.qtpl:408
+	qb422016.B = qz422016
+	//line testdata/templates/integration.qtpl:408
+	qt422016.ReleaseByteBuffer(qb422016)
+	//line testdata/templates/integration.qtpl:408
+	return dst422016
+//line testdata/templates/integration.qtpl:408
+}
+
+// IntegrationChan renders values received from ch until ch is closed or ctx is done.
+//
+//line testdata/templates/integration.qtpl:408
+func WriteIntegrationChanErr(qq422016 qtio422016.Writer, ctx context.Context, ch <-chan string) error {
+	//line testdata/templates/integration.qtpl:408
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	//line testdata/templates/integration.qtpl:408
+	StreamIntegrationChan(qw422016, ctx, ch)
+	//line testdata/templates/integration.qtpl:408
+	qe422016 := qw422016.Err()
+	//line testdata/templates/integration.qtpl:408
+	qt422016.ReleaseWriter(qw422016)
+	//line testdata/templates/integration.qtpl:408
+	return qe422016
+//line testdata/templates/integration.qtpl:408
+}
+
+// IntegrationChanArg renders values received from ch until ch is closed.
+//
+//line testdata/templates/integration.qtpl:411
+func StreamIntegrationChanArg(qw422016 *qt422016.Writer, ch <-chan string) {
+	//line testdata/templates/integration.qtpl:411
+	qw422016.N().S(`<ul>`)
+	//line testdata/templates/integration.qtpl:411
+	for s := range ch {
+		//line testdata/templates/integration.qtpl:411
+		qw422016.N().S(`<li>`)
+		//line testdata/templates/integration.qtpl:411
+		qw422016.E().S(s)
+		//line testdata/templates/integration.qtpl:411
+		qw422016.N().S(`</li>`)
+		//line testdata/templates/integration.qtpl:411
+	}
+	//line testdata/templates/integration.qtpl:411
+	qw422016.N().S(`</ul>`)
+//line testdata/templates/integration.qtpl:411
+}
+
+// IntegrationChanArg renders values received from ch until ch is closed.
+//
+//line testdata/templates/integration.qtpl:411
+func WriteIntegrationChanArg(qq422016 qtio422016.Writer, ch <-chan string) {
+	//line testdata/templates/integration.qtpl:411
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	//line testdata/templates/integration.qtpl:411
+	StreamIntegrationChanArg(qw422016, ch)
+	//line testdata/templates/integration.qtpl:411
+	qt422016.ReleaseWriter(qw422016)
+//line testdata/templates/integration.qtpl:411
+}
+
+// IntegrationChanArg renders values received from ch until ch is closed.
+//
+//line testdata/templates/integration.qtpl:411
+func IntegrationChanArg(ch <-chan string) string {
+	//line testdata/templates/integration.qtpl:411
+	qb422016 := qt422016.AcquireByteBuffer()
+	//line testdata/templates/integration.qtpl:411
+	WriteIntegrationChanArg(qb422016, ch)
+	//line testdata/templates/integration.qtpl:411
+	qs422016 := string(qb422016.B)
+	//line testdata/templates/integration.qtpl:411
+	qt422016.ReleaseByteBuffer(qb422016)
+	//line testdata/templates/integration.qtpl:411
+	return qs422016
+//line testdata/templates/integration.qtpl:411
+}
+
+// IntegrationChanArg renders values received from ch until ch is closed.
+//
+//line testdata/templates/integration.qtpl:411
+func AppendIntegrationChanArg(dst422016 []byte, ch <-chan string) []byte {
+	//line testdata/templates/integration.qtpl:411
+	qb422016 := qt422016.AcquireByteBuffer()
+	//line testdata/templates/integration.qtpl:411
+	qz422016 := qb422016.B
+	//line testdata/templates/integration.qtpl:411
+	qb422016.B = dst422016
+	//line testdata/templates/integration.qtpl:411
+	WriteIntegrationChanArg(qb422016, ch)
+	//line testdata/templates/integration.qtpl:411
+	dst422016 = qb422016.B
+	//line testdata/templates/integration.qtpl:411
+	qb422016.B = qz422016
+	//line testdata/templates/integration.qtpl:411
+	qt422016.ReleaseByteBuffer(qb422016)
+	//line testdata/templates/integration.qtpl:411
+	return dst422016
+//line testdata/templates/integration.qtpl:411
+}
+
+// IntegrationChanArg renders values received from ch until ch is closed.
+//
+//line testdata/templates/integration.qtpl:411
+func WriteIntegrationChanArgErr(qq422016 qtio422016.Writer, ch <-chan string) error {
+	//line testdata/templates/integration.qtpl:411
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	//line testdata/templates/integration.qtpl:411
+	StreamIntegrationChanArg(qw422016, ch)
+	//line testdata/templates/integration.qtpl:411
+	qe422016 := qw422016.Err()
+	//line testdata/templates/integration.qtpl:411
+	qt422016.ReleaseWriter(qw422016)
+	//line testdata/templates/integration.qtpl:411
+	return qe422016
+//line testdata/templates/integration.qtpl:411
+}
+
+// IntegrationCard renders the card with optional subtitle and count.
+//
+//line testdata/templates/integration.qtpl:414
+func StreamIntegrationCard(qw422016 *qt422016.Writer, title string, subtitle string, count int) {
+	//line testdata/templates/integration.qtpl:414
+	qw422016.N().S(`<h1>`)
+	//line testdata/templates/integration.qtpl:414
+	qw422016.E().S(title)
+	//line testdata/templates/integration.qtpl:414
+	qw422016.N().S(`</h1><h2>`)
+	//line testdata/templates/integration.qtpl:414
+	qw422016.E().S(subtitle)
+	//line testdata/templates/integration.qtpl:414
+	qw422016.N().S(`</h2><p>`)
+	//line testdata/templates/integration.qtpl:414
+	qw422016.N().D(count)
+	//line testdata/templates/integration.qtpl:414
+	qw422016.N().S(`</p>`)
+//line testdata/templates/integration.qtpl:414
+}
+
+// IntegrationCard renders the card with optional subtitle and count.
+//
+//line testdata/templates/integration.qtpl:414
+func WriteIntegrationCard(qq422016 qtio422016.Writer, title string, subtitle string, count int) {
+	//line testdata/templates/integration.qtpl:414
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	//line testdata/templates/integration.qtpl:414
+	StreamIntegrationCard(qw422016, title, subtitle, count)
+	//line testdata/templates/integration.qtpl:414
+	qt422016.ReleaseWriter(qw422016)
+//line testdata/templates/integration.qtpl:414
+}
+
+// IntegrationCard renders the card with optional subtitle and count.
+//
+//line testdata/templates/integration.qtpl:414
+func IntegrationCard(title string, subtitle string, count int) string {
+	//line testdata/templates/integration.qtpl:414
+	qb422016 := qt422016.AcquireByteBuffer()
+	//line testdata/templates/integration.qtpl:414
+	WriteIntegrationCard(qb422016, title, subtitle, count)
+	//line testdata/templates/integration.qtpl:414
+	qs422016 := string(qb422016.B)
+	//line testdata/templates/integration.qtpl:414
+	qt422016.ReleaseByteBuffer(qb422016)
+	//line testdata/templates/integration.qtpl:414
+	return qs422016
+//line testdata/templates/integration.qtpl:414
+}
+
+// IntegrationCard renders the card with optional subtitle and count.
+//
+//line testdata/templates/integration.qtpl:414
+func AppendIntegrationCard(dst422016 []byte, title string, subtitle string, count int) []byte {
+	//line testdata/templates/integration.qtpl:414
+	qb422016 := qt422016.AcquireByteBuffer()
+	//line testdata/templates/integration.qtpl:414
+	qz422016 := qb422016.B
+	//line testdata/templates/integration.qtpl:414
+	qb422016.B = dst422016
+	//line testdata/templates/integration.qtpl:414
+	WriteIntegrationCard(qb422016, title, subtitle, count)
+	//line testdata/templates/integration.qtpl:414
+	dst422016 = qb422016.B
+	//line testdata/templates/integration.qtpl:414
+	qb422016.B = qz422016
+	//line testdata/templates/integration.qtpl:414
+	qt422016.ReleaseByteBuffer(qb422016)
+	//line testdata/templates/integration.qtpl:414
+	return dst422016
+//line testdata/templates/integration.qtpl:414
+}
+
+// IntegrationCard renders the card with optional subtitle and count.
+//
+//line testdata/templates/integration.qtpl:414
+func WriteIntegrationCardErr(qq422016 qtio422016.Writer, title string, subtitle string, count int) error {
+	//line testdata/templates/integration.qtpl:414
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	//line testdata/templates/integration.qtpl:414
+	StreamIntegrationCard(qw422016, title, subtitle, count)
+	//line testdata/templates/integration.qtpl:414
+	qe422016 := qw422016.Err()
+	//line testdata/templates/integration.qtpl:414
+	qt422016.ReleaseWriter(qw422016)
+	//line testdata/templates/integration.qtpl:414
+	return qe422016
+//line testdata/templates/integration.qtpl:414
+}
+
+// StreamIntegrationCardDefaults calls StreamIntegrationCard with default values for the omitted args.
+//
+//line testdata/templates/integration.qtpl:414
+func StreamIntegrationCardDefaults(qw422016 *qt422016.Writer, title string) {
+	//line testdata/templates/integration.qtpl:414
+	StreamIntegrationCard(qw422016, title, "none", -1)
+//line testdata/templates/integration.qtpl:414
+}
+
+// WriteIntegrationCardDefaults calls WriteIntegrationCard with default values for the omitted args.
+//
+//line testdata/templates/integration.qtpl:414
+func WriteIntegrationCardDefaults(qq422016 qtio422016.Writer, title string) {
+	//line testdata/templates/integration.qtpl:414
+	WriteIntegrationCard(qq422016, title, "none", -1)
+//line testdata/templates/integration.qtpl:414
+}
+
+// IntegrationCardDefaults calls IntegrationCard with default values for the omitted args.
+//
+//line testdata/templates/integration.qtpl:414
+func IntegrationCardDefaults(title string) string {
+	//line testdata/templates/integration.qtpl:414
+	return IntegrationCard(title, "none", -1)
+//line testdata/templates/integration.qtpl:414
+}
+
+// IntegrationItems renders items. It returns ErrIntegrationEmptyItem for empty items.
+//
+//line testdata/templates/integration.qtpl:417
+func StreamIntegrationItems(qw422016 *qt422016.Writer, items []string) error {
+	//line testdata/templates/integration.qtpl:417
+	qw422016.N().S(`<ul>`)
+	//line testdata/templates/integration.qtpl:417
+	for _, s := range items {
+		//line testdata/templates/integration.qtpl:417
+		if qe422016 := streamintegrationItem(qw422016, s); qe422016 != nil {
+			//line testdata/templates/integration.qtpl:417
+			return qe422016
+			//line testdata/templates/integration.qtpl:417
+		}
+		//line testdata/templates/integration.qtpl:417
+	}
+	//line testdata/templates/integration.qtpl:417
+	qw422016.N().S(`</ul>`)
+	//line testdata/templates/integration.qtpl:417
+	return nil
+//line testdata/templates/integration.qtpl:417
+}
+
+// IntegrationItemsWriterTo writes the output of IntegrationItems called with the captured args.
+//
+//line testdata/templates/integration.qtpl:417
+type IntegrationItemsWriterTo struct {
+//line testdata/templates/integration.qtpl:417
+	items []string
+//line testdata/templates/integration.qtpl:417
+}
+
+// NewIntegrationItemsWriterTo returns IntegrationItemsWriterTo capturing the given args.
+//
+//line testdata/templates/integration.qtpl:417
+func NewIntegrationItemsWriterTo(items []string) IntegrationItemsWriterTo {
+	//line testdata/templates/integration.qtpl:417
+	return IntegrationItemsWriterTo{
+		//line testdata/templates/integration.qtpl:417
+		items: items,
+		//line testdata/templates/integration.qtpl:417
+	}
+//line testdata/templates/integration.qtpl:417
+}
+
+// WriteTo implements io.WriterTo.
+//
+//line testdata/templates/integration.qtpl:417
+func (qa422016 IntegrationItemsWriterTo) WriteTo(qq422016 qtio422016.Writer) (int64, error) {
+	//line testdata/templates/integration.qtpl:417
+	qw422016 := qt422016.AcquireCountingWriter(qq422016)
+	//line testdata/templates/integration.qtpl:417
+	qe422016 := StreamIntegrationItems(qw422016, qa422016.items)
+	//line testdata/templates/integration.qtpl:417
+	if qe422016 == nil {
+		//line testdata/templates/integration.qtpl:417
+		qe422016 = qw422016.Err()
+		//line testdata/templates/integration.qtpl:417
+	}
+	//line testdata/templates/integration.qtpl:417
+	qn422016 := qt422016.ReleaseCountingWriter(qw422016)
+	//line testdata/templates/integration.qtpl:417
+	return qn422016, qe422016
+//line testdata/templates/integration.qtpl:417
+}
+
+// IntegrationItems renders items. It returns ErrIntegrationEmptyItem for empty items.
+//
+//line testdata/templates/integration.qtpl:417
+func WriteIntegrationItems(qq422016 qtio422016.Writer, items []string) error {
+	//line testdata/templates/integration.qtpl:417
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	//line testdata/templates/integration.qtpl:417
+	qe422016 := StreamIntegrationItems(qw422016, items)
+	//line testdata/templates/integration.qtpl:417
+	if qe422016 == nil {
+		//line testdata/templates/integration.qtpl:417
+		qe422016 = qw422016.Err()
+		//line testdata/templates/integration.qtpl:417
+	}
+	//line testdata/templates/integration.qtpl:417
+	qt422016.ReleaseWriter(qw422016)
+	//line testdata/templates/integration.qtpl:417
+	return qe422016
+//line testdata/templates/integration.qtpl:417
+}
 
-	{% collapsespace %}
-		Collapse space {%space %}
-		between {%newline%} lines and tags
-		{%comment%}
-			Comments {%are%}
-			ignored
-		{%endcomment%}
+// IntegrationItems renders items. It returns ErrIntegrationEmptyItem for empty items.
+//
+//line testdata/templates/integration.qtpl:417
+func IntegrationItems(items []string) (string, error) {
+	//line testdata/templates/integration.qtpl:417
+	qb422016 := qt422016.AcquireByteBuffer()
+	//line testdata/templates/integration.qtpl:417
+	if qe422016 := WriteIntegrationItems(qb422016, items); qe422016 != nil {
+		//line testdata/templates/integration.qtpl:417
+		qt422016.ReleaseByteBuffer(qb422016)
+		//line testdata/templates/integration.qtpl:417
+		return "", qe422016
+		//line testdata/templates/integration.qtpl:417
+	}
+	//line testdata/templates/integration.qtpl:417
+	qs422016 := string(qb422016.B)
+	//line testdata/templates/integration.qtpl:417
+	qt422016.ReleaseByteBuffer(qb422016)
+	//line testdata/templates/integration.qtpl:417
+	return qs422016, nil
+//line testdata/templates/integration.qtpl:417
+}
 
-		{% for _, s := range []string{"foo","bar","baz"} %}
-			{% if s == "bar" %}
-				Bar
-			{% elseif s == "baz" %}
-				Baz
-				{% break %}
-			{% else %}
-				{% if s == "never" %}
-					{% return %}
-				{% endif %}
+// IntegrationGreeting greets name with the given tags. IntegrationGreetingWriterTo
+// implements io.WriterTo for it.
+//
+//line testdata/templates/integration.qtpl:421
+func StreamIntegrationGreeting(qw422016 *qt422016.Writer, name string, tags ...string) {
+	//line testdata/templates/integration.qtpl:421
+	qw422016.N().S(`Hello, `)
+	//line testdata/templates/integration.qtpl:421
+	qw422016.E().S(name)
+	//line testdata/templates/integration.qtpl:421
+	qw422016.N().S(`!`)
+	//line testdata/templates/integration.qtpl:421
+	for _, t := range tags {
+		//line testdata/templates/integration.qtpl:421
+		qw422016.N().S(` #`)
+		//line testdata/templates/integration.qtpl:421
+		qw422016.E().S(t)
+		//line testdata/templates/integration.qtpl:421
+	}
+//line testdata/templates/integration.qtpl:421
+}
 
-				{% switch s %}
-				{% case "foobar" %}
-					s = foobar
-				{% case "barbaz" %}
-					s = barbaz
-				{% default %}
-					s = {%s s %}
-				{% endswitch %}
+// IntegrationGreetingWriterTo writes the output of IntegrationGreeting called with the captured args.
+//
+//line testdata/templates/integration.qtpl:421
+type IntegrationGreetingWriterTo struct {
+//line testdata/templates/integration.qtpl:421
+	name string
+//line testdata/templates/integration.qtpl:421
+	tags []string
+//line testdata/templates/integration.qtpl:421
+}
 
-				{% continue %}
-			{% endif %}
-		{% endfor %}
-	{% endcollapsespace %}
+// NewIntegrationGreetingWriterTo returns IntegrationGreetingWriterTo capturing the given args.
+//
+//line testdata/templates/integration.qtpl:421
+func NewIntegrationGreetingWriterTo(name string, tags ...string) IntegrationGreetingWriterTo {
+	//line testdata/templates/integration.qtpl:421
+	return IntegrationGreetingWriterTo{
+		//line testdata/templates/integration.qtpl:421
+		name: name,
+		//line testdata/templates/integration.qtpl:421
+		tags: tags,
+		//line testdata/templates/integration.qtpl:421
+	}
+//line testdata/templates/integration.qtpl:421
+}
 
-	{% cat "integration.qtpl" %}
+// WriteTo implements io.WriterTo.
+//
+//line testdata/templates/integration.qtpl:421
+func (qa422016 IntegrationGreetingWriterTo) WriteTo(qq422016 qtio422016.Writer) (int64, error) {
+	//line testdata/templates/integration.qtpl:421
+	qw422016 := qt422016.AcquireCountingWriter(qq422016)
+	//line testdata/templates/integration.qtpl:421
+	StreamIntegrationGreeting(qw422016, qa422016.name, qa422016.tags...)
+	//line testdata/templates/integration.qtpl:421
+	qe422016 := qw422016.Err()
+	//line testdata/templates/integration.qtpl:421
+	qn422016 := qt422016.ReleaseCountingWriter(qw422016)
+	//line testdata/templates/integration.qtpl:421
+	return qn422016, qe422016
+//line testdata/templates/integration.qtpl:421
+}
 
-	tail of the func
-{% endfunc %}
+// IntegrationGreeting greets name with the given tags. IntegrationGreetingWriterTo
+// implements io.WriterTo for it.
+//
+//line testdata/templates/integration.qtpl:421
+func WriteIntegrationGreeting(qq422016 qtio422016.Writer, name string, tags ...string) {
+	//line testdata/templates/integration.qtpl:421
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	//line testdata/templates/integration.qtpl:421
+	StreamIntegrationGreeting(qw422016, name, tags...)
+	//line testdata/templates/integration.qtpl:421
+	qt422016.ReleaseWriter(qw422016)
+//line testdata/templates/integration.qtpl:421
+}
 
-{%
-interface Page {
-	Header()
-	Body()
+// IntegrationGreeting greets name with the given tags. IntegrationGreetingWriterTo
+// implements io.WriterTo for it.
+//
+//line testdata/templates/integration.qtpl:421
+func IntegrationGreeting(name string, tags ...string) string {
+	//line testdata/templates/integration.qtpl:421
+	qb422016 := qt422016.AcquireByteBuffer()
+	//line testdata/templates/integration.qtpl:421
+	WriteIntegrationGreeting(qb422016, name, tags...)
+	//line testdata/templates/integration.qtpl:421
+	qs422016 := string(qb422016.B)
+	//line testdata/templates/integration.qtpl:421
+	qt422016.ReleaseByteBuffer(qb422016)
+	//line testdata/templates/integration.qtpl:421
+	return qs422016
+//line testdata/templates/integration.qtpl:421
 }
-%}
 
-{% func embeddedFunc(p Page) %}
-	Page's header: {%= p.Header() %}
-	Body: {%s= fmt.Sprintf("<b>%s</b>", p.Body()) %}
-{% endfunc %}
+// IntegrationGreeting greets name with the given tags. IntegrationGreetingWriterTo
+// implements io.WriterTo for it.
+//
+//line testdata/templates/integration.qtpl:421
+func AppendIntegrationGreeting(dst422016 []byte, name string, tags ...string) []byte {
+	//line testdata/templates/integration.qtpl:421
+	qb422016 := qt422016.AcquireByteBuffer()
+	//line testdata/templates/integration.qtpl:421
+	qz422016 := qb422016.B
+	//line testdata/templates/integration.qtpl:421
+	qb422016.B = dst422016
+	//line testdata/templates/integration.qtpl:421
+	WriteIntegrationGreeting(qb422016, name, tags...)
+	//line testdata/templates/integration.qtpl:421
+	dst422016 = qb422016.B
+	//line testdata/templates/integration.qtpl:421
+	qb422016.B = qz422016
+	//line testdata/templates/integration.qtpl:421
+	qt422016.ReleaseByteBuffer(qb422016)
+	//line testdata/templates/integration.qtpl:421
+	return dst422016
+//line testdata/templates/integration.qtpl:421
+}
 
-{% code
-type integrationPage struct {
-	S string
+// IntegrationGreeting greets name with the given tags. IntegrationGreetingWriterTo
+// implements io.WriterTo for it.
+//
+//line testdata/templates/integration.qtpl:421
+func WriteIntegrationGreetingErr(qq422016 qtio422016.Writer, name string, tags ...string) error {
+	//line testdata/templates/integration.qtpl:421
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	//line testdata/templates/integration.qtpl:421
+	StreamIntegrationGreeting(qw422016, name, tags...)
+	//line testdata/templates/integration.qtpl:421
+	qe422016 := qw422016.Err()
+	//line testdata/templates/integration.qtpl:421
+	qt422016.ReleaseWriter(qw422016)
+	//line testdata/templates/integration.qtpl:421
+	return qe422016
+//line testdata/templates/integration.qtpl:421
 }
-%}
 
-{% func (p *integrationPage) Header() %}Header{% endfunc %}
+//line testdata/templates/integration.qtpl:423
+func streamintegrationItem(qw422016 *qt422016.Writer, s string) error {
+	//line testdata/templates/integration.qtpl:423
+	if s == "" {
+		//line testdata/templates/integration.qtpl:423
+		return ErrIntegrationEmptyItem
+		//line testdata/templates/integration.qtpl:423
+	}
+	//line testdata/templates/integration.qtpl:423
+	qw422016.N().S(`<li>`)
+	//line testdata/templates/integration.qtpl:423
+	qw422016.E().S(s)
+	//line testdata/templates/integration.qtpl:423
+	qw422016.N().S(`</li>`)
+	//line testdata/templates/integration.qtpl:423
+	return nil
+//line testdata/templates/integration.qtpl:423
+}
 
-{% func (p *integrationPage) Body() %}
-	S={%q p.S %}
-{% endfunc %}
-`)
-	//line testdata/templates/integration.qtpl:105
-	qw422016.N().S(`
+//line testdata/templates/integration.qtpl:423
+func writeintegrationItem(qq422016 qtio422016.Writer, s string) error {
+	//line testdata/templates/integration.qtpl:423
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	//line testdata/templates/integration.qtpl:423
+	qe422016 := streamintegrationItem(qw422016, s)
+	//line testdata/templates/integration.qtpl:423
+	if qe422016 == nil {
+		//line testdata/templates/integration.qtpl:423
+		qe422016 = qw422016.Err()
+		//line testdata/templates/integration.qtpl:423
+	}
+	//line testdata/templates/integration.qtpl:423
+	qt422016.ReleaseWriter(qw422016)
+	//line testdata/templates/integration.qtpl:423
+	return qe422016
+//line testdata/templates/integration.qtpl:423
+}
 
-	tail of the func
-`)
-//line testdata/templates/integration.qtpl:108
+//line testdata/templates/integration.qtpl:423
+func integrationItem(s string) (string, error) {
+	//line testdata/templates/integration.qtpl:423
+	qb422016 := qt422016.AcquireByteBuffer()
+	//line testdata/templates/integration.qtpl:423
+	if qe422016 := writeintegrationItem(qb422016, s); qe422016 != nil {
+		//line testdata/templates/integration.qtpl:423
+		qt422016.ReleaseByteBuffer(qb422016)
+		//line testdata/templates/integration.qtpl:423
+		return "", qe422016
+		//line testdata/templates/integration.qtpl:423
+	}
+	//line testdata/templates/integration.qtpl:423
+	qs422016 := string(qb422016.B)
+	//line testdata/templates/integration.qtpl:423
+	qt422016.ReleaseByteBuffer(qb422016)
+	//line testdata/templates/integration.qtpl:423
+	return qs422016, nil
+//line testdata/templates/integration.qtpl:423
 }
 
-//line testdata/templates/integration.qtpl:108
-func WriteIntegration(qq422016 qtio422016.Writer) {
-	//line testdata/templates/integration.qtpl:108
+// ErrIntegrationEmptyItem is returned by IntegrationItems for empty items.
+//
+//line testdata/templates/integration.qtpl:426
+var ErrIntegrationEmptyItem = errors.New("empty item")
+
+// IntegrationCtx forwards ctx to the nested template without passing it explicitly.
+//
+//line testdata/templates/integration.qtpl:431
+func StreamIntegrationCtx(qw422016 *qt422016.Writer, ctx qtctx422016.Context, name string) {
+	//line testdata/templates/integration.qtpl:431
+	qw422016.N().S(`<p>`)
+	//line testdata/templates/integration.qtpl:431
+	streamintegrationCtxName(qw422016, ctx, name)
+	//line testdata/templates/integration.qtpl:431
+	qw422016.N().S(`</p>`)
+//line testdata/templates/integration.qtpl:431
+}
+
+// IntegrationCtx forwards ctx to the nested template without passing it explicitly.
+//
+//line testdata/templates/integration.qtpl:431
+func WriteIntegrationCtx(qq422016 qtio422016.Writer, ctx qtctx422016.Context, name string) {
+	//line testdata/templates/integration.qtpl:431
 	qw422016 := qt422016.AcquireWriter(qq422016)
-	//line testdata/templates/integration.qtpl:108
-	StreamIntegration(qw422016)
-	//line testdata/templates/integration.qtpl:108
+	//line testdata/templates/integration.qtpl:431
+	StreamIntegrationCtx(qw422016, ctx, name)
+	//line testdata/templates/integration.qtpl:431
 	qt422016.ReleaseWriter(qw422016)
-//line testdata/templates/integration.qtpl:108
+//line testdata/templates/integration.qtpl:431
 }
 
-//line testdata/templates/integration.qtpl:108
-func Integration() string {
-	//line testdata/templates/integration.qtpl:108
+// IntegrationCtx forwards ctx to the nested template without passing it explicitly.
+//
+//line testdata/templates/integration.qtpl:431
+func IntegrationCtx(ctx qtctx422016.Context, name string) string {
+	//line testdata/templates/integration.qtpl:431
 	qb422016 := qt422016.AcquireByteBuffer()
-	//line testdata/templates/integration.qtpl:108
-	WriteIntegration(qb422016)
-	//line testdata/templates/integration.qtpl:108
+	//line testdata/templates/integration.qtpl:431
+	WriteIntegrationCtx(qb422016, ctx, name)
+	//line testdata/templates/integration.qtpl:431
 	qs422016 := string(qb422016.B)
-	//line testdata/templates/integration.qtpl:108
+	//line testdata/templates/integration.qtpl:431
 	qt422016.ReleaseByteBuffer(qb422016)
-	//line testdata/templates/integration.qtpl:108
+	//line testdata/templates/integration.qtpl:431
 	return qs422016
-//line testdata/templates/integration.qtpl:108
+//line testdata/templates/integration.qtpl:431
 }
 
-//line testdata/templates/integration.qtpl:111
-type Page interface {
-	//line testdata/templates/integration.qtpl:111
-	Header() string
-	//line testdata/templates/integration.qtpl:111
-	StreamHeader(qw422016 *qt422016.Writer)
-	//line testdata/templates/integration.qtpl:111
-	WriteHeader(qq422016 qtio422016.Writer)
-	//line testdata/templates/integration.qtpl:111
-	Body() string
-	//line testdata/templates/integration.qtpl:111
-	StreamBody(qw422016 *qt422016.Writer)
-	//line testdata/templates/integration.qtpl:111
-	WriteBody(qq422016 qtio422016.Writer)
-//line testdata/templates/integration.qtpl:111
+// IntegrationCtx forwards ctx to the nested template without passing it explicitly.
+//
+//line testdata/templates/integration.qtpl:431
+func AppendIntegrationCtx(dst422016 []byte, ctx qtctx422016.Context, name string) []byte {
+	//line testdata/templates/integration.qtpl:431
+	qb422016 := qt422016.AcquireByteBuffer()
+	//line testdata/templates/integration.qtpl:431
+	qz422016 := qb422016.B
+	//line testdata/templates/integration.qtpl:431
+	qb422016.B = dst422016
+	//line testdata/templates/integration.qtpl:431
+	WriteIntegrationCtx(qb422016, ctx, name)
+	//line testdata/templates/integration.qtpl:431
+	dst422016 = qb422016.B
+	//line testdata/templates/integration.qtpl:431
+	qb422016.B = qz422016
+	//line testdata/templates/integration.qtpl:431
+	qt422016.ReleaseByteBuffer(qb422016)
+	//line testdata/templates/integration.qtpl:431
+	return dst422016
+//line testdata/templates/integration.qtpl:431
 }
 
-//line testdata/templates/integration.qtpl:117
-func streamembeddedFunc(qw422016 *qt422016.Writer, p Page) {
-	//line testdata/templates/integration.qtpl:117
-	qw422016.N().S(`
-	Page's header: `)
-	//line testdata/templates/integration.qtpl:118
-	p.StreamHeader(qw422016)
-	//line testdata/templates/integration.qtpl:118
-	qw422016.N().S(`
-	Body: `)
-	//line testdata/templates/integration.qtpl:119
-	qw422016.N().S(fmt.Sprintf("<b>%s</b>", p.Body()))
-	//line testdata/templates/integration.qtpl:119
-	qw422016.N().S(`
-`)
-//line testdata/templates/integration.qtpl:120
+// IntegrationCtx forwards ctx to the nested template without passing it explicitly.
+//
+//line testdata/templates/integration.qtpl:431
+func WriteIntegrationCtxErr(qq422016 qtio422016.Writer, ctx qtctx422016.Context, name string) error {
+	//line testdata/templates/integration.qtpl:431
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	//line testdata/templates/integration.qtpl:431
+	StreamIntegrationCtx(qw422016, ctx, name)
+	//line testdata/templates/integration.qtpl:431
+	qe422016 := qw422016.Err()
+	//line testdata/templates/integration.qtpl:431
+	qt422016.ReleaseWriter(qw422016)
+	//line testdata/templates/integration.qtpl:431
+	return qe422016
+//line testdata/templates/integration.qtpl:431
 }
 
-//line testdata/templates/integration.qtpl:120
-func writeembeddedFunc(qq422016 qtio422016.Writer, p Page) {
-	//line testdata/templates/integration.qtpl:120
+//line testdata/templates/integration.qtpl:433
+func streamintegrationCtxName(qw422016 *qt422016.Writer, ctx qtctx422016.Context, name string) {
+	//line testdata/templates/integration.qtpl:433
+	qw422016.E().S(name)
+	//line testdata/templates/integration.qtpl:433
+	qw422016.N().S(`=`)
+	//line testdata/templates/integration.qtpl:433
+	qw422016.E().V(ctx.Value(IntegrationCtxKey{}))
+//line testdata/templates/integration.qtpl:433
+}
+
+//line testdata/templates/integration.qtpl:433
+func writeintegrationCtxName(qq422016 qtio422016.Writer, ctx qtctx422016.Context, name string) {
+	//line testdata/templates/integration.qtpl:433
 	qw422016 := qt422016.AcquireWriter(qq422016)
-	//line testdata/templates/integration.qtpl:120
-	streamembeddedFunc(qw422016, p)
-	//line testdata/templates/integration.qtpl:120
+	//line testdata/templates/integration.qtpl:433
+	streamintegrationCtxName(qw422016, ctx, name)
+	//line testdata/templates/integration.qtpl:433
 	qt422016.ReleaseWriter(qw422016)
-//line testdata/templates/integration.qtpl:120
+//line testdata/templates/integration.qtpl:433
 }
 
-//line testdata/templates/integration.qtpl:120
-func embeddedFunc(p Page) string {
-	//line testdata/templates/integration.qtpl:120
+//line testdata/templates/integration.qtpl:433
+func integrationCtxName(ctx qtctx422016.Context, name string) string {
+	//line testdata/templates/integration.qtpl:433
 	qb422016 := qt422016.AcquireByteBuffer()
-	//line testdata/templates/integration.qtpl:120
-	writeembeddedFunc(qb422016, p)
-	//line testdata/templates/integration.qtpl:120
+	//line testdata/templates/integration.qtpl:433
+	writeintegrationCtxName(qb422016, ctx, name)
+	//line testdata/templates/integration.qtpl:433
+	qs422016 := string(qb422016.B)
+	//line testdata/templates/integration.qtpl:433
+	qt422016.ReleaseByteBuffer(qb422016)
+	//line testdata/templates/integration.qtpl:433
+	return qs422016
+//line testdata/templates/integration.qtpl:433
+}
+
+//line testdata/templates/integration.qtpl:433
+func appendintegrationCtxName(dst422016 []byte, ctx qtctx422016.Context, name string) []byte {
+	//line testdata/templates/integration.qtpl:433
+	qb422016 := qt422016.AcquireByteBuffer()
+	//line testdata/templates/integration.qtpl:433
+	qz422016 := qb422016.B
+	//line testdata/templates/integration.qtpl:433
+	qb422016.B = dst422016
+	//line testdata/templates/integration.qtpl:433
+	writeintegrationCtxName(qb422016, ctx, name)
+	//line testdata/templates/integration.qtpl:433
+	dst422016 = qb422016.B
+	//line testdata/templates/integration.qtpl:433
+	qb422016.B = qz422016
+	//line testdata/templates/integration.qtpl:433
+	qt422016.ReleaseByteBuffer(qb422016)
+	//line testdata/templates/integration.qtpl:433
+	return dst422016
+//line testdata/templates/integration.qtpl:433
+}
+
+//line testdata/templates/integration.qtpl:433
+func writeintegrationCtxNameErr(qq422016 qtio422016.Writer, ctx qtctx422016.Context, name string) error {
+	//line testdata/templates/integration.qtpl:433
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	//line testdata/templates/integration.qtpl:433
+	streamintegrationCtxName(qw422016, ctx, name)
+	//line testdata/templates/integration.qtpl:433
+	qe422016 := qw422016.Err()
+	//line testdata/templates/integration.qtpl:433
+	qt422016.ReleaseWriter(qw422016)
+	//line testdata/templates/integration.qtpl:433
+	return qe422016
+//line testdata/templates/integration.qtpl:433
+}
+
+// IntegrationCtxKey is the key for the value rendered by IntegrationCtx.
+//
+//line testdata/templates/integration.qtpl:436
+type IntegrationCtxKey struct{}
+
+//line testdata/templates/integration.qtpl:440
+func streamintegrationStream(qw422016 *qt422016.Writer, s string) {
+	//line testdata/templates/integration.qtpl:440
+	qw422016.N().S(`[`)
+	//line testdata/templates/integration.qtpl:440
+	qw422016.E().S(s)
+	//line testdata/templates/integration.qtpl:440
+	qw422016.N().S(`]`)
+//line testdata/templates/integration.qtpl:440
+}
+
+//line testdata/templates/integration.qtpl:442
+func streamintegrationText(qw422016 *qt422016.Writer, s string) {
+	//line testdata/templates/integration.qtpl:442
+	qw422016.N().S(s)
+	//line testdata/templates/integration.qtpl:442
+	qw422016.N().S(` `)
+	//line testdata/templates/integration.qtpl:442
+	qw422016.N().Q(s)
+//line testdata/templates/integration.qtpl:442
+}
+
+//line testdata/templates/integration.qtpl:442
+func writeintegrationText(qq422016 qtio422016.Writer, s string) {
+	//line testdata/templates/integration.qtpl:442
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	//line testdata/templates/integration.qtpl:442
+	streamintegrationText(qw422016, s)
+	//line testdata/templates/integration.qtpl:442
+	qt422016.ReleaseWriter(qw422016)
+//line testdata/templates/integration.qtpl:442
+}
+
+//line testdata/templates/integration.qtpl:442
+func integrationText(s string) string {
+	//line testdata/templates/integration.qtpl:442
+	qb422016 := qt422016.AcquireByteBuffer()
+	//line testdata/templates/integration.qtpl:442
+	writeintegrationText(qb422016, s)
+	//line testdata/templates/integration.qtpl:442
+	qs422016 := string(qb422016.B)
+	//line testdata/templates/integration.qtpl:442
+	qt422016.ReleaseByteBuffer(qb422016)
+	//line testdata/templates/integration.qtpl:442
+	return qs422016
+//line testdata/templates/integration.qtpl:442
+}
+
+//line testdata/templates/integration.qtpl:442
+func appendintegrationText(dst422016 []byte, s string) []byte {
+	//line testdata/templates/integration.qtpl:442
+	qb422016 := qt422016.AcquireByteBuffer()
+	//line testdata/templates/integration.qtpl:442
+	qz422016 := qb422016.B
+	//line testdata/templates/integration.qtpl:442
+	qb422016.B = dst422016
+	//line testdata/templates/integration.qtpl:442
+	writeintegrationText(qb422016, s)
+	//line testdata/templates/integration.qtpl:442
+	dst422016 = qb422016.B
+	//line testdata/templates/integration.qtpl:442
+	qb422016.B = qz422016
+	//line testdata/templates/integration.qtpl:442
+	qt422016.ReleaseByteBuffer(qb422016)
+	//line testdata/templates/integration.qtpl:442
+	return dst422016
+//line testdata/templates/integration.qtpl:442
+}
+
+//line testdata/templates/integration.qtpl:442
+func writeintegrationTextErr(qq422016 qtio422016.Writer, s string) error {
+	//line testdata/templates/integration.qtpl:442
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	//line testdata/templates/integration.qtpl:442
+	streamintegrationText(qw422016, s)
+	//line testdata/templates/integration.qtpl:442
+	qe422016 := qw422016.Err()
+	//line testdata/templates/integration.qtpl:442
+	qt422016.ReleaseWriter(qw422016)
+	//line testdata/templates/integration.qtpl:442
+	return qe422016
+//line testdata/templates/integration.qtpl:442
+}
+
+//line testdata/templates/integration.qtpl:444
+func streamintegrationHTML(qw422016 *qt422016.Writer, s string) {
+	//line testdata/templates/integration.qtpl:444
+	qw422016.E().S(s)
+	//line testdata/templates/integration.qtpl:444
+	qw422016.N().S(` `)
+	//line testdata/templates/integration.qtpl:444
+	qw422016.E().Q(s)
+//line testdata/templates/integration.qtpl:444
+}
+
+//line testdata/templates/integration.qtpl:444
+func writeintegrationHTML(qq422016 qtio422016.Writer, s string) {
+	//line testdata/templates/integration.qtpl:444
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	//line testdata/templates/integration.qtpl:444
+	streamintegrationHTML(qw422016, s)
+	//line testdata/templates/integration.qtpl:444
+	qt422016.ReleaseWriter(qw422016)
+//line testdata/templates/integration.qtpl:444
+}
+
+//line testdata/templates/integration.qtpl:444
+func integrationHTML(s string) string {
+	//line testdata/templates/integration.qtpl:444
+	qb422016 := qt422016.AcquireByteBuffer()
+	//line testdata/templates/integration.qtpl:444
+	writeintegrationHTML(qb422016, s)
+	//line testdata/templates/integration.qtpl:444
 	qs422016 := string(qb422016.B)
-	//line testdata/templates/integration.qtpl:120
+	//line testdata/templates/integration.qtpl:444
 	qt422016.ReleaseByteBuffer(qb422016)
-	//line testdata/templates/integration.qtpl:120
+	//line testdata/templates/integration.qtpl:444
 	return qs422016
-//line testdata/templates/integration.qtpl:120
+//line testdata/templates/integration.qtpl:444
+}
+
+//line testdata/templates/integration.qtpl:444
+func appendintegrationHTML(dst422016 []byte, s string) []byte {
+	//line testdata/templates/integration.qtpl:444
+	qb422016 := qt422016.AcquireByteBuffer()
+	//line testdata/templates/integration.qtpl:444
+	qz422016 := qb422016.B
+	//line testdata/templates/integration.qtpl:444
+	qb422016.B = dst422016
+	//line testdata/templates/integration.qtpl:444
+	writeintegrationHTML(qb422016, s)
+	//line testdata/templates/integration.qtpl:444
+	dst422016 = qb422016.B
+	//line testdata/templates/integration.qtpl:444
+	qb422016.B = qz422016
+	//line testdata/templates/integration.qtpl:444
+	qt422016.ReleaseByteBuffer(qb422016)
+	//line testdata/templates/integration.qtpl:444
+	return dst422016
+//line testdata/templates/integration.qtpl:444
+}
+
+//line testdata/templates/integration.qtpl:444
+func writeintegrationHTMLErr(qq422016 qtio422016.Writer, s string) error {
+	//line testdata/templates/integration.qtpl:444
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	//line testdata/templates/integration.qtpl:444
+	streamintegrationHTML(qw422016, s)
+	//line testdata/templates/integration.qtpl:444
+	qe422016 := qw422016.Err()
+	//line testdata/templates/integration.qtpl:444
+	qt422016.ReleaseWriter(qw422016)
+	//line testdata/templates/integration.qtpl:444
+	return qe422016
+//line testdata/templates/integration.qtpl:444
 }
 
-//line testdata/templates/integration.qtpl:123
+//line testdata/templates/integration.qtpl:447
+func lookup(m map[string]string, k string) (string, bool) {
+	v, ok := m[k]
+	return v, ok
+}
+
+//line testdata/templates/integration.qtpl:454
+type integrationUser struct {
+	Profile *integrationProfile
+}
+
+type integrationProfile struct {
+	Name string
+	Age  int
+}
+
+//line testdata/templates/integration.qtpl:465
+type integrationTag string
+
+func (t integrationTag) String() string {
+	return "tag:" + string(t)
+}
+
+//line testdata/templates/integration.qtpl:473
 type integrationPage struct {
 	S string
 }
 
-//line testdata/templates/integration.qtpl:128
+//line testdata/templates/integration.qtpl:478
 func (p *integrationPage) StreamHeader(qw422016 *qt422016.Writer) {
-	//line testdata/templates/integration.qtpl:128
+	//line testdata/templates/integration.qtpl:478
 	qw422016.N().S(`Header`)
-//line testdata/templates/integration.qtpl:128
+//line testdata/templates/integration.qtpl:478
 }
 
-//line testdata/templates/integration.qtpl:128
+//line testdata/templates/integration.qtpl:478
 func (p *integrationPage) WriteHeader(qq422016 qtio422016.Writer) {
-	//line testdata/templates/integration.qtpl:128
+	//line testdata/templates/integration.qtpl:478
 	qw422016 := qt422016.AcquireWriter(qq422016)
-	//line testdata/templates/integration.qtpl:128
+	//line testdata/templates/integration.qtpl:478
 	p.StreamHeader(qw422016)
-	//line testdata/templates/integration.qtpl:128
+	//line testdata/templates/integration.qtpl:478
 	qt422016.ReleaseWriter(qw422016)
-//line testdata/templates/integration.qtpl:128
+//line testdata/templates/integration.qtpl:478
 }
 
-//line testdata/templates/integration.qtpl:128
+//line testdata/templates/integration.qtpl:478
 func (p *integrationPage) Header() string {
-	//line testdata/templates/integration.qtpl:128
+	//line testdata/templates/integration.qtpl:478
 	qb422016 := qt422016.AcquireByteBuffer()
-	//line testdata/templates/integration.qtpl:128
+	//line testdata/templates/integration.qtpl:478
 	p.WriteHeader(qb422016)
-	//line testdata/templates/integration.qtpl:128
+	//line testdata/templates/integration.qtpl:478
 	qs422016 := string(qb422016.B)
-	//line testdata/templates/integration.qtpl:128
+	//line testdata/templates/integration.qtpl:478
 	qt422016.ReleaseByteBuffer(qb422016)
-	//line testdata/templates/integration.qtpl:128
+	//line testdata/templates/integration.qtpl:478
 	return qs422016
-//line testdata/templates/integration.qtpl:128
+//line testdata/templates/integration.qtpl:478
+}
+
+//line testdata/templates/integration.qtpl:478
+func (p *integrationPage) AppendHeader(dst422016 []byte) []byte {
+	//line testdata/templates/integration.qtpl:478
+	qb422016 := qt422016.AcquireByteBuffer()
+	//line testdata/templates/integration.qtpl:478
+	qz422016 := qb422016.B
+	//line testdata/templates/integration.qtpl:478
+	qb422016.B = dst422016
+	//line testdata/templates/integration.qtpl:478
+	p.WriteHeader(qb422016)
+	//line testdata/templates/integration.qtpl:478
+	dst422016 = qb422016.B
+	//line testdata/templates/integration.qtpl:478
+	qb422016.B = qz422016
+	//line testdata/templates/integration.qtpl:478
+	qt422016.ReleaseByteBuffer(qb422016)
+	//line testdata/templates/integration.qtpl:478
+	return dst422016
+//line testdata/templates/integration.qtpl:478
+}
+
+//line testdata/templates/integration.qtpl:478
+func (p *integrationPage) WriteHeaderErr(qq422016 qtio422016.Writer) error {
+	//line testdata/templates/integration.qtpl:478
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	//line testdata/templates/integration.qtpl:478
+	p.StreamHeader(qw422016)
+	//line testdata/templates/integration.qtpl:478
+	qe422016 := qw422016.Err()
+	//line testdata/templates/integration.qtpl:478
+	qt422016.ReleaseWriter(qw422016)
+	//line testdata/templates/integration.qtpl:478
+	return qe422016
+//line testdata/templates/integration.qtpl:478
 }
 
-//line testdata/templates/integration.qtpl:130
+//line testdata/templates/integration.qtpl:480
 func (p *integrationPage) StreamBody(qw422016 *qt422016.Writer) {
-	//line testdata/templates/integration.qtpl:130
+	//line testdata/templates/integration.qtpl:480
 	qw422016.N().S(`
 	S=`)
-	//line testdata/templates/integration.qtpl:131
+	//line testdata/templates/integration.qtpl:481
 	qw422016.E().Q(p.S)
-	//line testdata/templates/integration.qtpl:131
+	//line testdata/templates/integration.qtpl:481
 	qw422016.N().S(`
 `)
-//line testdata/templates/integration.qtpl:132
+//line testdata/templates/integration.qtpl:482
 }
 
-//line testdata/templates/integration.qtpl:132
+//line testdata/templates/integration.qtpl:482
 func (p *integrationPage) WriteBody(qq422016 qtio422016.Writer) {
-	//line testdata/templates/integration.qtpl:132
+	//line testdata/templates/integration.qtpl:482
 	qw422016 := qt422016.AcquireWriter(qq422016)
-	//line testdata/templates/integration.qtpl:132
+	//line testdata/templates/integration.qtpl:482
 	p.StreamBody(qw422016)
-	//line testdata/templates/integration.qtpl:132
+	//line testdata/templates/integration.qtpl:482
 	qt422016.ReleaseWriter(qw422016)
-//line testdata/templates/integration.qtpl:132
+//line testdata/templates/integration.qtpl:482
 }
 
-//line testdata/templates/integration.qtpl:132
+//line testdata/templates/integration.qtpl:482
 func (p *integrationPage) Body() string {
-	//line testdata/templates/integration.qtpl:132
+	//line testdata/templates/integration.qtpl:482
 	qb422016 := qt422016.AcquireByteBuffer()
-	//line testdata/templates/integration.qtpl:132
+	//line testdata/templates/integration.qtpl:482
 	p.WriteBody(qb422016)
-	//line testdata/templates/integration.qtpl:132
+	//line testdata/templates/integration.qtpl:482
 	qs422016 := string(qb422016.B)
-	//line testdata/templates/integration.qtpl:132
+	//line testdata/templates/integration.qtpl:482
 	qt422016.ReleaseByteBuffer(qb422016)
-	//line testdata/templates/integration.qtpl:132
+	//line testdata/templates/integration.qtpl:482
 	return qs422016
-//line testdata/templates/integration.qtpl:132
+//line testdata/templates/integration.qtpl:482
+}
+
+//line testdata/templates/integration.qtpl:482
+func (p *integrationPage) AppendBody(dst422016 []byte) []byte {
+	//line testdata/templates/integration.qtpl:482
+	qb422016 := qt422016.AcquireByteBuffer()
+	//line testdata/templates/integration.qtpl:482
+	qz422016 := qb422016.B
+	//line testdata/templates/integration.qtpl:482
+	qb422016.B = dst422016
+	//line testdata/templates/integration.qtpl:482
+	p.WriteBody(qb422016)
+	//line testdata/templates/integration.qtpl:482
+	dst422016 = qb422016.B
+	//line testdata/templates/integration.qtpl:482
+	qb422016.B = qz422016
+	//line testdata/templates/integration.qtpl:482
+	qt422016.ReleaseByteBuffer(qb422016)
+	//line testdata/templates/integration.qtpl:482
+	return dst422016
+//line testdata/templates/integration.qtpl:482
+}
+
+//line testdata/templates/integration.qtpl:482
+func (p *integrationPage) WriteBodyErr(qq422016 qtio422016.Writer) error {
+	//line testdata/templates/integration.qtpl:482
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	//line testdata/templates/integration.qtpl:482
+	p.StreamBody(qw422016)
+	//line testdata/templates/integration.qtpl:482
+	qe422016 := qw422016.Err()
+	//line testdata/templates/integration.qtpl:482
+	qt422016.ReleaseWriter(qw422016)
+	//line testdata/templates/integration.qtpl:482
+	return qe422016
+//line testdata/templates/integration.qtpl:482
 }
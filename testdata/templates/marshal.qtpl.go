@@ -1,4 +1,4 @@
-// This file is automatically generated by qtc from "marshal.qtpl".
+// Code generated by qtc from "marshal.qtpl". DO NOT EDIT.
 // See https://github.com/valyala/quicktemplate for details.
 
 // Templates for marshal_timing_test.go
@@ -14,12 +14,6 @@ import (
 	qt422016 "github.com/valyala/quicktemplate"
 )
 
-//line testdata/templates/marshal.qtpl:3
-var (
-	_ = qtio422016.Copy
-	_ = qt422016.AcquireByteBuffer
-)
-
 //line testdata/templates/marshal.qtpl:4
 type MarshalRow struct {
 	Msg string
@@ -33,7 +27,7 @@ type MarshalData struct {
 }
 
 // JSON marshaling
-
+//
 //line testdata/templates/marshal.qtpl:18
 func (d *MarshalData) StreamJSON(qw422016 *qt422016.Writer) {
 	//line testdata/templates/marshal.qtpl:18
@@ -71,6 +65,8 @@ func (d *MarshalData) StreamJSON(qw422016 *qt422016.Writer) {
 //line testdata/templates/marshal.qtpl:32
 }
 
+// JSON marshaling
+//
 //line testdata/templates/marshal.qtpl:32
 func (d *MarshalData) WriteJSON(qq422016 qtio422016.Writer) {
 	//line testdata/templates/marshal.qtpl:32
@@ -82,6 +78,8 @@ func (d *MarshalData) WriteJSON(qq422016 qtio422016.Writer) {
 //line testdata/templates/marshal.qtpl:32
 }
 
+// JSON marshaling
+//
 //line testdata/templates/marshal.qtpl:32
 func (d *MarshalData) JSON() string {
 	//line testdata/templates/marshal.qtpl:32
@@ -97,8 +95,48 @@ func (d *MarshalData) JSON() string {
 //line testdata/templates/marshal.qtpl:32
 }
 
-// XML marshaling
+// JSON marshaling
+//
+//line testdata/templates/marshal.qtpl:32
+func (d *MarshalData) AppendJSON(dst422016 []byte) []byte {
+	//line testdata/templates/marshal.qtpl:32
+	qb422016 := qt422016.AcquireByteBuffer()
+	//line testdata/templates/marshal.qtpl:32
+	qz422016 := qb422016.B
+	//line testdata/templates/marshal.qtpl:32
+	qb422016.B = dst422016
+	//line testdata/templates/marshal.qtpl:32
+	d.WriteJSON(qb422016)
+	//line testdata/templates/marshal.qtpl:32
+	dst422016 = qb422016.B
+	//line testdata/templates/marshal.qtpl:32
+	qb422016.B = qz422016
+	//line testdata/templates/marshal.qtpl:32
+	qt422016.ReleaseByteBuffer(qb422016)
+	//line testdata/templates/marshal.qtpl:32
+	return dst422016
+//line testdata/templates/marshal.qtpl:32
+}
 
+// JSON marshaling
+//
+//line testdata/templates/marshal.qtpl:32
+func (d *MarshalData) WriteJSONErr(qq422016 qtio422016.Writer) error {
+	//line testdata/templates/marshal.qtpl:32
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	//line testdata/templates/marshal.qtpl:32
+	d.StreamJSON(qw422016)
+	//line testdata/templates/marshal.qtpl:32
+	qe422016 := qw422016.Err()
+	//line testdata/templates/marshal.qtpl:32
+	qt422016.ReleaseWriter(qw422016)
+	//line testdata/templates/marshal.qtpl:32
+	return qe422016
+//line testdata/templates/marshal.qtpl:32
+}
+
+// XML marshaling
+//
 //line testdata/templates/marshal.qtpl:37
 func (d *MarshalData) StreamXML(qw422016 *qt422016.Writer) {
 	//line testdata/templates/marshal.qtpl:37
@@ -130,6 +168,8 @@ func (d *MarshalData) StreamXML(qw422016 *qt422016.Writer) {
 //line testdata/templates/marshal.qtpl:48
 }
 
+// XML marshaling
+//
 //line testdata/templates/marshal.qtpl:48
 func (d *MarshalData) WriteXML(qq422016 qtio422016.Writer) {
 	//line testdata/templates/marshal.qtpl:48
@@ -141,6 +181,8 @@ func (d *MarshalData) WriteXML(qq422016 qtio422016.Writer) {
 //line testdata/templates/marshal.qtpl:48
 }
 
+// XML marshaling
+//
 //line testdata/templates/marshal.qtpl:48
 func (d *MarshalData) XML() string {
 	//line testdata/templates/marshal.qtpl:48
@@ -155,3 +197,43 @@ func (d *MarshalData) XML() string {
 	return qs422016
 //line testdata/templates/marshal.qtpl:48
 }
+
+// XML marshaling
+//
+//line testdata/templates/marshal.qtpl:48
+func (d *MarshalData) AppendXML(dst422016 []byte) []byte {
+	//line testdata/templates/marshal.qtpl:48
+	qb422016 := qt422016.AcquireByteBuffer()
+	//line testdata/templates/marshal.qtpl:48
+	qz422016 := qb422016.B
+	//line testdata/templates/marshal.qtpl:48
+	qb422016.B = dst422016
+	//line testdata/templates/marshal.qtpl:48
+	d.WriteXML(qb422016)
+	//line testdata/templates/marshal.qtpl:48
+	dst422016 = qb422016.B
+	//line testdata/templates/marshal.qtpl:48
+	qb422016.B = qz422016
+	//line testdata/templates/marshal.qtpl:48
+	qt422016.ReleaseByteBuffer(qb422016)
+	//line testdata/templates/marshal.qtpl:48
+	return dst422016
+//line testdata/templates/marshal.qtpl:48
+}
+
+// XML marshaling
+//
+//line testdata/templates/marshal.qtpl:48
+func (d *MarshalData) WriteXMLErr(qq422016 qtio422016.Writer) error {
+	//line testdata/templates/marshal.qtpl:48
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	//line testdata/templates/marshal.qtpl:48
+	d.StreamXML(qw422016)
+	//line testdata/templates/marshal.qtpl:48
+	qe422016 := qw422016.Err()
+	//line testdata/templates/marshal.qtpl:48
+	qt422016.ReleaseWriter(qw422016)
+	//line testdata/templates/marshal.qtpl:48
+	return qe422016
+//line testdata/templates/marshal.qtpl:48
+}
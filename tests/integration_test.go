@@ -1,9 +1,18 @@
 package tests
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
 	"io/ioutil"
+	"strings"
 	"testing"
+	"testing/iotest"
+	"time"
 
+	"github.com/valyala/quicktemplate"
 	"github.com/valyala/quicktemplate/testdata/templates"
 )
 
@@ -17,3 +26,395 @@ func TestIntegration(t *testing.T) {
 		t.Fatalf("unexpected output\n%q\nExpecting\n%q\n", s, expectedS)
 	}
 }
+
+func TestIntegrationAppend(t *testing.T) {
+	s := templates.Integration()
+	prefix := "prefix"
+	b := templates.AppendIntegration([]byte(prefix))
+	if string(b) != prefix+s {
+		t.Fatalf("unexpected output\n%q\nExpecting\n%q\n", b, prefix+s)
+	}
+
+	// nil dst results in the same bytes as the string form
+	if b := templates.AppendIntegration(nil); string(b) != s {
+		t.Fatalf("unexpected output\n%q\nExpecting\n%q\n", b, s)
+	}
+	rows := getBenchRows(10)
+	if b, s := templates.AppendBenchPage(nil, rows), templates.BenchPage(rows); string(b) != s {
+		t.Fatalf("unexpected output\n%q\nExpecting\n%q\n", b, s)
+	}
+
+	// no allocations if dst has enough capacity
+	dst := templates.AppendBenchPage(nil, rows)
+	n := testing.AllocsPerRun(100, func() {
+		dst = templates.AppendBenchPage(dst[:0], rows)
+	})
+	if n > 0 {
+		t.Fatalf("unexpected number of allocations: %v. Expecting 0", n)
+	}
+}
+
+func TestIntegrationRaw(t *testing.T) {
+	for _, s := range []string{"", "foo", "<b>trusted & \"safe\"</b>"} {
+		result := templates.IntegrationRaw(s, []byte(s))
+		expected := templates.IntegrationUnescaped(s, []byte(s))
+		if result != expected {
+			t.Fatalf("unexpected output\n%q\nExpecting\n%q\n", result, expected)
+		}
+	}
+
+	// no allocations for strings and byte slices if dst has enough capacity
+	s := "<b>trusted</b>"
+	b := []byte(s)
+	dst := templates.AppendIntegrationRaw(nil, s, b)
+	n := testing.AllocsPerRun(100, func() {
+		dst = templates.AppendIntegrationRaw(dst[:0], s, b)
+	})
+	if n > 0 {
+		t.Fatalf("unexpected number of allocations: %v. Expecting 0", n)
+	}
+}
+
+func TestIntegrationEscaper(t *testing.T) {
+	var bb bytes.Buffer
+	var ew *recordingEscaper
+	qw := quicktemplate.AcquireWriterEscaper(&bb, func(dst io.Writer) io.Writer {
+		ew = &recordingEscaper{w: dst}
+		return ew
+	})
+	templates.StreamIntegrationCard(qw, "<title>", "sub", 3)
+	templates.StreamIntegrationRaw(qw, "<raw>", []byte("<b>"))
+	templates.StreamIntegrationCtx(qw, context.WithValue(context.Background(), templates.IntegrationCtxKey{}, "v"), "<name>")
+	quicktemplate.ReleaseWriter(qw)
+
+	// Only the escaped output goes through the escaper.
+	expectedCalls := []string{"<title>", "sub", "<name>", "v"}
+	if fmt.Sprintf("%q", ew.calls) != fmt.Sprintf("%q", expectedCalls) {
+		t.Fatalf("unexpected escaper calls %q. Expecting %q", ew.calls, expectedCalls)
+	}
+	expectedS := "<h1><title></h1><h2>sub</h2><p>3</p><raw> <b> 42<p><name>=v</p>"
+	if bb.String() != expectedS {
+		t.Fatalf("unexpected output\n%q\nExpecting\n%q\n", bb.String(), expectedS)
+	}
+}
+
+// recordingEscaper records the data written via quicktemplate.Writer.E()
+// and writes it to w as is.
+type recordingEscaper struct {
+	w     io.Writer
+	calls []string
+}
+
+func (w *recordingEscaper) Write(p []byte) (int, error) {
+	w.calls = append(w.calls, string(p))
+	return w.w.Write(p)
+}
+
+func TestIntegrationCtx(t *testing.T) {
+	ctx := context.WithValue(context.Background(), templates.IntegrationCtxKey{}, "<value>")
+	result := templates.IntegrationCtx(ctx, "<name>")
+	expected := "<p>&lt;name&gt;=&lt;value&gt;</p>"
+	if result != expected {
+		t.Fatalf("unexpected output\n%q\nExpecting\n%q\n", result, expected)
+	}
+
+	var bb bytes.Buffer
+	templates.WriteIntegrationCtx(&bb, ctx, "<name>")
+	if bb.String() != expected {
+		t.Fatalf("unexpected output\n%q\nExpecting\n%q\n", bb.String(), expected)
+	}
+}
+
+func TestIntegrationCopy(t *testing.T) {
+	var bb bytes.Buffer
+	templates.WriteIntegrationCopy(&bb, strings.NewReader("<b>copied</b>"))
+	if bb.String() != "<pre><b>copied</b></pre>" {
+		t.Fatalf("unexpected output %q. Expecting %q", bb.String(), "<pre><b>copied</b></pre>")
+	}
+
+	// the reader contents are streamed to the output without buffering
+	w := &countingWriter{}
+	r := &streamReader{
+		w:      w,
+		chunks: 100,
+		chunk:  strings.Repeat("x", 1000),
+	}
+	templates.WriteIntegrationCopy(w, r)
+	if r.lagged {
+		t.Fatalf("the reader contents must be written to the output before reading the next chunk")
+	}
+	if expectedN := len("<pre>") + r.chunks*len(r.chunk) + len("</pre>"); w.n != expectedN {
+		t.Fatalf("unexpected output length: %d. Expecting %d", w.n, expectedN)
+	}
+
+	// read error is returned by WriteFErr
+	errRead := errors.New("read error")
+	err := templates.WriteIntegrationCopyErr(&bb, iotest.ErrReader(errRead))
+	if err != errRead {
+		t.Fatalf("unexpected error: %v. Expecting %v", err, errRead)
+	}
+}
+
+func TestIntegrationChan(t *testing.T) {
+	// all the buffered values are rendered from the closed channel
+	ch := make(chan string, 3)
+	ch <- "a"
+	ch <- "<b>"
+	ch <- "c"
+	close(ch)
+	s := templates.IntegrationChan(context.Background(), ch)
+	if expectedS := "<ul><li>a</li><li>&lt;b&gt;</li><li>c</li></ul>"; s != expectedS {
+		t.Fatalf("unexpected output %q. Expecting %q", s, expectedS)
+	}
+
+	// ctx cancellation stops rendering the channel, which is never closed
+	ctx, cancel := context.WithCancel(context.Background())
+	ch = make(chan string)
+	go func() {
+		for _, v := range []string{"a", "b", "c"} {
+			ch <- v
+		}
+		cancel()
+	}()
+	resultCh := make(chan string, 1)
+	go func() {
+		resultCh <- templates.IntegrationChan(ctx, ch)
+	}()
+	select {
+	case s = <-resultCh:
+	case <-time.After(time.Second):
+		t.Fatalf("timeout when rendering the channel after ctx cancellation")
+	}
+	if expectedS := "<ul><li>a</li><li>b</li><li>c</li></ul>"; s != expectedS {
+		t.Fatalf("unexpected output %q. Expecting %q", s, expectedS)
+	}
+}
+
+func TestIntegrationChanArg(t *testing.T) {
+	ch := make(chan string, 2)
+	ch <- "a"
+	ch <- "<b>"
+	close(ch)
+	s := templates.IntegrationChanArg(ch)
+	if expectedS := "<ul><li>a</li><li>&lt;b&gt;</li></ul>"; s != expectedS {
+		t.Fatalf("unexpected output %q. Expecting %q", s, expectedS)
+	}
+}
+
+func TestIntegrationFuncDefaults(t *testing.T) {
+	s := templates.IntegrationCard("<t>", "sub", 3)
+	if expectedS := "<h1>&lt;t&gt;</h1><h2>sub</h2><p>3</p>"; s != expectedS {
+		t.Fatalf("unexpected output %q. Expecting %q", s, expectedS)
+	}
+
+	// the defaults func passes the default values to the omitted args
+	expectedS := templates.IntegrationCard("<t>", "none", -1)
+	s = templates.IntegrationCardDefaults("<t>")
+	if s != expectedS {
+		t.Fatalf("unexpected output %q. Expecting %q", s, expectedS)
+	}
+	var bb bytes.Buffer
+	templates.WriteIntegrationCardDefaults(&bb, "<t>")
+	if bb.String() != expectedS {
+		t.Fatalf("unexpected output %q. Expecting %q", bb.String(), expectedS)
+	}
+}
+
+func TestIntegrationErrResult(t *testing.T) {
+	s, err := templates.IntegrationItems([]string{"a", "<b>"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if expectedS := "<ul><li>a</li><li>&lt;b&gt;</li></ul>"; s != expectedS {
+		t.Fatalf("unexpected output %q. Expecting %q", s, expectedS)
+	}
+
+	// the error returned by the nested func is returned with an empty string
+	s, err = templates.IntegrationItems([]string{"a", "", "c"})
+	if err != templates.ErrIntegrationEmptyItem {
+		t.Fatalf("unexpected error: %v. Expecting %v", err, templates.ErrIntegrationEmptyItem)
+	}
+	if s != "" {
+		t.Fatalf("unexpected non-empty output on error: %q", s)
+	}
+
+	// the write func leaves the output written before the error
+	var bb bytes.Buffer
+	if err := templates.WriteIntegrationItems(&bb, []string{"a", "", "c"}); err != templates.ErrIntegrationEmptyItem {
+		t.Fatalf("unexpected error: %v. Expecting %v", err, templates.ErrIntegrationEmptyItem)
+	}
+	if expectedS := "<ul><li>a</li>"; bb.String() != expectedS {
+		t.Fatalf("unexpected output %q. Expecting %q", bb.String(), expectedS)
+	}
+
+	// the write func returns write errors
+	w := &failingWriter{n: 5}
+	if err := templates.WriteIntegrationItems(w, []string{"a", "b"}); err != errFailingWriter {
+		t.Fatalf("unexpected error: %v. Expecting %v", err, errFailingWriter)
+	}
+}
+
+func TestIntegrationWriterTo(t *testing.T) {
+	f := func(wt io.WriterTo, expectedS string) {
+		t.Helper()
+
+		// io.Copy must use WriteTo instead of Read.
+		var bb bytes.Buffer
+		n, err := io.Copy(&bb, writerToReader{wt})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if bb.String() != expectedS {
+			t.Fatalf("unexpected output %q. Expecting %q", bb.String(), expectedS)
+		}
+		if n != int64(len(expectedS)) {
+			t.Fatalf("unexpected number of bytes written: %d. Expecting %d", n, len(expectedS))
+		}
+	}
+	f(templates.NewIntegrationGreetingWriterTo("<foo>"), templates.IntegrationGreeting("<foo>"))
+	f(templates.NewIntegrationGreetingWriterTo("bar", "a", "<b>"), "Hello, bar! #a #&lt;b&gt;")
+	f(templates.NewIntegrationItemsWriterTo([]string{"a", "b"}), "<ul><li>a</li><li>b</li></ul>")
+
+	// write errors are returned with the number of bytes written
+	w := &failingWriter{n: 5}
+	n, err := templates.NewIntegrationGreetingWriterTo("bar").WriteTo(w)
+	if err != errFailingWriter {
+		t.Fatalf("unexpected error: %v. Expecting %v", err, errFailingWriter)
+	}
+	if n != 5 {
+		t.Fatalf("unexpected number of bytes written: %d. Expecting 5", n)
+	}
+
+	// errors returned by err funcs are returned
+	var bb bytes.Buffer
+	n, err = templates.NewIntegrationItemsWriterTo([]string{"a", "", "c"}).WriteTo(&bb)
+	if err != templates.ErrIntegrationEmptyItem {
+		t.Fatalf("unexpected error: %v. Expecting %v", err, templates.ErrIntegrationEmptyItem)
+	}
+	if expectedS := "<ul><li>a</li>"; bb.String() != expectedS || n != int64(len(expectedS)) {
+		t.Fatalf("unexpected output %q with %d bytes written. Expecting %q", bb.String(), n, expectedS)
+	}
+}
+
+// writerToReader is io.Reader, which may be copied only via WriteTo.
+type writerToReader struct {
+	io.WriterTo
+}
+
+func (r writerToReader) Read(p []byte) (int, error) {
+	return 0, errors.New("Read mustn't be called, since WriteTo is available")
+}
+
+// countingWriter counts the written bytes.
+type countingWriter struct {
+	n int
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += len(p)
+	return len(p), nil
+}
+
+// streamReader returns chunks one by one and verifies that all the previously
+// read chunks are already written to w.
+type streamReader struct {
+	w      *countingWriter
+	chunks int
+	chunk  string
+
+	read   int
+	lagged bool
+}
+
+func (r *streamReader) Read(p []byte) (int, error) {
+	if r.w.n != len("<pre>")+r.read {
+		r.lagged = true
+	}
+	if r.read == r.chunks*len(r.chunk) {
+		return 0, io.EOF
+	}
+	n := copy(p, r.chunk)
+	r.read += n
+	return n, nil
+}
+
+func TestIntegrationWriteErr(t *testing.T) {
+	s := templates.Integration()
+
+	var bb bytes.Buffer
+	if err := templates.WriteIntegrationErr(&bb); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if bb.String() != s {
+		t.Fatalf("unexpected output\n%q\nExpecting\n%q\n", bb.String(), s)
+	}
+
+	for _, n := range []int{0, 10, len(s) / 2, len(s) - 1} {
+		w := &failingWriter{n: n}
+		if err := templates.WriteIntegrationErr(w); err != errFailingWriter {
+			t.Fatalf("unexpected error after writing %d bytes: %v. Expecting %v", n, err, errFailingWriter)
+		}
+		if w.writes > 0 {
+			t.Fatalf("unexpected %d writes after the error for n=%d", w.writes, n)
+		}
+	}
+}
+
+func TestIntegrationStreaming(t *testing.T) {
+	// The output must reach the writer while the template is rendered.
+	w := &slowWriter{}
+	n := 0
+	templates.WriteIntegrationProgress(w, 3, func(i int) {
+		expectedS := fmt.Sprintf("<p>%d</p>", i)
+		if !strings.HasSuffix(w.String(), expectedS) {
+			t.Fatalf("missing %q in the output written before item %d: %q", expectedS, i, w.String())
+		}
+		n++
+	})
+	if n != 3 {
+		t.Fatalf("unexpected number of progress calls: %d. Expecting 3", n)
+	}
+	if w.writes < n {
+		t.Fatalf("unexpected number of writes: %d. Expecting at least %d", w.writes, n)
+	}
+}
+
+// slowWriter delays every write.
+type slowWriter struct {
+	b      bytes.Buffer
+	writes int
+}
+
+func (w *slowWriter) Write(p []byte) (int, error) {
+	time.Sleep(time.Millisecond)
+	w.writes++
+	return w.b.Write(p)
+}
+
+func (w *slowWriter) String() string {
+	return w.b.String()
+}
+
+var errFailingWriter = errors.New("failing writer")
+
+// failingWriter fails after writing n bytes.
+type failingWriter struct {
+	n      int
+	failed bool
+
+	// writes is the number of writes after the error.
+	writes int
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if w.failed {
+		w.writes++
+		return 0, errFailingWriter
+	}
+	if len(p) > w.n {
+		w.failed = true
+		return w.n, errFailingWriter
+	}
+	w.n -= len(p)
+	return len(p), nil
+}
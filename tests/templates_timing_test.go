@@ -1,9 +1,11 @@
 package tests
 
 import (
+	"bufio"
 	"bytes"
 	"fmt"
 	"html/template"
+	"io"
 	"log"
 	"testing"
 
@@ -28,6 +30,31 @@ func init() {
 	if !bytes.Equal(bb1.B, bb2.B) {
 		log.Fatalf("results mismatch:\n%q\n%q", bb1, bb2)
 	}
+
+	b3 := templates.AppendBenchPage(nil, rows)
+	if !bytes.Equal(b3, bb2.B) {
+		log.Fatalf("results mismatch:\n%q\n%q", b3, bb2)
+	}
+
+	// nested {%= %} calls must produce the same output as the flat template
+	if nested, flat := templates.BenchNested(42), templates.BenchFlat(42); nested != flat {
+		log.Fatalf("results mismatch:\n%q\n%q", nested, flat)
+	}
+
+	// {%= %} calls to inline funcs must produce the same output as the flat template
+	if inlined, flat := templates.BenchInlined(42), templates.BenchFlat(42); inlined != flat {
+		log.Fatalf("results mismatch:\n%q\n%q", inlined, flat)
+	}
+
+	// hint(N) mustn't change the output
+	if large, hinted := templates.BenchLarge(rows), templates.BenchLargeHinted(rows); large != hinted {
+		log.Fatalf("results mismatch:\n%q\n%q", large, hinted)
+	}
+
+	// {%v:stringer %} must produce the same output as {%v %}
+	if v, vs := templates.BenchValueStringer(42), templates.BenchValueStringerTag(42); v != vs {
+		log.Fatalf("results mismatch:\n%q\n%q", v, vs)
+	}
 }
 
 func BenchmarkQuickTemplate1(b *testing.B) {
@@ -54,6 +81,156 @@ func benchmarkQuickTemplate(b *testing.B, rowsCount int) {
 	})
 }
 
+func BenchmarkQuickTemplateAppend1(b *testing.B) {
+	benchmarkQuickTemplateAppend(b, 1)
+}
+
+func BenchmarkQuickTemplateAppend10(b *testing.B) {
+	benchmarkQuickTemplateAppend(b, 10)
+}
+
+func BenchmarkQuickTemplateAppend100(b *testing.B) {
+	benchmarkQuickTemplateAppend(b, 100)
+}
+
+func benchmarkQuickTemplateAppend(b *testing.B, rowsCount int) {
+	rows := getBenchRows(rowsCount)
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		var dst []byte
+		for pb.Next() {
+			dst = templates.AppendBenchPage(dst[:0], rows)
+		}
+	})
+}
+
+func BenchmarkQuickTemplateString10(b *testing.B) {
+	rows := getBenchRows(10)
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			s := templates.BenchPage(rows)
+			if len(s) == 0 {
+				b.Fatalf("unexpected empty output")
+			}
+		}
+	})
+}
+
+func BenchmarkQuickTemplateStringLarge(b *testing.B) {
+	benchmarkQuickTemplateStringLarge(b, templates.BenchLarge)
+}
+
+// BenchmarkQuickTemplateStringLargeHinted measures the string func with
+// hint(N), which pre-sizes the buffer for the output.
+func BenchmarkQuickTemplateStringLargeHinted(b *testing.B) {
+	benchmarkQuickTemplateStringLarge(b, templates.BenchLargeHinted)
+}
+
+func benchmarkQuickTemplateStringLarge(b *testing.B, f func(rows []templates.BenchRow) string) {
+	rows := getBenchRows(100)
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			s := f(rows)
+			if len(s) == 0 {
+				b.Fatalf("unexpected empty output")
+			}
+		}
+	})
+}
+
+func BenchmarkQuickTemplateStaticWriteString(b *testing.B) {
+	benchmarkQuickTemplateStatic(b, func(bb *quicktemplate.ByteBuffer) io.Writer { return bb })
+}
+
+func BenchmarkQuickTemplateStaticWriteOnly(b *testing.B) {
+	benchmarkQuickTemplateStatic(b, func(bb *quicktemplate.ByteBuffer) io.Writer { return writeOnlyWriter{bb} })
+}
+
+// benchmarkQuickTemplateStatic measures the template with only static text
+// written to writers with and without WriteString method.
+func benchmarkQuickTemplateStatic(b *testing.B, newWriter func(bb *quicktemplate.ByteBuffer) io.Writer) {
+	rows := getBenchRows(0)
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		bb := quicktemplate.AcquireByteBuffer()
+		w := newWriter(bb)
+		for pb.Next() {
+			templates.WriteBenchPage(w, rows)
+			bb.Reset()
+		}
+		quicktemplate.ReleaseByteBuffer(bb)
+	})
+}
+
+// BenchmarkQuickTemplateNested5 and BenchmarkQuickTemplateFlat5 measure
+// the overhead of {%= %} calls nested 5 levels deep. Nested funcs share
+// the already acquired writer, so nesting mustn't result in allocations.
+func BenchmarkQuickTemplateNested5(b *testing.B) {
+	benchmarkQuickTemplateNesting(b, templates.WriteBenchNested)
+}
+
+func BenchmarkQuickTemplateFlat5(b *testing.B) {
+	benchmarkQuickTemplateNesting(b, templates.WriteBenchFlat)
+}
+
+// BenchmarkQuickTemplateInlined5 measures {%= %} calls nested 5 levels deep
+// to inline funcs, which are expanded into the func bodies without calls.
+func BenchmarkQuickTemplateInlined5(b *testing.B) {
+	benchmarkQuickTemplateNesting(b, templates.WriteBenchInlined)
+}
+
+func benchmarkQuickTemplateNesting(b *testing.B, write func(w io.Writer, n int)) {
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		bb := quicktemplate.AcquireByteBuffer()
+		for pb.Next() {
+			write(bb, 42)
+			bb.Reset()
+		}
+		quicktemplate.ReleaseByteBuffer(bb)
+	})
+}
+
+func BenchmarkQuickTemplateBufioWriter(b *testing.B) {
+	benchmarkQuickTemplateBufio(b, func(bw *bufio.Writer) io.Writer { return bw })
+}
+
+// BenchmarkQuickTemplateBufioWriterWrapped measures *bufio.Writer hidden
+// behind another type, so QWriter cannot special-case it.
+func BenchmarkQuickTemplateBufioWriterWrapped(b *testing.B) {
+	benchmarkQuickTemplateBufio(b, func(bw *bufio.Writer) io.Writer { return bufioWriterWrapper{bw} })
+}
+
+func benchmarkQuickTemplateBufio(b *testing.B, newWriter func(bw *bufio.Writer) io.Writer) {
+	rows := getBenchRows(10)
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		bw := bufio.NewWriter(io.Discard)
+		w := newWriter(bw)
+		for pb.Next() {
+			templates.WriteBenchPage(w, rows)
+			templates.WriteBenchValueInt(w, 1234)
+		}
+		if err := bw.Flush(); err != nil {
+			b.Fatalf("unexpected error: %s", err)
+		}
+	})
+}
+
+type bufioWriterWrapper struct {
+	*bufio.Writer
+}
+
+type writeOnlyWriter struct {
+	w io.Writer
+}
+
+func (w writeOnlyWriter) Write(p []byte) (int, error) {
+	return w.w.Write(p)
+}
+
 func BenchmarkHTMLTemplate1(b *testing.B) {
 	benchmarkHTMLTemplate(b, 1)
 }
@@ -91,3 +268,40 @@ func getBenchRows(n int) []templates.BenchRow {
 	}
 	return rows
 }
+
+func BenchmarkQuickTemplateValue(b *testing.B) {
+	benchmarkQuickTemplateValue(b, templates.WriteBenchValue)
+}
+
+func BenchmarkQuickTemplateValueInt(b *testing.B) {
+	benchmarkQuickTemplateValue(b, templates.WriteBenchValueInt)
+}
+
+func BenchmarkQuickTemplateValueStringer(b *testing.B) {
+	benchmarkQuickTemplateValue(b, templates.WriteBenchValueStringer)
+}
+
+func BenchmarkQuickTemplateValueStringerTag(b *testing.B) {
+	benchmarkQuickTemplateValue(b, templates.WriteBenchValueStringerTag)
+}
+
+func BenchmarkQuickTemplatePrintf(b *testing.B) {
+	b.ReportAllocs()
+	benchmarkQuickTemplateValue(b, templates.WriteBenchPrintf)
+}
+
+func BenchmarkQuickTemplateSprintf(b *testing.B) {
+	b.ReportAllocs()
+	benchmarkQuickTemplateValue(b, templates.WriteBenchSprintf)
+}
+
+func benchmarkQuickTemplateValue(b *testing.B, write func(w io.Writer, n int)) {
+	b.RunParallel(func(pb *testing.PB) {
+		bb := quicktemplate.AcquireByteBuffer()
+		for pb.Next() {
+			write(bb, 1233455)
+			bb.Reset()
+		}
+		quicktemplate.ReleaseByteBuffer(bb)
+	})
+}
@@ -0,0 +1,36 @@
+package quicktemplate
+
+import (
+	"bytes"
+	"strings"
+)
+
+// Trim returns s without leading and trailing whitespace.
+//
+// It is used by the generated code for {%s trim s %} tags.
+// The returned string refers s, so it is obtained without memory allocations.
+func Trim(s string) string {
+	return strings.TrimSpace(s)
+}
+
+// TrimZ returns z without leading and trailing whitespace.
+//
+// It is used by the generated code for {%z trim z %} tags.
+// The returned slice refers z, so it is obtained without memory allocations.
+func TrimZ(z []byte) []byte {
+	return bytes.TrimSpace(z)
+}
+
+// TrimSet returns s without leading and trailing chars contained in cutset.
+//
+// It is used by the generated code for {%s trimset cutset s %} tags.
+func TrimSet(s, cutset string) string {
+	return strings.Trim(s, cutset)
+}
+
+// TrimSetZ returns z without leading and trailing chars contained in cutset.
+//
+// It is used by the generated code for {%z trimset cutset z %} tags.
+func TrimSetZ(z []byte, cutset string) []byte {
+	return bytes.Trim(z, cutset)
+}
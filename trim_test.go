@@ -0,0 +1,51 @@
+package quicktemplate
+
+import (
+	"testing"
+)
+
+func TestTrim(t *testing.T) {
+	testTrim(t, "", "")
+	testTrim(t, "foo", "foo")
+	testTrim(t, " \t\n foo bar \r\n", "foo bar")
+	testTrim(t, "   ", "")
+}
+
+func testTrim(t *testing.T, s, expectedS string) {
+	if result := Trim(s); result != expectedS {
+		t.Fatalf("unexpected Trim(%q): %q. Expecting %q", s, result, expectedS)
+	}
+	if result := TrimZ([]byte(s)); string(result) != expectedS {
+		t.Fatalf("unexpected TrimZ(%q): %q. Expecting %q", s, result, expectedS)
+	}
+}
+
+func TestTrimSet(t *testing.T) {
+	testTrimSet(t, "", ".,", "")
+	testTrimSet(t, "..foo, bar.,", ".,", "foo, bar")
+	testTrimSet(t, " .foo. ", ".,", " .foo. ")
+	testTrimSet(t, "foo", "", "foo")
+}
+
+func testTrimSet(t *testing.T, s, cutset, expectedS string) {
+	if result := TrimSet(s, cutset); result != expectedS {
+		t.Fatalf("unexpected TrimSet(%q, %q): %q. Expecting %q", s, cutset, result, expectedS)
+	}
+	if result := TrimSetZ([]byte(s), cutset); string(result) != expectedS {
+		t.Fatalf("unexpected TrimSetZ(%q, %q): %q. Expecting %q", s, cutset, result, expectedS)
+	}
+}
+
+func TestTrimNoAllocs(t *testing.T) {
+	s := "  foo  "
+	z := []byte(s)
+	n := testing.AllocsPerRun(100, func() {
+		_ = Trim(s)
+		_ = TrimZ(z)
+		_ = TrimSet(s, " o")
+		_ = TrimSetZ(z, " o")
+	})
+	if n > 0 {
+		t.Fatalf("unexpected number of allocations: %v. Expecting 0", n)
+	}
+}
@@ -1,6 +1,7 @@
 package quicktemplate
 
 import (
+	"bufio"
 	"fmt"
 	"io"
 	"strconv"
@@ -13,6 +14,9 @@ import (
 type Writer struct {
 	e QWriter
 	n QWriter
+
+	// hw is the default html escaper for e.
+	hw htmlEscapeWriter
 }
 
 // W returns the underlying writer passed to AcquireWriter.
@@ -30,20 +34,50 @@ func (qw *Writer) N() *QWriter {
 	return &qw.n
 }
 
+// Err returns the first error occurred when writing to the underlying
+// writer passed to AcquireWriter or when reading from the reader
+// passed to N().Copy.
+//
+// Subsequent writes via E() and N() are skipped after the error.
+func (qw *Writer) Err() error {
+	return qw.n.err
+}
+
 // AcquireWriter returns new writer from the pool.
 //
 // Return unneeded writer to the pool by calling ReleaseWriter
 // in order to reduce memory allocations.
+//
+// Writes to *bufio.Writer are special-cased, so pass it to AcquireWriter
+// as is instead of wrapping it into another io.Writer.
 func AcquireWriter(w io.Writer) *Writer {
 	v := writerPool.Get()
 	if v == nil {
-		qw := &Writer{}
-		qw.e.w = &htmlEscapeWriter{}
-		v = qw
+		v = &Writer{}
 	}
 	qw := v.(*Writer)
-	qw.e.w.(*htmlEscapeWriter).w = w
+	// Write escaped data via qw.n, so the first error stops
+	// writes via both qw.e and qw.n.
+	qw.hw.w = &qw.n
+	qw.e.w = &qw.hw
 	qw.n.w = w
+	qw.n.sw, _ = w.(stringWriter)
+	qw.n.bw, _ = w.(*bufio.Writer)
+	return qw
+}
+
+// AcquireWriterEscaper returns new writer from the pool, which escapes
+// the data written via E() with the writer returned by newEscaper
+// instead of html escaping.
+//
+// newEscaper must return io.Writer, which writes the escaped data to dst,
+// i.e. for escaping the output for non-html targets without changing
+// the template tags. Writes via N() aren't escaped.
+//
+// Return unneeded writer to the pool by calling ReleaseWriter.
+func AcquireWriterEscaper(w io.Writer, newEscaper func(dst io.Writer) io.Writer) *Writer {
+	qw := AcquireWriter(w)
+	qw.e.w = newEscaper(&qw.n)
 	return qw
 }
 
@@ -51,11 +85,8 @@ func AcquireWriter(w io.Writer) *Writer {
 //
 // Do not access released writer, otherwise data races may occur.
 func ReleaseWriter(qw *Writer) {
-	hw := qw.e.w.(*htmlEscapeWriter)
-	hw.w = nil
+	qw.hw.w = nil
 	qw.e.Reset()
-	qw.e.w = hw
-
 	qw.n.Reset()
 
 	writerPool.Put(qw)
@@ -63,11 +94,84 @@ func ReleaseWriter(qw *Writer) {
 
 var writerPool sync.Pool
 
+// AcquireCountingWriter returns new writer from the pool, which counts
+// the bytes written to w.
+//
+// Return the writer to the pool by calling ReleaseCountingWriter,
+// which returns the number of bytes written to w. This simplifies
+// io.WriterTo implementations.
+func AcquireCountingWriter(w io.Writer) *Writer {
+	v := countingWriterPool.Get()
+	if v == nil {
+		v = &countingWriter{}
+	}
+	cw := v.(*countingWriter)
+	cw.w = w
+	cw.sw, _ = w.(stringWriter)
+	return AcquireWriter(cw)
+}
+
+// ReleaseCountingWriter returns the writer obtained via AcquireCountingWriter
+// to the pool and returns the number of bytes written to the underlying
+// writer.
+//
+// Do not access released writer, otherwise data races may occur.
+func ReleaseCountingWriter(qw *Writer) int64 {
+	cw := qw.n.w.(*countingWriter)
+	n := cw.n
+	ReleaseWriter(qw)
+
+	cw.w = nil
+	cw.sw = nil
+	cw.n = 0
+	countingWriterPool.Put(cw)
+	return n
+}
+
+var countingWriterPool sync.Pool
+
+// countingWriter counts the bytes written to w.
+type countingWriter struct {
+	w  io.Writer
+	sw stringWriter
+	n  int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+func (cw *countingWriter) WriteString(s string) (int, error) {
+	if cw.sw == nil {
+		return cw.Write(unsafeStrToBytes(s))
+	}
+	n, err := cw.sw.WriteString(s)
+	cw.n += int64(n)
+	return n, err
+}
+
 // QWriter is auxiliary writer used by Writer.
 type QWriter struct {
 	w   io.Writer
 	err error
 	b   []byte
+
+	// sw is set if w implements stringWriter.
+	sw stringWriter
+
+	// bw is set if w is *bufio.Writer, so the output is written
+	// to it without indirect calls and numbers are formatted directly
+	// into its buffer.
+	bw *bufio.Writer
+}
+
+// stringWriter is implemented by writers capable of writing strings
+// without conversion to byte slices, i.e. bytes.Buffer, bufio.Writer
+// or ByteBuffer.
+type stringWriter interface {
+	WriteString(s string) (int, error)
 }
 
 // Write implements io.Writer.
@@ -75,7 +179,13 @@ func (w *QWriter) Write(p []byte) (int, error) {
 	if w.err != nil {
 		return 0, w.err
 	}
-	n, err := w.w.Write(p)
+	var n int
+	var err error
+	if w.bw != nil {
+		n, err = w.bw.Write(p)
+	} else {
+		n, err = w.w.Write(p)
+	}
 	if err != nil {
 		w.err = err
 	}
@@ -86,11 +196,30 @@ func (w *QWriter) Write(p []byte) (int, error) {
 func (w *QWriter) Reset() {
 	w.w = nil
 	w.err = nil
+	w.sw = nil
+	w.bw = nil
 }
 
 // S writes s to w.
+//
+// s is written via WriteString if the underlying writer implements it.
 func (w *QWriter) S(s string) {
-	w.Write(unsafeStrToBytes(s))
+	if w.sw == nil {
+		w.Write(unsafeStrToBytes(s))
+		return
+	}
+	if w.err != nil {
+		return
+	}
+	var err error
+	if w.bw != nil {
+		_, err = w.bw.WriteString(s)
+	} else {
+		_, err = w.sw.WriteString(s)
+	}
+	if err != nil {
+		w.err = err
+	}
 }
 
 // Z writes z to w.
@@ -109,11 +238,46 @@ func (w *QWriter) D(n int) {
 	if ok {
 		bb.B = strconv.AppendInt(bb.B, int64(n), 10)
 	} else {
-		w.b = strconv.AppendInt(w.b[:0], int64(n), 10)
-		w.Write(w.b)
+		w.writeNum(strconv.AppendInt(w.numBuf(), int64(n), 10))
+	}
+}
+
+// DN writes n to w with digits grouped by thousands, i.e. 1,234,567.
+func (w *QWriter) DN(n int) {
+	w.DNSep(n, ",")
+}
+
+// DNSep writes n to w with digits grouped by thousands
+// using the given separator, i.e. 1.234.567 for "." separator.
+func (w *QWriter) DNSep(n int, sep string) {
+	bb, ok := w.w.(*ByteBuffer)
+	if ok {
+		bb.B = appendIntSep(bb.B, n, sep)
+	} else {
+		w.writeNum(appendIntSep(w.numBuf(), n, sep))
 	}
 }
 
+func appendIntSep(dst []byte, n int, sep string) []byte {
+	u := uint64(n)
+	if n < 0 {
+		dst = append(dst, '-')
+		u = -u
+	}
+	var buf [20]byte
+	digits := strconv.AppendUint(buf[:0], u, 10)
+	k := len(digits) % 3
+	if k == 0 {
+		k = 3
+	}
+	dst = append(dst, digits[:k]...)
+	for digits = digits[k:]; len(digits) > 0; digits = digits[3:] {
+		dst = append(dst, sep...)
+		dst = append(dst, digits[:3]...)
+	}
+	return dst
+}
+
 // F writes f to w.
 func (w *QWriter) F(f float64) {
 	w.FPrec(f, -1)
@@ -125,11 +289,35 @@ func (w *QWriter) FPrec(f float64, prec int) {
 	if ok {
 		bb.B = strconv.AppendFloat(bb.B, f, 'f', prec, 64)
 	} else {
-		w.b = strconv.AppendFloat(w.b[:0], f, 'f', prec, 64)
-		w.Write(w.b)
+		w.writeNum(strconv.AppendFloat(w.numBuf(), f, 'f', prec, 64))
+	}
+}
+
+// numBuf returns the buffer for formatting the number,
+// which must be written via writeNum.
+//
+// The free space in the *bufio.Writer buffer is returned if it is big
+// enough for usual numbers, so the number isn't copied to it.
+func (w *QWriter) numBuf() []byte {
+	if w.bw != nil && w.bw.Available() >= maxNumLen {
+		return w.bw.AvailableBuffer()
 	}
+	return w.b[:0]
 }
 
+// writeNum writes the number formatted into the buffer returned by numBuf.
+func (w *QWriter) writeNum(b []byte) {
+	if w.bw == nil || cap(b) != w.bw.Available() {
+		// b doesn't refer to the *bufio.Writer buffer,
+		// so it may be reused.
+		w.b = b
+	}
+	w.Write(b)
+}
+
+// maxNumLen is the usual maximum length of the formatted number.
+const maxNumLen = 64
+
 // Q writes quoted json-safe s to w.
 func (w *QWriter) Q(s string) {
 	w.Write(strQuote)
@@ -163,6 +351,30 @@ func (w *QWriter) V(v interface{}) {
 	fmt.Fprintf(w, "%v", v)
 }
 
+// Printf writes args formatted according to format to w.
+//
+// See fmt.Printf for format details. Unlike fmt.Sprintf, the output
+// is written directly to w without allocating intermediate string.
+func (w *QWriter) Printf(format string, args ...interface{}) {
+	fmt.Fprintf(w, format, args...)
+}
+
+// Copy copies data from r to w until EOF.
+//
+// The data is streamed in chunks, so r contents aren't buffered in memory.
+// The data is copied directly to the underlying writer if Copy is called
+// on the QWriter returned by Writer.N, so io.ReaderFrom implementations
+// such as *os.File and *bufio.Writer are used. Read errors stop subsequent
+// writes to w like write errors do.
+func (w *QWriter) Copy(r io.Reader) {
+	if w.err != nil {
+		return
+	}
+	if _, err := io.Copy(w.w, r); err != nil {
+		w.err = err
+	}
+}
+
 // U writes url-encoded s to w.
 func (w *QWriter) U(s string) {
 	bb, ok := w.w.(*ByteBuffer)
@@ -178,3 +390,71 @@ func (w *QWriter) U(s string) {
 func (w *QWriter) UZ(z []byte) {
 	w.U(unsafeBytesToStr(z))
 }
+
+// JS writes s escaped for js string literal to w.
+//
+// The escaped value is safe inside '...' and "..." js string literals
+// in inline <script>.
+func (w *QWriter) JS(s string) {
+	bb, ok := w.w.(*ByteBuffer)
+	if ok {
+		bb.B = appendJSString(bb.B, s)
+	} else {
+		w.b = appendJSString(w.b[:0], s)
+		w.Write(w.b)
+	}
+}
+
+// CSS writes s escaped for css value to w.
+//
+// The escaped value is intended for css property values inside
+// <style> and style="..." attributes. Use CSS only on the QWriter
+// returned by Writer.N, since html escaping of the escaped value breaks it.
+func (w *QWriter) CSS(s string) {
+	bb, ok := w.w.(*ByteBuffer)
+	if ok {
+		bb.B = appendCSSEscape(bb.B, s)
+	} else {
+		w.b = appendCSSEscape(w.b[:0], s)
+		w.Write(w.b)
+	}
+}
+
+// X writes s escaped according to xml rules to w.
+//
+// Use X only on the QWriter returned by Writer.N,
+// since html escaping of the escaped value breaks it.
+func (w *QWriter) X(s string) {
+	bb, ok := w.w.(*ByteBuffer)
+	if ok {
+		bb.B = appendXMLEscape(bb.B, s)
+	} else {
+		w.b = appendXMLEscape(w.b[:0], s)
+		w.Write(w.b)
+	}
+}
+
+// XZ writes z escaped according to xml rules to w.
+func (w *QWriter) XZ(z []byte) {
+	w.X(unsafeBytesToStr(z))
+}
+
+// A writes s escaped for html attribute value to w.
+//
+// The escaped value is intended for double-quoted attributes.
+// Use A only on the QWriter returned by Writer.N,
+// since html escaping of the escaped value breaks it.
+func (w *QWriter) A(s string) {
+	bb, ok := w.w.(*ByteBuffer)
+	if ok {
+		bb.B = appendAttrEscape(bb.B, s)
+	} else {
+		w.b = appendAttrEscape(w.b[:0], s)
+		w.Write(w.b)
+	}
+}
+
+// AZ writes z escaped for html attribute value to w.
+func (w *QWriter) AZ(z []byte) {
+	w.A(unsafeBytesToStr(z))
+}
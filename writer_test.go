@@ -1,7 +1,15 @@
 package quicktemplate
 
 import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
 	"testing"
+	"testing/iotest"
 )
 
 func TestWriter(t *testing.T) {
@@ -31,6 +39,12 @@ func TestWriter(t *testing.T) {
 	wn.QZ([]byte("asadf"))
 	wn.JZ([]byte("asd"))
 	wn.UZ([]byte("abc"))
+	wn.A(`a "b'`)
+	wn.AZ([]byte("c=d"))
+	wn.JS("</x>")
+	wn.X("'")
+	wn.XZ([]byte("&"))
+	wn.CSS("a;b")
 
 	we.S("<a></a>")
 	we.D(321)
@@ -47,7 +61,7 @@ func TestWriter(t *testing.T) {
 
 	ReleaseWriter(qw)
 
-	expectedS := "<a></a>123'\"foo\"ds1.23%D0%B0%D0%B1%D0%B2{}aaa\"asadf\"asdabc" +
+	expectedS := "<a></a>123'\"foo\"ds1.23%D0%B0%D0%B1%D0%B2{}aaa\"asadf\"asdabca&#32;&quot;b&#39;c&#61;d\\u003c/x\\u003e&apos;&amp;a\\3b b" +
 		"&lt;a&gt;&lt;/a&gt;321&#39;&quot;foo&quot;ds1.23%D0%B0%D0%B1%D0%B2{}aaa&quot;asadf&quot;asdabc"
 	if string(bb.B) != expectedS {
 		t.Fatalf("unexpected output: %q. Expecting %q", bb.B, expectedS)
@@ -67,6 +81,272 @@ func TestQWriterS(t *testing.T) {
 	})
 }
 
+func TestQWriterSWriteString(t *testing.T) {
+	sw := &testStringWriter{}
+	qw := AcquireWriter(sw)
+	qw.N().S("foo")
+	qw.E().S("<bar>")
+	qw.N().Z([]byte("baz"))
+	ReleaseWriter(qw)
+
+	expectedS := "foo&lt;bar&gt;baz"
+	if sw.b.String() != expectedS {
+		t.Fatalf("unexpected output: %q. Expecting %q", sw.b.String(), expectedS)
+	}
+	if sw.writeStringCalls != 1 {
+		t.Fatalf("unexpected number of WriteString calls: %d. Expecting 1", sw.writeStringCalls)
+	}
+
+	// the first error is sticky
+	sw = &testStringWriter{err: errors.New("foobar")}
+	qw = AcquireWriter(sw)
+	wn := qw.N()
+	wn.S("foo")
+	wn.S("bar")
+	wn.Z([]byte("baz"))
+	ReleaseWriter(qw)
+	if sw.writeStringCalls != 1 {
+		t.Fatalf("unexpected number of WriteString calls: %d. Expecting 1", sw.writeStringCalls)
+	}
+	if sw.b.Len() > 0 {
+		t.Fatalf("unexpected output after error: %q", sw.b.String())
+	}
+}
+
+func TestWriterUnbuffered(t *testing.T) {
+	var bb bytes.Buffer
+	qw := AcquireWriter(&bb)
+	defer ReleaseWriter(qw)
+
+	// The data must be written to the underlying writer immediately,
+	// so the output isn't buffered until the template returns.
+	qw.N().S("foo")
+	if bb.String() != "foo" {
+		t.Fatalf("unexpected output: %q. Expecting %q", bb.String(), "foo")
+	}
+	qw.E().S("<bar>")
+	if bb.String() != "foo&lt;bar&gt;" {
+		t.Fatalf("unexpected output: %q. Expecting %q", bb.String(), "foo&lt;bar&gt;")
+	}
+	qw.N().D(42)
+	if bb.String() != "foo&lt;bar&gt;42" {
+		t.Fatalf("unexpected output: %q. Expecting %q", bb.String(), "foo&lt;bar&gt;42")
+	}
+}
+
+func TestWriterBufio(t *testing.T) {
+	f := func(bufSize int) {
+		t.Helper()
+
+		var bb bytes.Buffer
+		bw := bufio.NewWriterSize(&bb, bufSize)
+		qw := AcquireWriter(bw)
+		var expected bytes.Buffer
+		for i := 0; i < 100; i++ {
+			qw.N().S("<a>")
+			qw.E().S("<b>")
+			qw.N().D(i * 1234567)
+			qw.E().DNSep(-i*1234567, ".")
+			qw.N().FPrec(float64(i)/3, i%20)
+			qw.N().F(1e100 * float64(i))
+			fmt.Fprintf(&expected, "<a>&lt;b&gt;%d%s%s%s", i*1234567,
+				appendIntSep(nil, -i*1234567, "."), strconv.FormatFloat(float64(i)/3, 'f', i%20, 64),
+				strconv.FormatFloat(1e100*float64(i), 'f', -1, 64))
+		}
+		ReleaseWriter(qw)
+
+		// The pooled writer mustn't refer to bw buffer after the release.
+		qw = AcquireWriter(&bytes.Buffer{})
+		qw.N().D(1234567890)
+		qw.N().F(1.5)
+		ReleaseWriter(qw)
+
+		if err := bw.Flush(); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if bb.String() != expected.String() {
+			t.Fatalf("unexpected output for bufSize=%d: %q. Expecting %q", bufSize, bb.String(), expected.String())
+		}
+	}
+	f(16)
+	f(100)
+	f(4096)
+
+	// write errors are sticky
+	bw := bufio.NewWriterSize(&testFailingWriter{n: 20}, 16)
+	qw := AcquireWriter(bw)
+	for i := 0; i < 10; i++ {
+		qw.N().S("foobar")
+		qw.N().D(12345678)
+	}
+	if err := qw.Err(); err != errTestFailingWriter {
+		t.Fatalf("unexpected error: %v. Expecting %v", err, errTestFailingWriter)
+	}
+	ReleaseWriter(qw)
+}
+
+func TestCountingWriter(t *testing.T) {
+	f := func(w io.Writer, output func() string) {
+		t.Helper()
+
+		qw := AcquireCountingWriter(w)
+		qw.N().S("foo")
+		qw.E().S("<bar>")
+		qw.N().D(1234)
+		qw.E().Z([]byte("&"))
+		qw.N().F(1.5)
+		n := ReleaseCountingWriter(qw)
+
+		expectedS := "foo&lt;bar&gt;1234&amp;1.5"
+		if s := output(); s != expectedS {
+			t.Fatalf("unexpected output: %q. Expecting %q", s, expectedS)
+		}
+		if n != int64(len(expectedS)) {
+			t.Fatalf("unexpected number of bytes written: %d. Expecting %d", n, len(expectedS))
+		}
+	}
+
+	var bb bytes.Buffer
+	f(&bb, bb.String)
+	var bbWriteOnly bytes.Buffer
+	f(writeOnlyWriter{&bbWriteOnly}, bbWriteOnly.String)
+	sw := &testStringWriter{}
+	f(sw, sw.b.String)
+
+	// partial writes are counted on error
+	qw := AcquireCountingWriter(&testFailingWriter{n: 5})
+	qw.N().S("foobar")
+	qw.N().S("baz")
+	if err := qw.Err(); err != errTestFailingWriter {
+		t.Fatalf("unexpected error: %v. Expecting %v", err, errTestFailingWriter)
+	}
+	if n := ReleaseCountingWriter(qw); n != 5 {
+		t.Fatalf("unexpected number of bytes written: %d. Expecting 5", n)
+	}
+}
+
+func TestWriterErr(t *testing.T) {
+	w := &testFailingWriter{n: 20}
+	qw := AcquireWriter(w)
+	if err := qw.Err(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	qw.N().S("foo")
+	qw.E().S("<bar>")
+	if err := qw.Err(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	qw.E().S("<baz>")
+	if err := qw.Err(); err != errTestFailingWriter {
+		t.Fatalf("unexpected error: %v. Expecting %v", err, errTestFailingWriter)
+	}
+	qw.N().S("aaa")
+	if err := qw.Err(); err != errTestFailingWriter {
+		t.Fatalf("unexpected error: %v. Expecting %v", err, errTestFailingWriter)
+	}
+	ReleaseWriter(qw)
+
+	// errors are reset on release
+	qw = AcquireWriter(&bytes.Buffer{})
+	if err := qw.Err(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	ReleaseWriter(qw)
+}
+
+func TestWriterEscaper(t *testing.T) {
+	var bb bytes.Buffer
+	var ew *testEscaper
+	qw := AcquireWriterEscaper(&bb, func(dst io.Writer) io.Writer {
+		ew = &testEscaper{w: dst}
+		return ew
+	})
+	qw.E().S("<a>")
+	qw.N().S("<b>")
+	qw.E().D(42)
+	qw.E().Z([]byte("c&d"))
+	expectedS := "[<a>]<b>[42][c&d]"
+	if bb.String() != expectedS {
+		t.Fatalf("unexpected output: %q. Expecting %q", bb.String(), expectedS)
+	}
+	if ew.calls != 3 {
+		t.Fatalf("unexpected number of escaper calls: %d. Expecting 3", ew.calls)
+	}
+	ReleaseWriter(qw)
+
+	// write errors are visible in Err()
+	w := &testFailingWriter{n: 3}
+	qw = AcquireWriterEscaper(w, func(dst io.Writer) io.Writer {
+		return &testEscaper{w: dst}
+	})
+	qw.E().S("foo")
+	if err := qw.Err(); err != errTestFailingWriter {
+		t.Fatalf("unexpected error: %v. Expecting %v", err, errTestFailingWriter)
+	}
+	ReleaseWriter(qw)
+
+	// html escaping is used by the writers acquired via AcquireWriter
+	bb.Reset()
+	qw = AcquireWriter(&bb)
+	qw.E().S("<a>")
+	if bb.String() != "&lt;a&gt;" {
+		t.Fatalf("unexpected output: %q. Expecting %q", bb.String(), "&lt;a&gt;")
+	}
+	ReleaseWriter(qw)
+}
+
+// testEscaper wraps the written data into brackets.
+type testEscaper struct {
+	w     io.Writer
+	calls int
+}
+
+func (w *testEscaper) Write(p []byte) (int, error) {
+	w.calls++
+	if _, err := fmt.Fprintf(w.w, "[%s]", p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+var errTestFailingWriter = errors.New("failing writer")
+
+// testFailingWriter fails after writing n bytes.
+type testFailingWriter struct {
+	n int
+}
+
+func (w *testFailingWriter) Write(p []byte) (int, error) {
+	if len(p) > w.n {
+		n := w.n
+		w.n = 0
+		return n, errTestFailingWriter
+	}
+	w.n -= len(p)
+	return len(p), nil
+}
+
+type testStringWriter struct {
+	b                bytes.Buffer
+	err              error
+	writeStringCalls int
+}
+
+func (w *testStringWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	return w.b.Write(p)
+}
+
+func (w *testStringWriter) WriteString(s string) (int, error) {
+	w.writeStringCalls++
+	if w.err != nil {
+		return 0, w.err
+	}
+	return w.b.WriteString(s)
+}
+
 func TestQWriterZ(t *testing.T) {
 	testQWriter(t, func(wn, we *QWriter) string {
 		s := "\u0000" + `foo<>&'" bar
@@ -167,6 +447,84 @@ func TestQWriterV(t *testing.T) {
 	})
 }
 
+func TestQWriterPrintf(t *testing.T) {
+	testQWriter(t, func(wn, we *QWriter) string {
+		format := "%d items: %q %s %v"
+		args := []interface{}{42, "<a>", "b&c", []int{1, 2}}
+		s := fmt.Sprintf(format, args...)
+		expectedS := s + `42 items: &quot;&lt;a&gt;&quot; b&amp;c [1 2]`
+		wn.Printf(format, args...)
+		we.Printf(format, args...)
+		return expectedS
+	})
+}
+
+func TestQWriterCopy(t *testing.T) {
+	testQWriter(t, func(wn, we *QWriter) string {
+		wn.Copy(strings.NewReader("<a>"))
+		we.Copy(strings.NewReader("<b>"))
+		wn.Copy(strings.NewReader(""))
+		return "<a>&lt;b&gt;"
+	})
+}
+
+func TestQWriterCopyErr(t *testing.T) {
+	// write error
+	w := &testFailingWriter{n: 5}
+	qw := AcquireWriter(w)
+	qw.N().Copy(strings.NewReader("foobar"))
+	if err := qw.Err(); err != errTestFailingWriter {
+		t.Fatalf("unexpected error: %v. Expecting %v", err, errTestFailingWriter)
+	}
+	ReleaseWriter(qw)
+
+	// read error stops subsequent writes
+	var bb bytes.Buffer
+	qw = AcquireWriter(&bb)
+	errRead := errors.New("read error")
+	qw.N().Copy(io.MultiReader(strings.NewReader("foo"), iotest.ErrReader(errRead)))
+	if err := qw.Err(); err != errRead {
+		t.Fatalf("unexpected error: %v. Expecting %v", err, errRead)
+	}
+	qw.N().S("bar")
+	if bb.String() != "foo" {
+		t.Fatalf("unexpected output: %q. Expecting %q", bb.String(), "foo")
+	}
+	ReleaseWriter(qw)
+}
+
+func TestQWriterDN(t *testing.T) {
+	testQWriter(t, func(wn, we *QWriter) string {
+		wn.DN(1234567)
+		wn.S(" ")
+		we.DN(-1000)
+		wn.S(" ")
+		wn.DN(0)
+		wn.S(" ")
+		we.DN(-999)
+		wn.S(" ")
+		wn.DN(100000)
+		wn.S(" ")
+		we.DN(-2147483648)
+		return "1,234,567 -1,000 0 -999 100,000 -2,147,483,648"
+	})
+}
+
+func TestQWriterDNSep(t *testing.T) {
+	testQWriter(t, func(wn, we *QWriter) string {
+		wn.DNSep(1234567, ".")
+		wn.S(" ")
+		we.DNSep(-1000, ".")
+		wn.S(" ")
+		wn.DNSep(0, ".")
+		wn.S(" ")
+		we.DNSep(12345, "'")
+		wn.S(" ")
+		wn.DNSep(1234, "")
+		return "1.234.567 -1.000 0 12&#39;345 1234"
+	})
+}
+
 func TestQWriterF(t *testing.T) {
 	testQWriter(t, func(wn, we *QWriter) string {
 		f := 1.9234
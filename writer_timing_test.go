@@ -1,6 +1,8 @@
 package quicktemplate
 
 import (
+	"fmt"
+	"io"
 	"testing"
 )
 
@@ -32,6 +34,38 @@ func BenchmarkQWriterVInt(b *testing.B) {
 	})
 }
 
+func BenchmarkQWriterPrintf(b *testing.B) {
+	n := 1233455
+	s := createTestS(10)
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		var w QWriter
+		bb := AcquireByteBuffer()
+		w.w = bb
+		for pb.Next() {
+			w.Printf("%d items: %s", n, s)
+			bb.Reset()
+		}
+		ReleaseByteBuffer(bb)
+	})
+}
+
+func BenchmarkQWriterSprintf(b *testing.B) {
+	n := 1233455
+	s := createTestS(10)
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		var w QWriter
+		bb := AcquireByteBuffer()
+		w.w = bb
+		for pb.Next() {
+			w.S(fmt.Sprintf("%d items: %s", n, s))
+			bb.Reset()
+		}
+		ReleaseByteBuffer(bb)
+	})
+}
+
 func BenchmarkQWriterQ1(b *testing.B) {
 	benchmarkQWriterQ(b, 1)
 }
@@ -137,6 +171,41 @@ func benchmarkQWriterU(b *testing.B, size int) {
 	})
 }
 
+func BenchmarkQWriterA1(b *testing.B) {
+	benchmarkQWriterA(b, 1)
+}
+
+func BenchmarkQWriterA10(b *testing.B) {
+	benchmarkQWriterA(b, 10)
+}
+
+func BenchmarkQWriterA100(b *testing.B) {
+	benchmarkQWriterA(b, 100)
+}
+
+func BenchmarkQWriterA1K(b *testing.B) {
+	benchmarkQWriterA(b, 1000)
+}
+
+func BenchmarkQWriterA10K(b *testing.B) {
+	benchmarkQWriterA(b, 10000)
+}
+
+func benchmarkQWriterA(b *testing.B, size int) {
+	s := createTestS(size)
+	b.SetBytes(int64(size))
+	b.RunParallel(func(pb *testing.PB) {
+		var w QWriter
+		bb := AcquireByteBuffer()
+		w.w = bb
+		for pb.Next() {
+			w.A(s)
+			bb.Reset()
+		}
+		ReleaseByteBuffer(bb)
+	})
+}
+
 func BenchmarkQWriterF(b *testing.B) {
 	f := 123.456
 	b.RunParallel(func(pb *testing.PB) {
@@ -165,6 +234,23 @@ func BenchmarkQWriterD(b *testing.B) {
 	})
 }
 
+// BenchmarkQWriterDEscaped measures the overhead of html escaping
+// for integers, which {%d %} tag avoids by writing them via Writer.N.
+func BenchmarkQWriterDEscaped(b *testing.B) {
+	n := 123456
+	b.RunParallel(func(pb *testing.PB) {
+		bb := AcquireByteBuffer()
+		qw := AcquireWriter(bb)
+		w := qw.E()
+		for pb.Next() {
+			w.D(n)
+			bb.Reset()
+		}
+		ReleaseWriter(qw)
+		ReleaseByteBuffer(bb)
+	})
+}
+
 func BenchmarkQWriterZ1(b *testing.B) {
 	benchmarkQWriterZ(b, 1)
 }
@@ -235,6 +321,40 @@ func benchmarkQWriterS(b *testing.B, size int) {
 	})
 }
 
+func BenchmarkQWriterSWriteString1K(b *testing.B) {
+	benchmarkQWriterSAcquired(b, 1000, func(bb *ByteBuffer) io.Writer { return bb })
+}
+
+func BenchmarkQWriterSWriteOnly1K(b *testing.B) {
+	benchmarkQWriterSAcquired(b, 1000, func(bb *ByteBuffer) io.Writer { return writeOnlyWriter{bb} })
+}
+
+func benchmarkQWriterSAcquired(b *testing.B, size int, newWriter func(bb *ByteBuffer) io.Writer) {
+	s := createTestS(size)
+	b.SetBytes(int64(size))
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		bb := AcquireByteBuffer()
+		qw := AcquireWriter(newWriter(bb))
+		w := qw.N()
+		for pb.Next() {
+			w.S(s)
+			bb.Reset()
+		}
+		ReleaseWriter(qw)
+		ReleaseByteBuffer(bb)
+	})
+}
+
+// writeOnlyWriter hides WriteString method of the underlying writer.
+type writeOnlyWriter struct {
+	w io.Writer
+}
+
+func (w writeOnlyWriter) Write(p []byte) (int, error) {
+	return w.w.Write(p)
+}
+
 func createTestS(size int) string {
 	return string(createTestZ(size))
 }
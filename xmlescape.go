@@ -0,0 +1,32 @@
+package quicktemplate
+
+// appendXMLEscape appends src escaped according to xml rules to dst.
+//
+// Unlike html escaping, the apostrophe is escaped to &apos;.
+func appendXMLEscape(dst []byte, src string) []byte {
+	n := len(src)
+	if n > 0 {
+		// Hint the compiler to remove bounds checks in the loop below.
+		_ = src[n-1]
+	}
+	for i := 0; i < n; i++ {
+		c := src[i]
+		switch c {
+		case '<':
+			dst = append(dst, strLT...)
+		case '>':
+			dst = append(dst, strGT...)
+		case '"':
+			dst = append(dst, strQuot...)
+		case '\'':
+			dst = append(dst, strXMLApos...)
+		case '&':
+			dst = append(dst, strAmp...)
+		default:
+			dst = append(dst, c)
+		}
+	}
+	return dst
+}
+
+var strXMLApos = []byte("&apos;")
@@ -0,0 +1,20 @@
+package quicktemplate
+
+import (
+	"testing"
+)
+
+func TestAppendXMLEscape(t *testing.T) {
+	testAppendXMLEscape(t, "", "")
+	testAppendXMLEscape(t, "foo bar", "foo bar")
+	testAppendXMLEscape(t, "привет", "привет")
+	testAppendXMLEscape(t, "Rock'n'Roll", "Rock&apos;n&apos;Roll")
+	testAppendXMLEscape(t, `<a href="x?a=1&b=2">`, "&lt;a href=&quot;x?a=1&amp;b=2&quot;&gt;")
+}
+
+func testAppendXMLEscape(t *testing.T, s, expectedResult string) {
+	result := appendXMLEscape(nil, s)
+	if string(result) != expectedResult {
+		t.Fatalf("unexpected result %q. Expecting %q. str=%q", result, expectedResult, s)
+	}
+}